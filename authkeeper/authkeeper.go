@@ -2,12 +2,10 @@ package authkeeper
 
 import (
 	"context"
-	"crypto/tls"
 	"net/http"
+	"os"
 	"strings"
-	"time"
 
-	"github.com/MicahParks/keyfunc/v3"
 	godbus "github.com/godbus/dbus/v5"
 	"github.com/modelcontextprotocol/go-sdk/auth"
 	"github.com/openSUSE/systemd-mcp/dbus"
@@ -17,21 +15,52 @@ import (
 type AuthKeeper interface {
 	IsReadAuthorized(ctx context.Context) (bool, error)
 	IsWriteAuthorized(ctx context.Context) (bool, error)
+	// Preview reports if a read or, with write set, a write would be
+	// authorized without asking the user
+	Preview(ctx context.Context, write bool) (Preview, error)
 	Deauthorize() *godbus.Error
 	Close() error
 }
 
+// Preview is the outcome of an authorization check which wasn't performed
+type Preview struct {
+	Allowed bool `json:"allowed"`
+	// the user would be asked to authenticate
+	Interactive bool `json:"interactive,omitempty"`
+	// noauth, root, polkit, oauth2, peercred, session or grant
+	Mechanism string `json:"mechanism"`
+	Reason    string `json:"reason,omitempty"`
+}
+
 type noAuth struct {
 	readAllowed  bool
 	writeAllowed bool
 }
 
+func (a *noAuth) refusal(ctx context.Context, write, allowed bool) error {
+	if allowed {
+		return nil
+	}
+	return &AuthError{Code: AuthDenied, Message: "not allowed by the server configuration", Permission: permissionOf(ctx, write)}
+}
+
 func (a *noAuth) IsReadAuthorized(ctx context.Context) (bool, error) {
-	return a.readAllowed, nil
+	return a.readAllowed, a.refusal(ctx, false, a.readAllowed)
 }
 
 func (a *noAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
-	return a.writeAllowed, nil
+	return a.writeAllowed, a.refusal(ctx, true, a.writeAllowed)
+}
+
+func (a *noAuth) Preview(ctx context.Context, write bool) (Preview, error) {
+	preview := Preview{Mechanism: "noauth", Allowed: a.readAllowed}
+	if write {
+		preview.Allowed = a.writeAllowed
+	}
+	if !preview.Allowed {
+		preview.Reason = "not allowed by the server configuration"
+	}
+	return preview, nil
 }
 
 func (a *noAuth) Deauthorize() *godbus.Error {
@@ -47,11 +76,33 @@ type polkitAuth struct {
 }
 
 func (a *polkitAuth) IsReadAuthorized(ctx context.Context) (bool, error) {
-	return a.dbus.IsReadAuthorized(ctx)
+	allowed, err := a.dbus.IsReadAuthorized(ctx)
+	return allowed, polkitRefusal(ctx, false, allowed, err)
 }
 
 func (a *polkitAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
-	return a.dbus.IsWriteAuthorized(ctx)
+	allowed, err := a.dbus.IsWriteAuthorized(ctx)
+	return allowed, polkitRefusal(ctx, true, allowed, err)
+}
+
+func (a *polkitAuth) Preview(ctx context.Context, write bool) (Preview, error) {
+	if os.Geteuid() == 0 {
+		return Preview{Allowed: true, Mechanism: "root"}, nil
+	}
+	authorized, challenge, err := a.dbus.Preview(ctx, write)
+	if err != nil {
+		return Preview{}, err
+	}
+	preview := Preview{Allowed: authorized, Interactive: challenge, Mechanism: "polkit"}
+	switch {
+	case authorized:
+		preview.Reason = "granted by polkit"
+	case challenge:
+		preview.Reason = "polkit would ask the user to authenticate"
+	default:
+		preview.Reason = "denied by polkit"
+	}
+	return preview, nil
 }
 
 func (a *polkitAuth) Deauthorize() *godbus.Error {
@@ -68,6 +119,9 @@ func (a *polkitAuth) Close() error {
 type OAuth2Provider interface {
 	AuthKeeper
 	VerifyJWT(ctx context.Context, tokenString string, r *http.Request) (*auth.TokenInfo, error)
+	// Middleware rejects the http requests without a valid bearer token
+	// carrying the scopes
+	Middleware(scopes []string) func(http.Handler) http.Handler
 	JwksUri() string
 }
 
@@ -76,12 +130,47 @@ type oauth2Auth struct {
 	context context.Context
 }
 
+// refusal returns the error of a refused token, nil if it was allowed
+func (a *oauth2Auth) refusal(ctx context.Context, write, allowed bool, err error) error {
+	if allowed && err == nil {
+		return nil
+	}
+	if auth.TokenInfoFromContext(ctx) == nil {
+		return &AuthError{Code: AuthRequired, Message: "no bearer token", Hint: "send a bearer token of the controller", Err: err}
+	}
+	e := &AuthError{Code: AuthDenied, Message: "the bearer token doesn't allow the call", Hint: "request a token with the scope mcp:read", Err: err}
+	if write {
+		e.Hint = "request a token with the scope mcp:write and the role mcp-admin"
+	}
+	if err != nil {
+		e.Message = err.Error()
+	}
+	return e
+}
+
 func (a *oauth2Auth) IsReadAuthorized(ctx context.Context) (bool, error) {
-	return a.oauth.IsReadAuthorized(ctx)
+	allowed, err := a.oauth.IsReadAuthorized(ctx)
+	return allowed, a.refusal(ctx, false, allowed, err)
 }
 
 func (a *oauth2Auth) IsWriteAuthorized(ctx context.Context) (bool, error) {
-	return a.oauth.IsWriteAuthorized(ctx)
+	allowed, err := a.oauth.IsWriteAuthorized(ctx)
+	return allowed, a.refusal(ctx, true, allowed, err)
+}
+
+func (a *oauth2Auth) Preview(ctx context.Context, write bool) (Preview, error) {
+	// the scopes of the token are checked, nobody is asked
+	check := a.oauth.IsReadAuthorized
+	if write {
+		check = a.oauth.IsWriteAuthorized
+	}
+	preview := Preview{Mechanism: "oauth2"}
+	allowed, err := check(ctx)
+	preview.Allowed = allowed && err == nil
+	if err != nil {
+		preview.Reason = err.Error()
+	}
+	return preview, nil
 }
 
 func (a *oauth2Auth) Deauthorize() *godbus.Error {
@@ -96,6 +185,10 @@ func (a *oauth2Auth) VerifyJWT(ctx context.Context, tokenString string, r *http.
 	return a.oauth.VerifyJWT(ctx, tokenString, r)
 }
 
+func (a *oauth2Auth) Middleware(scopes []string) func(http.Handler) http.Handler {
+	return a.oauth.Middleware(scopes)
+}
+
 func (a *oauth2Auth) JwksUri() string {
 	return a.oauth.JwksUri
 }
@@ -124,36 +217,19 @@ func NewNoAuth(readAllowed, writeAllowed bool) (AuthKeeper, error) {
 	}, nil
 }
 
-// remote auth with oauth2
-func NewOauth(controller string, skipVerify bool) (AuthKeeper, error) {
+// remote auth with oauth2, the tokens are validated against the keys and
+// the issuer of the controller
+func NewOauth(controller string, opts remoteauth.Options) (AuthKeeper, error) {
 	if !strings.HasPrefix(controller, "http") {
 		controller = "http://" + controller
 	}
-	jwksURI, err := remoteauth.GetJwksURI(controller, skipVerify)
-	if err != nil {
-		return nil, err
-	}
 	ctx := context.Background()
-
-	override := keyfunc.Override{}
-	if skipVerify {
-		override.Client = &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
-			Timeout: 10 * time.Second,
-		}
-	}
-
-	keyf, err := keyfunc.NewDefaultOverrideCtx(ctx, []string{jwksURI}, override)
+	oauth, err := remoteauth.New(ctx, controller, opts)
 	if err != nil {
 		return nil, err
 	}
 	return &oauth2Auth{
-		oauth: &remoteauth.Oauth2Auth{
-			KeyFunc: keyf,
-			JwksUri: jwksURI,
-		},
+		oauth:   oauth,
 		context: ctx,
 	}, nil
 }
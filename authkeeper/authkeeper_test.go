@@ -29,3 +29,19 @@ func TestDeauthorizeNoAuth(t *testing.T) {
 	errDeauth := auth.Deauthorize()
 	assert.Nil(t, errDeauth)
 }
+
+func TestPreviewNoAuth(t *testing.T) {
+	auth, err := authkeeper.NewNoAuth(true, false)
+	assert.NoError(t, err)
+
+	preview, err := auth.Preview(context.Background(), false)
+	assert.NoError(t, err)
+	assert.True(t, preview.Allowed)
+	assert.Equal(t, "noauth", preview.Mechanism)
+
+	preview, err = auth.Preview(context.Background(), true)
+	assert.NoError(t, err)
+	assert.False(t, preview.Allowed)
+	assert.False(t, preview.Interactive)
+	assert.NotEmpty(t, preview.Reason)
+}
@@ -0,0 +1,95 @@
+package authkeeper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type toolCallKey struct{}
+
+// ElicitAuth asks the user of the client to approve the write calls the
+// authorization refused, e.g. as no polkit agent runs next to a client using
+// stdio. The approval is requested with MCP elicitation and only if the
+// client supports it.
+type ElicitAuth struct {
+	AuthKeeper
+}
+
+func NewElicitAuth(next AuthKeeper) *ElicitAuth {
+	return &ElicitAuth{AuthKeeper: next}
+}
+
+// Middleware passes the tool calls in the context, so that the approval
+// describes the call and is requested in its session
+func (a *ElicitAuth) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if call, ok := req.(*mcp.CallToolRequest); ok && call.Params != nil && call.Session != nil {
+			ctx = context.WithValue(ctx, toolCallKey{}, call)
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// elicitableCall returns the tool call of the context if its client
+// supports elicitation
+func elicitableCall(ctx context.Context) (*mcp.CallToolRequest, bool) {
+	call, ok := ctx.Value(toolCallKey{}).(*mcp.CallToolRequest)
+	if !ok {
+		return nil, false
+	}
+	params := call.Session.InitializeParams()
+	if params == nil || params.Capabilities == nil || params.Capabilities.Elicitation == nil {
+		return nil, false
+	}
+	return call, true
+}
+
+// approvalMessage describes the call and the polkit action it needs
+func approvalMessage(ctx context.Context, call *mcp.CallToolRequest) string {
+	return fmt.Sprintf("Allow the call of %s with the arguments %s, which needs the authorization %s?", call.Params.Name, call.Params.Arguments, permissionOf(ctx, true))
+}
+
+func (a *ElicitAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
+	allowed, err := a.AuthKeeper.IsWriteAuthorized(ctx)
+	if allowed && err == nil {
+		return true, nil
+	}
+	call, ok := elicitableCall(ctx)
+	if !ok {
+		return allowed, err
+	}
+	slog.Debug("asking the client to approve the call", "tool", call.Params.Name, "reason", err)
+	res, elicitErr := call.Session.Elicit(ctx, &mcp.ElicitParams{
+		Message:         approvalMessage(ctx, call),
+		RequestedSchema: &jsonschema.Schema{Type: "object"},
+	})
+	if elicitErr != nil {
+		slog.Debug("couldn't ask the client for approval", "error", elicitErr)
+		return allowed, err
+	}
+	if res.Action != "accept" {
+		return false, &AuthError{
+			Code:       AuthDenied,
+			Message:    fmt.Sprintf("the call of %s was not approved by the user", call.Params.Name),
+			Permission: permissionOf(ctx, true),
+		}
+	}
+	slog.Info("call approved by the user of the client", "tool", call.Params.Name)
+	return true, nil
+}
+
+func (a *ElicitAuth) Preview(ctx context.Context, write bool) (Preview, error) {
+	preview, err := a.AuthKeeper.Preview(ctx, write)
+	if err != nil || preview.Allowed || !write {
+		return preview, err
+	}
+	if _, ok := elicitableCall(ctx); ok {
+		preview.Interactive = true
+		preview.Reason = "the user of the client would be asked to approve the call"
+	}
+	return preview, nil
+}
@@ -0,0 +1,68 @@
+package authkeeper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// callWrite calls a tool checking the write authorization from a client
+// answering the elicitation with action, no handler is set if it's empty
+func callWrite(t *testing.T, action string) (*mcp.CallToolResult, []string) {
+	keeper, _ := NewNoAuth(true, false)
+	a := NewElicitAuth(keeper)
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "change_unit_state"}, func(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
+		allowed, err := a.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsManageAction))
+		if err != nil {
+			return nil, nil, err
+		}
+		if !allowed {
+			return nil, nil, assert.AnError
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "done"}}}, nil, nil
+	})
+	server.AddReceivingMiddleware(a.Middleware)
+
+	var messages []string
+	opts := &mcp.ClientOptions{}
+	if action != "" {
+		opts.ElicitationHandler = func(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+			messages = append(messages, req.Params.Message)
+			return &mcp.ElicitResult{Action: action}, nil
+		}
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "client"}, opts)
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(context.Background(), st, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { ss.Close() })
+	cs, err := client.Connect(context.Background(), ct, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { cs.Close() })
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "change_unit_state", Arguments: map[string]any{}})
+	require.NoError(t, err)
+	return res, messages
+}
+
+func TestElicitAuth(t *testing.T) {
+	res, messages := callWrite(t, "accept")
+	assert.False(t, res.IsError)
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "change_unit_state")
+	assert.Contains(t, messages[0], dbus.UnitsManageAction)
+
+	res, messages = callWrite(t, "decline")
+	assert.True(t, res.IsError)
+	assert.Contains(t, res.Content[0].(*mcp.TextContent).Text, "not approved by the user")
+	assert.Len(t, messages, 1)
+
+	// clients without elicitation get the refusal of the authorization
+	res, _ = callWrite(t, "")
+	assert.True(t, res.IsError)
+	assert.Contains(t, res.Content[0].(*mcp.TextContent).Text, "not allowed by the server configuration")
+}
@@ -0,0 +1,101 @@
+package authkeeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+type ErrorCode string
+
+const (
+	// the request carries no credentials, e.g. no bearer token
+	AuthRequired ErrorCode = "AUTH_REQUIRED"
+	// the credentials don't allow the call or the user refused it
+	AuthDenied ErrorCode = "AUTH_DENIED"
+	// the user didn't authenticate in time
+	AuthTimeout ErrorCode = "AUTH_TIMEOUT"
+)
+
+// AuthError is a refused authorization, the results of the tool calls
+// carry it as structured error so that clients can prompt for credentials
+type AuthError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// polkit action the call needs
+	Permission string `json:"permission,omitempty"`
+	// what gets the call authorized, e.g. a command to run
+	Hint string `json:"hint,omitempty"`
+	Err  error  `json:"-"`
+}
+
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// permissionOf returns the polkit action requested in the context
+func permissionOf(ctx context.Context, write bool) string {
+	permission, _ := ctx.Value(dbus.PermissionKey).(string)
+	switch {
+	case permission != "":
+		return permission
+	case write:
+		return dbus.UnitsManageAction
+	default:
+		return dbus.ReadAction
+	}
+}
+
+// polkitRefusal returns the error of a refused polkit authorization, nil if it
+// was allowed
+func polkitRefusal(ctx context.Context, write, allowed bool, err error) error {
+	if allowed && err == nil {
+		return nil
+	}
+	permission := permissionOf(ctx, write)
+	e := &AuthError{
+		Code:       AuthDenied,
+		Message:    fmt.Sprintf("polkit didn't authorize %s", permission),
+		Permission: permission,
+		Hint:       fmt.Sprintf("pkcheck --action-id %s --process %d --allow-user-interaction", permission, os.Getpid()),
+		Err:        err,
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		e.Code = AuthTimeout
+		e.Message = fmt.Sprintf("authorization of %s timed out", permission)
+	} else if err != nil {
+		e.Message = fmt.Sprintf("%s: %s", e.Message, err)
+	}
+	return e
+}
+
+// ErrorMiddleware adds the refused authorization to the structured content
+// of the results of the failed tool calls
+func ErrorMiddleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		result, err := next(ctx, method, req)
+		res, ok := result.(*mcp.CallToolResult)
+		if err != nil || !ok || res == nil || !res.IsError {
+			return result, err
+		}
+		var authErr *AuthError
+		if !errors.As(res.GetError(), &authErr) {
+			return result, err
+		}
+		switch structured := res.StructuredContent.(type) {
+		case nil:
+			res.StructuredContent = map[string]any{"error": authErr}
+		case map[string]any:
+			structured["error"] = authErr
+		}
+		return res, nil
+	}
+}
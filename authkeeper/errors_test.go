@@ -0,0 +1,75 @@
+package authkeeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolkitRefusal(t *testing.T) {
+	ctx := context.WithValue(context.Background(), dbus.PermissionKey, dbus.FilesWriteAction)
+	assert.NoError(t, polkitRefusal(ctx, true, true, nil))
+
+	var authErr *AuthError
+	require.ErrorAs(t, polkitRefusal(ctx, true, false, nil), &authErr)
+	assert.Equal(t, AuthDenied, authErr.Code)
+	assert.Equal(t, dbus.FilesWriteAction, authErr.Permission)
+	assert.Contains(t, authErr.Hint, "pkcheck --action-id "+dbus.FilesWriteAction)
+
+	err := polkitRefusal(context.Background(), false, false, fmt.Errorf("polkit: %w", context.DeadlineExceeded))
+	require.ErrorAs(t, err, &authErr)
+	assert.Equal(t, AuthTimeout, authErr.Code)
+	assert.Equal(t, dbus.ReadAction, authErr.Permission)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPeerCredRefusal(t *testing.T) {
+	a, err := NewPeerCredAuth([]string{"unix-user:4242"}, nil)
+	require.NoError(t, err)
+	var authErr *AuthError
+	_, err = a.IsReadAuthorized(context.Background())
+	require.ErrorAs(t, err, &authErr)
+	assert.Equal(t, AuthRequired, authErr.Code)
+
+	_, err = a.IsWriteAuthorized(WithPeerCred(context.Background(), PeerCred{UID: 4242}))
+	require.ErrorAs(t, err, &authErr)
+	assert.Equal(t, AuthDenied, authErr.Code)
+	assert.Equal(t, "start the server with --listen-write unix-user:4242", authErr.Hint)
+}
+
+func TestErrorMiddleware(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "refused"}, func(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", &AuthError{Code: AuthDenied, Message: "denied", Hint: "ask"})
+	})
+	mcp.AddTool(server, &mcp.Tool{Name: "failed"}, func(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
+		return nil, nil, errors.New("failed")
+	})
+	server.AddReceivingMiddleware(ErrorMiddleware)
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil)
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(context.Background(), st, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { ss.Close() })
+	cs, err := client.Connect(context.Background(), ct, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { cs.Close() })
+
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "refused", Arguments: map[string]any{}})
+	require.NoError(t, err)
+	assert.True(t, res.IsError)
+	assert.Contains(t, res.Content[0].(*mcp.TextContent).Text, "denied")
+	assert.Equal(t, map[string]any{"error": map[string]any{"code": "AUTH_DENIED", "message": "denied", "hint": "ask"}}, res.StructuredContent)
+
+	res, err = cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "failed", Arguments: map[string]any{}})
+	require.NoError(t, err)
+	assert.True(t, res.IsError)
+	assert.Nil(t, res.StructuredContent)
+}
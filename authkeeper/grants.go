@@ -0,0 +1,230 @@
+package authkeeper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Grant is an authorization kept for a session until it expires
+type Grant struct {
+	Permission string    `json:"permission"`
+	Write      bool      `json:"write"`
+	Expires    time.Time `json:"expires"`
+	// seconds until the grant expires
+	Remaining int `json:"remaining"`
+}
+
+type grantKey struct {
+	session    string
+	permission string
+	write      bool
+}
+
+// GrantAuth keeps the read and write authorizations granted to a session
+// for the ttl, e.g. write is allowed for 15 minutes after polkit authorized
+// it, so that the user isn't asked for every call. Expired grants are
+// dropped and have to be authorized again.
+type GrantAuth struct {
+	AuthKeeper
+	ttl time.Duration
+	// replaced by the tests
+	now    func() time.Time
+	mu     sync.Mutex
+	grants map[grantKey]time.Time
+}
+
+func NewGrantAuth(next AuthKeeper, ttl time.Duration) *GrantAuth {
+	return &GrantAuth{
+		AuthKeeper: next,
+		ttl:        ttl,
+		now:        time.Now,
+		grants:     make(map[grantKey]time.Time),
+	}
+}
+
+// keyOf returns the key of the authorization requested in the context
+func keyOf(ctx context.Context, write bool) grantKey {
+	key := grantKey{write: write, permission: permissionOf(ctx, write)}
+	key.session, _ = SessionFromContext(ctx)
+	return key
+}
+
+// granted reports if the authorization was granted and didn't expire yet,
+// the expired grants are dropped
+func (a *GrantAuth) granted(key grantKey) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	for k, expires := range a.grants {
+		if !now.Before(expires) {
+			delete(a.grants, k)
+		}
+	}
+	_, ok := a.grants[key]
+	return ok
+}
+
+func (a *GrantAuth) authorize(ctx context.Context, write bool, next func(context.Context) (bool, error)) (bool, error) {
+	key := keyOf(ctx, write)
+	if a.granted(key) {
+		return true, nil
+	}
+	allowed, err := next(ctx)
+	if allowed && err == nil {
+		a.mu.Lock()
+		a.grants[key] = a.now().Add(a.ttl)
+		a.mu.Unlock()
+	}
+	return allowed, err
+}
+
+func (a *GrantAuth) IsReadAuthorized(ctx context.Context) (bool, error) {
+	return a.authorize(ctx, false, a.AuthKeeper.IsReadAuthorized)
+}
+
+func (a *GrantAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
+	return a.authorize(ctx, true, a.AuthKeeper.IsWriteAuthorized)
+}
+
+func (a *GrantAuth) Preview(ctx context.Context, write bool) (Preview, error) {
+	if a.granted(keyOf(ctx, write)) {
+		return Preview{Allowed: true, Mechanism: "grant", Reason: "granted earlier in this session"}, nil
+	}
+	return a.AuthKeeper.Preview(ctx, write)
+}
+
+// Grants returns the grants of the session which didn't expire yet
+func (a *GrantAuth) Grants(session string) []Grant {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	grants := []Grant{}
+	for k, expires := range a.grants {
+		if k.session != session || !now.Before(expires) {
+			continue
+		}
+		grants = append(grants, Grant{
+			Permission: k.permission,
+			Write:      k.write,
+			Expires:    expires,
+			Remaining:  int(expires.Sub(now).Seconds()),
+		})
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].Permission < grants[j].Permission })
+	return grants
+}
+
+// Renew extends the grants which didn't expire yet by the ttl and returns
+// their number
+func (a *GrantAuth) Renew() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	renewed := 0
+	for k, expires := range a.grants {
+		if now.Before(expires) {
+			a.grants[k] = now.Add(a.ttl)
+			renewed++
+		}
+	}
+	return renewed
+}
+
+type GetAuthStatusParams struct{}
+
+type AuthStatus struct {
+	Session string `json:"session,omitempty"`
+	// seconds a grant is kept
+	TTL    int     `json:"ttl"`
+	Grants []Grant `json:"grants"`
+}
+
+func CreateGetAuthStatusSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[GetAuthStatusParams](nil)
+	return inputSchema
+}
+
+// GetAuthStatus reports the authorizations granted to the session of the
+// caller and the time they remain valid
+func (a *GrantAuth) GetAuthStatus(ctx context.Context, req *mcp.CallToolRequest, params *GetAuthStatusParams) (*mcp.CallToolResult, any, error) {
+	session, _ := SessionFromContext(ctx)
+	if req != nil && req.Session != nil {
+		session = req.Session.ID()
+	}
+	status := AuthStatus{
+		Session: session,
+		TTL:     int(a.ttl.Seconds()),
+		Grants:  a.Grants(session),
+	}
+	jsonBytes, err := json.Marshal(status)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, status, nil
+}
+
+// renewal is the dbus object which lets the user running the server renew
+// the grants, e.g. with
+// busctl call NAME PATH NAME Renew
+type renewal struct {
+	conn   *godbus.Conn
+	grants *GrantAuth
+}
+
+// Renew is called over dbus, only root and the user running the server may
+// renew the grants
+func (r *renewal) Renew(sender godbus.Sender) (uint32, *godbus.Error) {
+	var uid uint32
+	if err := r.conn.BusObject().Call("org.freedesktop.DBus.GetConnectionUnixUser", 0, string(sender)).Store(&uid); err != nil {
+		return 0, godbus.MakeFailedError(err)
+	}
+	if uid != 0 && uid != uint32(os.Getuid()) {
+		return 0, godbus.NewError("org.freedesktop.DBus.Error.AccessDenied", []any{fmt.Sprintf("uid %d may not renew the authorizations", uid)})
+	}
+	renewed := r.grants.Renew()
+	slog.Info("renewed authorizations over dbus", "count", renewed, "uid", uid)
+	return uint32(renewed), nil
+}
+
+// ServeRenewal exports the Renew method under the name and path, on the
+// system bus if running as root and on the session bus otherwise
+func (a *GrantAuth) ServeRenewal(name, path string) (*godbus.Conn, error) {
+	connect := godbus.ConnectSessionBus
+	if os.Geteuid() == 0 {
+		connect = godbus.ConnectSystemBus
+	}
+	conn, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Export(&renewal{conn: conn, grants: a}, godbus.ObjectPath(path), name); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reply, err := conn.RequestName(name, godbus.NameFlagDoNotQueue)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if reply != godbus.RequestNameReplyPrimaryOwner {
+		conn.Close()
+		return nil, fmt.Errorf("dbus name %s is already taken", name)
+	}
+	return conn, nil
+}
@@ -0,0 +1,83 @@
+package authkeeper
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingAuth allows the calls and counts them
+type countingAuth struct {
+	noAuth
+	calls int
+}
+
+func (a *countingAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
+	a.calls++
+	return a.writeAllowed, nil
+}
+
+func TestGrantAuth(t *testing.T) {
+	next := &countingAuth{noAuth: noAuth{writeAllowed: true}}
+	a := NewGrantAuth(next, 15*time.Minute)
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	manage := context.WithValue(WithSession(context.Background(), "s1"), dbus.PermissionKey, dbus.UnitsManageAction)
+
+	for range 3 {
+		allowed, err := a.IsWriteAuthorized(manage)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	assert.Equal(t, 1, next.calls)
+	preview, err := a.Preview(manage, true)
+	require.NoError(t, err)
+	assert.Equal(t, "grant", preview.Mechanism)
+
+	// other actions and sessions are authorized on their own
+	a.IsWriteAuthorized(context.WithValue(manage, dbus.PermissionKey, dbus.FilesWriteAction))
+	a.IsWriteAuthorized(context.WithValue(WithSession(context.Background(), "s2"), dbus.PermissionKey, dbus.UnitsManageAction))
+	assert.Equal(t, 3, next.calls)
+
+	now = now.Add(10 * time.Minute)
+	grants := a.Grants("s1")
+	require.Len(t, grants, 2)
+	assert.Equal(t, Grant{Permission: dbus.FilesWriteAction, Write: true, Expires: now.Add(5 * time.Minute), Remaining: 300}, grants[0])
+
+	// renewed grants are valid for the ttl again
+	assert.Equal(t, 3, a.Renew())
+	assert.Equal(t, 15*60, a.Grants("s1")[0].Remaining)
+
+	// expired grants have to be authorized again
+	now = now.Add(15 * time.Minute)
+	assert.Empty(t, a.Grants("s1"))
+	a.IsWriteAuthorized(manage)
+	assert.Equal(t, 4, next.calls)
+
+	// refused authorizations aren't kept
+	next.writeAllowed = false
+	allowed, _ := a.IsWriteAuthorized(context.WithValue(manage, dbus.PermissionKey, dbus.FilesWriteAction))
+	assert.False(t, allowed)
+	assert.Len(t, a.Grants("s1"), 1)
+}
+
+func TestGetAuthStatus(t *testing.T) {
+	a := NewGrantAuth(&countingAuth{noAuth: noAuth{writeAllowed: true}}, time.Minute)
+	ctx := WithSession(context.Background(), "s1")
+	a.IsWriteAuthorized(ctx)
+	res, _, err := a.GetAuthStatus(ctx, nil, &GetAuthStatusParams{})
+	require.NoError(t, err)
+	var status AuthStatus
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &status))
+	assert.Equal(t, "s1", status.Session)
+	assert.Equal(t, 60, status.TTL)
+	require.Len(t, status.Grants, 1)
+	assert.Equal(t, dbus.UnitsManageAction, status.Grants[0].Permission)
+	assert.True(t, status.Grants[0].Write)
+}
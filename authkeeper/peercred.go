@@ -0,0 +1,217 @@
+package authkeeper
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+
+	godbus "github.com/godbus/dbus/v5"
+	"golang.org/x/sys/unix"
+)
+
+// PeerCred are the credentials of the process connected to the unix socket
+type PeerCred struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+type peerCredKey struct{}
+
+// WithPeerCred returns a context carrying the credentials of the peer
+func WithPeerCred(ctx context.Context, cred PeerCred) context.Context {
+	return context.WithValue(ctx, peerCredKey{}, cred)
+}
+
+// PeerCredFromContext returns the credentials of the peer of the request
+func PeerCredFromContext(ctx context.Context) (PeerCred, bool) {
+	cred, ok := ctx.Value(peerCredKey{}).(PeerCred)
+	return cred, ok
+}
+
+// PeerCredConnContext reads the credentials of the peer with SO_PEERCRED when
+// a unix socket is accepted, it's used as ConnContext of the http server
+func PeerCredConnContext(ctx context.Context, c net.Conn) context.Context {
+	conn, ok := c.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return ctx
+	}
+	var ucred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil || credErr != nil {
+		return ctx
+	}
+	return WithPeerCred(ctx, PeerCred{PID: ucred.Pid, UID: ucred.Uid, GID: ucred.Gid})
+}
+
+// principal is a user or a group given like in polkit, e.g. unix-user:alice
+// or unix-group:wheel
+type principal struct {
+	group bool
+	id    uint32
+}
+
+func parsePrincipal(s string) (principal, error) {
+	kind, name, _ := strings.Cut(s, ":")
+	p := principal{group: kind == "unix-group"}
+	if kind != "unix-user" && kind != "unix-group" || name == "" {
+		return p, fmt.Errorf("invalid principal %q, use unix-user:NAME or unix-group:NAME", s)
+	}
+	id, err := strconv.ParseUint(name, 10, 32)
+	if err != nil {
+		var lookup string
+		if p.group {
+			g, gerr := user.LookupGroup(name)
+			if gerr != nil {
+				return p, gerr
+			}
+			lookup = g.Gid
+		} else {
+			u, uerr := user.Lookup(name)
+			if uerr != nil {
+				return p, uerr
+			}
+			lookup = u.Uid
+		}
+		if id, err = strconv.ParseUint(lookup, 10, 32); err != nil {
+			return p, err
+		}
+	}
+	p.id = uint32(id)
+	return p, nil
+}
+
+func parsePrincipals(list []string) ([]principal, error) {
+	principals := make([]principal, 0, len(list))
+	for _, s := range list {
+		p, err := parsePrincipal(s)
+		if err != nil {
+			return nil, err
+		}
+		principals = append(principals, p)
+	}
+	return principals, nil
+}
+
+// peerCredAuth authorizes the processes connected to the unix socket by their
+// user and groups, nobody is asked
+type peerCredAuth struct {
+	read  []principal
+	write []principal
+	// looks up the supplementary groups of a user, replaced by the tests
+	groups func(uid uint32) []uint32
+}
+
+// NewPeerCredAuth authorizes the peers of the unix socket. Root and the user
+// running the server may read and write, the other users need to be listed
+// as reader or writer, writers may also read.
+func NewPeerCredAuth(readers, writers []string) (AuthKeeper, error) {
+	read, err := parsePrincipals(readers)
+	if err != nil {
+		return nil, err
+	}
+	write, err := parsePrincipals(writers)
+	if err != nil {
+		return nil, err
+	}
+	return &peerCredAuth{read: read, write: write, groups: supplementaryGroups}, nil
+}
+
+func supplementaryGroups(uid uint32) []uint32 {
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return nil
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil
+	}
+	var gids []uint32
+	for _, id := range ids {
+		if gid, err := strconv.ParseUint(id, 10, 32); err == nil {
+			gids = append(gids, uint32(gid))
+		}
+	}
+	return gids
+}
+
+// matches reports if the peer is one of the principals
+func (a *peerCredAuth) matches(cred PeerCred, principals []principal) bool {
+	var gids []uint32
+	for _, p := range principals {
+		if !p.group {
+			if p.id == cred.UID {
+				return true
+			}
+			continue
+		}
+		if p.id == cred.GID {
+			return true
+		}
+		if gids == nil {
+			gids = a.groups(cred.UID)
+		}
+		if slices.Contains(gids, p.id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *peerCredAuth) authorize(ctx context.Context, write bool) (bool, error) {
+	cred, ok := PeerCredFromContext(ctx)
+	if !ok {
+		return false, &AuthError{Code: AuthRequired, Message: "no peer credentials in context", Hint: "connect over the --listen socket"}
+	}
+	if cred.UID == 0 || cred.UID == uint32(os.Getuid()) {
+		return true, nil
+	}
+	if a.matches(cred, a.write) || (!write && a.matches(cred, a.read)) {
+		return true, nil
+	}
+	access := "read"
+	if write {
+		access = "write"
+	}
+	return false, &AuthError{
+		Code:    AuthDenied,
+		Message: fmt.Sprintf("uid %d isn't allowed to %s", cred.UID, access),
+		Hint:    fmt.Sprintf("start the server with --listen-%s unix-user:%d", access, cred.UID),
+	}
+}
+
+func (a *peerCredAuth) IsReadAuthorized(ctx context.Context) (bool, error) {
+	return a.authorize(ctx, false)
+}
+
+func (a *peerCredAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
+	return a.authorize(ctx, true)
+}
+
+func (a *peerCredAuth) Preview(ctx context.Context, write bool) (Preview, error) {
+	allowed, err := a.authorize(ctx, write)
+	preview := Preview{Allowed: allowed, Mechanism: "peercred"}
+	if err != nil {
+		preview.Reason = err.Error()
+	}
+	return preview, nil
+}
+
+func (a *peerCredAuth) Deauthorize() *godbus.Error {
+	return nil
+}
+
+func (a *peerCredAuth) Close() error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package authkeeper
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrincipal(t *testing.T) {
+	p, err := parsePrincipal("unix-user:1000")
+	require.NoError(t, err)
+	assert.Equal(t, principal{id: 1000}, p)
+	p, err = parsePrincipal("unix-group:10")
+	require.NoError(t, err)
+	assert.Equal(t, principal{group: true, id: 10}, p)
+	p, err = parsePrincipal("unix-user:root")
+	require.NoError(t, err)
+	assert.Equal(t, principal{id: 0}, p)
+
+	for _, invalid := range []string{"alice", "unix-user:", "user:alice", "unix-user:no-such-user-here"} {
+		_, err := parsePrincipal(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPeerCredAuth(t *testing.T) {
+	keeper, err := NewPeerCredAuth([]string{"unix-user:1000", "unix-group:100"}, []string{"unix-group:10"})
+	require.NoError(t, err)
+	a := keeper.(*peerCredAuth)
+	a.groups = func(uid uint32) []uint32 {
+		if uid == 1002 {
+			return []uint32{10}
+		}
+		return nil
+	}
+	ctx := context.Background()
+
+	_, err = a.IsReadAuthorized(ctx)
+	assert.ErrorContains(t, err, "no peer credentials")
+
+	tests := []struct {
+		cred        PeerCred
+		read, write bool
+	}{
+		{PeerCred{UID: 0}, true, true},
+		{PeerCred{UID: uint32(os.Getuid()), GID: 5000}, true, true},
+		{PeerCred{UID: 1000, GID: 1000}, true, false},
+		// primary group
+		{PeerCred{UID: 1001, GID: 100}, true, false},
+		// supplementary group of the writers
+		{PeerCred{UID: 1002, GID: 1002}, true, true},
+		{PeerCred{UID: 1003, GID: 1003}, false, false},
+	}
+	for _, tt := range tests {
+		ctx := WithPeerCred(ctx, tt.cred)
+		read, _ := a.IsReadAuthorized(ctx)
+		write, err := a.IsWriteAuthorized(ctx)
+		assert.Equal(t, tt.read, read, "read %+v", tt.cred)
+		assert.Equal(t, tt.write, write, "write %+v", tt.cred)
+		if !tt.write {
+			assert.ErrorContains(t, err, "isn't allowed to write")
+		}
+		preview, err := a.Preview(ctx, true)
+		require.NoError(t, err)
+		assert.Equal(t, "peercred", preview.Mechanism)
+		assert.Equal(t, tt.write, preview.Allowed)
+	}
+
+	_, err = NewPeerCredAuth([]string{"alice"}, nil)
+	assert.Error(t, err)
+}
+
+func TestPeerCredConnContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		if c, err := net.Dial("unix", path); err == nil {
+			defer c.Close()
+			c.Read(make([]byte, 1))
+		}
+	}()
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	cred, ok := PeerCredFromContext(PeerCredConnContext(context.Background(), conn))
+	require.True(t, ok)
+	assert.Equal(t, uint32(os.Getuid()), cred.UID)
+	assert.Equal(t, uint32(os.Getgid()), cred.GID)
+	assert.Equal(t, int32(os.Getpid()), cred.PID)
+
+	_, ok = PeerCredFromContext(PeerCredConnContext(context.Background(), nil))
+	assert.False(t, ok)
+}
@@ -0,0 +1,121 @@
+package authkeeper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type sessionKey struct{}
+
+// WithSession returns a context carrying the id of the MCP session of the
+// request
+func WithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, id)
+}
+
+// SessionFromContext returns the id of the MCP session of the request
+func SessionFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(sessionKey{}).(string)
+	return id, ok
+}
+
+// Principal returns who the request is authorized as, the subject of the
+// bearer token or the uid of the peer of the unix socket. It's empty for the
+// user running the server, e.g. over stdio.
+func Principal(ctx context.Context) string {
+	if ti := auth.TokenInfoFromContext(ctx); ti != nil {
+		return "oauth2:" + ti.UserID
+	}
+	if cred, ok := PeerCredFromContext(ctx); ok {
+		return fmt.Sprintf("uid:%d", cred.UID)
+	}
+	return ""
+}
+
+// SessionAuth keeps the authorization per MCP session. A session belongs to
+// the principal first authorized in it and the requests of other principals
+// in the session are refused, so that a session id reused by another client
+// doesn't carry over what was authorized for the owner of the session.
+type SessionAuth struct {
+	AuthKeeper
+	mu sync.Mutex
+	// principal owning the session by session id
+	owners map[string]string
+}
+
+func NewSessionAuth(next AuthKeeper) *SessionAuth {
+	return &SessionAuth{AuthKeeper: next, owners: make(map[string]string)}
+}
+
+// Middleware passes the session id of the requests in the context
+func (a *SessionAuth) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if session, ok := req.GetSession().(*mcp.ServerSession); ok && session != nil {
+			ctx = WithSession(ctx, session.ID())
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// Forget drops the owner of an ended session
+func (a *SessionAuth) Forget(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.owners, id)
+}
+
+// checkOwner returns an error if the session belongs to another principal,
+// with bind set the session is bound to the principal of the request
+func (a *SessionAuth) checkOwner(ctx context.Context, bind bool) error {
+	id, ok := SessionFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	principal := Principal(ctx)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	owner, bound := a.owners[id]
+	if !bound {
+		if bind {
+			a.owners[id] = principal
+		}
+		return nil
+	}
+	if owner != principal {
+		return &AuthError{Code: AuthDenied, Message: fmt.Sprintf("session %s belongs to another client", id), Hint: "start a new session"}
+	}
+	return nil
+}
+
+func (a *SessionAuth) authorize(ctx context.Context, next func(context.Context) (bool, error)) (bool, error) {
+	if err := a.checkOwner(ctx, false); err != nil {
+		return false, err
+	}
+	allowed, err := next(ctx)
+	if !allowed || err != nil {
+		return allowed, err
+	}
+	if err := a.checkOwner(ctx, true); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (a *SessionAuth) IsReadAuthorized(ctx context.Context) (bool, error) {
+	return a.authorize(ctx, a.AuthKeeper.IsReadAuthorized)
+}
+
+func (a *SessionAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
+	return a.authorize(ctx, a.AuthKeeper.IsWriteAuthorized)
+}
+
+func (a *SessionAuth) Preview(ctx context.Context, write bool) (Preview, error) {
+	if err := a.checkOwner(ctx, false); err != nil {
+		return Preview{Mechanism: "session", Reason: err.Error()}, nil
+	}
+	return a.AuthKeeper.Preview(ctx, write)
+}
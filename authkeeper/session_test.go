@@ -0,0 +1,51 @@
+package authkeeper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrincipal(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", Principal(ctx))
+	assert.Equal(t, "uid:1000", Principal(WithPeerCred(ctx, PeerCred{UID: 1000})))
+}
+
+func TestSessionAuth(t *testing.T) {
+	keeper, err := NewPeerCredAuth([]string{"unix-user:1000", "unix-user:1001"}, []string{"unix-user:1000"})
+	require.NoError(t, err)
+	a := NewSessionAuth(keeper)
+	alice := WithPeerCred(WithSession(context.Background(), "s1"), PeerCred{UID: 1000})
+	bob := WithPeerCred(WithSession(context.Background(), "s1"), PeerCred{UID: 1001})
+
+	// a refused request doesn't bind the session
+	_, err = a.IsWriteAuthorized(bob)
+	assert.ErrorContains(t, err, "isn't allowed to write")
+
+	allowed, err := a.IsWriteAuthorized(alice)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+
+	// the session of alice doesn't authorize bob, not even to read
+	allowed, err = a.IsReadAuthorized(bob)
+	assert.ErrorContains(t, err, "belongs to another client")
+	assert.False(t, allowed)
+	preview, err := a.Preview(bob, false)
+	assert.NoError(t, err)
+	assert.False(t, preview.Allowed)
+	assert.Equal(t, "session", preview.Mechanism)
+
+	// but his own session does
+	allowed, err = a.IsReadAuthorized(WithPeerCred(WithSession(context.Background(), "s2"), PeerCred{UID: 1001}))
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+
+	// ended sessions are forgotten
+	a.Forget("s1")
+	allowed, err = a.IsReadAuthorized(bob)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+}
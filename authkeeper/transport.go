@@ -0,0 +1,89 @@
+package authkeeper
+
+import (
+	"context"
+	"errors"
+
+	godbus "github.com/godbus/dbus/v5"
+)
+
+// transports over which the requests are received, each can have its own
+// authorization
+const (
+	TransportStdio = "stdio"
+	// streamable http and websocket, authorized by bearer tokens
+	TransportHTTP = "http"
+	// the --listen and the varlink socket, authorized by the credentials of
+	// the peer
+	TransportUnix = "unix"
+)
+
+type transportKey struct{}
+
+// WithTransport returns a context carrying the transport of the request
+func WithTransport(ctx context.Context, transport string) context.Context {
+	return context.WithValue(ctx, transportKey{}, transport)
+}
+
+// TransportFromContext returns the transport the request was received over
+func TransportFromContext(ctx context.Context) (string, bool) {
+	transport, ok := ctx.Value(transportKey{}).(string)
+	return transport, ok
+}
+
+// TransportAuth authorizes the requests by the authorization of their
+// transport, so that e.g. the stdio client is asked by polkit while the http
+// clients need a bearer token
+type TransportAuth struct {
+	keepers map[string]AuthKeeper
+	// authorizes the requests without transport, e.g. the calls over the
+	// dbus API
+	fallback AuthKeeper
+}
+
+// NewTransportAuth dispatches to the keepers by transport, the keeper of the
+// fallback transport authorizes the requests without transport or of a
+// transport without keeper
+func NewTransportAuth(keepers map[string]AuthKeeper, fallback string) *TransportAuth {
+	return &TransportAuth{keepers: keepers, fallback: keepers[fallback]}
+}
+
+func (a *TransportAuth) keeper(ctx context.Context) AuthKeeper {
+	if transport, ok := TransportFromContext(ctx); ok {
+		if keeper, ok := a.keepers[transport]; ok {
+			return keeper
+		}
+	}
+	return a.fallback
+}
+
+func (a *TransportAuth) IsReadAuthorized(ctx context.Context) (bool, error) {
+	return a.keeper(ctx).IsReadAuthorized(ctx)
+}
+
+func (a *TransportAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
+	return a.keeper(ctx).IsWriteAuthorized(ctx)
+}
+
+func (a *TransportAuth) Preview(ctx context.Context, write bool) (Preview, error) {
+	return a.keeper(ctx).Preview(ctx, write)
+}
+
+// Deauthorize revokes the authorizations of all transports
+func (a *TransportAuth) Deauthorize() *godbus.Error {
+	var first *godbus.Error
+	for _, keeper := range a.keepers {
+		if err := keeper.Deauthorize(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (a *TransportAuth) Close() error {
+	var errs []error
+	for _, keeper := range a.keepers {
+		errs = append(errs, keeper.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,51 @@
+package authkeeper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportAuth(t *testing.T) {
+	readOnly, _ := NewNoAuth(true, false)
+	readWrite, _ := NewNoAuth(true, true)
+	peers, err := NewPeerCredAuth(nil, nil)
+	require.NoError(t, err)
+	a := NewTransportAuth(map[string]AuthKeeper{
+		TransportStdio: readWrite,
+		TransportHTTP:  readOnly,
+		TransportUnix:  peers,
+	}, TransportHTTP)
+
+	ctx := context.Background()
+	allowed, _ := a.IsWriteAuthorized(WithTransport(ctx, TransportStdio))
+	assert.True(t, allowed)
+	allowed, err = a.IsWriteAuthorized(WithTransport(ctx, TransportHTTP))
+	assert.False(t, allowed)
+	assert.Error(t, err)
+	// without transport the fallback decides
+	allowed, _ = a.IsWriteAuthorized(ctx)
+	assert.False(t, allowed)
+	allowed, _ = a.IsWriteAuthorized(WithTransport(ctx, "other"))
+	assert.False(t, allowed)
+
+	preview, err := a.Preview(WithTransport(ctx, TransportUnix), false)
+	require.NoError(t, err)
+	assert.Equal(t, "peercred", preview.Mechanism)
+	allowed, err = a.IsReadAuthorized(WithTransport(WithPeerCred(ctx, PeerCred{UID: 0}), TransportUnix))
+	assert.True(t, allowed)
+	assert.NoError(t, err)
+
+	assert.Nil(t, a.Deauthorize())
+	assert.NoError(t, a.Close())
+}
+
+func TestTransportFromContext(t *testing.T) {
+	_, ok := TransportFromContext(context.Background())
+	assert.False(t, ok)
+	transport, ok := TransportFromContext(WithTransport(context.Background(), TransportStdio))
+	assert.True(t, ok)
+	assert.Equal(t, TransportStdio, transport)
+}
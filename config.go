@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/openSUSE/systemd-mcp/internal/pkg/deadline"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/file"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/ratelimit"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/toolgroup"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// DefaultConfigFile is read if it exists and no other file is given
+const DefaultConfigFile = "/etc/systemd-mcp/config.yaml"
+
+// configSections maps the keys of the sections of the config file to the
+// flags they set, the flags can also be set at the top level by their names
+var configSections = map[string]map[string]string{
+	"transport": {
+		"http":               "http",
+		"ws":                 "ws",
+		"ws-allowed-origins": "ws-allowed-origins",
+		"stdio":              "stdio",
+		"listen":             "listen",
+		"listen-read":        "listen-read",
+		"listen-write":       "listen-write",
+		"varlink":            "varlink",
+		"cert-file":          "cert-file",
+		"key-file":           "key-file",
+		"tls-client-ca":      "tls-client-ca",
+		"drain-timeout":      "drain-timeout",
+	},
+	"auth": {
+		"noauth":          "noauth",
+		"controller":      "controller",
+		"audience":        "audience",
+		"token-leeway":    "token-leeway",
+		"allow-read":      "allow-read",
+		"allow-write":     "allow-write",
+		"ttl":             "auth-ttl",
+		"timeout":         "timeout",
+		"elicit-approval": "elicit-approval",
+		"policy-file":     "policy-file",
+	},
+	"tools": {
+		"enabled":             "enabled-tools",
+		"dry-run":             "dry-run",
+		"confirm-destructive": "confirm-destructive",
+		"rate-limit":          "rate-limit",
+		"rate-burst":          "rate-burst",
+		"tool-rate-limit":     "tool-rate-limit",
+		"call-timeout":        "call-timeout",
+		"tool-call-timeout":   "tool-call-timeout",
+	},
+	"units": {
+		"allowed": "allowed-units",
+		"denied":  "denied-units",
+	},
+	"files": {
+		"roots":       "file-roots",
+		"write-roots": "file-write-roots",
+	},
+	"journal": {
+		"max-entries": "journal-max-entries",
+		"gateway":     "journal-gateway",
+		"remote":      "journal-remote",
+		"remote-dir":  "remote-journal-dir",
+	},
+}
+
+// flags which make no sense in the config file
+var configExcluded = []string{"config", "check-config", "help", "version", "list-tools", "check-drift"}
+
+// loadConfig reads the config file as defaults of the flags, so that flags
+// and environment variables take precedence. The default file may be
+// missing, a file given by --config has to exist.
+func loadConfig(cmd *cobra.Command) error {
+	path := viper.GetString("config")
+	if path == "" {
+		return nil
+	}
+	cfg := viper.New()
+	cfg.SetConfigFile(path)
+	if filepath.Ext(path) == "" {
+		cfg.SetConfigType("yaml")
+	}
+	if err := cfg.ReadInConfig(); err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !cmd.Flags().Changed("config") {
+			return nil
+		}
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var errs []error
+	set := func(key, name string, value any) {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || slices.Contains(configExcluded, name) {
+			errs = append(errs, fmt.Errorf("unknown key %s", key))
+			return
+		}
+		if err := checkFlagValue(flag, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value of %s: %w", key, err))
+			return
+		}
+		viper.SetDefault(name, value)
+	}
+	for key, value := range cfg.AllSettings() {
+		section, ok := configSections[key]
+		if !ok {
+			set(key, key, value)
+			continue
+		}
+		values, ok := value.(map[string]any)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s has to be a section", key))
+			continue
+		}
+		for k, v := range values {
+			name, ok := section[k]
+			if !ok {
+				errs = append(errs, fmt.Errorf("unknown key %s.%s", key, k))
+				continue
+			}
+			set(key+"."+k, name, v)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// checkFlagValue checks that the value of the config file can be converted
+// to the type of the flag
+func checkFlagValue(flag *pflag.Flag, value any) error {
+	var err error
+	switch flag.Value.Type() {
+	case "bool":
+		_, err = cast.ToBoolE(value)
+	case "int":
+		_, err = cast.ToIntE(value)
+	case "uint32":
+		_, err = cast.ToUint32E(value)
+	case "float64":
+		_, err = cast.ToFloat64E(value)
+	case "duration":
+		_, err = cast.ToDurationE(value)
+	case "stringSlice":
+		_, err = cast.ToStringSliceE(value)
+	default:
+		_, err = cast.ToStringE(value)
+	}
+	return err
+}
+
+// checkConfig checks the settings which are parsed on startup without
+// connecting to anything
+func checkConfig() error {
+	var errs []error
+	isHttp := viper.GetString("http") != "" || viper.GetString("ws") != ""
+	if isHttp && viper.GetString("noauth") != magicNoauth && viper.GetString("controller") == "" {
+		errs = append(errs, fmt.Errorf("http mode requires either controller or noauth=%s", magicNoauth))
+	}
+	if listen := viper.GetString("listen"); listen != "" && !strings.HasPrefix(listen, "unix:") {
+		errs = append(errs, fmt.Errorf("invalid listen %s, use unix:PATH", listen))
+	}
+	if addr := viper.GetString("varlink"); addr != "" && !strings.HasPrefix(addr, "unix:") {
+		errs = append(errs, fmt.Errorf("invalid varlink %s, use unix:PATH", addr))
+	}
+	if (viper.GetString("cert-file") == "") != (viper.GetString("key-file") == "") {
+		errs = append(errs, fmt.Errorf("cert-file and key-file have to be set together"))
+	}
+	if _, err := clientTLSConfig(viper.GetString("tls-client-ca")); err != nil {
+		errs = append(errs, err)
+	}
+	allowedUnits, deniedUnits := viper.GetStringSlice("allowed-units"), viper.GetStringSlice("denied-units")
+	if policyFile := viper.GetString("policy-file"); policyFile != "" {
+		if pol, err := policy.Load(policyFile); err != nil {
+			errs = append(errs, err)
+		} else {
+			allowedUnits = append(allowedUnits, pol.Allowed...)
+			deniedUnits = append(deniedUnits, pol.Denied...)
+		}
+	}
+	if _, err := policy.NewUnitAccess(allowedUnits, deniedUnits); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := toolgroup.Parse(viper.GetStringSlice("enabled-tools")); err != nil {
+		errs = append(errs, err)
+	}
+	if err := ratelimit.New(0, 0, 0).SetToolRates(viper.GetStringSlice("tool-rate-limit")); err != nil {
+		errs = append(errs, err)
+	}
+	if err := deadline.New(0).SetToolTimeouts(viper.GetStringSlice("tool-call-timeout")); err != nil {
+		errs = append(errs, err)
+	}
+	for _, root := range viper.GetStringSlice("file-roots") {
+		if !filepath.IsAbs(root) {
+			errs = append(errs, fmt.Errorf("file root %s isn't an absolute path", root))
+		} else if _, err := os.Stat(root); err != nil && !slices.Contains(file.DefaultRoots, root) {
+			errs = append(errs, fmt.Errorf("file root: %w", err))
+		}
+	}
+	for _, root := range viper.GetStringSlice("file-write-roots") {
+		if !filepath.IsAbs(root) {
+			errs = append(errs, fmt.Errorf("file write root %s isn't an absolute path", root))
+		} else if _, err := os.Stat(root); err != nil && !slices.Contains(file.DefaultWriteRoots, root) {
+			errs = append(errs, fmt.Errorf("file write root: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// runConfig checks the config file with the arguments
+func runConfig(t *testing.T, config string, args ...string) error {
+	t.Helper()
+	t.Cleanup(viper.Reset)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := NewRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(append([]string{"--config", path, "--check-config"}, args...))
+	return cmd.Execute()
+}
+
+func TestLoadConfig(t *testing.T) {
+	config := `
+transport:
+  http: ":8080"
+auth:
+  noauth: ThisIsInsecure
+tools:
+  enabled: [list_loaded_units, list_log]
+  rate-limit: 1
+  call-timeout: 1m
+units:
+  denied: ["sshd.service"]
+journal:
+  max-entries: 500
+debug: true
+`
+	if err := runConfig(t, config, "--rate-limit=2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := viper.GetStringSlice("enabled-tools"); !slices.Equal(got, []string{"list_loaded_units", "list_log"}) {
+		t.Errorf("enabled-tools = %v", got)
+	}
+	if got := viper.GetDuration("call-timeout"); got != time.Minute {
+		t.Errorf("call-timeout = %s", got)
+	}
+	if got := viper.GetInt("journal-max-entries"); got != 500 {
+		t.Errorf("journal-max-entries = %d", got)
+	}
+	if !viper.GetBool("debug") {
+		t.Error("debug isn't set by the top level key")
+	}
+	// flags take precedence
+	if got := viper.GetFloat64("rate-limit"); got != 2 {
+		t.Errorf("rate-limit = %g", got)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{
+			name:     "unknown keys",
+			config:   "tools:\n  enable: [list_log]\nverbosity: 3\n",
+			expected: []string{"unknown key tools.enable", "unknown key verbosity"},
+		},
+		{
+			name:     "invalid values",
+			config:   "journal:\n  max-entries: many\ntools:\n  call-timeout: soon\n",
+			expected: []string{"invalid value of journal.max-entries", "invalid value of tools.call-timeout"},
+		},
+		{
+			name:     "no section",
+			config:   "units: sshd.service\n",
+			expected: []string{"units has to be a section"},
+		},
+		{
+			name:     "http without auth",
+			config:   "transport:\n  http: \":8080\"\n",
+			expected: []string{"http mode requires either controller or noauth"},
+		},
+		{
+			name:     "invalid settings",
+			config:   "tools:\n  enabled: [unit:read]\n  tool-rate-limit: [list_log]\nfiles:\n  roots: [etc]\n",
+			expected: []string{"unknown tool group", "invalid tool rate", "file root etc isn't an absolute path"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runConfig(t, tt.config)
+			if err == nil {
+				t.Fatal("expected the config to be refused")
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected error to contain %q, got: %q", expected, err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestMissingConfig(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	cmd := NewRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs([]string{"--config", filepath.Join(t.TempDir(), "missing.yaml"), "--check-config"})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected a missing config file given by --config to fail")
+	}
+}
@@ -9,18 +9,45 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/godbus/dbus/v5"
 )
 
+// polkit actions of the tool categories, so that polkit rules can e.g.
+// grant reading the journal but not managing the units
+const (
+	UnitsReadAction   = "com.suse.gatekeeper.units.read"
+	UnitsManageAction = "com.suse.gatekeeper.units.manage"
+	JournalReadAction = "com.suse.gatekeeper.journal.read"
+	FilesReadAction   = "com.suse.gatekeeper.files.read"
+	FilesWriteAction  = "com.suse.gatekeeper.files.write"
+	// logind sessions, users and seats
+	SessionsReadAction   = "com.suse.gatekeeper.sessions.read"
+	SessionsManageAction = "com.suse.gatekeeper.sessions.manage"
+	// the read action of the tools without category
+	ReadAction = "com.suse.gatekeeper.readlog"
+)
+
+// isReadAction reports if the action only allows reading
+func isReadAction(actionID string) bool {
+	return actionID == ReadAction || strings.HasSuffix(actionID, ".read")
+}
+
 type DbusAuth struct {
 	*dbus.Conn
 	sender   dbus.Sender // store the sender which authorized the last call
 	Timeout  uint32
 	DbusName string
 	DbusPath string
+	// polkit authority, the one of the system bus if nil
+	Authority Authority
+	// ids of the temporary authorizations the write checks caused, which
+	// Deauthorize revokes
+	mu     sync.Mutex
+	caused []string
 }
 
 // Just register the sender for further call backs
@@ -52,12 +79,65 @@ func getSessionIdFromPid(pid uint32) (string, error) {
 	return "", fmt.Errorf("session scope not found in cgroup for pid %d", pid)
 }
 
-// Deauthorize revokes the authorization
+// Deauthorize revokes the temporary authorizations polkit kept after the
+// write checks of the server, so that the next change has to be authorized
+// again. The ones the user obtained otherwise, e.g. with systemctl, are kept.
 func (a *DbusAuth) Deauthorize() *dbus.Error {
 	slog.Debug("Deauthorize called")
+	a.mu.Lock()
+	ids := a.caused
+	a.caused = nil
+	a.mu.Unlock()
+	authority := a.authority()
+	for _, id := range ids {
+		if err := authority.RevokeTemporaryAuthorizationById(id); err != nil {
+			return dbus.MakeFailedError(err)
+		}
+		slog.Debug("revoked temporary authorization", "id", id)
+	}
 	return nil
 }
 
+func (a *DbusAuth) authority() Authority {
+	if a.Authority == nil {
+		return NewAuthority()
+	}
+	return a.Authority
+}
+
+// temporaryIDs returns the ids of the temporary authorizations of the
+// session for the write actions of the MCP server
+func (a *DbusAuth) temporaryIDs(session string) (map[string]bool, error) {
+	auths, err := ListTemporaryAuthorizations(a.authority(), session)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool, len(auths))
+	for _, auth := range auths {
+		if !isReadAction(auth.ActionID) {
+			ids[auth.ID] = true
+		}
+	}
+	return ids, nil
+}
+
+// recordCaused remembers the temporary authorizations of the session which
+// weren't there before the check, so that Deauthorize revokes them
+func (a *DbusAuth) recordCaused(session string, before map[string]bool) {
+	after, err := a.temporaryIDs(session)
+	if err != nil {
+		slog.Debug("failed to list the temporary authorizations", "error", err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id := range after {
+		if !before[id] {
+			a.caused = append(a.caused, id)
+		}
+	}
+}
+
 // Check if read was authorized. Triggers also a call back via
 // dbus if read was authorized at another time
 func (a *DbusAuth) IsReadAuthorized(ctx context.Context) (bool, error) {
@@ -65,7 +145,7 @@ func (a *DbusAuth) IsReadAuthorized(ctx context.Context) (bool, error) {
 
 	readPermission, _ := ctx.Value(PermissionKey).(string)
 	if readPermission == "" {
-		readPermission = "com.suse.gatekeeper.readlog"
+		readPermission = ReadAction
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(a.Timeout)*time.Second)
@@ -104,7 +184,7 @@ func (a *DbusAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
 
 	systemdPermission, _ := ctx.Value(PermissionKey).(string)
 	if systemdPermission == "" {
-		systemdPermission = "org.freedesktop.systemd1.manage-units"
+		systemdPermission = UnitsManageAction
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(a.Timeout)*time.Second)
@@ -117,7 +197,17 @@ func (a *DbusAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
 		if os.Geteuid() == 0 {
 			state = true
 		} else {
+			// the temporary authorizations before and after the check tell
+			// which one polkit kept for it
+			session, serr := OwnSession()
+			var before map[string]bool
+			if serr == nil {
+				before, serr = a.temporaryIDs(session)
+			}
 			state, err = CheckPolkitByPID(int32(os.Getpid()), systemdPermission)
+			if serr == nil {
+				a.recordCaused(session, before)
+			}
 		}
 	}
 	if err != nil {
@@ -132,6 +222,31 @@ func (a *DbusAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
 	}
 }
 
+// Preview checks the permission of the context, or the default read or
+// write permission, without asking the user. Challenge is set if polkit
+// would ask the user to authenticate.
+func (a *DbusAuth) Preview(ctx context.Context, write bool) (authorized, challenge bool, err error) {
+	permission, _ := ctx.Value(PermissionKey).(string)
+	switch {
+	case permission != "":
+	case write:
+		permission = UnitsManageAction
+	default:
+		permission = ReadAction
+	}
+	if a.sender != "" {
+		return false, false, nil
+	}
+	if os.Geteuid() == 0 {
+		return true, false, nil
+	}
+	result, err := checkPolkit(int32(os.Getpid()), permission, 0)
+	if err != nil {
+		return false, false, err
+	}
+	return result.IsAuthorized, result.IsChallenge, nil
+}
+
 // getProcessStartTime returns the start time of a process in clock ticks since system boot.
 func getProcessStartTime(pid int32) (uint64, int32, error) {
 	statPath := fmt.Sprintf("/proc/%d/stat", pid)
@@ -169,15 +284,29 @@ func getProcessStartTime(pid int32) (uint64, int32, error) {
 
 // CheckPolkitByPID checks if the given PID is authorized for the given actionID.
 func CheckPolkitByPID(pid int32, actionID string) (bool, error) {
+	result, err := checkPolkit(pid, actionID, 1) // AllowUserInteraction
+	if err != nil {
+		return false, err
+	}
+	return result.IsAuthorized, nil
+}
+
+type polkitResult struct {
+	IsAuthorized bool
+	IsChallenge  bool
+	Details      map[string]dbus.Variant
+}
+
+func checkPolkit(pid int32, actionID string, flags uint32) (*polkitResult, error) {
 	conn, err := dbus.ConnectSystemBus()
 	if err != nil {
-		return false, fmt.Errorf("could not connect to system dbus: %w", err)
+		return nil, fmt.Errorf("could not connect to system dbus: %w", err)
 	}
 	defer conn.Close()
 
 	startTime, uid, err := getProcessStartTime(pid)
 	if err != nil {
-		return false, fmt.Errorf("failed to get process info for PID %d: %w", pid, err)
+		return nil, fmt.Errorf("failed to get process info for PID %d: %w", pid, err)
 	}
 
 	subject := struct {
@@ -193,21 +322,16 @@ func CheckPolkitByPID(pid int32, actionID string) (bool, error) {
 	}
 
 	details := make(map[string]string)
-	flags := uint32(1) // AllowUserInteraction
 	cancellationID := ""
-	var result struct {
-		IsAuthorized bool
-		IsChallenge  bool
-		Details      map[string]dbus.Variant
-	}
+	var result polkitResult
 
 	pkObj := conn.Object("org.freedesktop.PolicyKit1", "/org/freedesktop/PolicyKit1/Authority")
 	err = pkObj.Call("org.freedesktop.PolicyKit1.Authority.CheckAuthorization", 0,
 		subject, actionID, details, flags, cancellationID).Store(&result)
 
 	if err != nil {
-		return false, fmt.Errorf("error checking authorization: %w", err)
+		return nil, fmt.Errorf("error checking authorization: %w", err)
 	}
 
-	return result.IsAuthorized, nil
+	return &result, nil
 }
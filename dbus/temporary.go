@@ -0,0 +1,142 @@
+package dbus
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// prefixes of the polkit actions the MCP server asks for
+var mcpActionPrefixes = []string{"org.freedesktop.systemd1.", "com.suse.gatekeeper."}
+
+// TemporaryAuthorization is an authorization polkit keeps after the user
+// authenticated for an action with auth_admin_keep or auth_self_keep
+type TemporaryAuthorization struct {
+	ID       string    `json:"id"`
+	ActionID string    `json:"action_id"`
+	Obtained time.Time `json:"obtained"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Authority is the part of the polkit authority used for the temporary
+// authorizations
+type Authority interface {
+	EnumerateTemporaryAuthorizations(sessionID string) ([]TemporaryAuthorization, error)
+	RevokeTemporaryAuthorizationById(id string) error
+}
+
+type polkitSubject struct {
+	Kind    string
+	Details map[string]dbus.Variant
+}
+
+type polkitTemporaryAuthorization struct {
+	ID           string
+	ActionID     string
+	Subject      polkitSubject
+	TimeObtained uint64
+	TimeExpires  uint64
+}
+
+type systemAuthority struct{}
+
+// NewAuthority returns the polkit authority of the system bus
+func NewAuthority() Authority {
+	return systemAuthority{}
+}
+
+func (systemAuthority) authority() (*dbus.Conn, dbus.BusObject, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not connect to system dbus: %w", err)
+	}
+	return conn, conn.Object("org.freedesktop.PolicyKit1", "/org/freedesktop/PolicyKit1/Authority"), nil
+}
+
+func (a systemAuthority) EnumerateTemporaryAuthorizations(sessionID string) ([]TemporaryAuthorization, error) {
+	conn, pkObj, err := a.authority()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	subject := polkitSubject{"unix-session", map[string]dbus.Variant{"session-id": dbus.MakeVariant(sessionID)}}
+	var raw []polkitTemporaryAuthorization
+	if err := pkObj.Call("org.freedesktop.PolicyKit1.Authority.EnumerateTemporaryAuthorizations", 0, subject).Store(&raw); err != nil {
+		return nil, fmt.Errorf("error enumerating temporary authorizations: %w", err)
+	}
+	auths := make([]TemporaryAuthorization, 0, len(raw))
+	for _, r := range raw {
+		auths = append(auths, TemporaryAuthorization{
+			ID:       r.ID,
+			ActionID: r.ActionID,
+			Obtained: time.Unix(int64(r.TimeObtained), 0),
+			Expires:  time.Unix(int64(r.TimeExpires), 0),
+		})
+	}
+	return auths, nil
+}
+
+func (a systemAuthority) RevokeTemporaryAuthorizationById(id string) error {
+	conn, pkObj, err := a.authority()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := pkObj.Call("org.freedesktop.PolicyKit1.Authority.RevokeTemporaryAuthorizationById", 0, id).Store(); err != nil {
+		return fmt.Errorf("error revoking temporary authorization %s: %w", id, err)
+	}
+	return nil
+}
+
+// isMCPAction reports if the action is one the MCP server asks for
+func isMCPAction(actionID string) bool {
+	return slices.ContainsFunc(mcpActionPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(actionID, prefix)
+	})
+}
+
+// OwnSession returns the login session of the server, polkit keeps the
+// temporary authorizations per session
+func OwnSession() (string, error) {
+	return getSessionIdFromPid(uint32(os.Getpid()))
+}
+
+// ListTemporaryAuthorizations returns the temporary authorizations of the
+// session for the actions of the MCP server
+func ListTemporaryAuthorizations(authority Authority, sessionID string) ([]TemporaryAuthorization, error) {
+	auths, err := authority.EnumerateTemporaryAuthorizations(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(auths, func(a TemporaryAuthorization) bool {
+		return !isMCPAction(a.ActionID)
+	}), nil
+}
+
+// RevokeTemporaryAuthorizations revokes the temporary authorizations of the
+// session for the actions of the MCP server, or only the one with the id.
+// The revoked authorizations are returned.
+func RevokeTemporaryAuthorizations(authority Authority, sessionID, id string) ([]TemporaryAuthorization, error) {
+	auths, err := ListTemporaryAuthorizations(authority, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if id != "" {
+		auths = slices.DeleteFunc(auths, func(a TemporaryAuthorization) bool { return a.ID != id })
+		if len(auths) == 0 {
+			return nil, fmt.Errorf("no temporary authorization %s of the MCP actions", id)
+		}
+	}
+	var revoked []TemporaryAuthorization
+	for _, a := range auths {
+		if err := authority.RevokeTemporaryAuthorizationById(a.ID); err != nil {
+			return revoked, err
+		}
+		revoked = append(revoked, a)
+	}
+	return revoked, nil
+}
@@ -0,0 +1,84 @@
+package dbus
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAuthority struct {
+	auths   []TemporaryAuthorization
+	revoked []string
+}
+
+func (f *fakeAuthority) EnumerateTemporaryAuthorizations(sessionID string) ([]TemporaryAuthorization, error) {
+	if sessionID != "3" {
+		return nil, fmt.Errorf("no session %s", sessionID)
+	}
+	return append([]TemporaryAuthorization(nil), f.auths...), nil
+}
+
+func (f *fakeAuthority) RevokeTemporaryAuthorizationById(id string) error {
+	f.revoked = append(f.revoked, id)
+	return nil
+}
+
+func newFakeAuthority() *fakeAuthority {
+	return &fakeAuthority{auths: []TemporaryAuthorization{
+		{ID: "tmpauthz1", ActionID: "org.freedesktop.systemd1.manage-units"},
+		{ID: "tmpauthz2", ActionID: "org.freedesktop.packagekit.package-install"},
+		{ID: "tmpauthz3", ActionID: "com.suse.gatekeeper.readlog"},
+		{ID: "tmpauthz4", ActionID: "com.suse.gatekeeper.journal.read"},
+		{ID: "tmpauthz5", ActionID: "com.suse.gatekeeper.files.write"},
+	}}
+}
+
+func TestListTemporaryAuthorizations(t *testing.T) {
+	auths, err := ListTemporaryAuthorizations(newFakeAuthority(), "3")
+	require.NoError(t, err)
+	require.Len(t, auths, 4)
+	assert.Equal(t, "tmpauthz1", auths[0].ID)
+	assert.Equal(t, "tmpauthz3", auths[1].ID)
+
+	_, err = ListTemporaryAuthorizations(newFakeAuthority(), "4")
+	assert.Error(t, err)
+}
+
+func TestRevokeTemporaryAuthorizations(t *testing.T) {
+	authority := newFakeAuthority()
+	revoked, err := RevokeTemporaryAuthorizations(authority, "3", "")
+	require.NoError(t, err)
+	assert.Len(t, revoked, 4)
+	assert.Equal(t, []string{"tmpauthz1", "tmpauthz3", "tmpauthz4", "tmpauthz5"}, authority.revoked)
+
+	authority = newFakeAuthority()
+	revoked, err = RevokeTemporaryAuthorizations(authority, "3", "tmpauthz3")
+	require.NoError(t, err)
+	require.Len(t, revoked, 1)
+	assert.Equal(t, []string{"tmpauthz3"}, authority.revoked)
+
+	// authorizations of other actions are left alone
+	_, err = RevokeTemporaryAuthorizations(authority, "3", "tmpauthz2")
+	assert.Error(t, err)
+}
+
+func TestDeauthorize(t *testing.T) {
+	authority := newFakeAuthority()
+	auth := &DbusAuth{Authority: authority}
+	before, err := auth.temporaryIDs("3")
+	require.NoError(t, err)
+	authority.auths = append(authority.auths,
+		TemporaryAuthorization{ID: "tmpauthz6", ActionID: "com.suse.gatekeeper.units.manage"},
+		TemporaryAuthorization{ID: "tmpauthz7", ActionID: "com.suse.gatekeeper.units.read"})
+	auth.recordCaused("3", before)
+	assert.Nil(t, auth.Deauthorize())
+	// the authorizations obtained before the check and the ones to read are
+	// kept
+	assert.Equal(t, []string{"tmpauthz6"}, authority.revoked)
+	assert.Nil(t, auth.Deauthorize())
+	assert.Equal(t, []string{"tmpauthz6"}, authority.revoked)
+	_, err = auth.temporaryIDs("4")
+	assert.Error(t, err)
+}
@@ -0,0 +1,308 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/journal"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/redact"
+)
+
+// the audit records are logged with this identifier, so that they can be
+// read with journalctl -t systemd-mcp-audit
+const Identifier = "systemd-mcp-audit"
+
+const DefaultRecords = 50
+
+// Record is the audit record of a write tool call
+type Record struct {
+	Time      time.Time       `json:"time"`
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	// subject of the bearer token or the user running the server
+	Caller string `json:"caller"`
+	// success or error
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// JournalReader returns the newest entries matching the matches, the
+// oldest first
+type JournalReader interface {
+	Entries(ctx context.Context, matches []string, count int) ([]map[string]string, error)
+}
+
+// Logger records the calls of the write tools to the journal and to an
+// optional JSONL file
+type Logger struct {
+	// JSONL file the records are appended to, disabled if empty
+	File   string
+	Auth   auth.AuthKeeper
+	Reader JournalReader
+
+	mu    sync.Mutex
+	tools map[string]bool
+	// sends to the journal, replaced by the tests
+	send func(message string, priority journal.Priority, vars map[string]string) error
+}
+
+type GetAuditLogParams struct {
+	Tool  string `json:"tool,omitempty" jsonschema:"Only the calls of this tool, e.g. change_unit_state."`
+	Since string `json:"since,omitempty" jsonschema:"Only calls at or after this time in RFC3339 format."`
+	Limit int    `json:"limit,omitempty" jsonschema:"Maximal number of records to return, the newest are returned."`
+}
+
+type GetAuditLogResult struct {
+	// file or journal
+	Source  string   `json:"source"`
+	Records []Record `json:"records"`
+}
+
+func New(file string, authorization auth.AuthKeeper, reader JournalReader) *Logger {
+	l := &Logger{
+		File:   file,
+		Auth:   authorization,
+		Reader: reader,
+		tools:  make(map[string]bool),
+	}
+	if journal.Enabled() {
+		l.send = journal.Send
+	}
+	return l
+}
+
+func CreateGetAuditLogSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[GetAuditLogParams](nil)
+	inputSchema.Properties["limit"].Default = json.RawMessage(strconv.Itoa(DefaultRecords))
+	return inputSchema
+}
+
+// Add registers a tool, the calls of tools without read-only hint are
+// recorded
+func (l *Logger) Add(tool *mcp.Tool) {
+	if tool.Annotations != nil && tool.Annotations.ReadOnlyHint {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tools[tool.Name] = true
+}
+
+// caller returns the subject of the bearer token or the user connected to
+// the unix socket, calls over stdio are made by the user running the server
+func caller(ctx context.Context, req *mcp.CallToolRequest) string {
+	if req.Extra != nil && req.Extra.TokenInfo != nil && req.Extra.TokenInfo.UserID != "" {
+		return req.Extra.TokenInfo.UserID
+	}
+	if cred, ok := auth.PeerCredFromContext(ctx); ok {
+		return "uid=" + strconv.FormatUint(uint64(cred.UID), 10)
+	}
+	return "uid=" + strconv.Itoa(os.Getuid())
+}
+
+// newRecord creates the record of a finished call
+func newRecord(ctx context.Context, req *mcp.CallToolRequest, res *mcp.CallToolResult, err error, now time.Time) Record {
+	// the arguments granting access are never recorded
+	rec := Record{
+		Time:      now,
+		Tool:      req.Params.Name,
+		Arguments: redact.Arguments(req.Params.Arguments, redact.Secrets),
+		Caller:    caller(ctx, req),
+		Result:    "success",
+	}
+	switch {
+	case err != nil:
+		rec.Result, rec.Error = "error", err.Error()
+	case res != nil && res.IsError:
+		rec.Result = "error"
+		for _, c := range res.Content {
+			if text, ok := c.(*mcp.TextContent); ok {
+				rec.Error = text.Text
+				break
+			}
+		}
+	}
+	return rec
+}
+
+// write records to the journal and appends to the file
+func (l *Logger) write(rec Record) {
+	if l.send != nil {
+		priority := journal.PriNotice
+		if rec.Result != "success" {
+			priority = journal.PriWarning
+		}
+		vars := map[string]string{
+			"SYSLOG_IDENTIFIER": Identifier,
+			"MCP_TOOL":          rec.Tool,
+			"MCP_ARGUMENTS":     string(rec.Arguments),
+			"MCP_CALLER":        rec.Caller,
+			"MCP_RESULT":        rec.Result,
+		}
+		if rec.Error != "" {
+			vars["MCP_ERROR"] = rec.Error
+		}
+		msg := fmt.Sprintf("%s called %s: %s", rec.Caller, rec.Tool, rec.Result)
+		if err := l.send(msg, priority, vars); err != nil {
+			slog.Warn("failed to write audit record to the journal", "error", err)
+		}
+	}
+	if l.File == "" {
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		slog.Warn("failed to marshal audit record", "error", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		slog.Warn("failed to open audit file", "file", l.File, "error", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		slog.Warn("failed to write audit record", "file", l.File, "error", err)
+	}
+}
+
+// Middleware records the calls of the write tools
+func (l *Logger) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		result, err := next(ctx, method, req)
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || call.Params == nil {
+			return result, err
+		}
+		l.mu.Lock()
+		write := l.tools[call.Params.Name]
+		l.mu.Unlock()
+		if write {
+			res, _ := result.(*mcp.CallToolResult)
+			l.write(newRecord(ctx, call, res, err, time.Now()))
+		}
+		return result, err
+	}
+}
+
+// readFile returns the records of the JSONL file
+func (l *Logger) readFile() ([]Record, error) {
+	f, err := os.Open(l.File)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			slog.Warn("invalid audit record", "file", l.File, "error", err)
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// readJournal returns the records logged to the journal
+func (l *Logger) readJournal(ctx context.Context, tool string, limit int) ([]Record, error) {
+	if l.Reader == nil {
+		return nil, fmt.Errorf("no audit file is configured and the journal can't be read")
+	}
+	matches := []string{"SYSLOG_IDENTIFIER=" + Identifier}
+	if tool != "" {
+		matches = append(matches, "MCP_TOOL="+tool)
+	}
+	entries, err := l.Reader.Entries(ctx, matches, limit)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(entries))
+	for _, fields := range entries {
+		usec, _ := strconv.ParseInt(fields["__REALTIME_TIMESTAMP"], 10, 64)
+		rec := Record{
+			Time:   time.UnixMicro(usec),
+			Tool:   fields["MCP_TOOL"],
+			Caller: fields["MCP_CALLER"],
+			Result: fields["MCP_RESULT"],
+			Error:  fields["MCP_ERROR"],
+		}
+		if args := fields["MCP_ARGUMENTS"]; json.Valid([]byte(args)) {
+			rec.Arguments = json.RawMessage(args)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// GetAuditLog returns the newest records of the write tool calls, from the
+// audit file if configured and otherwise from the journal
+func (l *Logger) GetAuditLog(ctx context.Context, req *mcp.CallToolRequest, params *GetAuditLogParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := l.Auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.JournalReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	var since time.Time
+	if params.Since != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, params.Since); err != nil {
+			return nil, nil, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = DefaultRecords
+	}
+
+	res := GetAuditLogResult{Source: "journal"}
+	var records []Record
+	var err error
+	if l.File != "" {
+		res.Source = "file"
+		records, err = l.readFile()
+	} else {
+		// the time is filtered afterwards, read enough for it
+		records, err = l.readJournal(ctx, params.Tool, max(limit, 1000))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	records = slices.DeleteFunc(records, func(rec Record) bool {
+		return (params.Tool != "" && rec.Tool != params.Tool) || rec.Time.Before(since)
+	})
+	res.Records = records[max(len(records)-limit, 0):]
+	if res.Records == nil {
+		res.Records = []Record{}
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
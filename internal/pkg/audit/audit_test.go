@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/journal"
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReader struct {
+	matches []string
+	entries []map[string]string
+}
+
+func (r *fakeReader) Entries(ctx context.Context, matches []string, count int) ([]map[string]string, error) {
+	r.matches = matches
+	return r.entries, nil
+}
+
+func call(name, args string) *mcp.CallToolRequest {
+	return &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: name, Arguments: json.RawMessage(args)}}
+}
+
+func getAuditLog(t *testing.T, l *Logger, params *GetAuditLogParams) GetAuditLogResult {
+	res, _, err := l.GetAuditLog(context.Background(), nil, params)
+	require.NoError(t, err)
+	var out GetAuditLogResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &out))
+	return out
+}
+
+func TestMiddleware(t *testing.T) {
+	authorization, _ := auth_pkg.NewNoAuth(true, true)
+	l := New(filepath.Join(t.TempDir(), "audit.jsonl"), authorization, nil)
+	var sent []map[string]string
+	l.send = func(message string, priority journal.Priority, vars map[string]string) error {
+		sent = append(sent, vars)
+		return nil
+	}
+	l.Add(&mcp.Tool{Name: "change_unit_state"})
+	l.Add(&mcp.Tool{Name: "list_log", Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true}})
+	handler := l.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		params := req.(*mcp.CallToolRequest).Params
+		if string(params.Arguments) == `{"name":"bad.service"}` {
+			return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: "unit not found"}}}, nil
+		}
+		return &mcp.CallToolResult{}, nil
+	})
+
+	_, err := handler(context.Background(), "tools/call", call("change_unit_state", `{"name":"nginx.service","action":"restart","delegation":"abc.def"}`))
+	require.NoError(t, err)
+	_, err = handler(context.Background(), "tools/call", call("list_log", `{}`))
+	require.NoError(t, err)
+	req := call("change_unit_state", `{"name":"bad.service"}`)
+	req.Extra = &mcp.RequestExtra{TokenInfo: &auth.TokenInfo{UserID: "alice"}}
+	_, err = handler(context.Background(), "tools/call", req)
+	require.NoError(t, err)
+
+	require.Len(t, sent, 2)
+	assert.Equal(t, Identifier, sent[0]["SYSLOG_IDENTIFIER"])
+	assert.Equal(t, "uid="+strconv.Itoa(os.Getuid()), sent[0]["MCP_CALLER"])
+	assert.NotContains(t, sent[0]["MCP_ARGUMENTS"], "abc.def")
+	assert.Equal(t, "error", sent[1]["MCP_RESULT"])
+	assert.Equal(t, "unit not found", sent[1]["MCP_ERROR"])
+
+	out := getAuditLog(t, l, &GetAuditLogParams{})
+	assert.Equal(t, "file", out.Source)
+	require.Len(t, out.Records, 2)
+	assert.Equal(t, "success", out.Records[0].Result)
+	assert.JSONEq(t, `{"name":"nginx.service","action":"restart","delegation":"[redacted]"}`, string(out.Records[0].Arguments))
+	assert.Equal(t, "alice", out.Records[1].Caller)
+
+	out = getAuditLog(t, l, &GetAuditLogParams{Limit: 1})
+	require.Len(t, out.Records, 1)
+	assert.Equal(t, "alice", out.Records[0].Caller)
+	out = getAuditLog(t, l, &GetAuditLogParams{Tool: "install_unit"})
+	assert.Empty(t, out.Records)
+	out = getAuditLog(t, l, &GetAuditLogParams{Since: time.Now().Add(time.Hour).Format(time.RFC3339)})
+	assert.Empty(t, out.Records)
+}
+
+func TestGetAuditLogJournal(t *testing.T) {
+	authorization, _ := auth_pkg.NewNoAuth(true, true)
+	ts := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	reader := &fakeReader{entries: []map[string]string{{
+		"__REALTIME_TIMESTAMP": fmt.Sprint(ts.UnixMicro()),
+		"MCP_TOOL":             "switch_target",
+		"MCP_ARGUMENTS":        `{"target":"rescue.target"}`,
+		"MCP_CALLER":           "uid=0",
+		"MCP_RESULT":           "success",
+	}}}
+	l := New("", authorization, reader)
+	out := getAuditLog(t, l, &GetAuditLogParams{Tool: "switch_target"})
+	assert.Equal(t, "journal", out.Source)
+	assert.Equal(t, []string{"SYSLOG_IDENTIFIER=" + Identifier, "MCP_TOOL=switch_target"}, reader.matches)
+	require.Len(t, out.Records, 1)
+	assert.True(t, ts.Equal(out.Records[0].Time))
+	assert.JSONEq(t, `{"target":"rescue.target"}`, string(out.Records[0].Arguments))
+
+	denied, _ := auth_pkg.NewNoAuth(false, false)
+	l.Auth = denied
+	_, _, err := l.GetAuditLog(context.Background(), nil, &GetAuditLogParams{})
+	assert.Error(t, err)
+}
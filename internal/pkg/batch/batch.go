@@ -0,0 +1,228 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+)
+
+const MaxCalls = 16
+
+// handler calls a tool with the raw json arguments, it returns the result
+// and the structured output of the tool
+type handler func(ctx context.Context, req *mcp.CallToolRequest, args json.RawMessage) (*mcp.CallToolResult, any, error)
+
+// Batch holds the read-only tools which can be called in a batch
+type Batch struct {
+	mu    sync.RWMutex
+	tools map[string]handler
+	// the policy the calls are decided by, nil for none
+	policy *policy.Policy
+}
+
+type Call struct {
+	Tool      string         `json:"tool" jsonschema:"Name of the read-only tool to call."`
+	Arguments map[string]any `json:"arguments,omitempty" jsonschema:"Arguments of the tool call."`
+}
+
+type BatchParams struct {
+	Calls []Call `json:"calls" jsonschema:"Read-only tool calls which are executed concurrently."`
+}
+
+type CallResult struct {
+	Tool              string        `json:"tool"`
+	IsError           bool          `json:"is_error,omitempty"`
+	Content           []mcp.Content `json:"content,omitempty"`
+	StructuredContent any           `json:"structured_content,omitempty"`
+	Error             string        `json:"error,omitempty"`
+}
+
+type BatchResult struct {
+	Results []CallResult `json:"results"`
+}
+
+func New() *Batch {
+	return &Batch{
+		tools: make(map[string]handler),
+	}
+}
+
+func CreateBatchSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[BatchParams](nil)
+	return inputSchema
+}
+
+// AddTool adds a read-only tool to the server and makes it available for
+// batches. The arguments of batched calls get the same defaults and
+// validation as direct calls.
+func AddTool[In any](b *Batch, server *mcp.Server, tool *mcp.Tool, h mcp.ToolHandlerFor[In, any]) {
+	if tool.Annotations == nil {
+		tool.Annotations = &mcp.ToolAnnotations{}
+	}
+	tool.Annotations.ReadOnlyHint = true
+	mcp.AddTool(server, tool, h)
+
+	schema, ok := tool.InputSchema.(*jsonschema.Schema)
+	if !ok {
+		schema, _ = jsonschema.For[In](nil)
+	}
+	var resolved *jsonschema.Resolved
+	if schema != nil {
+		var err error
+		if resolved, err = schema.Resolve(nil); err != nil {
+			slog.Warn("couldn't resolve schema, not adding tool to batch", "tool", tool.Name, "error", err)
+			return
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tools[tool.Name] = func(ctx context.Context, req *mcp.CallToolRequest, args json.RawMessage) (*mcp.CallToolResult, any, error) {
+		v := make(map[string]any)
+		if len(args) > 0 {
+			if err := json.Unmarshal(args, &v); err != nil {
+				return nil, nil, fmt.Errorf("invalid arguments: %w", err)
+			}
+		}
+		if resolved != nil {
+			if err := resolved.ApplyDefaults(&v); err != nil {
+				return nil, nil, fmt.Errorf("applying defaults: %w", err)
+			}
+			if err := resolved.Validate(&v); err != nil {
+				return nil, nil, fmt.Errorf("validating arguments: %w", err)
+			}
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		var in In
+		if err := json.Unmarshal(data, &in); err != nil {
+			return nil, nil, fmt.Errorf("invalid arguments: %w", err)
+		}
+		return h(ctx, req, in)
+	}
+}
+
+// SetPolicy applies the policy to every call of a batch, as if the tool was
+// called directly
+func (b *Batch) SetPolicy(p *policy.Policy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.policy = p
+}
+
+// Remove removes tools from the batches, e.g. the ones which aren't enabled
+func (b *Batch) Remove(names ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, name := range names {
+		delete(b.tools, name)
+	}
+}
+
+// CallTool calls a single read-only tool with the json arguments, like it's
+// called in a batch
+func (b *Batch) CallTool(ctx context.Context, req *mcp.CallToolRequest, name string, args json.RawMessage) (*mcp.CallToolResult, any, error) {
+	b.mu.RLock()
+	h := b.tools[name]
+	b.mu.RUnlock()
+	if h == nil {
+		return nil, nil, fmt.Errorf("tool %q isn't a read-only tool, available tools: %v", name, b.Tools())
+	}
+	return b.call(ctx, req, h, name, args)
+}
+
+// call calls the tool with the call in the context, so that the policy and
+// the authorization decide on the tool and not on the batch
+func (b *Batch) call(ctx context.Context, req *mcp.CallToolRequest, h handler, name string, args json.RawMessage) (*mcp.CallToolResult, any, error) {
+	call := policy.CallFromArguments(name, args)
+	b.mu.RLock()
+	p := b.policy
+	b.mu.RUnlock()
+	if err := p.Check(call); err != nil {
+		return nil, nil, err
+	}
+	return h(policy.WithCall(ctx, call), req, args)
+}
+
+// Tools returns the names of the tools which can be batched
+func (b *Batch) Tools() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	names := make([]string, 0, len(b.tools))
+	for name := range b.tools {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Call executes the read-only tool calls concurrently and combines their
+// results in the order of the calls
+func (b *Batch) Call(ctx context.Context, req *mcp.CallToolRequest, params *BatchParams) (*mcp.CallToolResult, any, error) {
+	if len(params.Calls) == 0 {
+		return nil, nil, fmt.Errorf("no calls given")
+	}
+	if len(params.Calls) > MaxCalls {
+		return nil, nil, fmt.Errorf("can't batch more than %d calls", MaxCalls)
+	}
+	handlers := make([]handler, len(params.Calls))
+	b.mu.RLock()
+	for i, call := range params.Calls {
+		handlers[i] = b.tools[call.Tool]
+	}
+	b.mu.RUnlock()
+	for i, h := range handlers {
+		if h == nil {
+			return nil, nil, fmt.Errorf("tool %q can't be batched, available tools: %v", params.Calls[i].Tool, b.Tools())
+		}
+	}
+
+	res := BatchResult{
+		Results: make([]CallResult, len(params.Calls)),
+	}
+	var wg sync.WaitGroup
+	for i, call := range params.Calls {
+		wg.Go(func() {
+			result := CallResult{Tool: call.Tool}
+			args, err := json.Marshal(call.Arguments)
+			if err == nil {
+				var callRes *mcp.CallToolResult
+				var out any
+				callRes, out, err = b.call(ctx, req, handlers[i], call.Tool, args)
+				if callRes != nil {
+					result.IsError = callRes.IsError
+					result.Content = callRes.Content
+				}
+				if err == nil {
+					result.StructuredContent = out
+				}
+			}
+			if err != nil {
+				result.IsError = true
+				result.Error = err.Error()
+			}
+			res.Results[i] = result
+		})
+	}
+	wg.Wait()
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,122 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type echoParams struct {
+	Text  string `json:"text"`
+	Count int    `json:"count,omitempty"`
+}
+
+func echo(ctx context.Context, req *mcp.CallToolRequest, params *echoParams) (*mcp.CallToolResult, any, error) {
+	if params.Text == "fail" {
+		return nil, nil, fmt.Errorf("echo failed")
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%s %d", params.Text, params.Count)}},
+	}, params, nil
+}
+
+func TestBatch(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	schema, _ := jsonschema.For[echoParams](nil)
+	schema.Properties["count"].Default = json.RawMessage(`3`)
+	b := New()
+	tool := &mcp.Tool{Name: "echo", InputSchema: schema}
+	AddTool(b, server, tool, echo)
+	assert.True(t, tool.Annotations.ReadOnlyHint)
+	assert.Equal(t, []string{"echo"}, b.Tools())
+
+	type textResult struct {
+		Tool    string `json:"tool"`
+		IsError bool   `json:"is_error"`
+		Error   string `json:"error"`
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+		StructuredContent *echoParams `json:"structured_content"`
+	}
+	call := func(params *BatchParams) []textResult {
+		res, out, err := b.Call(context.Background(), nil, params)
+		require.NoError(t, err)
+		require.IsType(t, BatchResult{}, out)
+		var result struct {
+			Results []textResult `json:"results"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		return result.Results
+	}
+
+	result := call(&BatchParams{Calls: []Call{
+		{Tool: "echo", Arguments: map[string]any{"text": "a"}},
+		{Tool: "echo", Arguments: map[string]any{"text": "b", "count": 1}},
+		{Tool: "echo", Arguments: map[string]any{"text": "fail"}},
+		{Tool: "echo", Arguments: map[string]any{"count": "wrong"}},
+	}})
+	require.Len(t, result, 4)
+	assert.Equal(t, "a 3", result[0].Content[0].Text)
+	assert.Equal(t, "b 1", result[1].Content[0].Text)
+	assert.Equal(t, &echoParams{Text: "b", Count: 1}, result[1].StructuredContent)
+	assert.Nil(t, result[2].StructuredContent)
+	assert.True(t, result[2].IsError)
+	assert.Equal(t, "echo failed", result[2].Error)
+	assert.True(t, result[3].IsError)
+
+	_, _, err := b.Call(context.Background(), nil, &BatchParams{Calls: []Call{{Tool: "change_unit_state"}}})
+	assert.Error(t, err)
+	_, _, err = b.Call(context.Background(), nil, &BatchParams{})
+	assert.Error(t, err)
+	_, _, err = b.Call(context.Background(), nil, &BatchParams{Calls: make([]Call, MaxCalls+1)})
+	assert.Error(t, err)
+}
+
+type unitParams struct {
+	Name  string   `json:"name,omitempty"`
+	Names []string `json:"names,omitempty"`
+}
+
+func TestBatchPolicy(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	pol := &policy.Policy{Default: policy.Deny, Rules: []policy.Rule{
+		{Tool: "show_unit", Units: []string{"sshd.service"}, Decision: policy.Deny},
+		{Tool: "show_unit", Decision: policy.Allow},
+	}}
+	// the server itself denies everything, only the policy allows
+	next, _ := auth_pkg.NewNoAuth(false, false)
+	keeper := policy.NewKeeper(next, pol)
+	b := New()
+	AddTool(b, server, &mcp.Tool{Name: "show_unit"}, func(ctx context.Context, req *mcp.CallToolRequest, params *unitParams) (*mcp.CallToolResult, any, error) {
+		if allowed, err := keeper.IsReadAuthorized(ctx); !allowed {
+			return nil, nil, fmt.Errorf("not authorized: %w", err)
+		}
+		return &mcp.CallToolResult{}, nil, nil
+	})
+	b.SetPolicy(pol)
+
+	_, out, err := b.Call(context.Background(), nil, &BatchParams{Calls: []Call{
+		{Tool: "show_unit", Arguments: map[string]any{"names": []any{"nginx.service", "sshd.service"}}},
+		{Tool: "show_unit", Arguments: map[string]any{"name": "nginx.service"}},
+	}})
+	require.NoError(t, err)
+	results := out.(BatchResult).Results
+	assert.True(t, results[0].IsError)
+	assert.Contains(t, results[0].Error, "denied by policy rule")
+	// decided on the call of show_unit, not on the batch
+	assert.False(t, results[1].IsError, results[1].Error)
+
+	_, _, err = b.CallTool(context.Background(), nil, "show_unit", json.RawMessage(`{"name":"sshd.service"}`))
+	assert.ErrorContains(t, err, "denied by policy rule")
+	_, _, err = b.CallTool(context.Background(), nil, "show_unit", json.RawMessage(`{"name":"nginx.service"}`))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,190 @@
+package confirm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/safety"
+)
+
+// DefaultTTL is the time in which a destructive call has to be confirmed
+const DefaultTTL = 2 * time.Minute
+
+const tokenArgument = "confirmation_token"
+
+// Request is the answer to the first call of a destructive tool
+type Request struct {
+	ConfirmationRequired bool      `json:"confirmation_required"`
+	Tool                 string    `json:"tool"`
+	Token                string    `json:"confirmation_token"`
+	Expires              time.Time `json:"expires"`
+	Message              string    `json:"message"`
+}
+
+type pending struct {
+	session string
+	tool    string
+	args    string
+	expires time.Time
+}
+
+// Confirmer performs the destructive calls only if they are reissued with
+// the token handed out for the first call, so that a single hallucinated
+// call doesn't stop a unit or power off the host
+type Confirmer struct {
+	ttl time.Duration
+	mu  sync.Mutex
+	// decides if a call needs a confirmation, nil for all calls of a tool
+	rules map[string]safety.DestructiveFunc
+	// calls waiting for their confirmation by token
+	pending map[string]pending
+}
+
+func New(ttl time.Duration) *Confirmer {
+	return &Confirmer{
+		ttl:     ttl,
+		rules:   make(map[string]safety.DestructiveFunc),
+		pending: make(map[string]pending),
+	}
+}
+
+// Require makes the calls of the tool need a confirmation, fn decides by the
+// arguments and is nil if every call needs one
+func (c *Confirmer) Require(tool string, fn safety.DestructiveFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules[tool] = fn
+}
+
+// Add adds the confirmation_token argument to the input schema of a tool
+// needing a confirmation, it has to be called before the tool is registered
+func (c *Confirmer) Add(tool *mcp.Tool) {
+	c.mu.Lock()
+	_, ok := c.rules[tool.Name]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	schema, ok := tool.InputSchema.(*jsonschema.Schema)
+	if !ok || schema == nil {
+		return
+	}
+	if schema.Properties == nil {
+		schema.Properties = make(map[string]*jsonschema.Schema)
+	}
+	schema.Properties[tokenArgument] = &jsonschema.Schema{
+		Type:        "string",
+		Description: "Token returned by the first call of a destructive action, the call has to be reissued with the same arguments and the token.",
+	}
+}
+
+// needsConfirmation reports if the call of the tool needs a confirmation
+func (c *Confirmer) needsConfirmation(tool string, args map[string]any) bool {
+	c.mu.Lock()
+	fn, ok := c.rules[tool]
+	c.mu.Unlock()
+	return ok && (fn == nil || fn(args))
+}
+
+// Confirm checks a call, it returns nil if it may be performed and the
+// request for confirmation if it has to be reissued with the token. A token
+// can only be used once, by the same session for the same arguments.
+func (c *Confirmer) Confirm(session, tool string, args map[string]any, now time.Time) (*Request, error) {
+	if !c.needsConfirmation(tool, args) {
+		return nil, nil
+	}
+	token, _ := args[tokenArgument].(string)
+	rest := make(map[string]any, len(args))
+	for k, v := range args {
+		if k != tokenArgument {
+			rest[k] = v
+		}
+	}
+	// maps are marshaled with sorted keys
+	call, err := json.Marshal(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for t, p := range c.pending {
+		if now.After(p.expires) {
+			delete(c.pending, t)
+		}
+	}
+	if token != "" {
+		p, ok := c.pending[token]
+		if !ok {
+			return nil, fmt.Errorf("confirmation token %s is unknown or expired, call %s again without it to get a new one", token, tool)
+		}
+		if p.session != session || p.tool != tool || p.args != string(call) {
+			return nil, fmt.Errorf("confirmation token %s was issued for another call, the call has to be reissued with the same arguments", token)
+		}
+		delete(c.pending, token)
+		return nil, nil
+	}
+	tokenBytes := make([]byte, 8)
+	rand.Read(tokenBytes)
+	token = hex.EncodeToString(tokenBytes)
+	expires := now.Add(c.ttl)
+	c.pending[token] = pending{session: session, tool: tool, args: string(call), expires: expires}
+	return &Request{
+		ConfirmationRequired: true,
+		Tool:                 tool,
+		Token:                token,
+		Expires:              expires,
+		Message:              fmt.Sprintf("%s is destructive and wasn't performed. To perform it, call %s again with the same arguments and confirmation_token set to %s within %s.", tool, tool, token, c.ttl),
+	}, nil
+}
+
+// Middleware answers the first call of a destructive tool with the request
+// for confirmation and passes the confirmed calls through
+func (c *Confirmer) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || call.Params == nil {
+			return next(ctx, method, req)
+		}
+		var args map[string]any
+		if len(call.Params.Arguments) > 0 {
+			if err := json.Unmarshal(call.Params.Arguments, &args); err != nil {
+				return next(ctx, method, req)
+			}
+		}
+		var session string
+		if call.Session != nil {
+			session = call.Session.ID()
+		}
+		request, err := c.Confirm(session, call.Params.Name, args, time.Now())
+		if err != nil {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+			}, nil
+		}
+		if request == nil {
+			return next(ctx, method, req)
+		}
+		slog.Debug("destructive call needs confirmation", "tool", call.Params.Name)
+		jsonBytes, err := json.Marshal(request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal response: %w", err)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{
+					Text: string(jsonBytes),
+				},
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,107 @@
+package confirm
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func isStop(args map[string]any) bool {
+	return args["action"] == "stop"
+}
+
+func TestConfirm(t *testing.T) {
+	c := New(DefaultTTL)
+	c.Require("change_unit_state", isStop)
+	c.Require("switch_target", nil)
+	now := time.Now()
+
+	request, err := c.Confirm("s1", "change_unit_state", map[string]any{"name": "a.service", "action": "start"}, now)
+	require.NoError(t, err)
+	assert.Nil(t, request, "non destructive calls need no confirmation")
+	request, err = c.Confirm("s1", "show_unit", map[string]any{}, now)
+	require.NoError(t, err)
+	assert.Nil(t, request)
+
+	args := map[string]any{"name": "a.service", "action": "stop"}
+	request, err = c.Confirm("s1", "change_unit_state", args, now)
+	require.NoError(t, err)
+	require.NotNil(t, request)
+	assert.True(t, request.ConfirmationRequired)
+	assert.Equal(t, now.Add(DefaultTTL), request.Expires)
+
+	// other arguments, another session or another tool don't match
+	_, err = c.Confirm("s1", "change_unit_state", map[string]any{"name": "b.service", "action": "stop", "confirmation_token": request.Token}, now)
+	assert.Error(t, err)
+	_, err = c.Confirm("s2", "change_unit_state", map[string]any{"name": "a.service", "action": "stop", "confirmation_token": request.Token}, now)
+	assert.Error(t, err)
+	_, err = c.Confirm("s1", "switch_target", map[string]any{"name": "a.service", "action": "stop", "confirmation_token": request.Token}, now)
+	assert.Error(t, err)
+
+	confirmed := map[string]any{"action": "stop", "name": "a.service", "confirmation_token": request.Token}
+	request, err = c.Confirm("s1", "change_unit_state", confirmed, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Nil(t, request)
+	// a token is only valid once
+	_, err = c.Confirm("s1", "change_unit_state", confirmed, now.Add(time.Minute))
+	assert.Error(t, err)
+}
+
+func TestConfirmExpired(t *testing.T) {
+	c := New(DefaultTTL)
+	c.Require("switch_target", nil)
+	now := time.Now()
+	request, err := c.Confirm("", "switch_target", map[string]any{"target": "rescue.target"}, now)
+	require.NoError(t, err)
+	_, err = c.Confirm("", "switch_target", map[string]any{"target": "rescue.target", "confirmation_token": request.Token}, now.Add(DefaultTTL+time.Second))
+	assert.ErrorContains(t, err, "unknown or expired")
+	assert.Empty(t, c.pending)
+}
+
+func TestAdd(t *testing.T) {
+	c := New(DefaultTTL)
+	c.Require("switch_target", nil)
+	schema := &jsonschema.Schema{Type: "object", Properties: map[string]*jsonschema.Schema{"target": {Type: "string"}}}
+	c.Add(&mcp.Tool{Name: "switch_target", InputSchema: schema})
+	assert.Equal(t, "string", schema.Properties["confirmation_token"].Type)
+	other := &jsonschema.Schema{Type: "object", Properties: map[string]*jsonschema.Schema{}}
+	c.Add(&mcp.Tool{Name: "show_unit", InputSchema: other})
+	assert.Empty(t, other.Properties)
+}
+
+func TestMiddleware(t *testing.T) {
+	c := New(DefaultTTL)
+	c.Require("switch_target", nil)
+	calls := 0
+	handler := c.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		calls++
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "isolated"}}}, nil
+	})
+	call := func(args string) *mcp.CallToolResult {
+		result, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{
+			Params: &mcp.CallToolParamsRaw{Name: "switch_target", Arguments: json.RawMessage(args)},
+		})
+		require.NoError(t, err)
+		return result.(*mcp.CallToolResult)
+	}
+
+	result := call(`{"target":"rescue.target","confirm":true}`)
+	assert.Equal(t, 0, calls)
+	var request Request
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &request))
+	assert.True(t, request.ConfirmationRequired)
+
+	result = call(`{"target":"multi-user.target","confirm":true,"confirmation_token":"` + request.Token + `"}`)
+	assert.True(t, result.IsError)
+	assert.Equal(t, 0, calls)
+
+	result = call(`{"confirm":true,"confirmation_token":"` + request.Token + `","target":"rescue.target"}`)
+	assert.False(t, result.IsError)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,228 @@
+package dbusapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/batch"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/deadline"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/toolgroup"
+)
+
+// Interface is the dbus interface of the read-only tools
+const Interface = "org.opensuse.systemdmcp.Manager"
+
+// errors of the calls
+const (
+	errAccessDenied = "org.freedesktop.DBus.Error.AccessDenied"
+	errInvalidArgs  = "org.freedesktop.DBus.Error.InvalidArgs"
+	errToolFailed   = Interface + ".Error.ToolFailed"
+)
+
+// polkit actions the callers need by tool group, the tools of the other
+// groups need the generic read action
+var groupActions = map[string]string{
+	"units":    dbus.UnitsReadAction,
+	"journal":  dbus.JournalReadAction,
+	"files":    dbus.FilesReadAction,
+	"sessions": dbus.SessionsReadAction,
+}
+
+// API exports the read-only tools of the server as dbus methods, so that
+// local tools without MCP client, e.g. Cockpit plugins, get the same view of
+// the system. The methods take the arguments of the tool as JSON and return
+// its structured result as JSON.
+type API struct {
+	tools    *batch.Batch
+	deadline *deadline.Deadline
+	// credentials of the sender of a call, replaced by the tests
+	creds func(sender string) (authkeeper.PeerCred, error)
+	// checks the polkit action for the process, replaced by the tests
+	checkPolkit func(pid int32, action string) (bool, error)
+}
+
+// New exports the tools which can be batched, the calls get the timeouts of
+// the deadline
+func New(tools *batch.Batch, d *deadline.Deadline) *API {
+	return &API{
+		tools:       tools,
+		deadline:    d,
+		checkPolkit: dbus.CheckPolkitByPID,
+	}
+}
+
+// MethodName returns the dbus method of a tool, e.g. ListLoadedUnits for
+// list_loaded_units
+func MethodName(tool string) string {
+	words := strings.Split(tool, "_")
+	for i, w := range words {
+		if w != "" {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// authorize lets root and the user running the server call every tool,
+// other users need the polkit action of the group of the tool
+func (a *API) authorize(sender, tool string) (authkeeper.PeerCred, *godbus.Error) {
+	cred, err := a.creds(sender)
+	if err != nil {
+		return cred, godbus.MakeFailedError(err)
+	}
+	if cred.UID == 0 || cred.UID == uint32(os.Getuid()) {
+		return cred, nil
+	}
+	action, ok := groupActions[toolgroup.Of(tool)]
+	if !ok {
+		action = dbus.ReadAction
+	}
+	allowed, err := a.checkPolkit(cred.PID, action)
+	if err != nil {
+		return cred, godbus.MakeFailedError(err)
+	}
+	if !allowed {
+		return cred, godbus.NewError(errAccessDenied, []any{fmt.Sprintf("uid %d isn't authorized for %s", cred.UID, action)})
+	}
+	return cred, nil
+}
+
+// Call calls the tool with the JSON arguments and returns its result as JSON
+func (a *API) Call(sender godbus.Sender, tool, args string) (string, *godbus.Error) {
+	if !slices.Contains(a.tools.Tools(), tool) {
+		return "", godbus.NewError(errInvalidArgs, []any{fmt.Sprintf("%s isn't a read-only tool", tool)})
+	}
+	cred, dbusErr := a.authorize(string(sender), tool)
+	if dbusErr != nil {
+		return "", dbusErr
+	}
+	if args == "" {
+		args = "{}"
+	}
+	if !json.Valid([]byte(args)) {
+		return "", godbus.NewError(errInvalidArgs, []any{"the arguments aren't valid JSON"})
+	}
+	// the caller is authorized like a peer of the unix socket
+	ctx := authkeeper.WithPeerCred(context.Background(), cred)
+	if timeout := a.deadline.Timeout(tool); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req := &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: tool, Arguments: json.RawMessage(args)}}
+	res, out, err := a.tools.CallTool(ctx, req, tool, json.RawMessage(args))
+	slog.Info("dbus call", "tool", tool, "uid", cred.UID, "error", err)
+	if err != nil {
+		var authErr *authkeeper.AuthError
+		if errors.As(err, &authErr) {
+			return "", godbus.NewError(errAccessDenied, []any{err.Error()})
+		}
+		return "", godbus.NewError(errToolFailed, []any{err.Error()})
+	}
+	if res != nil && res.IsError {
+		return "", godbus.NewError(errToolFailed, []any{text(res)})
+	}
+	if out == nil {
+		return text(res), nil
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// ListTools returns the tools which can be called
+func (a *API) ListTools() ([]string, *godbus.Error) {
+	return a.tools.Tools(), nil
+}
+
+// text returns the text content of a result
+func text(res *mcp.CallToolResult) string {
+	if res == nil {
+		return ""
+	}
+	var texts []string
+	for _, c := range res.Content {
+		if t, ok := c.(*mcp.TextContent); ok {
+			texts = append(texts, t.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Export exports Call, ListTools and a method per tool at the path, so the
+// tools have to be registered before
+func (a *API) Export(conn *godbus.Conn, path string) error {
+	a.creds = func(sender string) (authkeeper.PeerCred, error) {
+		var cred authkeeper.PeerCred
+		if err := conn.BusObject().Call("org.freedesktop.DBus.GetConnectionUnixUser", 0, sender).Store(&cred.UID); err != nil {
+			return cred, err
+		}
+		var pid uint32
+		if err := conn.BusObject().Call("org.freedesktop.DBus.GetConnectionUnixProcessID", 0, sender).Store(&pid); err != nil {
+			return cred, err
+		}
+		cred.PID = int32(pid)
+		return cred, nil
+	}
+	methods := map[string]any{
+		"Call":      a.Call,
+		"ListTools": a.ListTools,
+	}
+	iface := introspect.Interface{
+		Name: Interface,
+		Methods: []introspect.Method{
+			{Name: "Call", Args: []introspect.Arg{{Name: "tool", Type: "s", Direction: "in"}, {Name: "arguments", Type: "s", Direction: "in"}, {Name: "result", Type: "s", Direction: "out"}}},
+			{Name: "ListTools", Args: []introspect.Arg{{Name: "tools", Type: "as", Direction: "out"}}},
+		},
+	}
+	for _, tool := range a.tools.Tools() {
+		methods[MethodName(tool)] = func(sender godbus.Sender, args string) (string, *godbus.Error) {
+			return a.Call(sender, tool, args)
+		}
+		iface.Methods = append(iface.Methods, introspect.Method{
+			Name: MethodName(tool),
+			Args: []introspect.Arg{{Name: "arguments", Type: "s", Direction: "in"}, {Name: "result", Type: "s", Direction: "out"}},
+		})
+	}
+	if err := conn.ExportMethodTable(methods, godbus.ObjectPath(path), Interface); err != nil {
+		return err
+	}
+	node := &introspect.Node{Name: path, Interfaces: []introspect.Interface{introspect.IntrospectData, iface}}
+	return conn.Export(introspect.NewIntrospectable(node), godbus.ObjectPath(path), "org.freedesktop.DBus.Introspectable")
+}
+
+// Connect connects to the system bus if running as root and to the session
+// bus otherwise and requests the name
+func Connect(name string) (*godbus.Conn, error) {
+	connect := godbus.ConnectSessionBus
+	if os.Geteuid() == 0 {
+		connect = godbus.ConnectSystemBus
+	}
+	conn, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.RequestName(name, godbus.NameFlagDoNotQueue)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if reply != godbus.RequestNameReplyPrimaryOwner {
+		conn.Close()
+		return nil, fmt.Errorf("dbus name %s is already taken", name)
+	}
+	return conn, nil
+}
@@ -0,0 +1,107 @@
+package dbusapi
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/batch"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/deadline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type listParams struct {
+	Pattern string `json:"pattern,omitempty"`
+}
+
+type listResult struct {
+	Units []string `json:"units"`
+	UID   uint32   `json:"uid"`
+}
+
+func newAPI(t *testing.T, uid uint32, allowed bool) (*API, *string) {
+	t.Helper()
+	tools := batch.New()
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	batch.AddTool(tools, server, &mcp.Tool{Name: "list_loaded_units"}, func(ctx context.Context, req *mcp.CallToolRequest, params *listParams) (*mcp.CallToolResult, any, error) {
+		if params.Pattern == "fail" {
+			return nil, nil, &authkeeper.AuthError{Code: authkeeper.AuthDenied, Message: "denied"}
+		}
+		cred, _ := authkeeper.PeerCredFromContext(ctx)
+		return &mcp.CallToolResult{}, listResult{Units: []string{"sshd.service"}, UID: cred.UID}, nil
+	})
+	batch.AddTool(tools, server, &mcp.Tool{Name: "get_man_page"}, func(ctx context.Context, req *mcp.CallToolRequest, params *listParams) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "no page"}}, IsError: true}, nil, nil
+	})
+	api := New(tools, deadline.New(deadline.DefaultTimeout))
+	api.creds = func(sender string) (authkeeper.PeerCred, error) {
+		return authkeeper.PeerCred{PID: 42, UID: uid}, nil
+	}
+	var checked string
+	api.checkPolkit = func(pid int32, action string) (bool, error) {
+		checked = action
+		return allowed, nil
+	}
+	return api, &checked
+}
+
+func TestMethodName(t *testing.T) {
+	assert.Equal(t, "ListLoadedUnits", MethodName("list_loaded_units"))
+	assert.Equal(t, "CanI", MethodName("can_i"))
+}
+
+func TestCall(t *testing.T) {
+	api, checked := newAPI(t, uint32(os.Getuid()), false)
+	tools, dbusErr := api.ListTools()
+	require.Nil(t, dbusErr)
+	assert.Equal(t, []string{"get_man_page", "list_loaded_units"}, tools)
+
+	// the user running the server isn't checked by polkit
+	out, dbusErr := api.Call(":1.1", "list_loaded_units", "")
+	require.Nil(t, dbusErr)
+	var res listResult
+	require.NoError(t, json.Unmarshal([]byte(out), &res))
+	assert.Equal(t, []string{"sshd.service"}, res.Units)
+	assert.Equal(t, uint32(os.Getuid()), res.UID)
+	assert.Empty(t, *checked)
+
+	_, dbusErr = api.Call(":1.1", "change_unit_state", "{}")
+	require.NotNil(t, dbusErr)
+	assert.Equal(t, errInvalidArgs, dbusErr.Name)
+	_, dbusErr = api.Call(":1.1", "list_loaded_units", "{")
+	require.NotNil(t, dbusErr)
+	assert.Equal(t, errInvalidArgs, dbusErr.Name)
+	_, dbusErr = api.Call(":1.1", "list_loaded_units", `{"pattern": "fail"}`)
+	require.NotNil(t, dbusErr)
+	assert.Equal(t, errAccessDenied, dbusErr.Name)
+	_, dbusErr = api.Call(":1.1", "get_man_page", "{}")
+	require.NotNil(t, dbusErr)
+	assert.Equal(t, errToolFailed, dbusErr.Name)
+	assert.Equal(t, []any{"no page"}, dbusErr.Body)
+}
+
+func TestCallAuthorization(t *testing.T) {
+	uid := uint32(os.Getuid()) + 1000
+	if os.Getuid() == 0 {
+		uid = 1000
+	}
+	api, checked := newAPI(t, uid, false)
+	_, dbusErr := api.Call(godbus.Sender(":1.2"), "list_loaded_units", "{}")
+	require.NotNil(t, dbusErr)
+	assert.Equal(t, errAccessDenied, dbusErr.Name)
+	assert.Equal(t, dbus.UnitsReadAction, *checked)
+	_, dbusErr = api.Call(godbus.Sender(":1.2"), "get_man_page", "{}")
+	require.NotNil(t, dbusErr)
+	assert.Equal(t, dbus.ReadAction, *checked)
+
+	api, _ = newAPI(t, uid, true)
+	out, dbusErr := api.Call(godbus.Sender(":1.2"), "list_loaded_units", "{}")
+	require.Nil(t, dbusErr)
+	assert.Contains(t, out, "sshd.service")
+}
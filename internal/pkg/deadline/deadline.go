@@ -0,0 +1,95 @@
+package deadline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// DefaultTimeout is the time a tool call gets for its dbus and journal
+// operations
+const DefaultTimeout = 25 * time.Second
+
+// Deadline cancels the context of a tool call after its timeout, so that a
+// hung systemd or a slow journal can't make the requests pile up
+type Deadline struct {
+	// timeout of the tools without own timeout, 0 for none
+	timeout time.Duration
+	tools   map[string]time.Duration
+}
+
+// New gives every tool call the timeout, 0 disables it
+func New(timeout time.Duration) *Deadline {
+	return &Deadline{
+		timeout: max(timeout, 0),
+		tools:   make(map[string]time.Duration),
+	}
+}
+
+// SetToolTimeout sets the timeout of a single tool, e.g. one waiting for a
+// job by itself, 0 disables it
+func (d *Deadline) SetToolTimeout(tool string, timeout time.Duration) {
+	d.tools[tool] = max(timeout, 0)
+}
+
+// SetToolTimeouts sets the timeouts of single tools given as tool=duration,
+// e.g. list_log=1m
+func (d *Deadline) SetToolTimeouts(timeouts []string) error {
+	for _, t := range timeouts {
+		tool, duration, ok := strings.Cut(t, "=")
+		if !ok || tool == "" {
+			return fmt.Errorf("invalid tool timeout %q, use TOOL=DURATION", t)
+		}
+		timeout, err := time.ParseDuration(duration)
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("invalid tool timeout %q, use TOOL=DURATION", t)
+		}
+		d.tools[tool] = timeout
+	}
+	return nil
+}
+
+// Timeout returns the timeout of the tool, 0 if its calls have none
+func (d *Deadline) Timeout(tool string) time.Duration {
+	if timeout, ok := d.tools[tool]; ok {
+		return timeout
+	}
+	return d.timeout
+}
+
+// Middleware runs the tool calls with the timeout of the tool and replaces
+// the error of a call which ran out of time
+func (d *Deadline) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || call.Params == nil {
+			return next(ctx, method, req)
+		}
+		timeout := d.Timeout(call.Params.Name)
+		if timeout == 0 {
+			return next(ctx, method, req)
+		}
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		result, err := next(callCtx, method, req)
+		if ctx.Err() != nil || !errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+			return result, err
+		}
+		if res, ok := result.(*mcp.CallToolResult); err == nil && ok && !res.IsError {
+			// finished just in time
+			return result, err
+		}
+		slog.Warn("tool call ran out of time", "tool", call.Params.Name, "timeout", timeout)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{
+				Text: fmt.Sprintf("%s didn't finish within %s, systemd or the journal doesn't answer in time, retry later", call.Params.Name, timeout),
+			}},
+		}, nil
+	}
+}
@@ -0,0 +1,53 @@
+package deadline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetToolTimeouts(t *testing.T) {
+	d := New(DefaultTimeout)
+	require.NoError(t, d.SetToolTimeouts([]string{"list_log=1m", "follow_log=0"}))
+	assert.Equal(t, time.Minute, d.Timeout("list_log"))
+	assert.Equal(t, time.Duration(0), d.Timeout("follow_log"))
+	assert.Equal(t, DefaultTimeout, d.Timeout("list_units"))
+	for _, invalid := range []string{"list_log", "=1m", "list_log=long", "list_log=-1s"} {
+		assert.Error(t, d.SetToolTimeouts([]string{invalid}), invalid)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	d := New(10 * time.Millisecond)
+	d.SetToolTimeout("follow_log", 0)
+	// the handler hangs like a call to a hung systemd
+	handler := d.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if req.(*mcp.CallToolRequest).Params.Name == "follow_log" {
+			_, ok := ctx.Deadline()
+			assert.False(t, ok)
+			return &mcp.CallToolResult{}, nil
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	result, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_units"}})
+	require.NoError(t, err)
+	res := result.(*mcp.CallToolResult)
+	assert.True(t, res.IsError)
+	assert.Contains(t, res.Content[0].(*mcp.TextContent).Text, "list_units didn't finish within 10ms")
+
+	result, err = handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "follow_log"}})
+	require.NoError(t, err)
+	assert.False(t, result.(*mcp.CallToolResult).IsError)
+
+	// a canceled request keeps its error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = handler(ctx, "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_units"}})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,146 @@
+package dryrun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Effects are the changes a call of a write tool would make
+type Effects struct {
+	DBusMethods []string `json:"dbus_methods,omitempty"`
+	Files       []string `json:"files,omitempty"`
+	Commands    []string `json:"commands,omitempty"`
+}
+
+// Tool describes a write tool for the dry run
+type Tool struct {
+	// polkit action the call is authorized with
+	Permission string
+	Effects    func(args map[string]any) Effects
+	// argument with which the tool previews a call by itself, it is then
+	// called with the argument set to PreviewValue instead of being described
+	PreviewArgument string
+	PreviewValue    any
+}
+
+// Preview is the result of a dry run
+type Preview struct {
+	DryRun       bool           `json:"dry_run"`
+	Tool         string         `json:"tool"`
+	Arguments    map[string]any `json:"arguments,omitempty"`
+	PolkitAction string         `json:"polkit_action"`
+	Effects
+	Message string `json:"message"`
+}
+
+// DryRun lets the write tools describe what they would do instead of doing
+// it, for the calls with the dry_run argument or for all calls
+type DryRun struct {
+	// all calls of the write tools are dry runs
+	Always bool
+	tools  map[string]Tool
+}
+
+func New(always bool, tools map[string]Tool) *DryRun {
+	return &DryRun{
+		Always: always,
+		tools:  tools,
+	}
+}
+
+// Add adds the dry_run argument to the input schema of a write tool, it has
+// to be called before the tool is registered as the server copies the tool
+func (d *DryRun) Add(tool *mcp.Tool) {
+	if _, ok := d.tools[tool.Name]; !ok {
+		return
+	}
+	schema, ok := tool.InputSchema.(*jsonschema.Schema)
+	if !ok || schema == nil {
+		return
+	}
+	if _, ok := schema.Properties["dry_run"]; ok {
+		return
+	}
+	if schema.Properties == nil {
+		schema.Properties = make(map[string]*jsonschema.Schema)
+	}
+	schema.Properties["dry_run"] = &jsonschema.Schema{
+		Type:        "boolean",
+		Description: "Only describe the dbus methods, files and polkit action of the call without performing it.",
+	}
+}
+
+// Describe returns the preview of a call of a write tool
+func (d *DryRun) Describe(name string, args map[string]any) (Preview, bool) {
+	tool, ok := d.tools[name]
+	if !ok {
+		return Preview{}, false
+	}
+	preview := Preview{
+		DryRun:       true,
+		Tool:         name,
+		Arguments:    args,
+		PolkitAction: tool.Permission,
+		Message:      "dry run, nothing was changed. The arguments weren't checked against the system.",
+	}
+	if tool.Effects != nil {
+		preview.Effects = tool.Effects(args)
+	}
+	return preview, true
+}
+
+// Middleware answers the dry runs of the write tools, the other calls are
+// passed through
+func (d *DryRun) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || call.Params == nil {
+			return next(ctx, method, req)
+		}
+		tool, ok := d.tools[call.Params.Name]
+		if !ok {
+			return next(ctx, method, req)
+		}
+		var args map[string]any
+		if len(call.Params.Arguments) > 0 {
+			if err := json.Unmarshal(call.Params.Arguments, &args); err != nil {
+				return next(ctx, method, req)
+			}
+		}
+		if requested, _ := args["dry_run"].(bool); !requested && !d.Always {
+			return next(ctx, method, req)
+		}
+		if tool.PreviewArgument != "" {
+			if args == nil {
+				args = make(map[string]any)
+			}
+			args[tool.PreviewArgument] = tool.PreviewValue
+			raw, err := json.Marshal(args)
+			if err != nil {
+				return nil, err
+			}
+			call.Params.Arguments = raw
+			slog.Debug("dry run of tool", "tool", call.Params.Name, "argument", tool.PreviewArgument)
+			return next(ctx, method, req)
+		}
+		delete(args, "dry_run")
+		preview, _ := d.Describe(call.Params.Name, args)
+		jsonBytes, err := json.Marshal(preview)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal response: %w", err)
+		}
+		slog.Debug("dry run of tool", "tool", call.Params.Name)
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{
+					Text: string(jsonBytes),
+				},
+			},
+		}, nil
+	}
+}
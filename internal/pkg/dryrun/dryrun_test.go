@@ -0,0 +1,88 @@
+package dryrun
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testTools = map[string]Tool{
+	"set_runbook": {
+		Permission: "org.freedesktop.systemd1.manage-unit-files",
+		Effects: func(args map[string]any) Effects {
+			return Effects{Files: []string{"/var/lib/systemd-mcp/runbooks/" + args["unit"].(string) + ".md"}}
+		},
+	},
+	"apply_state": {Permission: "org.freedesktop.systemd1.manage-unit-files", PreviewArgument: "apply", PreviewValue: false},
+}
+
+// call returns the arguments the handler was called with, nil if it wasn't
+// called
+func call(t *testing.T, d *DryRun, name, args string) (*mcp.CallToolResult, map[string]any) {
+	var called map[string]any
+	handler := d.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		called = make(map[string]any)
+		require.NoError(t, json.Unmarshal(req.(*mcp.CallToolRequest).Params.Arguments, &called))
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "done"}}}, nil
+	})
+	result, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{
+		Params: &mcp.CallToolParamsRaw{Name: name, Arguments: json.RawMessage(args)},
+	})
+	require.NoError(t, err)
+	return result.(*mcp.CallToolResult), called
+}
+
+func TestAdd(t *testing.T) {
+	d := New(false, testTools)
+	schema := &jsonschema.Schema{Type: "object", Properties: map[string]*jsonschema.Schema{"unit": {Type: "string"}}}
+	d.Add(&mcp.Tool{Name: "set_runbook", InputSchema: schema})
+	assert.Equal(t, "boolean", schema.Properties["dry_run"].Type)
+
+	// read tools and tools with their own dry_run are left alone
+	readSchema := &jsonschema.Schema{Type: "object", Properties: map[string]*jsonschema.Schema{}}
+	d.Add(&mcp.Tool{Name: "show_unit", InputSchema: readSchema})
+	assert.NotContains(t, readSchema.Properties, "dry_run")
+	own := &jsonschema.Schema{Type: "boolean", Description: "own"}
+	d.Add(&mcp.Tool{Name: "apply_state", InputSchema: &jsonschema.Schema{Properties: map[string]*jsonschema.Schema{"dry_run": own}}})
+	assert.Equal(t, "own", own.Description)
+}
+
+func TestMiddleware(t *testing.T) {
+	d := New(false, testTools)
+
+	result, called := call(t, d, "set_runbook", `{"unit":"nginx.service","content":"restart it"}`)
+	assert.NotNil(t, called)
+	assert.Equal(t, "done", result.Content[0].(*mcp.TextContent).Text)
+
+	result, called = call(t, d, "set_runbook", `{"unit":"nginx.service","content":"restart it","dry_run":true}`)
+	assert.Nil(t, called)
+	var preview Preview
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &preview))
+	assert.True(t, preview.DryRun)
+	assert.Equal(t, "org.freedesktop.systemd1.manage-unit-files", preview.PolkitAction)
+	assert.Equal(t, []string{"/var/lib/systemd-mcp/runbooks/nginx.service.md"}, preview.Files)
+	assert.Equal(t, map[string]any{"unit": "nginx.service", "content": "restart it"}, preview.Arguments)
+
+	// the tool previews the call by itself
+	_, called = call(t, d, "apply_state", `{"manifest":"units: []","apply":true,"dry_run":true}`)
+	assert.Equal(t, false, called["apply"])
+
+	// read tools are passed through
+	_, called = call(t, d, "show_unit", `{"dry_run":true}`)
+	assert.NotNil(t, called)
+}
+
+func TestMiddlewareAlways(t *testing.T) {
+	d := New(true, testTools)
+	result, called := call(t, d, "set_runbook", `{"unit":"nginx.service"}`)
+	assert.Nil(t, called)
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, `"dry_run":true`)
+
+	_, called = call(t, d, "apply_state", `{"manifest":"units: []","apply":true}`)
+	assert.Equal(t, false, called["apply"])
+}
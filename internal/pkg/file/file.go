@@ -2,9 +2,12 @@ package file
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/user"
@@ -16,6 +19,40 @@ import (
 
 	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+)
+
+// Auth authorizes reading the files with the files.read action, nil reads
+// them without asking
+var Auth auth.AuthKeeper
+
+// Units are the units whose files below the systemd directories can be read,
+// nil for all
+var Units *policy.UnitAccess
+
+// DefaultRoots are the directories below which files can be read unless
+// other roots are configured
+var DefaultRoots = []string{"/etc/systemd", "/usr/lib/systemd", "/run/systemd", "/var/log"}
+
+// Roots are the directories below which files can be read, nil for all. The
+// symlinks are resolved before the check, so a symlink below a root can't
+// lead outside of the roots.
+var Roots []string
+
+// DefaultWriteRoots are the directories below which files can be written
+// unless other roots are configured
+var DefaultWriteRoots = []string{"/etc/systemd", "/run/systemd"}
+
+// WriteRoots are the directories below which put_file can write, nil for the
+// roots files can be read from. A written file has to be below both.
+var WriteRoots []string
+
+// suffixes of the unit files and of the directories which belong to a unit
+var (
+	unitSuffixes = []string{".service", ".socket", ".target", ".timer", ".path", ".mount", ".automount", ".swap", ".slice", ".scope", ".device"}
+	dirSuffixes  = []string{".d", ".wants", ".requires", ".upholds"}
 )
 
 type GetFileParams struct {
@@ -23,6 +60,8 @@ type GetFileParams struct {
 	ShowContent bool   `json:"show_content,omitempty" jsonschema:"Whether to show file content. Defaults to false."`
 	Offset      int    `json:"offset,omitempty" jsonschema:"Line offset for pagination. Defaults to 0."`
 	Limit       int    `json:"limit,omitempty" jsonschema:"Line limit for pagination. Defaults to 1000."`
+	ByteOffset  int64  `json:"byte_offset,omitempty" jsonschema:"Read the content from this byte on instead of by lines, e.g. for large files with long lines. Implies show_content."`
+	ByteLength  int64  `json:"byte_length,omitempty" jsonschema:"Number of bytes to read from byte_offset, at most 1 MiB. Defaults to 64 KiB. Implies show_content."`
 }
 
 type FileMetadata struct {
@@ -43,6 +82,25 @@ type GetFileResult struct {
 	TotalLines int            `json:"total_lines,omitempty"`
 	Offset     int            `json:"offset,omitempty"`
 	Limit      int            `json:"limit,omitempty"`
+	ByteOffset int64          `json:"byte_offset,omitempty"`
+	ByteLength int64          `json:"byte_length,omitempty"`
+	Binary     bool           `json:"binary,omitempty"`
+	Warning    string         `json:"warning,omitempty"`
+}
+
+const (
+	// files with a NUL byte in their beginning are binary, their content
+	// isn't returned
+	binaryProbe = 8000
+	// lines up to this length are read, e.g. of JSON logs
+	maxLineLength     = 16 << 20
+	defaultByteLength = 64 << 10
+	maxByteLength     = 1 << 20
+)
+
+// isBinary reports if the beginning of a file is binary
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), binaryProbe)], 0) >= 0
 }
 
 func CreateFileSchema() *jsonschema.Schema {
@@ -50,6 +108,7 @@ func CreateFileSchema() *jsonschema.Schema {
 	inputSchema.Properties["limit"].Default = json.RawMessage(`1000`)
 	inputSchema.Properties["offset"].Default = json.RawMessage(`0`)
 	inputSchema.Properties["show_content"].Default = json.RawMessage(`false`)
+	inputSchema.Properties["byte_length"].Default = json.RawMessage(`65536`)
 	return inputSchema
 }
 
@@ -93,79 +152,205 @@ func getFileMetadata(ctx context.Context, path string, info os.FileInfo, fetchAC
 	return metadata
 }
 
+// unitOf returns the unit a file or directory is named after, e.g.
+// nginx.service for nginx.service.d
+func unitOf(name string) string {
+	for _, suffix := range dirSuffixes {
+		if trimmed, ok := strings.CutSuffix(name, suffix); ok {
+			name = trimmed
+			break
+		}
+	}
+	for _, suffix := range unitSuffixes {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return name
+		}
+	}
+	return ""
+}
+
+// checkUnitPath refuses the files of units which can't be accessed, these
+// are the files below a systemd directory, e.g. /etc/systemd/system, named
+// after a unit
+func checkUnitPath(path string) error {
+	below := false
+	for _, elem := range strings.Split(filepath.Clean(path), string(filepath.Separator)) {
+		if elem == "systemd" {
+			below = true
+			continue
+		}
+		if unit := unitOf(elem); below && unit != "" {
+			if err := Units.Check(unit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolvedRoots returns the roots with their symlinks resolved, the roots
+// which don't exist are left out
+func resolvedRoots() []string {
+	return resolveRoots(Roots)
+}
+
+// resolveRoots resolves the symlinks of the roots, missing roots are left out
+func resolveRoots(configured []string) []string {
+	var roots []string
+	for _, root := range configured {
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			roots = append(roots, resolved)
+		}
+	}
+	return roots
+}
+
+// rootOf returns the root the path is below and the path relative to it
+func rootOf(path string, roots []string) (string, string, bool) {
+	path = filepath.Clean(path)
+	for _, root := range roots {
+		if rel, err := filepath.Rel(filepath.Clean(root), path); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return root, rel, true
+		}
+	}
+	return "", "", false
+}
+
+// checkRoot refuses the files outside of the roots
+func checkRoot(path string, roots []string) error {
+	if Roots == nil {
+		return nil
+	}
+	if _, _, ok := rootOf(path, roots); ok {
+		return nil
+	}
+	return fmt.Errorf("%s is outside of the directories files can be read from: %s", filepath.Clean(path), strings.Join(Roots, ", "))
+}
+
+// checkPath checks the path against the roots and the units
+func checkPath(path string, roots []string) error {
+	if err := checkRoot(path, roots); err != nil {
+		return err
+	}
+	if Units == nil {
+		return nil
+	}
+	return checkUnitPath(path)
+}
+
+// checkAccess checks the path and, for symlinks, the file it points to and
+// returns the path with the symlinks resolved
+func checkAccess(path string) (string, error) {
+	if Units == nil && Roots == nil {
+		return path, nil
+	}
+	if Roots != nil && !filepath.IsAbs(path) {
+		return "", fmt.Errorf("%s isn't an absolute path", path)
+	}
+	// the path may be given below a root or the directory it points to
+	roots := resolvedRoots()
+	if err := checkPath(path, append(roots, Roots...)); err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		// the file doesn't exist, opening it fails
+		return path, nil
+	}
+	if resolved != path {
+		if err := checkPath(resolved, roots); err != nil {
+			return "", fmt.Errorf("%s points to %s: %w", path, resolved, err)
+		}
+	}
+	return resolved, nil
+}
+
+// openFile opens the checked file through its root, so that a symlink
+// swapped in after the check can't lead outside of the roots
+func openFile(path string) (*os.File, error) {
+	if Roots == nil {
+		return os.Open(path)
+	}
+	r, rel, err := openRoot(path, Roots)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return r.Open(rel)
+}
+
 // reads a file with the privileges of the systemd service
 func GetFile(ctx context.Context, req *mcp.CallToolRequest, params *GetFileParams) (*mcp.CallToolResult, any, error) {
-	info, err := os.Stat(params.Path)
+	if Auth != nil {
+		if allowed, err := Auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.FilesReadAction)); err != nil {
+			return nil, nil, err
+		} else if !allowed {
+			return nil, nil, fmt.Errorf("calling method was canceled by user")
+		}
+	}
+	if params.ByteOffset < 0 || params.ByteLength < 0 {
+		return nil, nil, fmt.Errorf("byte_offset and byte_length can't be negative")
+	}
+	path, err := checkAccess(params.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := openFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 
-	metadata := getFileMetadata(ctx, params.Path, info, true)
+	metadata := getFileMetadata(ctx, path, info, true)
+	// the name asked for, not the one of the target of a symlink
+	metadata.Name = filepath.Base(params.Path)
 
 	result := &GetFileResult{
 		Metadata: metadata,
 	}
 
 	if info.IsDir() {
-		entries, err := os.ReadDir(params.Path)
+		entries, err := os.ReadDir(path)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to read directory: %w", err)
 		}
 
 		var fileEntries []FileMetadata
 		for _, entry := range entries {
+			if _, err := checkAccess(filepath.Join(path, entry.Name())); err != nil {
+				continue
+			}
 			entryInfo, err := entry.Info()
 			if err != nil {
 				continue
 			}
-			meta := getFileMetadata(ctx, filepath.Join(params.Path, entry.Name()), entryInfo, false)
+			meta := getFileMetadata(ctx, filepath.Join(path, entry.Name()), entryInfo, false)
 			fileEntries = append(fileEntries, *meta)
 		}
 		result.Entries = fileEntries
-	} else if params.ShowContent {
-		f, err := os.Open(params.Path)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to open file: %w", err)
-		}
-		defer f.Close()
-
-		limit := params.Limit
-		if limit <= 0 {
-			limit = 1000
+	} else if params.ShowContent || params.ByteOffset > 0 || params.ByteLength > 0 {
+		probe := make([]byte, binaryProbe)
+		n, err := io.ReadFull(f, probe)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, nil, fmt.Errorf("error reading file: %w", err)
 		}
-
-		// Count lines or read with limit
-		// Since we need to paginate, we might need to scan through lines.
-		// For huge files, this is inefficient, but simple for now.
-		// An optimization would be to seek if lines are fixed width, but they aren't.
-
-		var lines []string
-		scanner := bufio.NewScanner(f)
-		lineCount := 0
-		linesRead := 0
-
-		// If offset is huge, this is slow.
-		// But usually we just read config files.
-		for scanner.Scan() {
-			if lineCount >= params.Offset && linesRead < limit {
-				lines = append(lines, scanner.Text())
-				linesRead++
+		if isBinary(probe[:n]) {
+			result.Binary = true
+			result.Warning = "binary file, only the metadata is returned"
+		} else if params.ByteOffset > 0 || params.ByteLength > 0 {
+			if err := readBytes(f, params, result); err != nil {
+				return nil, nil, err
 			}
-			lineCount++
-		}
-
-		if err := scanner.Err(); err != nil {
-			// Handle token too long or other errors?
-			// For now just return what we have or error.
-			if err != bufio.ErrTooLong {
+		} else {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
 				return nil, nil, fmt.Errorf("error reading file: %w", err)
 			}
+			readLines(f, params, result)
 		}
-
-		result.Content = strings.Join(lines, "\n")
-		result.TotalLines = lineCount
-		result.Offset = params.Offset
-		result.Limit = limit
 	}
 
 	jsonBytes, err := json.Marshal(result)
@@ -179,5 +364,58 @@ func GetFile(ctx context.Context, req *mcp.CallToolRequest, params *GetFileParam
 				Text: string(jsonBytes),
 			},
 		},
-	}, nil, nil
+	}, result, nil
+}
+
+// readLines reads the lines of the page of the file, the content after a line
+// longer than maxLineLength is left out with a warning
+func readLines(f *os.File, params *GetFileParams, result *GetFileResult) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	lineCount := 0
+	for scanner.Scan() {
+		if lineCount >= params.Offset && len(lines) < limit {
+			lines = append(lines, scanner.Text())
+		}
+		lineCount++
+	}
+	if err := scanner.Err(); err != nil {
+		result.Warning = fmt.Sprintf("stopped reading at line %d: %s, read the rest with byte_offset and byte_length", lineCount+1, err)
+		if errors.Is(err, bufio.ErrTooLong) {
+			result.Warning = fmt.Sprintf("line %d is longer than %d bytes, read the rest with byte_offset and byte_length", lineCount+1, maxLineLength)
+		}
+	}
+	result.Content = strings.Join(lines, "\n")
+	result.TotalLines = lineCount
+	result.Offset = params.Offset
+	result.Limit = limit
+}
+
+// readBytes reads the byte range of the file without scanning the lines
+// before it
+func readBytes(f *os.File, params *GetFileParams, result *GetFileResult) error {
+	length := params.ByteLength
+	if length <= 0 {
+		length = defaultByteLength
+	}
+	length = min(length, maxByteLength)
+	data := make([]byte, length)
+	n, err := f.ReadAt(data, params.ByteOffset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+	if bytes.IndexByte(data[:n], 0) >= 0 {
+		result.Binary = true
+		result.Warning = "the range contains binary data, only the metadata is returned"
+		return nil
+	}
+	result.Content = string(data[:n])
+	result.ByteOffset = params.ByteOffset
+	result.ByteLength = int64(n)
+	return nil
 }
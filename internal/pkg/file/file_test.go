@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -70,3 +71,125 @@ func TestGetFile_Unit(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestCheckAccess(t *testing.T) {
+	units, err := policy.NewUnitAccess([]string{"nginx*.service"}, nil)
+	require.NoError(t, err)
+	Units = units
+	defer func() { Units = nil }()
+	checkAccess := func(path string) error {
+		_, err := checkAccess(path)
+		return err
+	}
+
+	assert.NoError(t, checkAccess("/etc/systemd/system/nginx.service"))
+	assert.NoError(t, checkAccess("/etc/systemd/system/nginx.service.d/override.conf"))
+	assert.Error(t, checkAccess("/usr/lib/systemd/system/sshd.service"))
+	assert.Error(t, checkAccess("/etc/systemd/system/sshd.service.d/override.conf"))
+	// only files below the systemd directories are named after units
+	assert.NoError(t, checkAccess("/etc/ssh/sshd_config"))
+	assert.NoError(t, checkAccess("/srv/backup/sshd.service"))
+
+	// the directory entries of other units are left out
+	tmpDir := filepath.Join(t.TempDir(), "systemd")
+	require.NoError(t, os.Mkdir(tmpDir, 0755))
+	for _, name := range []string{"nginx.service", "sshd.service"} {
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte("[Unit]\n"), 0644))
+	}
+	res, _, err := GetFile(context.Background(), &mcp.CallToolRequest{}, &GetFileParams{Path: tmpDir})
+	require.NoError(t, err)
+	var result GetFileResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+	require.Len(t, result.Entries, 1)
+	assert.Equal(t, "nginx.service", result.Entries[0].Name)
+	_, _, err = GetFile(context.Background(), &mcp.CallToolRequest{}, &GetFileParams{Path: filepath.Join(tmpDir, "sshd.service")})
+	assert.Error(t, err)
+}
+
+func TestRoots(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "root")
+	outside := filepath.Join(tmpDir, "outside")
+	require.NoError(t, os.Mkdir(root, 0755))
+	require.NoError(t, os.Mkdir(outside, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "inside.conf"), []byte("inside\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("secret\n"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "escape")))
+	require.NoError(t, os.Symlink(filepath.Join(root, "inside.conf"), filepath.Join(root, "link.conf")))
+	// a root which is a symlink itself
+	require.NoError(t, os.Symlink(root, filepath.Join(tmpDir, "alias")))
+	Roots = []string{filepath.Join(tmpDir, "alias")}
+	defer func() { Roots = nil }()
+
+	read := func(path string) (string, error) {
+		_, out, err := GetFile(context.Background(), nil, &GetFileParams{Path: path, ShowContent: true})
+		if err != nil {
+			return "", err
+		}
+		return out.(*GetFileResult).Content, nil
+	}
+	content, err := read(filepath.Join(tmpDir, "alias", "inside.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "inside", content)
+	content, err = read(filepath.Join(tmpDir, "alias", "link.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "inside", content)
+
+	_, err = read(filepath.Join(outside, "secret"))
+	assert.ErrorContains(t, err, "outside of the directories")
+	_, err = read(filepath.Join(tmpDir, "alias", "..", "outside", "secret"))
+	assert.ErrorContains(t, err, "outside of the directories")
+	_, err = read(filepath.Join(tmpDir, "alias", "escape"))
+	assert.ErrorContains(t, err, "outside of the directories")
+	_, err = read("alias/inside.conf")
+	assert.ErrorContains(t, err, "isn't an absolute path")
+
+	// the symlinks leading outside are left out of the listing
+	_, out, err := GetFile(context.Background(), nil, &GetFileParams{Path: filepath.Join(tmpDir, "alias")})
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range out.(*GetFileResult).Entries {
+		names = append(names, entry.Name)
+	}
+	assert.ElementsMatch(t, []string{"inside.conf", "link.conf"}, names)
+
+	// a symlink swapped in after the check is refused by the root
+	_, err = openFile(filepath.Join(root, "escape"))
+	assert.Error(t, err)
+}
+
+func TestGetFileContent(t *testing.T) {
+	tmpDir := t.TempDir()
+	get := func(params *GetFileParams) *GetFileResult {
+		_, out, err := GetFile(context.Background(), nil, params)
+		require.NoError(t, err)
+		return out.(*GetFileResult)
+	}
+
+	binary := filepath.Join(tmpDir, "journal")
+	require.NoError(t, os.WriteFile(binary, []byte("LPKSHHRH\x00\x00\x01"), 0644))
+	res := get(&GetFileParams{Path: binary, ShowContent: true})
+	assert.True(t, res.Binary)
+	assert.NotEmpty(t, res.Warning)
+	assert.Empty(t, res.Content)
+	assert.Equal(t, int64(11), res.Metadata.Size)
+
+	// lines longer than the default buffer of the scanner are read
+	long := strings.Repeat("x", 100*1024)
+	jsonLog := filepath.Join(tmpDir, "app.json")
+	require.NoError(t, os.WriteFile(jsonLog, []byte("{\"msg\":\""+long+"\"}\nsecond\n"), 0644))
+	res = get(&GetFileParams{Path: jsonLog, ShowContent: true, Offset: 1})
+	assert.Empty(t, res.Warning)
+	assert.Equal(t, 2, res.TotalLines)
+	assert.Equal(t, "second", res.Content)
+
+	res = get(&GetFileParams{Path: jsonLog, ByteOffset: 2, ByteLength: 3})
+	assert.Equal(t, "msg", res.Content)
+	assert.Equal(t, int64(2), res.ByteOffset)
+	assert.Equal(t, int64(3), res.ByteLength)
+	res = get(&GetFileParams{Path: jsonLog, ByteOffset: int64(len(long)) + 8})
+	assert.Equal(t, "\"}\nsecond\n", res.Content)
+
+	_, _, err := GetFile(context.Background(), nil, &GetFileParams{Path: jsonLog, ByteOffset: -1})
+	assert.Error(t, err)
+}
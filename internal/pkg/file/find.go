@@ -0,0 +1,312 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+const (
+	// files are listed up to this number by default
+	defaultFindLimit = 100
+	// lines matching contains which are returned per file
+	maxMatchedLines = 10
+	// larger files aren't searched for contains
+	maxSearchSize = 4 << 20
+)
+
+type FindFilesParams struct {
+	Path      string `json:"path" jsonschema:"Absolute directory to search below, e.g. /etc/systemd."`
+	Name      string `json:"name,omitempty" jsonschema:"Glob the file names have to match, e.g. *.conf."`
+	Regex     string `json:"regex,omitempty" jsonschema:"Regular expression the paths relative to path have to match, e.g. \\.service\\.d/."`
+	Contains  string `json:"contains,omitempty" jsonschema:"Regular expression a line of the file has to match, e.g. ^MemoryMax=. Directories never match."`
+	Type      string `json:"type,omitempty" jsonschema:"Only files or only directories, one of file or dir."`
+	MaxDepth  int    `json:"max_depth,omitempty" jsonschema:"Number of directory levels below path to search, 1 for the entries of path only. Defaults to no limit."`
+	NewerThan string `json:"newer_than,omitempty" jsonschema:"Only files modified after this time, an RFC 3339 time or an age like 30m, 24h or 7d."`
+	OlderThan string `json:"older_than,omitempty" jsonschema:"Only files modified before this time, an RFC 3339 time or an age like 30m, 24h or 7d."`
+	MinSize   int64  `json:"min_size,omitempty" jsonschema:"Minimal size in bytes."`
+	MaxSize   int64  `json:"max_size,omitempty" jsonschema:"Maximal size in bytes, 0 for no limit."`
+	Limit     int    `json:"limit,omitempty" jsonschema:"Maximal number of files to return. Defaults to 100."`
+}
+
+type MatchedLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+type FoundFile struct {
+	Path    string        `json:"path"`
+	Size    int64         `json:"size"`
+	Mode    string        `json:"mode"`
+	ModTime string        `json:"mod_time"`
+	IsDir   bool          `json:"is_dir"`
+	Lines   []MatchedLine `json:"lines,omitempty"`
+}
+
+type FindFilesResult struct {
+	Path      string      `json:"path"`
+	Files     []FoundFile `json:"files"`
+	Count     int         `json:"count"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+func CreateFindFilesSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[FindFilesParams](nil)
+	inputSchema.Properties["type"].Enum = []any{"file", "dir"}
+	inputSchema.Properties["limit"].Default = json.RawMessage(`100`)
+	inputSchema.Properties["max_depth"].Default = json.RawMessage(`0`)
+	return inputSchema
+}
+
+// parseModTime parses an RFC 3339 time or an age before now like 24h or 7d
+func parseModTime(val string, now time.Time) (time.Time, error) {
+	if val == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(val, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	age, err := time.ParseDuration(val)
+	if err != nil || age < 0 {
+		return time.Time{}, fmt.Errorf("invalid time %q, use an RFC 3339 time or an age like 24h or 7d", val)
+	}
+	return now.Add(-age), nil
+}
+
+// finder holds the compiled filters of a search
+type finder struct {
+	params   *FindFilesParams
+	regex    *regexp.Regexp
+	contains *regexp.Regexp
+	newer    time.Time
+	older    time.Time
+}
+
+func newFinder(params *FindFilesParams) (*finder, error) {
+	f := &finder{params: params}
+	var err error
+	if params.Name != "" {
+		if _, err := filepath.Match(params.Name, ""); err != nil {
+			return nil, fmt.Errorf("invalid name %q: %w", params.Name, err)
+		}
+	}
+	if params.Regex != "" {
+		if f.regex, err = regexp.Compile(params.Regex); err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+	}
+	if params.Contains != "" {
+		if f.contains, err = regexp.Compile(params.Contains); err != nil {
+			return nil, fmt.Errorf("invalid contains: %w", err)
+		}
+	}
+	switch params.Type {
+	case "", "file", "dir":
+	default:
+		return nil, fmt.Errorf("invalid type %q, must be file or dir", params.Type)
+	}
+	now := time.Now()
+	if f.newer, err = parseModTime(params.NewerThan, now); err != nil {
+		return nil, err
+	}
+	if f.older, err = parseModTime(params.OlderThan, now); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// matches checks the entry against the filters besides contains
+func (f *finder) matches(rel string, info fs.FileInfo) bool {
+	switch {
+	case f.params.Type == "file" && info.IsDir(), f.params.Type == "dir" && !info.IsDir():
+		return false
+	case f.contains != nil && !info.Mode().IsRegular():
+		return false
+	}
+	if f.params.Name != "" {
+		if ok, _ := filepath.Match(f.params.Name, filepath.Base(rel)); !ok {
+			return false
+		}
+	}
+	if f.regex != nil && !f.regex.MatchString(rel) {
+		return false
+	}
+	if !f.newer.IsZero() && !info.ModTime().After(f.newer) {
+		return false
+	}
+	if !f.older.IsZero() && !info.ModTime().Before(f.older) {
+		return false
+	}
+	if info.Size() < f.params.MinSize || (f.params.MaxSize > 0 && info.Size() > f.params.MaxSize) {
+		return false
+	}
+	return true
+}
+
+// grep returns the lines of the file matching contains, the file is opened
+// through its root like by get_file
+func (f *finder) grep(path string) ([]MatchedLine, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var lines []MatchedLine
+	scanner := bufio.NewScanner(file)
+	for nr := 1; scanner.Scan(); nr++ {
+		if f.contains.MatchString(scanner.Text()) {
+			lines = append(lines, MatchedLine{Line: nr, Text: scanner.Text()})
+			if len(lines) == maxMatchedLines {
+				break
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, bufio.ErrTooLong) {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// FindFiles searches the directory tree below a path for files by name, path,
+// content, type, modification time and size. Only the files which can be read
+// with get_file are searched, symlinks are followed if they lead to a file
+// below the roots.
+func FindFiles(ctx context.Context, req *mcp.CallToolRequest, params *FindFilesParams) (*mcp.CallToolResult, any, error) {
+	if Auth != nil {
+		if allowed, err := Auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.FilesReadAction)); err != nil {
+			return nil, nil, err
+		} else if !allowed {
+			return nil, nil, fmt.Errorf("calling method was canceled by user")
+		}
+	}
+	if !filepath.IsAbs(params.Path) {
+		return nil, nil, fmt.Errorf("%s isn't an absolute path", params.Path)
+	}
+	f, err := newFinder(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultFindLimit
+	}
+
+	res := FindFilesResult{Path: params.Path, Files: []FoundFile{}}
+	err = walk(ctx, params.Path, params.MaxDepth, func(path, rel, resolved string, info fs.FileInfo) error {
+		if !f.matches(rel, info) {
+			return nil
+		}
+		found := FoundFile{
+			Path:    path,
+			Size:    info.Size(),
+			Mode:    info.Mode().String(),
+			ModTime: info.ModTime().Format(time.RFC3339),
+			IsDir:   info.IsDir(),
+		}
+		if f.contains != nil {
+			if info.Size() > maxSearchSize {
+				return nil
+			}
+			var err error
+			if found.Lines, err = f.grep(resolved); err != nil || len(found.Lines) == 0 {
+				return nil
+			}
+		}
+		if len(res.Files) == limit {
+			res.Truncated = true
+			return fs.SkipAll
+		}
+		res.Files = append(res.Files, found)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to search %s: %w", params.Path, err)
+	}
+	res.Count = len(res.Files)
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
+
+// walk calls fn for the entries below the path which can be read, with their
+// path below the path asked for, which may be a symlink, the path relative to
+// it, the path with the symlinks resolved and the information of the file a
+// symlink points to. The directories which can't be read, e.g. of units out
+// of scope, are skipped, as are the directories deeper than maxDepth unless
+// it is 0.
+func walk(ctx context.Context, path string, maxDepth int, fn func(path, rel, resolved string, info fs.FileInfo) error) error {
+	base, err := checkAccess(path)
+	if err != nil {
+		return err
+	}
+	// the walk doesn't follow a symlink as path
+	if resolved, err := filepath.EvalSymlinks(base); err == nil {
+		base = resolved
+	}
+	return filepath.WalkDir(base, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if current == base {
+				return err
+			}
+			// unreadable directories are skipped
+			if entry != nil && entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if current == base {
+			return nil
+		}
+		rel, _ := filepath.Rel(base, current)
+		resolved, err := checkAccess(current)
+		if err != nil {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		// the file a symlink points to, files aren't opened as they may
+		// be fifos
+		info, err := os.Stat(resolved)
+		if err != nil {
+			return nil
+		}
+		if err := fn(filepath.Join(path, rel), rel, resolved, info); err != nil {
+			return err
+		}
+		if entry.IsDir() && maxDepth > 0 && strings.Count(rel, string(filepath.Separator))+1 >= maxDepth {
+			return fs.SkipDir
+		}
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "systemd")
+	files := map[string]string{
+		"system/nginx.service":                    "[Service]\nExecStart=/usr/sbin/nginx\n",
+		"system/nginx.service.d/memory.conf":      "[Service]\nMemoryMax=1G\n",
+		"system/sshd.service.d/memory.conf":       "[Service]\nMemoryMax=512M\n",
+		"system/backup.service.d/override.conf":   "[Service]\nNice=10\n",
+		"system/multi-user.target.wants/.keep":    "",
+		"system/multi-user.target.wants/big.conf": string(make([]byte, 2048)),
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "system/backup.service.d/override.conf"), old, old))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "outside.conf"), []byte("MemoryMax=1\n"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(tmpDir, "outside.conf"), filepath.Join(root, "system/escape.conf")))
+	Roots = []string{root}
+	defer func() { Roots = nil }()
+
+	find := func(params *FindFilesParams) []string {
+		t.Helper()
+		_, out, err := FindFiles(context.Background(), nil, params)
+		require.NoError(t, err)
+		var paths []string
+		for _, f := range out.(FindFilesResult).Files {
+			rel, _ := filepath.Rel(params.Path, f.Path)
+			paths = append(paths, rel)
+		}
+		return paths
+	}
+
+	assert.ElementsMatch(t, []string{"system/nginx.service.d/memory.conf", "system/sshd.service.d/memory.conf"},
+		find(&FindFilesParams{Path: root, Contains: "^MemoryMax="}))
+	assert.ElementsMatch(t, []string{"system/nginx.service.d", "system/sshd.service.d", "system/backup.service.d"},
+		find(&FindFilesParams{Path: root, Name: "*.service.d", Type: "dir"}))
+	assert.ElementsMatch(t, []string{"system"}, find(&FindFilesParams{Path: root, MaxDepth: 1}))
+	assert.ElementsMatch(t, []string{"system/backup.service.d/override.conf"},
+		find(&FindFilesParams{Path: root, Regex: `\.service\.d/`, OlderThan: "1d"}))
+	assert.ElementsMatch(t, []string{"system/nginx.service.d/memory.conf", "system/sshd.service.d/memory.conf", "system/multi-user.target.wants/big.conf"},
+		find(&FindFilesParams{Path: root, Name: "*.conf", NewerThan: "24h"}))
+	assert.ElementsMatch(t, []string{"system/multi-user.target.wants/big.conf"}, find(&FindFilesParams{Path: root, Type: "file", MinSize: 1024}))
+	assert.Len(t, find(&FindFilesParams{Path: root, Type: "file", Limit: 2}), 2)
+
+	// the files of units out of scope are left out
+	units, err := policy.NewUnitAccess([]string{"nginx*.service"}, nil)
+	require.NoError(t, err)
+	Units = units
+	defer func() { Units = nil }()
+	assert.ElementsMatch(t, []string{"system/nginx.service.d/memory.conf"}, find(&FindFilesParams{Path: root, Name: "memory.conf"}))
+
+	_, _, err = FindFiles(context.Background(), nil, &FindFilesParams{Path: tmpDir})
+	assert.ErrorContains(t, err, "outside of the directories")
+	_, _, err = FindFiles(context.Background(), nil, &FindFilesParams{Path: root, Regex: "("})
+	assert.ErrorContains(t, err, "invalid regex")
+	_, _, err = FindFiles(context.Background(), nil, &FindFilesParams{Path: root, NewerThan: "yesterday"})
+	assert.ErrorContains(t, err, "invalid time")
+}
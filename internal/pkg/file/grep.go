@@ -0,0 +1,242 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+const (
+	defaultGrepContext = 2
+	maxGrepContext     = 10
+	defaultGrepMatches = 100
+	maxGrepMatches     = 1000
+	// bytes of the files read by a search
+	defaultGrepBytes = 16 << 20
+	maxGrepBytes     = 256 << 20
+)
+
+type GrepFilesParams struct {
+	Pattern    string `json:"pattern" jsonschema:"Regular expression matched against each line, e.g. MemoryMax=."`
+	Path       string `json:"path,omitempty" jsonschema:"Absolute file or directory to search. Defaults to all directories files can be read from."`
+	Name       string `json:"name,omitempty" jsonschema:"Glob the file names have to match, e.g. *.conf."`
+	IgnoreCase bool   `json:"ignore_case,omitempty" jsonschema:"Match the pattern case insensitive."`
+	Context    *int   `json:"context,omitempty" jsonschema:"Lines before and after each match to return, at most 10. Defaults to 2."`
+	MaxMatches int    `json:"max_matches,omitempty" jsonschema:"Maximal number of matches to return. Defaults to 100."`
+	MaxBytes   int64  `json:"max_bytes,omitempty" jsonschema:"Maximal number of bytes to read from the files. Defaults to 16 MiB."`
+}
+
+type GrepMatch struct {
+	Path   string   `json:"path"`
+	Line   int      `json:"line"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+type GrepFilesResult struct {
+	Matches      []GrepMatch `json:"matches"`
+	Count        int         `json:"count"`
+	FilesScanned int         `json:"files_scanned"`
+	BytesScanned int64       `json:"bytes_scanned"`
+	// the search stopped at max_matches or max_bytes
+	Truncated string `json:"truncated,omitempty"`
+}
+
+func CreateGrepFilesSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[GrepFilesParams](nil)
+	inputSchema.Properties["ignore_case"].Default = json.RawMessage(`false`)
+	inputSchema.Properties["context"].Default = json.RawMessage(`2`)
+	inputSchema.Properties["max_matches"].Default = json.RawMessage(`100`)
+	inputSchema.Properties["max_bytes"].Default = json.RawMessage(`16777216`)
+	return inputSchema
+}
+
+// errLimit stops the search at a limit
+var errLimit = errors.New("limit reached")
+
+// grepper searches the files and collects the matches
+type grepper struct {
+	re         *regexp.Regexp
+	name       string
+	context    int
+	maxMatches int
+	bytesLeft  int64
+	res        GrepFilesResult
+}
+
+// search adds the matches of a file, the file is opened through its root
+// like by get_file
+func (g *grepper) search(path, resolved string) error {
+	if g.bytesLeft <= 0 {
+		g.res.Truncated = "max_bytes"
+		return errLimit
+	}
+	f, err := openFile(resolved)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	// one more byte tells if the file is cut
+	data, err := io.ReadAll(io.LimitReader(f, g.bytesLeft+1))
+	if err != nil {
+		return nil
+	}
+	cut := int64(len(data)) > g.bytesLeft
+	if cut {
+		data = data[:g.bytesLeft]
+	}
+	g.bytesLeft -= int64(len(data))
+	g.res.BytesScanned += int64(len(data))
+	g.res.FilesScanned++
+	// binary files are skipped
+	if isBinary(data) {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for i, line := range lines {
+		if !g.re.MatchString(line) {
+			continue
+		}
+		if len(g.res.Matches) == g.maxMatches {
+			g.res.Truncated = "max_matches"
+			return errLimit
+		}
+		g.res.Matches = append(g.res.Matches, GrepMatch{
+			Path:   path,
+			Line:   i + 1,
+			Text:   line,
+			Before: lines[max(0, i-g.context):i],
+			After:  lines[i+1 : min(len(lines), i+1+g.context)],
+		})
+	}
+	if cut {
+		g.res.Truncated = "max_bytes"
+		return errLimit
+	}
+	return nil
+}
+
+// GrepFiles searches the lines of the files below a path or the roots for a
+// regular expression and returns the matches with the lines around them.
+// The number of matches and the bytes read are limited.
+func GrepFiles(ctx context.Context, req *mcp.CallToolRequest, params *GrepFilesParams) (*mcp.CallToolResult, any, error) {
+	if Auth != nil {
+		if allowed, err := Auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.FilesReadAction)); err != nil {
+			return nil, nil, err
+		} else if !allowed {
+			return nil, nil, fmt.Errorf("calling method was canceled by user")
+		}
+	}
+	pattern := params.Pattern
+	if pattern == "" {
+		return nil, nil, fmt.Errorf("pattern is required")
+	}
+	if params.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	if params.Name != "" {
+		if _, err := filepath.Match(params.Name, ""); err != nil {
+			return nil, nil, fmt.Errorf("invalid name %q: %w", params.Name, err)
+		}
+	}
+	paths := Roots
+	if params.Path != "" {
+		if !filepath.IsAbs(params.Path) {
+			return nil, nil, fmt.Errorf("%s isn't an absolute path", params.Path)
+		}
+		paths = []string{params.Path}
+	} else if Roots == nil {
+		return nil, nil, fmt.Errorf("path is required as files can be read from all directories")
+	}
+	g := &grepper{
+		re:         re,
+		name:       params.Name,
+		context:    defaultGrepContext,
+		maxMatches: defaultGrepMatches,
+		bytesLeft:  defaultGrepBytes,
+		res:        GrepFilesResult{Matches: []GrepMatch{}},
+	}
+	if params.Context != nil {
+		g.context = min(max(*params.Context, 0), maxGrepContext)
+	}
+	if params.MaxMatches > 0 {
+		g.maxMatches = min(params.MaxMatches, maxGrepMatches)
+	}
+	if params.MaxBytes > 0 {
+		g.bytesLeft = min(params.MaxBytes, maxGrepBytes)
+	}
+
+	err = func() error {
+		for _, path := range paths {
+			if err := g.searchPath(ctx, path, params.Path == ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil && !errors.Is(err, errLimit) {
+		return nil, nil, fmt.Errorf("failed to search: %w", err)
+	}
+	g.res.Count = len(g.res.Matches)
+
+	jsonBytes, err := json.Marshal(g.res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, g.res, nil
+}
+
+// searchPath searches a file or the files below a directory, missing roots
+// are skipped
+func (g *grepper) searchPath(ctx context.Context, path string, isRoot bool) error {
+	resolved, err := checkAccess(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		if isRoot && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if !info.IsDir() {
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s isn't a regular file", path)
+		}
+		return g.search(path, resolved)
+	}
+	return walk(ctx, path, 0, func(path, rel, resolved string, info fs.FileInfo) error {
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if g.name != "" {
+			if ok, _ := filepath.Match(g.name, filepath.Base(rel)); !ok {
+				return nil
+			}
+		}
+		return g.search(path, resolved)
+	})
+}
@@ -0,0 +1,71 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrepFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	etc := filepath.Join(tmpDir, "etc")
+	logs := filepath.Join(tmpDir, "log")
+	files := map[string]string{
+		filepath.Join(etc, "nginx.service.d/memory.conf"): "[Service]\nMemoryMax=1G\nNice=5\n",
+		filepath.Join(etc, "sshd.service.d/memory.conf"):  "[Service]\n# memorymax is set by the admin\nmemorymax=2G\n",
+		filepath.Join(etc, "binary.conf"):                 "MemoryMax=\x00\n",
+		filepath.Join(logs, "app.log"):                    "start\nMemoryMax exceeded\nstop\n",
+	}
+	for path, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "outside.conf"), []byte("MemoryMax=3G\n"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(tmpDir, "outside.conf"), filepath.Join(etc, "escape.conf")))
+	Roots = []string{etc, logs, filepath.Join(tmpDir, "missing")}
+	defer func() { Roots = nil }()
+
+	grep := func(params *GrepFilesParams) GrepFilesResult {
+		t.Helper()
+		_, out, err := GrepFiles(context.Background(), nil, params)
+		require.NoError(t, err)
+		return out.(GrepFilesResult)
+	}
+
+	// all roots, missing ones are skipped
+	res := grep(&GrepFilesParams{Pattern: "^MemoryMax="})
+	require.Equal(t, 1, res.Count)
+	assert.Equal(t, GrepMatch{
+		Path:   filepath.Join(etc, "nginx.service.d/memory.conf"),
+		Line:   2,
+		Text:   "MemoryMax=1G",
+		Before: []string{"[Service]"},
+		After:  []string{"Nice=5"},
+	}, res.Matches[0])
+	assert.Empty(t, res.Truncated)
+
+	res = grep(&GrepFilesParams{Pattern: "memorymax", IgnoreCase: true, Name: "*.conf"})
+	assert.Equal(t, 3, res.Count)
+	zero := 0
+	res = grep(&GrepFilesParams{Pattern: "MemoryMax", Path: filepath.Join(logs, "app.log"), Context: &zero})
+	require.Equal(t, 1, res.Count)
+	assert.Empty(t, res.Matches[0].Before)
+
+	res = grep(&GrepFilesParams{Pattern: "(?i)memorymax", MaxMatches: 2})
+	assert.Equal(t, 2, res.Count)
+	assert.Equal(t, "max_matches", res.Truncated)
+	res = grep(&GrepFilesParams{Pattern: "MemoryMax", Path: etc, MaxBytes: 10})
+	assert.Equal(t, int64(10), res.BytesScanned)
+	assert.Equal(t, "max_bytes", res.Truncated)
+
+	_, _, err := GrepFiles(context.Background(), nil, &GrepFilesParams{Pattern: "x", Path: tmpDir})
+	assert.ErrorContains(t, err, "outside of the directories")
+	_, _, err = GrepFiles(context.Background(), nil, &GrepFilesParams{Pattern: "("})
+	assert.ErrorContains(t, err, "invalid pattern")
+	_, _, err = GrepFiles(context.Background(), nil, &GrepFilesParams{})
+	assert.ErrorContains(t, err, "pattern is required")
+}
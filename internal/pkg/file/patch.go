@@ -0,0 +1,161 @@
+package file
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// hunk is a change of a unified diff
+type hunk struct {
+	// line of the old content the hunk starts at, 1 based
+	start int
+	old   []string
+	new   []string
+	// the old or the new content has no newline at the end
+	oldNoEOL bool
+	newNoEOL bool
+}
+
+// parsePatch parses the hunks of a unified diff, the file headers are
+// skipped
+func parsePatch(patch string) ([]hunk, error) {
+	var hunks []hunk
+	var cur *hunk
+	// remaining lines of the old and the new side of the current hunk
+	var oldLeft, newLeft int
+	lines := strings.Split(strings.TrimSuffix(patch, "\n"), "\n")
+	for nr, line := range lines {
+		if m := hunkHeader.FindStringSubmatch(line); m != nil {
+			if cur != nil && (oldLeft > 0 || newLeft > 0) {
+				return nil, fmt.Errorf("patch line %d: hunk ends early", nr+1)
+			}
+			hunks = append(hunks, hunk{})
+			cur = &hunks[len(hunks)-1]
+			cur.start, _ = strconv.Atoi(m[1])
+			oldLeft, newLeft = hunkCount(m[2]), hunkCount(m[4])
+			continue
+		}
+		if cur == nil || (oldLeft == 0 && newLeft == 0 && !strings.HasPrefix(line, "\\")) {
+			// headers like --- and +++ or text between the files
+			cur = nil
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "\\"):
+			// "\ No newline at end of file" refers to the line before
+			prev := lines[nr-1]
+			if strings.HasPrefix(prev, "-") || strings.HasPrefix(prev, " ") || prev == "" {
+				cur.oldNoEOL = true
+			}
+			if strings.HasPrefix(prev, "+") || strings.HasPrefix(prev, " ") || prev == "" {
+				cur.newNoEOL = true
+			}
+		case strings.HasPrefix(line, "-"):
+			cur.old = append(cur.old, line[1:])
+			oldLeft--
+		case strings.HasPrefix(line, "+"):
+			cur.new = append(cur.new, line[1:])
+			newLeft--
+		case strings.HasPrefix(line, " "), line == "":
+			// some editors strip the space of empty context lines
+			text := strings.TrimPrefix(line, " ")
+			cur.old = append(cur.old, text)
+			cur.new = append(cur.new, text)
+			oldLeft--
+			newLeft--
+		default:
+			return nil, fmt.Errorf("patch line %d: unexpected %q", nr+1, line)
+		}
+		if oldLeft < 0 || newLeft < 0 {
+			return nil, fmt.Errorf("patch line %d: hunk is longer than its header", nr+1)
+		}
+	}
+	if cur != nil && (oldLeft > 0 || newLeft > 0) {
+		return nil, fmt.Errorf("patch ends within a hunk")
+	}
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("patch has no hunks")
+	}
+	return hunks, nil
+}
+
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// applyPatch applies a unified diff to the content. A hunk whose lines moved
+// is applied where its old lines are found, closest to the line of its
+// header.
+func applyPatch(content, patch string) (string, error) {
+	hunks, err := parsePatch(patch)
+	if err != nil {
+		return "", err
+	}
+	eol := content == "" || strings.HasSuffix(content, "\n")
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+	var out []string
+	// lines of the content before next are applied
+	next := 0
+	for i, h := range hunks {
+		at, ok := findHunk(lines, h, next)
+		if !ok {
+			return "", fmt.Errorf("hunk %d at line %d doesn't match the file", i+1, h.start)
+		}
+		out = append(out, lines[next:at]...)
+		out = append(out, h.new...)
+		next = at + len(h.old)
+		if next == len(lines) {
+			eol = !h.newNoEOL
+		}
+	}
+	out = append(out, lines[next:]...)
+	if len(out) == 0 {
+		return "", nil
+	}
+	result := strings.Join(out, "\n")
+	if eol {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// findHunk returns the index of the lines at which the old lines of the
+// hunk start, not before from
+func findHunk(lines []string, h hunk, from int) (int, bool) {
+	want := h.start - 1
+	if len(h.old) == 0 {
+		// a hunk which only adds lines starts after the line of its header
+		want = h.start
+	}
+	matches := func(at int) bool {
+		if at < from || at+len(h.old) > len(lines) {
+			return false
+		}
+		for i, line := range h.old {
+			if lines[at+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+	for offset := 0; offset <= len(lines); offset++ {
+		if matches(want - offset) {
+			return want - offset, true
+		}
+		if matches(want + offset) {
+			return want + offset, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,305 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+// layout of the timestamp of the backups, e.g.
+// nginx.conf.20261015T143000.123456789.bak, with the nanoseconds two writes
+// within a second don't overwrite the first backup
+const backupLayout = "20060102T150405.000000000"
+
+// MaxBackups is the number of backups put_file keeps of a file, the oldest
+// ones are removed. Zero keeps all of them.
+var MaxBackups = 5
+
+type PutFileParams struct {
+	Path    string `json:"path" jsonschema:"Absolute path of the file to create or update."`
+	Content string `json:"content,omitempty" jsonschema:"New content of the file. Not allowed together with patch."`
+	Patch   string `json:"patch,omitempty" jsonschema:"Unified diff, e.g. from diff -u, which is applied to the current content of the file."`
+	Empty   bool   `json:"empty,omitempty" jsonschema:"Write an empty file, instead of content or patch."`
+	Mode    string `json:"mode,omitempty" jsonschema:"Octal permissions of a new file, e.g. 0640. Existing files keep their permissions and owner."`
+}
+
+type PutFileResult struct {
+	Path     string        `json:"path"`
+	Created  bool          `json:"created"`
+	Changed  bool          `json:"changed"`
+	Backup   string        `json:"backup,omitempty"`
+	Metadata *FileMetadata `json:"metadata,omitempty"`
+}
+
+func CreatePutFileSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[PutFileParams](nil)
+	inputSchema.Properties["mode"].Default = json.RawMessage(`"0644"`)
+	return inputSchema
+}
+
+// parseMode parses the octal permissions of a new file, setuid, setgid and
+// sticky bits are refused
+func parseMode(mode string) (fs.FileMode, error) {
+	if mode == "" {
+		return 0644, nil
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0777 {
+		return 0, fmt.Errorf("invalid mode %q, use octal permissions like 0644", mode)
+	}
+	return fs.FileMode(perm), nil
+}
+
+// checkWrite checks the file and returns the path it is written to. The
+// symlinks of an existing file are resolved like for reading, a new file is
+// created in the resolved parent directory.
+func checkWrite(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("%s isn't an absolute path", path)
+	}
+	if _, err := checkAccess(path); err != nil {
+		return "", err
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil {
+			return "", fmt.Errorf("failed to find the directory of the file: %w", err)
+		}
+		target = filepath.Join(dir, filepath.Base(path))
+		if target != path {
+			if _, err := checkAccess(target); err != nil {
+				return "", fmt.Errorf("%s points to %s: %w", path, target, err)
+			}
+		}
+	}
+	if WriteRoots == nil {
+		return target, nil
+	}
+	// the path may be given below a root or the directory it points to
+	roots := resolveRoots(WriteRoots)
+	if _, _, ok := rootOf(path, append(roots, WriteRoots...)); !ok {
+		return "", fmt.Errorf("%s is outside of the directories files can be written to: %s", filepath.Clean(path), strings.Join(WriteRoots, ", "))
+	}
+	if _, _, ok := rootOf(target, roots); !ok {
+		return "", fmt.Errorf("%s points to %s, which is outside of the directories files can be written to: %s", path, target, strings.Join(WriteRoots, ", "))
+	}
+	return target, nil
+}
+
+// writeRoots are the roots a checked path is written below
+func writeRoots() []string {
+	if WriteRoots != nil {
+		return WriteRoots
+	}
+	return Roots
+}
+
+// openRoot opens the root the checked path is below and returns the path
+// relative to it, without roots the directory of the path is the root
+func openRoot(path string, configured []string) (*os.Root, string, error) {
+	root, rel := filepath.Dir(path), filepath.Base(path)
+	if configured != nil {
+		var ok bool
+		if root, rel, ok = rootOf(path, resolveRoots(configured)); !ok {
+			return nil, "", fmt.Errorf("%s is outside of the directories: %s", path, strings.Join(configured, ", "))
+		}
+	}
+	r, err := os.OpenRoot(root)
+	return r, rel, err
+}
+
+// writeFile writes the content to a temporary file next to the file, which
+// then replaces it, so that readers see either the old or the new content
+func writeFile(r *os.Root, rel string, content []byte, perm fs.FileMode, uid, gid int) error {
+	tmp := filepath.Join(filepath.Dir(rel), fmt.Sprintf(".%s.%d.tmp", filepath.Base(rel), time.Now().UnixNano()))
+	f, err := r.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		if _, err := f.Write(content); err != nil {
+			return err
+		}
+		// the permissions of the file aren't restricted by the umask
+		if err := f.Chmod(perm); err != nil {
+			return err
+		}
+		if uid >= 0 {
+			if err := f.Chown(uid, gid); err != nil {
+				return fmt.Errorf("failed to keep the owner: %w", err)
+			}
+		}
+		return f.Sync()
+	}()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = r.Rename(tmp, rel)
+	}
+	if err != nil {
+		r.Remove(tmp)
+	}
+	return err
+}
+
+// pruneBackups removes the oldest backups of the file so that MaxBackups of
+// them are left
+func pruneBackups(r *os.Root, rel string) error {
+	if MaxBackups <= 0 {
+		return nil
+	}
+	dir, err := r.Open(filepath.Dir(rel))
+	if err != nil {
+		return err
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, name := range names {
+		stamp, ok := strings.CutPrefix(name, filepath.Base(rel)+".")
+		if !ok {
+			continue
+		}
+		if stamp, ok = strings.CutSuffix(stamp, ".bak"); !ok {
+			continue
+		}
+		// parsing accepts the fraction of seconds but doesn't need it
+		if _, err := time.Parse("20060102T150405", stamp); err == nil {
+			backups = append(backups, name)
+		}
+	}
+	if len(backups) <= MaxBackups {
+		return nil
+	}
+	// the timestamps sort by time
+	slices.Sort(backups)
+	for _, name := range backups[:len(backups)-MaxBackups] {
+		if err := r.Remove(filepath.Join(filepath.Dir(rel), name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutFile creates or updates a file below the roots. The content is given in
+// full or as unified diff against the current content. An existing file is
+// copied to a backup with a timestamp first and keeps its owner and
+// permissions, of the backups MaxBackups are kept.
+func PutFile(ctx context.Context, req *mcp.CallToolRequest, params *PutFileParams) (*mcp.CallToolResult, any, error) {
+	// a missing content must not empty the file
+	given := 0
+	for _, set := range []bool{params.Content != "", params.Patch != "", params.Empty} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		return nil, nil, fmt.Errorf("exactly one of content, patch or empty has to be given")
+	}
+	perm, err := parseMode(params.Mode)
+	if err != nil {
+		return nil, nil, err
+	}
+	// authorized before the path is checked, so that its errors don't tell
+	// unauthorized callers which files exist
+	if Auth != nil {
+		if allowed, err := Auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.FilesWriteAction)); err != nil {
+			return nil, nil, err
+		} else if !allowed {
+			return nil, nil, fmt.Errorf("calling method was canceled by user")
+		}
+		defer Auth.Deauthorize()
+	}
+	path, err := checkWrite(params.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, rel, err := openRoot(path, writeRoots())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	res := PutFileResult{Path: path}
+	uid, gid := -1, -1
+	current, err := r.ReadFile(rel)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if params.Patch != "" {
+			return nil, nil, fmt.Errorf("%s doesn't exist, a patch can't be applied", path)
+		}
+		res.Created = true
+	case err != nil:
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	default:
+		info, err := r.Stat(rel)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to stat file: %w", err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, nil, fmt.Errorf("%s isn't a regular file", path)
+		}
+		perm = info.Mode().Perm()
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid, gid = int(stat.Uid), int(stat.Gid)
+		}
+	}
+
+	content := params.Content
+	if params.Patch != "" {
+		if content, err = applyPatch(string(current), params.Patch); err != nil {
+			return nil, nil, fmt.Errorf("failed to apply patch to %s: %w", path, err)
+		}
+	}
+	res.Changed = res.Created || content != string(current)
+	if res.Changed {
+		if !res.Created {
+			backup := rel + "." + time.Now().Format(backupLayout) + ".bak"
+			if err := writeFile(r, backup, current, perm, uid, gid); err != nil {
+				return nil, nil, fmt.Errorf("failed to back up %s: %w", path, err)
+			}
+			res.Backup = filepath.Join(filepath.Dir(path), filepath.Base(backup))
+			if err := pruneBackups(r, rel); err != nil {
+				slog.Warn("failed to remove old backups", "path", path, "error", err)
+			}
+		}
+		if err := writeFile(r, rel, []byte(content), perm, uid, gid); err != nil {
+			return nil, nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		slog.Info("wrote file", "path", path, "created", res.Created, "backup", res.Backup)
+	}
+	if info, err := r.Stat(rel); err == nil {
+		res.Metadata = getFileMetadata(ctx, path, info, false)
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
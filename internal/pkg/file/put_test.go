@@ -0,0 +1,196 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyPatch(t *testing.T) {
+	content := "a\nb\nc\nd\ne\n"
+	tests := []struct {
+		name, patch, want string
+	}{
+		{
+			name:  "replace",
+			patch: "--- a/file\n+++ b/file\n@@ -2,3 +2,3 @@\n b\n-c\n+C\n d\n",
+			want:  "a\nb\nC\nd\ne\n",
+		},
+		{
+			name:  "moved lines",
+			patch: "@@ -1,2 +1,3 @@\n d\n+x\n e\n",
+			want:  "a\nb\nc\nd\nx\ne\n",
+		},
+		{
+			name:  "two hunks",
+			patch: "@@ -1,1 +1,1 @@\n-a\n+A\n@@ -5 +5 @@\n-e\n+E\n",
+			want:  "A\nb\nc\nd\nE\n",
+		},
+		{
+			name:  "append",
+			patch: "@@ -5,0 +6,1 @@\n+f\n",
+			want:  "a\nb\nc\nd\ne\nf\n",
+		},
+		{
+			name:  "no newline at the end",
+			patch: "@@ -5 +5 @@\n-e\n+E\n\\ No newline at end of file\n",
+			want:  "a\nb\nc\nd\nE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyPatch(content, tt.patch)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := applyPatch(content, "@@ -2 +2 @@\n-x\n+y\n")
+	assert.ErrorContains(t, err, "doesn't match")
+	_, err = applyPatch(content, "no hunks here\n")
+	assert.ErrorContains(t, err, "no hunks")
+	_, err = applyPatch(content, "@@ -1,2 +1,2 @@\n-a\n+A\n")
+	assert.ErrorContains(t, err, "ends within a hunk")
+}
+
+func TestPutFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "root")
+	require.NoError(t, os.Mkdir(root, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "outside.conf"), []byte("outside\n"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(tmpDir, "outside.conf"), filepath.Join(root, "escape.conf")))
+	Roots = []string{root}
+	defer func() { Roots = nil }()
+	put := func(params *PutFileParams) (*PutFileResult, error) {
+		_, out, err := PutFile(context.Background(), nil, params)
+		if err != nil {
+			return nil, err
+		}
+		res := out.(PutFileResult)
+		return &res, nil
+	}
+	path := filepath.Join(root, "app.conf")
+
+	res, err := put(&PutFileParams{Path: path, Content: "port=80\n", Mode: "0600"})
+	require.NoError(t, err)
+	assert.True(t, res.Created)
+	assert.Empty(t, res.Backup)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	res, err = put(&PutFileParams{Path: path, Patch: "@@ -1 +1 @@\n-port=80\n+port=8080\n"})
+	require.NoError(t, err)
+	assert.False(t, res.Created)
+	assert.True(t, res.Changed)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "port=8080\n", string(data))
+	// the backup has the old content and the file keeps its permissions
+	require.NotEmpty(t, res.Backup)
+	data, err = os.ReadFile(res.Backup)
+	require.NoError(t, err)
+	assert.Equal(t, "port=80\n", string(data))
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	res, err = put(&PutFileParams{Path: path, Content: "port=8080\n"})
+	require.NoError(t, err)
+	assert.False(t, res.Changed)
+	assert.Empty(t, res.Backup)
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "no temporary files are left")
+
+	_, err = put(&PutFileParams{Path: filepath.Join(tmpDir, "new.conf"), Content: "x\n"})
+	assert.ErrorContains(t, err, "outside of the directories")
+	_, err = put(&PutFileParams{Path: filepath.Join(root, "escape.conf"), Content: "x\n"})
+	assert.ErrorContains(t, err, "outside of the directories")
+	_, err = put(&PutFileParams{Path: filepath.Join(root, "missing.conf"), Patch: "@@ -1 +1 @@\n-a\n+b\n"})
+	assert.ErrorContains(t, err, "doesn't exist")
+	_, err = put(&PutFileParams{Path: path, Content: "x\n", Patch: "@@ -1 +1 @@\n-a\n+b\n"})
+	assert.Error(t, err)
+	_, err = put(&PutFileParams{Path: path})
+	assert.ErrorContains(t, err, "exactly one of")
+	_, err = put(&PutFileParams{Path: path, Content: "x\n", Empty: true})
+	assert.ErrorContains(t, err, "exactly one of")
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "port=8080\n", string(data), "a call without content doesn't empty the file")
+	_, err = put(&PutFileParams{Path: filepath.Join(root, "suid.conf"), Content: "x\n", Mode: "4755"})
+	assert.ErrorContains(t, err, "invalid mode")
+	data, err = os.ReadFile(filepath.Join(tmpDir, "outside.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "outside\n", string(data))
+
+	res, err = put(&PutFileParams{Path: path, Empty: true})
+	require.NoError(t, err)
+	assert.True(t, res.Changed)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+func TestPutFileBackups(t *testing.T) {
+	root := t.TempDir()
+	Roots = []string{root}
+	defer func() { Roots = nil }()
+	MaxBackups = 2
+	defer func() { MaxBackups = 5 }()
+	path := filepath.Join(root, "app.conf")
+	require.NoError(t, os.WriteFile(path, []byte("0\n"), 0644))
+	// a backup without fraction of seconds and a file which isn't a backup
+	require.NoError(t, os.WriteFile(path+".20200101T000000.bak", []byte("old\n"), 0644))
+	require.NoError(t, os.WriteFile(path+".orig", []byte("orig\n"), 0644))
+
+	var backups []string
+	for i := 1; i <= 3; i++ {
+		_, out, err := PutFile(context.Background(), nil, &PutFileParams{Path: path, Content: fmt.Sprintf("%d\n", i)})
+		require.NoError(t, err)
+		backups = append(backups, out.(PutFileResult).Backup)
+	}
+	// writes within the same second get backups of their own
+	assert.Len(t, slices.Compact(slices.Clone(backups)), 3)
+
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"app.conf", "app.conf.orig", filepath.Base(backups[1]), filepath.Base(backups[2])}, names)
+	data, err := os.ReadFile(backups[2])
+	require.NoError(t, err)
+	assert.Equal(t, "2\n", string(data))
+}
+
+func TestPutFileWriteRoots(t *testing.T) {
+	root := t.TempDir()
+	etc, logs := filepath.Join(root, "etc"), filepath.Join(root, "log")
+	require.NoError(t, os.Mkdir(etc, 0755))
+	require.NoError(t, os.Mkdir(logs, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(logs, "app.log"), []byte("log\n"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(logs, "app.log"), filepath.Join(etc, "app.log")))
+	Roots = []string{root}
+	WriteRoots = []string{etc}
+	defer func() { Roots, WriteRoots = nil, nil }()
+	put := func(path string) error {
+		_, _, err := PutFile(context.Background(), nil, &PutFileParams{Path: path, Content: "x\n"})
+		return err
+	}
+
+	require.NoError(t, put(filepath.Join(etc, "app.conf")))
+	// readable, but not writable
+	assert.ErrorContains(t, put(filepath.Join(logs, "app.log")), "can be written to")
+	assert.ErrorContains(t, put(filepath.Join(etc, "app.log")), "can be written to")
+	data, err := os.ReadFile(filepath.Join(logs, "app.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "log\n", string(data))
+}
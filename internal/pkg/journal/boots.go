@@ -0,0 +1,345 @@
+package journal
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// message ids of the catalog entries pid1 logs during boot, see
+// systemd/sd-messages.h
+const (
+	msgStartupFinished = "b07a249cd024414a82dd00cd181378ff"
+	msgUnitStarting    = "7d4958e842da4a758f6c1cdc7b36dcc5"
+	msgUnitStarted     = "39f53479d3a045ac8e11786248231fbf"
+	msgUnitFailed      = "be02cf6855d2428ba40df7e9d022f03d"
+)
+
+type CompareBootsParams struct {
+	Boots     int     `json:"boots,omitempty" jsonschema:"Number of most recent boots to compare, including the current one."`
+	Top       int     `json:"top,omitempty" jsonschema:"Number of slowest units to report per boot."`
+	Threshold float64 `json:"threshold,omitempty" jsonschema:"Increase in percent against the average of the older boots which is reported as regression."`
+}
+
+const (
+	DefaultCompareBoots = 5
+	MaxCompareBoots     = 20
+	DefaultTopUnits     = 10
+	DefaultThreshold    = 20.0
+	// changes of units below this are just noise
+	minUnitRegression = 500 * time.Millisecond
+)
+
+type UnitStartup struct {
+	Unit     string `json:"unit"`
+	Duration int64  `json:"duration_ms"`
+}
+
+type BootSummary struct {
+	BootID      string        `json:"bootid"`
+	Start       time.Time     `json:"start"`
+	Kernel      int64         `json:"kernel_ms,omitempty"`
+	Initrd      int64         `json:"initrd_ms,omitempty"`
+	Userspace   int64         `json:"userspace_ms,omitempty"`
+	Total       int64         `json:"total_ms,omitempty"`
+	FailedUnits []string      `json:"failed_units,omitempty"`
+	Slowest     []UnitStartup `json:"slowest_units,omitempty"`
+	// all unit startup times, only used for the comparison
+	units map[string]time.Duration
+}
+
+type Regression struct {
+	Kind     string  `json:"kind"`
+	Unit     string  `json:"unit,omitempty"`
+	Current  int64   `json:"current_ms,omitempty"`
+	Average  int64   `json:"average_ms,omitempty"`
+	Increase float64 `json:"increase_percent,omitempty"`
+}
+
+type CompareBootsResult struct {
+	Host        string        `json:"host"`
+	Boots       []BootSummary `json:"boots"`
+	Regressions []Regression  `json:"regressions"`
+	Hint        string        `json:"hint,omitempty"`
+}
+
+func CreateCompareBootsSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[CompareBootsParams](nil)
+	inputSchema.Properties["boots"].Default = json.RawMessage(strconv.Itoa(DefaultCompareBoots))
+	inputSchema.Properties["top"].Default = json.RawMessage(strconv.Itoa(DefaultTopUnits))
+	inputSchema.Properties["threshold"].Default = json.RawMessage(`20`)
+	return inputSchema
+}
+
+// bootEvent is a boot related message of pid1
+type bootEvent struct {
+	boot   string
+	time   time.Time
+	msgID  string
+	unit   string
+	fields map[string]string
+}
+
+func usecField(fields map[string]string, name string) time.Duration {
+	usec, err := strconv.ParseInt(fields[name], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// summarizeBoots creates a summary for every boot, ordered from the newest to
+// the oldest boot. The events may be in any order.
+func summarizeBoots(events []bootEvent, top int) []BootSummary {
+	byBoot := make(map[string][]bootEvent)
+	for _, ev := range events {
+		byBoot[ev.boot] = append(byBoot[ev.boot], ev)
+	}
+	var summaries []BootSummary
+	for boot, evs := range byBoot {
+		slices.SortStableFunc(evs, func(a, b bootEvent) int {
+			return a.time.Compare(b.time)
+		})
+		sum := BootSummary{
+			BootID: boot,
+			Start:  evs[0].time,
+			units:  make(map[string]time.Duration),
+		}
+		starting := make(map[string]time.Time)
+		for _, ev := range evs {
+			switch ev.msgID {
+			case msgStartupFinished:
+				sum.Kernel = usecField(ev.fields, "KERNEL_USEC").Milliseconds()
+				sum.Initrd = usecField(ev.fields, "INITRD_USEC").Milliseconds()
+				sum.Userspace = usecField(ev.fields, "USERSPACE_USEC").Milliseconds()
+				sum.Total = (usecField(ev.fields, "FIRMWARE_USEC") + usecField(ev.fields, "LOADER_USEC") +
+					usecField(ev.fields, "KERNEL_USEC") + usecField(ev.fields, "INITRD_USEC") +
+					usecField(ev.fields, "USERSPACE_USEC")).Milliseconds()
+			case msgUnitStarting:
+				if _, ok := starting[ev.unit]; !ok {
+					starting[ev.unit] = ev.time
+				}
+			case msgUnitStarted:
+				if start, ok := starting[ev.unit]; ok {
+					if _, done := sum.units[ev.unit]; !done {
+						sum.units[ev.unit] = ev.time.Sub(start)
+					}
+				}
+			case msgUnitFailed:
+				if !slices.Contains(sum.FailedUnits, ev.unit) {
+					sum.FailedUnits = append(sum.FailedUnits, ev.unit)
+				}
+			}
+		}
+		for unit, dur := range sum.units {
+			sum.Slowest = append(sum.Slowest, UnitStartup{Unit: unit, Duration: dur.Milliseconds()})
+		}
+		slices.SortFunc(sum.Slowest, func(a, b UnitStartup) int {
+			if a.Duration != b.Duration {
+				return cmp.Compare(b.Duration, a.Duration)
+			}
+			return strings.Compare(a.Unit, b.Unit)
+		})
+		if len(sum.Slowest) > top {
+			sum.Slowest = sum.Slowest[:top]
+		}
+		slices.Sort(sum.FailedUnits)
+		summaries = append(summaries, sum)
+	}
+	slices.SortFunc(summaries, func(a, b BootSummary) int {
+		return b.Start.Compare(a.Start)
+	})
+	return summaries
+}
+
+func increase(current, average float64) float64 {
+	if average == 0 {
+		return 0
+	}
+	return (current - average) / average * 100
+}
+
+// findRegressions compares the newest boot against the average of the older
+// boots
+func findRegressions(boots []BootSummary, threshold float64) []Regression {
+	regressions := []Regression{}
+	if len(boots) < 2 {
+		return regressions
+	}
+	current, older := boots[0], boots[1:]
+
+	var totalSum, totalCount int64
+	for _, b := range older {
+		if b.Total > 0 {
+			totalSum += b.Total
+			totalCount++
+		}
+	}
+	if current.Total > 0 && totalCount > 0 {
+		avg := totalSum / totalCount
+		if inc := increase(float64(current.Total), float64(avg)); inc > threshold {
+			regressions = append(regressions, Regression{
+				Kind:     "boot_time",
+				Current:  current.Total,
+				Average:  avg,
+				Increase: inc,
+			})
+		}
+	}
+
+	var unitRegressions []Regression
+	for unit, dur := range current.units {
+		var sum time.Duration
+		var count int
+		for _, b := range older {
+			if d, ok := b.units[unit]; ok {
+				sum += d
+				count++
+			}
+		}
+		if count == 0 {
+			continue
+		}
+		avg := sum / time.Duration(count)
+		if dur-avg < minUnitRegression {
+			continue
+		}
+		if inc := increase(float64(dur), float64(avg)); inc > threshold {
+			unitRegressions = append(unitRegressions, Regression{
+				Kind:     "unit_startup",
+				Unit:     unit,
+				Current:  dur.Milliseconds(),
+				Average:  avg.Milliseconds(),
+				Increase: inc,
+			})
+		}
+	}
+	slices.SortFunc(unitRegressions, func(a, b Regression) int {
+		return cmp.Compare(b.Current-b.Average, a.Current-a.Average)
+	})
+	regressions = append(regressions, unitRegressions...)
+
+	for _, unit := range current.FailedUnits {
+		failedBefore := false
+		for _, b := range older {
+			if slices.Contains(b.FailedUnits, unit) {
+				failedBefore = true
+				break
+			}
+		}
+		if !failedBefore {
+			regressions = append(regressions, Regression{
+				Kind: "new_failure",
+				Unit: unit,
+			})
+		}
+	}
+	return regressions
+}
+
+// CompareBoots compares the boot time, unit startup times and failed units of
+// the last boots and reports the regressions of the current boot.
+func (sj *HostLog) CompareBoots(ctx context.Context, req *mcp.CallToolRequest, params *CompareBootsParams) (*mcp.CallToolResult, any, error) {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	allowed, err := sj.self_init(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	nrBoots := params.Boots
+	if nrBoots <= 0 {
+		nrBoots = DefaultCompareBoots
+	}
+	if nrBoots > MaxCompareBoots {
+		return nil, nil, fmt.Errorf("can't compare more than %d boots", MaxCompareBoots)
+	}
+	top := params.Top
+	if top <= 0 {
+		top = DefaultTopUnits
+	}
+	threshold := params.Threshold
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+
+	sj.journal.FlushMatches()
+	for _, id := range []string{msgStartupFinished, msgUnitStarting, msgUnitStarted, msgUnitFailed} {
+		if err := sj.journal.AddMatch("MESSAGE_ID=" + id); err != nil {
+			return nil, nil, fmt.Errorf("failed to add message filter: %w", err)
+		}
+	}
+	// only the system manager
+	if err := sj.journal.AddMatch("_PID=1"); err != nil {
+		return nil, nil, fmt.Errorf("failed to add pid filter: %w", err)
+	}
+	if err := sj.journal.SeekTail(); err != nil {
+		return nil, nil, fmt.Errorf("failed to seek to end: %w", err)
+	}
+
+	// walk backwards until enough boots were seen
+	var events []bootEvent
+	seenBoots := make(map[string]bool)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		ret, err := sj.journal.Previous()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read previous entry: %w", err)
+		}
+		if ret == 0 {
+			break
+		}
+		entry, err := sj.getEntry()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get log entry: %w", err)
+		}
+		boot := entry.Fields["_BOOT_ID"]
+		if !seenBoots[boot] {
+			if len(seenBoots) == nrBoots {
+				break
+			}
+			seenBoots[boot] = true
+		}
+		events = append(events, bootEvent{
+			boot:   boot,
+			time:   time.UnixMicro(int64(entry.RealtimeTimestamp)),
+			msgID:  entry.Fields["MESSAGE_ID"],
+			unit:   entry.Fields["UNIT"],
+			fields: entry.Fields,
+		})
+	}
+
+	host, _ := os.Hostname()
+	res := CompareBootsResult{
+		Host:  host,
+		Boots: summarizeBoots(events, top),
+	}
+	res.Regressions = findRegressions(res.Boots, threshold)
+	if len(res.Boots) < 2 {
+		res.Hint = "Less than two boots are recorded in the journal, enable persistent journal storage to compare boots."
+	}
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
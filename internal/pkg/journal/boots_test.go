@@ -0,0 +1,64 @@
+package journal
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bootEvents(boot string, start time.Time, userspace, slowUnit time.Duration, failed ...string) []bootEvent {
+	events := []bootEvent{
+		{boot: boot, time: start, msgID: msgUnitStarting, unit: "slow.service"},
+		{boot: boot, time: start.Add(slowUnit), msgID: msgUnitStarted, unit: "slow.service"},
+		{boot: boot, time: start.Add(time.Second), msgID: msgUnitStarting, unit: "fast.service"},
+		{boot: boot, time: start.Add(time.Second + 10*time.Millisecond), msgID: msgUnitStarted, unit: "fast.service"},
+		{boot: boot, time: start.Add(userspace), msgID: msgStartupFinished, fields: map[string]string{
+			"KERNEL_USEC":    "1000000",
+			"USERSPACE_USEC": strconv.FormatInt(userspace.Microseconds(), 10),
+		}},
+	}
+	for _, unit := range failed {
+		events = append(events, bootEvent{boot: boot, time: start.Add(2 * time.Second), msgID: msgUnitFailed, unit: unit})
+	}
+	return events
+}
+
+func TestSummarizeBoots(t *testing.T) {
+	now := time.Now()
+	var events []bootEvent
+	events = append(events, bootEvents("old", now.Add(-48*time.Hour), 10*time.Second, 2*time.Second)...)
+	events = append(events, bootEvents("new", now, 20*time.Second, 5*time.Second, "broken.service")...)
+
+	boots := summarizeBoots(events, 1)
+	require.Len(t, boots, 2)
+	assert.Equal(t, "new", boots[0].BootID)
+	assert.Equal(t, int64(21000), boots[0].Total)
+	assert.Equal(t, int64(20000), boots[0].Userspace)
+	assert.Equal(t, []UnitStartup{{Unit: "slow.service", Duration: 5000}}, boots[0].Slowest)
+	assert.Equal(t, []string{"broken.service"}, boots[0].FailedUnits)
+	assert.Equal(t, "old", boots[1].BootID)
+	assert.Empty(t, boots[1].FailedUnits)
+}
+
+func TestFindRegressions(t *testing.T) {
+	now := time.Now()
+	var events []bootEvent
+	events = append(events, bootEvents("older", now.Add(-72*time.Hour), 10*time.Second, 2*time.Second, "broken.service")...)
+	events = append(events, bootEvents("old", now.Add(-48*time.Hour), 10*time.Second, 2*time.Second)...)
+	events = append(events, bootEvents("new", now, 20*time.Second, 5*time.Second, "broken.service", "new.service")...)
+
+	regressions := findRegressions(summarizeBoots(events, DefaultTopUnits), DefaultThreshold)
+	require.Len(t, regressions, 3)
+	assert.Equal(t, "boot_time", regressions[0].Kind)
+	assert.Equal(t, int64(21000), regressions[0].Current)
+	assert.Equal(t, int64(11000), regressions[0].Average)
+	assert.Equal(t, "unit_startup", regressions[1].Kind)
+	assert.Equal(t, "slow.service", regressions[1].Unit)
+	// broken.service already failed in an older boot
+	assert.Equal(t, Regression{Kind: "new_failure", Unit: "new.service"}, regressions[2])
+
+	assert.Empty(t, findRegressions(summarizeBoots(bootEvents("single", now, time.Second, time.Second), 1), DefaultThreshold))
+}
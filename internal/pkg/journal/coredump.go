@@ -0,0 +1,294 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// MESSAGE_ID of the entries systemd-coredump logs for a crash
+	coredumpMessageID     = "fc2e22bc6ee647b6b90729ab34a250b1"
+	DefaultCoredumpWindow = "-7d"
+	DefaultCoredumps      = 20
+	DefaultBacktraceLines = 20
+)
+
+// fields of a coredump entry which are listed, the COREDUMP field with the
+// dump itself is never read
+var coredumpFields = []string{
+	"COREDUMP_PID", "COREDUMP_UID", "COREDUMP_SIGNAL", "COREDUMP_SIGNAL_NAME",
+	"COREDUMP_EXE", "COREDUMP_COMM", "COREDUMP_CMDLINE", "COREDUMP_UNIT",
+	"COREDUMP_USER_UNIT", "COREDUMP_TIMESTAMP", "COREDUMP_FILENAME",
+	"COREDUMP_PACKAGE_NAME", "COREDUMP_PACKAGE_VERSION",
+}
+
+type ListCoredumpsParams struct {
+	Since string `json:"since,omitempty" jsonschema:"Only crashes at or after this time, same formats as since of list_log."`
+	Unit  string `json:"unit,omitempty" jsonschema:"Only crashes of processes of this unit, e.g. nginx.service."`
+	Exe   string `json:"exe,omitempty" jsonschema:"Only crashes of this executable, the path or its base name."`
+	Limit int    `json:"limit,omitempty" jsonschema:"Maximal number of crashes to list, the newest first."`
+}
+
+type GetCoredumpInfoParams struct {
+	ID    string `json:"id" jsonschema:"Id of the crash as returned by list_coredumps."`
+	Lines int    `json:"lines,omitempty" jsonschema:"Number of lines of the backtrace to return. Set to -1 to omit it."`
+}
+
+type Coredump struct {
+	// cursor of the journal entry
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	PID      int       `json:"pid"`
+	UID      int       `json:"uid"`
+	Signal   string    `json:"signal"`
+	Exe      string    `json:"exe"`
+	Comm     string    `json:"comm,omitempty"`
+	Unit     string    `json:"unit,omitempty"`
+	UserUnit string    `json:"user_unit,omitempty"`
+	// the dump is stored in this file, unset if it wasn't stored or is
+	// stored in the journal
+	Filename string `json:"filename,omitempty"`
+}
+
+type CoredumpInfo struct {
+	Coredump
+	Cmdline        string `json:"cmdline,omitempty"`
+	Package        string `json:"package,omitempty"`
+	PackageVersion string `json:"package_version,omitempty"`
+	// the dump file was removed by the cleanup
+	Missing   bool     `json:"missing,omitempty"`
+	Backtrace []string `json:"backtrace,omitempty"`
+	Truncated bool     `json:"backtrace_truncated,omitempty"`
+}
+
+type ListCoredumpsResult struct {
+	Host      string     `json:"host"`
+	Since     time.Time  `json:"since"`
+	Coredumps []Coredump `json:"coredumps"`
+}
+
+func CreateListCoredumpsSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ListCoredumpsParams](nil)
+	inputSchema.Properties["since"].Default = json.RawMessage(strconv.Quote(DefaultCoredumpWindow))
+	inputSchema.Properties["limit"].Default = json.RawMessage(strconv.Itoa(DefaultCoredumps))
+	return inputSchema
+}
+
+func CreateGetCoredumpInfoSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[GetCoredumpInfoParams](nil)
+	inputSchema.Properties["lines"].Default = json.RawMessage(strconv.Itoa(DefaultBacktraceLines))
+	return inputSchema
+}
+
+// coredumpFromFields fills a coredump from the fields of its entry
+func coredumpFromFields(cursor string, fields map[string]string) Coredump {
+	c := Coredump{
+		ID:       cursor,
+		Signal:   fields["COREDUMP_SIGNAL_NAME"],
+		Exe:      fields["COREDUMP_EXE"],
+		Comm:     fields["COREDUMP_COMM"],
+		Unit:     fields["COREDUMP_UNIT"],
+		UserUnit: fields["COREDUMP_USER_UNIT"],
+		Filename: fields["COREDUMP_FILENAME"],
+	}
+	c.PID, _ = strconv.Atoi(fields["COREDUMP_PID"])
+	c.UID, _ = strconv.Atoi(fields["COREDUMP_UID"])
+	if c.Signal == "" {
+		c.Signal = fields["COREDUMP_SIGNAL"]
+	}
+	if usec, err := strconv.ParseInt(fields["COREDUMP_TIMESTAMP"], 10, 64); err == nil {
+		c.Time = time.UnixMicro(usec)
+	}
+	return c
+}
+
+// backtrace returns the stack traces systemd-coredump appends to the
+// message, cut to lines
+func backtrace(msg string, lines int) (trace []string, truncated bool) {
+	_, stack, found := strings.Cut(msg, "\n")
+	if !found || !strings.Contains(stack, "Stack trace of thread") {
+		return nil, false
+	}
+	for _, line := range strings.Split(strings.TrimSpace(stack), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if len(trace) == lines {
+			return trace, true
+		}
+		trace = append(trace, line)
+	}
+	return trace, false
+}
+
+// matchesExe reports if the executable is exe, given as path or base name
+func matchesExe(path, exe string) bool {
+	return exe == "" || path == exe || strings.HasSuffix(path, "/"+exe)
+}
+
+// readFields reads the given fields of the current entry, missing fields
+// are left out
+func (sj *HostLog) readFields(names []string) map[string]string {
+	fields := make(map[string]string, len(names))
+	for _, name := range names {
+		if val, err := sj.journal.GetDataValue(name); err == nil {
+			fields[name] = val
+		}
+	}
+	return fields
+}
+
+// ListCoredumps lists the crashes systemd-coredump logged, like
+// coredumpctl list, the newest first
+func (sj *HostLog) ListCoredumps(ctx context.Context, req *mcp.CallToolRequest, params *ListCoredumpsParams) (*mcp.CallToolResult, any, error) {
+	if params.Since == "" {
+		params.Since = DefaultCoredumpWindow
+	}
+	since, err := parseTime(params.Since, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = DefaultCoredumps
+	}
+
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	allowed, err := sj.self_init(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	sj.journal.FlushMatches()
+	if err := sj.journal.AddMatch("MESSAGE_ID=" + coredumpMessageID); err != nil {
+		return nil, nil, fmt.Errorf("failed to add coredump filter: %w", err)
+	}
+	if params.Unit != "" {
+		if err := sj.journal.AddMatch("COREDUMP_UNIT=" + params.Unit); err != nil {
+			return nil, nil, fmt.Errorf("failed to add unit filter: %w", err)
+		}
+	}
+	if err := sj.journal.SeekTail(); err != nil {
+		return nil, nil, fmt.Errorf("failed to seek to end: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	res := ListCoredumpsResult{Host: host, Since: since, Coredumps: []Coredump{}}
+	for len(res.Coredumps) < limit {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		ret, err := sj.journal.Previous()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read previous entry: %w", err)
+		}
+		if ret == 0 {
+			break
+		}
+		usec, err := sj.journal.GetRealtimeUsec()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get entry time: %w", err)
+		}
+		if usec < uint64(since.UnixMicro()) {
+			break
+		}
+		cursor, err := sj.journal.GetCursor()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get cursor: %w", err)
+		}
+		c := coredumpFromFields(cursor, sj.readFields(coredumpFields))
+		if !matchesExe(c.Exe, params.Exe) {
+			continue
+		}
+		if c.Time.IsZero() {
+			c.Time = time.UnixMicro(int64(usec))
+		}
+		res.Coredumps = append(res.Coredumps, c)
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
+
+// GetCoredumpInfo returns the details of a crash, like coredumpctl info,
+// with an excerpt of the backtrace
+func (sj *HostLog) GetCoredumpInfo(ctx context.Context, req *mcp.CallToolRequest, params *GetCoredumpInfoParams) (*mcp.CallToolResult, any, error) {
+	if params.ID == "" {
+		return nil, nil, fmt.Errorf("id is required")
+	}
+	lines := params.Lines
+	if lines == 0 {
+		lines = DefaultBacktraceLines
+	}
+
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	allowed, err := sj.self_init(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	sj.journal.FlushMatches()
+	if err := sj.journal.SeekCursor(params.ID); err != nil {
+		return nil, nil, fmt.Errorf("invalid id: %w", err)
+	}
+	if ret, err := sj.journal.Next(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read entry: %w", err)
+	} else if ret == 0 || sj.journal.TestCursor(params.ID) != nil {
+		return nil, nil, fmt.Errorf("no crash with id %s", params.ID)
+	}
+	// the message carries the backtrace
+	fields := sj.readFields(append(slices.Clone(coredumpFields), "MESSAGE"))
+	info := CoredumpInfo{
+		Coredump:       coredumpFromFields(params.ID, fields),
+		Cmdline:        fields["COREDUMP_CMDLINE"],
+		Package:        fields["COREDUMP_PACKAGE_NAME"],
+		PackageVersion: fields["COREDUMP_PACKAGE_VERSION"],
+	}
+	if info.Exe == "" {
+		return nil, nil, fmt.Errorf("the entry %s isn't a crash", params.ID)
+	}
+	if info.Filename != "" {
+		if _, err := os.Stat(info.Filename); err != nil {
+			info.Missing = true
+		}
+	}
+	if lines > 0 {
+		info.Backtrace, info.Truncated = backtrace(fields["MESSAGE"], lines)
+	}
+
+	jsonBytes, err := json.Marshal(info)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, info, nil
+}
@@ -0,0 +1,59 @@
+package journal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoredumpFromFields(t *testing.T) {
+	c := coredumpFromFields("s=1", map[string]string{
+		"COREDUMP_PID":         "4711",
+		"COREDUMP_UID":         "0",
+		"COREDUMP_SIGNAL":      "11",
+		"COREDUMP_SIGNAL_NAME": "SIGSEGV",
+		"COREDUMP_EXE":         "/usr/sbin/nginx",
+		"COREDUMP_UNIT":        "nginx.service",
+		"COREDUMP_TIMESTAMP":   "1792058400000000",
+	})
+	assert.Equal(t, "s=1", c.ID)
+	assert.Equal(t, 4711, c.PID)
+	assert.Equal(t, "SIGSEGV", c.Signal)
+	assert.Equal(t, "nginx.service", c.Unit)
+	assert.Equal(t, time.UnixMicro(1792058400000000), c.Time)
+
+	c = coredumpFromFields("s=2", map[string]string{"COREDUMP_SIGNAL": "6"})
+	assert.Equal(t, "6", c.Signal)
+	assert.True(t, c.Time.IsZero())
+}
+
+func TestBacktrace(t *testing.T) {
+	msg := `Process 4711 (nginx) of user 0 dumped core.
+
+Stack trace of thread 4711:
+#0  0x00007f1c2d8a0b7c ngx_http_process_request (nginx + 0x5ab7c)
+#1  0x00007f1c2d8a1234 ngx_http_read_request_header (nginx + 0x5b234)
+#2  0x00007f1c2d8a5678 ngx_epoll_process_events (nginx + 0x5f678)
+ELF object binary architecture: AMD x86-64`
+
+	trace, truncated := backtrace(msg, 20)
+	require.Len(t, trace, 5)
+	assert.Equal(t, "Stack trace of thread 4711:", trace[0])
+	assert.False(t, truncated)
+
+	trace, truncated = backtrace(msg, 2)
+	assert.Len(t, trace, 2)
+	assert.True(t, truncated)
+
+	trace, _ = backtrace("Process 4711 (nginx) of user 0 dumped core.", 20)
+	assert.Nil(t, trace)
+}
+
+func TestMatchesExe(t *testing.T) {
+	assert.True(t, matchesExe("/usr/sbin/nginx", ""))
+	assert.True(t, matchesExe("/usr/sbin/nginx", "nginx"))
+	assert.True(t, matchesExe("/usr/sbin/nginx", "/usr/sbin/nginx"))
+	assert.False(t, matchesExe("/usr/sbin/nginx-debug", "nginx"))
+}
@@ -0,0 +1,141 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	DefaultFieldValues = 200
+	// the field names are collected from the newest entries, as the journal
+	// API can't enumerate them
+	fieldSampleEntries = 1000
+)
+
+type JournalFieldsParams struct {
+	Field   string `json:"field,omitempty" jsonschema:"Field of which the unique values are listed, e.g. SYSLOG_IDENTIFIER or _SYSTEMD_UNIT. Without a field the names of the fields are listed."`
+	Pattern string `json:"pattern,omitempty" jsonschema:"Regular expression the listed values have to match."`
+	Limit   int    `json:"limit,omitempty" jsonschema:"Maximal number of values to list."`
+}
+
+type JournalFieldsResult struct {
+	Field string `json:"field,omitempty"`
+	// names of the fields, or the values of the field
+	Values []string `json:"values"`
+	// number of matching values before the limit
+	NrValues int `json:"nr_values"`
+	// number of entries the field names were collected from
+	Sampled   int  `json:"sampled_entries,omitempty"`
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+func CreateJournalFieldsSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[JournalFieldsParams](nil)
+	inputSchema.Properties["limit"].Default = json.RawMessage(strconv.Itoa(DefaultFieldValues))
+	return inputSchema
+}
+
+// filterValues sorts the values matching re and cuts them to limit
+func filterValues(values []string, re *regexp.Regexp, limit int, res *JournalFieldsResult) {
+	if re != nil {
+		values = slices.DeleteFunc(values, func(v string) bool { return !re.MatchString(v) })
+	}
+	slices.Sort(values)
+	res.NrValues = len(values)
+	if len(values) > limit {
+		values = values[:limit]
+		res.Truncated = true
+	}
+	res.Values = append([]string{}, values...)
+}
+
+// fieldNames collects the names of the fields of the newest entries
+func (sj *HostLog) fieldNames(ctx context.Context) ([]string, int, error) {
+	if err := sj.journal.SeekTail(); err != nil {
+		return nil, 0, fmt.Errorf("failed to seek to end: %w", err)
+	}
+	names := make(map[string]bool)
+	sampled := 0
+	for ; sampled < fieldSampleEntries; sampled++ {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		ret, err := sj.journal.Previous()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read previous entry: %w", err)
+		}
+		if ret == 0 {
+			break
+		}
+		entry, err := sj.getEntry()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get log entry: %w", err)
+		}
+		for name := range entry.Fields {
+			names[name] = true
+		}
+	}
+	var fields []string
+	for name := range names {
+		fields = append(fields, name)
+	}
+	return fields, sampled, nil
+}
+
+// JournalFields lists the names of the journal fields or the unique values
+// of a field, like journalctl -N and -F, so that filters of list_log can be
+// built from values which exist.
+func (sj *HostLog) JournalFields(ctx context.Context, req *mcp.CallToolRequest, params *JournalFieldsParams) (*mcp.CallToolResult, any, error) {
+	var re *regexp.Regexp
+	var err error
+	if params.Pattern != "" {
+		if re, err = regexp.Compile(params.Pattern); err != nil {
+			return nil, nil, fmt.Errorf("invalid regex pattern: %w", err)
+		}
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = DefaultFieldValues
+	}
+
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	allowed, err := sj.self_init(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	sj.journal.FlushMatches()
+
+	res := JournalFieldsResult{Field: params.Field}
+	var values []string
+	if params.Field == "" {
+		if values, res.Sampled, err = sj.fieldNames(ctx); err != nil {
+			return nil, nil, err
+		}
+	} else if values, err = sj.journal.GetUniqueValues(params.Field); err != nil {
+		return nil, nil, fmt.Errorf("failed to get values of %s: %w", params.Field, err)
+	}
+	filterValues(values, re, limit, &res)
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
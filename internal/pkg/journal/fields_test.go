@@ -0,0 +1,29 @@
+package journal
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterValues(t *testing.T) {
+	values := []string{"sshd", "nginx", "kernel", "systemd-logind", "systemd"}
+
+	res := JournalFieldsResult{}
+	filterValues(append([]string{}, values...), nil, 10, &res)
+	assert.Equal(t, []string{"kernel", "nginx", "sshd", "systemd", "systemd-logind"}, res.Values)
+	assert.Equal(t, 5, res.NrValues)
+	assert.False(t, res.Truncated)
+
+	res = JournalFieldsResult{}
+	filterValues(append([]string{}, values...), regexp.MustCompile("^s"), 2, &res)
+	assert.Equal(t, []string{"sshd", "systemd"}, res.Values)
+	assert.Equal(t, 3, res.NrValues)
+	assert.True(t, res.Truncated)
+
+	res = JournalFieldsResult{}
+	filterValues(nil, nil, 10, &res)
+	assert.NotNil(t, res.Values)
+	assert.Zero(t, res.NrValues)
+}
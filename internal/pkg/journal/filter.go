@@ -0,0 +1,178 @@
+package journal
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslog priorities in the order of their numeric value
+var priorityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+var relativeTime = regexp.MustCompile(`^([+-]?)((?:\d+(?:\.\d+)?(?:ns|us|µs|ms|s|m|h|d|w))+)( ago)?$`)
+var relativePart = regexp.MustCompile(`(\d+(?:\.\d+)?)(ns|us|µs|ms|s|m|h|d|w)`)
+var machineIdRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// ValidPriorities returns the names of the priorities
+func ValidPriorities() []string {
+	return slices.Clone(priorityNames)
+}
+
+// parsePriority accepts the name or the number of a priority
+func parsePriority(val string) (int, error) {
+	val = strings.ToLower(strings.TrimSpace(val))
+	if i := slices.Index(priorityNames, val); i >= 0 {
+		return i, nil
+	}
+	switch val {
+	case "error":
+		return 3, nil
+	case "warn":
+		return 4, nil
+	}
+	if i, err := strconv.Atoi(val); err == nil && i >= 0 && i < len(priorityNames) {
+		return i, nil
+	}
+	return 0, fmt.Errorf("invalid priority %q, must be one of %v or 0-7", val, priorityNames)
+}
+
+// priorityLevels returns the levels selected by priority, a single level or
+// a range FROM..TO, and by atLeast, which selects this and all more
+// important levels like journalctl -p does. If both are set, the levels in
+// both are selected.
+func priorityLevels(priority, atLeast string) ([]int, error) {
+	if priority == "" && atLeast == "" {
+		return nil, nil
+	}
+	highest, lowest := 0, len(priorityNames)-1
+	var err error
+	if from, to, ok := strings.Cut(priority, ".."); ok {
+		if highest, err = parsePriority(from); err != nil {
+			return nil, err
+		}
+		if lowest, err = parsePriority(to); err != nil {
+			return nil, err
+		}
+		if highest > lowest {
+			highest, lowest = lowest, highest
+		}
+	} else if priority != "" {
+		if highest, err = parsePriority(priority); err != nil {
+			return nil, err
+		}
+		lowest = highest
+	}
+	if atLeast != "" {
+		minLevel, err := parsePriority(atLeast)
+		if err != nil {
+			return nil, err
+		}
+		lowest = min(lowest, minLevel)
+	}
+	if highest > lowest {
+		return nil, fmt.Errorf("priority %s and priority_min %s don't select any level", priority, atLeast)
+	}
+	var levels []int
+	for i := highest; i <= lowest; i++ {
+		levels = append(levels, i)
+	}
+	return levels, nil
+}
+
+// priorityName decodes the PRIORITY field of an entry
+func priorityName(field string) string {
+	if i, err := strconv.Atoi(field); err == nil && i >= 0 && i < len(priorityNames) {
+		return priorityNames[i]
+	}
+	return ""
+}
+
+// parseTime understands the formats of journalctl --since: absolute times,
+// now, today, yesterday, tomorrow and times relative to now like -2h,
+// +30m or 1d ago
+func parseTime(val string, now time.Time) (time.Time, error) {
+	val = strings.TrimSpace(val)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch val {
+	case "":
+		return time.Time{}, nil
+	case "now":
+		return now, nil
+	case "today":
+		return midnight, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), nil
+	case "tomorrow":
+		return midnight.AddDate(0, 0, 1), nil
+	}
+	if m := relativeTime.FindStringSubmatch(val); m != nil {
+		var d time.Duration
+		for _, part := range relativePart.FindAllStringSubmatch(m[2], -1) {
+			num, _ := strconv.ParseFloat(part[1], 64)
+			unit := part[2]
+			switch unit {
+			case "d":
+				num, unit = num*24, "h"
+			case "w":
+				num, unit = num*24*7, "h"
+			}
+			partDuration, err := time.ParseDuration(strconv.FormatFloat(num, 'f', -1, 64) + unit)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid relative time %q: %w", val, err)
+			}
+			d += partDuration
+		}
+		if m[1] == "-" || m[3] != "" {
+			d = -d
+		}
+		return now.Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, val, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use RFC3339, 'YYYY-MM-DD [HH:MM[:SS]]', now, today, yesterday or a relative time like -2h", val)
+}
+
+// timeRange returns the time window of the parameters, since and until take
+// precedence over from and to
+func timeRange(params *ListLogParams, now time.Time) (since, until time.Time, err error) {
+	since, until = params.From, params.To
+	if params.Since != "" {
+		if since, err = parseTime(params.Since, now); err != nil {
+			return
+		}
+	}
+	if params.Until != "" {
+		if until, err = parseTime(params.Until, now); err != nil {
+			return
+		}
+	}
+	if !since.IsZero() && !until.IsZero() && since.After(until) {
+		err = fmt.Errorf("since time cannot be after until time")
+	}
+	return
+}
+
+// extraFields returns the requested fields the entry has, the names are
+// upper case as all journal fields
+func extraFields(fields map[string]string, names []string) map[string]string {
+	var extra map[string]string
+	for _, name := range names {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if val, ok := fields[name]; ok {
+			if extra == nil {
+				extra = make(map[string]string)
+			}
+			extra[name] = val
+		}
+	}
+	return extra
+}
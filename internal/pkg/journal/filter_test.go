@@ -0,0 +1,127 @@
+package journal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriorityLevels(t *testing.T) {
+	tests := []struct {
+		priority string
+		atLeast  string
+		want     []int
+	}{
+		{"", "", nil},
+		{"err", "", []int{3}},
+		{"3", "", []int{3}},
+		{"warning..err", "", []int{3, 4}},
+		{"err..warning", "", []int{3, 4}},
+		{"", "err", []int{0, 1, 2, 3}},
+		{"", "WARN", []int{0, 1, 2, 3, 4}},
+		{"crit..notice", "err", []int{2, 3}},
+		{"crit", "err", []int{2}},
+	}
+	for _, tt := range tests {
+		levels, err := priorityLevels(tt.priority, tt.atLeast)
+		require.NoError(t, err, tt.priority)
+		assert.Equal(t, tt.want, levels, tt.priority)
+	}
+	for _, invalid := range []struct{ priority, atLeast string }{
+		{"8", ""}, {"fatal", ""}, {"err..", ""}, {"-1", ""}, {"", "verbose"}, {"debug", "err"},
+	} {
+		_, err := priorityLevels(invalid.priority, invalid.atLeast)
+		assert.Error(t, err, invalid)
+	}
+	assert.Equal(t, "warning", priorityName("4"))
+	assert.Equal(t, "", priorityName(""))
+	assert.Equal(t, "", priorityName("9"))
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2026, 10, 15, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		val  string
+		want time.Time
+	}{
+		{"", time.Time{}},
+		{"now", now},
+		{"today", time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)},
+		{"yesterday", time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)},
+		{"-2h", now.Add(-2 * time.Hour)},
+		{"+30m", now.Add(30 * time.Minute)},
+		{"1h30m ago", now.Add(-90 * time.Minute)},
+		{"-1d", now.AddDate(0, 0, -1)},
+		{"-1w", now.AddDate(0, 0, -7)},
+		{"2026-10-15T10:00:00+02:00", time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC)},
+		{"2026-10-15 10:00", time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)},
+		{"2026-10-01", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseTime(tt.val, now)
+		require.NoError(t, err, tt.val)
+		assert.True(t, tt.want.Equal(got), "%s: got %s, want %s", tt.val, got, tt.want)
+	}
+	for _, invalid := range []string{"soon", "-2x", "15.10.2026"} {
+		_, err := parseTime(invalid, now)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	now := time.Date(2026, 10, 15, 14, 30, 0, 0, time.UTC)
+	from := now.Add(-time.Hour)
+	since, until, err := timeRange(&ListLogParams{From: from}, now)
+	require.NoError(t, err)
+	assert.Equal(t, from, since)
+	assert.True(t, until.IsZero())
+
+	since, until, err = timeRange(&ListLogParams{From: from, Since: "-2h", Until: "now"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-2*time.Hour), since)
+	assert.Equal(t, now, until)
+
+	_, _, err = timeRange(&ListLogParams{Since: "now", Until: "-1h"}, now)
+	assert.Error(t, err)
+}
+
+func TestEntryFilter(t *testing.T) {
+	now := time.Now()
+	filter, err := newEntryFilter(&ListLogParams{Grep: "^Failed"}, now.Add(-time.Hour), now)
+	require.NoError(t, err)
+	assert.True(t, filter.match(map[string]string{"MESSAGE": "Failed to start"}, now.Add(-time.Minute)))
+	assert.False(t, filter.match(map[string]string{"MESSAGE": "Started", "UNIT": "Failed"}, now.Add(-time.Minute)))
+	assert.False(t, filter.match(map[string]string{"MESSAGE": "Failed to start"}, now.Add(-2*time.Hour)))
+
+	_, err = newEntryFilter(&ListLogParams{Grep: "("}, time.Time{}, time.Time{})
+	assert.Error(t, err)
+}
+
+func TestEntryFilterUnits(t *testing.T) {
+	units, err := policy.NewUnitAccess([]string{"nginx*.service"}, nil)
+	require.NoError(t, err)
+	filter, err := newEntryFilter(&ListLogParams{}, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	filter.units = units
+	assert.True(t, filter.local())
+	now := time.Now()
+	assert.True(t, filter.match(map[string]string{"_SYSTEMD_UNIT": "nginx.service"}, now))
+	assert.True(t, filter.match(map[string]string{"_SYSTEMD_USER_UNIT": "nginx-dev.service"}, now))
+	assert.False(t, filter.match(map[string]string{"_SYSTEMD_UNIT": "sshd.service"}, now))
+	assert.False(t, filter.match(map[string]string{"_TRANSPORT": "kernel"}, now))
+
+	assert.ErrorContains(t, checkUnits(units, &ListLogParams{Unit: []string{"sshd.service"}, ExactUnit: true}), "outside")
+	assert.NoError(t, checkUnits(units, &ListLogParams{Unit: []string{"nginx.service"}, ExactUnit: true}))
+	// the entries of regular expressions are filtered
+	assert.NoError(t, checkUnits(units, &ListLogParams{Unit: []string{"ssh.*"}}))
+}
+
+func TestExtraFields(t *testing.T) {
+	fields := map[string]string{"MESSAGE": "Failed", "_PID": "42", "ERRNO": "2"}
+	assert.Equal(t, map[string]string{"_PID": "42", "ERRNO": "2"}, extraFields(fields, []string{"_pid", "ERRNO", "CODE_FILE"}))
+	assert.Nil(t, extraFields(fields, []string{"CODE_FILE"}))
+	assert.Nil(t, extraFields(fields, nil))
+}
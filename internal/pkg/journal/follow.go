@@ -0,0 +1,282 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	DefaultFollowSeconds = 30
+	MaxFollowSeconds     = 120
+	// entries kept in the result, all are streamed
+	maxFollowEntries = 1000
+	// the journal is checked for new entries at this interval, it isn't
+	// locked in between
+	followInterval = time.Second
+)
+
+type FollowLogParams struct {
+	Unit        string `json:"unit" jsonschema:"Exact name of the unit, e.g. nginx.service."`
+	Seconds     int    `json:"seconds,omitempty" jsonschema:"Number of seconds to follow the log."`
+	Pattern     string `json:"pattern,omitempty" jsonschema:"Stop following as soon as a message matches this regular expression."`
+	PriorityMin string `json:"priority_min,omitempty" jsonschema:"Only entries with this or a more important priority, e.g. err."`
+}
+
+type FollowLogResult struct {
+	Unit       string      `json:"unit"`
+	Host       string      `json:"host"`
+	Started    time.Time   `json:"started"`
+	Stopped    time.Time   `json:"stopped"`
+	Matched    bool        `json:"matched"`
+	NrMessages int         `json:"nr_messages"`
+	Messages   []LogOutput `json:"messages"`
+	// more entries were logged than are kept in the result
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+func CreateFollowLogSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[FollowLogParams](nil)
+	inputSchema.Properties["seconds"].Default = json.RawMessage(strconv.Itoa(DefaultFollowSeconds))
+	return inputSchema
+}
+
+// followDuration returns the duration to follow for the requested seconds
+func followDuration(seconds int) (time.Duration, error) {
+	switch {
+	case seconds == 0:
+		seconds = DefaultFollowSeconds
+	case seconds < 0 || seconds > MaxFollowSeconds:
+		return 0, fmt.Errorf("seconds must be between 1 and %d", MaxFollowSeconds)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// streamEntry sends an entry to the client while following, as progress
+// notification if the client asked for them, else as log message
+func streamEntry(ctx context.Context, req *mcp.CallToolRequest, nr int, entry *LogOutput) {
+	if req == nil || req.Session == nil {
+		return
+	}
+	line := fmt.Sprintf("%s %s: %s", entry.Time.Format(time.Stamp), entry.Identifier, entry.Msg)
+	var err error
+	if token := req.Params.GetProgressToken(); token != nil {
+		err = req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+			ProgressToken: token,
+			Message:       line,
+			Progress:      float64(nr),
+		})
+	} else {
+		err = req.Session.Log(ctx, &mcp.LoggingMessageParams{
+			Logger: "follow_log",
+			Level:  loggingLevel(entry.Priority),
+			Data:   line,
+		})
+	}
+	if err != nil {
+		slog.Debug("failed to stream log entry", "error", err)
+	}
+}
+
+// loggingLevel maps a syslog priority name to the MCP logging level
+func loggingLevel(priority string) mcp.LoggingLevel {
+	switch priority {
+	case "emerg":
+		return "emergency"
+	case "alert", "notice", "info", "debug":
+		return mcp.LoggingLevel(priority)
+	case "crit":
+		return "critical"
+	case "err":
+		return "error"
+	case "warning":
+		return "warning"
+	}
+	return "info"
+}
+
+// addFollowMatches filters the journal for the entries of the unit,
+// including the messages of the service manager about it
+func (sj *HostLog) addFollowMatches(unit string, levels []int) error {
+	sj.journal.FlushMatches()
+	if err := sj.journal.AddMatch("_SYSTEMD_UNIT=" + unit); err != nil {
+		return fmt.Errorf("failed to add unit filter: %w", err)
+	}
+	if err := sj.journal.AddDisjunction(); err != nil {
+		return err
+	}
+	if err := sj.journal.AddMatch("UNIT=" + unit); err != nil {
+		return fmt.Errorf("failed to add unit filter: %w", err)
+	}
+	if err := sj.journal.AddConjunction(); err != nil {
+		return err
+	}
+	for _, level := range levels {
+		if err := sj.journal.AddMatch("PRIORITY=" + strconv.Itoa(level)); err != nil {
+			return fmt.Errorf("failed to add priority filter: %w", err)
+		}
+	}
+	return nil
+}
+
+// followTail returns the cursor of the last entry of the unit, which is
+// empty if it has none
+func (sj *HostLog) followTail(ctx context.Context, unit string, levels []int) (string, error) {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	allowed, err := sj.self_init(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		return "", fmt.Errorf("calling method was canceled by user")
+	}
+	if err := sj.addFollowMatches(unit, levels); err != nil {
+		return "", err
+	}
+	if err := sj.journal.SeekTail(); err != nil {
+		return "", fmt.Errorf("failed to seek to end: %w", err)
+	}
+	if ret, err := sj.journal.Previous(); err != nil {
+		return "", fmt.Errorf("failed to read previous entry: %w", err)
+	} else if ret == 0 {
+		return "", nil
+	}
+	return sj.journal.GetCursor()
+}
+
+// followNext returns the entries of the unit after the cursor, or since the
+// time without a cursor, and the cursor of the last one. The journal is only
+// locked while reading, as it is shared with the other tools, so the matches
+// and the position are set again every time.
+func (sj *HostLog) followNext(unit string, levels []int, cursor string, since time.Time) ([]*sdjournal.JournalEntry, string, error) {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	if sj.journal == nil {
+		return nil, cursor, fmt.Errorf("the journal was closed")
+	}
+	if err := sj.addFollowMatches(unit, levels); err != nil {
+		return nil, cursor, err
+	}
+	if cursor != "" {
+		if found, err := sj.seekAfterCursor(cursor, time.Time{}); err != nil || !found {
+			return nil, cursor, err
+		}
+	} else {
+		if err := sj.journal.SeekRealtimeUsec(uint64(since.UnixMicro())); err != nil {
+			return nil, cursor, fmt.Errorf("failed to seek to start time: %w", err)
+		}
+		if ret, err := sj.journal.Next(); err != nil || ret == 0 {
+			return nil, cursor, err
+		}
+	}
+	var entries []*sdjournal.JournalEntry
+	for {
+		entry, err := sj.getEntry()
+		if err != nil {
+			return nil, cursor, fmt.Errorf("failed to get log entry: %w", err)
+		}
+		entries = append(entries, entry)
+		cursor = entry.Cursor
+		ret, err := sj.journal.Next()
+		if err != nil {
+			return nil, cursor, fmt.Errorf("failed to read next entry: %w", err)
+		}
+		if ret == 0 {
+			return entries, cursor, nil
+		}
+	}
+}
+
+// FollowLog waits for new entries of a unit, like journalctl -f, for the
+// given seconds or until a message matches the pattern. The entries are
+// streamed while following and returned at the end.
+func (sj *HostLog) FollowLog(ctx context.Context, req *mcp.CallToolRequest, params *FollowLogParams) (*mcp.CallToolResult, any, error) {
+	if params.Unit == "" {
+		return nil, nil, fmt.Errorf("unit is required")
+	}
+	if err := sj.Units.Check(params.Unit); err != nil {
+		return nil, nil, err
+	}
+	duration, err := followDuration(params.Seconds)
+	if err != nil {
+		return nil, nil, err
+	}
+	var stop *regexp.Regexp
+	if params.Pattern != "" {
+		if stop, err = regexp.Compile(params.Pattern); err != nil {
+			return nil, nil, fmt.Errorf("invalid regex pattern: %w", err)
+		}
+	}
+	levels, err := priorityLevels("", params.PriorityMin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	host, _ := os.Hostname()
+	res := FollowLogResult{Unit: params.Unit, Host: host, Started: time.Now(), Messages: []LogOutput{}}
+	// only new entries are read
+	cursor, err := sj.followTail(ctx, params.Unit, levels)
+	if err != nil {
+		return nil, nil, err
+	}
+	deadline := res.Started.Add(duration)
+	nr := 0
+	for !res.Matched && ctx.Err() == nil {
+		var entries []*sdjournal.JournalEntry
+		entries, cursor, err = sj.followNext(params.Unit, levels, cursor, res.Started)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range entries {
+			out := LogOutput{
+				Time:       time.UnixMicro(int64(entry.RealtimeTimestamp)),
+				Identifier: entry.Fields["SYSLOG_IDENTIFIER"],
+				Msg:        entry.Fields["MESSAGE"],
+				Priority:   priorityName(entry.Fields["PRIORITY"]),
+			}
+			out.Language, out.Translation = sj.Lang.Tag(ctx, out.Msg)
+			nr++
+			streamEntry(ctx, req, nr, &out)
+			if len(res.Messages) < maxFollowEntries {
+				res.Messages = append(res.Messages, out)
+			} else {
+				res.Truncated = true
+			}
+			if res.Matched = stop != nil && stop.MatchString(out.Msg); res.Matched {
+				break
+			}
+		}
+		remaining := time.Until(deadline)
+		if res.Matched || remaining <= 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(min(remaining, followInterval)):
+		}
+	}
+	res.Stopped = time.Now()
+	res.NrMessages = nr
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,56 @@
+package journal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollowDuration(t *testing.T) {
+	d, err := followDuration(0)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultFollowSeconds*time.Second, d)
+	d, err = followDuration(5)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, d)
+	_, err = followDuration(MaxFollowSeconds + 1)
+	assert.Error(t, err)
+	_, err = followDuration(-1)
+	assert.Error(t, err)
+}
+
+func TestLoggingLevel(t *testing.T) {
+	assert.Equal(t, mcp.LoggingLevel("emergency"), loggingLevel("emerg"))
+	assert.Equal(t, mcp.LoggingLevel("critical"), loggingLevel("crit"))
+	assert.Equal(t, mcp.LoggingLevel("error"), loggingLevel("err"))
+	assert.Equal(t, mcp.LoggingLevel("notice"), loggingLevel("notice"))
+	assert.Equal(t, mcp.LoggingLevel("info"), loggingLevel(""))
+}
+
+func TestFollowLogParams(t *testing.T) {
+	log := HostLog{}
+	_, _, err := log.FollowLog(context.Background(), nil, &FollowLogParams{})
+	assert.ErrorContains(t, err, "unit is required")
+	_, _, err = log.FollowLog(context.Background(), nil, &FollowLogParams{Unit: "nginx.service", Pattern: "("})
+	assert.ErrorContains(t, err, "invalid regex")
+	_, _, err = log.FollowLog(context.Background(), nil, &FollowLogParams{Unit: "nginx.service", PriorityMin: "loud"})
+	assert.Error(t, err)
+	_, _, err = log.FollowLog(context.Background(), nil, &FollowLogParams{Unit: "nginx.service", Seconds: -1})
+	assert.Error(t, err)
+
+	// units out of scope are refused before the journal is opened
+	log.Units = &policy.UnitAccess{Denied: []string{"sshd.service"}}
+	_, _, err = log.FollowLog(context.Background(), nil, &FollowLogParams{Unit: "sshd.service"})
+	assert.ErrorContains(t, err, "outside of the units")
+}
+
+func TestFollowNextClosed(t *testing.T) {
+	log := HostLog{}
+	_, _, err := log.followNext("nginx.service", nil, "", time.Now())
+	assert.ErrorContains(t, err, "journal was closed")
+}
@@ -0,0 +1,159 @@
+package journal
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MIME type of the journal export format
+const exportMIMEType = "application/vnd.fdo.journal"
+
+// ValidLogFormats returns the formats of list_log
+func ValidLogFormats() []string {
+	return []string{"json", "text", "export"}
+}
+
+func checkLogFormat(format string) error {
+	if format != "" && !slices.Contains(ValidLogFormats(), format) {
+		return fmt.Errorf("invalid format: %s, valid values are %v", format, ValidLogFormats())
+	}
+	return nil
+}
+
+// rawFormat reports if the entries are rendered from their fields instead
+// of the messages of the result
+func rawFormat(format string) bool {
+	return format == "text" || format == "export"
+}
+
+// entryRecord returns the fields of the entry together with its cursor and
+// timestamps, named like in the export format
+func entryRecord(entry *sdjournal.JournalEntry) map[string]string {
+	record := make(map[string]string, len(entry.Fields)+3)
+	for key, val := range entry.Fields {
+		record[key] = val
+	}
+	record["__CURSOR"] = entry.Cursor
+	record["__REALTIME_TIMESTAMP"] = strconv.FormatUint(entry.RealtimeTimestamp, 10)
+	record["__MONOTONIC_TIMESTAMP"] = strconv.FormatUint(entry.MonotonicTimestamp, 10)
+	return record
+}
+
+// formatText renders the records like the short output of journalctl,
+// continuation lines of a message are indented
+func formatText(res *ListLogResult, records []map[string]string) string {
+	var sb strings.Builder
+	if len(records) == 0 {
+		sb.WriteString("-- No entries --\n")
+	}
+	for _, r := range records {
+		usec, _ := strconv.ParseInt(r["__REALTIME_TIMESTAMP"], 10, 64)
+		ident := cmp.Or(r["SYSLOG_IDENTIFIER"], r["_COMM"], "unknown")
+		if pid := cmp.Or(r["SYSLOG_PID"], r["_PID"]); pid != "" {
+			ident += "[" + pid + "]"
+		}
+		prefix := fmt.Sprintf("%s %s %s: ", time.UnixMicro(usec).Format(time.Stamp), cmp.Or(r["_HOSTNAME"], res.Host), ident)
+		sb.WriteString(prefix)
+		sb.WriteString(strings.ReplaceAll(strings.TrimRight(r["MESSAGE"], "\n"), "\n", "\n"+strings.Repeat(" ", len(prefix))))
+		sb.WriteString("\n")
+	}
+	if res.Hint != "" {
+		fmt.Fprintf(&sb, "-- %s --\n", res.Hint)
+	}
+	if res.Shaping != nil && res.Shaping.Omitted > 0 {
+		fmt.Fprintf(&sb, "-- %d older entries omitted --\n", res.Shaping.Omitted)
+	}
+	if res.LastCursor != "" {
+		// like journalctl --show-cursor
+		fmt.Fprintf(&sb, "-- cursor: %s\n", res.LastCursor)
+	}
+	return sb.String()
+}
+
+// exportable reports if the value can be written as text in the export
+// format, other values are written with their size
+func exportable(val string) bool {
+	return utf8.ValidString(val) && !strings.ContainsFunc(val, unicode.IsControl)
+}
+
+// formatExport serializes the records in the journal export format, the
+// cursor and the timestamps come first and the fields are sorted
+func formatExport(records []map[string]string) []byte {
+	var buf bytes.Buffer
+	for _, r := range records {
+		keys := make([]string, 0, len(r))
+		for key := range r {
+			keys = append(keys, key)
+		}
+		slices.SortFunc(keys, func(a, b string) int {
+			// the address fields start with two underscores
+			return cmp.Or(cmp.Compare(exportOrder(a), exportOrder(b)), strings.Compare(a, b))
+		})
+		for _, key := range keys {
+			val := r[key]
+			if exportable(val) {
+				fmt.Fprintf(&buf, "%s=%s\n", key, val)
+				continue
+			}
+			buf.WriteString(key + "\n")
+			binary.Write(&buf, binary.LittleEndian, uint64(len(val)))
+			buf.WriteString(val + "\n")
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+func exportOrder(key string) int {
+	if i := slices.Index([]string{"__CURSOR", "__REALTIME_TIMESTAMP", "__MONOTONIC_TIMESTAMP"}, key); i >= 0 {
+		return i
+	}
+	return 3
+}
+
+// logContent returns the result in the requested format, the records are
+// aligned to the end as shaping drops the oldest messages
+func logContent(res *ListLogResult, records []map[string]string, format string) (*mcp.CallToolResult, error) {
+	if rawFormat(format) {
+		records = records[max(len(records)-len(res.Messages), 0):]
+	}
+	var content mcp.Content
+	switch format {
+	case "text":
+		content = &mcp.TextContent{Text: formatText(res, records)}
+	case "export":
+		// binary fields can't be passed as text
+		data := formatExport(records)
+		resource := &mcp.ResourceContents{
+			URI:      fmt.Sprintf("journal://%s/entries", res.Host),
+			MIMEType: exportMIMEType,
+		}
+		if utf8.Valid(data) {
+			resource.Text = string(data)
+		} else {
+			resource.Blob = data
+		}
+		content = &mcp.EmbeddedResource{Resource: resource}
+	default:
+		jsonBytes, err := json.Marshal(res)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal response: %w", err)
+		}
+		content = &mcp.TextContent{Text: string(jsonBytes)}
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{content},
+	}, nil
+}
@@ -0,0 +1,65 @@
+package journal
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatText(t *testing.T) {
+	ts := time.Date(2026, 10, 15, 10, 0, 0, 0, time.Local)
+	record := entryRecord(&sdjournal.JournalEntry{
+		Cursor:            "c1",
+		RealtimeTimestamp: uint64(ts.UnixMicro()),
+		Fields: map[string]string{
+			"SYSLOG_IDENTIFIER": "sshd",
+			"_PID":              "42",
+			"MESSAGE":           "first\nsecond",
+		},
+	})
+	res := &ListLogResult{Host: "web1", LastCursor: "c1", Messages: []LogOutput{{}}}
+	prefix := ts.Format(time.Stamp) + " web1 sshd[42]: "
+	assert.Equal(t, prefix+"first\n"+strings.Repeat(" ", len(prefix))+"second\n-- cursor: c1\n", formatText(res, []map[string]string{record}))
+
+	assert.Equal(t, "-- No entries --\n", formatText(&ListLogResult{}, nil))
+}
+
+func TestFormatExport(t *testing.T) {
+	data := formatExport([]map[string]string{{
+		"__CURSOR":              "c1",
+		"__REALTIME_TIMESTAMP":  "100",
+		"__MONOTONIC_TIMESTAMP": "5",
+		"MESSAGE":               "hello",
+		"_PID":                  "42",
+		"COREDUMP_BACKTRACE":    "a\nb",
+	}})
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, 3)
+	assert.Equal(t, "__CURSOR=c1\n__REALTIME_TIMESTAMP=100\n__MONOTONIC_TIMESTAMP=5\n"+
+		"COREDUMP_BACKTRACE\n"+string(size)+"a\nb\n"+
+		"MESSAGE=hello\n_PID=42\n\n", string(data))
+}
+
+func TestLogContent(t *testing.T) {
+	res := &ListLogResult{Host: "web1", Messages: []LogOutput{{Msg: "two"}}}
+	records := []map[string]string{{"MESSAGE": "one"}, {"MESSAGE": "two"}}
+	// the records of messages dropped by shaping are dropped as well
+	result, err := logContent(res, records, "export")
+	require.NoError(t, err)
+	export := result.Content[0].(*mcp.EmbeddedResource).Resource
+	assert.Equal(t, "journal://web1/entries", export.URI)
+	assert.Equal(t, "MESSAGE=two\n\n", export.Text)
+
+	result, err = logContent(res, nil, "")
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, `"message":"two"`)
+
+	assert.Error(t, checkLogFormat("yaml"))
+	assert.NoError(t, checkLogFormat(""))
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
@@ -11,8 +12,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -21,28 +24,88 @@ import (
 	"github.com/coreos/go-systemd/v22/sdjournal"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/lang"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/metrics"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/sdjournalw"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
 )
 
 type HostLog struct {
+	// the journal handle can't be used concurrently
+	mu      sync.Mutex
 	journal *sdjournal.Journal
 	Auth    auth.AuthKeeper
+	// tags the messages with their language, nil disables it
+	Lang *lang.Tagger
+	// the journals of other hosts, used if a host is requested
+	Remote *RemoteLog
+	// the units whose entries list_log returns, nil for all
+	Units *policy.UnitAccess
+	// counts the entries read, nil disables it
+	Metrics *metrics.Metrics
+	// maximal number of entries list_log returns, 0 for no limit
+	MaxEntries int
+	// the journal contains the entries other hosts forwarded
+	forwarded bool
 }
 
-// Close the log and underlying journal
+// Close the log and underlying journal, waits for the calls in flight. The
+// journal is only opened on first use.
 func (log *HostLog) Close() error {
-	return log.journal.Close()
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	var err error
+	if log.journal != nil {
+		err = log.journal.Close()
+		log.journal = nil
+	}
+	if log.Remote != nil {
+		err = errors.Join(err, log.Remote.Close())
+	}
+	return err
+}
+
+// getEntry reads the current entry and counts it with the size of its
+// fields
+func (sj *HostLog) getEntry() (*sdjournal.JournalEntry, error) {
+	entry, err := sj.journal.GetEntry()
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	for k, v := range entry.Fields {
+		size += len(k) + len(v)
+	}
+	sj.Metrics.AddJournalRead(1, size)
+	return entry, nil
 }
 
 type ListLogParams struct {
-	Count     int       `json:"count,omitempty" jsonschema:"Number of log lines to output"`
-	Offset    int       `json:"offset,omitempty" jsonschema:"Number of newest log entries to skip for pagination"`
-	From      time.Time `json:"from,omitempty" jsonschema:"Start time for filtering logs"`
-	To        time.Time `json:"to,omitempty" jsonschema:"End time for filtering logs "`
-	Pattern   string    `json:"pattern,omitempty" jsonschema:"Regular expression pattern to filter log messages or units."`
-	Unit      []string  `json:"unit,omitempty" jsonschema:"Names of the service/unit from which to get the logs. Without an unit name the entries of all units are returned. The first field treated a regular expression if not set otherwise"`
-	ExactUnit bool      `json:"exact_unit,omitempty" jsonschema:"Treat the first name unit as exact idendtifier and not as regular expression"`
-	AllBoots  bool      `json:"allboots,omitempty" jsonschema:"Get the log entries from all boots, not just the active one"`
+	Count        int       `json:"count,omitempty" jsonschema:"Number of log lines to output"`
+	Offset       int       `json:"offset,omitempty" jsonschema:"Number of newest log entries to skip for pagination"`
+	From         time.Time `json:"from,omitempty" jsonschema:"Start time for filtering logs"`
+	To           time.Time `json:"to,omitempty" jsonschema:"End time for filtering logs "`
+	Pattern      string    `json:"pattern,omitempty" jsonschema:"Regular expression pattern to filter log messages or units."`
+	Unit         []string  `json:"unit,omitempty" jsonschema:"Names of the service/unit from which to get the logs. Without an unit name the entries of all units are returned. The first field treated a regular expression if not set otherwise"`
+	ExactUnit    bool      `json:"exact_unit,omitempty" jsonschema:"Treat the first name unit as exact idendtifier and not as regular expression"`
+	AllBoots     bool      `json:"allboots,omitempty" jsonschema:"Get the log entries from all boots, not just the active one"`
+	Since        string    `json:"since,omitempty" jsonschema:"Only entries at or after this time: RFC3339, 'YYYY-MM-DD [HH:MM[:SS]]', now, today, yesterday or relative to now like -2h or '1d ago'. Takes precedence over from."`
+	Until        string    `json:"until,omitempty" jsonschema:"Only entries at or before this time, same formats as since. Takes precedence over to."`
+	Grep         string    `json:"grep,omitempty" jsonschema:"Regular expression the MESSAGE field has to match."`
+	Priority     string    `json:"priority,omitempty" jsonschema:"Only entries with this priority (emerg, alert, crit, err, warning, notice, info, debug or 0-7) or with a priority in a range like emerg..warning."`
+	PriorityMin  string    `json:"priority_min,omitempty" jsonschema:"Only entries with this or a more important priority, like journalctl -p. Use err to get only errors."`
+	Host         string    `json:"host,omitempty" jsonschema:"Hostname of a remote host which forwards its journal to this host, or of a fleet member whose journal gateway is configured. The entries of all its boots are returned."`
+	Machine      string    `json:"machine,omitempty" jsonschema:"Id of a container or virtual machine as reported by list_machines. Only its entries of all boots are returned, which needs its journal linked into the one of the host."`
+	Fields       []string  `json:"fields,omitempty" jsonschema:"Additional journal fields to include in every entry, e.g. _PID, _UID, CODE_FILE, ERRNO or _CMDLINE. Use journal_fields to list the available fields."`
+	Sample       int       `json:"sample,omitempty" jsonschema:"Return only every Nth entry of the time window, starting at its oldest entry, e.g. 100 to summarize a chatty unit. Set to -1 for a random sample of count entries over the whole window. Can't be combined with the cursors."`
+	Format       string    `json:"format,omitempty" jsonschema:"Format of the response: json, text for a compact rendering like journalctl or export for the journal export format with all fields, which log-analysis tools can consume."`
+	Kernel       bool      `json:"kernel,omitempty" jsonschema:"Only the kernel messages, like journalctl -k. Use it to investigate hardware problems and the OOM killer."`
+	AfterCursor  string    `json:"after_cursor,omitempty" jsonschema:"Only the oldest entries after the entry with this cursor, use last_cursor of a previous result to page forward. Offset is ignored."`
+	BeforeCursor string    `json:"before_cursor,omitempty" jsonschema:"Only the newest entries before the entry with this cursor, use first_cursor of a previous result to page backwards through the history."`
+	// reduced in the order documentation, oldest messages
+	MaxTokensHint int `json:"max_tokens_hint,omitempty" jsonschema:"Approximate number of tokens the response may use. The documentation and the oldest messages are omitted to fit and the omissions are reported."`
 }
 
 type LogOutput struct {
@@ -53,6 +116,12 @@ type LogOutput struct {
 	Host       string    `json:"host,omitempty"`
 	Msg        string    `json:"message"`
 	Boot       string    `json:"bootid,omitempty"`
+	Priority   string    `json:"priority,omitempty"`
+	// the additional fields requested with fields, if the entry has them
+	Fields map[string]string `json:"fields,omitempty"`
+	// set if language tagging is enabled
+	Language    string `json:"language,omitempty"`
+	Translation string `json:"translation,omitempty"`
 }
 
 type ManPage struct {
@@ -69,12 +138,27 @@ type ListLogResult struct {
 	Messages      []LogOutput `json:"messages"`
 	Identifier    string      `json:"identifier,omitempty"`
 	UnitName      string      `json:"unit_name,omitempty"`
+	// cursors of the oldest and newest message for the pagination
+	FirstCursor string `json:"first_cursor,omitempty"`
+	LastCursor  string `json:"last_cursor,omitempty"`
+	// number of entries of the window the sample was taken from
+	SampledFrom int           `json:"sampled_from,omitempty"`
+	Shaping     *util.Shaping `json:"shaping,omitempty"`
+	// all fields of the messages, only collected for the text and export
+	// formats
+	records []map[string]string
 }
 
 func CreateListLogsSchema() *jsonschema.Schema {
 	inputSchema, _ := jsonschema.For[ListLogParams](nil)
 	inputSchema.Properties["count"].Default = json.RawMessage(`100`)
 	inputSchema.Properties["offset"].Default = json.RawMessage(`0`)
+	var formats []any
+	for _, f := range ValidLogFormats() {
+		formats = append(formats, f)
+	}
+	inputSchema.Properties["format"].Enum = formats
+	inputSchema.Properties["format"].Default = json.RawMessage(`"json"`)
 	// inputSchema.Properties["pattern"].Default = json.RawMessage(`""`)
 
 	return inputSchema
@@ -99,44 +183,140 @@ func (sj *HostLog) seekAndSkip(count uint64, offset uint64) (uint64, error) {
 	}
 }
 
-func (sj *HostLog) seekByTimeRange(params *ListLogParams) error {
-	var fromTime, toTime time.Time
-	// var err error
-
-	if !params.From.IsZero() {
-		fromTime = params.From
+// seekWindow positions the journal at the count-th newest entry of the time
+// window which matches the filter, or at its first entry if the window has
+// less matching entries
+func (sj *HostLog) seekWindow(ctx context.Context, filter *entryFilter, since, until time.Time, count int) error {
+	if until.IsZero() {
+		if err := sj.journal.SeekTail(); err != nil {
+			return fmt.Errorf("failed to seek to end: %w", err)
+		}
+	} else if err := sj.journal.SeekRealtimeUsec(uint64(until.UnixMicro()) + 1); err != nil {
+		return fmt.Errorf("failed to seek to until time: %w", err)
 	}
-
-	if !params.To.IsZero() {
-		toTime = params.To
+	if _, err := sj.journal.Previous(); err != nil {
+		return fmt.Errorf("failed to read previous entry: %w", err)
+	}
+	if err := seekMatches(ctx, sj, filter, since, count); err != nil {
+		return err
 	}
+	return sj.seekSince(since)
+}
+
+func (sj *HostLog) previous() (uint64, error) {
+	return sj.journal.Previous()
+}
+
+// entryWalker reads the journal backwards
+type entryWalker interface {
+	getEntry() (*sdjournal.JournalEntry, error)
+	previous() (uint64, error)
+}
 
-	// Validate time range
-	if !params.From.IsZero() && !params.To.IsZero() {
-		if fromTime.After(toTime) {
-			return fmt.Errorf("from time cannot be after to time")
+// seekMatches walks back from the current entry until count entries match
+// the filter, the entries get older than since or the journal begins. The
+// filter is applied by reading the entries, so that the matches of grep and
+// pattern aren't limited to the newest count entries.
+func seekMatches(ctx context.Context, w entryWalker, filter *entryFilter, since time.Time, count int) error {
+	matched := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entry, err := w.getEntry()
+		if err != nil {
+			// the journal has no entries
+			return nil
+		}
+		timestamp := time.UnixMicro(int64(entry.RealtimeTimestamp))
+		if !since.IsZero() && timestamp.Before(since) {
+			return nil
+		}
+		if filter.match(entry.Fields, timestamp) {
+			if matched++; matched >= count {
+				return nil
+			}
+		}
+		if ret, err := w.previous(); err != nil {
+			return fmt.Errorf("failed to read previous entry: %w", err)
+		} else if ret == 0 {
+			return nil
 		}
 	}
+}
 
-	if !params.To.IsZero() {
-		toMicros := uint64(toTime.UnixNano() / 1000)
-		if err := sj.journal.SeekRealtimeUsec(toMicros); err != nil {
-			return fmt.Errorf("failed to seek to time range: %w", err)
+// seekSince moves to the first entry at since if the current entry is older
+func (sj *HostLog) seekSince(since time.Time) error {
+	if since.IsZero() {
+		return nil
+	}
+	if entry, err := sj.getEntry(); err == nil && entry.RealtimeTimestamp >= uint64(since.UnixMicro()) {
+		return nil
+	}
+	if err := sj.journal.SeekRealtimeUsec(uint64(since.UnixMicro())); err != nil {
+		return fmt.Errorf("failed to seek to since time: %w", err)
+	}
+	if _, err := sj.journal.Next(); err != nil {
+		return fmt.Errorf("failed to read next entry: %w", err)
+	}
+	return nil
+}
+
+// seekBeforeCursor positions the journal count entries before the entry
+// with the cursor and returns the newest entry before it, which is nil if
+// there is none
+func (sj *HostLog) seekBeforeCursor(cursor string, since time.Time, count uint64) (*sdjournal.JournalEntry, error) {
+	if err := sj.journal.SeekCursor(cursor); err != nil {
+		return nil, fmt.Errorf("invalid before_cursor: %w", err)
+	}
+	// lands on the entry of the cursor if it matches the filters, else
+	// on the entry before it
+	if ret, err := sj.journal.Previous(); err != nil {
+		return nil, fmt.Errorf("failed to read previous entry: %w", err)
+	} else if ret == 0 {
+		return nil, nil
+	}
+	if sj.journal.TestCursor(cursor) == nil {
+		if ret, err := sj.journal.Previous(); err != nil {
+			return nil, fmt.Errorf("failed to read previous entry: %w", err)
+		} else if ret == 0 {
+			return nil, nil
 		}
-	} else {
-		if err := sj.journal.SeekTail(); err != nil {
-			return fmt.Errorf("failed to seek to end: %w", err)
+	}
+	last, err := sj.getEntry()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get log entry: %w", err)
+	}
+	if !since.IsZero() && last.RealtimeTimestamp < uint64(since.UnixMicro()) {
+		return nil, nil
+	}
+	if count > 1 {
+		if _, err := sj.journal.PreviousSkip(count - 1); err != nil {
+			return nil, fmt.Errorf("failed to move back entries: %w", err)
 		}
 	}
+	return last, sj.seekSince(since)
+}
 
-	// If we have pagination offset, apply it after time seeking
-	if params.Offset > 0 {
-		if _, err := sj.journal.PreviousSkip(uint64(params.Offset)); err != nil {
-			return fmt.Errorf("failed to skip offset entries: %w", err)
+// seekAfterCursor positions the journal at the first entry after the entry
+// with the cursor, it returns false if there is none
+func (sj *HostLog) seekAfterCursor(cursor string, since time.Time) (bool, error) {
+	if err := sj.journal.SeekCursor(cursor); err != nil {
+		return false, fmt.Errorf("invalid after_cursor: %w", err)
+	}
+	ret, err := sj.journal.Next()
+	if err != nil {
+		return false, fmt.Errorf("failed to read next entry: %w", err)
+	}
+	if ret > 0 && sj.journal.TestCursor(cursor) == nil {
+		if ret, err = sj.journal.Next(); err != nil {
+			return false, fmt.Errorf("failed to read next entry: %w", err)
 		}
 	}
-
-	return nil
+	if ret == 0 {
+		return false, nil
+	}
+	return true, sj.seekSince(since)
 }
 
 func (sj *HostLog) isJournalGroupMember() bool {
@@ -178,7 +358,7 @@ func (sj *HostLog) isJournalGroupMember() bool {
 // This isn't an ideal solution, but I couldn't think of a better one
 func (sj *HostLog) self_init(ctx context.Context) (allowed bool, err error) {
 	if sj.journal != nil {
-		return sj.Auth.IsReadAuthorized(ctx)
+		return sj.Auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.JournalReadAction))
 	} else if os.Geteuid() == 0 || sj.isJournalGroupMember() {
 		// running as root or in journal group, ask via oauth2 is read is authorized, if yes
 		// and journal isn't opened, open it
@@ -236,7 +416,7 @@ func (sj *HostLog) self_init(ctx context.Context) (allowed bool, err error) {
 	}
 	// if journal can be read don't do any more auth calling
 	if !sj.isJournalGroupMember() {
-		allowed, err = sj.Auth.IsReadAuthorized(ctx)
+		allowed, err = sj.Auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.JournalReadAction))
 		if err != nil || !allowed {
 			return allowed, err
 		}
@@ -246,6 +426,23 @@ func (sj *HostLog) self_init(ctx context.Context) (allowed bool, err error) {
 
 // get the lat log entries for a given unit, else just the last messages
 func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params *ListLogParams) (*mcp.CallToolResult, any, error) {
+	if err := checkLogFormat(params.Format); err != nil {
+		return nil, nil, err
+	}
+	if err := checkUnits(sj.Units, params); err != nil {
+		return nil, nil, err
+	}
+	if params.Machine != "" && !machineIdRegex.MatchString(params.Machine) {
+		return nil, nil, fmt.Errorf("invalid machine id: %s, it must be 32 hexadecimal characters", params.Machine)
+	}
+	if params.Host != "" && !sj.forwarded {
+		if local, _ := os.Hostname(); params.Host != local {
+			return sj.Remote.ListLog(ctx, req, params)
+		}
+		params.Host = ""
+	}
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
 	// always init the host log via self initialization, not via init or
 	allowed, err := sj.self_init(ctx)
 	if err != nil {
@@ -254,6 +451,20 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 	if !allowed {
 		return nil, nil, fmt.Errorf("calling method was canceled by user")
 	}
+	since, until, err := timeRange(params, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	levels, err := priorityLevels(params.Priority, params.PriorityMin)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the unit is matched by the journal
+	filter, err := newEntryFilter(&ListLogParams{Pattern: params.Pattern, Grep: params.Grep}, since, until)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter.units = sj.Units
 	sj.journal.FlushMatches()
 	if len(params.Unit) > 0 {
 		firstUnit := params.Unit[0]
@@ -321,24 +532,93 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 			}
 		}
 	}
-	if !params.AllBoots {
+	if params.Host != "" {
+		// the current boot of a remote host isn't known
+		if err := sj.journal.AddMatch("_HOSTNAME=" + params.Host); err != nil {
+			return nil, nil, fmt.Errorf("failed to add host filter: %w", err)
+		}
+	} else if params.Machine != "" {
+		// the boots of the machine aren't the ones of the host
+		if err := sj.journal.AddMatch("_MACHINE_ID=" + params.Machine); err != nil {
+			return nil, nil, fmt.Errorf("failed to add machine filter: %w", err)
+		}
+	} else if !params.AllBoots {
 		if bootId, err := sj.journal.GetBootID(); err != nil {
 			return nil, nil, fmt.Errorf("failed to get boot id: %s", err)
 		} else if err := sj.journal.AddMatch("_BOOT_ID=" + bootId); err != nil {
 			return nil, nil, fmt.Errorf("failed to add boot filter: %w", err)
 		}
 	}
+	// matches of the same field are ORed
+	for _, level := range levels {
+		if err := sj.journal.AddMatch("PRIORITY=" + strconv.Itoa(level)); err != nil {
+			return nil, nil, fmt.Errorf("failed to add priority filter: %w", err)
+		}
+	}
+	if params.Kernel {
+		if err := sj.journal.AddMatch("_TRANSPORT=kernel"); err != nil {
+			return nil, nil, fmt.Errorf("failed to add kernel filter: %w", err)
+		}
+	}
 
-	// Handle time-based filtering
-	if !params.From.IsZero() || !params.To.IsZero() {
-		err = sj.seekByTimeRange(params)
-		if err != nil {
+	maxCount := params.Count
+	if maxCount <= 0 {
+		maxCount = 100
+	}
+	if sj.MaxEntries > 0 {
+		maxCount = min(maxCount, sj.MaxEntries)
+	}
+	// with after_cursor the window is read forward from the cursor
+	forward := params.AfterCursor != ""
+	// the newest entry before before_cursor
+	var last *sdjournal.JournalEntry
+	var sample *sampler
+	if params.Sample < 0 || params.Sample > 1 {
+		sample = newSampler(params.Sample, maxCount)
+	}
+	found := true
+	switch {
+	case sample != nil:
+		if forward || params.BeforeCursor != "" {
+			return nil, nil, fmt.Errorf("sample can't be combined with after_cursor or before_cursor")
+		}
+		// the whole window is read
+		if err := sj.journal.SeekHead(); err != nil {
+			return nil, nil, fmt.Errorf("failed to seek to start: %w", err)
+		}
+		if _, err := sj.journal.Next(); err != nil {
+			return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
+		}
+		if err := sj.seekSince(since); err != nil {
 			return nil, nil, err
 		}
-	} else {
-		// Use original pagination logic when no time filters
-		_, err = sj.seekAndSkip(uint64(params.Count), uint64(params.Offset))
-		if err != nil {
+	case forward:
+		if params.BeforeCursor != "" {
+			// only to find the end of the window
+			if last, err = sj.seekBeforeCursor(params.BeforeCursor, time.Time{}, 1); err != nil {
+				return nil, nil, err
+			}
+			found = last != nil
+		}
+		if found {
+			if found, err = sj.seekAfterCursor(params.AfterCursor, since); err != nil {
+				return nil, nil, err
+			}
+		}
+	case params.BeforeCursor != "":
+		if last, err = sj.seekBeforeCursor(params.BeforeCursor, since, 1); err != nil {
+			return nil, nil, err
+		}
+		if found = last != nil; found {
+			if err := seekMatches(ctx, sj, filter, since, maxCount+params.Offset); err != nil {
+				return nil, nil, err
+			}
+			if err := sj.seekSince(since); err != nil {
+				return nil, nil, err
+			}
+		}
+	default:
+		if err := sj.seekWindow(ctx, filter, since, until, maxCount+params.Offset); err != nil {
 			return nil, nil, err
 		}
 	}
@@ -350,76 +630,72 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 	uniqUnitNameStr := ""
 	uniqExeName := make(map[string]bool)
 	host, _ := os.Hostname()
-
-	var regexPattern *regexp.Regexp
-	if params.Pattern != "" {
-		var err error
-		regexPattern, err = regexp.Compile(params.Pattern)
-		if err != nil {
-			return nil, nil, fmt.Errorf("invalid regex pattern: %w", err)
-		}
+	if params.Host != "" {
+		host = params.Host
 	}
 
-	collectedCount := 0
-	maxCount := params.Count
-	if maxCount <= 0 {
-		maxCount = 100
-	}
-
-	for {
-		entry, err := sj.journal.GetEntry()
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to get log entry for %v", params.Unit)
+	// read the window up to its end and keep the newest entries without
+	// the offset ones, after a cursor the oldest entries are kept
+	var entries []*sdjournal.JournalEntry
+	for found {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
 		}
-
-		timestamp := time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
-
-		if !params.To.IsZero() && timestamp.Before(params.To) {
-
-			ret, err := sj.journal.Next()
-			if err != nil {
-				return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
-			}
-			if ret == 0 {
+		entry, err := sj.getEntry()
+		if err != nil {
+			if len(entries) == 0 {
+				// nothing matches the filters
 				break
 			}
-			continue
+			return nil, nil, fmt.Errorf("failed to get log entry for %v", params.Unit)
 		}
-
-		if !params.From.IsZero() && timestamp.After(params.From) {
-			ret, err := sj.journal.Next()
-			if err != nil {
-				return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
-			}
-			if ret == 0 {
-				break
-			}
-			continue
+		timestamp := time.UnixMicro(int64(entry.RealtimeTimestamp))
+		if !until.IsZero() && timestamp.After(until) {
+			break
 		}
-
-		if regexPattern != nil {
-			var messages strings.Builder
-			for _, v := range entry.Fields {
-				messages.WriteString(v)
-			}
-			if !regexPattern.MatchString(messages.String()) {
-				ret, err := sj.journal.Next()
-				if err != nil {
-					return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
-				}
-				if ret == 0 {
-					break
-				}
-				continue
+		if last != nil && last.RealtimeTimestamp < entry.RealtimeTimestamp {
+			break
+		}
+		if filter.match(entry.Fields, timestamp) {
+			if sample != nil {
+				sample.add(entry)
+			} else {
+				entries = append(entries, entry)
 			}
 		}
-
+		if (last != nil && entry.Cursor == last.Cursor) || (forward && len(entries) == maxCount) || (sample != nil && sample.full()) {
+			break
+		}
+		ret, err := sj.journal.Next()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
+		}
+		if ret == 0 {
+			break
+		}
+	}
+	if sample != nil {
+		entries = sample.entries()
+	} else if !forward {
+		end := max(len(entries)-params.Offset, 0)
+		entries = entries[max(end-maxCount, 0):end]
+	}
+	var cursors []string
+	var records []map[string]string
+	for _, entry := range entries {
+		cursors = append(cursors, entry.Cursor)
+		if rawFormat(params.Format) {
+			records = append(records, entryRecord(entry))
+		}
+		timestamp := time.UnixMicro(int64(entry.RealtimeTimestamp))
 		structEntr := LogOutput{
 			Identifier: entry.Fields["SYSLOG_IDENTIFIER"],
 			UnitName:   entry.Fields["_SYSTEMD_UNIT"],
 			ExeName:    entry.Fields["_EXE"],
 			Time:       timestamp,
 			Msg:        entry.Fields["MESSAGE"],
+			Priority:   priorityName(entry.Fields["PRIORITY"]),
+			Fields:     extraFields(entry.Fields, params.Fields),
 		}
 		if _, ok := uniqIdentifiers[entry.Fields["SYSLOG_IDENTIFIER"]]; !ok {
 			uniqIdentifiers[entry.Fields["SYSLOG_IDENTIFIER"]] = true
@@ -434,7 +710,7 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 				uniqExeName[entry.Fields["_EXE"]] = true
 			}
 		}
-		if params.AllBoots {
+		if params.AllBoots || params.Host != "" || params.Machine != "" {
 			structEntr.Boot = entry.Fields["_BOOT_ID"]
 		}
 		if host == entry.Fields["_HOSTNAME"] {
@@ -444,26 +720,22 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 			structEntr.Identifier = fmt.Sprintf("%s:%s", entry.Fields["_SYSTEMD_UNIT"], entry.Fields["_SYSTEMD_USER_UNIT"])
 		}
 		messages = append(messages, structEntr)
-		collectedCount++
-
-		if collectedCount >= maxCount {
-			break
-		}
-
-		ret, err := sj.journal.Next()
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
-		}
-		if ret == 0 {
-			break
-		}
 	}
 
+	for i := range messages {
+		messages[i].Language, messages[i].Translation = sj.Lang.Tag(ctx, messages[i].Msg)
+	}
 	res := ListLogResult{
 		Host:       host,
 		NrMessages: len(messages),
 		Messages:   messages,
 	}
+	if sample != nil {
+		res.SampledFrom = sample.seen
+		if sample.full() {
+			res.Hint = "The sample doesn't cover the whole window, use a bigger sample or a shorter window."
+		}
+	}
 	if len(uniqIdentifiers) == 1 {
 		res.Identifier = uniqIdentifiersStr
 		for i := range messages {
@@ -543,17 +815,224 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 			}
 		}
 	}
+	if params.MaxTokensHint > 0 {
+		res.Shaping = shapeLog(&res, params.MaxTokensHint)
+	}
+	res.setCursors(cursors)
 
-	jsonBytes, err := json.Marshal(res)
+	result, err := logContent(&res, records, params.Format)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+		return nil, nil, err
+	}
+	return result, res, nil
+}
+
+// setCursors sets the cursors of the first and last message, the cursors
+// are aligned to the end as shaping drops the oldest messages
+func (res *ListLogResult) setCursors(cursors []string) {
+	if len(res.Messages) == 0 || len(cursors) < len(res.Messages) {
+		return
+	}
+	cursors = cursors[len(cursors)-len(res.Messages):]
+	res.FirstCursor, res.LastCursor = cursors[0], cursors[len(cursors)-1]
+}
+
+// shapeLog drops the documentation and then the oldest messages until the
+// result fits into maxTokens
+func shapeLog(res *ListLogResult, maxTokens int) *util.Shaping {
+	shaping := &util.Shaping{MaxTokensHint: maxTokens}
+	if len(res.Documentation) > 0 && !shaping.Fits(res) {
+		res.Documentation = nil
+		shaping.Reduce("documentation")
+	}
+	for !shaping.Fits(res) && len(res.Messages) > 0 {
+		keep := shaping.Shrink(len(res.Messages))
+		shaping.Omitted += len(res.Messages) - keep
+		res.Messages = res.Messages[len(res.Messages)-keep:]
+	}
+	if len(shaping.Reduced) == 0 && shaping.Omitted == 0 {
+		return nil
+	}
+	res.NrMessages = len(res.Messages)
+	return shaping
+}
+
+// UnitLog returns the last count messages of the given unit from the current
+// boot in a compact, journalctl like, format. Messages systemd itself logs
+// about the unit (e.g. "Failed with result 'exit-code'") are included.
+func (sj *HostLog) UnitLog(ctx context.Context, unit string, count int) ([]string, error) {
+	if err := sj.Units.Check(unit); err != nil {
+		return nil, err
+	}
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	allowed, err := sj.self_init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("calling method was canceled by user")
+	}
+	if count <= 0 {
+		return nil, nil
+	}
+	sj.journal.FlushMatches()
+	if err := sj.journal.AddMatch("_SYSTEMD_UNIT=" + unit); err != nil {
+		return nil, fmt.Errorf("failed to add unit filter: %w", err)
+	}
+	if err := sj.journal.AddDisjunction(); err != nil {
+		return nil, err
+	}
+	if err := sj.journal.AddMatch("UNIT=" + unit); err != nil {
+		return nil, fmt.Errorf("failed to add unit filter: %w", err)
+	}
+	if err := sj.journal.AddConjunction(); err != nil {
+		return nil, err
+	}
+	if bootId, err := sj.journal.GetBootID(); err != nil {
+		return nil, fmt.Errorf("failed to get boot id: %s", err)
+	} else if err := sj.journal.AddMatch("_BOOT_ID=" + bootId); err != nil {
+		return nil, fmt.Errorf("failed to add boot filter: %w", err)
+	}
+	if _, err := sj.seekAndSkip(uint64(count), 0); err != nil {
+		return nil, err
 	}
 
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: string(jsonBytes),
-			},
-		},
-	}, nil, nil
+	var lines []string
+	for len(lines) < count {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		entry, err := sj.getEntry()
+		if err != nil {
+			// no entries for this unit
+			break
+		}
+		lines = append(lines, formatShort(entry))
+		ret, err := sj.journal.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read next entry: %w", err)
+		}
+		if ret == 0 {
+			break
+		}
+	}
+	return lines, nil
+}
+
+// formatShort renders an entry like the short output of journalctl
+func formatShort(entry *sdjournal.JournalEntry) string {
+	timestamp := time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
+	ident := entry.Fields["SYSLOG_IDENTIFIER"]
+	if ident == "" {
+		ident = entry.Fields["_COMM"]
+	}
+	if pid := entry.Fields["_PID"]; pid != "" {
+		ident = fmt.Sprintf("%s[%s]", ident, pid)
+	}
+	return fmt.Sprintf("%s %s: %s", timestamp.Format(time.Stamp), ident, entry.Fields["MESSAGE"])
+}
+
+// UnitJobResults returns the results of the last count jobs of the unit in
+// the current boot as logged by the service manager, oldest first.
+func (sj *HostLog) UnitJobResults(ctx context.Context, unit string, count int) ([]string, error) {
+	if err := sj.Units.Check(unit); err != nil {
+		return nil, err
+	}
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	allowed, err := sj.self_init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("calling method was canceled by user")
+	}
+	if count <= 0 {
+		return nil, nil
+	}
+	sj.journal.FlushMatches()
+	if err := sj.journal.AddMatch("UNIT=" + unit); err != nil {
+		return nil, fmt.Errorf("failed to add unit filter: %w", err)
+	}
+	if err := sj.journal.AddMatch("_PID=1"); err != nil {
+		return nil, fmt.Errorf("failed to add pid filter: %w", err)
+	}
+	if bootId, err := sj.journal.GetBootID(); err != nil {
+		return nil, fmt.Errorf("failed to get boot id: %s", err)
+	} else if err := sj.journal.AddMatch("_BOOT_ID=" + bootId); err != nil {
+		return nil, fmt.Errorf("failed to add boot filter: %w", err)
+	}
+	if err := sj.journal.SeekTail(); err != nil {
+		return nil, fmt.Errorf("failed to seek to end: %w", err)
+	}
+	var results []string
+	for len(results) < count {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ret, err := sj.journal.Previous()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read previous entry: %w", err)
+		}
+		if ret == 0 {
+			break
+		}
+		entry, err := sj.getEntry()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get log entry: %w", err)
+		}
+		result := entry.Fields["JOB_RESULT"]
+		if result == "" {
+			continue
+		}
+		timestamp := time.UnixMicro(int64(entry.RealtimeTimestamp))
+		results = append(results, fmt.Sprintf("%s %s job: %s", timestamp.Format(time.Stamp), entry.Fields["JOB_TYPE"], result))
+	}
+	slices.Reverse(results)
+	return results, nil
+}
+
+// Entries returns the fields of the newest count entries matching all
+// matches, the oldest first, together with their timestamp as
+// __REALTIME_TIMESTAMP
+func (sj *HostLog) Entries(ctx context.Context, matches []string, count int) ([]map[string]string, error) {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	allowed, err := sj.self_init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("calling method was canceled by user")
+	}
+	sj.journal.FlushMatches()
+	for _, match := range matches {
+		if err := sj.journal.AddMatch(match); err != nil {
+			return nil, fmt.Errorf("failed to add filter %s: %w", match, err)
+		}
+	}
+	if err := sj.journal.SeekTail(); err != nil {
+		return nil, fmt.Errorf("failed to seek to end: %w", err)
+	}
+	var entries []map[string]string
+	for len(entries) < count {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ret, err := sj.journal.Previous()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read previous entry: %w", err)
+		}
+		if ret == 0 {
+			break
+		}
+		entry, err := sj.getEntry()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get log entry: %w", err)
+		}
+		entries = append(entries, entryRecord(entry))
+	}
+	slices.Reverse(entries)
+	return entries, nil
 }
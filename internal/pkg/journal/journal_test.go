@@ -1,9 +1,15 @@
 package journal
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateListLogsSchema(t *testing.T) {
@@ -13,3 +19,93 @@ func TestCreateListLogsSchema(t *testing.T) {
 	assert.Contains(t, schema.Properties, "offset")
 	assert.Contains(t, schema.Properties, "unit")
 }
+
+func TestShapeLog(t *testing.T) {
+	var messages []LogOutput
+	var cursors []string
+	for i := range 50 {
+		messages = append(messages, LogOutput{Msg: fmt.Sprintf("message %d with some text", i)})
+		cursors = append(cursors, fmt.Sprintf("c%d", i))
+	}
+	res := ListLogResult{
+		NrMessages:    len(messages),
+		Messages:      messages,
+		Documentation: []ManPage{{Name: "sshd", Section: 8, Description: "OpenSSH daemon"}},
+	}
+	shaping := shapeLog(&res, 300)
+	assert.NotNil(t, shaping)
+	assert.Nil(t, res.Documentation)
+	assert.Equal(t, []string{"documentation"}, shaping.Reduced)
+	assert.LessOrEqual(t, shaping.EstimatedTokens, 300)
+	assert.Equal(t, 50-len(res.Messages), shaping.Omitted)
+	assert.Equal(t, len(res.Messages), res.NrMessages)
+	// the newest messages are kept
+	assert.Equal(t, "message 49 with some text", res.Messages[len(res.Messages)-1].Msg)
+	// the cursors are the ones of the kept messages
+	res.setCursors(cursors)
+	assert.Equal(t, fmt.Sprintf("c%d", 50-len(res.Messages)), res.FirstCursor)
+	assert.Equal(t, "c49", res.LastCursor)
+
+	small := ListLogResult{Messages: messages[:1]}
+	assert.Nil(t, shapeLog(&small, 300))
+}
+
+func TestUnitLogScope(t *testing.T) {
+	log := HostLog{Units: &policy.UnitAccess{Denied: []string{"sshd.service"}}}
+	_, err := log.UnitLog(context.Background(), "sshd.service", 10)
+	assert.ErrorContains(t, err, "outside of the units")
+	_, err = log.UnitJobResults(context.Background(), "sshd.service", 10)
+	assert.ErrorContains(t, err, "outside of the units")
+}
+
+// sliceWalker walks back through entries from pos
+type sliceWalker struct {
+	entries []*sdjournal.JournalEntry
+	pos     int
+}
+
+func (w *sliceWalker) getEntry() (*sdjournal.JournalEntry, error) {
+	if len(w.entries) == 0 {
+		return nil, fmt.Errorf("no entry")
+	}
+	return w.entries[w.pos], nil
+}
+
+func (w *sliceWalker) previous() (uint64, error) {
+	if w.pos == 0 {
+		return 0, nil
+	}
+	w.pos--
+	return 1, nil
+}
+
+func TestSeekMatches(t *testing.T) {
+	start := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	var entries []*sdjournal.JournalEntry
+	for i := range 50 {
+		msg := fmt.Sprintf("request %d served", i)
+		if i == 3 || i == 7 {
+			msg = fmt.Sprintf("request %d failed", i)
+		}
+		entries = append(entries, &sdjournal.JournalEntry{
+			RealtimeTimestamp: uint64(start.Add(time.Duration(i) * time.Minute).UnixMicro()),
+			Fields:            map[string]string{"MESSAGE": msg},
+		})
+	}
+	filter, err := newEntryFilter(&ListLogParams{Grep: "failed"}, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	seek := func(since time.Time, count int) int {
+		w := &sliceWalker{entries: entries, pos: len(entries) - 1}
+		require.NoError(t, seekMatches(context.Background(), w, filter, since, count))
+		return w.pos
+	}
+
+	// the matches are far older than the newest count entries
+	assert.Equal(t, 7, seek(time.Time{}, 1))
+	assert.Equal(t, 3, seek(time.Time{}, 2))
+	assert.Equal(t, 0, seek(time.Time{}, 10), "less matches than count")
+	// the walk stops at the first entry before since
+	assert.Equal(t, 4, seek(start.Add(5*time.Minute), 2))
+
+	assert.NoError(t, seekMatches(context.Background(), &sliceWalker{}, filter, time.Time{}, 1))
+}
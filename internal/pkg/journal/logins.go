@@ -0,0 +1,293 @@
+package journal
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type LoginFailuresParams struct {
+	Since string `json:"since,omitempty" jsonschema:"Start of the window, same formats as since of list_log."`
+	Until string `json:"until,omitempty" jsonschema:"End of the window, same formats as until of list_log."`
+	Top   int    `json:"top,omitempty" jsonschema:"Number of sources and users with the most failures to report."`
+}
+
+const (
+	DefaultLoginWindow = "-24h"
+	DefaultTopLogins   = 20
+	// upper bound of entries read, so that a brute force attack doesn't
+	// make the tool hang
+	maxLoginEntries = 200000
+)
+
+// identifiers of the programs which log authentication attempts
+var loginIdentifiers = []string{"sshd", "sshd-session", "sshd-auth", "login", "su", "sudo", "fail2ban-server"}
+
+type loginKind int
+
+const (
+	loginFailed loginKind = iota
+	loginAccepted
+	loginBanned
+)
+
+// messages of sshd, pam and fail2ban, the submatches are named user and ip.
+// sshd logs every attempt itself, so its "Invalid user" and pam messages
+// aren't counted to not count an attempt twice.
+var loginMessages = []struct {
+	kind loginKind
+	sshd bool
+	re   *regexp.Regexp
+}{
+	{loginFailed, true, regexp.MustCompile(`^Failed \S+ for (?:invalid user )?(?P<user>\S*) from (?P<ip>\S+) port`)},
+	{loginFailed, true, regexp.MustCompile(`^maximum authentication attempts exceeded for (?:invalid user )?(?P<user>\S*) from (?P<ip>\S+)`)},
+	{loginAccepted, true, regexp.MustCompile(`^Accepted \S+ for (?P<user>\S+) from (?P<ip>\S+) port`)},
+	{loginFailed, false, regexp.MustCompile(`^pam_\w+\([^)]*\): authentication failure;.*\brhost=(?P<ip>\S*)\s+user=(?P<user>\S+)`)},
+	{loginFailed, false, regexp.MustCompile(`^pam_\w+\([^)]*\): authentication failure;.*\brhost=(?P<ip>\S*)`)},
+	{loginBanned, false, regexp.MustCompile(`\[\S+\] Ban (?P<ip>\S+)`)},
+}
+
+type loginEvent struct {
+	kind loginKind
+	time time.Time
+	user string
+	ip   string
+}
+
+// parseLoginMessage classifies a message of the given identifier, the
+// source is empty for local logins
+func parseLoginMessage(ident, msg string) (loginEvent, bool) {
+	sshd := strings.HasPrefix(ident, "sshd")
+	for _, m := range loginMessages {
+		if m.sshd != sshd {
+			continue
+		}
+		match := m.re.FindStringSubmatch(msg)
+		if match == nil {
+			continue
+		}
+		ev := loginEvent{kind: m.kind}
+		if i := m.re.SubexpIndex("user"); i > 0 {
+			ev.user = match[i]
+		}
+		if i := m.re.SubexpIndex("ip"); i > 0 {
+			ev.ip = match[i]
+		}
+		return ev, true
+	}
+	return loginEvent{}, false
+}
+
+type LoginSource struct {
+	Source    string    `json:"source"`
+	Failures  int       `json:"failures"`
+	Accepted  int       `json:"accepted,omitempty"`
+	Banned    bool      `json:"banned,omitempty"`
+	Users     []string  `json:"users,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+type LoginUser struct {
+	User      string    `json:"user"`
+	Failures  int       `json:"failures"`
+	Sources   int       `json:"sources"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+type LoginFailuresResult struct {
+	Host     string        `json:"host"`
+	Since    time.Time     `json:"since"`
+	Until    time.Time     `json:"until,omitzero"`
+	Failures int           `json:"failures"`
+	Accepted int           `json:"accepted"`
+	Sources  []LoginSource `json:"sources"`
+	Users    []LoginUser   `json:"users"`
+	// the window had more entries than were read
+	Truncated bool   `json:"truncated,omitempty"`
+	Hint      string `json:"hint,omitempty"`
+}
+
+func CreateLoginFailuresSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[LoginFailuresParams](nil)
+	inputSchema.Properties["since"].Default = json.RawMessage(strconv.Quote(DefaultLoginWindow))
+	inputSchema.Properties["top"].Default = json.RawMessage(strconv.Itoa(DefaultTopLogins))
+	return inputSchema
+}
+
+func seen(first, last *time.Time, t time.Time) {
+	if first.IsZero() || t.Before(*first) {
+		*first = t
+	}
+	if t.After(*last) {
+		*last = t
+	}
+}
+
+// summarizeLogins counts the failures per source and per user, the sources
+// and users with the most failures come first. Local failures have the
+// source "local".
+func summarizeLogins(events []loginEvent, top int, res *LoginFailuresResult) {
+	sources := make(map[string]*LoginSource)
+	users := make(map[string]*LoginUser)
+	userSources := make(map[string]map[string]bool)
+	for _, ev := range events {
+		ip := ev.ip
+		if ip == "" {
+			ip = "local"
+		}
+		src, ok := sources[ip]
+		if !ok {
+			src = &LoginSource{Source: ip}
+			sources[ip] = src
+		}
+		switch ev.kind {
+		case loginBanned:
+			src.Banned = true
+			continue
+		case loginAccepted:
+			src.Accepted++
+			res.Accepted++
+			continue
+		}
+		res.Failures++
+		src.Failures++
+		seen(&src.FirstSeen, &src.LastSeen, ev.time)
+		if ev.user == "" {
+			continue
+		}
+		if !slices.Contains(src.Users, ev.user) {
+			src.Users = append(src.Users, ev.user)
+		}
+		user, ok := users[ev.user]
+		if !ok {
+			user = &LoginUser{User: ev.user}
+			users[ev.user] = user
+			userSources[ev.user] = make(map[string]bool)
+		}
+		user.Failures++
+		userSources[ev.user][ip] = true
+		user.Sources = len(userSources[ev.user])
+		seen(&user.FirstSeen, &user.LastSeen, ev.time)
+	}
+
+	res.Sources = []LoginSource{}
+	for _, src := range sources {
+		// sources which only logged in successfully aren't of interest
+		if src.Failures > 0 {
+			slices.Sort(src.Users)
+			res.Sources = append(res.Sources, *src)
+		}
+	}
+	slices.SortFunc(res.Sources, func(a, b LoginSource) int {
+		return cmp.Or(cmp.Compare(b.Failures, a.Failures), cmp.Compare(a.Source, b.Source))
+	})
+	if len(res.Sources) > top {
+		res.Sources = res.Sources[:top]
+	}
+	res.Users = []LoginUser{}
+	for _, user := range users {
+		res.Users = append(res.Users, *user)
+	}
+	slices.SortFunc(res.Users, func(a, b LoginUser) int {
+		return cmp.Or(cmp.Compare(b.Failures, a.Failures), cmp.Compare(a.User, b.User))
+	})
+	if len(res.Users) > top {
+		res.Users = res.Users[:top]
+	}
+}
+
+// LoginFailures summarizes the failed logins of sshd and pam (login, su,
+// sudo) in the window by source address and by user, sources which were
+// banned by fail2ban and successful logins from failing sources are marked.
+func (sj *HostLog) LoginFailures(ctx context.Context, req *mcp.CallToolRequest, params *LoginFailuresParams) (*mcp.CallToolResult, any, error) {
+	if params.Since == "" {
+		params.Since = DefaultLoginWindow
+	}
+	since, until, err := timeRange(&ListLogParams{Since: params.Since, Until: params.Until}, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	top := params.Top
+	if top <= 0 {
+		top = DefaultTopLogins
+	}
+
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	allowed, err := sj.self_init(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	sj.journal.FlushMatches()
+	for _, ident := range loginIdentifiers {
+		if err := sj.journal.AddMatch("SYSLOG_IDENTIFIER=" + ident); err != nil {
+			return nil, nil, fmt.Errorf("failed to add identifier filter: %w", err)
+		}
+	}
+	if err := sj.journal.SeekRealtimeUsec(uint64(since.UnixMicro())); err != nil {
+		return nil, nil, fmt.Errorf("failed to seek to since time: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	res := LoginFailuresResult{Host: host, Since: since, Until: until}
+	var events []loginEvent
+	for read := 0; ; read++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		if read == maxLoginEntries {
+			res.Truncated = true
+			break
+		}
+		ret, err := sj.journal.Next()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
+		}
+		if ret == 0 {
+			break
+		}
+		entry, err := sj.getEntry()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get log entry: %w", err)
+		}
+		timestamp := time.UnixMicro(int64(entry.RealtimeTimestamp))
+		if !until.IsZero() && timestamp.After(until) {
+			break
+		}
+		if ev, ok := parseLoginMessage(entry.Fields["SYSLOG_IDENTIFIER"], entry.Fields["MESSAGE"]); ok {
+			ev.time = timestamp
+			events = append(events, ev)
+		}
+	}
+	summarizeLogins(events, top, &res)
+	if res.Truncated {
+		res.Hint = fmt.Sprintf("Only the first %d entries of the window were read, use a shorter window.", maxLoginEntries)
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,66 @@
+package journal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLoginMessage(t *testing.T) {
+	tests := []struct {
+		ident string
+		msg   string
+		want  loginEvent
+		ok    bool
+	}{
+		{"sshd-session", "Failed password for invalid user admin from 203.0.113.7 port 4242 ssh2", loginEvent{kind: loginFailed, user: "admin", ip: "203.0.113.7"}, true},
+		{"sshd", "Failed publickey for root from 2001:db8::1 port 22 ssh2: RSA SHA256:abc", loginEvent{kind: loginFailed, user: "root", ip: "2001:db8::1"}, true},
+		{"sshd", "Accepted publickey for alice from 198.51.100.1 port 5000 ssh2", loginEvent{kind: loginAccepted, user: "alice", ip: "198.51.100.1"}, true},
+		{"sshd", "maximum authentication attempts exceeded for root from 203.0.113.7 port 4242 ssh2 [preauth]", loginEvent{kind: loginFailed, user: "root", ip: "203.0.113.7"}, true},
+		// counted by the Failed message of sshd
+		{"sshd", "Invalid user admin from 203.0.113.7 port 4242", loginEvent{}, false},
+		{"sshd", "pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=203.0.113.7  user=root", loginEvent{}, false},
+		{"su", "pam_unix(su:auth): authentication failure; logname=bob uid=1000 euid=0 tty=/dev/pts/0 ruser=bob rhost=  user=root", loginEvent{kind: loginFailed, user: "root"}, true},
+		{"login", "pam_unix(login:auth): authentication failure; logname=LOGIN uid=0 euid=0 tty=tty1 ruser= rhost=", loginEvent{kind: loginFailed}, true},
+		{"fail2ban-server", "[sshd] Ban 203.0.113.7", loginEvent{kind: loginBanned, ip: "203.0.113.7"}, true},
+		{"sshd", "Server listening on 0.0.0.0 port 22.", loginEvent{}, false},
+	}
+	for _, tt := range tests {
+		ev, ok := parseLoginMessage(tt.ident, tt.msg)
+		assert.Equal(t, tt.ok, ok, tt.msg)
+		assert.Equal(t, tt.want, ev, tt.msg)
+	}
+}
+
+func TestSummarizeLogins(t *testing.T) {
+	start := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	events := []loginEvent{
+		{kind: loginFailed, time: start, user: "root", ip: "203.0.113.7"},
+		{kind: loginFailed, time: start.Add(time.Minute), user: "admin", ip: "203.0.113.7"},
+		{kind: loginFailed, time: start.Add(2 * time.Minute), user: "root", ip: "203.0.113.7"},
+		{kind: loginBanned, time: start.Add(3 * time.Minute), ip: "203.0.113.7"},
+		{kind: loginFailed, time: start.Add(4 * time.Minute), user: "alice", ip: "198.51.100.1"},
+		{kind: loginAccepted, time: start.Add(5 * time.Minute), user: "alice", ip: "198.51.100.1"},
+		{kind: loginAccepted, time: start.Add(6 * time.Minute), user: "bob", ip: "192.0.2.1"},
+		{kind: loginFailed, time: start.Add(7 * time.Minute), user: "root"},
+	}
+	var res LoginFailuresResult
+	summarizeLogins(events, 2, &res)
+	assert.Equal(t, 5, res.Failures)
+	assert.Equal(t, 2, res.Accepted)
+	require.Len(t, res.Sources, 2)
+	assert.Equal(t, LoginSource{Source: "203.0.113.7", Failures: 3, Banned: true, Users: []string{"admin", "root"},
+		FirstSeen: start, LastSeen: start.Add(2 * time.Minute)}, res.Sources[0])
+	assert.Equal(t, "198.51.100.1", res.Sources[1].Source)
+	assert.Equal(t, 1, res.Sources[1].Accepted)
+	require.Len(t, res.Users, 2)
+	assert.Equal(t, LoginUser{User: "root", Failures: 3, Sources: 2, FirstSeen: start, LastSeen: start.Add(7 * time.Minute)}, res.Users[0])
+	assert.Equal(t, "admin", res.Users[1].User)
+
+	res = LoginFailuresResult{}
+	summarizeLogins(nil, 10, &res)
+	assert.NotNil(t, res.Sources)
+	assert.NotNil(t, res.Users)
+}
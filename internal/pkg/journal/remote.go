@@ -0,0 +1,396 @@
+package journal
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/lang"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/metrics"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+)
+
+// number of entries read from the gateway if they have to be filtered
+// locally, as gatewayd only supports exact matches
+const gatewayScanLimit = 10000
+
+// RemoteLog reads the journals which other hosts forward to this host, either
+// from a systemd-journal-gatewayd endpoint or from the directory
+// systemd-journal-remote writes to.
+type RemoteLog struct {
+	// URL of systemd-journal-gatewayd, e.g. http://loghost:19531, takes
+	// precedence over Dir
+	Gateway string
+	// URLs of the systemd-journal-gatewayd of single hosts by host name,
+	// checked before Gateway and Dir
+	Members map[string]string
+	// directory with the journals of systemd-journal-remote
+	Dir    string
+	Client *http.Client
+	Auth   auth.AuthKeeper
+	Lang   *lang.Tagger
+	// the units whose entries are returned, nil for all
+	Units *policy.UnitAccess
+	// counts the entries read from the journals of systemd-journal-remote
+	Metrics *metrics.Metrics
+	// maximal number of entries list_log returns, 0 for no limit
+	MaxEntries int
+
+	mu  sync.Mutex
+	dir *HostLog
+}
+
+// ListLog returns the entries of the remote host params.Host. Only the
+// exact unit, the host, the priority and the kernel transport are matched by
+// gatewayd, the other filters are applied on the received entries.
+func (r *RemoteLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params *ListLogParams) (*mcp.CallToolResult, any, error) {
+	if r == nil || (r.Gateway == "" && r.Dir == "" && len(r.Members) == 0) {
+		return nil, nil, fmt.Errorf("no remote journals are configured, can't read the log of %s", params.Host)
+	}
+	gateway, member := r.Members[params.Host]
+	if !member {
+		gateway = r.Gateway
+	}
+	if gateway == "" {
+		if r.Dir == "" {
+			return nil, nil, fmt.Errorf("no journal is configured for %s", params.Host)
+		}
+		dir, err := r.openDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		return dir.ListLog(ctx, req, params)
+	}
+	if allowed, err := r.Auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.JournalReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	res, err := r.gatewayLog(ctx, gateway, member, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := logContent(res, res.records, params.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, res, nil
+}
+
+// openDir opens the journal files of systemd-journal-remote on first use
+func (r *RemoteLog) openDir() (*HostLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dir != nil {
+		return r.dir, nil
+	}
+	if _, err := os.Stat(r.Dir); err != nil {
+		return nil, fmt.Errorf("no remote journals: %w", err)
+	}
+	j, err := sdjournal.NewJournalFromDir(r.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open remote journals in %s: %w", r.Dir, err)
+	}
+	r.dir = &HostLog{journal: j, Auth: r.Auth, Lang: r.Lang, Units: r.Units, Metrics: r.Metrics, MaxEntries: r.MaxEntries, forwarded: true}
+	return r.dir, nil
+}
+
+// Close the journal files of systemd-journal-remote if they were opened
+func (r *RemoteLog) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dir == nil {
+		return nil
+	}
+	err := r.dir.Close()
+	r.dir = nil
+	return err
+}
+
+// entryFilter applies the filters of the parameters which the journal
+// matches can't express
+type entryFilter struct {
+	unit    *regexp.Regexp
+	pattern *regexp.Regexp
+	grep    *regexp.Regexp
+	from    time.Time
+	to      time.Time
+	// entries of other units are dropped
+	units *policy.UnitAccess
+}
+
+// checkUnits refuses exact units outside of the accessible ones, the
+// entries of regular expressions are filtered instead
+func checkUnits(units *policy.UnitAccess, params *ListLogParams) error {
+	if !params.ExactUnit {
+		return nil
+	}
+	for _, unit := range params.Unit {
+		if err := units.Check(unit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newEntryFilter(params *ListLogParams, since, until time.Time) (*entryFilter, error) {
+	f := &entryFilter{from: since, to: until}
+	var err error
+	if len(params.Unit) > 0 && !params.ExactUnit {
+		if f.unit, err = regexp.Compile(params.Unit[0]); err != nil {
+			return nil, fmt.Errorf("invalid regular expression in unit: %w", err)
+		}
+	}
+	if params.Pattern != "" {
+		if f.pattern, err = regexp.Compile(params.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid regex pattern: %w", err)
+		}
+	}
+	if params.Grep != "" {
+		if f.grep, err = regexp.Compile(params.Grep); err != nil {
+			return nil, fmt.Errorf("invalid regex in grep: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// local reports if entries have to be filtered after receiving them
+func (f *entryFilter) local() bool {
+	return f.unit != nil || f.units != nil || f.pattern != nil || f.grep != nil || !f.from.IsZero() || !f.to.IsZero()
+}
+
+func (f *entryFilter) match(fields map[string]string, timestamp time.Time) bool {
+	if !f.from.IsZero() && timestamp.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && timestamp.After(f.to) {
+		return false
+	}
+	if f.unit != nil && !f.unit.MatchString(fields["SYSLOG_IDENTIFIER"]) &&
+		!f.unit.MatchString(fields["_SYSTEMD_UNIT"]) && !f.unit.MatchString(fields["_SYSTEMD_USER_UNIT"]) {
+		return false
+	}
+	if f.units != nil && !f.units.Permits(cmp.Or(fields["_SYSTEMD_UNIT"], fields["_SYSTEMD_USER_UNIT"])) {
+		return false
+	}
+	if f.grep != nil && !f.grep.MatchString(fields["MESSAGE"]) {
+		return false
+	}
+	if f.pattern != nil {
+		var all strings.Builder
+		for _, v := range fields {
+			all.WriteString(v)
+		}
+		if !f.pattern.MatchString(all.String()) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseMembers parses the gatewayd URLs of single hosts, given as URL or as
+// host=URL if the host name differs from the one of the URL
+func ParseMembers(urls []string) (map[string]string, error) {
+	members := make(map[string]string, len(urls))
+	for _, member := range urls {
+		host, gateway, named := strings.Cut(member, "=")
+		if !named {
+			gateway = member
+		}
+		u, err := url.Parse(gateway)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid journal gateway URL %q", gateway)
+		}
+		if !named {
+			host = u.Hostname()
+		}
+		members[host] = gateway
+	}
+	return members, nil
+}
+
+// gatewayLog requests the newest entries of the host from gatewayd. The
+// gatewayd of a member only serves its own journal, so its entries aren't
+// matched by host name and, like for the local host, only the current boot
+// is read without allboots.
+func (r *RemoteLog) gatewayLog(ctx context.Context, gateway string, member bool, params *ListLogParams) (*ListLogResult, error) {
+	since, until, err := timeRange(params, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if params.Sample != 0 && params.Sample != 1 {
+		return nil, fmt.Errorf("sample isn't supported for hosts read from the journal gateway")
+	}
+	levels, err := priorityLevels(params.Priority, params.PriorityMin)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newEntryFilter(params, since, until)
+	if err != nil {
+		return nil, err
+	}
+	filter.units = r.Units
+	count := params.Count
+	if count <= 0 {
+		count = 100
+	}
+	if r.MaxEntries > 0 {
+		count = min(count, r.MaxEntries)
+	}
+	query := url.Values{}
+	if !member {
+		query.Set("_HOSTNAME", params.Host)
+	} else if !params.AllBoots {
+		query.Set("boot", "")
+	}
+	if len(params.Unit) > 0 && params.ExactUnit {
+		query.Set("_SYSTEMD_UNIT", params.Unit[0])
+	}
+	for _, level := range levels {
+		query.Add("PRIORITY", strconv.Itoa(level))
+	}
+	if params.Kernel {
+		query.Set("_TRANSPORT", "kernel")
+	}
+	window := count + params.Offset
+	if filter.local() {
+		window = gatewayScanLimit
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(gateway, "/")+"/entries?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gateway address: %w", err)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	// the entries of a range start at the cursor and skip the given number
+	// of entries, before_cursor is only used as end with after_cursor
+	forward := params.AfterCursor != ""
+	switch {
+	case forward:
+		httpReq.Header.Set("Range", fmt.Sprintf("entries=%s:1:%d", params.AfterCursor, window))
+	case params.BeforeCursor != "":
+		httpReq.Header.Set("Range", fmt.Sprintf("entries=%s:-%d:%d", params.BeforeCursor, window, window))
+	default:
+		httpReq.Header.Set("Range", fmt.Sprintf("entries=:-%d:%d", window, window))
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query journal gateway: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("journal gateway returned %s", resp.Status)
+	}
+
+	var messages []LogOutput
+	var cursors []string
+	var records []map[string]string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		fields, err := gatewayFields(line)
+		if err != nil {
+			return nil, err
+		}
+		cursor := fields["__CURSOR"]
+		if params.BeforeCursor != "" && cursor == params.BeforeCursor {
+			break
+		}
+		if cursor != "" && cursor == params.AfterCursor {
+			continue
+		}
+		usec, _ := strconv.ParseInt(fields["__REALTIME_TIMESTAMP"], 10, 64)
+		timestamp := time.UnixMicro(usec)
+		if !filter.match(fields, timestamp) {
+			continue
+		}
+		entry := LogOutput{
+			Time:       timestamp,
+			Identifier: fields["SYSLOG_IDENTIFIER"],
+			UnitName:   fields["_SYSTEMD_UNIT"],
+			ExeName:    fields["_EXE"],
+			Msg:        fields["MESSAGE"],
+			Boot:       fields["_BOOT_ID"],
+			Priority:   priorityName(fields["PRIORITY"]),
+			Fields:     extraFields(fields, params.Fields),
+		}
+		if entry.Identifier == "" {
+			entry.Identifier = fmt.Sprintf("%s:%s", fields["_SYSTEMD_UNIT"], fields["_SYSTEMD_USER_UNIT"])
+		}
+		messages = append(messages, entry)
+		cursors = append(cursors, cursor)
+		if rawFormat(params.Format) {
+			records = append(records, fields)
+		}
+		if forward && len(messages) == count {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read from journal gateway: %w", err)
+	}
+
+	// the newest entries are at the end, skip offset of them and keep count
+	if !forward {
+		end := max(len(messages)-params.Offset, 0)
+		messages, cursors = messages[max(end-count, 0):end], cursors[max(end-count, 0):end]
+		if records != nil {
+			records = records[max(end-count, 0):end]
+		}
+	}
+	for i := range messages {
+		messages[i].Language, messages[i].Translation = r.Lang.Tag(ctx, messages[i].Msg)
+	}
+	res := &ListLogResult{
+		Host:       params.Host,
+		NrMessages: len(messages),
+		Messages:   messages,
+		records:    records,
+	}
+	if messages == nil {
+		res.Messages = []LogOutput{}
+	}
+	if params.MaxTokensHint > 0 {
+		res.Shaping = shapeLog(res, params.MaxTokensHint)
+	}
+	res.setCursors(cursors)
+	return res, nil
+}
+
+// gatewayFields decodes an entry of the JSON output of gatewayd, binary
+// fields are sent as array of bytes and are skipped
+func gatewayFields(line []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return nil, fmt.Errorf("invalid entry from journal gateway: %w", err)
+	}
+	fields := make(map[string]string, len(raw))
+	for key, val := range raw {
+		var s string
+		if json.Unmarshal(val, &s) == nil {
+			fields[key] = s
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,152 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatewayFields(t *testing.T) {
+	fields, err := gatewayFields([]byte(`{"MESSAGE":"hello","_PID":"12","BINARY":[1,2,3]}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"MESSAGE": "hello", "_PID": "12"}, fields)
+
+	_, err = gatewayFields([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestParseMembers(t *testing.T) {
+	members, err := ParseMembers([]string{"http://web1:19531", "db1=https://10.0.0.5:19531/"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"web1": "http://web1:19531", "db1": "https://10.0.0.5:19531/"}, members)
+
+	_, err = ParseMembers([]string{"web1:19531"})
+	assert.Error(t, err)
+	_, err = ParseMembers([]string{"db1=ftp://db1"})
+	assert.Error(t, err)
+}
+
+func TestRemoteListLog(t *testing.T) {
+	start := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	var gotQuery, gotRange string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery, gotRange = r.URL.RawQuery, r.Header.Get("Range")
+		assert.Equal(t, "/entries", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+		// cursor ranges are emulated for the cursors c0 to c4
+		first, last := 0, 5
+		var cursor, skip, num int
+		if _, err := fmt.Sscanf(gotRange, "entries=c%d:%d:%d", &cursor, &skip, &num); err == nil {
+			first = max(cursor+skip, 0)
+			last = min(first+num, 5)
+		}
+		for i := first; i < last; i++ {
+			unit := "nginx.service"
+			if i%2 == 1 {
+				unit = "sshd.service"
+			}
+			fmt.Fprintf(w, `{"__CURSOR":"c%d","__REALTIME_TIMESTAMP":"%d","_HOSTNAME":"web1","_SYSTEMD_UNIT":"%s","SYSLOG_IDENTIFIER":"%s","MESSAGE":"message %d","_BOOT_ID":"b1","PRIORITY":"6"}`+"\n",
+				i, start.Add(time.Duration(i)*time.Minute).UnixMicro(), unit, unit[:len(unit)-8], i)
+		}
+	}))
+	defer gateway.Close()
+
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	log := HostLog{Auth: auth, Remote: &RemoteLog{Gateway: gateway.URL, Auth: auth}}
+	listLog := func(params *ListLogParams) ListLogResult {
+		res, _, err := log.ListLog(context.Background(), nil, params)
+		require.NoError(t, err)
+		var result ListLogResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		return result
+	}
+
+	result := listLog(&ListLogParams{Host: "web1", Unit: []string{"nginx.service"}, ExactUnit: true, Count: 2})
+	assert.Equal(t, "_HOSTNAME=web1&_SYSTEMD_UNIT=nginx.service", gotQuery)
+	assert.Equal(t, "entries=:-2:2", gotRange)
+	assert.Equal(t, "web1", result.Host)
+	require.Len(t, result.Messages, 2)
+	assert.Equal(t, "message 3", result.Messages[0].Msg)
+	assert.Equal(t, "b1", result.Messages[1].Boot)
+	assert.Equal(t, "info", result.Messages[1].Priority)
+	assert.Equal(t, "c3", result.FirstCursor)
+	assert.Equal(t, "c4", result.LastCursor)
+
+	// regular expressions and time ranges are filtered locally
+	result = listLog(&ListLogParams{Host: "web1", Unit: []string{"^ssh"}, From: start.Add(2 * time.Minute), Count: 10})
+	assert.Equal(t, "_HOSTNAME=web1", gotQuery)
+	assert.Equal(t, fmt.Sprintf("entries=:-%d:%d", gatewayScanLimit, gatewayScanLimit), gotRange)
+	require.Len(t, result.Messages, 1)
+	assert.Equal(t, "message 3", result.Messages[0].Msg)
+
+	listLog(&ListLogParams{Host: "web1", PriorityMin: "crit"})
+	assert.Equal(t, "PRIORITY=0&PRIORITY=1&PRIORITY=2&_HOSTNAME=web1", gotQuery)
+
+	result = listLog(&ListLogParams{Host: "web1", Count: 1, Fields: []string{"_BOOT_ID", "ERRNO"}})
+	require.Len(t, result.Messages, 1)
+	assert.Equal(t, map[string]string{"_BOOT_ID": "b1"}, result.Messages[0].Fields)
+
+	listLog(&ListLogParams{Host: "web1", Kernel: true})
+	assert.Equal(t, "_HOSTNAME=web1&_TRANSPORT=kernel", gotQuery)
+
+	result = listLog(&ListLogParams{Host: "web1", Count: 2, Offset: 1})
+	require.Len(t, result.Messages, 2)
+	assert.Equal(t, "message 2", result.Messages[0].Msg)
+
+	// walk backwards and forward with the cursors
+	result = listLog(&ListLogParams{Host: "web1", Count: 2, BeforeCursor: "c3"})
+	assert.Equal(t, "entries=c3:-2:2", gotRange)
+	require.Len(t, result.Messages, 2)
+	assert.Equal(t, "message 1", result.Messages[0].Msg)
+	assert.Equal(t, "c1", result.FirstCursor)
+	assert.Equal(t, "c2", result.LastCursor)
+
+	result = listLog(&ListLogParams{Host: "web1", Count: 2, AfterCursor: "c1"})
+	assert.Equal(t, "entries=c1:1:2", gotRange)
+	require.Len(t, result.Messages, 2)
+	assert.Equal(t, "message 2", result.Messages[0].Msg)
+	assert.Equal(t, "c3", result.LastCursor)
+
+	res, _, err := log.ListLog(context.Background(), nil, &ListLogParams{Host: "web1", Count: 2, Format: "text"})
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(3*time.Minute).Local().Format(time.Stamp)+" web1 sshd: message 3\n"+
+		start.Add(4*time.Minute).Local().Format(time.Stamp)+" web1 nginx: message 4\n-- cursor: c4\n", res.Content[0].(*mcp.TextContent).Text)
+
+	res, _, err = log.ListLog(context.Background(), nil, &ListLogParams{Host: "web1", Count: 1, Format: "export"})
+	require.NoError(t, err)
+	export := res.Content[0].(*mcp.EmbeddedResource).Resource
+	assert.Equal(t, "application/vnd.fdo.journal", export.MIMEType)
+	assert.Contains(t, export.Text, "__CURSOR=c4\n__REALTIME_TIMESTAMP=")
+	assert.Contains(t, export.Text, "MESSAGE=message 4\n")
+
+	_, _, err = log.ListLog(context.Background(), nil, &ListLogParams{Host: "web1", Format: "yaml"})
+	assert.Error(t, err)
+	_, _, err = log.ListLog(context.Background(), nil, &ListLogParams{Host: "web1", From: start.Add(time.Hour), To: start})
+	assert.Error(t, err)
+	_, _, err = log.ListLog(context.Background(), nil, &ListLogParams{Host: "web1", Sample: 10})
+	assert.ErrorContains(t, err, "sample")
+
+	// the gatewayd of a member serves only its own journal
+	log.Remote = &RemoteLog{Members: map[string]string{"web1": gateway.URL}, Auth: auth}
+	result = listLog(&ListLogParams{Host: "web1", Count: 2})
+	assert.Equal(t, "boot=", gotQuery)
+	require.Len(t, result.Messages, 2)
+	assert.Equal(t, "message 4", result.Messages[1].Msg)
+	listLog(&ListLogParams{Host: "web1", AllBoots: true, Kernel: true})
+	assert.Equal(t, "_TRANSPORT=kernel", gotQuery)
+	_, _, err = log.ListLog(context.Background(), nil, &ListLogParams{Host: "web2"})
+	assert.ErrorContains(t, err, "no journal is configured for web2")
+
+	log.Remote = nil
+	_, _, err = log.ListLog(context.Background(), nil, &ListLogParams{Host: "web1"})
+	assert.ErrorContains(t, err, "no remote journals")
+}
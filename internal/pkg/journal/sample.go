@@ -0,0 +1,61 @@
+package journal
+
+import (
+	"math/rand/v2"
+	"slices"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+)
+
+// upper bound of entries read for a sample, so that a flood doesn't make
+// the tool hang
+const maxSampleEntries = 1000000
+
+// sampler keeps every Nth entry or, with a negative every, a uniform random
+// sample of size entries (reservoir sampling)
+type sampler struct {
+	every int
+	size  int
+	seen  int
+	kept  []*sdjournal.JournalEntry
+	rand  *rand.Rand
+}
+
+func newSampler(every, size int) *sampler {
+	return &sampler{every: every, size: size, rand: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))}
+}
+
+func (s *sampler) add(entry *sdjournal.JournalEntry) {
+	s.seen++
+	switch {
+	case s.every > 0:
+		if (s.seen-1)%s.every == 0 {
+			s.kept = append(s.kept, entry)
+		}
+	case len(s.kept) < s.size:
+		s.kept = append(s.kept, entry)
+	default:
+		if i := s.rand.IntN(s.seen); i < s.size {
+			s.kept[i] = entry
+		}
+	}
+}
+
+// full reports if no further entries are needed
+func (s *sampler) full() bool {
+	return s.seen >= maxSampleEntries || (s.every > 0 && len(s.kept) >= s.size)
+}
+
+// entries returns the kept entries in the order of the journal
+func (s *sampler) entries() []*sdjournal.JournalEntry {
+	slices.SortStableFunc(s.kept, func(a, b *sdjournal.JournalEntry) int {
+		switch {
+		case a.RealtimeTimestamp < b.RealtimeTimestamp:
+			return -1
+		case a.RealtimeTimestamp > b.RealtimeTimestamp:
+			return 1
+		}
+		return 0
+	})
+	return s.kept
+}
@@ -0,0 +1,49 @@
+package journal
+
+import (
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleEntries(n int) []*sdjournal.JournalEntry {
+	entries := make([]*sdjournal.JournalEntry, n)
+	for i := range entries {
+		entries[i] = &sdjournal.JournalEntry{RealtimeTimestamp: uint64(i)}
+	}
+	return entries
+}
+
+func TestSamplerEvery(t *testing.T) {
+	s := newSampler(10, 100)
+	for _, e := range sampleEntries(35) {
+		s.add(e)
+	}
+	kept := s.entries()
+	require.Len(t, kept, 4)
+	assert.Equal(t, uint64(0), kept[0].RealtimeTimestamp)
+	assert.Equal(t, uint64(30), kept[3].RealtimeTimestamp)
+	assert.False(t, s.full())
+
+	s = newSampler(2, 3)
+	for _, e := range sampleEntries(6) {
+		s.add(e)
+	}
+	assert.True(t, s.full())
+}
+
+func TestSamplerReservoir(t *testing.T) {
+	s := newSampler(-1, 10)
+	for _, e := range sampleEntries(1000) {
+		s.add(e)
+	}
+	assert.False(t, s.full())
+	assert.Equal(t, 1000, s.seen)
+	kept := s.entries()
+	require.Len(t, kept, 10)
+	for i := 1; i < len(kept); i++ {
+		assert.Less(t, kept[i-1].RealtimeTimestamp, kept[i].RealtimeTimestamp)
+	}
+}
@@ -0,0 +1,215 @@
+package journal
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type LogStatsParams struct {
+	Since string `json:"since,omitempty" jsonschema:"Start of the window, same formats as since of list_log."`
+	Until string `json:"until,omitempty" jsonschema:"End of the window, same formats as until of list_log."`
+	Top   int    `json:"top,omitempty" jsonschema:"Number of units with the most messages to report."`
+}
+
+const (
+	DefaultStatsWindow = "-1h"
+	DefaultTopTalkers  = 20
+	// upper bound of entries read, so that a flood doesn't make the tool
+	// hang
+	maxStatsEntries = 1000000
+)
+
+type UnitStats struct {
+	// the unit, or the syslog identifier for messages outside of units
+	Unit     string `json:"unit"`
+	Messages int    `json:"messages"`
+	// size of the message texts
+	Bytes int `json:"bytes"`
+	// number of messages with the priority err or more important
+	Errors int `json:"errors,omitempty"`
+}
+
+type PriorityStats struct {
+	Priority string `json:"priority"`
+	Messages int    `json:"messages"`
+}
+
+type LogStatsResult struct {
+	Host       string          `json:"host"`
+	Since      time.Time       `json:"since"`
+	Until      time.Time       `json:"until,omitzero"`
+	Messages   int             `json:"messages"`
+	PerMinute  float64         `json:"per_minute"`
+	Units      []UnitStats     `json:"units"`
+	Priorities []PriorityStats `json:"priorities"`
+	// disk space of all journal files, not only of the window
+	DiskUsage uint64 `json:"disk_usage_bytes"`
+	// the window had more entries than were read
+	Truncated bool   `json:"truncated,omitempty"`
+	Hint      string `json:"hint,omitempty"`
+}
+
+func CreateLogStatsSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[LogStatsParams](nil)
+	inputSchema.Properties["since"].Default = json.RawMessage(strconv.Quote(DefaultStatsWindow))
+	inputSchema.Properties["top"].Default = json.RawMessage(strconv.Itoa(DefaultTopTalkers))
+	return inputSchema
+}
+
+// logCounter aggregates the entries of the window
+type logCounter struct {
+	total      int
+	units      map[string]*UnitStats
+	priorities [8]int
+}
+
+func newLogCounter() *logCounter {
+	return &logCounter{units: make(map[string]*UnitStats)}
+}
+
+// add counts an entry, fields which the entry doesn't have are empty
+func (c *logCounter) add(unit, ident, priority string, size int) {
+	c.total++
+	if unit == "" {
+		unit = ident
+	}
+	if unit == "" {
+		unit = "unknown"
+	}
+	stats, ok := c.units[unit]
+	if !ok {
+		stats = &UnitStats{Unit: unit}
+		c.units[unit] = stats
+	}
+	stats.Messages++
+	stats.Bytes += size
+	if level, err := strconv.Atoi(priority); err == nil && level >= 0 && level < len(c.priorities) {
+		c.priorities[level]++
+		if level <= 3 {
+			stats.Errors++
+		}
+	}
+}
+
+// summarize fills the counts of the result, the units with the most
+// messages come first
+func (c *logCounter) summarize(top int, res *LogStatsResult) {
+	res.Messages = c.total
+	res.Units = []UnitStats{}
+	for _, stats := range c.units {
+		res.Units = append(res.Units, *stats)
+	}
+	slices.SortFunc(res.Units, func(a, b UnitStats) int {
+		return cmp.Or(cmp.Compare(b.Messages, a.Messages), cmp.Compare(a.Unit, b.Unit))
+	})
+	if len(res.Units) > top {
+		res.Units = res.Units[:top]
+	}
+	res.Priorities = []PriorityStats{}
+	for level, count := range c.priorities {
+		if count > 0 {
+			res.Priorities = append(res.Priorities, PriorityStats{Priority: priorityNames[level], Messages: count})
+		}
+	}
+	end := res.Until
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if minutes := end.Sub(res.Since).Minutes(); minutes > 0 {
+		res.PerMinute = float64(c.total) / minutes
+	}
+}
+
+// LogStats counts the messages of a time window per unit and per priority
+// and reports the disk usage of the journal, so that the units flooding the
+// log can be found without reading the entries.
+func (sj *HostLog) LogStats(ctx context.Context, req *mcp.CallToolRequest, params *LogStatsParams) (*mcp.CallToolResult, any, error) {
+	if params.Since == "" {
+		params.Since = DefaultStatsWindow
+	}
+	since, until, err := timeRange(&ListLogParams{Since: params.Since, Until: params.Until}, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	top := params.Top
+	if top <= 0 {
+		top = DefaultTopTalkers
+	}
+
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	allowed, err := sj.self_init(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	sj.journal.FlushMatches()
+	if err := sj.journal.SeekRealtimeUsec(uint64(since.UnixMicro())); err != nil {
+		return nil, nil, fmt.Errorf("failed to seek to since time: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	res := LogStatsResult{Host: host, Since: since, Until: until}
+	if res.DiskUsage, err = sj.journal.GetUsage(); err != nil {
+		return nil, nil, err
+	}
+	counter := newLogCounter()
+	for read := 0; ; read++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		if read == maxStatsEntries {
+			res.Truncated = true
+			break
+		}
+		ret, err := sj.journal.Next()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
+		}
+		if ret == 0 {
+			break
+		}
+		if !until.IsZero() {
+			usec, err := sj.journal.GetRealtimeUsec()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get entry time: %w", err)
+			}
+			if usec > uint64(until.UnixMicro()) {
+				break
+			}
+		}
+		// only the counted fields are read, missing fields are empty
+		unit, _ := sj.journal.GetDataValue("_SYSTEMD_UNIT")
+		ident, _ := sj.journal.GetDataValue("SYSLOG_IDENTIFIER")
+		priority, _ := sj.journal.GetDataValue("PRIORITY")
+		msg, _ := sj.journal.GetDataValue("MESSAGE")
+		counter.add(unit, ident, priority, len(msg))
+	}
+	counter.summarize(top, &res)
+	if res.Truncated {
+		res.Hint = fmt.Sprintf("Only the first %d entries of the window were counted, use a shorter window.", maxStatsEntries)
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,31 @@
+package journal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogCounter(t *testing.T) {
+	counter := newLogCounter()
+	for range 3 {
+		counter.add("nginx.service", "nginx", "3", 10)
+	}
+	counter.add("nginx.service", "nginx", "6", 5)
+	counter.add("", "kernel", "4", 20)
+	counter.add("", "", "", 1)
+	counter.add("sshd.service", "sshd", "6", 2)
+
+	since := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	res := LogStatsResult{Since: since, Until: since.Add(time.Minute)}
+	counter.summarize(2, &res)
+	assert.Equal(t, 7, res.Messages)
+	assert.Equal(t, 7.0, res.PerMinute)
+	require.Len(t, res.Units, 2)
+	assert.Equal(t, UnitStats{Unit: "nginx.service", Messages: 4, Bytes: 35, Errors: 3}, res.Units[0])
+	// ties are sorted by name
+	assert.Equal(t, "kernel", res.Units[1].Unit)
+	assert.Equal(t, []PriorityStats{{"err", 3}, {"warning", 1}, {"info", 2}}, res.Priorities)
+}
@@ -0,0 +1,177 @@
+// Package lang tags texts like unit descriptions and log messages with
+// their language and optionally passes them through an external
+// translation command.
+package lang
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// texts with less matching words are not tagged
+const minWordHits = 2
+
+// frequent words which are rare in the other languages
+var stopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "for", "with", "not", "was", "are", "from", "this", "be", "failed", "started", "stopped"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "mit", "für", "von", "ein", "eine", "wurde", "auf", "den", "des", "dienst"},
+	"fr": {"le", "la", "les", "et", "est", "pas", "des", "une", "du", "pour", "avec", "dans", "été", "au", "service", "sur"},
+	"es": {"el", "los", "las", "y", "es", "no", "una", "del", "para", "con", "por", "se", "ha", "al", "servicio", "está"},
+	"it": {"il", "lo", "gli", "e", "è", "non", "della", "per", "con", "una", "del", "che", "sono", "stato", "servizio", "di"},
+	"pt": {"o", "os", "as", "e", "é", "não", "uma", "do", "da", "para", "com", "em", "foi", "serviço", "ao", "que"},
+	"nl": {"de", "het", "een", "en", "is", "niet", "van", "voor", "met", "op", "dat", "wordt", "zijn", "dienst", "naar", "bij"},
+}
+
+// scripts which are (nearly) used by a single language
+var scripts = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+}
+
+// Detect returns the ISO 639-1 code of the language of text or an empty
+// string if it can't be determined. The detection is a heuristic based on
+// the script and on frequent words, good enough for descriptions and log
+// messages but not for single words.
+func Detect(text string) string {
+	letters := 0
+	counts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				counts[s.lang]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	// kana is mixed with Han in Japanese
+	if counts["ja"] > 0 {
+		return "ja"
+	}
+	for _, s := range scripts {
+		if counts[s.lang]*2 > letters {
+			return s.lang
+		}
+	}
+
+	hits := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, word := range words {
+		for lang, list := range stopWords {
+			for _, stop := range list {
+				if word == stop {
+					hits[lang]++
+				}
+			}
+		}
+	}
+	best, bestHits, secondHits := "", 0, 0
+	for lang, n := range hits {
+		switch {
+		case n > bestHits || n == bestHits && lang < best:
+			secondHits = max(secondHits, bestHits)
+			best, bestHits = lang, n
+		case n > secondHits:
+			secondHits = n
+		}
+	}
+	if bestHits < minWordHits || bestHits == secondHits {
+		return ""
+	}
+	return best
+}
+
+// Tagger tags texts with their language and translates them with an
+// external command. A nil Tagger doesn't tag anything.
+type Tagger struct {
+	// Command gets the text on stdin and has to print the translation,
+	// the languages are passed in SOURCE_LANG and TARGET_LANG
+	Command []string
+	// Target is the language the texts are translated to
+	Target  string
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+func NewTagger(command []string, target string) *Tagger {
+	if target == "" {
+		target = "en"
+	}
+	return &Tagger{
+		Command: command,
+		Target:  target,
+		Timeout: 10 * time.Second,
+		cache:   make(map[string]string),
+	}
+}
+
+// Tag returns the language of the text and the translation if a command is
+// configured and the language isn't the target language
+func (t *Tagger) Tag(ctx context.Context, text string) (lang, translation string) {
+	if t == nil {
+		return "", ""
+	}
+	lang = Detect(text)
+	if lang == "" || lang == t.Target || len(t.Command) == 0 {
+		return lang, ""
+	}
+	translation, err := t.translate(ctx, text, lang)
+	if err != nil {
+		slog.Warn("translation failed", "command", t.Command[0], "error", err)
+		return lang, ""
+	}
+	return lang, translation
+}
+
+func (t *Tagger) translate(ctx context.Context, text, lang string) (string, error) {
+	t.mu.Lock()
+	cached, ok := t.cache[lang+"\x00"+text]
+	t.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, t.Command[0], t.Command[1:]...)
+	cmd.Env = append(os.Environ(), "SOURCE_LANG="+lang, "TARGET_LANG="+t.Target)
+	cmd.Stdin = strings.NewReader(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	translation := strings.TrimSpace(string(out))
+	t.mu.Lock()
+	t.cache[lang+"\x00"+text] = translation
+	t.mu.Unlock()
+	return translation, nil
+}
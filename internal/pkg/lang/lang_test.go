@@ -0,0 +1,67 @@
+package lang
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"The OpenSSH server daemon failed to start and was stopped", "en"},
+		{"Der Dienst wurde nicht gestartet, da die Konfiguration fehlt", "de"},
+		{"Le service de gestion des journaux est arrêté pour la maintenance", "fr"},
+		{"El servicio no se ha iniciado por un error en la configuración", "es"},
+		{"Il servizio non è stato avviato per un errore della configurazione", "it"},
+		{"De dienst voor het netwerk is niet gestart", "nl"},
+		{"Служба сетевого времени", "ru"},
+		{"ネットワーク時刻同期サービス", "ja"},
+		{"网络时间同步服务", "zh"},
+		{"sshd.service", ""},
+		{"", ""},
+		{"12345 !!", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Detect(tt.text), tt.text)
+	}
+}
+
+func TestTagger(t *testing.T) {
+	var nilTagger *Tagger
+	lang, translation := nilTagger.Tag(context.Background(), "Der Dienst wurde nicht gestartet")
+	assert.Empty(t, lang)
+	assert.Empty(t, translation)
+
+	tagger := NewTagger(nil, "")
+	lang, translation = tagger.Tag(context.Background(), "Der Dienst wurde nicht gestartet")
+	assert.Equal(t, "de", lang)
+	assert.Empty(t, translation)
+
+	script := filepath.Join(t.TempDir(), "translate")
+	counter := filepath.Join(t.TempDir(), "calls")
+	os.WriteFile(script, []byte("#!/bin/sh\necho x >> "+counter+"\necho \"[$SOURCE_LANG->$TARGET_LANG] $(cat)\"\n"), 0755)
+	tagger = NewTagger([]string{script}, "en")
+	for range 2 {
+		lang, translation = tagger.Tag(context.Background(), "Der Dienst wurde nicht gestartet")
+		assert.Equal(t, "de", lang)
+		assert.Equal(t, "[de->en] Der Dienst wurde nicht gestartet", translation)
+	}
+	calls, _ := os.ReadFile(counter)
+	assert.Equal(t, "x\n", string(calls), "translations are cached")
+
+	// texts in the target language aren't translated
+	lang, translation = tagger.Tag(context.Background(), "The service was not started")
+	assert.Equal(t, "en", lang)
+	assert.Empty(t, translation)
+
+	tagger = NewTagger([]string{"/bin/false"}, "en")
+	lang, translation = tagger.Tag(context.Background(), "Der Dienst wurde nicht gestartet")
+	assert.Equal(t, "de", lang)
+	assert.Empty(t, translation)
+}
@@ -0,0 +1,460 @@
+package logind
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+)
+
+const (
+	logindDest      = "org.freedesktop.login1"
+	logindPath      = godbus.ObjectPath("/org/freedesktop/login1")
+	managerIface    = "org.freedesktop.login1.Manager"
+	sessionIface    = "org.freedesktop.login1.Session"
+	userIface       = "org.freedesktop.login1.User"
+	seatIface       = "org.freedesktop.login1.Seat"
+	propertiesIface = "org.freedesktop.DBus.Properties"
+)
+
+type Logind struct {
+	Auth auth.AuthKeeper
+}
+
+type Session struct {
+	ID         string     `json:"id"`
+	UID        uint32     `json:"uid"`
+	User       string     `json:"user"`
+	Seat       string     `json:"seat,omitempty"`
+	TTY        string     `json:"tty,omitempty"`
+	Display    string     `json:"display,omitempty"`
+	Remote     bool       `json:"remote"`
+	RemoteHost string     `json:"remote_host,omitempty"`
+	RemoteUser string     `json:"remote_user,omitempty"`
+	Service    string     `json:"service,omitempty"`
+	Type       string     `json:"type"`
+	Class      string     `json:"class"`
+	State      string     `json:"state"`
+	Active     bool       `json:"active"`
+	Idle       bool       `json:"idle"`
+	IdleSince  *time.Time `json:"idle_since,omitempty"`
+	Locked     bool       `json:"locked"`
+	Since      *time.Time `json:"since,omitempty"`
+	// only reported by session_info
+	Leader  uint32 `json:"leader,omitempty"`
+	Scope   string `json:"scope,omitempty"`
+	Desktop string `json:"desktop,omitempty"`
+	VTNr    uint32 `json:"vtnr,omitempty"`
+}
+
+type User struct {
+	UID      uint32   `json:"uid"`
+	Name     string   `json:"name"`
+	State    string   `json:"state"`
+	Linger   bool     `json:"linger"`
+	Idle     bool     `json:"idle"`
+	Sessions []string `json:"sessions"`
+}
+
+type Seat struct {
+	ID            string   `json:"id"`
+	ActiveSession string   `json:"active_session,omitempty"`
+	CanGraphical  bool     `json:"can_graphical"`
+	Idle          bool     `json:"idle"`
+	Sessions      []string `json:"sessions"`
+}
+
+type ListSessionsParams struct {
+	User string `json:"user,omitempty" jsonschema:"Only list the sessions of this user name."`
+}
+
+type ListSessionsResult struct {
+	Sessions []Session `json:"sessions"`
+	Users    []User    `json:"users"`
+	Seats    []Seat    `json:"seats"`
+}
+
+type SessionInfoParams struct {
+	ID string `json:"id" jsonschema:"Id of the session, as listed by list_sessions."`
+}
+
+type TerminateSessionParams struct {
+	ID string `json:"id" jsonschema:"Id of the session to terminate, all its processes are killed."`
+}
+
+type LockSeatParams struct {
+	Seat string `json:"seat,omitempty" jsonschema:"Seat whose sessions are locked. Defaults to 'seat0'."`
+}
+
+func CreateListSessionsSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ListSessionsParams](nil)
+	return inputSchema
+}
+
+func CreateSessionInfoSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[SessionInfoParams](nil)
+	return inputSchema
+}
+
+func CreateTerminateSessionSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[TerminateSessionParams](nil)
+	return inputSchema
+}
+
+func CreateLockSeatSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[LockSeatParams](nil)
+	inputSchema.Properties["seat"].Default = json.RawMessage("\"seat0\"")
+	return inputSchema
+}
+
+// usecTime converts the microseconds since the epoch logind reports, zero
+// is unset
+func usecTime(usec uint64) *time.Time {
+	if usec == 0 {
+		return nil
+	}
+	t := time.UnixMicro(int64(usec)).UTC()
+	return &t
+}
+
+// idOf returns the id of a (so) property like the Seat of a session
+func idOf(v godbus.Variant) string {
+	fields, ok := v.Value().([]any)
+	if !ok || len(fields) == 0 {
+		return ""
+	}
+	id, _ := fields[0].(string)
+	return id
+}
+
+// idsOf returns the ids of an a(so) property like the Sessions of a user
+func idsOf(v godbus.Variant) []string {
+	ids := []string{}
+	entries, ok := v.Value().([][]any)
+	if !ok {
+		return ids
+	}
+	for _, entry := range entries {
+		if len(entry) > 0 {
+			if id, ok := entry[0].(string); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// sessionOf builds the session from the properties of its dbus object, the
+// details are only added for session_info
+func sessionOf(props map[string]godbus.Variant, details bool) Session {
+	str := func(name string) string { s, _ := props[name].Value().(string); return s }
+	flag := func(name string) bool { b, _ := props[name].Value().(bool); return b }
+	usec := func(name string) uint64 { u, _ := props[name].Value().(uint64); return u }
+	s := Session{
+		ID:         str("Id"),
+		User:       str("Name"),
+		Seat:       idOf(props["Seat"]),
+		TTY:        str("TTY"),
+		Display:    str("Display"),
+		Remote:     flag("Remote"),
+		RemoteHost: str("RemoteHost"),
+		RemoteUser: str("RemoteUser"),
+		Service:    str("Service"),
+		Type:       str("Type"),
+		Class:      str("Class"),
+		State:      str("State"),
+		Active:     flag("Active"),
+		Idle:       flag("IdleHint"),
+		Locked:     flag("LockedHint"),
+		Since:      usecTime(usec("Timestamp")),
+	}
+	if user, ok := props["User"].Value().([]any); ok && len(user) > 0 {
+		s.UID, _ = user[0].(uint32)
+	}
+	if s.Idle {
+		s.IdleSince = usecTime(usec("IdleSinceHint"))
+	}
+	if details {
+		s.Leader, _ = props["Leader"].Value().(uint32)
+		s.Scope = str("Scope")
+		s.Desktop = str("Desktop")
+		s.VTNr, _ = props["VTNr"].Value().(uint32)
+	}
+	return s
+}
+
+func userOf(uid uint32, props map[string]godbus.Variant) User {
+	u := User{UID: uid, Sessions: idsOf(props["Sessions"])}
+	u.Name, _ = props["Name"].Value().(string)
+	u.State, _ = props["State"].Value().(string)
+	u.Linger, _ = props["Linger"].Value().(bool)
+	u.Idle, _ = props["IdleHint"].Value().(bool)
+	return u
+}
+
+func seatOf(id string, props map[string]godbus.Variant) Seat {
+	s := Seat{ID: id, ActiveSession: idOf(props["ActiveSession"]), Sessions: idsOf(props["Sessions"])}
+	s.CanGraphical, _ = props["CanGraphical"].Value().(bool)
+	s.Idle, _ = props["IdleHint"].Value().(bool)
+	return s
+}
+
+// connection to logind, opened per call like the one of power_state
+type connection struct {
+	bus *godbus.Conn
+}
+
+func connect(ctx context.Context) (*connection, error) {
+	bus, err := godbus.ConnectSystemBus(godbus.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to the system bus: %w", err)
+	}
+	return &connection{bus: bus}, nil
+}
+
+func (c *connection) Close() {
+	c.bus.Close()
+}
+
+func (c *connection) manager() godbus.BusObject {
+	return c.bus.Object(logindDest, logindPath)
+}
+
+func (c *connection) properties(ctx context.Context, path godbus.ObjectPath, iface string) (map[string]godbus.Variant, error) {
+	props := make(map[string]godbus.Variant)
+	err := c.bus.Object(logindDest, path).CallWithContext(ctx, propertiesIface+".GetAll", 0, iface).Store(&props)
+	return props, err
+}
+
+// session returns the session with the id
+func (c *connection) session(ctx context.Context, id string, details bool) (Session, error) {
+	var path godbus.ObjectPath
+	if err := c.manager().CallWithContext(ctx, managerIface+".GetSession", 0, id).Store(&path); err != nil {
+		return Session{}, fmt.Errorf("no session %s: %w", id, err)
+	}
+	props, err := c.properties(ctx, path, sessionIface)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to get the properties of session %s: %w", id, err)
+	}
+	return sessionOf(props, details), nil
+}
+
+// list returns the sessions, the users and the seats logind knows
+func (c *connection) list(ctx context.Context) (*ListSessionsResult, error) {
+	res := &ListSessionsResult{Sessions: []Session{}, Users: []User{}, Seats: []Seat{}}
+	var sessions []struct {
+		ID   string
+		UID  uint32
+		User string
+		Seat string
+		Path godbus.ObjectPath
+	}
+	if err := c.manager().CallWithContext(ctx, managerIface+".ListSessions", 0).Store(&sessions); err != nil {
+		return nil, fmt.Errorf("failed to list the sessions: %w", err)
+	}
+	for _, s := range sessions {
+		props, err := c.properties(ctx, s.Path, sessionIface)
+		if err != nil {
+			// the session may have ended meanwhile
+			slog.Debug("failed to get the properties of the session", "session", s.ID, "error", err)
+			continue
+		}
+		res.Sessions = append(res.Sessions, sessionOf(props, false))
+	}
+	var users []struct {
+		UID  uint32
+		Name string
+		Path godbus.ObjectPath
+	}
+	if err := c.manager().CallWithContext(ctx, managerIface+".ListUsers", 0).Store(&users); err != nil {
+		return nil, fmt.Errorf("failed to list the users: %w", err)
+	}
+	for _, u := range users {
+		props, err := c.properties(ctx, u.Path, userIface)
+		if err != nil {
+			slog.Debug("failed to get the properties of the user", "uid", u.UID, "error", err)
+			continue
+		}
+		res.Users = append(res.Users, userOf(u.UID, props))
+	}
+	var seats []struct {
+		ID   string
+		Path godbus.ObjectPath
+	}
+	if err := c.manager().CallWithContext(ctx, managerIface+".ListSeats", 0).Store(&seats); err != nil {
+		return nil, fmt.Errorf("failed to list the seats: %w", err)
+	}
+	for _, s := range seats {
+		props, err := c.properties(ctx, s.Path, seatIface)
+		if err != nil {
+			slog.Debug("failed to get the properties of the seat", "seat", s.ID, "error", err)
+			continue
+		}
+		res.Seats = append(res.Seats, seatOf(s.ID, props))
+	}
+	return res, nil
+}
+
+// filterUser keeps the sessions and the entry of the user
+func filterUser(res *ListSessionsResult, user string) {
+	res.Sessions = slices.DeleteFunc(res.Sessions, func(s Session) bool { return s.User != user })
+	res.Users = slices.DeleteFunc(res.Users, func(u User) bool { return u.Name != user })
+}
+
+func jsonResult(res any) (*mcp.CallToolResult, error) {
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
+func (l *Logind) authorizeRead(ctx context.Context) error {
+	if allowed, err := l.Auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.SessionsReadAction)); err != nil {
+		return err
+	} else if !allowed {
+		return fmt.Errorf("calling method was canceled by user")
+	}
+	return nil
+}
+
+// ListSessions reports who is logged in, with the idle state of the
+// sessions, the users and the seats
+func (l *Logind) ListSessions(ctx context.Context, req *mcp.CallToolRequest, params *ListSessionsParams) (*mcp.CallToolResult, any, error) {
+	if err := l.authorizeRead(ctx); err != nil {
+		return nil, nil, err
+	}
+	conn, err := connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	res, err := conn.list(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if params.User != "" {
+		filterUser(res, params.User)
+	}
+	result, err := jsonResult(res)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, res, nil
+}
+
+// SessionInfo returns the details of a session
+func (l *Logind) SessionInfo(ctx context.Context, req *mcp.CallToolRequest, params *SessionInfoParams) (*mcp.CallToolResult, any, error) {
+	if params.ID == "" {
+		return nil, nil, fmt.Errorf("id is required")
+	}
+	if err := l.authorizeRead(ctx); err != nil {
+		return nil, nil, err
+	}
+	conn, err := connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	session, err := conn.session(ctx, params.ID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := jsonResult(session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, session, nil
+}
+
+func (l *Logind) authorizeWrite(ctx context.Context) error {
+	allowed, err := l.Auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.SessionsManageAction))
+	if !allowed || err != nil {
+		return fmt.Errorf("calling method wasn't authorized: %w", err)
+	}
+	return nil
+}
+
+func messageResult(msg string) (*mcp.CallToolResult, any, error) {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: msg},
+		},
+	}, util.Message{Message: msg}, nil
+}
+
+// TerminateSession ends a session by killing all its processes
+func (l *Logind) TerminateSession(ctx context.Context, req *mcp.CallToolRequest, params *TerminateSessionParams) (*mcp.CallToolResult, any, error) {
+	if params.ID == "" {
+		return nil, nil, fmt.Errorf("id is required")
+	}
+	if err := l.authorizeWrite(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer l.Auth.Deauthorize()
+	conn, err := connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	session, err := conn.session(ctx, params.ID, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := conn.manager().CallWithContext(ctx, managerIface+".TerminateSession", 0, params.ID).Store(); err != nil {
+		return nil, nil, fmt.Errorf("error when terminating session %s: %w", params.ID, err)
+	}
+	slog.Info("terminated session", "session", params.ID, "user", session.User)
+	return messageResult(fmt.Sprintf("terminated session %s of %s", params.ID, session.User))
+}
+
+// LockSeat locks the screens of all sessions of a seat
+func (l *Logind) LockSeat(ctx context.Context, req *mcp.CallToolRequest, params *LockSeatParams) (*mcp.CallToolResult, any, error) {
+	seat := params.Seat
+	if seat == "" {
+		seat = "seat0"
+	}
+	if err := l.authorizeWrite(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer l.Auth.Deauthorize()
+	conn, err := connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	var path godbus.ObjectPath
+	if err := conn.manager().CallWithContext(ctx, managerIface+".GetSeat", 0, seat).Store(&path); err != nil {
+		return nil, nil, fmt.Errorf("no seat %s: %w", seat, err)
+	}
+	props, err := conn.properties(ctx, path, seatIface)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the properties of seat %s: %w", seat, err)
+	}
+	sessions := seatOf(seat, props).Sessions
+	if len(sessions) == 0 {
+		return messageResult(fmt.Sprintf("no sessions on %s", seat))
+	}
+	for _, id := range sessions {
+		if err := conn.manager().CallWithContext(ctx, managerIface+".LockSession", 0, id).Store(); err != nil {
+			return nil, nil, fmt.Errorf("error when locking session %s: %w", id, err)
+		}
+	}
+	slog.Info("locked seat", "seat", seat, "sessions", sessions)
+	return messageResult(fmt.Sprintf("locked the sessions %v of %s", sessions, seat))
+}
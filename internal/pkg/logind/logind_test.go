@@ -0,0 +1,80 @@
+package logind
+
+import (
+	"testing"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionOf(t *testing.T) {
+	props := map[string]godbus.Variant{
+		"Id":            godbus.MakeVariant("3"),
+		"Name":          godbus.MakeVariant("alice"),
+		"User":          godbus.MakeVariant([]any{uint32(1000), godbus.ObjectPath("/org/freedesktop/login1/user/_1000")}),
+		"Seat":          godbus.MakeVariant([]any{"seat0", godbus.ObjectPath("/org/freedesktop/login1/seat/seat0")}),
+		"Remote":        godbus.MakeVariant(true),
+		"RemoteHost":    godbus.MakeVariant("192.0.2.1"),
+		"Type":          godbus.MakeVariant("tty"),
+		"Class":         godbus.MakeVariant("user"),
+		"State":         godbus.MakeVariant("active"),
+		"IdleHint":      godbus.MakeVariant(true),
+		"IdleSinceHint": godbus.MakeVariant(uint64(1760000000000000)),
+		"Timestamp":     godbus.MakeVariant(uint64(0)),
+		"Leader":        godbus.MakeVariant(uint32(4242)),
+		"Scope":         godbus.MakeVariant("session-3.scope"),
+	}
+	s := sessionOf(props, false)
+	assert.Equal(t, "3", s.ID)
+	assert.Equal(t, uint32(1000), s.UID)
+	assert.Equal(t, "seat0", s.Seat)
+	assert.True(t, s.Remote)
+	require.NotNil(t, s.IdleSince)
+	assert.Equal(t, time.Unix(1760000000, 0).UTC(), *s.IdleSince)
+	assert.Nil(t, s.Since)
+	assert.Zero(t, s.Leader)
+	assert.Empty(t, s.Scope)
+
+	s = sessionOf(props, true)
+	assert.Equal(t, uint32(4242), s.Leader)
+	assert.Equal(t, "session-3.scope", s.Scope)
+
+	props["IdleHint"] = godbus.MakeVariant(false)
+	assert.Nil(t, sessionOf(props, false).IdleSince)
+}
+
+func TestSeatAndUser(t *testing.T) {
+	sessions := godbus.MakeVariant([][]any{
+		{"3", godbus.ObjectPath("/org/freedesktop/login1/session/_33")},
+		{"c1", godbus.ObjectPath("/org/freedesktop/login1/session/c1")},
+	})
+	seat := seatOf("seat0", map[string]godbus.Variant{
+		"ActiveSession": godbus.MakeVariant([]any{"3", godbus.ObjectPath("/org/freedesktop/login1/session/_33")}),
+		"CanGraphical":  godbus.MakeVariant(true),
+		"Sessions":      sessions,
+	})
+	assert.Equal(t, Seat{ID: "seat0", ActiveSession: "3", CanGraphical: true, Sessions: []string{"3", "c1"}}, seat)
+
+	user := userOf(1000, map[string]godbus.Variant{
+		"Name":     godbus.MakeVariant("alice"),
+		"State":    godbus.MakeVariant("lingering"),
+		"Linger":   godbus.MakeVariant(true),
+		"Sessions": sessions,
+	})
+	assert.Equal(t, User{UID: 1000, Name: "alice", State: "lingering", Linger: true, Sessions: []string{"3", "c1"}}, user)
+	assert.Equal(t, []string{}, userOf(0, nil).Sessions)
+}
+
+func TestFilterUser(t *testing.T) {
+	res := &ListSessionsResult{
+		Sessions: []Session{{ID: "1", User: "root"}, {ID: "3", User: "alice"}},
+		Users:    []User{{UID: 0, Name: "root"}, {UID: 1000, Name: "alice"}},
+		Seats:    []Seat{{ID: "seat0"}},
+	}
+	filterUser(res, "alice")
+	assert.Equal(t, []Session{{ID: "3", User: "alice"}}, res.Sessions)
+	assert.Equal(t, []User{{UID: 1000, Name: "alice"}}, res.Users)
+	assert.Len(t, res.Seats, 1)
+}
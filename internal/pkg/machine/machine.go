@@ -0,0 +1,226 @@
+package machine
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+)
+
+const (
+	machineDest  = "org.freedesktop.machine1"
+	machinePath  = godbus.ObjectPath("/org/freedesktop/machine1")
+	managerIface = "org.freedesktop.machine1.Manager"
+	machineIface = "org.freedesktop.machine1.Machine"
+)
+
+type Machines struct {
+	Auth auth.AuthKeeper
+}
+
+type Machine struct {
+	Name          string     `json:"name"`
+	Class         string     `json:"class"`
+	Service       string     `json:"service,omitempty"`
+	ID            string     `json:"id,omitempty"`
+	Unit          string     `json:"unit,omitempty"`
+	State         string     `json:"state,omitempty"`
+	Leader        uint32     `json:"leader,omitempty"`
+	Since         *time.Time `json:"since,omitempty"`
+	RootDirectory string     `json:"root_directory,omitempty"`
+	// only reported by machine_info
+	Addresses []string          `json:"addresses,omitempty"`
+	OSRelease map[string]string `json:"os_release,omitempty"`
+	// how to read the journal of the machine
+	Journal string `json:"journal,omitempty"`
+}
+
+type ListMachinesParams struct{}
+
+type ListMachinesResult struct {
+	Machines []Machine `json:"machines"`
+}
+
+type MachineInfoParams struct {
+	Name string `json:"name" jsonschema:"Name of the machine, as listed by list_machines."`
+}
+
+func CreateListMachinesSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ListMachinesParams](nil)
+	return inputSchema
+}
+
+func CreateMachineInfoSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[MachineInfoParams](nil)
+	return inputSchema
+}
+
+// machineOf builds the machine from the properties of its dbus object
+func machineOf(props map[string]godbus.Variant) Machine {
+	m := Machine{}
+	m.Name, _ = props["Name"].Value().(string)
+	m.Class, _ = props["Class"].Value().(string)
+	m.Service, _ = props["Service"].Value().(string)
+	m.Unit, _ = props["Unit"].Value().(string)
+	m.State, _ = props["State"].Value().(string)
+	m.Leader, _ = props["Leader"].Value().(uint32)
+	m.RootDirectory, _ = props["RootDirectory"].Value().(string)
+	if id, ok := props["Id"].Value().([]byte); ok && len(id) == 16 {
+		m.ID = hex.EncodeToString(id)
+	}
+	if usec, ok := props["Timestamp"].Value().(uint64); ok && usec > 0 {
+		since := time.UnixMicro(int64(usec)).UTC()
+		m.Since = &since
+	}
+	return m
+}
+
+// journalHint tells how the entries of the machine can be read
+func journalHint(m Machine) string {
+	if m.ID == "" {
+		return ""
+	}
+	return fmt.Sprintf("call list_log with machine %s, this needs the journal of the machine linked into the one of the host, e.g. with systemd-nspawn --link-journal=try-guest", m.ID)
+}
+
+type connection struct {
+	bus *godbus.Conn
+}
+
+func connect(ctx context.Context) (*connection, error) {
+	bus, err := godbus.ConnectSystemBus(godbus.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to the system bus: %w", err)
+	}
+	return &connection{bus: bus}, nil
+}
+
+func (c *connection) Close() {
+	c.bus.Close()
+}
+
+func (c *connection) manager() godbus.BusObject {
+	return c.bus.Object(machineDest, machinePath)
+}
+
+func (c *connection) machine(ctx context.Context, path godbus.ObjectPath) (Machine, error) {
+	props := make(map[string]godbus.Variant)
+	err := c.bus.Object(machineDest, path).CallWithContext(ctx, "org.freedesktop.DBus.Properties.GetAll", 0, machineIface).Store(&props)
+	if err != nil {
+		return Machine{}, err
+	}
+	return machineOf(props), nil
+}
+
+func (m *Machines) authorize(ctx context.Context) error {
+	if allowed, err := m.Auth.IsReadAuthorized(ctx); err != nil {
+		return err
+	} else if !allowed {
+		return fmt.Errorf("calling method was canceled by user")
+	}
+	return nil
+}
+
+func jsonResult(res any) (*mcp.CallToolResult, error) {
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
+// ListMachines lists the containers and virtual machines registered with
+// machined, like machinectl list
+func (m *Machines) ListMachines(ctx context.Context, req *mcp.CallToolRequest, params *ListMachinesParams) (*mcp.CallToolResult, any, error) {
+	if err := m.authorize(ctx); err != nil {
+		return nil, nil, err
+	}
+	conn, err := connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	var list []struct {
+		Name    string
+		Class   string
+		Service string
+		Path    godbus.ObjectPath
+	}
+	if err := conn.manager().CallWithContext(ctx, managerIface+".ListMachines", 0).Store(&list); err != nil {
+		return nil, nil, fmt.Errorf("couldn't list the machines of systemd-machined: %w", err)
+	}
+	res := ListMachinesResult{Machines: []Machine{}}
+	for _, entry := range list {
+		machine, err := conn.machine(ctx, entry.Path)
+		if err != nil {
+			// the machine may have terminated meanwhile
+			slog.Debug("failed to get the properties of the machine", "machine", entry.Name, "error", err)
+			machine = Machine{Name: entry.Name, Class: entry.Class, Service: entry.Service}
+		}
+		res.Machines = append(res.Machines, machine)
+	}
+	result, err := jsonResult(res)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, res, nil
+}
+
+// MachineInfo returns the details of a machine with its addresses, its os
+// release and how its journal can be read
+func (m *Machines) MachineInfo(ctx context.Context, req *mcp.CallToolRequest, params *MachineInfoParams) (*mcp.CallToolResult, any, error) {
+	if params.Name == "" {
+		return nil, nil, fmt.Errorf("name is required")
+	}
+	if err := m.authorize(ctx); err != nil {
+		return nil, nil, err
+	}
+	conn, err := connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	var path godbus.ObjectPath
+	if err := conn.manager().CallWithContext(ctx, managerIface+".GetMachine", 0, params.Name).Store(&path); err != nil {
+		return nil, nil, fmt.Errorf("no machine %s: %w", params.Name, err)
+	}
+	machine, err := conn.machine(ctx, path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the properties of machine %s: %w", params.Name, err)
+	}
+	var addresses []struct {
+		Family  int32
+		Address []byte
+	}
+	// only containers with their own network namespace report addresses
+	if err := conn.manager().CallWithContext(ctx, managerIface+".GetMachineAddresses", 0, params.Name).Store(&addresses); err == nil {
+		for _, a := range addresses {
+			machine.Addresses = append(machine.Addresses, net.IP(a.Address).String())
+		}
+	} else {
+		slog.Debug("failed to get the addresses of the machine", "machine", params.Name, "error", err)
+	}
+	if err := conn.manager().CallWithContext(ctx, managerIface+".GetMachineOSRelease", 0, params.Name).Store(&machine.OSRelease); err != nil {
+		slog.Debug("failed to get the os release of the machine", "machine", params.Name, "error", err)
+	}
+	machine.Journal = journalHint(machine)
+	result, err := jsonResult(machine)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, machine, nil
+}
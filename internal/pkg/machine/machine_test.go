@@ -0,0 +1,47 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachineOf(t *testing.T) {
+	props := map[string]godbus.Variant{
+		"Name":          godbus.MakeVariant("web"),
+		"Id":            godbus.MakeVariant([]byte{0xde, 0xad, 0xbe, 0xef, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}),
+		"Timestamp":     godbus.MakeVariant(uint64(1760000000000000)),
+		"Service":       godbus.MakeVariant("systemd-nspawn"),
+		"Unit":          godbus.MakeVariant("machine-web.scope"),
+		"Leader":        godbus.MakeVariant(uint32(4242)),
+		"Class":         godbus.MakeVariant("container"),
+		"RootDirectory": godbus.MakeVariant("/var/lib/machines/web"),
+		"State":         godbus.MakeVariant("running"),
+	}
+	m := machineOf(props)
+	require.NotNil(t, m.Since)
+	assert.Equal(t, time.Unix(1760000000, 0).UTC(), *m.Since)
+	m.Since = nil
+	assert.Equal(t, Machine{
+		Name:          "web",
+		Class:         "container",
+		Service:       "systemd-nspawn",
+		ID:            "deadbeef000102030405060708090a0b",
+		Unit:          "machine-web.scope",
+		State:         "running",
+		Leader:        4242,
+		RootDirectory: "/var/lib/machines/web",
+	}, m)
+	assert.Contains(t, journalHint(m), "machine deadbeef000102030405060708090a0b")
+
+	// machines without an id can't be matched in the journal
+	props["Id"] = godbus.MakeVariant([]byte{})
+	props["Timestamp"] = godbus.MakeVariant(uint64(0))
+	m = machineOf(props)
+	assert.Empty(t, m.ID)
+	assert.Nil(t, m.Since)
+	assert.Empty(t, journalHint(m))
+}
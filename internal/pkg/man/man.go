@@ -216,5 +216,5 @@ func GetManPage(ctx context.Context, req *mcp.CallToolRequest, params *GetManPag
 				Text: string(jsonBytes),
 			},
 		},
-	}, nil, nil
+	}, res, nil
 }
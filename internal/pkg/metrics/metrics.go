@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+)
+
+// upper bounds in seconds of the buckets of the dbus latency
+var dbusBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	// cumulative counts per bucket
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *histogram) observe(seconds float64) {
+	for i, le := range dbusBuckets {
+		if seconds <= le {
+			h.buckets[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Metrics counts the tool calls, refused authorizations, dbus calls and
+// journal reads of the server and serves them in the Prometheus text format.
+// Its methods do nothing on a nil Metrics.
+type Metrics struct {
+	mu sync.Mutex
+	// by tool
+	toolCalls  map[string]uint64
+	toolErrors map[string]uint64
+	// by error code
+	authDenials map[authkeeper.ErrorCode]uint64
+	// by dbus method
+	dbus           map[string]*histogram
+	journalEntries uint64
+	journalBytes   uint64
+}
+
+func New() *Metrics {
+	return &Metrics{
+		toolCalls:   make(map[string]uint64),
+		toolErrors:  make(map[string]uint64),
+		authDenials: make(map[authkeeper.ErrorCode]uint64),
+		dbus:        make(map[string]*histogram),
+	}
+}
+
+// ObserveDBus records the latency of a call of the dbus method
+func (m *Metrics) ObserveDBus(method string, took time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.dbus[method]
+	if h == nil {
+		h = &histogram{buckets: make([]uint64, len(dbusBuckets))}
+		m.dbus[method] = h
+	}
+	h.observe(took.Seconds())
+}
+
+// AddJournalRead records journal entries read with the size of their fields
+func (m *Metrics) AddJournalRead(entries, bytes int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.journalEntries += uint64(entries)
+	m.journalBytes += uint64(bytes)
+}
+
+// Middleware counts the tool calls with their errors and refused
+// authorizations
+func (m *Metrics) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	if m == nil {
+		return next
+	}
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || call.Params == nil {
+			return next(ctx, method, req)
+		}
+		result, err := next(ctx, method, req)
+		res, _ := result.(*mcp.CallToolResult)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.toolCalls[call.Params.Name]++
+		if err == nil && (res == nil || !res.IsError) {
+			return result, err
+		}
+		m.toolErrors[call.Params.Name]++
+		callErr := err
+		if callErr == nil {
+			callErr = res.GetError()
+		}
+		var authErr *authkeeper.AuthError
+		if errors.As(callErr, &authErr) {
+			m.authDenials[authErr.Code]++
+		}
+		return result, err
+	}
+}
+
+// escape escapes a label value
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// sortedKeys returns the keys of a map in order, so that the output is
+// stable
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func writeCounter[K ~string](w io.Writer, name, help, label string, values map[K]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, escape(string(k)), values[k])
+	}
+}
+
+// Write writes the metrics in the Prometheus text format
+func (m *Metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	writeCounter(bw, "systemd_mcp_tool_calls_total", "Tool calls by tool.", "tool", m.toolCalls)
+	writeCounter(bw, "systemd_mcp_tool_errors_total", "Tool calls which failed by tool.", "tool", m.toolErrors)
+	writeCounter(bw, "systemd_mcp_auth_denials_total", "Tool calls whose authorization was refused by error code.", "code", m.authDenials)
+
+	name := "systemd_mcp_dbus_call_duration_seconds"
+	fmt.Fprintf(bw, "# HELP %s Latency of the calls to the service manager by dbus method.\n# TYPE %s histogram\n", name, name)
+	for _, method := range sortedKeys(m.dbus) {
+		h := m.dbus[method]
+		label := escape(method)
+		for i, le := range dbusBuckets {
+			fmt.Fprintf(bw, "%s_bucket{method=\"%s\",le=\"%g\"} %d\n", name, label, le, h.buckets[i])
+		}
+		fmt.Fprintf(bw, "%s_bucket{method=\"%s\",le=\"+Inf\"} %d\n", name, label, h.count)
+		fmt.Fprintf(bw, "%s_sum{method=\"%s\"} %g\n", name, label, h.sum)
+		fmt.Fprintf(bw, "%s_count{method=\"%s\"} %d\n", name, label, h.count)
+	}
+
+	fmt.Fprintf(bw, "# HELP systemd_mcp_journal_entries_read_total Journal entries read.\n# TYPE systemd_mcp_journal_entries_read_total counter\nsystemd_mcp_journal_entries_read_total %d\n", m.journalEntries)
+	fmt.Fprintf(bw, "# HELP systemd_mcp_journal_bytes_read_total Size of the fields of the journal entries read.\n# TYPE systemd_mcp_journal_bytes_read_total counter\nsystemd_mcp_journal_bytes_read_total %d\n", m.journalBytes)
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics for scraping
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
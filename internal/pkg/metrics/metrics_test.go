@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	handler := m.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		res := &mcp.CallToolResult{}
+		switch req.(*mcp.CallToolRequest).Params.Name {
+		case "change_unit_state":
+			res.SetError(&authkeeper.AuthError{Code: authkeeper.AuthDenied, Message: "polkit didn't authorize"})
+		case "list_log":
+			return nil, errors.New("broken")
+		}
+		return res, nil
+	})
+	for _, tool := range []string{"list_units", "list_units", "change_unit_state", "list_log"} {
+		handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: tool}})
+	}
+	m.ObserveDBus("StartUnit", 30*time.Millisecond)
+	m.AddJournalRead(2, 100)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, body, `systemd_mcp_tool_calls_total{tool="list_units"} 2`)
+	assert.Contains(t, body, `systemd_mcp_tool_errors_total{tool="change_unit_state"} 1`)
+	assert.Contains(t, body, `systemd_mcp_tool_errors_total{tool="list_log"} 1`)
+	assert.NotContains(t, body, `systemd_mcp_tool_errors_total{tool="list_units"}`)
+	assert.Contains(t, body, `systemd_mcp_auth_denials_total{code="AUTH_DENIED"} 1`)
+	assert.Contains(t, body, `systemd_mcp_dbus_call_duration_seconds_bucket{method="StartUnit",le="0.025"} 0`)
+	assert.Contains(t, body, `systemd_mcp_dbus_call_duration_seconds_bucket{method="StartUnit",le="0.05"} 1`)
+	assert.Contains(t, body, `systemd_mcp_dbus_call_duration_seconds_count{method="StartUnit"} 1`)
+	assert.Contains(t, body, "systemd_mcp_journal_entries_read_total 2\n")
+	assert.Contains(t, body, "systemd_mcp_journal_bytes_read_total 100\n")
+}
+
+func TestNil(t *testing.T) {
+	var m *Metrics
+	m.ObserveDBus("StartUnit", time.Second)
+	m.AddJournalRead(1, 1)
+	called := false
+	handler := m.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		called = true
+		return &mcp.CallToolResult{}, nil
+	})
+	_, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_units"}})
+	require.NoError(t, err)
+	assert.True(t, called)
+}
@@ -0,0 +1,308 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+)
+
+var (
+	netifDir   = "/run/systemd/netif"
+	procRoute  = "/proc/net/route"
+	procRoute6 = "/proc/net/ipv6_route"
+)
+
+type Network struct {
+	Auth auth.AuthKeeper
+}
+
+type NetworkStatusParams struct {
+	Link string `json:"link,omitempty" jsonschema:"Only report this network interface, e.g. 'eth0'."`
+}
+
+type Route struct {
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway,omitempty"`
+	Metric      int    `json:"metric"`
+}
+
+type Lease struct {
+	Address       string   `json:"address,omitempty"`
+	Netmask       string   `json:"netmask,omitempty"`
+	Router        string   `json:"router,omitempty"`
+	ServerAddress string   `json:"server_address,omitempty"`
+	Lifetime      int      `json:"lifetime,omitempty"`
+	DNS           []string `json:"dns,omitempty"`
+	NTP           []string `json:"ntp,omitempty"`
+	DomainName    string   `json:"domain_name,omitempty"`
+	Hostname      string   `json:"hostname,omitempty"`
+}
+
+type Link struct {
+	Ifindex int      `json:"ifindex"`
+	Name    string   `json:"name"`
+	MAC     string   `json:"mac,omitempty"`
+	MTU     int      `json:"mtu"`
+	Flags   []string `json:"flags"`
+	// the states networkd keeps in /run/systemd/netif/links
+	AdminState   string   `json:"administrative_state,omitempty"`
+	OperState    string   `json:"operational_state,omitempty"`
+	CarrierState string   `json:"carrier_state,omitempty"`
+	AddressState string   `json:"address_state,omitempty"`
+	OnlineState  string   `json:"online_state,omitempty"`
+	NetworkFile  string   `json:"network_file,omitempty"`
+	DNS          []string `json:"dns,omitempty"`
+	Domains      []string `json:"domains,omitempty"`
+	Addresses    []string `json:"addresses"`
+	Routes       []Route  `json:"routes"`
+	DHCPLease    *Lease   `json:"dhcp_lease,omitempty"`
+}
+
+type NetworkStatusResult struct {
+	OperationalState string   `json:"operational_state,omitempty"`
+	CarrierState     string   `json:"carrier_state,omitempty"`
+	AddressState     string   `json:"address_state,omitempty"`
+	OnlineState      string   `json:"online_state,omitempty"`
+	Links            []Link   `json:"links"`
+	Warnings         []string `json:"warnings,omitempty"`
+}
+
+func CreateNetworkStatusSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[NetworkStatusParams](nil)
+	return inputSchema
+}
+
+// readEnvFile reads the KEY=VALUE files networkd writes, nil if it doesn't
+// exist
+func readEnvFile(file string) map[string]string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, val, ok := strings.Cut(line, "="); ok {
+			values[key] = val
+		}
+	}
+	return values
+}
+
+// addState adds the networkd state of the link
+func addState(l *Link, dir string) {
+	state := readEnvFile(filepath.Join(dir, "links", strconv.Itoa(l.Ifindex)))
+	if state == nil {
+		return
+	}
+	l.AdminState = state["ADMIN_STATE"]
+	l.OperState = state["OPER_STATE"]
+	l.CarrierState = state["CARRIER_STATE"]
+	l.AddressState = state["ADDRESS_STATE"]
+	l.OnlineState = state["ONLINE_STATE"]
+	l.NetworkFile = state["NETWORK_FILE"]
+	l.DNS = strings.Fields(state["DNS"])
+	l.Domains = strings.Fields(state["DOMAINS"])
+}
+
+// readLease returns the DHCPv4 lease of the link, nil if it has none
+func readLease(dir string, ifindex int) *Lease {
+	values := readEnvFile(filepath.Join(dir, "leases", strconv.Itoa(ifindex)))
+	if values == nil {
+		return nil
+	}
+	lease := &Lease{
+		Address:       values["ADDRESS"],
+		Netmask:       values["NETMASK"],
+		Router:        values["ROUTER"],
+		ServerAddress: values["SERVER_ADDRESS"],
+		DNS:           strings.Fields(values["DNS"]),
+		NTP:           strings.Fields(values["NTP"]),
+		DomainName:    values["DOMAINNAME"],
+		Hostname:      values["HOSTNAME"],
+	}
+	lease.Lifetime, _ = strconv.Atoi(values["LIFETIME"])
+	return lease
+}
+
+// ipv4Hex converts an address of /proc/net/route, which is in host byte
+// order
+func ipv4Hex(val string) (net.IP, error) {
+	n, err := strconv.ParseUint(val, 16, 32)
+	if err != nil {
+		return nil, err
+	}
+	ip := make(net.IP, net.IPv4len)
+	binary.LittleEndian.PutUint32(ip, uint32(n))
+	return ip, nil
+}
+
+// readRoutes reads the IPv4 and IPv6 routes of the kernel by interface name
+func readRoutes(file4, file6 string) map[string][]Route {
+	routes := make(map[string][]Route)
+	if f, err := os.Open(file4); err == nil {
+		scanner := bufio.NewScanner(f)
+		// skip the header
+		scanner.Scan()
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 8 {
+				continue
+			}
+			dest, err1 := ipv4Hex(fields[1])
+			gw, err2 := ipv4Hex(fields[2])
+			mask, err3 := ipv4Hex(fields[7])
+			if err1 != nil || err2 != nil || err3 != nil {
+				continue
+			}
+			ones, _ := net.IPMask(mask).Size()
+			r := Route{Destination: fmt.Sprintf("%s/%d", dest, ones)}
+			if !gw.IsUnspecified() {
+				r.Gateway = gw.String()
+			}
+			r.Metric, _ = strconv.Atoi(fields[6])
+			routes[fields[0]] = append(routes[fields[0]], r)
+		}
+		f.Close()
+	}
+	if f, err := os.Open(file6); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 {
+				continue
+			}
+			dest, err1 := hex.DecodeString(fields[0])
+			length, err2 := strconv.ParseUint(fields[1], 16, 8)
+			gw, err3 := hex.DecodeString(fields[4])
+			metric, err4 := strconv.ParseUint(fields[5], 16, 32)
+			if err1 != nil || err2 != nil || err3 != nil || err4 != nil || len(dest) != net.IPv6len || len(gw) != net.IPv6len {
+				continue
+			}
+			// the local and multicast routes of the lo interface aren't
+			// interesting
+			if fields[9] == "lo" {
+				continue
+			}
+			r := Route{Destination: fmt.Sprintf("%s/%d", net.IP(dest), length), Metric: int(metric)}
+			if !net.IP(gw).IsUnspecified() {
+				r.Gateway = net.IP(gw).String()
+			}
+			routes[fields[9]] = append(routes[fields[9]], r)
+		}
+		f.Close()
+	}
+	return routes
+}
+
+// managerStates returns the overall states networkd reports over dbus
+func managerStates(ctx context.Context, res *NetworkStatusResult) error {
+	bus, err := godbus.ConnectSystemBus(godbus.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer bus.Close()
+	obj := bus.Object("org.freedesktop.network1", "/org/freedesktop/network1")
+	for name, dest := range map[string]*string{
+		"OperationalState": &res.OperationalState,
+		"CarrierState":     &res.CarrierState,
+		"AddressState":     &res.AddressState,
+		"OnlineState":      &res.OnlineState,
+	} {
+		if err := obj.CallWithContext(ctx, "org.freedesktop.DBus.Properties.Get", 0, "org.freedesktop.network1.Manager", name).Store(dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// links returns the interfaces with their addresses, routes and networkd
+// state
+func links(ifaces []net.Interface, dir string, routes map[string][]Route) []Link {
+	res := []Link{}
+	for _, iface := range ifaces {
+		l := Link{
+			Ifindex:   iface.Index,
+			Name:      iface.Name,
+			MAC:       iface.HardwareAddr.String(),
+			MTU:       iface.MTU,
+			Flags:     strings.Split(iface.Flags.String(), "|"),
+			Addresses: []string{},
+			Routes:    routes[iface.Name],
+			DHCPLease: readLease(dir, iface.Index),
+		}
+		if iface.Flags == 0 {
+			l.Flags = []string{}
+		}
+		if l.Routes == nil {
+			l.Routes = []Route{}
+		}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, a := range addrs {
+				l.Addresses = append(l.Addresses, a.String())
+			}
+		}
+		addState(&l, dir)
+		res = append(res, l)
+	}
+	return res
+}
+
+// Status reports the links with their networkd state, addresses, routes
+// and DHCP leases, like networkctl status --all
+func (n *Network) Status(ctx context.Context, req *mcp.CallToolRequest, params *NetworkStatusParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := n.Auth.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	var ifaces []net.Interface
+	if params.Link != "" {
+		iface, err := net.InterfaceByName(params.Link)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unknown link %s: %w", params.Link, err)
+		}
+		ifaces = []net.Interface{*iface}
+	} else {
+		var err error
+		if ifaces, err = net.Interfaces(); err != nil {
+			return nil, nil, fmt.Errorf("couldn't list the links: %w", err)
+		}
+	}
+	res := NetworkStatusResult{
+		Links: links(ifaces, netifDir, readRoutes(procRoute, procRoute6)),
+	}
+	if err := managerStates(ctx, &res); err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("couldn't query systemd-networkd, the links may be managed by another service: %s", err))
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
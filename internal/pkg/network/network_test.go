@@ -0,0 +1,75 @@
+package network
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRoutes(t *testing.T) {
+	dir := t.TempDir()
+	route4 := filepath.Join(dir, "route")
+	require.NoError(t, os.WriteFile(route4, []byte(`Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	0102000A	0003	0	0	100	00000000	0	0	0
+eth0	0002000A	00000000	0001	0	0	100	00FFFFFF	0	0	0
+`), 0644))
+	route6 := filepath.Join(dir, "ipv6_route")
+	require.NoError(t, os.WriteFile(route6, []byte(`20010db8000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+00000000000000000000000000000001 80 00000000000000000000000000000000 00 00000000000000000000000000000000 00000000 00000002 00000000 80200001       lo
+`), 0644))
+
+	routes := readRoutes(route4, route6)
+	assert.Equal(t, []Route{
+		{Destination: "0.0.0.0/0", Gateway: "10.0.2.1", Metric: 100},
+		{Destination: "10.0.2.0/24", Metric: 100},
+		{Destination: "2001:db8::/64", Metric: 256},
+	}, routes["eth0"])
+	assert.NotContains(t, routes, "lo")
+	assert.Empty(t, readRoutes(filepath.Join(dir, "missing"), filepath.Join(dir, "missing6")))
+}
+
+func TestLinks(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "links"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "leases"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "links", "2"), []byte(`# This is private data. Do not parse.
+ADMIN_STATE=configured
+OPER_STATE=routable
+CARRIER_STATE=carrier
+ADDRESS_STATE=routable
+ONLINE_STATE=online
+NETWORK_FILE=/etc/systemd/network/20-wired.network
+DNS=10.0.2.3
+DOMAINS=example.com
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "leases", "2"), []byte(`ADDRESS=10.0.2.15
+NETMASK=255.255.255.0
+ROUTER=10.0.2.2
+SERVER_ADDRESS=10.0.2.2
+LIFETIME=86400
+DNS=10.0.2.3 10.0.2.4
+`), 0644))
+
+	ifaces := []net.Interface{
+		{Index: 2, Name: "eth0", MTU: 1500, Flags: net.FlagUp | net.FlagBroadcast},
+		{Index: 3, Name: "wlan0", MTU: 1500},
+	}
+	got := links(ifaces, dir, map[string][]Route{"eth0": {{Destination: "0.0.0.0/0", Gateway: "10.0.2.2"}}})
+	require.Len(t, got, 2)
+	assert.Equal(t, "routable", got[0].OperState)
+	assert.Equal(t, "/etc/systemd/network/20-wired.network", got[0].NetworkFile)
+	assert.Equal(t, []string{"10.0.2.3"}, got[0].DNS)
+	assert.Equal(t, []string{"up", "broadcast"}, got[0].Flags)
+	require.NotNil(t, got[0].DHCPLease)
+	assert.Equal(t, &Lease{Address: "10.0.2.15", Netmask: "255.255.255.0", Router: "10.0.2.2", ServerAddress: "10.0.2.2", Lifetime: 86400, DNS: []string{"10.0.2.3", "10.0.2.4"}, NTP: []string{}}, got[0].DHCPLease)
+	assert.Len(t, got[0].Routes, 1)
+
+	assert.Empty(t, got[1].OperState)
+	assert.Nil(t, got[1].DHCPLease)
+	assert.Equal(t, []Route{}, got[1].Routes)
+	assert.Equal(t, []string{}, got[1].Flags)
+}
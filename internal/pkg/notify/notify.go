@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+)
+
+// send passes the state to systemd, outside of a service with Type=notify
+// it does nothing, replaced by the tests
+var send = func(state string) error {
+	_, err := daemon.SdNotify(false, state)
+	return err
+}
+
+func notify(state string) {
+	if err := send(state); err != nil {
+		slog.Debug("failed to notify systemd", "state", state, "error", err)
+	}
+}
+
+// Ready tells systemd that the server accepts requests, the status is shown
+// by systemctl status
+func Ready(status string) {
+	notify("READY=1\nSTATUS=" + status)
+}
+
+// Status updates the status shown by systemctl status
+func Status(status string) {
+	notify("STATUS=" + status)
+}
+
+// Stopping tells systemd that the server shuts down
+func Stopping() {
+	notify("STOPPING=1")
+}
+
+// Watchdog pings the watchdog of the service in half of its interval until
+// the context ends. The ping is skipped while the health check fails, so that
+// systemd restarts a server which lost its connections. Without WatchdogSec
+// it returns at once.
+func Watchdog(ctx context.Context, health func(context.Context) error) {
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		slog.Warn("invalid watchdog configuration", "error", err)
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	healthy := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, interval/2)
+		err := health(checkCtx)
+		cancel()
+		if err != nil {
+			slog.Warn("health check failed, not pinging the watchdog", "error", err)
+			if healthy {
+				Status("unhealthy: " + err.Error())
+			}
+			healthy = false
+			continue
+		}
+		notify("WATCHDOG=1")
+		healthy = true
+	}
+}
@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// record replaces send and returns the sent states
+func record(t *testing.T) func() []string {
+	var mu sync.Mutex
+	var states []string
+	orig := send
+	send = func(state string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, state)
+		return nil
+	}
+	t.Cleanup(func() { send = orig })
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), states...)
+	}
+}
+
+func TestReady(t *testing.T) {
+	states := record(t)
+	Ready("serving MCP over stdio")
+	Stopping()
+	assert.Equal(t, []string{"READY=1\nSTATUS=serving MCP over stdio", "STOPPING=1"}, states())
+}
+
+func TestWatchdog(t *testing.T) {
+	states := record(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", "")
+	var mu sync.Mutex
+	healthErr := fmt.Errorf("no connection to systemd")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Watchdog(ctx, func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return healthErr
+		})
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	// the failing health check is reported once and the watchdog isn't pinged
+	assert.Equal(t, []string{"STATUS=unhealthy: no connection to systemd"}, states())
+	mu.Lock()
+	healthErr = nil
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+	pings := states()[1:]
+	assert.NotEmpty(t, pings)
+	for _, state := range pings {
+		assert.Equal(t, "WATCHDOG=1", state)
+	}
+}
+
+func TestWatchdogDisabled(t *testing.T) {
+	states := record(t)
+	t.Setenv("WATCHDOG_USEC", "")
+	done := make(chan struct{})
+	go func() {
+		Watchdog(context.Background(), func(context.Context) error { return nil })
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watchdog didn't return without WATCHDOG_USEC")
+	}
+	assert.Empty(t, states())
+}
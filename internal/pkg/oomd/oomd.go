@@ -0,0 +1,275 @@
+package oomd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+)
+
+const DefaultKills = 20
+
+var (
+	cgroupRoot     = "/sys/fs/cgroup"
+	systemPressure = "/proc/pressure/memory"
+)
+
+// JournalReader returns the newest entries matching the matches, the
+// oldest first
+type JournalReader interface {
+	Entries(ctx context.Context, matches []string, count int) ([]map[string]string, error)
+}
+
+type Oomd struct {
+	Auth   auth.AuthKeeper
+	Reader JournalReader
+	// returns the dump of systemd-oomd, replaced by the tests
+	dump func(ctx context.Context) (string, error)
+}
+
+type OomdStatusParams struct {
+	Kills int `json:"kills,omitempty" jsonschema:"Maximal number of kill events to return, the newest are returned."`
+}
+
+// Pressure is one line of a pressure stall information file
+type Pressure struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	// total stall time in microseconds
+	Total uint64 `json:"total"`
+}
+
+type MemoryPressure struct {
+	Some Pressure  `json:"some"`
+	Full *Pressure `json:"full,omitempty"`
+}
+
+type Cgroup struct {
+	Path string `json:"path"`
+	// memory_pressure or swap
+	Monitor  string          `json:"monitor"`
+	Pressure *MemoryPressure `json:"pressure,omitempty"`
+	// the remaining values of the dump, like the limit and the usage
+	Details map[string]string `json:"details,omitempty"`
+}
+
+type Kill struct {
+	Time    time.Time `json:"time"`
+	Cgroup  string    `json:"cgroup"`
+	Message string    `json:"message"`
+}
+
+type OomdStatusResult struct {
+	// the global settings of the dump, like the default limits and whether
+	// it is a dry run
+	Settings       map[string]string `json:"settings,omitempty"`
+	SystemPressure *MemoryPressure   `json:"system_pressure,omitempty"`
+	Cgroups        []Cgroup          `json:"cgroups"`
+	Kills          []Kill            `json:"kills"`
+	Warnings       []string          `json:"warnings,omitempty"`
+}
+
+func CreateOomdStatusSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[OomdStatusParams](nil)
+	inputSchema.Properties["kills"].Default = json.RawMessage(strconv.Itoa(DefaultKills))
+	return inputSchema
+}
+
+// readPressure parses a memory.pressure file of the cgroup or of the system
+func readPressure(file string) (*MemoryPressure, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	res := &MemoryPressure{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		p := Pressure{}
+		for _, field := range fields[1:] {
+			key, val, _ := strings.Cut(field, "=")
+			switch key {
+			case "avg10":
+				p.Avg10, _ = strconv.ParseFloat(val, 64)
+			case "avg60":
+				p.Avg60, _ = strconv.ParseFloat(val, 64)
+			case "avg300":
+				p.Avg300, _ = strconv.ParseFloat(val, 64)
+			case "total":
+				p.Total, _ = strconv.ParseUint(val, 10, 64)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			res.Some = p
+		case "full":
+			res.Full = &p
+		}
+	}
+	return res, scanner.Err()
+}
+
+// parseDump reads the settings and the monitored cgroups from the output of
+// oomctl dump. Unindented lines are the settings or start a section, the
+// cgroups of the monitored sections start with a Path line.
+func parseDump(dump string) (map[string]string, []Cgroup) {
+	settings := make(map[string]string)
+	cgroups := []Cgroup{}
+	var monitor string
+	var current *Cgroup
+	for _, line := range strings.Split(dump, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		key, val, _ := strings.Cut(trimmed, ":")
+		val = strings.TrimSpace(val)
+		if trimmed == line {
+			current = nil
+			switch {
+			case strings.HasPrefix(key, "Memory Pressure Monitored"):
+				monitor = "memory_pressure"
+			case strings.HasPrefix(key, "Swap Monitored"):
+				monitor = "swap"
+			case val == "":
+				monitor = ""
+			default:
+				monitor = ""
+				settings[key] = val
+			}
+			continue
+		}
+		if monitor == "" {
+			continue
+		}
+		if key == "Path" {
+			cgroups = append(cgroups, Cgroup{Path: val, Monitor: monitor, Details: make(map[string]string)})
+			current = &cgroups[len(cgroups)-1]
+		} else if current != nil {
+			current.Details[key] = val
+		}
+	}
+	return settings, cgroups
+}
+
+// killOf returns the kill event of a message of systemd-oomd, like "Killed
+// /system.slice/foo.service due to memory pressure for ..."
+func killOf(fields map[string]string) (Kill, bool) {
+	msg := fields["MESSAGE"]
+	if !strings.HasPrefix(msg, "Killed ") {
+		return Kill{}, false
+	}
+	usec, _ := strconv.ParseInt(fields["__REALTIME_TIMESTAMP"], 10, 64)
+	cgroup, _, _ := strings.Cut(strings.TrimPrefix(msg, "Killed "), " ")
+	return Kill{Time: time.UnixMicro(usec), Cgroup: cgroup, Message: msg}, true
+}
+
+// dumpOomd returns the state of systemd-oomd as oomctl dump shows it
+func dumpOomd(ctx context.Context) (string, error) {
+	bus, err := godbus.ConnectSystemBus(godbus.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer bus.Close()
+	var fd godbus.UnixFD
+	err = bus.Object("org.freedesktop.oom1", "/org/freedesktop/oom1").CallWithContext(ctx, "org.freedesktop.oom1.Manager.DumpByFileDescriptor", 0).Store(&fd)
+	if err != nil {
+		return "", err
+	}
+	f := os.NewFile(uintptr(fd), "oomd-dump")
+	defer f.Close()
+	dump, err := io.ReadAll(f)
+	return string(dump), err
+}
+
+// kills returns the newest kill events systemd-oomd logged
+func (o *Oomd) kills(ctx context.Context, limit int) ([]Kill, error) {
+	if o.Reader == nil {
+		return nil, fmt.Errorf("the journal can't be read")
+	}
+	// oomd also logs other messages, so more entries are read
+	entries, err := o.Reader.Entries(ctx, []string{"SYSLOG_IDENTIFIER=systemd-oomd"}, 10*limit)
+	if err != nil {
+		return nil, err
+	}
+	kills := []Kill{}
+	for _, fields := range entries {
+		if kill, ok := killOf(fields); ok {
+			kills = append(kills, kill)
+		}
+	}
+	if len(kills) > limit {
+		kills = kills[len(kills)-limit:]
+	}
+	return kills, nil
+}
+
+// Status reports the cgroups systemd-oomd monitors with their current memory
+// pressure and the processes it killed recently
+func (o *Oomd) Status(ctx context.Context, req *mcp.CallToolRequest, params *OomdStatusParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := o.Auth.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	limit := params.Kills
+	if limit <= 0 {
+		limit = DefaultKills
+	}
+	res := OomdStatusResult{Cgroups: []Cgroup{}}
+	dump := o.dump
+	if dump == nil {
+		dump = dumpOomd
+	}
+	if text, err := dump(ctx); err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("couldn't query systemd-oomd, it may not be running: %s", err))
+	} else {
+		res.Settings, res.Cgroups = parseDump(text)
+	}
+	for i := range res.Cgroups {
+		// the dump has the averages of the last poll, the pressure files
+		// the current ones
+		if p, err := readPressure(filepath.Join(cgroupRoot, res.Cgroups[i].Path, "memory.pressure")); err == nil {
+			res.Cgroups[i].Pressure = p
+		}
+	}
+	if p, err := readPressure(systemPressure); err == nil {
+		res.SystemPressure = p
+	} else {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("couldn't read the memory pressure of the system: %s", err))
+	}
+	kills, err := o.kills(ctx, limit)
+	if err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("couldn't read the kill events from the journal: %s", err))
+		kills = []Kill{}
+	}
+	res.Kills = kills
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
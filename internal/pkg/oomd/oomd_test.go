@@ -0,0 +1,89 @@
+package oomd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDump = `Dry Run: no
+Swap Used Limit: 90.00%
+Default Memory Pressure Limit: 60.00%
+Default Memory Pressure Duration: 20s
+System Context:
+        Memory: Used: 1.2G Total: 7.7G
+        Swap: Used: 0B Total: 0B
+Swap Monitored CGroups:
+        Path: /
+                Swap Usage: (see System Context)
+Memory Pressure Monitored CGroups:
+        Path: /user.slice/user-1000.slice/user@1000.service
+                Memory Pressure Limit: 50.00%
+                Pressure: Avg10: 0.00 Avg60: 0.00 Avg300: 0.00 Total: 18ms
+                Current Memory Usage: 1.2G
+`
+
+type fakeReader struct {
+	entries []map[string]string
+}
+
+func (r *fakeReader) Entries(ctx context.Context, matches []string, count int) ([]map[string]string, error) {
+	return r.entries, nil
+}
+
+func TestParseDump(t *testing.T) {
+	settings, cgroups := parseDump(testDump)
+	assert.Equal(t, map[string]string{
+		"Dry Run":                          "no",
+		"Swap Used Limit":                  "90.00%",
+		"Default Memory Pressure Limit":    "60.00%",
+		"Default Memory Pressure Duration": "20s",
+	}, settings)
+	require.Len(t, cgroups, 2)
+	assert.Equal(t, Cgroup{Path: "/", Monitor: "swap", Details: map[string]string{"Swap Usage": "(see System Context)"}}, cgroups[0])
+	assert.Equal(t, "memory_pressure", cgroups[1].Monitor)
+	assert.Equal(t, "/user.slice/user-1000.slice/user@1000.service", cgroups[1].Path)
+	assert.Equal(t, "50.00%", cgroups[1].Details["Memory Pressure Limit"])
+	assert.Equal(t, "1.2G", cgroups[1].Details["Current Memory Usage"])
+}
+
+func TestStatus(t *testing.T) {
+	dir := t.TempDir()
+	cgroupRoot = dir
+	systemPressure = filepath.Join(dir, "pressure")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "user.slice/user-1000.slice/user@1000.service"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "user.slice/user-1000.slice/user@1000.service/memory.pressure"),
+		[]byte("some avg10=12.50 avg60=3.00 avg300=0.50 total=1234\nfull avg10=1.00 avg60=0.00 avg300=0.00 total=56\n"), 0644))
+	require.NoError(t, os.WriteFile(systemPressure, []byte("some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n"), 0644))
+
+	authorization, _ := auth_pkg.NewNoAuth(true, true)
+	o := Oomd{
+		Auth: authorization,
+		Reader: &fakeReader{entries: []map[string]string{
+			{"MESSAGE": "Killed /user.slice/user-1000.slice/user@1000.service/app.slice/build.scope due to memory pressure for /user.slice/user-1000.slice/user@1000.service being 63.20% > 50.00% for > 20s with reclaim activity", "__REALTIME_TIMESTAMP": "1760000000000000"},
+			{"MESSAGE": "Considered 3 cgroups for killing, top candidates were:"},
+			{"MESSAGE": "Killed /system.slice/leak.service due to swap used (95.00%) being over 90.00%", "__REALTIME_TIMESTAMP": "1760000100000000"},
+		}},
+		dump: func(ctx context.Context) (string, error) { return testDump, nil },
+	}
+	_, out, err := o.Status(context.Background(), nil, &OomdStatusParams{Kills: 1})
+	require.NoError(t, err)
+	res := out.(OomdStatusResult)
+	assert.Empty(t, res.Warnings)
+	require.Len(t, res.Cgroups, 2)
+	assert.Nil(t, res.Cgroups[0].Pressure)
+	require.NotNil(t, res.Cgroups[1].Pressure)
+	assert.Equal(t, Pressure{Avg10: 12.5, Avg60: 3, Avg300: 0.5, Total: 1234}, res.Cgroups[1].Pressure.Some)
+	assert.Equal(t, uint64(56), res.Cgroups[1].Pressure.Full.Total)
+	require.NotNil(t, res.SystemPressure)
+	assert.Nil(t, res.SystemPressure.Full)
+	// only the newest kill is returned
+	require.Len(t, res.Kills, 1)
+	assert.Equal(t, "/system.slice/leak.service", res.Kills[0].Cgroup)
+	assert.Equal(t, int64(1760000100), res.Kills[0].Time.Unix())
+}
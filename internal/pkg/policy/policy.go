@@ -0,0 +1,356 @@
+package policy
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"go.yaml.in/yaml/v3"
+)
+
+type Decision string
+
+const (
+	// authorized without asking
+	Allow Decision = "allow"
+	// refused without asking
+	Deny Decision = "deny"
+	// decided by the authorization of the server, e.g. polkit
+	Ask Decision = "ask"
+)
+
+// arguments of the tools which name the units of a call
+var unitArguments = []string{"name", "names", "unit", "units", "target"}
+
+// tools acting on all units if a call names none, with the actions doing so,
+// all actions if nil
+var allUnitsTools = map[string][]string{
+	"change_unit_state": {"reset_failed"},
+	"list_log":          nil,
+	"list_coredumps":    nil,
+}
+
+// Rule decides the calls of the tools matching Tool on the units matching
+// Units with one of the Actions. Empty fields match every call.
+type Rule struct {
+	Tool     string   `json:"tool,omitempty" yaml:"tool,omitempty"`
+	Units    []string `json:"units,omitempty" yaml:"units,omitempty"`
+	Actions  []string `json:"actions,omitempty" yaml:"actions,omitempty"`
+	Decision Decision `json:"decision" yaml:"decision"`
+}
+
+// Policy decides tool calls by the first matching rule, e.g. allow the
+// restart of nginx.service but never stop sshd.service
+type Policy struct {
+	// decision if no rule matches, ask if unset
+	Default Decision `json:"default,omitempty" yaml:"default,omitempty"`
+	Rules   []Rule   `json:"rules" yaml:"rules"`
+	// the units the server is scoped to, added to the ones of
+	// --allowed-units and --denied-units
+	UnitAccess `yaml:",inline"`
+}
+
+// Call is what the policy decides on
+type Call struct {
+	Tool   string
+	Units  []string
+	Action string
+	// the operations of a call which changes the units differently, e.g.
+	// of apply_plan, which are decided one by one
+	Operations []Call
+}
+
+type callKey struct{}
+
+// WithCall returns a context carrying the call the authorization is
+// requested for
+func WithCall(ctx context.Context, call Call) context.Context {
+	return context.WithValue(ctx, callKey{}, call)
+}
+
+func callFromContext(ctx context.Context) (Call, bool) {
+	call, ok := ctx.Value(callKey{}).(Call)
+	return call, ok
+}
+
+func validDecision(d Decision) bool {
+	return d == Allow || d == Deny || d == Ask
+}
+
+// Load reads the policy from a YAML or JSON file
+func Load(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	p := &Policy{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", file, err)
+	}
+	if p.Default == "" {
+		p.Default = Ask
+	}
+	if !validDecision(p.Default) {
+		return nil, fmt.Errorf("invalid default decision %q in %s", p.Default, file)
+	}
+	if _, err := NewUnitAccess(p.Allowed, p.Denied); err != nil {
+		return nil, fmt.Errorf("%w in %s", err, file)
+	}
+	for i, r := range p.Rules {
+		if !validDecision(r.Decision) {
+			return nil, fmt.Errorf("invalid decision %q of rule %d in %s", r.Decision, i+1, file)
+		}
+		for _, pat := range append([]string{r.Tool}, r.Units...) {
+			if _, err := path.Match(pat, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %s of rule %d in %s: %w", pat, i+1, file, err)
+			}
+		}
+	}
+	return p, nil
+}
+
+// matches reports if the rule applies to the call. A deny rule applies if
+// one of the units of the call matches, so that it can't be avoided by
+// adding units to the call, or if the call acts on all units by naming none.
+// The other rules only apply if all units of the call match.
+func (r *Rule) matches(call Call) bool {
+	if r.Tool != "" {
+		if match, _ := path.Match(r.Tool, call.Tool); !match {
+			return false
+		}
+	}
+	if len(r.Actions) > 0 && !slices.Contains(r.Actions, call.Action) {
+		return false
+	}
+	if len(r.Units) > 0 {
+		matchesUnit := func(unit string) bool {
+			return slices.ContainsFunc(r.Units, func(pat string) bool {
+				match, _ := path.Match(pat, unit)
+				return match
+			})
+		}
+		if r.Decision == Deny {
+			return slices.ContainsFunc(call.Units, matchesUnit) || actsOnAllUnits(call)
+		}
+		if len(call.Units) == 0 {
+			return false
+		}
+		for _, unit := range call.Units {
+			if !matchesUnit(unit) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// actsOnAllUnits reports if the call names no units and the tool then acts
+// on all of them, e.g. reset_failed without name
+func actsOnAllUnits(call Call) bool {
+	if len(call.Units) > 0 {
+		return false
+	}
+	actions, ok := allUnitsTools[call.Tool]
+	return ok && (actions == nil || slices.Contains(actions, call.Action))
+}
+
+// Decide returns the decision of the first matching rule, the rule is nil
+// for the default decision. A call with operations is denied if one of
+// them is denied and only allowed if all of them are.
+func (p *Policy) Decide(call Call) (Decision, *Rule) {
+	if len(call.Operations) > 0 {
+		decision, rule := Allow, (*Rule)(nil)
+		for _, op := range call.Operations {
+			switch d, r := p.Decide(op); {
+			case d == Deny:
+				return d, r
+			case d == Ask && decision == Allow:
+				decision, rule = d, r
+			case d == Allow && rule == nil:
+				rule = r
+			}
+		}
+		return decision, rule
+	}
+	for i := range p.Rules {
+		if p.Rules[i].matches(call) {
+			return p.Rules[i].Decision, &p.Rules[i]
+		}
+	}
+	return cmp.Or(p.Default, Ask), nil
+}
+
+// reason returns the decision of the call and the description of the rule
+// deciding it
+func (p *Policy) reason(call Call) (Decision, string) {
+	decision, rule := p.Decide(call)
+	if rule == nil {
+		return decision, fmt.Sprintf("default decision %s of the policy", decision)
+	}
+	return decision, fmt.Sprintf("policy rule %s %s of units %v with actions %v", decision, cmp.Or(rule.Tool, "*"), rule.Units, rule.Actions)
+}
+
+// Check returns the error of a denied call, e.g. for the calls of a batch
+func (p *Policy) Check(call Call) error {
+	if p == nil {
+		return nil
+	}
+	if decision, reason := p.reason(call); decision == Deny {
+		return deniedError(reason)
+	}
+	return nil
+}
+
+func deniedError(reason string) error {
+	return &auth.AuthError{Code: auth.AuthDenied, Message: fmt.Sprintf("denied by %s", reason), Hint: "change the rules of the policy file"}
+}
+
+// manifest holds the parts of a manifest of apply_state the policy decides
+// on
+type manifest struct {
+	Units []struct {
+		Name    string `yaml:"name"`
+		Enabled *bool  `yaml:"enabled"`
+		Active  *bool  `yaml:"active"`
+		DropIns []struct {
+			Content string `yaml:"content"`
+		} `yaml:"dropins"`
+	} `yaml:"units"`
+}
+
+// operations returns the changes of the units of apply_plan and apply_state
+// as calls, with the names of the operations of apply_plan as actions
+func operations(tool string, v map[string]any) []Call {
+	var ops []Call
+	if list, ok := v["operations"].([]any); ok {
+		for _, elem := range list {
+			op, _ := elem.(map[string]any)
+			unit, _ := op["unit"].(string)
+			action, _ := op["op"].(string)
+			ops = append(ops, Call{Tool: tool, Units: []string{unit}, Action: action})
+		}
+	}
+	if data, ok := v["manifest"].(string); ok {
+		var m manifest
+		yaml.Unmarshal([]byte(data), &m)
+		for _, unit := range m.Units {
+			add := func(action string) {
+				ops = append(ops, Call{Tool: tool, Units: []string{unit.Name}, Action: action})
+			}
+			switch {
+			case unit.Enabled == nil:
+			case *unit.Enabled:
+				add("enable")
+			default:
+				add("disable")
+			}
+			switch {
+			case unit.Active == nil:
+			case *unit.Active:
+				add("start")
+			default:
+				add("stop")
+			}
+			// drop-ins without content are removed
+			for _, d := range unit.DropIns {
+				if d.Content == "" {
+					add("remove_dropin")
+				} else {
+					add("write_dropin")
+				}
+			}
+		}
+	}
+	return ops
+}
+
+// CallFromArguments extracts the units and the action of a tool call, the
+// operations of apply_plan and the units of the manifest of apply_state are
+// the operations of the call
+func CallFromArguments(tool string, args json.RawMessage) Call {
+	call := Call{Tool: tool}
+	var v map[string]any
+	json.Unmarshal(args, &v)
+	call.Operations = operations(tool, v)
+	for _, key := range unitArguments {
+		switch val := v[key].(type) {
+		case string:
+			if val != "" {
+				call.Units = append(call.Units, val)
+			}
+		case []any:
+			for _, elem := range val {
+				if s, ok := elem.(string); ok && s != "" {
+					call.Units = append(call.Units, s)
+				}
+			}
+		}
+	}
+	call.Action, _ = v["action"].(string)
+	return call
+}
+
+// Middleware passes the tool calls in the context to the authorization
+func (p *Policy) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if call, ok := req.(*mcp.CallToolRequest); ok && call.Params != nil {
+			ctx = WithCall(ctx, CallFromArguments(call.Params.Name, call.Params.Arguments))
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// Keeper applies the policy before the authorization of the server, which
+// only decides the calls the policy asks for
+type Keeper struct {
+	auth.AuthKeeper
+	Policy *Policy
+}
+
+func NewKeeper(next auth.AuthKeeper, p *Policy) *Keeper {
+	return &Keeper{AuthKeeper: next, Policy: p}
+}
+
+// decide returns the decision for the call in the context, without call
+// the authorization of the server decides
+func (k *Keeper) decide(ctx context.Context) (Decision, string) {
+	call, ok := callFromContext(ctx)
+	if !ok {
+		return Ask, ""
+	}
+	return k.Policy.reason(call)
+}
+
+func (k *Keeper) authorize(ctx context.Context, next func(context.Context) (bool, error)) (bool, error) {
+	switch decision, reason := k.decide(ctx); decision {
+	case Allow:
+		return true, nil
+	case Deny:
+		return false, deniedError(reason)
+	}
+	return next(ctx)
+}
+
+func (k *Keeper) IsReadAuthorized(ctx context.Context) (bool, error) {
+	return k.authorize(ctx, k.AuthKeeper.IsReadAuthorized)
+}
+
+func (k *Keeper) IsWriteAuthorized(ctx context.Context) (bool, error) {
+	return k.authorize(ctx, k.AuthKeeper.IsWriteAuthorized)
+}
+
+func (k *Keeper) Preview(ctx context.Context, write bool) (auth.Preview, error) {
+	switch decision, reason := k.decide(ctx); decision {
+	case Allow:
+		return auth.Preview{Allowed: true, Mechanism: "policy", Reason: "allowed by " + reason}, nil
+	case Deny:
+		return auth.Preview{Allowed: false, Mechanism: "policy", Reason: "denied by " + reason}, nil
+	}
+	return k.AuthKeeper.Preview(ctx, write)
+}
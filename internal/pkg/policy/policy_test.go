@@ -0,0 +1,185 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+default: ask
+rules:
+  - tool: change_unit_state
+    units: ["nginx*.service"]
+    actions: [restart, reload]
+    decision: allow
+  - tool: change_unit_state
+    units: [sshd.service]
+    actions: [stop, stop_kill, disable]
+    decision: deny
+  - tool: list_*
+    decision: allow
+`
+
+func loadPolicy(t *testing.T, content string) (*Policy, error) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	return Load(file)
+}
+
+func TestDecide(t *testing.T) {
+	p, err := loadPolicy(t, testPolicy)
+	require.NoError(t, err)
+	tests := []struct {
+		call Call
+		want Decision
+	}{
+		{Call{Tool: "change_unit_state", Units: []string{"nginx.service"}, Action: "restart"}, Allow},
+		{Call{Tool: "change_unit_state", Units: []string{"nginx.service", "nginx-cache.service"}, Action: "reload"}, Allow},
+		// all units have to match
+		{Call{Tool: "change_unit_state", Units: []string{"nginx.service", "sshd.service"}, Action: "restart"}, Ask},
+		{Call{Tool: "change_unit_state", Units: []string{"nginx.service"}, Action: "stop"}, Ask},
+		{Call{Tool: "change_unit_state", Units: []string{"sshd.service"}, Action: "stop"}, Deny},
+		// a deny rule applies if one unit matches
+		{Call{Tool: "change_unit_state", Units: []string{"nginx.service", "sshd.service"}, Action: "stop"}, Deny},
+		// operations are decided one by one
+		{Call{Tool: "change_unit_state", Operations: []Call{
+			{Tool: "change_unit_state", Units: []string{"nginx.service"}, Action: "restart"},
+			{Tool: "change_unit_state", Units: []string{"sshd.service"}, Action: "disable"},
+		}}, Deny},
+		{Call{Tool: "change_unit_state", Operations: []Call{
+			{Tool: "change_unit_state", Units: []string{"nginx.service"}, Action: "restart"},
+			{Tool: "change_unit_state", Units: []string{"nginx-cache.service"}, Action: "reload"},
+		}}, Allow},
+		{Call{Tool: "change_unit_state", Operations: []Call{
+			{Tool: "change_unit_state", Units: []string{"nginx.service"}, Action: "restart"},
+			{Tool: "change_unit_state", Units: []string{"sshd.service"}, Action: "restart"},
+		}}, Ask},
+		{Call{Tool: "change_unit_state", Action: "stop"}, Ask},
+		{Call{Tool: "list_log"}, Allow},
+		{Call{Tool: "get_file"}, Ask},
+	}
+	for _, tt := range tests {
+		got, _ := p.Decide(tt.call)
+		assert.Equal(t, tt.want, got, "%+v", tt.call)
+	}
+}
+
+func TestDecideAllUnits(t *testing.T) {
+	p, err := loadPolicy(t, `
+default: allow
+rules:
+  - units: [sshd.service]
+    decision: deny
+`)
+	require.NoError(t, err)
+	tests := []struct {
+		call Call
+		want Decision
+	}{
+		// the calls without unit include sshd.service
+		{Call{Tool: "change_unit_state", Action: "reset_failed"}, Deny},
+		{Call{Tool: "list_log"}, Deny},
+		{Call{Tool: "list_coredumps"}, Deny},
+		{Call{Tool: "change_unit_state", Units: []string{"nginx.service"}, Action: "reset_failed"}, Allow},
+		{Call{Tool: "list_log", Units: []string{"nginx.service"}}, Allow},
+		// the other actions need a unit
+		{Call{Tool: "change_unit_state", Action: "stop"}, Allow},
+		{Call{Tool: "get_file"}, Allow},
+	}
+	for _, tt := range tests {
+		got, _ := p.Decide(tt.call)
+		assert.Equal(t, tt.want, got, "%+v", tt.call)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	p, err := loadPolicy(t, `{"rules": [{"tool": "switch_target", "decision": "deny"}]}`)
+	require.NoError(t, err)
+	assert.Equal(t, Ask, p.Default)
+	require.Len(t, p.Rules, 1)
+
+	_, err = loadPolicy(t, "rules:\n  - tool: get_file\n    decision: maybe\n")
+	assert.ErrorContains(t, err, "invalid decision")
+	_, err = loadPolicy(t, "default: never\n")
+	assert.ErrorContains(t, err, "invalid default")
+	_, err = loadPolicy(t, "rules:\n  - units: ['[']\n    decision: deny\n")
+	assert.ErrorContains(t, err, "invalid pattern")
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestCallFromArguments(t *testing.T) {
+	call := CallFromArguments("change_unit_state", json.RawMessage(`{"name":"nginx.service","action":"restart"}`))
+	assert.Equal(t, Call{Tool: "change_unit_state", Units: []string{"nginx.service"}, Action: "restart"}, call)
+	call = CallFromArguments("show_unit", json.RawMessage(`{"names":["a.service","b.service"]}`))
+	assert.Equal(t, []string{"a.service", "b.service"}, call.Units)
+
+	call = CallFromArguments("apply_plan", json.RawMessage(`{"operations":[{"op":"write_dropin","unit":"nginx.service","name":"a.conf"},{"op":"stop","unit":"sshd.service"}]}`))
+	assert.Equal(t, []Call{
+		{Tool: "apply_plan", Units: []string{"nginx.service"}, Action: "write_dropin"},
+		{Tool: "apply_plan", Units: []string{"sshd.service"}, Action: "stop"},
+	}, call.Operations)
+
+	manifest := "units:\n  - name: sshd.service\n    enabled: false\n    active: false\n  - name: nginx.service\n    dropins:\n      - name: a.conf\n        content: x\n"
+	args, _ := json.Marshal(map[string]any{"manifest": manifest, "apply": true})
+	call = CallFromArguments("apply_state", args)
+	assert.Equal(t, []Call{
+		{Tool: "apply_state", Units: []string{"sshd.service"}, Action: "disable"},
+		{Tool: "apply_state", Units: []string{"sshd.service"}, Action: "stop"},
+		{Tool: "apply_state", Units: []string{"nginx.service"}, Action: "write_dropin"},
+	}, call.Operations)
+}
+
+func TestKeeper(t *testing.T) {
+	p, err := loadPolicy(t, testPolicy)
+	require.NoError(t, err)
+	// the server itself denies everything
+	next, _ := auth_pkg.NewNoAuth(false, false)
+	k := NewKeeper(next, p)
+	var gotCtx context.Context
+	handler := p.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		gotCtx = ctx
+		return &mcp.CallToolResult{}, nil
+	})
+	callCtx := func(name, args string) context.Context {
+		_, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{
+			Params: &mcp.CallToolParamsRaw{Name: name, Arguments: json.RawMessage(args)},
+		})
+		require.NoError(t, err)
+		return gotCtx
+	}
+
+	allowed, err := k.IsWriteAuthorized(callCtx("change_unit_state", `{"name":"nginx.service","action":"restart"}`))
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, err = k.IsWriteAuthorized(callCtx("change_unit_state", `{"name":"sshd.service","action":"stop"}`))
+	assert.ErrorContains(t, err, "denied by policy rule deny change_unit_state")
+	assert.False(t, allowed)
+
+	// asked calls are decided by the server
+	allowed, _ = k.IsWriteAuthorized(callCtx("change_unit_state", `{"name":"sshd.service","action":"restart"}`))
+	assert.False(t, allowed)
+	allowed, _ = k.IsReadAuthorized(context.Background())
+	assert.False(t, allowed)
+
+	allowed, err = k.IsReadAuthorized(callCtx("list_log", `{}`))
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+
+	preview, err := k.Preview(WithCall(context.Background(), Call{Tool: "change_unit_state", Units: []string{"sshd.service"}, Action: "disable"}), true)
+	require.NoError(t, err)
+	assert.False(t, preview.Allowed)
+	assert.Equal(t, "policy", preview.Mechanism)
+	preview, err = k.Preview(WithCall(context.Background(), Call{Tool: "get_file"}), false)
+	require.NoError(t, err)
+	assert.Equal(t, "noauth", preview.Mechanism)
+}
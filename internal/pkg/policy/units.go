@@ -0,0 +1,56 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"slices"
+)
+
+// UnitAccess scopes the server to the units of an application. Units matching
+// a denied pattern are never accessible and if allowed patterns are given,
+// only the units matching them are.
+type UnitAccess struct {
+	Allowed []string `json:"allowed_units,omitempty" yaml:"allowed_units,omitempty"`
+	Denied  []string `json:"denied_units,omitempty" yaml:"denied_units,omitempty"`
+}
+
+// NewUnitAccess checks the glob patterns, without patterns nil is returned
+// which permits all units
+func NewUnitAccess(allowed, denied []string) (*UnitAccess, error) {
+	if len(allowed) == 0 && len(denied) == 0 {
+		return nil, nil
+	}
+	for _, pat := range append(slices.Clone(allowed), denied...) {
+		if _, err := path.Match(pat, ""); err != nil {
+			return nil, fmt.Errorf("invalid unit pattern %s: %w", pat, err)
+		}
+	}
+	return &UnitAccess{Allowed: allowed, Denied: denied}, nil
+}
+
+func matchesAny(patterns []string, unit string) bool {
+	return slices.ContainsFunc(patterns, func(pat string) bool {
+		match, _ := path.Match(pat, unit)
+		return match
+	})
+}
+
+// Permits reports if the unit is accessible, an empty unit, e.g. of a kernel
+// message, is only accessible if no units are allowed explicitly
+func (a *UnitAccess) Permits(unit string) bool {
+	if a == nil {
+		return true
+	}
+	if matchesAny(a.Denied, unit) {
+		return false
+	}
+	return len(a.Allowed) == 0 || matchesAny(a.Allowed, unit)
+}
+
+// Check returns an error if the unit isn't accessible
+func (a *UnitAccess) Check(unit string) error {
+	if !a.Permits(unit) {
+		return fmt.Errorf("unit %s is outside of the units this server may access", unit)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitAccess(t *testing.T) {
+	access, err := NewUnitAccess(nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, access)
+	assert.True(t, access.Permits("sshd.service"))
+
+	access, err = NewUnitAccess([]string{"nginx*.service", "php-fpm.service"}, []string{"nginx-debug.service"})
+	require.NoError(t, err)
+	assert.True(t, access.Permits("nginx.service"))
+	assert.True(t, access.Permits("php-fpm.service"))
+	assert.False(t, access.Permits("nginx-debug.service"))
+	assert.False(t, access.Permits("sshd.service"))
+	// e.g. kernel messages
+	assert.False(t, access.Permits(""))
+	assert.ErrorContains(t, access.Check("sshd.service"), "sshd.service is outside")
+	assert.NoError(t, access.Check("nginx.service"))
+
+	access, err = NewUnitAccess(nil, []string{"sshd.service"})
+	require.NoError(t, err)
+	assert.True(t, access.Permits("nginx.service"))
+	assert.True(t, access.Permits(""))
+	assert.False(t, access.Permits("sshd.service"))
+
+	_, err = NewUnitAccess([]string{"["}, nil)
+	assert.ErrorContains(t, err, "invalid unit pattern")
+}
+
+func TestLoadUnitAccess(t *testing.T) {
+	p, err := loadPolicy(t, "allowed_units: [nginx*.service]\ndenied_units: [nginx-debug.service]\nrules: []\n")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nginx*.service"}, p.Allowed)
+	assert.Equal(t, []string{"nginx-debug.service"}, p.Denied)
+
+	_, err = loadPolicy(t, "denied_units: ['[']\n")
+	assert.ErrorContains(t, err, "invalid unit pattern")
+}
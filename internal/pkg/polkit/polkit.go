@@ -0,0 +1,115 @@
+package polkit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+// Authorizations gives access to the temporary polkit authorizations of the
+// session the server runs in
+type Authorizations struct {
+	Auth      auth.AuthKeeper
+	Authority dbus.Authority
+	// session of the authorizations, the one of the server if empty
+	Session string
+}
+
+type ListAuthorizationsParams struct{}
+
+type RevokeAuthorizationsParams struct {
+	ID string `json:"id,omitempty" jsonschema:"Id of the temporary authorization to revoke. All authorizations of the MCP actions are revoked if empty."`
+}
+
+type AuthorizationsResult struct {
+	Session        string                        `json:"session"`
+	Authorizations []dbus.TemporaryAuthorization `json:"authorizations"`
+}
+
+func CreateListAuthorizationsSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ListAuthorizationsParams](nil)
+	return inputSchema
+}
+
+func CreateRevokeAuthorizationsSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[RevokeAuthorizationsParams](nil)
+	return inputSchema
+}
+
+func (a *Authorizations) session() (string, error) {
+	if a.Session != "" {
+		return a.Session, nil
+	}
+	session, err := dbus.OwnSession()
+	if err != nil {
+		return "", fmt.Errorf("couldn't get the login session of the server: %w", err)
+	}
+	return session, nil
+}
+
+func (a *Authorizations) authority() dbus.Authority {
+	if a.Authority == nil {
+		return dbus.NewAuthority()
+	}
+	return a.Authority
+}
+
+// List returns the temporary authorizations polkit keeps for the actions of
+// the MCP server, e.g. after the user authenticated for starting a unit
+func (a *Authorizations) List(ctx context.Context, req *mcp.CallToolRequest, params *ListAuthorizationsParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := a.Auth.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	session, err := a.session()
+	if err != nil {
+		return nil, nil, err
+	}
+	auths, err := dbus.ListTemporaryAuthorizations(a.authority(), session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return authorizationsResult(session, auths)
+}
+
+// Revoke revokes the temporary authorizations of the MCP actions, so that
+// the user is asked again for the next action. Revoking only drops
+// privileges, so no further authorization is needed.
+func (a *Authorizations) Revoke(ctx context.Context, req *mcp.CallToolRequest, params *RevokeAuthorizationsParams) (*mcp.CallToolResult, any, error) {
+	session, err := a.session()
+	if err != nil {
+		return nil, nil, err
+	}
+	revoked, err := dbus.RevokeTemporaryAuthorizations(a.authority(), session, params.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return authorizationsResult(session, revoked)
+}
+
+func authorizationsResult(session string, auths []dbus.TemporaryAuthorization) (*mcp.CallToolResult, any, error) {
+	res := AuthorizationsResult{
+		Session:        session,
+		Authorizations: auths,
+	}
+	if res.Authorizations == nil {
+		res.Authorizations = []dbus.TemporaryAuthorization{}
+	}
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,60 @@
+package polkit
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAuthority struct {
+	auths   []dbus.TemporaryAuthorization
+	revoked []string
+}
+
+func (f *fakeAuthority) EnumerateTemporaryAuthorizations(sessionID string) ([]dbus.TemporaryAuthorization, error) {
+	return f.auths, nil
+}
+
+func (f *fakeAuthority) RevokeTemporaryAuthorizationById(id string) error {
+	f.revoked = append(f.revoked, id)
+	return nil
+}
+
+func result(t *testing.T, res *mcp.CallToolResult) AuthorizationsResult {
+	require.Len(t, res.Content, 1)
+	var out AuthorizationsResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &out))
+	return out
+}
+
+func TestListAndRevoke(t *testing.T) {
+	authority := &fakeAuthority{auths: []dbus.TemporaryAuthorization{
+		{ID: "tmpauthz1", ActionID: "org.freedesktop.systemd1.manage-units"},
+		{ID: "tmpauthz2", ActionID: "org.freedesktop.login1.reboot"},
+	}}
+	noAuth, _ := auth.NewNoAuth(true, false)
+	a := Authorizations{Auth: noAuth, Authority: authority, Session: "3"}
+
+	res, _, err := a.List(context.Background(), nil, &ListAuthorizationsParams{})
+	require.NoError(t, err)
+	out := result(t, res)
+	assert.Equal(t, "3", out.Session)
+	require.Len(t, out.Authorizations, 1)
+	assert.Equal(t, "tmpauthz1", out.Authorizations[0].ID)
+
+	res, _, err = a.Revoke(context.Background(), nil, &RevokeAuthorizationsParams{})
+	require.NoError(t, err)
+	assert.Len(t, result(t, res).Authorizations, 1)
+	assert.Equal(t, []string{"tmpauthz1"}, authority.revoked)
+
+	denied, _ := auth.NewNoAuth(false, false)
+	a.Auth = denied
+	_, _, err = a.List(context.Background(), nil, &ListAuthorizationsParams{})
+	assert.Error(t, err)
+}
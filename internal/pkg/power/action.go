@@ -0,0 +1,154 @@
+package power
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+)
+
+// PowerActionPermission is the polkit action for rebooting, powering off and
+// suspending the host, it is separate from the other write actions as it
+// takes down the host together with the server
+const PowerActionPermission = "com.suse.gatekeeper.power"
+
+const logindManager = "org.freedesktop.login1.Manager"
+
+// logind methods of the actions and the methods checking them
+var powerActions = map[string]struct {
+	can    string
+	method string
+}{
+	"reboot":    {"CanReboot", "Reboot"},
+	"poweroff":  {"CanPowerOff", "PowerOff"},
+	"suspend":   {"CanSuspend", "Suspend"},
+	"hibernate": {"CanHibernate", "Hibernate"},
+}
+
+func ValidPowerActions() []string {
+	return []string{"reboot", "poweroff", "suspend", "hibernate", "schedule_shutdown", "cancel_shutdown"}
+}
+
+func ValidShutdownTypes() []string {
+	return []string{"poweroff", "reboot", "halt"}
+}
+
+type PowerActionParams struct {
+	Action  string `json:"action" jsonschema:"Action to perform. 'schedule_shutdown' shuts down after the delay and 'cancel_shutdown' cancels a scheduled shutdown."`
+	Type    string `json:"type,omitempty" jsonschema:"Kind of the scheduled shutdown. Defaults to 'poweroff'."`
+	Minutes uint   `json:"minutes,omitempty" jsonschema:"Delay of the scheduled shutdown in minutes."`
+	Message string `json:"message,omitempty" jsonschema:"Wall message sent to the logged in users before the shutdown."`
+	Confirm bool   `json:"confirm,omitempty" jsonschema:"Must be true, all actions but cancel_shutdown interrupt the host and the server."`
+}
+
+func CreatePowerActionSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[PowerActionParams](nil)
+	var actions, types []any
+	for _, a := range ValidPowerActions() {
+		actions = append(actions, a)
+	}
+	for _, t := range ValidShutdownTypes() {
+		types = append(types, t)
+	}
+	inputSchema.Properties["action"].Enum = actions
+	inputSchema.Properties["type"].Enum = types
+	inputSchema.Properties["type"].Default = json.RawMessage("\"poweroff\"")
+	return inputSchema
+}
+
+// IsInterruptingAction reports by the arguments of power_action if the call
+// interrupts the host, all actions but cancel_shutdown do
+func IsInterruptingAction(args map[string]any) bool {
+	action, _ := args["action"].(string)
+	return action != "cancel_shutdown"
+}
+
+// checkPowerAction validates the parameters before anything is authorized
+func checkPowerAction(params *PowerActionParams) error {
+	if !slices.Contains(ValidPowerActions(), params.Action) {
+		return fmt.Errorf("invalid action: %s, valid values are %v", params.Action, ValidPowerActions())
+	}
+	if params.Type != "" && !slices.Contains(ValidShutdownTypes(), params.Type) {
+		return fmt.Errorf("invalid shutdown type: %s, valid values are %v", params.Type, ValidShutdownTypes())
+	}
+	if params.Action != "cancel_shutdown" && !params.Confirm {
+		return fmt.Errorf("%s interrupts the host and this server, call again with confirm set to true if this is intended", params.Action)
+	}
+	return nil
+}
+
+// Action reboots, powers off or suspends the host or schedules a shutdown
+// with logind. It needs the confirm argument and its own polkit action.
+func (p *Power) Action(ctx context.Context, req *mcp.CallToolRequest, params *PowerActionParams) (*mcp.CallToolResult, any, error) {
+	if err := checkPowerAction(params); err != nil {
+		return nil, nil, err
+	}
+	allowed, err := p.Auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, PowerActionPermission))
+	if !allowed || err != nil {
+		slog.Debug("PowerAction wasn't authorized", "reason", err)
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+	}
+	defer p.Auth.Deauthorize()
+
+	bus, err := godbus.ConnectSystemBus(godbus.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer bus.Close()
+	obj := bus.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+	if params.Message != "" {
+		if err := obj.CallWithContext(ctx, logindManager+".SetWallMessage", 0, params.Message, true).Store(); err != nil {
+			return nil, nil, fmt.Errorf("failed to set the wall message: %w", err)
+		}
+	}
+
+	var msg string
+	switch params.Action {
+	case "schedule_shutdown":
+		kind := params.Type
+		if kind == "" {
+			kind = "poweroff"
+		}
+		at := time.Now().Add(time.Duration(params.Minutes) * time.Minute)
+		if err := obj.CallWithContext(ctx, logindManager+".ScheduleShutdown", 0, kind, uint64(at.UnixMicro())).Store(); err != nil {
+			return nil, nil, fmt.Errorf("error when scheduling the %s: %w", kind, err)
+		}
+		msg = fmt.Sprintf("scheduled %s at %s", kind, at.Format(time.RFC3339))
+	case "cancel_shutdown":
+		var cancelled bool
+		if err := obj.CallWithContext(ctx, logindManager+".CancelScheduledShutdown", 0).Store(&cancelled); err != nil {
+			return nil, nil, fmt.Errorf("error when cancelling the shutdown: %w", err)
+		}
+		msg = "cancelled the scheduled shutdown"
+		if !cancelled {
+			msg = "no shutdown was scheduled"
+		}
+	default:
+		action := powerActions[params.Action]
+		var can string
+		if err := obj.CallWithContext(ctx, logindManager+"."+action.can, 0).Store(&can); err != nil {
+			return nil, nil, fmt.Errorf("failed to check if %s is possible: %w", params.Action, err)
+		}
+		if can != "yes" {
+			return nil, nil, fmt.Errorf("logind refuses %s: %s answered %q", params.Action, action.can, can)
+		}
+		if err := obj.CallWithContext(ctx, logindManager+"."+action.method, 0, false).Store(); err != nil {
+			return nil, nil, fmt.Errorf("error when calling %s: %w", action.method, err)
+		}
+		msg = fmt.Sprintf("%s initiated", params.Action)
+	}
+	slog.Info("power action", "action", params.Action, "result", msg)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: msg},
+		},
+	}, util.Message{Message: msg}, nil
+}
@@ -0,0 +1,112 @@
+package power
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// operations the lock types of the inhibitors hold off
+var inhibitedOperations = map[string]string{
+	"shutdown":             "reboot and poweroff",
+	"sleep":                "suspend and hibernate",
+	"idle":                 "the automatic idle action",
+	"handle-power-key":     "the handling of the power key",
+	"handle-suspend-key":   "the handling of the suspend key",
+	"handle-hibernate-key": "the handling of the hibernate key",
+	"handle-lid-switch":    "the handling of the lid switch",
+	"handle-reboot-key":    "the handling of the reboot key",
+}
+
+type ListInhibitorsParams struct {
+	What string `json:"what,omitempty" jsonschema:"Only list the inhibitors of this lock type, e.g. 'shutdown' or 'sleep'."`
+}
+
+type ListInhibitorsResult struct {
+	Inhibitors []Inhibitor `json:"inhibitors"`
+	// what the block inhibitors prevent and what the delay inhibitors hold off
+	Explanation []string `json:"explanation,omitempty"`
+}
+
+func CreateListInhibitorsSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ListInhibitorsParams](nil)
+	var whats []any
+	for what := range inhibitedOperations {
+		whats = append(whats, what)
+	}
+	slices.SortFunc(whats, func(a, b any) int { return strings.Compare(a.(string), b.(string)) })
+	inputSchema.Properties["what"].Enum = whats
+	return inputSchema
+}
+
+// filterInhibitors keeps the inhibitors holding a lock of the type, the
+// lock types of an inhibitor are separated by colons
+func filterInhibitors(inhibitors []Inhibitor, what string) []Inhibitor {
+	return slices.DeleteFunc(inhibitors, func(inh Inhibitor) bool {
+		return !slices.Contains(strings.Split(inh.What, ":"), what)
+	})
+}
+
+// explainInhibitors describes what the inhibitors prevent, so that an agent
+// can tell why e.g. a reboot is refused before forcing it
+func explainInhibitors(inhibitors []Inhibitor) []string {
+	var explanation []string
+	for _, inh := range inhibitors {
+		for _, what := range strings.Split(inh.What, ":") {
+			op, ok := inhibitedOperations[what]
+			if !ok {
+				op = what
+			}
+			verb := "blocks"
+			if inh.Mode == "delay" {
+				verb = "delays"
+			}
+			explanation = append(explanation, fmt.Sprintf("%s (pid %d, uid %d) %s %s: %s", inh.Who, inh.PID, inh.UID, verb, op, inh.Why))
+		}
+	}
+	return explanation
+}
+
+// ListInhibitors lists the inhibitor locks of logind together with what
+// they prevent
+func (p *Power) ListInhibitors(ctx context.Context, req *mcp.CallToolRequest, params *ListInhibitorsParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := p.Auth.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	bus, err := godbus.ConnectSystemBus(godbus.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer bus.Close()
+	inhibitors, err := listInhibitors(ctx, bus.Object("org.freedesktop.login1", "/org/freedesktop/login1"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't list the inhibitors: %w", err)
+	}
+	if params.What != "" {
+		inhibitors = filterInhibitors(inhibitors, params.What)
+	}
+	res := ListInhibitorsResult{
+		Inhibitors:  inhibitors,
+		Explanation: explainInhibitors(inhibitors),
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,382 @@
+package power
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+)
+
+var (
+	powerSupplyDir = "/sys/class/power_supply"
+	thermalDir     = "/sys/class/thermal"
+	sysPowerDir    = "/sys/power"
+	unitDirs       = []string{"/etc/systemd/system", "/run/systemd/system"}
+	sleepConfs     = []string{"/usr/lib/systemd/sleep.conf", "/etc/systemd/sleep.conf"}
+	sleepConfDirs  = []string{"/usr/lib/systemd/sleep.conf.d", "/run/systemd/sleep.conf.d", "/etc/systemd/sleep.conf.d"}
+)
+
+// sleep operations with the target, the sleep.conf setting, the logind
+// method and the kernel state which are needed for it
+var sleepOperations = []struct {
+	name   string
+	target string
+	allow  string
+	method string
+	state  string
+}{
+	{"suspend", "suspend.target", "AllowSuspend", "CanSuspend", "mem"},
+	{"hibernate", "hibernate.target", "AllowHibernation", "CanHibernate", "disk"},
+	{"hybrid-sleep", "hybrid-sleep.target", "AllowHybridSleep", "CanHybridSleep", "disk"},
+	{"suspend-then-hibernate", "suspend-then-hibernate.target", "AllowSuspendThenHibernate", "CanSuspendThenHibernate", "disk"},
+}
+
+type Power struct {
+	Auth auth.AuthKeeper
+}
+
+type PowerStateParams struct{}
+
+type PowerSupply struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Online     *bool  `json:"online,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Capacity   *int   `json:"capacity_percent,omitempty"`
+	Level      string `json:"capacity_level,omitempty"`
+	Health     string `json:"health,omitempty"`
+	Technology string `json:"technology,omitempty"`
+}
+
+type TripPoint struct {
+	Type string  `json:"type"`
+	Temp float64 `json:"temp_celsius"`
+}
+
+type ThermalZone struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"`
+	Temp     float64     `json:"temp_celsius"`
+	Trips    []TripPoint `json:"trip_points,omitempty"`
+	Exceeded []string    `json:"exceeded_trip_points,omitempty"`
+}
+
+type SleepState struct {
+	Operation string `json:"operation"`
+	Target    string `json:"target"`
+	Masked    bool   `json:"masked"`
+	Allowed   bool   `json:"allowed"`
+	Kernel    bool   `json:"kernel_support"`
+	Logind    string `json:"logind,omitempty"`
+}
+
+type Inhibitor struct {
+	What string `json:"what"`
+	Who  string `json:"who"`
+	Why  string `json:"why"`
+	Mode string `json:"mode"`
+	UID  uint32 `json:"uid"`
+	PID  uint32 `json:"pid"`
+}
+
+type PowerStateResult struct {
+	OnAC       *bool         `json:"on_ac,omitempty"`
+	Supplies   []PowerSupply `json:"power_supplies"`
+	Thermal    []ThermalZone `json:"thermal_zones"`
+	Sleep      []SleepState  `json:"sleep"`
+	Inhibitors []Inhibitor   `json:"inhibitors"`
+	Warnings   []string      `json:"warnings,omitempty"`
+}
+
+func CreatePowerStateSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[PowerStateParams](nil)
+	return inputSchema
+}
+
+func readAttr(dir, name string) string {
+	val, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(val))
+}
+
+func readPowerSupplies(dir string) []PowerSupply {
+	supplies := []PowerSupply{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return supplies
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		ps := PowerSupply{
+			Name:       e.Name(),
+			Type:       readAttr(path, "type"),
+			Status:     readAttr(path, "status"),
+			Level:      readAttr(path, "capacity_level"),
+			Health:     readAttr(path, "health"),
+			Technology: readAttr(path, "technology"),
+		}
+		if online := readAttr(path, "online"); online != "" {
+			val := online == "1"
+			ps.Online = &val
+		}
+		if capacity, err := strconv.Atoi(readAttr(path, "capacity")); err == nil {
+			ps.Capacity = &capacity
+		}
+		supplies = append(supplies, ps)
+	}
+	return supplies
+}
+
+// onAC is nil if there is no mains supply, like on most servers
+func onAC(supplies []PowerSupply) *bool {
+	var res *bool
+	for _, ps := range supplies {
+		if ps.Type != "Mains" || ps.Online == nil {
+			continue
+		}
+		online := *ps.Online || (res != nil && *res)
+		res = &online
+	}
+	return res
+}
+
+// the kernel reports temperatures in millidegree celsius
+func milliCelsius(val string) (float64, bool) {
+	temp, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return float64(temp) / 1000, true
+}
+
+func readThermalZones(dir string) []ThermalZone {
+	zones := []ThermalZone{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return zones
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), "thermal_zone") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		temp, ok := milliCelsius(readAttr(path, "temp"))
+		if !ok {
+			continue
+		}
+		zone := ThermalZone{
+			Name: e.Name(),
+			Type: readAttr(path, "type"),
+			Temp: temp,
+		}
+		for i := 0; ; i++ {
+			tripType := readAttr(path, fmt.Sprintf("trip_point_%d_type", i))
+			if tripType == "" {
+				break
+			}
+			tripTemp, ok := milliCelsius(readAttr(path, fmt.Sprintf("trip_point_%d_temp", i)))
+			if !ok || tripTemp <= 0 {
+				continue
+			}
+			zone.Trips = append(zone.Trips, TripPoint{Type: tripType, Temp: tripTemp})
+			if temp >= tripTemp {
+				zone.Exceeded = append(zone.Exceeded, tripType)
+			}
+		}
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+// targetMasked checks if the target is linked to /dev/null
+func targetMasked(dirs []string, target string) bool {
+	for _, dir := range dirs {
+		if dest, err := os.Readlink(filepath.Join(dir, target)); err == nil && dest == "/dev/null" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSleepConf reads the [Sleep] settings, later files override earlier
+// ones and drop-ins are applied in lexical order of their names
+func parseSleepConf(confs, dropinDirs []string) map[string]string {
+	files := slices.Clone(confs)
+	dropins := make(map[string]string)
+	for _, dir := range dropinDirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if strings.HasSuffix(e.Name(), ".conf") {
+				dropins[e.Name()] = filepath.Join(dir, e.Name())
+			}
+		}
+	}
+	names := make([]string, 0, len(dropins))
+	for name := range dropins {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		files = append(files, dropins[name])
+	}
+
+	settings := make(map[string]string)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		section := ""
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+				continue
+			}
+			if strings.HasPrefix(line, "[") {
+				section = strings.Trim(line, "[]")
+				continue
+			}
+			if key, val, ok := strings.Cut(line, "="); ok && section == "Sleep" {
+				settings[strings.TrimSpace(key)] = strings.TrimSpace(val)
+			}
+		}
+		f.Close()
+	}
+	return settings
+}
+
+func isTrue(val string) bool {
+	switch strings.ToLower(val) {
+	case "1", "yes", "y", "true", "t", "on":
+		return true
+	}
+	return false
+}
+
+// sleepStates combines the settings which decide if a sleep operation can be
+// used, logind holds the answers of the Can* methods
+func sleepStates(kernelStates []string, settings map[string]string, dirs []string, logind map[string]string) []SleepState {
+	states := []SleepState{}
+	for _, op := range sleepOperations {
+		allowed := true
+		if val, ok := settings[op.allow]; ok {
+			allowed = isTrue(val)
+		}
+		states = append(states, SleepState{
+			Operation: op.name,
+			Target:    op.target,
+			Masked:    targetMasked(dirs, op.target) || targetMasked(dirs, "sleep.target"),
+			Allowed:   allowed,
+			Kernel:    slices.Contains(kernelStates, op.state),
+			Logind:    logind[op.method],
+		})
+	}
+	return states
+}
+
+// queryLogind asks logind which sleep operations are possible and lists
+// the active inhibitors
+func queryLogind(ctx context.Context) (map[string]string, []Inhibitor, error) {
+	bus, err := godbus.ConnectSystemBus(godbus.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer bus.Close()
+	obj := bus.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+	can := make(map[string]string)
+	for _, op := range sleepOperations {
+		var res string
+		if err := obj.CallWithContext(ctx, "org.freedesktop.login1.Manager."+op.method, 0).Store(&res); err == nil {
+			can[op.method] = res
+		}
+	}
+	inhibitors, err := listInhibitors(ctx, obj)
+	return can, inhibitors, err
+}
+
+// listInhibitors returns the inhibitor locks logind holds
+func listInhibitors(ctx context.Context, obj godbus.BusObject) ([]Inhibitor, error) {
+	var list [][]interface{}
+	if err := obj.CallWithContext(ctx, "org.freedesktop.login1.Manager.ListInhibitors", 0).Store(&list); err != nil {
+		return nil, err
+	}
+	inhibitors := []Inhibitor{}
+	for _, entry := range list {
+		if len(entry) != 6 {
+			continue
+		}
+		inh := Inhibitor{}
+		inh.What, _ = entry[0].(string)
+		inh.Who, _ = entry[1].(string)
+		inh.Why, _ = entry[2].(string)
+		inh.Mode, _ = entry[3].(string)
+		inh.UID, _ = entry[4].(uint32)
+		inh.PID, _ = entry[5].(uint32)
+		inhibitors = append(inhibitors, inh)
+	}
+	return inhibitors, nil
+}
+
+// State reports the AC and battery state, the thermal zones and if the
+// sleep targets are usable or inhibited
+func (p *Power) State(ctx context.Context, req *mcp.CallToolRequest, params *PowerStateParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := p.Auth.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	res := PowerStateResult{
+		Supplies:   readPowerSupplies(powerSupplyDir),
+		Thermal:    readThermalZones(thermalDir),
+		Inhibitors: []Inhibitor{},
+	}
+	res.OnAC = onAC(res.Supplies)
+	for _, ps := range res.Supplies {
+		if ps.Type == "Battery" && ps.Level == "Critical" {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("battery %s is at a critical level", ps.Name))
+		}
+	}
+	for _, zone := range res.Thermal {
+		if len(zone.Exceeded) > 0 {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("thermal zone %s (%s) at %.1f°C exceeds trip points %s", zone.Name, zone.Type, zone.Temp, strings.Join(zone.Exceeded, " ")))
+		}
+	}
+
+	logind, inhibitors, err := queryLogind(ctx)
+	if err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("couldn't query logind: %s", err))
+	}
+	if inhibitors != nil {
+		res.Inhibitors = inhibitors
+	}
+	res.Sleep = sleepStates(strings.Fields(readAttr(sysPowerDir, "state")),
+		parseSleepConf(sleepConfs, sleepConfDirs), unitDirs, logind)
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,112 @@
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeAttrs(t *testing.T, dir string, attrs map[string]string) {
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	for name, val := range attrs {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(val+"\n"), 0644))
+	}
+}
+
+func TestReadPowerSupplies(t *testing.T) {
+	dir := t.TempDir()
+	writeAttrs(t, filepath.Join(dir, "AC"), map[string]string{"type": "Mains", "online": "0"})
+	writeAttrs(t, filepath.Join(dir, "BAT0"), map[string]string{"type": "Battery", "status": "Discharging", "capacity": "4", "capacity_level": "Critical"})
+
+	supplies := readPowerSupplies(dir)
+	require.Len(t, supplies, 2)
+	assert.Equal(t, "AC", supplies[0].Name)
+	require.NotNil(t, supplies[0].Online)
+	assert.False(t, *supplies[0].Online)
+	require.NotNil(t, supplies[1].Capacity)
+	assert.Equal(t, 4, *supplies[1].Capacity)
+	assert.Equal(t, "Discharging", supplies[1].Status)
+
+	ac := onAC(supplies)
+	require.NotNil(t, ac)
+	assert.False(t, *ac)
+	assert.Nil(t, onAC(nil))
+	assert.Empty(t, readPowerSupplies(filepath.Join(dir, "missing")))
+}
+
+func TestReadThermalZones(t *testing.T) {
+	dir := t.TempDir()
+	writeAttrs(t, filepath.Join(dir, "thermal_zone0"), map[string]string{
+		"type": "x86_pkg_temp", "temp": "91500",
+		"trip_point_0_type": "passive", "trip_point_0_temp": "90000",
+		"trip_point_1_type": "critical", "trip_point_1_temp": "105000",
+	})
+	writeAttrs(t, filepath.Join(dir, "cooling_device0"), map[string]string{"type": "Processor"})
+
+	zones := readThermalZones(dir)
+	require.Len(t, zones, 1)
+	assert.Equal(t, 91.5, zones[0].Temp)
+	assert.Len(t, zones[0].Trips, 2)
+	assert.Equal(t, []string{"passive"}, zones[0].Exceeded)
+}
+
+func TestSleepStates(t *testing.T) {
+	units := t.TempDir()
+	require.NoError(t, os.Symlink("/dev/null", filepath.Join(units, "hibernate.target")))
+	etc := t.TempDir()
+	conf := filepath.Join(etc, "sleep.conf")
+	require.NoError(t, os.WriteFile(conf, []byte("[Sleep]\nAllowSuspend=yes\nAllowHybridSleep=no\n"), 0644))
+	dropins := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dropins, "10-nosuspend.conf"), []byte("[Sleep]\nAllowSuspend=no\n"), 0644))
+
+	settings := parseSleepConf([]string{conf, filepath.Join(etc, "missing.conf")}, []string{dropins})
+	assert.Equal(t, map[string]string{"AllowSuspend": "no", "AllowHybridSleep": "no"}, settings)
+
+	states := sleepStates([]string{"freeze", "mem"}, settings, []string{units}, map[string]string{"CanSuspend": "na"})
+	require.Len(t, states, 4)
+	assert.Equal(t, SleepState{Operation: "suspend", Target: "suspend.target", Allowed: false, Kernel: true, Logind: "na"}, states[0])
+	assert.True(t, states[1].Masked)
+	assert.True(t, states[1].Allowed)
+	assert.False(t, states[1].Kernel)
+	assert.False(t, states[2].Allowed)
+}
+
+func TestCheckPowerAction(t *testing.T) {
+	assert.Error(t, checkPowerAction(&PowerActionParams{Action: "dance", Confirm: true}))
+	assert.Error(t, checkPowerAction(&PowerActionParams{Action: "schedule_shutdown", Type: "kexec", Confirm: true}))
+	err := checkPowerAction(&PowerActionParams{Action: "reboot"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "confirm")
+	assert.NoError(t, checkPowerAction(&PowerActionParams{Action: "reboot", Confirm: true}))
+	assert.NoError(t, checkPowerAction(&PowerActionParams{Action: "schedule_shutdown", Type: "reboot", Minutes: 10, Confirm: true}))
+	assert.NoError(t, checkPowerAction(&PowerActionParams{Action: "cancel_shutdown"}))
+	for name := range powerActions {
+		assert.Contains(t, ValidPowerActions(), name)
+	}
+	assert.True(t, IsInterruptingAction(map[string]any{"action": "reboot"}))
+	assert.False(t, IsInterruptingAction(map[string]any{"action": "cancel_shutdown"}))
+}
+
+func TestInhibitors(t *testing.T) {
+	inhibitors := []Inhibitor{
+		{What: "shutdown:sleep", Who: "backup", Why: "nightly backup", Mode: "block", UID: 0, PID: 42},
+		{What: "sleep", Who: "NetworkManager", Why: "disconnect first", Mode: "delay", UID: 0, PID: 7},
+		{What: "handle-lid-switch", Who: "gdm", Why: "login screen", Mode: "block", UID: 120, PID: 99},
+	}
+	assert.Equal(t, []string{
+		"backup (pid 42, uid 0) blocks reboot and poweroff: nightly backup",
+		"backup (pid 42, uid 0) blocks suspend and hibernate: nightly backup",
+		"NetworkManager (pid 7, uid 0) delays suspend and hibernate: disconnect first",
+		"gdm (pid 99, uid 120) blocks the handling of the lid switch: login screen",
+	}, explainInhibitors(inhibitors))
+
+	shutdown := filterInhibitors(slices.Clone(inhibitors), "shutdown")
+	require.Len(t, shutdown, 1)
+	assert.Equal(t, "backup", shutdown[0].Who)
+	assert.Len(t, filterInhibitors(slices.Clone(inhibitors), "sleep"), 2)
+	assert.Empty(t, filterInhibitors(slices.Clone(inhibitors), "idle"))
+}
@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"golang.org/x/time/rate"
+)
+
+// Limiter limits the tool calls with a token bucket per session and tool and
+// caps the calls running at the same time, so that a client calling a tool
+// in a loop can't saturate dbus or the journal
+type Limiter struct {
+	// calls per second and burst of the tools without own rate, a rate of
+	// 0 doesn't limit them
+	rate  rate.Limit
+	burst int
+	tools map[string]rate.Limit
+	mu    sync.Mutex
+	// buckets by session id and tool
+	buckets map[string]map[string]*rate.Limiter
+	// holds a token per running call, nil if the calls aren't capped
+	running chan struct{}
+}
+
+// New limits every session to perSecond calls of each tool with the given
+// burst, maxConcurrent caps the calls running at the same time of all
+// sessions. Zero values disable the limits.
+func New(perSecond float64, burst, maxConcurrent int) *Limiter {
+	l := &Limiter{
+		rate:    rate.Limit(perSecond),
+		burst:   max(burst, 1),
+		tools:   make(map[string]rate.Limit),
+		buckets: make(map[string]map[string]*rate.Limiter),
+	}
+	if maxConcurrent > 0 {
+		l.running = make(chan struct{}, maxConcurrent)
+	}
+	return l
+}
+
+// SetToolRates sets the rates of single tools given as tool=calls per
+// second, e.g. list_units=0.5, a rate of 0 doesn't limit the tool
+func (l *Limiter) SetToolRates(rates []string) error {
+	for _, r := range rates {
+		tool, perSecond, ok := strings.Cut(r, "=")
+		if !ok || tool == "" {
+			return fmt.Errorf("invalid tool rate %q, use TOOL=CALLS_PER_SECOND", r)
+		}
+		f, err := strconv.ParseFloat(perSecond, 64)
+		if err != nil || f < 0 {
+			return fmt.Errorf("invalid tool rate %q, use TOOL=CALLS_PER_SECOND", r)
+		}
+		l.tools[tool] = rate.Limit(f)
+	}
+	return nil
+}
+
+// bucket returns the bucket of the tool in the session, nil if the tool
+// isn't limited
+func (l *Limiter) bucket(session, tool string) *rate.Limiter {
+	limit, ok := l.tools[tool]
+	if !ok {
+		limit = l.rate
+	}
+	if limit == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tools := l.buckets[session]
+	if tools == nil {
+		tools = make(map[string]*rate.Limiter)
+		l.buckets[session] = tools
+	}
+	b := tools[tool]
+	if b == nil {
+		b = rate.NewLimiter(limit, l.burst)
+		tools[tool] = b
+	}
+	return b
+}
+
+// Forget drops the buckets of an ended session
+func (l *Limiter) Forget(session string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.buckets, session)
+}
+
+// Allow takes a token of the bucket of the tool in the session, if the
+// bucket is empty an error telling when to retry is returned
+func (l *Limiter) Allow(session, tool string, now time.Time) error {
+	b := l.bucket(session, tool)
+	if b == nil {
+		return nil
+	}
+	r := b.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return fmt.Errorf("rate limit of %s exceeded, retry in %s", tool, delay.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// acquire waits until less than the maximum of calls are running, the
+// returned func ends the call
+func (l *Limiter) acquire(ctx context.Context) (func(), error) {
+	if l.running == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.running <- struct{}{}:
+		return func() { <-l.running }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Middleware refuses the tool calls exceeding the rate of the tool and
+// delays the calls exceeding the maximum of running calls
+func (l *Limiter) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || call.Params == nil {
+			return next(ctx, method, req)
+		}
+		var session string
+		if call.Session != nil {
+			session = call.Session.ID()
+		}
+		if err := l.Allow(session, call.Params.Name, time.Now()); err != nil {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+			}, nil
+		}
+		release, err := l.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return next(ctx, method, req)
+	}
+}
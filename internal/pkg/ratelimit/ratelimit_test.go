@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllow(t *testing.T) {
+	l := New(1, 2, 0)
+	require.NoError(t, l.SetToolRates([]string{"show_unit=0"}))
+	now := time.Now()
+
+	// the burst is allowed, then one call per second
+	assert.NoError(t, l.Allow("s1", "list_units", now))
+	assert.NoError(t, l.Allow("s1", "list_units", now))
+	assert.ErrorContains(t, l.Allow("s1", "list_units", now), "rate limit of list_units exceeded, retry in 1s")
+	assert.NoError(t, l.Allow("s1", "list_units", now.Add(time.Second)))
+
+	// other tools and sessions have their own buckets
+	assert.NoError(t, l.Allow("s1", "list_log", now))
+	assert.NoError(t, l.Allow("s2", "list_units", now))
+	// tools without rate aren't limited
+	for range 10 {
+		assert.NoError(t, l.Allow("s1", "show_unit", now))
+	}
+
+	l.Forget("s1")
+	assert.NoError(t, l.Allow("s1", "list_units", now))
+}
+
+func TestSetToolRates(t *testing.T) {
+	l := New(0, 0, 0)
+	for _, invalid := range []string{"list_units", "=1", "list_units=fast", "list_units=-1"} {
+		assert.Error(t, l.SetToolRates([]string{invalid}), invalid)
+	}
+	// without rates nothing is limited
+	for range 10 {
+		assert.NoError(t, l.Allow("", "list_units", time.Now()))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l := New(1000, 1000, 2)
+	var running, maxRunning atomic.Int32
+	handler := l.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return &mcp.CallToolResult{}, nil
+	})
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Go(func() {
+			_, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_units"}})
+			assert.NoError(t, err)
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), maxRunning.Load())
+
+	// calls over the rate are refused with a tool error
+	l = New(1, 1, 0)
+	call := &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_units"}}
+	handler = l.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		return &mcp.CallToolResult{}, nil
+	})
+	result, err := handler(context.Background(), "tools/call", call)
+	require.NoError(t, err)
+	assert.False(t, result.(*mcp.CallToolResult).IsError)
+	result, err = handler(context.Background(), "tools/call", call)
+	require.NoError(t, err)
+	assert.True(t, result.(*mcp.CallToolResult).IsError)
+}
@@ -0,0 +1,56 @@
+package redact
+
+import "encoding/json"
+
+const Placeholder = "[redacted]"
+
+// Secrets are the arguments which grant access
+var Secrets = []string{"delegation", "token", "confirmation_token"}
+
+// Contents are the arguments carrying the content of files, which can be
+// large and contain credentials
+var Contents = []string{"content", "manifest"}
+
+// Arguments replaces the values of the keys at any depth of the arguments,
+// e.g. also in the operations of apply_plan or the calls of batch. The
+// arguments are returned unchanged if nothing was replaced.
+func Arguments(args json.RawMessage, keys ...[]string) json.RawMessage {
+	var v any
+	if err := json.Unmarshal(args, &v); err != nil {
+		return args
+	}
+	sensitive := make(map[string]bool)
+	for _, list := range keys {
+		for _, key := range list {
+			sensitive[key] = true
+		}
+	}
+	if !replace(v, sensitive) {
+		return args
+	}
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// replace replaces the sensitive values in place and reports if it did
+func replace(v any, sensitive map[string]bool) bool {
+	replaced := false
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if sensitive[key] {
+				v[key] = Placeholder
+				replaced = true
+			} else if replace(value, sensitive) {
+				replaced = true
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if replace(value, sensitive) {
+				replaced = true
+			}
+		}
+	}
+	return replaced
+}
@@ -0,0 +1,22 @@
+package redact
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArguments(t *testing.T) {
+	args := json.RawMessage(`{"operations":[{"op":"write_dropin","unit":"nginx.service","content":"[Service]\nEnvironment=KEY=secret"}],"confirmation_token":"abc"}`)
+	assert.JSONEq(t, `{"operations":[{"op":"write_dropin","unit":"nginx.service","content":"[redacted]"}],"confirmation_token":"[redacted]"}`,
+		string(Arguments(args, Secrets, Contents)))
+	// only the given keys are replaced
+	assert.JSONEq(t, `{"operations":[{"op":"write_dropin","unit":"nginx.service","content":"[Service]\nEnvironment=KEY=secret"}],"confirmation_token":"[redacted]"}`,
+		string(Arguments(args, Secrets)))
+
+	unchanged := json.RawMessage(`{"name":  "nginx.service"}`)
+	assert.Equal(t, unchanged, Arguments(unchanged, Secrets, Contents))
+	invalid := json.RawMessage(`{"name":`)
+	assert.Equal(t, invalid, Arguments(invalid, Secrets))
+}
@@ -0,0 +1,45 @@
+package reqlog
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/redact"
+)
+
+// Middleware logs every tool call with its arguments, duration and result at
+// info level. Tokens and file contents are redacted from the arguments.
+func Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || call.Params == nil {
+			return next(ctx, method, req)
+		}
+		start := time.Now()
+		result, err := next(ctx, method, req)
+		attrs := []any{
+			slog.String("tool", call.Params.Name),
+			slog.String("arguments", string(redact.Arguments(call.Params.Arguments, redact.Secrets, redact.Contents))),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if call.Session != nil {
+			attrs = append(attrs, slog.String("session", call.Session.ID()))
+		}
+		res, _ := result.(*mcp.CallToolResult)
+		switch {
+		case err != nil:
+			attrs = append(attrs, slog.String("result", "error"), slog.Any("error", err))
+		case res != nil && res.IsError:
+			attrs = append(attrs, slog.String("result", "error"))
+			if toolErr := res.GetError(); toolErr != nil {
+				attrs = append(attrs, slog.Any("error", toolErr))
+			}
+		default:
+			attrs = append(attrs, slog.String("result", "success"))
+		}
+		slog.InfoContext(ctx, "tool call", attrs...)
+		return result, err
+	}
+}
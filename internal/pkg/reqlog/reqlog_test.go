@@ -0,0 +1,44 @@
+package reqlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	handler := Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		res := &mcp.CallToolResult{}
+		if req.(*mcp.CallToolRequest).Params.Name == "install_unit" {
+			res.SetError(errors.New("unit exists"))
+		}
+		return res, nil
+	})
+	_, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{
+		Name:      "install_unit",
+		Arguments: json.RawMessage(`{"name":"backup.service","content":"[Service]\nEnvironment=PASSWORD=secret"}`),
+	}})
+	require.NoError(t, err)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "tool call", record["msg"])
+	assert.Equal(t, "install_unit", record["tool"])
+	assert.JSONEq(t, `{"name":"backup.service","content":"[redacted]"}`, record["arguments"].(string))
+	assert.Equal(t, "error", record["result"])
+	assert.Equal(t, "unit exists", record["error"])
+	assert.Contains(t, record, "duration")
+	assert.NotContains(t, buf.String(), "secret")
+}
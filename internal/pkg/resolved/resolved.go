@@ -0,0 +1,389 @@
+package resolved
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+)
+
+const (
+	resolveDest    = "org.freedesktop.resolve1"
+	resolvePath    = godbus.ObjectPath("/org/freedesktop/resolve1")
+	managerIface   = "org.freedesktop.resolve1.Manager"
+	linkIface      = "org.freedesktop.resolve1.Link"
+	propertiesGet  = "org.freedesktop.DBus.Properties.Get"
+	resolveErrPref = "org.freedesktop.resolve1."
+)
+
+// flags of the resolve1 queries, see sd-resolved(3)
+const (
+	flagDNS           = 1 << 0
+	flagLLMNRIPv4     = 1 << 1
+	flagLLMNRIPv6     = 1 << 2
+	flagMDNSIPv4      = 1 << 3
+	flagMDNSIPv6      = 1 << 4
+	flagAuthenticated = 1 << 9
+)
+
+type Resolved struct {
+	Auth auth.AuthKeeper
+}
+
+// an entry of the DNS properties, a(iiay) of the manager
+type dnsEntry struct {
+	Ifindex int32
+	Family  int32
+	Address []byte
+}
+
+// an entry of the Domains property, a(isb) of the manager
+type domainEntry struct {
+	Ifindex   int32
+	Domain    string
+	RouteOnly bool
+}
+
+type Link struct {
+	Ifindex          int32    `json:"ifindex"`
+	Name             string   `json:"name,omitempty"`
+	CurrentDNSServer string   `json:"current_dns_server,omitempty"`
+	DNSServers       []string `json:"dns_servers"`
+	Domains          []string `json:"domains"`
+	RouteDomains     []string `json:"route_domains,omitempty"`
+	DefaultRoute     bool     `json:"default_route"`
+	DNSSEC           string   `json:"dnssec,omitempty"`
+	DNSSECSupported  bool     `json:"dnssec_supported"`
+	DNSOverTLS       string   `json:"dns_over_tls,omitempty"`
+}
+
+type ResolvedStatusParams struct{}
+
+type ResolvedStatusResult struct {
+	CurrentDNSServer string   `json:"current_dns_server,omitempty"`
+	DNSServers       []string `json:"dns_servers"`
+	FallbackDNS      []string `json:"fallback_dns_servers"`
+	Domains          []string `json:"domains"`
+	DNSSEC           string   `json:"dnssec"`
+	DNSSECSupported  bool     `json:"dnssec_supported"`
+	DNSOverTLS       string   `json:"dns_over_tls"`
+	LLMNR            string   `json:"llmnr"`
+	MulticastDNS     string   `json:"multicast_dns"`
+	Links            []Link   `json:"links"`
+	Warnings         []string `json:"warnings,omitempty"`
+}
+
+type ResolveQueryParams struct {
+	Name    string `json:"name,omitempty" jsonschema:"Host name to resolve to addresses."`
+	Address string `json:"address,omitempty" jsonschema:"IPv4 or IPv6 address to resolve to host names."`
+	Family  string `json:"family,omitempty" jsonschema:"Address family of a host name lookup. Defaults to 'any'."`
+	Link    string `json:"link,omitempty" jsonschema:"Only query on this network interface, e.g. 'eth0'."`
+}
+
+type ResolveQueryResult struct {
+	Name          string   `json:"name,omitempty"`
+	Address       string   `json:"address,omitempty"`
+	CanonicalName string   `json:"canonical_name,omitempty"`
+	Addresses     []string `json:"addresses,omitempty"`
+	Names         []string `json:"names,omitempty"`
+	// protocols which answered, e.g. dns or llmnr
+	Protocols     []string `json:"protocols,omitempty"`
+	Authenticated bool     `json:"authenticated"`
+	DurationMS    int64    `json:"duration_ms"`
+	// error of resolved, e.g. that the name doesn't exist
+	Error string `json:"error,omitempty"`
+}
+
+func ValidFamilies() []string {
+	return []string{"any", "inet", "inet6"}
+}
+
+func CreateResolvedStatusSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ResolvedStatusParams](nil)
+	return inputSchema
+}
+
+func CreateResolveQuerySchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ResolveQueryParams](nil)
+	var families []any
+	for _, f := range ValidFamilies() {
+		families = append(families, f)
+	}
+	inputSchema.Properties["family"].Enum = families
+	inputSchema.Properties["family"].Default = json.RawMessage("\"any\"")
+	return inputSchema
+}
+
+// addressString formats an address of resolved, the family is AF_INET or
+// AF_INET6
+func addressString(address []byte) string {
+	if len(address) != net.IPv4len && len(address) != net.IPv6len {
+		return fmt.Sprintf("%x", address)
+	}
+	return net.IP(address).String()
+}
+
+// linkName returns the name of the interface, replaced by the tests
+var linkName = func(ifindex int32) string {
+	iface, err := net.InterfaceByIndex(int(ifindex))
+	if err != nil {
+		return ""
+	}
+	return iface.Name
+}
+
+// splitLinks returns the global servers and domains and the links they are
+// configured for, ordered by ifindex
+func splitLinks(dns []dnsEntry, domains []domainEntry) (servers []string, globalDomains []string, links []Link) {
+	servers, globalDomains = []string{}, []string{}
+	byIndex := make(map[int32]*Link)
+	link := func(ifindex int32) *Link {
+		l, ok := byIndex[ifindex]
+		if !ok {
+			l = &Link{Ifindex: ifindex, Name: linkName(ifindex), DNSServers: []string{}, Domains: []string{}}
+			byIndex[ifindex] = l
+		}
+		return l
+	}
+	for _, e := range dns {
+		if e.Ifindex == 0 {
+			servers = append(servers, addressString(e.Address))
+			continue
+		}
+		l := link(e.Ifindex)
+		l.DNSServers = append(l.DNSServers, addressString(e.Address))
+	}
+	for _, e := range domains {
+		if e.Ifindex == 0 {
+			globalDomains = append(globalDomains, e.Domain)
+			continue
+		}
+		l := link(e.Ifindex)
+		if e.RouteOnly {
+			l.RouteDomains = append(l.RouteDomains, e.Domain)
+		} else {
+			l.Domains = append(l.Domains, e.Domain)
+		}
+	}
+	links = []Link{}
+	for _, l := range byIndex {
+		links = append(links, *l)
+	}
+	slices.SortFunc(links, func(a, b Link) int { return int(a.Ifindex - b.Ifindex) })
+	return servers, globalDomains, links
+}
+
+// protocols returns the protocols of the flags of an answer
+func protocols(flags uint64) []string {
+	var protos []string
+	if flags&flagDNS != 0 {
+		protos = append(protos, "dns")
+	}
+	if flags&(flagLLMNRIPv4|flagLLMNRIPv6) != 0 {
+		protos = append(protos, "llmnr")
+	}
+	if flags&(flagMDNSIPv4|flagMDNSIPv6) != 0 {
+		protos = append(protos, "mdns")
+	}
+	return protos
+}
+
+// family returns the AF_ value of the family parameter
+func family(name string) (int32, error) {
+	switch name {
+	case "", "any":
+		return 0, nil
+	case "inet":
+		return 2, nil
+	case "inet6":
+		return 10, nil
+	}
+	return 0, fmt.Errorf("invalid family: %s, valid values are %v", name, ValidFamilies())
+}
+
+func property(ctx context.Context, obj godbus.BusObject, iface, name string, dest any) error {
+	return obj.CallWithContext(ctx, propertiesGet, 0, iface, name).Store(dest)
+}
+
+// linkDetails adds the DNSSEC state and the current server of the link
+func linkDetails(ctx context.Context, bus *godbus.Conn, l *Link) error {
+	var path godbus.ObjectPath
+	if err := bus.Object(resolveDest, resolvePath).CallWithContext(ctx, managerIface+".GetLink", 0, l.Ifindex).Store(&path); err != nil {
+		return err
+	}
+	obj := bus.Object(resolveDest, path)
+	var current struct {
+		Family  int32
+		Address []byte
+	}
+	if err := property(ctx, obj, linkIface, "CurrentDNSServer", &current); err == nil && len(current.Address) > 0 {
+		l.CurrentDNSServer = addressString(current.Address)
+	}
+	property(ctx, obj, linkIface, "DefaultRoute", &l.DefaultRoute)
+	property(ctx, obj, linkIface, "DNSSEC", &l.DNSSEC)
+	property(ctx, obj, linkIface, "DNSSECSupported", &l.DNSSECSupported)
+	property(ctx, obj, linkIface, "DNSOverTLS", &l.DNSOverTLS)
+	return nil
+}
+
+func (r *Resolved) authorize(ctx context.Context) error {
+	if allowed, err := r.Auth.IsReadAuthorized(ctx); err != nil {
+		return err
+	} else if !allowed {
+		return fmt.Errorf("calling method was canceled by user")
+	}
+	return nil
+}
+
+func jsonResult(res any) (*mcp.CallToolResult, error) {
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
+// Status reports the DNS servers and domains of systemd-resolved, globally
+// and per link, with the DNSSEC and DNS over TLS state
+func (r *Resolved) Status(ctx context.Context, req *mcp.CallToolRequest, params *ResolvedStatusParams) (*mcp.CallToolResult, any, error) {
+	if err := r.authorize(ctx); err != nil {
+		return nil, nil, err
+	}
+	bus, err := godbus.ConnectSystemBus(godbus.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer bus.Close()
+	obj := bus.Object(resolveDest, resolvePath)
+
+	var dns, fallback []dnsEntry
+	var domains []domainEntry
+	if err := property(ctx, obj, managerIface, "DNS", &dns); err != nil {
+		return nil, nil, fmt.Errorf("couldn't query systemd-resolved: %w", err)
+	}
+	res := ResolvedStatusResult{FallbackDNS: []string{}}
+	if err := property(ctx, obj, managerIface, "Domains", &domains); err != nil {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("couldn't read the domains: %s", err))
+	}
+	res.DNSServers, res.Domains, res.Links = splitLinks(dns, domains)
+	if err := property(ctx, obj, managerIface, "FallbackDNS", &fallback); err == nil {
+		for _, e := range fallback {
+			res.FallbackDNS = append(res.FallbackDNS, addressString(e.Address))
+		}
+	}
+	var current dnsEntry
+	if err := property(ctx, obj, managerIface, "CurrentDNSServer", &current); err == nil && len(current.Address) > 0 {
+		res.CurrentDNSServer = addressString(current.Address)
+	}
+	property(ctx, obj, managerIface, "DNSSEC", &res.DNSSEC)
+	property(ctx, obj, managerIface, "DNSSECSupported", &res.DNSSECSupported)
+	property(ctx, obj, managerIface, "DNSOverTLS", &res.DNSOverTLS)
+	property(ctx, obj, managerIface, "LLMNR", &res.LLMNR)
+	property(ctx, obj, managerIface, "MulticastDNS", &res.MulticastDNS)
+	for i := range res.Links {
+		if err := linkDetails(ctx, bus, &res.Links[i]); err != nil {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("couldn't read link %d: %s", res.Links[i].Ifindex, err))
+		}
+	}
+	if len(res.DNSServers) == 0 && !slices.ContainsFunc(res.Links, func(l Link) bool { return len(l.DNSServers) > 0 }) {
+		res.Warnings = append(res.Warnings, "no DNS servers are configured")
+	}
+
+	result, err := jsonResult(res)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, res, nil
+}
+
+// Query resolves a host name or an address with systemd-resolved, like
+// resolvectl query. Errors of resolved like a missing name are part of the
+// result.
+func (r *Resolved) Query(ctx context.Context, req *mcp.CallToolRequest, params *ResolveQueryParams) (*mcp.CallToolResult, any, error) {
+	if (params.Name == "") == (params.Address == "") {
+		return nil, nil, fmt.Errorf("either name or address is required")
+	}
+	af, err := family(params.Family)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ip net.IP
+	if params.Address != "" {
+		if ip = net.ParseIP(params.Address); ip == nil {
+			return nil, nil, fmt.Errorf("invalid address: %s", params.Address)
+		}
+	}
+	var ifindex int32
+	if params.Link != "" {
+		iface, err := net.InterfaceByName(params.Link)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unknown link %s: %w", params.Link, err)
+		}
+		ifindex = int32(iface.Index)
+	}
+	if err := r.authorize(ctx); err != nil {
+		return nil, nil, err
+	}
+	bus, err := godbus.ConnectSystemBus(godbus.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer bus.Close()
+	obj := bus.Object(resolveDest, resolvePath)
+
+	res := ResolveQueryResult{Name: params.Name, Address: params.Address}
+	var flags uint64
+	start := time.Now()
+	if params.Name != "" {
+		var addresses []dnsEntry
+		err = obj.CallWithContext(ctx, managerIface+".ResolveHostname", 0, ifindex, params.Name, af, uint64(0)).Store(&addresses, &res.CanonicalName, &flags)
+		for _, a := range addresses {
+			res.Addresses = append(res.Addresses, addressString(a.Address))
+		}
+	} else {
+		af = 2
+		if ip.To4() == nil {
+			af = 10
+		} else {
+			ip = ip.To4()
+		}
+		var names []struct {
+			Ifindex int32
+			Name    string
+		}
+		err = obj.CallWithContext(ctx, managerIface+".ResolveAddress", 0, ifindex, af, []byte(ip), uint64(0)).Store(&names, &flags)
+		for _, n := range names {
+			res.Names = append(res.Names, n.Name)
+		}
+	}
+	res.DurationMS = time.Since(start).Milliseconds()
+	var dbusErr godbus.Error
+	if errors.As(err, &dbusErr) && strings.HasPrefix(dbusErr.Name, resolveErrPref) {
+		res.Error = fmt.Sprintf("%s: %s", strings.TrimPrefix(dbusErr.Name, resolveErrPref), dbusErr.Error())
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("couldn't query systemd-resolved: %w", err)
+	}
+	res.Protocols = protocols(flags)
+	res.Authenticated = flags&flagAuthenticated != 0
+
+	result, err := jsonResult(res)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, res, nil
+}
@@ -0,0 +1,50 @@
+package resolved
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitLinks(t *testing.T) {
+	linkName = func(ifindex int32) string { return fmt.Sprintf("eth%d", ifindex-2) }
+	dns := []dnsEntry{
+		{Ifindex: 0, Family: 2, Address: []byte{9, 9, 9, 9}},
+		{Ifindex: 3, Family: 2, Address: []byte{192, 0, 2, 53}},
+		{Ifindex: 2, Family: 10, Address: []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x53}},
+	}
+	domains := []domainEntry{
+		{Ifindex: 0, Domain: "example.com"},
+		{Ifindex: 3, Domain: "corp.example.com"},
+		{Ifindex: 3, Domain: "internal", RouteOnly: true},
+	}
+	servers, global, links := splitLinks(dns, domains)
+	assert.Equal(t, []string{"9.9.9.9"}, servers)
+	assert.Equal(t, []string{"example.com"}, global)
+	assert.Equal(t, []Link{
+		{Ifindex: 2, Name: "eth0", DNSServers: []string{"2001:db8::53"}, Domains: []string{}},
+		{Ifindex: 3, Name: "eth1", DNSServers: []string{"192.0.2.53"}, Domains: []string{"corp.example.com"}, RouteDomains: []string{"internal"}},
+	}, links)
+
+	servers, global, links = splitLinks(nil, nil)
+	assert.Empty(t, servers)
+	assert.NotNil(t, global)
+	assert.Empty(t, links)
+}
+
+func TestProtocols(t *testing.T) {
+	assert.Equal(t, []string{"dns"}, protocols(flagDNS|flagAuthenticated))
+	assert.Equal(t, []string{"llmnr", "mdns"}, protocols(flagLLMNRIPv6|flagMDNSIPv4))
+	assert.Nil(t, protocols(0))
+}
+
+func TestFamily(t *testing.T) {
+	af, err := family("")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), af)
+	af, _ = family("inet6")
+	assert.Equal(t, int32(10), af)
+	_, err = family("ipx")
+	assert.Error(t, err)
+}
@@ -0,0 +1,202 @@
+package safety
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// arguments of the tools which name the objects a call affects
+var objectArguments = []string{"name", "names", "unit", "units", "patterns", "target", "path", "seat"}
+
+// Safety classifies a tool call, so that policy engines of the clients can
+// reason about the steps of a plan
+type Safety struct {
+	ReadOnly    bool `json:"read_only"`
+	Mutating    bool `json:"mutating"`
+	Destructive bool `json:"destructive"`
+	// units, patterns or files named in the arguments
+	AffectedObjects []string `json:"affected_objects"`
+}
+
+// DestructiveFunc decides by the arguments if a call of a mutating tool is
+// destructive
+type DestructiveFunc func(args map[string]any) bool
+
+type rule struct {
+	readOnly    bool
+	destructive bool
+	byArguments DestructiveFunc
+}
+
+// Classifier classifies the calls of the registered tools by their
+// annotations. Like in MCP, tools without read-only hint are mutating and
+// are destructive unless the destructive hint is false.
+type Classifier struct {
+	mu    sync.RWMutex
+	rules map[string]rule
+}
+
+func New() *Classifier {
+	return &Classifier{
+		rules: make(map[string]rule),
+	}
+}
+
+// Add registers a tool, its annotations have to be final
+func (c *Classifier) Add(tool *mcp.Tool) {
+	r := rule{destructive: true}
+	if a := tool.Annotations; a != nil {
+		r.readOnly = a.ReadOnlyHint
+		if a.DestructiveHint != nil {
+			r.destructive = *a.DestructiveHint
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules[tool.Name] = r
+}
+
+// SetDestructive lets the arguments decide if a call of the tool is
+// destructive, e.g. the action of change_unit_state
+func (c *Classifier) SetDestructive(name string, fn DestructiveFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.rules[name]
+	if !ok {
+		r = rule{destructive: true}
+	}
+	r.byArguments = fn
+	c.rules[name] = r
+}
+
+// Classify returns the safety of a call, unknown tools are treated as
+// destructive
+func (c *Classifier) Classify(name string, args json.RawMessage) Safety {
+	c.mu.RLock()
+	r, ok := c.rules[name]
+	c.mu.RUnlock()
+	if !ok {
+		r = rule{destructive: true}
+	}
+	var v map[string]any
+	json.Unmarshal(args, &v)
+	s := Safety{
+		ReadOnly:        r.readOnly,
+		Mutating:        !r.readOnly,
+		AffectedObjects: affectedObjects(v),
+	}
+	if s.Mutating {
+		s.Destructive = r.destructive
+		if r.byArguments != nil {
+			s.Destructive = r.byArguments(v)
+		}
+	}
+	return s
+}
+
+// affectedObjects collects the objects named in the arguments, also of the
+// calls of a batch
+func affectedObjects(args map[string]any) []string {
+	objects := []string{}
+	add := func(val any) {
+		if s, ok := val.(string); ok && s != "" && !slices.Contains(objects, s) {
+			objects = append(objects, s)
+		}
+	}
+	for _, key := range objectArguments {
+		switch val := args[key].(type) {
+		case string:
+			add(val)
+		case []any:
+			for _, elem := range val {
+				add(elem)
+			}
+		}
+	}
+	if calls, ok := args["calls"].([]any); ok {
+		for _, call := range calls {
+			if call, ok := call.(map[string]any); ok {
+				nested, _ := call["arguments"].(map[string]any)
+				for _, obj := range affectedObjects(nested) {
+					add(obj)
+				}
+			}
+		}
+	}
+	return objects
+}
+
+// Middleware adds the safety block to the structured content of the
+// results of tool calls
+func (c *Classifier) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		result, err := next(ctx, method, req)
+		call, ok := req.(*mcp.CallToolRequest)
+		if err != nil || !ok || call.Params == nil {
+			return result, err
+		}
+		res, ok := result.(*mcp.CallToolResult)
+		if !ok || res == nil {
+			return result, err
+		}
+		safety := c.Classify(call.Params.Name, call.Params.Arguments)
+		switch structured := res.StructuredContent.(type) {
+		case nil:
+			res.StructuredContent = map[string]any{"safety": safety}
+		case map[string]any:
+			structured["safety"] = safety
+		case json.RawMessage:
+			// the output of the tool as set by the sdk
+			var v map[string]any
+			if err := json.Unmarshal(structured, &v); err == nil && v != nil {
+				v["safety"] = safety
+				res.StructuredContent = v
+			}
+		}
+		return res, nil
+	}
+}
+
+// OutputSchema returns the output schema of a tool whose structured content
+// is T, together with the safety block added by the Middleware. The schema
+// of types it can't be inferred of, e.g. recursive ones, is any object.
+func OutputSchema[T any]() *jsonschema.Schema {
+	schema, err := jsonschema.For[T](&jsonschema.ForOptions{
+		// raw JSON is any value, not an array of bytes
+		TypeSchemas: map[reflect.Type]*jsonschema.Schema{reflect.TypeFor[json.RawMessage](): {}},
+	})
+	if err != nil {
+		schema = &jsonschema.Schema{Type: "object"}
+	}
+	if schema.Properties == nil {
+		schema.Properties = make(map[string]*jsonschema.Schema)
+	}
+	for _, p := range schema.Properties {
+		nullMaps(p)
+	}
+	schema.Properties["safety"], _ = jsonschema.For[Safety](nil)
+	return schema
+}
+
+// nullMaps allows null for the maps of the schema, as nil maps are marshaled
+// to null
+func nullMaps(s *jsonschema.Schema) {
+	if s == nil {
+		return
+	}
+	if s.Type == "object" && s.Properties == nil {
+		s.Types = []string{"null", "object"}
+		s.Type = ""
+	}
+	for _, p := range s.Properties {
+		nullMaps(p)
+	}
+	nullMaps(s.Items)
+	nullMaps(s.AdditionalProperties)
+}
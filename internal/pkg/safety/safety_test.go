@@ -0,0 +1,94 @@
+package safety
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	notDestructive := false
+	c := New()
+	c.Add(&mcp.Tool{Name: "show_unit", Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true}})
+	c.Add(&mcp.Tool{Name: "set_runbook", Annotations: &mcp.ToolAnnotations{DestructiveHint: &notDestructive}})
+	c.Add(&mcp.Tool{Name: "switch_target"})
+	c.Add(&mcp.Tool{Name: "change_unit_state"})
+	c.SetDestructive("change_unit_state", func(args map[string]any) bool { return args["action"] == "stop" })
+
+	assert.Equal(t, Safety{ReadOnly: true, AffectedObjects: []string{"a.service", "b.service"}},
+		c.Classify("show_unit", json.RawMessage(`{"names":["a.service","b.service"]}`)))
+	assert.Equal(t, Safety{Mutating: true, AffectedObjects: []string{"nginx.service"}},
+		c.Classify("set_runbook", json.RawMessage(`{"unit":"nginx.service"}`)))
+	assert.Equal(t, Safety{Mutating: true, Destructive: true, AffectedObjects: []string{"rescue.target"}},
+		c.Classify("switch_target", json.RawMessage(`{"target":"rescue.target"}`)))
+	assert.True(t, c.Classify("change_unit_state", json.RawMessage(`{"name":"a.service","action":"stop"}`)).Destructive)
+	assert.False(t, c.Classify("change_unit_state", json.RawMessage(`{"name":"a.service","action":"start"}`)).Destructive)
+	// unknown tools are treated as destructive
+	assert.Equal(t, Safety{Mutating: true, Destructive: true, AffectedObjects: []string{}}, c.Classify("unknown", nil))
+}
+
+func TestAffectedObjectsOfBatch(t *testing.T) {
+	var args map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{"calls":[{"tool":"show_unit","arguments":{"names":["a.service"]}},{"tool":"get_file","arguments":{"path":"/etc/hosts"}},{"tool":"list_log","arguments":{"unit":["a.service"]}}]}`), &args))
+	assert.Equal(t, []string{"a.service", "/etc/hosts"}, affectedObjects(args))
+}
+
+func TestMiddleware(t *testing.T) {
+	c := New()
+	c.Add(&mcp.Tool{Name: "show_unit", Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true}})
+	handler := c.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "{}"}}}, nil
+	})
+	result, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{
+		Params: &mcp.CallToolParamsRaw{Name: "show_unit", Arguments: json.RawMessage(`{"names":["a.service"]}`)},
+	})
+	require.NoError(t, err)
+	structured := result.(*mcp.CallToolResult).StructuredContent.(map[string]any)
+	assert.Equal(t, Safety{ReadOnly: true, AffectedObjects: []string{"a.service"}}, structured["safety"])
+
+	// other methods are passed through
+	result, err = handler(context.Background(), "tools/list", &mcp.ListToolsRequest{})
+	require.NoError(t, err)
+	assert.Nil(t, result.(*mcp.CallToolResult).StructuredContent)
+}
+
+func TestOutputSchema(t *testing.T) {
+	type result struct {
+		Units     []string          `json:"units"`
+		Labels    map[string]string `json:"labels"`
+		Arguments json.RawMessage   `json:"arguments"`
+	}
+	resolved, err := OutputSchema[result]().Resolve(nil)
+	require.NoError(t, err)
+	var v map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{"units":null,"labels":null,"arguments":{"name":"a.service"},"safety":{"read_only":true,"mutating":false,"destructive":false,"affected_objects":[]}}`), &v))
+	assert.NoError(t, resolved.Validate(v))
+	assert.Error(t, resolved.Validate(map[string]any{"units": "a.service", "labels": nil, "arguments": nil}))
+}
+
+func TestMiddlewareOutput(t *testing.T) {
+	c := New()
+	handler := c.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		return &mcp.CallToolResult{StructuredContent: json.RawMessage(`{"units":["a.service"]}`)}, nil
+	})
+	result, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{
+		Params: &mcp.CallToolParamsRaw{Name: "unknown"},
+	})
+	require.NoError(t, err)
+	structured := result.(*mcp.CallToolResult).StructuredContent.(map[string]any)
+	assert.Equal(t, []any{"a.service"}, structured["units"])
+	assert.Contains(t, structured, "safety")
+}
+
+func TestOutputSchemaOfRecursiveType(t *testing.T) {
+	type node struct {
+		Children []node `json:"children"`
+	}
+	schema := OutputSchema[node]()
+	assert.Equal(t, "object", schema.Type)
+	assert.Contains(t, schema.Properties, "safety")
+}
@@ -0,0 +1,389 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var mdstatPath = "/proc/mdstat"
+
+var (
+	mdStatusRe = regexp.MustCompile(`\[(\d+)/(\d+)\]\s+\[([U_]+)\]`)
+	mdSyncRe   = regexp.MustCompile(`(resync|recovery|reshape|check)\s*=\s*([\d.]+%)`)
+)
+
+type StorageHealthParams struct {
+	SkipSmart bool `json:"skip_smart,omitempty" jsonschema:"Don't query the SMART health of the disks."`
+}
+
+type MDArray struct {
+	Name       string   `json:"name"`
+	State      string   `json:"state"`
+	Level      string   `json:"level,omitempty"`
+	Devices    []string `json:"devices"`
+	Failed     []string `json:"failed_devices,omitempty"`
+	Status     string   `json:"status,omitempty"`
+	Degraded   bool     `json:"degraded"`
+	Sync       string   `json:"sync,omitempty"`
+	MountUnits []string `json:"mount_units,omitempty"`
+}
+
+type VolumeGroup struct {
+	Name       string `json:"name"`
+	Attr       string `json:"attr"`
+	Size       string `json:"size"`
+	Free       string `json:"free"`
+	MissingPVs int    `json:"missing_pvs"`
+}
+
+type LogicalVolume struct {
+	Name       string   `json:"name"`
+	VG         string   `json:"vg"`
+	Attr       string   `json:"attr"`
+	Size       string   `json:"size"`
+	Health     string   `json:"health,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	MountUnits []string `json:"mount_units,omitempty"`
+}
+
+type SmartHealth struct {
+	Device     string   `json:"device"`
+	Model      string   `json:"model,omitempty"`
+	Passed     *bool    `json:"passed,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	MountUnits []string `json:"mount_units,omitempty"`
+}
+
+type StorageHealthResult struct {
+	Raid           []MDArray       `json:"raid"`
+	VolumeGroups   []VolumeGroup   `json:"volume_groups"`
+	LogicalVolumes []LogicalVolume `json:"logical_volumes"`
+	Smart          []SmartHealth   `json:"smart,omitempty"`
+	Problems       []string        `json:"problems"`
+	Errors         []string        `json:"errors,omitempty"`
+}
+
+func CreateStorageHealthSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[StorageHealthParams](nil)
+	inputSchema.Properties["skip_smart"].Default = json.RawMessage(`false`)
+	return inputSchema
+}
+
+// parseMdstat parses the arrays of /proc/mdstat
+func parseMdstat(data string) []MDArray {
+	arrays := []MDArray{}
+	var cur *MDArray
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, rest, ok := strings.Cut(line, " : "); ok && strings.HasPrefix(name, "md") {
+			arrays = append(arrays, MDArray{Name: strings.TrimSpace(name), Devices: []string{}})
+			cur = &arrays[len(arrays)-1]
+			fields := strings.Fields(rest)
+			for i, field := range fields {
+				switch {
+				case i == 0:
+					cur.State = field
+				case strings.HasPrefix(field, "("):
+					cur.State += " " + field
+				case strings.Contains(field, "["):
+					dev, flags, _ := strings.Cut(field, "[")
+					cur.Devices = append(cur.Devices, dev)
+					if strings.HasSuffix(flags, "(F)") {
+						cur.Failed = append(cur.Failed, dev)
+					}
+				default:
+					cur.Level = field
+				}
+			}
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			cur = nil
+			continue
+		}
+		if m := mdStatusRe.FindStringSubmatch(line); m != nil {
+			cur.Status = m[3]
+			want, _ := strconv.Atoi(m[1])
+			have, _ := strconv.Atoi(m[2])
+			cur.Degraded = have < want || strings.Contains(m[3], "_")
+		}
+		if m := mdSyncRe.FindStringSubmatch(line); m != nil {
+			cur.Sync = m[1] + " " + m[2]
+		}
+	}
+	return arrays
+}
+
+// lvm reports all values as strings
+type lvmReport struct {
+	Report []struct {
+		VG []struct {
+			Name       string `json:"vg_name"`
+			Attr       string `json:"vg_attr"`
+			Size       string `json:"vg_size"`
+			Free       string `json:"vg_free"`
+			MissingPVs string `json:"vg_missing_pv_count"`
+		} `json:"vg"`
+		LV []struct {
+			Name   string `json:"lv_name"`
+			VG     string `json:"vg_name"`
+			Attr   string `json:"lv_attr"`
+			Size   string `json:"lv_size"`
+			Health string `json:"lv_health_status"`
+			Path   string `json:"lv_dm_path"`
+		} `json:"lv"`
+	} `json:"report"`
+}
+
+func parseVgs(data []byte) ([]VolumeGroup, error) {
+	var report lvmReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse vgs output: %w", err)
+	}
+	vgs := []VolumeGroup{}
+	for _, r := range report.Report {
+		for _, vg := range r.VG {
+			missing, _ := strconv.Atoi(vg.MissingPVs)
+			vgs = append(vgs, VolumeGroup{
+				Name:       vg.Name,
+				Attr:       vg.Attr,
+				Size:       vg.Size,
+				Free:       vg.Free,
+				MissingPVs: missing,
+			})
+		}
+	}
+	return vgs, nil
+}
+
+func parseLvs(data []byte) ([]LogicalVolume, error) {
+	var report lvmReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse lvs output: %w", err)
+	}
+	lvs := []LogicalVolume{}
+	for _, r := range report.Report {
+		for _, lv := range r.LV {
+			lvs = append(lvs, LogicalVolume{
+				Name:   lv.Name,
+				VG:     lv.VG,
+				Attr:   lv.Attr,
+				Size:   lv.Size,
+				Health: lv.Health,
+				Path:   lv.Path,
+			})
+		}
+	}
+	return lvs, nil
+}
+
+// parseSmart parses the output of smartctl --json -H -i
+func parseSmart(device string, data []byte) SmartHealth {
+	health := SmartHealth{Device: device}
+	var out struct {
+		Smartctl struct {
+			Messages []struct {
+				String   string `json:"string"`
+				Severity string `json:"severity"`
+			} `json:"messages"`
+		} `json:"smartctl"`
+		Model       string `json:"model_name"`
+		SmartStatus *struct {
+			Passed bool `json:"passed"`
+		} `json:"smart_status"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		health.Error = fmt.Sprintf("failed to parse smartctl output: %s", err)
+		return health
+	}
+	health.Model = out.Model
+	if out.SmartStatus != nil {
+		health.Passed = &out.SmartStatus.Passed
+	} else {
+		for _, msg := range out.Smartctl.Messages {
+			if msg.Severity == "error" {
+				health.Error = msg.String
+				break
+			}
+		}
+	}
+	return health
+}
+
+// escapePath escapes a path like systemd-escape --path does
+func escapePath(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "-"
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c == '/':
+			b.WriteByte('-')
+		case c == '.' && (i == 0 || path[i-1] == '/'):
+			fmt.Fprintf(&b, `\x%02x`, c)
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == ':', c == '_', c == '.':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
+
+// mountUnits maps every block device path to the mount and swap units of
+// the device and the devices stacked on top of it
+func mountUnits(devices []BlockDevice) map[string][]string {
+	units := make(map[string][]string)
+	var walk func(dev BlockDevice) []string
+	walk = func(dev BlockDevice) []string {
+		var mine []string
+		switch {
+		case dev.Mountpoint == "[SWAP]":
+			mine = append(mine, escapePath(dev.Path)+".swap")
+		case strings.HasPrefix(dev.Mountpoint, "/"):
+			mine = append(mine, escapePath(dev.Mountpoint)+".mount")
+		}
+		for _, child := range dev.Children {
+			mine = append(mine, walk(child)...)
+		}
+		for _, unit := range mine {
+			if !slices.Contains(units[dev.Path], unit) {
+				units[dev.Path] = append(units[dev.Path], unit)
+			}
+		}
+		return mine
+	}
+	for _, dev := range devices {
+		walk(dev)
+	}
+	for path := range units {
+		slices.Sort(units[path])
+	}
+	return units
+}
+
+func affected(units []string) string {
+	if len(units) == 0 {
+		return ""
+	}
+	return ", affects " + strings.Join(units, " ")
+}
+
+// StorageHealth summarizes the state of the md RAID arrays, the LVM volume
+// groups and logical volumes and the SMART health of the disks
+func (s *Storage) StorageHealth(ctx context.Context, req *mcp.CallToolRequest, params *StorageHealthParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := s.Auth.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	res := StorageHealthResult{
+		Raid:           []MDArray{},
+		VolumeGroups:   []VolumeGroup{},
+		LogicalVolumes: []LogicalVolume{},
+		Problems:       []string{},
+	}
+	devices, err := listBlockDevices(ctx, nil)
+	if err != nil {
+		res.Errors = append(res.Errors, err.Error())
+	}
+	units := mountUnits(devices)
+
+	if data, err := os.ReadFile(mdstatPath); err == nil {
+		res.Raid = parseMdstat(string(data))
+	} else if !os.IsNotExist(err) {
+		res.Errors = append(res.Errors, err.Error())
+	}
+	for i, md := range res.Raid {
+		res.Raid[i].MountUnits = units["/dev/"+md.Name]
+		if md.Degraded {
+			res.Problems = append(res.Problems, fmt.Sprintf("RAID %s is degraded [%s]%s", md.Name, md.Status, affected(res.Raid[i].MountUnits)))
+		}
+		if len(md.Failed) > 0 {
+			res.Problems = append(res.Problems, fmt.Sprintf("RAID %s has failed devices %s", md.Name, strings.Join(md.Failed, " ")))
+		}
+		if md.Sync != "" {
+			res.Problems = append(res.Problems, fmt.Sprintf("RAID %s is in %s", md.Name, md.Sync))
+		}
+	}
+
+	if out, err := exec.CommandContext(ctx, "vgs", "--reportformat", "json", "--units", "b",
+		"-o", "vg_name,vg_attr,vg_size,vg_free,vg_missing_pv_count").Output(); err == nil {
+		if res.VolumeGroups, err = parseVgs(out); err != nil {
+			res.Errors = append(res.Errors, err.Error())
+		}
+	} else if !errors.Is(err, exec.ErrNotFound) {
+		res.Errors = append(res.Errors, fmt.Sprintf("failed to run vgs: %s", err))
+	}
+	for _, vg := range res.VolumeGroups {
+		if vg.MissingPVs > 0 {
+			res.Problems = append(res.Problems, fmt.Sprintf("volume group %s is missing %d physical volumes", vg.Name, vg.MissingPVs))
+		}
+	}
+	if out, err := exec.CommandContext(ctx, "lvs", "--reportformat", "json", "--units", "b",
+		"-o", "lv_name,vg_name,lv_attr,lv_size,lv_health_status,lv_dm_path").Output(); err == nil {
+		if res.LogicalVolumes, err = parseLvs(out); err != nil {
+			res.Errors = append(res.Errors, err.Error())
+		}
+	} else if !errors.Is(err, exec.ErrNotFound) {
+		res.Errors = append(res.Errors, fmt.Sprintf("failed to run lvs: %s", err))
+	}
+	for i, lv := range res.LogicalVolumes {
+		res.LogicalVolumes[i].MountUnits = units[lv.Path]
+		if lv.Health != "" {
+			res.Problems = append(res.Problems, fmt.Sprintf("logical volume %s/%s is %s%s", lv.VG, lv.Name, lv.Health, affected(res.LogicalVolumes[i].MountUnits)))
+		}
+	}
+
+	if !params.SkipSmart {
+		for _, dev := range devices {
+			if dev.Type != "disk" || strings.HasPrefix(dev.Name, "zram") {
+				continue
+			}
+			// smartctl sets bits of the exit code for failing disks, so
+			// the output is parsed in any case
+			out, err := exec.CommandContext(ctx, "smartctl", "--json", "-H", "-i", dev.Path).Output()
+			if errors.Is(err, exec.ErrNotFound) {
+				res.Errors = append(res.Errors, "smartctl is not installed, no SMART health available")
+				break
+			}
+			health := parseSmart(dev.Path, out)
+			health.MountUnits = units[dev.Path]
+			if health.Passed != nil && !*health.Passed {
+				res.Problems = append(res.Problems, fmt.Sprintf("disk %s fails its SMART health check%s", dev.Path, affected(health.MountUnits)))
+			}
+			res.Smart = append(res.Smart, health)
+		}
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
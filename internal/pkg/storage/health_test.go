@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mdstat = `Personalities : [raid1] [raid6] [raid5] [raid4]
+md0 : active raid1 sdb1[1] sda1[0]
+      1046528 blocks super 1.2 [2/2] [UU]
+
+md1 : active raid5 sde1[3] sdd1[1] sdc1[0](F)
+      2093056 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [_UU]
+      [==>..................]  recovery = 12.6% (132096/1046528) finish=0.1min speed=132096K/sec
+
+md2 : inactive sdf1[0](S)
+      1046528 blocks super 1.2
+
+unused devices: <none>
+`
+
+func TestParseMdstat(t *testing.T) {
+	arrays := parseMdstat(mdstat)
+	require.Len(t, arrays, 3)
+	assert.Equal(t, MDArray{Name: "md0", State: "active", Level: "raid1", Devices: []string{"sdb1", "sda1"}, Status: "UU"}, arrays[0])
+	assert.True(t, arrays[1].Degraded)
+	assert.Equal(t, []string{"sdc1"}, arrays[1].Failed)
+	assert.Equal(t, "recovery 12.6%", arrays[1].Sync)
+	assert.Equal(t, "raid5", arrays[1].Level)
+	assert.Equal(t, "inactive", arrays[2].State)
+	assert.Empty(t, arrays[2].Level)
+	assert.Equal(t, []string{"sdf1"}, arrays[2].Devices)
+}
+
+func TestParseLvm(t *testing.T) {
+	vgs, err := parseVgs([]byte(`{"report":[{"vg":[{"vg_name":"system","vg_attr":"wz-pn-","vg_size":"100B","vg_free":"0B","vg_missing_pv_count":"1"}]}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []VolumeGroup{{Name: "system", Attr: "wz-pn-", Size: "100B", Free: "0B", MissingPVs: 1}}, vgs)
+
+	lvs, err := parseLvs([]byte(`{"report":[{"lv":[{"lv_name":"root","vg_name":"system","lv_attr":"-wi-ao--p-","lv_size":"50B","lv_health_status":"partial","lv_dm_path":"/dev/mapper/system-root"}]}]}`))
+	require.NoError(t, err)
+	require.Len(t, lvs, 1)
+	assert.Equal(t, "partial", lvs[0].Health)
+	assert.Equal(t, "/dev/mapper/system-root", lvs[0].Path)
+
+	_, err = parseVgs([]byte("  No volume groups found"))
+	assert.Error(t, err)
+}
+
+func TestParseSmart(t *testing.T) {
+	health := parseSmart("/dev/sda", []byte(`{"model_name":"Disk","smart_status":{"passed":false}}`))
+	require.NotNil(t, health.Passed)
+	assert.False(t, *health.Passed)
+	assert.Equal(t, "Disk", health.Model)
+
+	health = parseSmart("/dev/vda", []byte(`{"smartctl":{"messages":[{"string":"Unable to detect device type","severity":"error"}]}}`))
+	assert.Nil(t, health.Passed)
+	assert.Equal(t, "Unable to detect device type", health.Error)
+
+	health = parseSmart("/dev/sdb", nil)
+	assert.NotEmpty(t, health.Error)
+}
+
+func TestEscapePath(t *testing.T) {
+	tests := map[string]string{
+		"/":               "-",
+		"/var/lib":        "var-lib",
+		"/home/foo-bar":   `home-foo\x2dbar`,
+		"/srv/.hidden":    `srv-\x2ehidden`,
+		"/dev/mapper/a-b": `dev-mapper-a\x2db`,
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, escapePath(path), path)
+	}
+}
+
+func TestMountUnits(t *testing.T) {
+	devices := []BlockDevice{
+		{Path: "/dev/sda", Type: "disk", Children: []BlockDevice{
+			{Path: "/dev/sda1", Type: "part", Mountpoint: "/boot/efi"},
+			{Path: "/dev/sda2", Type: "part", Children: []BlockDevice{
+				{Path: "/dev/md0", Type: "raid1", Mountpoint: "/"},
+			}},
+			{Path: "/dev/sda3", Type: "part", Mountpoint: "[SWAP]"},
+		}},
+	}
+	units := mountUnits(devices)
+	assert.Equal(t, []string{"-.mount", "boot-efi.mount", "dev-sda3.swap"}, units["/dev/sda"])
+	assert.Equal(t, []string{"-.mount"}, units["/dev/md0"])
+	assert.Equal(t, []string{"-.mount"}, units["/dev/sda2"])
+}
@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+)
+
+var (
+	repartDirs = []string{"/etc/repart.d", "/run/repart.d", "/usr/local/lib/repart.d", "/usr/lib/repart.d"}
+	fstabPath  = "/etc/fstab"
+)
+
+// well known GPT partition types, see the discoverable partitions
+// specification
+var gptTypes = map[string]string{
+	"c12a7328-f81f-11d2-ba4b-00a0c93ec93b": "esp",
+	"bc13c2ff-59e6-4262-a352-b275fd6f7172": "xbootldr",
+	"0fc63daf-8483-4772-8e79-3d69d8477de4": "linux-generic",
+	"4f68bce3-e8cd-4db1-96e7-fbcaf984b709": "root-x86-64",
+	"b921b045-1df0-41c3-af44-4c6f280d3fae": "root-arm64",
+	"44479540-f297-41b2-9af7-d131d5f0458a": "root-x86",
+	"8484680c-9521-48c6-9c11-b0720656f69e": "usr-x86-64",
+	"b0e01050-ee5f-4390-949a-9101b17104e9": "usr-arm64",
+	"0657fd6d-a4ab-43c4-84e5-0933c84b4f4f": "swap",
+	"933ac7e1-2eb4-4f13-b844-0e14e2aef915": "home",
+	"3b8f8425-20e0-4f3b-907f-1a25a76f98e8": "srv",
+	"4d21b016-b534-45c2-a9fb-5c16e091fd2d": "var",
+	"7ec6f557-3bc5-4aca-b293-16ef5df639d1": "tmp",
+	"e6d6d379-f507-44c2-a23c-238f2a3df928": "linux-lvm",
+	"a19d880f-05fc-4d3b-a006-743f0f84911e": "linux-raid",
+	"ca7d7ccb-63ed-4c53-861c-1742536059cc": "linux-luks",
+	"21686148-6449-6e6f-744e-656564454649": "bios-boot",
+	"ebd0a0a2-b9e5-4433-87c0-68b6b72699c7": "microsoft-basic-data",
+}
+
+type Storage struct {
+	Auth auth.AuthKeeper
+}
+
+type DiskLayoutParams struct {
+	Devices []string `json:"devices,omitempty" jsonschema:"Only report these block devices (e.g. '/dev/sda'). Defaults to all devices."`
+}
+
+// BlockDevice is a block device as reported by lsblk
+type BlockDevice struct {
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	Type         string `json:"type"`
+	Size         int64  `json:"size"`
+	FsType       string `json:"fstype,omitempty"`
+	FsAvail      int64  `json:"fsavail,omitempty"`
+	Mountpoint   string `json:"mountpoint,omitempty"`
+	Label        string `json:"label,omitempty"`
+	UUID         string `json:"uuid,omitempty"`
+	PartLabel    string `json:"partlabel,omitempty"`
+	PartType     string `json:"parttype,omitempty"`
+	PartTypeName string `json:"parttype_name,omitempty"`
+	PartUUID     string `json:"partuuid,omitempty"`
+	// only set for disks
+	Unpartitioned int64         `json:"unpartitioned,omitempty"`
+	Children      []BlockDevice `json:"children,omitempty"`
+}
+
+// lsblk reports numbers as json numbers or as strings depending on the version
+type lsblkNumber int64
+
+func (n *lsblkNumber) UnmarshalJSON(data []byte) error {
+	str := strings.Trim(string(data), `"`)
+	if str == "null" || str == "" {
+		*n = 0
+		return nil
+	}
+	var v int64
+	if _, err := fmt.Sscan(str, &v); err != nil {
+		return err
+	}
+	*n = lsblkNumber(v)
+	return nil
+}
+
+type lsblkDevice struct {
+	Name       string        `json:"name"`
+	Path       string        `json:"path"`
+	Type       string        `json:"type"`
+	Size       lsblkNumber   `json:"size"`
+	FsType     string        `json:"fstype"`
+	FsAvail    lsblkNumber   `json:"fsavail"`
+	Mountpoint string        `json:"mountpoint"`
+	Label      string        `json:"label"`
+	UUID       string        `json:"uuid"`
+	PartLabel  string        `json:"partlabel"`
+	PartType   string        `json:"parttype"`
+	PartUUID   string        `json:"partuuid"`
+	Children   []lsblkDevice `json:"children"`
+}
+
+type RepartDefinition struct {
+	File     string            `json:"file"`
+	Settings map[string]string `json:"settings"`
+}
+
+type FstabEntry struct {
+	Spec       string   `json:"spec"`
+	Mountpoint string   `json:"mountpoint"`
+	FsType     string   `json:"fstype"`
+	Options    []string `json:"options,omitempty"`
+	Growfs     bool     `json:"growfs"`
+}
+
+type DiskLayoutResult struct {
+	Devices []BlockDevice      `json:"devices"`
+	Repart  []RepartDefinition `json:"repart_definitions,omitempty"`
+	Fstab   []FstabEntry       `json:"fstab,omitempty"`
+	Errors  []string           `json:"errors,omitempty"`
+}
+
+func CreateDiskLayoutSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[DiskLayoutParams](nil)
+	return inputSchema
+}
+
+func convertLsblk(dev lsblkDevice) BlockDevice {
+	bd := BlockDevice{
+		Name:       dev.Name,
+		Path:       dev.Path,
+		Type:       dev.Type,
+		Size:       int64(dev.Size),
+		FsType:     dev.FsType,
+		FsAvail:    int64(dev.FsAvail),
+		Mountpoint: dev.Mountpoint,
+		Label:      dev.Label,
+		UUID:       dev.UUID,
+		PartLabel:  dev.PartLabel,
+		PartType:   dev.PartType,
+		PartUUID:   dev.PartUUID,
+	}
+	bd.PartTypeName = gptTypes[strings.ToLower(dev.PartType)]
+	var partitioned int64
+	for _, child := range dev.Children {
+		c := convertLsblk(child)
+		if c.Type == "part" {
+			partitioned += c.Size
+		}
+		bd.Children = append(bd.Children, c)
+	}
+	if bd.Type == "disk" && partitioned > 0 && partitioned < bd.Size {
+		bd.Unpartitioned = bd.Size - partitioned
+	}
+	return bd
+}
+
+// parseLsblk converts the output of lsblk --json --bytes
+func parseLsblk(data []byte) ([]BlockDevice, error) {
+	var out struct {
+		Blockdevices []lsblkDevice `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse lsblk output: %w", err)
+	}
+	devices := []BlockDevice{}
+	for _, dev := range out.Blockdevices {
+		devices = append(devices, convertLsblk(dev))
+	}
+	return devices, nil
+}
+
+func listBlockDevices(ctx context.Context, devices []string) ([]BlockDevice, error) {
+	args := []string{"--json", "--bytes", "-o", "NAME,PATH,TYPE,SIZE,FSTYPE,FSAVAIL,MOUNTPOINT,LABEL,UUID,PARTLABEL,PARTTYPE,PARTUUID"}
+	args = append(args, devices...)
+	out, err := exec.CommandContext(ctx, "lsblk", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run lsblk: %w", err)
+	}
+	return parseLsblk(out)
+}
+
+// parseUnitStyle reads the key value pairs of a repart.d file, keys of
+// multiple sections are prefixed with the section name
+func parseUnitStyle(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	settings := make(map[string]string)
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if section != "" && section != "Partition" {
+			key = section + "." + key
+		}
+		if prev, ok := settings[key]; ok {
+			settings[key] = prev + " " + strings.TrimSpace(val)
+		} else {
+			settings[key] = strings.TrimSpace(val)
+		}
+	}
+	return settings, scanner.Err()
+}
+
+// readRepartDefinitions returns the effective repart.d definitions, files in
+// earlier directories mask files with the same name in later ones
+func readRepartDefinitions(dirs []string) ([]RepartDefinition, error) {
+	seen := make(map[string]string)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !strings.HasSuffix(e.Name(), ".conf") {
+				continue
+			}
+			if _, ok := seen[e.Name()]; !ok {
+				seen[e.Name()] = filepath.Join(dir, e.Name())
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var defs []RepartDefinition
+	for _, name := range names {
+		settings, err := parseUnitStyle(seen[name])
+		if err != nil {
+			return defs, err
+		}
+		defs = append(defs, RepartDefinition{File: seen[name], Settings: settings})
+	}
+	return defs, nil
+}
+
+func parseFstab(path string) ([]FstabEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []FstabEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		entry := FstabEntry{
+			Spec:       fields[0],
+			Mountpoint: fields[1],
+			FsType:     fields[2],
+		}
+		if len(fields) >= 4 {
+			entry.Options = strings.Split(fields[3], ",")
+			entry.Growfs = slices.Contains(entry.Options, "x-systemd.growfs")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// DiskLayout lists the block devices with their partitions, GPT labels and
+// types, free space and the repart and growfs definitions
+func (s *Storage) DiskLayout(ctx context.Context, req *mcp.CallToolRequest, params *DiskLayoutParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := s.Auth.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	var err error
+	res := DiskLayoutResult{}
+	if res.Devices, err = listBlockDevices(ctx, params.Devices); err != nil {
+		return nil, nil, err
+	}
+	if res.Repart, err = readRepartDefinitions(repartDirs); err != nil {
+		res.Errors = append(res.Errors, err.Error())
+	}
+	if res.Fstab, err = parseFstab(fstabPath); err != nil && !os.IsNotExist(err) {
+		res.Errors = append(res.Errors, err.Error())
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
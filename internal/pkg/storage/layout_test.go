@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLsblk(t *testing.T) {
+	data := `{"blockdevices":[
+		{"name":"sda","path":"/dev/sda","type":"disk","size":1000,"children":[
+			{"name":"sda1","path":"/dev/sda1","type":"part","size":"200","fstype":"vfat","parttype":"C12A7328-F81F-11D2-BA4B-00A0C93EC93B","partlabel":"ESP","mountpoint":"/boot/efi","fsavail":null},
+			{"name":"sda2","path":"/dev/sda2","type":"part","size":500,"fstype":"btrfs","parttype":"4f68bce3-e8cd-4db1-96e7-fbcaf984b709","fsavail":100}
+		]}
+	]}`
+	devices, err := parseLsblk([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	disk := devices[0]
+	assert.Equal(t, int64(300), disk.Unpartitioned)
+	require.Len(t, disk.Children, 2)
+	assert.Equal(t, "esp", disk.Children[0].PartTypeName)
+	assert.Equal(t, int64(200), disk.Children[0].Size)
+	assert.Equal(t, "root-x86-64", disk.Children[1].PartTypeName)
+	assert.Equal(t, int64(100), disk.Children[1].FsAvail)
+
+	_, err = parseLsblk([]byte("garbage"))
+	assert.Error(t, err)
+}
+
+func TestReadRepartDefinitions(t *testing.T) {
+	etc := t.TempDir()
+	usr := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(etc, "10-root.conf"), []byte("[Partition]\nType=root\nSizeMinBytes=10G\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(usr, "10-root.conf"), []byte("[Partition]\nType=usr\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(usr, "20-swap.conf"), []byte("# swap\n[Partition]\nType=swap\nFormat=swap\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(usr, "README"), []byte("ignored"), 0644))
+
+	defs, err := readRepartDefinitions([]string{etc, usr})
+	require.NoError(t, err)
+	require.Len(t, defs, 2)
+	assert.Equal(t, filepath.Join(etc, "10-root.conf"), defs[0].File)
+	assert.Equal(t, map[string]string{"Type": "root", "SizeMinBytes": "10G"}, defs[0].Settings)
+	assert.Equal(t, "swap", defs[1].Settings["Format"])
+}
+
+func TestParseFstab(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fstab")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\nUUID=1 / btrfs defaults,x-systemd.growfs 0 0\n/dev/sda3 swap swap defaults 0 0\n"), 0644))
+	entries, err := parseFstab(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.True(t, entries[0].Growfs)
+	assert.False(t, entries[1].Growfs)
+	assert.Equal(t, "swap", entries[1].FsType)
+}
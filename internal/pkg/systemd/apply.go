@@ -0,0 +1,371 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"go.yaml.in/yaml/v3"
+)
+
+var (
+	// drop-ins of the manifest are written below this directory
+	dropinRoot = "/etc/systemd/system"
+	sysctlRoot = "/proc/sys"
+	sysctlKey  = regexp.MustCompile(`^[a-zA-Z0-9_-]+([./][a-zA-Z0-9_-]+)*$`)
+)
+
+const applyJobTimeout = 30 * time.Second
+
+type DropIn struct {
+	Name    string `json:"name" yaml:"name"`
+	Content string `json:"content" yaml:"content"`
+}
+
+type UnitManifest struct {
+	Name    string   `json:"name" yaml:"name"`
+	Enabled *bool    `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Active  *bool    `json:"active,omitempty" yaml:"active,omitempty"`
+	DropIns []DropIn `json:"dropins,omitempty" yaml:"dropins,omitempty"`
+}
+
+// Manifest describes the desired state of a host. Drop-ins with an empty
+// content are removed.
+type Manifest struct {
+	Units  []UnitManifest    `json:"units,omitempty" yaml:"units,omitempty"`
+	Sysctl map[string]string `json:"sysctl,omitempty" yaml:"sysctl,omitempty"`
+}
+
+type ApplyParams struct {
+	Manifest string `json:"manifest" jsonschema:"Desired state as YAML or JSON with 'units' (name, enabled, active, dropins with name and content) and 'sysctl' (key: value)."`
+	Apply    bool   `json:"apply,omitempty" jsonschema:"Apply the plan. Without it only the plan is returned."`
+}
+
+type Change struct {
+	Kind    string `json:"kind"`
+	Target  string `json:"target"`
+	Current string `json:"current"`
+	Desired string `json:"desired"`
+}
+
+type ApplyResult struct {
+	Plan       []Change `json:"plan"`
+	Applied    bool     `json:"applied"`
+	Error      string   `json:"error,omitempty"`
+	RolledBack []string `json:"rolled_back,omitempty"`
+	Message    string   `json:"message,omitempty"`
+}
+
+func CreateApplySchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ApplyParams](nil)
+	inputSchema.Properties["apply"].Default = json.RawMessage(`false`)
+	return inputSchema
+}
+
+// ParseManifest reads a YAML or JSON manifest and checks the names in it
+func ParseManifest(data string) (*Manifest, error) {
+	var manifest Manifest
+	if err := yaml.Unmarshal([]byte(data), &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	for _, unit := range manifest.Units {
+		if unit.Name == "" || strings.ContainsAny(unit.Name, "/ ") || !strings.Contains(unit.Name, ".") {
+			return nil, fmt.Errorf("invalid unit name: %q", unit.Name)
+		}
+		for _, d := range unit.DropIns {
+			if !strings.HasSuffix(d.Name, ".conf") || strings.ContainsAny(d.Name, "/ ") {
+				return nil, fmt.Errorf("invalid drop-in name %q of %s, must be a file name ending with .conf", d.Name, unit.Name)
+			}
+		}
+	}
+	for key := range manifest.Sysctl {
+		if !sysctlKey.MatchString(key) {
+			return nil, fmt.Errorf("invalid sysctl key: %q", key)
+		}
+	}
+	return &manifest, nil
+}
+
+func sysctlPath(key string) string {
+	return filepath.Join(sysctlRoot, strings.ReplaceAll(key, ".", "/"))
+}
+
+func dropinPath(unit, name string) string {
+	return filepath.Join(dropinRoot, unit+".d", name)
+}
+
+// sysctl values are compared without the differences in white space
+func normalizeSysctl(val string) string {
+	return strings.Join(strings.Fields(val), " ")
+}
+
+func isEnabled(unitFileState string) bool {
+	return unitFileState == "enabled" || unitFileState == "enabled-runtime"
+}
+
+func isActive(activeState string) bool {
+	return activeState == "active" || activeState == "reloading" || activeState == "activating"
+}
+
+// plan compares the manifest against the current state and returns the
+// changes in the order in which they are applied: drop-ins, sysctls,
+// enablement and at last the active state.
+func (conn *Connection) plan(ctx context.Context, manifest *Manifest) ([]Change, error) {
+	var dropins, sysctls, enable, active []Change
+	for _, unit := range manifest.Units {
+		for _, d := range unit.DropIns {
+			current, err := os.ReadFile(dropinPath(unit.Name, d.Name))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			if string(current) != d.Content {
+				dropins = append(dropins, Change{Kind: "dropin", Target: dropinPath(unit.Name, d.Name), Current: string(current), Desired: d.Content})
+			}
+		}
+		if unit.Enabled == nil && unit.Active == nil {
+			continue
+		}
+		props, err := conn.dbus.GetAllPropertiesContext(ctx, unit.Name)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get state of %s: %w", unit.Name, err)
+		}
+		unitFileState, _ := props["UnitFileState"].(string)
+		activeState, _ := props["ActiveState"].(string)
+		if unit.Enabled != nil && *unit.Enabled != isEnabled(unitFileState) {
+			enable = append(enable, Change{Kind: "enabled", Target: unit.Name, Current: unitFileState, Desired: fmt.Sprint(*unit.Enabled)})
+		}
+		if unit.Active != nil && *unit.Active != isActive(activeState) {
+			active = append(active, Change{Kind: "active", Target: unit.Name, Current: activeState, Desired: fmt.Sprint(*unit.Active)})
+		}
+	}
+	keys := make([]string, 0, len(manifest.Sysctl))
+	for key := range manifest.Sysctl {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		current, err := os.ReadFile(sysctlPath(key))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read sysctl %s: %w", key, err)
+		}
+		if normalizeSysctl(string(current)) != normalizeSysctl(manifest.Sysctl[key]) {
+			sysctls = append(sysctls, Change{Kind: "sysctl", Target: key, Current: normalizeSysctl(string(current)), Desired: manifest.Sysctl[key]})
+		}
+	}
+	return slices.Concat(dropins, sysctls, enable, active), nil
+}
+
+// waitJob starts a job and waits for its result, the job is canceled if the
+// context is canceled before
+func (conn *Connection) waitJob(ctx context.Context, start func(ch chan<- string) (int, error)) error {
+	ch := make(chan string, 1)
+	id, err := start(ch)
+	if err != nil {
+		return err
+	}
+	select {
+	case result := <-ch:
+		if result != "done" {
+			return fmt.Errorf("job finished with result: %s", result)
+		}
+		return nil
+	case <-time.After(applyJobTimeout):
+		return fmt.Errorf("job didn't finish within %s", applyJobTimeout)
+	case <-ctx.Done():
+		return conn.abortJob(ctx, id)
+	}
+}
+
+func (conn *Connection) setActive(ctx context.Context, unit string, active bool) error {
+	return conn.waitJob(ctx, func(ch chan<- string) (int, error) {
+		if active {
+			return conn.dbus.StartUnitContext(ctx, unit, "replace", ch)
+		}
+		return conn.dbus.StopUnitContext(ctx, unit, "replace", ch)
+	})
+}
+
+func (conn *Connection) setEnabled(ctx context.Context, unit string, enabled bool) error {
+	conn.invalidateProperties(unit)
+	if enabled {
+		_, _, err := conn.dbus.EnableUnitFilesContext(ctx, []string{unit}, false, false)
+		return err
+	}
+	_, err := conn.dbus.DisableUnitFilesContext(ctx, []string{unit}, false)
+	return err
+}
+
+func writeFileOrRemove(path, content string) error {
+	if content == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// step of an apply with the function which reverts it
+type step struct {
+	desc string
+	do   func() error
+	undo func() error
+}
+
+func (conn *Connection) steps(ctx context.Context, changes []Change) []step {
+	var steps []step
+	for i, c := range changes {
+		switch c.Kind {
+		case "dropin":
+			steps = append(steps, step{
+				desc: "write drop-in " + c.Target,
+				do:   func() error { return writeFileOrRemove(c.Target, c.Desired) },
+				undo: func() error { return writeFileOrRemove(c.Target, c.Current) },
+			})
+			// drop-ins are planned first, reload once after the last one so
+			// that the units are started with the new configuration
+			if i+1 == len(changes) || changes[i+1].Kind != "dropin" {
+				steps = append(steps, step{
+					desc: "reload the manager configuration",
+					do:   func() error { return conn.dbus.ReloadContext(ctx) },
+					undo: func() error { return conn.dbus.ReloadContext(ctx) },
+				})
+			}
+		case "sysctl":
+			steps = append(steps, step{
+				desc: fmt.Sprintf("set sysctl %s=%s", c.Target, c.Desired),
+				do:   func() error { return os.WriteFile(sysctlPath(c.Target), []byte(c.Desired), 0644) },
+				undo: func() error { return os.WriteFile(sysctlPath(c.Target), []byte(c.Current), 0644) },
+			})
+		case "enabled":
+			desired := c.Desired == "true"
+			steps = append(steps, step{
+				desc: fmt.Sprintf("set enabled=%t for %s", desired, c.Target),
+				do:   func() error { return conn.setEnabled(ctx, c.Target, desired) },
+				undo: func() error { return conn.setEnabled(ctx, c.Target, !desired) },
+			})
+		case "active":
+			desired := c.Desired == "true"
+			steps = append(steps, step{
+				desc: fmt.Sprintf("set active=%t for %s", desired, c.Target),
+				do:   func() error { return conn.setActive(ctx, c.Target, desired) },
+				undo: func() error { return conn.setActive(ctx, c.Target, !desired) },
+			})
+		}
+	}
+	return steps
+}
+
+// runSteps applies the steps and reverts the applied ones in reverse order
+// if a step fails
+func runSteps(steps []step) (rolledBack []string, err error) {
+	for i, s := range steps {
+		slog.Debug("apply", "step", s.desc)
+		if err = s.do(); err == nil {
+			continue
+		}
+		err = fmt.Errorf("%s failed: %w", s.desc, err)
+		var undoErrs []error
+		for j := i - 1; j >= 0; j-- {
+			if undoErr := steps[j].undo(); undoErr != nil {
+				undoErrs = append(undoErrs, fmt.Errorf("undo of %s failed: %w", steps[j].desc, undoErr))
+				continue
+			}
+			rolledBack = append(rolledBack, steps[j].desc)
+		}
+		return rolledBack, errors.Join(append([]error{err}, undoErrs...)...)
+	}
+	return nil, nil
+}
+
+// IsDestructiveManifest reports if applying the manifest of a call of
+// apply_state stops or disables a unit, only returning the plan isn't
+// destructive
+func IsDestructiveManifest(args map[string]any) bool {
+	if apply, _ := args["apply"].(bool); !apply {
+		return false
+	}
+	content, _ := args["manifest"].(string)
+	manifest, err := ParseManifest(content)
+	if err != nil {
+		return false
+	}
+	for _, unit := range manifest.Units {
+		if (unit.Active != nil && !*unit.Active) || (unit.Enabled != nil && !*unit.Enabled) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyManifest computes the changes needed to reach the state of the
+// manifest and applies them if requested. If a step fails the already
+// applied steps are reverted.
+func (conn *Connection) ApplyManifest(ctx context.Context, req *mcp.CallToolRequest, params *ApplyParams) (*mcp.CallToolResult, any, error) {
+	manifest, err := ParseManifest(params.Manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, unit := range manifest.Units {
+		if err := conn.units.Check(unit.Name); err != nil {
+			return nil, nil, err
+		}
+	}
+	if params.Apply {
+		allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.FilesWriteAction))
+		if !allowed || err != nil {
+			slog.Debug("ApplyManifest wasn't authorized", "reason", err)
+			return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+		}
+		defer conn.auth.Deauthorize()
+	} else if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+
+	res := ApplyResult{}
+	if res.Plan, err = conn.plan(ctx, manifest); err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case len(res.Plan) == 0:
+		res.Message = "the host is already in the desired state"
+	case !params.Apply:
+		res.Message = "call again with apply set to true to apply the plan"
+	default:
+		res.RolledBack, err = runSteps(conn.steps(ctx, res.Plan))
+		if err != nil {
+			res.Error = err.Error()
+			res.Message = "applying failed, the applied changes were rolled back"
+		} else {
+			res.Applied = true
+		}
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
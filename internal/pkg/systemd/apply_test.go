@@ -0,0 +1,160 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testManifest = `
+units:
+  - name: foo.service
+    enabled: true
+    active: true
+    dropins:
+      - name: 10-limits.conf
+        content: |
+          [Service]
+          LimitNOFILE=4096
+sysctl:
+  vm.swappiness: 10
+`
+
+func TestParseManifest(t *testing.T) {
+	manifest, err := ParseManifest(testManifest)
+	require.NoError(t, err)
+	require.Len(t, manifest.Units, 1)
+	assert.True(t, *manifest.Units[0].Enabled)
+	assert.Equal(t, "10", manifest.Sysctl["vm.swappiness"])
+
+	manifest, err = ParseManifest(`{"units": [{"name": "bar.timer", "active": false}]}`)
+	require.NoError(t, err)
+	assert.Nil(t, manifest.Units[0].Enabled)
+	assert.False(t, *manifest.Units[0].Active)
+
+	for _, invalid := range []string{
+		`units: [{name: ../foo.service}]`,
+		`units: [{name: foo}]`,
+		`units: [{name: foo.service, dropins: [{name: ../../passwd.conf}]}]`,
+		`units: [{name: foo.service, dropins: [{name: override}]}]`,
+		`sysctl: {"../kernel": 1}`,
+		`units: foo`,
+	} {
+		_, err := ParseManifest(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func setupApply(t *testing.T) {
+	dropinRoot = t.TempDir()
+	sysctlRoot = t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(sysctlRoot, "vm"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(sysctlRoot, "vm", "swappiness"), []byte("60\n"), 0644))
+}
+
+func applyResult(t *testing.T, res *mcp.CallToolResult) ApplyResult {
+	var result ApplyResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+	return result
+}
+
+func TestApplyManifest(t *testing.T) {
+	setupApply(t)
+	var calls []string
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				return map[string]interface{}{"UnitFileState": "disabled", "ActiveState": "inactive"}, nil
+			},
+			reload: func() error {
+				calls = append(calls, "reload")
+				return nil
+			},
+			startUnit: func(name string, mode string) (int, error) {
+				calls = append(calls, "start "+name)
+				return 1, nil
+			},
+			enableUnitFiles: func(files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error) {
+				calls = append(calls, "enable "+files[0])
+				return false, nil, nil
+			},
+			jobResult: "done",
+		},
+		auth: auth,
+	}
+
+	res, _, err := conn.ApplyManifest(context.Background(), nil, &ApplyParams{Manifest: testManifest})
+	require.NoError(t, err)
+	result := applyResult(t, res)
+	assert.False(t, result.Applied)
+	require.Len(t, result.Plan, 4)
+	assert.Equal(t, []string{"dropin", "sysctl", "enabled", "active"}, []string{result.Plan[0].Kind, result.Plan[1].Kind, result.Plan[2].Kind, result.Plan[3].Kind})
+	assert.Equal(t, "60", result.Plan[1].Current)
+	assert.Empty(t, calls)
+
+	res, _, err = conn.ApplyManifest(context.Background(), nil, &ApplyParams{Manifest: testManifest, Apply: true})
+	require.NoError(t, err)
+	result = applyResult(t, res)
+	assert.True(t, result.Applied)
+	assert.Equal(t, []string{"reload", "enable foo.service", "start foo.service"}, calls)
+	content, err := os.ReadFile(filepath.Join(dropinRoot, "foo.service.d", "10-limits.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "[Service]\nLimitNOFILE=4096\n", string(content))
+	content, _ = os.ReadFile(filepath.Join(sysctlRoot, "vm", "swappiness"))
+	assert.Equal(t, "10", string(content))
+
+	readOnly, _ := auth_pkg.NewNoAuth(true, false)
+	conn.auth = readOnly
+	_, _, err = conn.ApplyManifest(context.Background(), nil, &ApplyParams{Manifest: testManifest, Apply: true})
+	assert.Error(t, err)
+
+	calls = nil
+	conn.auth = auth
+	conn.units = &policy.UnitAccess{Denied: []string{"foo.service"}}
+	_, _, err = conn.ApplyManifest(context.Background(), nil, &ApplyParams{Manifest: testManifest, Apply: true})
+	assert.ErrorContains(t, err, "outside of the units")
+	assert.Empty(t, calls)
+}
+
+func TestApplyManifestRollback(t *testing.T) {
+	setupApply(t)
+	var disabled []string
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				return map[string]interface{}{"UnitFileState": "disabled", "ActiveState": "inactive"}, nil
+			},
+			startUnit: func(name string, mode string) (int, error) {
+				return 0, fmt.Errorf("unit foo.service has a bad setting")
+			},
+			disableUnitFiles: func(files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
+				disabled = append(disabled, files...)
+				return nil, nil
+			},
+		},
+		auth: auth,
+	}
+	res, _, err := conn.ApplyManifest(context.Background(), nil, &ApplyParams{Manifest: testManifest, Apply: true})
+	require.NoError(t, err)
+	result := applyResult(t, res)
+	assert.False(t, result.Applied)
+	assert.Contains(t, result.Error, "bad setting")
+	assert.Len(t, result.RolledBack, 4)
+	assert.Equal(t, []string{"foo.service"}, disabled)
+	_, err = os.Stat(filepath.Join(dropinRoot, "foo.service.d", "10-limits.conf"))
+	assert.True(t, os.IsNotExist(err))
+	content, _ := os.ReadFile(filepath.Join(sysctlRoot, "vm", "swappiness"))
+	assert.Equal(t, "60", string(content))
+}
@@ -0,0 +1,305 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+func ValidPlanOperations() []string {
+	return []string{"enable", "disable", "start", "stop", "restart", "reload", "write_dropin", "remove_dropin"}
+}
+
+type PlanOperation struct {
+	Op      string `json:"op" jsonschema:"Operation to perform."`
+	Unit    string `json:"unit" jsonschema:"Exact name of the unit, e.g. nginx.service."`
+	Name    string `json:"name,omitempty" jsonschema:"File name of the drop-in for write_dropin and remove_dropin, ending with .conf."`
+	Content string `json:"content,omitempty" jsonschema:"Content of the drop-in for write_dropin."`
+}
+
+type ApplyPlanParams struct {
+	Operations []PlanOperation `json:"operations" jsonschema:"Operations in the order in which they are performed, e.g. write a drop-in, enable and restart a unit."`
+	Validate   bool            `json:"validate,omitempty" jsonschema:"Only validate the operations without performing them."`
+	Override   bool            `json:"override,omitempty" jsonschema:"Perform starts, stops and restarts even if a unit had too many of them recently."`
+}
+
+// PlanStep is the report of an operation, the manager reloads which the
+// drop-ins need are steps of their own
+type PlanStep struct {
+	Op          string `json:"op"`
+	Unit        string `json:"unit,omitempty"`
+	Description string `json:"description"`
+	// validated, done, failed, skipped, rolled_back or not_reverted
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ApplyPlanResult struct {
+	Steps   []PlanStep `json:"steps"`
+	Applied bool       `json:"applied"`
+	Error   string     `json:"error,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+func CreateApplyPlanSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ApplyPlanParams](nil)
+	var ops []any
+	for _, op := range ValidPlanOperations() {
+		ops = append(ops, op)
+	}
+	inputSchema.Properties["operations"].Items.Properties["op"].Enum = ops
+	inputSchema.Properties["validate"].Default = json.RawMessage(`false`)
+	return inputSchema
+}
+
+// planStep is a validated operation, undo is nil if it can't be reverted
+type planStep struct {
+	report PlanStep
+	do     func() error
+	undo   func() error
+}
+
+// validateOperation checks the operation against the current state of the
+// unit and returns the steps performing it
+func (conn *Connection) validateOperation(ctx context.Context, op PlanOperation, override bool) ([]planStep, error) {
+	if !slices.Contains(ValidPlanOperations(), op.Op) {
+		return nil, fmt.Errorf("invalid operation %q, valid operations are %v", op.Op, ValidPlanOperations())
+	}
+	if !unitNameRe.MatchString(op.Unit) {
+		return nil, fmt.Errorf("invalid unit name: %q", op.Unit)
+	}
+	if err := conn.units.Check(op.Unit); err != nil {
+		return nil, err
+	}
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, op.Unit)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get state of %s: %w", op.Unit, err)
+	}
+	if loadState, _ := props["LoadState"].(string); loadState == "not-found" {
+		return nil, fmt.Errorf("unit %s doesn't exist", op.Unit)
+	}
+	unitFileState, _ := props["UnitFileState"].(string)
+	activeState, _ := props["ActiveState"].(string)
+	report := PlanStep{Op: op.Op, Unit: op.Unit, Result: "validated"}
+	noop := func() error { return nil }
+
+	switch op.Op {
+	case "write_dropin", "remove_dropin":
+		if !strings.HasSuffix(op.Name, ".conf") || strings.ContainsAny(op.Name, "/ ") {
+			return nil, fmt.Errorf("invalid drop-in name %q of %s, must be a file name ending with .conf", op.Name, op.Unit)
+		}
+		content := op.Content
+		if op.Op == "write_dropin" {
+			if strings.TrimSpace(content) == "" {
+				return nil, fmt.Errorf("drop-in %s of %s has no content, use remove_dropin to remove it", op.Name, op.Unit)
+			}
+			if _, err := unitSections(content); err != nil {
+				return nil, fmt.Errorf("invalid drop-in %s of %s: %w", op.Name, op.Unit, err)
+			}
+		} else {
+			content = ""
+		}
+		path := dropinPath(op.Unit, op.Name)
+		current, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		report.Description = "write drop-in " + path
+		if op.Op == "remove_dropin" {
+			report.Description = "remove drop-in " + path
+		}
+		return []planStep{{
+			report: report,
+			do:     func() error { return writeFileOrRemove(path, content) },
+			undo:   func() error { return writeFileOrRemove(path, string(current)) },
+		}}, nil
+	case "enable", "disable":
+		enable := op.Op == "enable"
+		report.Description = fmt.Sprintf("%s %s", op.Op, op.Unit)
+		if enable == isEnabled(unitFileState) {
+			report.Description += ", it is already " + unitFileState
+			return []planStep{{report: report, do: noop, undo: noop}}, nil
+		}
+		return []planStep{{
+			report: report,
+			do:     func() error { return conn.setEnabled(ctx, op.Unit, enable) },
+			undo:   func() error { return conn.setEnabled(ctx, op.Unit, !enable) },
+		}}, nil
+	case "start", "stop":
+		start := op.Op == "start"
+		if err := conn.guardAction(op.Unit, op.Op, override, time.Now()); err != nil {
+			return nil, err
+		}
+		report.Description = fmt.Sprintf("%s %s", op.Op, op.Unit)
+		if start == isActive(activeState) {
+			report.Description += ", it is already " + activeState
+			return []planStep{{report: report, do: noop, undo: noop}}, nil
+		}
+		return []planStep{{
+			report: report,
+			do:     func() error { return conn.setActive(ctx, op.Unit, start) },
+			undo:   func() error { return conn.setActive(ctx, op.Unit, !start) },
+		}}, nil
+	default:
+		if err := conn.guardAction(op.Unit, op.Op, override, time.Now()); err != nil {
+			return nil, err
+		}
+		report.Description = fmt.Sprintf("%s %s", op.Op, op.Unit)
+		return []planStep{{
+			report: report,
+			do: func() error {
+				return conn.waitJob(ctx, func(ch chan<- string) (int, error) {
+					if op.Op == "reload" {
+						return conn.dbus.ReloadOrRestartUnitContext(ctx, op.Unit, "replace", ch)
+					}
+					return conn.dbus.RestartUnitContext(ctx, op.Unit, "replace", ch)
+				})
+			},
+		}}, nil
+	}
+}
+
+// planSteps validates all operations before anything is changed, a reload
+// of the manager follows each run of drop-in operations
+func (conn *Connection) planSteps(ctx context.Context, params *ApplyPlanParams) ([]planStep, error) {
+	if len(params.Operations) == 0 {
+		return nil, fmt.Errorf("the plan has no operations")
+	}
+	var steps []planStep
+	for i, op := range params.Operations {
+		opSteps, err := conn.validateOperation(ctx, op, params.Override)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i+1, err)
+		}
+		steps = append(steps, opSteps...)
+		isDropin := strings.HasSuffix(op.Op, "_dropin")
+		if isDropin && (i+1 == len(params.Operations) || !strings.HasSuffix(params.Operations[i+1].Op, "_dropin")) {
+			steps = append(steps, planStep{
+				report: PlanStep{Op: "daemon_reload", Description: "reload the manager configuration", Result: "validated"},
+				do:     func() error { return conn.dbus.ReloadContext(ctx) },
+				undo:   func() error { return conn.dbus.ReloadContext(ctx) },
+			})
+		}
+	}
+	return steps, nil
+}
+
+// runPlan performs the steps, if one fails the performed ones are reverted
+// in reverse order and the remaining ones skipped
+func runPlan(steps []planStep) error {
+	for i := range steps {
+		slog.Debug("apply plan", "step", steps[i].report.Description)
+		err := steps[i].do()
+		if err == nil {
+			steps[i].report.Result = "done"
+			continue
+		}
+		steps[i].report.Result = "failed"
+		steps[i].report.Error = err.Error()
+		for j := i + 1; j < len(steps); j++ {
+			steps[j].report.Result = "skipped"
+		}
+		for j := i - 1; j >= 0; j-- {
+			if steps[j].undo == nil {
+				steps[j].report.Result = "not_reverted"
+				continue
+			}
+			if undoErr := steps[j].undo(); undoErr != nil {
+				steps[j].report.Error = fmt.Sprintf("undo failed: %s", undoErr)
+				continue
+			}
+			steps[j].report.Result = "rolled_back"
+		}
+		return fmt.Errorf("%s failed: %w", steps[i].report.Description, err)
+	}
+	return nil
+}
+
+// IsDestructivePlan reports if a call of apply_plan with the arguments
+// performs an operation which interrupts a unit or keeps it from starting at
+// boot, validating the plan isn't destructive
+func IsDestructivePlan(args map[string]any) bool {
+	if validate, _ := args["validate"].(bool); validate {
+		return false
+	}
+	ops, _ := args["operations"].([]any)
+	for _, op := range ops {
+		op, _ := op.(map[string]any)
+		if name, _ := op["op"].(string); slices.Contains(destructiveActions, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// planPermissions returns the polkit actions the operations need, writing
+// the drop-ins needs the write action for files and changing the units the
+// manage action
+func planPermissions(ops []PlanOperation) []string {
+	var permissions []string
+	for _, op := range ops {
+		if permission, _ := toolPermission("apply_plan", op.Op); !slices.Contains(permissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// ApplyPlan validates an ordered list of operations up-front and performs
+// them, if an operation fails the already performed ones are reverted.
+func (conn *Connection) ApplyPlan(ctx context.Context, req *mcp.CallToolRequest, params *ApplyPlanParams) (*mcp.CallToolResult, any, error) {
+	if params.Validate {
+		if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+			return nil, nil, err
+		} else if !allowed {
+			return nil, nil, fmt.Errorf("calling method was canceled by user")
+		}
+	} else {
+		defer conn.auth.Deauthorize()
+		for _, permission := range planPermissions(params.Operations) {
+			allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, permission))
+			if !allowed || err != nil {
+				slog.Debug("ApplyPlan wasn't authorized", "permission", permission, "reason", err)
+				return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+			}
+		}
+	}
+
+	steps, err := conn.planSteps(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := ApplyPlanResult{}
+	if params.Validate {
+		res.Message = "all operations are valid, call again without validate to perform them"
+	} else if err := runPlan(steps); err != nil {
+		res.Error = err.Error()
+		res.Message = "the plan failed, the performed operations were reverted, except restarts and reloads which can't be undone and are reported as not_reverted"
+	} else {
+		res.Applied = true
+	}
+	for _, s := range steps {
+		res.Steps = append(res.Steps, s.report)
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,161 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyPlanSchema(t *testing.T) {
+	schema := CreateApplyPlanSchema()
+	assert.Len(t, schema.Properties["operations"].Items.Properties["op"].Enum, len(ValidPlanOperations()))
+}
+
+func TestApplyPlan(t *testing.T) {
+	setupApply(t)
+	var calls []string
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				if unitName == "missing.service" {
+					return map[string]interface{}{"LoadState": "not-found"}, nil
+				}
+				return map[string]interface{}{"LoadState": "loaded", "UnitFileState": "disabled", "ActiveState": "active"}, nil
+			},
+			enableUnitFiles: func(files []string, runtime bool, force bool) (bool, []sddbus.EnableUnitFileChange, error) {
+				calls = append(calls, "enable "+files[0])
+				return false, nil, nil
+			},
+			disableUnitFiles: func(files []string, runtime bool) ([]sddbus.DisableUnitFileChange, error) {
+				calls = append(calls, "disable "+files[0])
+				return nil, nil
+			},
+			restartUnit: func(name string, mode string) (int, error) {
+				calls = append(calls, "restart "+name)
+				if name == "broken.service" {
+					return 0, fmt.Errorf("job failed")
+				}
+				return 1, nil
+			},
+			reload: func() error {
+				calls = append(calls, "reload")
+				return nil
+			},
+			jobResult: "done",
+		},
+		auth: auth,
+	}
+	dropin := PlanOperation{Op: "write_dropin", Unit: "nginx.service", Name: "limits.conf", Content: "[Service]\nLimitNOFILE=65536\n"}
+
+	_, _, err := conn.ApplyPlan(context.Background(), nil, &ApplyPlanParams{Operations: []PlanOperation{dropin, {Op: "start", Unit: "missing.service"}}})
+	assert.ErrorContains(t, err, "operation 2: unit missing.service doesn't exist")
+	_, _, err = conn.ApplyPlan(context.Background(), nil, &ApplyPlanParams{Operations: []PlanOperation{{Op: "write_dropin", Unit: "nginx.service", Name: "bad.conf", Content: "LimitNOFILE=1\n"}}})
+	assert.ErrorContains(t, err, "outside of a section")
+	assert.Empty(t, calls)
+
+	_, out, err := conn.ApplyPlan(context.Background(), nil, &ApplyPlanParams{Operations: []PlanOperation{dropin, {Op: "enable", Unit: "nginx.service"}}, Validate: true})
+	require.NoError(t, err)
+	assert.False(t, out.(ApplyPlanResult).Applied)
+	assert.Empty(t, calls)
+	assert.NoFileExists(t, dropinPath("nginx.service", "limits.conf"))
+
+	_, out, err = conn.ApplyPlan(context.Background(), nil, &ApplyPlanParams{Operations: []PlanOperation{
+		dropin,
+		{Op: "enable", Unit: "nginx.service"},
+		{Op: "start", Unit: "nginx.service"},
+		{Op: "restart", Unit: "nginx.service"},
+		{Op: "restart", Unit: "broken.service"},
+		{Op: "enable", Unit: "other.service"},
+	}})
+	require.NoError(t, err)
+	res := out.(ApplyPlanResult)
+	assert.False(t, res.Applied)
+	assert.Contains(t, res.Error, "restart broken.service failed")
+	var results []string
+	for _, s := range res.Steps {
+		results = append(results, s.Op+" "+s.Result)
+	}
+	assert.Equal(t, []string{
+		"write_dropin rolled_back", "daemon_reload rolled_back", "enable rolled_back", "start rolled_back",
+		"restart not_reverted", "restart failed", "enable skipped",
+	}, results)
+	assert.Equal(t, []string{"reload", "enable nginx.service", "restart nginx.service", "restart broken.service", "disable nginx.service", "reload"}, calls)
+	_, err = os.Stat(dropinPath("nginx.service", "limits.conf"))
+	assert.True(t, os.IsNotExist(err))
+
+	calls = nil
+	_, out, err = conn.ApplyPlan(context.Background(), nil, &ApplyPlanParams{Operations: []PlanOperation{dropin, {Op: "restart", Unit: "nginx.service"}}})
+	require.NoError(t, err)
+	assert.True(t, out.(ApplyPlanResult).Applied)
+	assert.FileExists(t, dropinPath("nginx.service", "limits.conf"))
+}
+
+// permissionAuth records the polkit actions of the write authorizations
+// and only allows the granted ones
+type permissionAuth struct {
+	auth_pkg.AuthKeeper
+	granted     []string
+	permissions []string
+}
+
+func (a *permissionAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
+	permission, _ := ctx.Value(dbus.PermissionKey).(string)
+	a.permissions = append(a.permissions, permission)
+	if !slices.Contains(a.granted, permission) {
+		return false, fmt.Errorf("%s isn't granted", permission)
+	}
+	return true, nil
+}
+
+func TestApplyPlanPermissions(t *testing.T) {
+	setupApply(t)
+	var calls []string
+	noAuth, _ := auth_pkg.NewNoAuth(true, true)
+	auth := &permissionAuth{AuthKeeper: noAuth, granted: []string{dbus.FilesWriteAction}}
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				return map[string]interface{}{"LoadState": "loaded", "UnitFileState": "enabled", "ActiveState": "active"}, nil
+			},
+			stopUnit: func(name string, mode string) (int, error) {
+				calls = append(calls, "stop "+name)
+				return 1, nil
+			},
+			reload: func() error {
+				calls = append(calls, "reload")
+				return nil
+			},
+			jobResult: "done",
+		},
+		auth: auth,
+	}
+	dropin := PlanOperation{Op: "write_dropin", Unit: "nginx.service", Name: "limits.conf", Content: "[Service]\nLimitNOFILE=65536\n"}
+
+	// the write action for files doesn't allow to stop units
+	_, _, err := conn.ApplyPlan(context.Background(), nil, &ApplyPlanParams{Operations: []PlanOperation{dropin, {Op: "stop", Unit: "nginx.service"}}})
+	assert.ErrorContains(t, err, "wasn't authorized")
+	assert.Equal(t, []string{dbus.FilesWriteAction, dbus.UnitsManageAction}, auth.permissions)
+	assert.Empty(t, calls)
+	assert.NoFileExists(t, dropinPath("nginx.service", "limits.conf"))
+
+	auth.permissions = nil
+	_, out, err := conn.ApplyPlan(context.Background(), nil, &ApplyPlanParams{Operations: []PlanOperation{dropin}})
+	require.NoError(t, err)
+	assert.True(t, out.(ApplyPlanResult).Applied)
+	assert.Equal(t, []string{dbus.FilesWriteAction}, auth.permissions)
+
+	auth.granted = append(auth.granted, dbus.UnitsManageAction)
+	_, out, err = conn.ApplyPlan(context.Background(), nil, &ApplyPlanParams{Operations: []PlanOperation{{Op: "stop", Unit: "nginx.service"}}})
+	require.NoError(t, err)
+	assert.True(t, out.(ApplyPlanResult).Applied)
+	assert.Equal(t, []string{"reload", "stop nginx.service"}, calls)
+}
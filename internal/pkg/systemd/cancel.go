@@ -0,0 +1,57 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+)
+
+// time the cancellation of a job may take, the context of the aborted
+// request can't be used for it
+const cancelJobTimeout = 5 * time.Second
+
+type jobCanceler interface {
+	CancelJobContext(ctx context.Context, id uint32) error
+}
+
+// abortJob cancels the job of a request the client aborted, so that e.g. an
+// abandoned restart doesn't continue silently, and returns the error of the
+// request
+func (conn *Connection) abortJob(ctx context.Context, id int) error {
+	c, ok := conn.dbus.(jobCanceler)
+	if !ok || id <= 0 {
+		return fmt.Errorf("request aborted, job %d keeps running: %w", id, ctx.Err())
+	}
+	cancelCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cancelJobTimeout)
+	defer cancel()
+	if err := c.CancelJobContext(cancelCtx, uint32(id)); err != nil {
+		slog.Warn("failed to cancel the job of the aborted request", "job", id, "error", err)
+		return fmt.Errorf("request aborted, job %d keeps running: %w", id, ctx.Err())
+	}
+	slog.Info("canceled the job of the aborted request", "job", id)
+	return fmt.Errorf("request aborted, job %d was canceled: %w", id, ctx.Err())
+}
+
+// waitUnitJob waits up to the timeout for the job started by
+// ChangeUnitState and cancels it if the client aborts the request meanwhile
+func (conn *Connection) waitUnitJob(ctx context.Context, id int, timeout uint) (*mcp.CallToolResult, any, error) {
+	var msg string
+	select {
+	case msg = <-conn.rchannel:
+	case <-time.After(time.Duration(timeout) * time.Second):
+		msg = "Reload or restart still in progress."
+	case <-ctx.Done():
+		return nil, nil, conn.abortJob(ctx, id)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: msg,
+			},
+		},
+	}, util.Message{Message: msg}, nil
+}
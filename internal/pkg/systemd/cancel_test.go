@@ -0,0 +1,66 @@
+package systemd
+
+import (
+	"context"
+	"testing"
+
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cancelingDbus struct {
+	*mockDbusConnection
+	canceled []uint32
+}
+
+func (m *cancelingDbus) CancelJobContext(ctx context.Context, id uint32) error {
+	m.canceled = append(m.canceled, id)
+	return nil
+}
+
+func TestChangeUnitStateCanceled(t *testing.T) {
+	mock := &cancelingDbus{mockDbusConnection: &mockDbusConnection{
+		restartUnit: func(name string, mode string) (int, error) { return 42, nil },
+	}}
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{dbus: mock, auth: auth, rchannel: make(chan string, 1)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := conn.ChangeUnitState(ctx, nil, &ChangeUnitStateParams{Name: "test.service", Action: "restart_force", TimeOut: 30})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Contains(t, err.Error(), "job 42 was canceled")
+	assert.Equal(t, []uint32{42}, mock.canceled)
+}
+
+func TestChangeUnitStateWaits(t *testing.T) {
+	mock := &cancelingDbus{mockDbusConnection: &mockDbusConnection{jobResult: "done"}}
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{dbus: mock, auth: auth, rchannel: make(chan string, 1)}
+
+	_, out, err := conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Name: "test.service", Action: "start", TimeOut: 30})
+	require.NoError(t, err)
+	assert.Equal(t, util.Message{Message: "done"}, out)
+	assert.Empty(t, mock.canceled)
+}
+
+func TestWaitJobCanceled(t *testing.T) {
+	mock := &cancelingDbus{mockDbusConnection: &mockDbusConnection{
+		stopUnit: func(name string, mode string) (int, error) { return 7, nil },
+	}}
+	conn := &Connection{dbus: mock}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := conn.setActive(ctx, "test.service", false)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []uint32{7}, mock.canceled)
+
+	// without CancelJob the job keeps running
+	conn.dbus = mock.mockDbusConnection
+	err = conn.setActive(ctx, "test.service", false)
+	assert.Contains(t, err.Error(), "job 7 keeps running")
+}
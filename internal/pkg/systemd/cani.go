@@ -0,0 +1,153 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/power"
+)
+
+// polkit actions of the tools which change the system
+var writePermissions = map[string]string{
+	"change_unit_state":    dbus.UnitsManageAction,
+	"check_restart_reload": dbus.UnitsManageAction,
+	"create_delegation":    dbus.UnitsManageAction,
+	"revoke_delegation":    dbus.UnitsManageAction,
+	"set_environment":      dbus.UnitsManageAction,
+	"unset_environment":    dbus.UnitsManageAction,
+	"install_unit":         dbus.FilesWriteAction,
+	"apply_state":          dbus.FilesWriteAction,
+	"apply_plan":           dbus.UnitsManageAction,
+	"save_baseline":        dbus.FilesWriteAction,
+	"journal_upload":       dbus.FilesWriteAction,
+	"set_runbook":          dbus.FilesWriteAction,
+	"switch_target":        SwitchTargetPermission,
+	"set_default_target":   dbus.UnitsManageAction,
+	"terminate_session":    dbus.SessionsManageAction,
+	"lock_seat":            dbus.SessionsManageAction,
+	"power_action":         power.PowerActionPermission,
+	"apply_sysusers":       dbus.FilesWriteAction,
+	"put_file":             dbus.FilesWriteAction,
+}
+
+// polkit actions of the tools which read, the tools of the other packages
+// need the read action without category
+var readPermissions = map[string]string{
+	"list_loaded_units":     dbus.UnitsReadAction,
+	"list_unit_files":       dbus.UnitsReadAction,
+	"show_unit":             dbus.UnitsReadAction,
+	"failed_units":          dbus.UnitsReadAction,
+	"system_overview":       dbus.UnitsReadAction,
+	"get_default_target":    dbus.UnitsReadAction,
+	"why_not_running":       dbus.UnitsReadAction,
+	"get_runbook":           dbus.UnitsReadAction,
+	"analyze_security":      dbus.UnitsReadAction,
+	"diff_unit_state":       dbus.UnitsReadAction,
+	"get_environment":       dbus.UnitsReadAction,
+	"export_state":          dbus.UnitsReadAction,
+	"check_drift":           dbus.UnitsReadAction,
+	"list_log":              dbus.JournalReadAction,
+	"compare_boots":         dbus.JournalReadAction,
+	"follow_log":            dbus.JournalReadAction,
+	"login_failures":        dbus.JournalReadAction,
+	"log_stats":             dbus.JournalReadAction,
+	"journal_fields":        dbus.JournalReadAction,
+	"list_coredumps":        dbus.JournalReadAction,
+	"get_coredump_info":     dbus.JournalReadAction,
+	"get_audit_log":         dbus.JournalReadAction,
+	"get_unit_file_content": dbus.FilesReadAction,
+	"list_sysusers":         dbus.FilesReadAction,
+	"get_file":              dbus.FilesReadAction,
+	"find_files":            dbus.FilesReadAction,
+	"grep_files":            dbus.FilesReadAction,
+	"list_sessions":         dbus.SessionsReadAction,
+	"session_info":          dbus.SessionsReadAction,
+}
+
+type CanIParams struct {
+	Tool   string `json:"tool" jsonschema:"Name of the tool to check, e.g. change_unit_state."`
+	Action string `json:"action,omitempty" jsonschema:"Action of change_unit_state, e.g. restart or enable, or operation of apply_plan, e.g. write_dropin."`
+	Unit   string `json:"unit,omitempty" jsonschema:"Unit the tool would be called for, checks also if the restart limit would refuse the action."`
+}
+
+type CanIResult struct {
+	Tool       string `json:"tool"`
+	Action     string `json:"action,omitempty"`
+	Unit       string `json:"unit,omitempty"`
+	Write      bool   `json:"write"`
+	Permission string `json:"permission"`
+	auth.Preview
+	// the restart limit would refuse the action without override
+	Refused string `json:"refused,omitempty"`
+}
+
+func CreateCanISchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[CanIParams](nil)
+	return inputSchema
+}
+
+// toolPermission returns the polkit action a tool is authorized with, for
+// apply_plan the action is the operation
+func toolPermission(tool, action string) (permission string, write bool) {
+	if tool == "apply_plan" && strings.HasSuffix(action, "_dropin") {
+		return dbus.FilesWriteAction, true
+	}
+	if permission, write = writePermissions[tool]; write {
+		return permission, true
+	}
+	if permission, ok := readPermissions[tool]; ok {
+		return permission, false
+	}
+	return dbus.ReadAction, false
+}
+
+// CanI reports if a call of the tool would be authorized and by which
+// mechanism, without calling it and without asking the user, so that an
+// agent can plan without triggering authentication prompts.
+func (conn *Connection) CanI(ctx context.Context, req *mcp.CallToolRequest, params *CanIParams) (*mcp.CallToolResult, any, error) {
+	if params.Tool == "" {
+		return nil, nil, fmt.Errorf("tool is required")
+	}
+	res := CanIResult{
+		Tool:   params.Tool,
+		Action: params.Action,
+		Unit:   params.Unit,
+	}
+	res.Permission, res.Write = toolPermission(params.Tool, params.Action)
+	// a policy decides on the checked call instead of can_i
+	call := policy.Call{Tool: params.Tool, Action: params.Action}
+	if params.Unit != "" {
+		call.Units = []string{params.Unit}
+	}
+	ctx = policy.WithCall(ctx, call)
+	var err error
+	res.Preview, err = conn.auth.Preview(context.WithValue(ctx, dbus.PermissionKey, res.Permission), res.Write)
+	if err != nil {
+		return nil, nil, err
+	}
+	if params.Tool == "change_unit_state" && params.Unit != "" {
+		if err := conn.checkGuard(params.Unit, params.Action, time.Now()); err != nil {
+			res.Refused = err.Error()
+		}
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
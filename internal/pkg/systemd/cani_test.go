@@ -0,0 +1,78 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolPermission(t *testing.T) {
+	permission, write := toolPermission("list_log", "")
+	assert.False(t, write)
+	assert.Equal(t, dbus.JournalReadAction, permission)
+	permission, _ = toolPermission("show_unit", "")
+	assert.Equal(t, dbus.UnitsReadAction, permission)
+	permission, _ = toolPermission("get_file", "")
+	assert.Equal(t, dbus.FilesReadAction, permission)
+	// tools without category
+	permission, write = toolPermission("tpm_status", "")
+	assert.False(t, write)
+	assert.Equal(t, dbus.ReadAction, permission)
+
+	permission, write = toolPermission("change_unit_state", "restart")
+	assert.True(t, write)
+	assert.Equal(t, dbus.UnitsManageAction, permission)
+	permission, _ = toolPermission("change_unit_state", "enable")
+	assert.Equal(t, dbus.UnitsManageAction, permission)
+	permission, write = toolPermission("install_unit", "")
+	assert.True(t, write)
+	assert.Equal(t, dbus.FilesWriteAction, permission)
+	permission, _ = toolPermission("switch_target", "")
+	assert.Equal(t, SwitchTargetPermission, permission)
+	permission, _ = toolPermission("apply_plan", "restart")
+	assert.Equal(t, dbus.UnitsManageAction, permission)
+	permission, _ = toolPermission("apply_plan", "write_dropin")
+	assert.Equal(t, dbus.FilesWriteAction, permission)
+}
+
+func TestCanI(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, false)
+	conn := &Connection{
+		auth: auth,
+		actions: map[string][]UnitAction{
+			"nginx.service": {{"restart", time.Now()}, {"restart", time.Now()}, {"restart", time.Now()}},
+		},
+	}
+	canI := func(params *CanIParams) CanIResult {
+		res, _, err := conn.CanI(context.Background(), nil, params)
+		require.NoError(t, err)
+		var out CanIResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &out))
+		return out
+	}
+
+	out := canI(&CanIParams{Tool: "failed_units"})
+	assert.True(t, out.Allowed)
+	assert.False(t, out.Write)
+	assert.Equal(t, "noauth", out.Mechanism)
+
+	out = canI(&CanIParams{Tool: "change_unit_state", Action: "restart", Unit: "nginx.service"})
+	assert.False(t, out.Allowed)
+	assert.True(t, out.Write)
+	assert.Contains(t, out.Refused, "refusing to restart nginx.service")
+	// the check isn't recorded as action
+	assert.Len(t, conn.actions["nginx.service"], 3)
+
+	out = canI(&CanIParams{Tool: "change_unit_state", Action: "reload", Unit: "nginx.service"})
+	assert.Empty(t, out.Refused)
+
+	_, _, err := conn.CanI(context.Background(), nil, &CanIParams{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,186 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+// ValidBatchChanges are the actions of change_unit_state which can be
+// performed for several units at once
+func ValidBatchChanges() []string {
+	return []string{"enable", "enable_force", "disable", "start", "stop"}
+}
+
+type FileChange struct {
+	Type        string `json:"type"`
+	Filename    string `json:"filename"`
+	Destination string `json:"destination,omitempty"`
+}
+
+// UnitChangeResult is the outcome of the action for one of the names
+type UnitChangeResult struct {
+	Name string `json:"name"`
+	// done, failed, skipped or rolled_back
+	Result  string       `json:"result"`
+	Error   string       `json:"error,omitempty"`
+	Changes []FileChange `json:"changes,omitempty"`
+}
+
+// changeFor reports if the changed link belongs to the unit
+func changeFor(unit string, change FileChange) bool {
+	return filepath.Base(change.Filename) == unit || filepath.Base(change.Destination) == unit
+}
+
+// enableUnits enables or disables the unit files, with allOrNothing in a
+// single call so that systemd applies all of them or fails
+func (conn *Connection) enableUnits(ctx context.Context, params *ChangeUnitStateParams) []UnitChangeResult {
+	apply := func(names []string) ([]FileChange, error) {
+		for _, name := range names {
+			conn.invalidateProperties(name)
+		}
+		var changes []FileChange
+		if params.Action == "disable" {
+			res, err := conn.dbus.DisableUnitFilesContext(ctx, names, params.Runtime)
+			for _, c := range res {
+				changes = append(changes, FileChange{Type: c.Type, Filename: c.Filename, Destination: c.Destination})
+			}
+			return changes, err
+		}
+		_, res, err := conn.dbus.EnableUnitFilesContext(ctx, names, params.Runtime, params.Action == "enable_force")
+		for _, c := range res {
+			changes = append(changes, FileChange{Type: c.Type, Filename: c.Filename, Destination: c.Destination})
+		}
+		return changes, err
+	}
+	results := make([]UnitChangeResult, len(params.Names))
+	if params.AllOrNothing {
+		changes, err := apply(params.Names)
+		for i, name := range params.Names {
+			results[i] = UnitChangeResult{Name: name, Result: "done"}
+			if err != nil {
+				results[i].Result = "failed"
+				results[i].Error = err.Error()
+				continue
+			}
+			for _, c := range changes {
+				if changeFor(name, c) {
+					results[i].Changes = append(results[i].Changes, c)
+				}
+			}
+		}
+		return results
+	}
+	for i, name := range params.Names {
+		results[i] = UnitChangeResult{Name: name, Result: "done"}
+		changes, err := apply([]string{name})
+		if err != nil {
+			results[i].Result = "failed"
+			results[i].Error = err.Error()
+		}
+		results[i].Changes = changes
+	}
+	return results
+}
+
+// activateUnits starts or stops the units one after the other. With
+// allOrNothing the units are left as they were if one of them fails: the
+// remaining ones are skipped and the changed ones are changed back.
+func (conn *Connection) activateUnits(ctx context.Context, params *ChangeUnitStateParams) []UnitChangeResult {
+	setState := func(name string, start bool) error {
+		return conn.waitJob(ctx, func(ch chan<- string) (int, error) {
+			if start {
+				return conn.dbus.StartUnitContext(ctx, name, params.Mode, ch)
+			}
+			return conn.dbus.StopUnitContext(ctx, name, params.Mode, ch)
+		})
+	}
+	start := params.Action == "start"
+	results := make([]UnitChangeResult, 0, len(params.Names))
+	for i, name := range params.Names {
+		if err := setState(name, start); err != nil {
+			results = append(results, UnitChangeResult{Name: name, Result: "failed", Error: err.Error()})
+			if !params.AllOrNothing {
+				continue
+			}
+			for _, skipped := range params.Names[i+1:] {
+				results = append(results, UnitChangeResult{Name: skipped, Result: "skipped"})
+			}
+			for j := i - 1; j >= 0; j-- {
+				if err := setState(results[j].Name, !start); err != nil {
+					results[j].Error = fmt.Sprintf("rolling back failed: %s", err)
+					continue
+				}
+				results[j].Result = "rolled_back"
+			}
+			break
+		}
+		results = append(results, UnitChangeResult{Name: name, Result: "done"})
+	}
+	return results
+}
+
+// changeUnits performs the action of change_unit_state for all names and
+// reports the result of every unit as block of its own
+func (conn *Connection) changeUnits(ctx context.Context, params *ChangeUnitStateParams) (*mcp.CallToolResult, any, error) {
+	if params.Name != "" {
+		return nil, nil, fmt.Errorf("set either name or names")
+	}
+	if !slices.Contains(ValidBatchChanges(), params.Action) {
+		return nil, nil, fmt.Errorf("action %s can't be performed for several units, valid actions are %v", params.Action, ValidBatchChanges())
+	}
+	if params.Mode == "" {
+		params.Mode = "replace"
+	}
+	if params.Action == "start" && !slices.Contains(ValidRestartModes(), params.Mode) {
+		return nil, nil, fmt.Errorf("invalid mode for start: %s", params.Mode)
+	}
+	for _, name := range params.Names {
+		if err := conn.units.Check(name); err != nil {
+			return nil, nil, err
+		}
+	}
+	if params.Delegation != "" {
+		for _, name := range params.Names {
+			if err := conn.checkDelegation(params.Delegation, name, params.Action, time.Now()); err != nil {
+				return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+			}
+		}
+	} else {
+		allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsManageAction))
+		if !allowed || err != nil {
+			slog.Debug("ChangeUnit wasn't authorized", "reason", err)
+			return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+		}
+		defer conn.auth.Deauthorize()
+	}
+	for _, name := range params.Names {
+		if err := conn.guardAction(name, params.Action, params.Override, time.Now()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var results []UnitChangeResult
+	if strings.HasPrefix(params.Action, "enable") || params.Action == "disable" {
+		results = conn.enableUnits(ctx, params)
+	} else {
+		results = conn.activateUnits(ctx, params)
+	}
+	txtContentList := []mcp.Content{}
+	for _, res := range results {
+		jsonByte, err := json.Marshal(res)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+		}
+		txtContentList = append(txtContentList, &mcp.TextContent{Text: string(jsonByte)})
+	}
+	return &mcp.CallToolResult{Content: txtContentList}, nil, nil
+}
@@ -0,0 +1,111 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func unitResults(t *testing.T, res *mcp.CallToolResult) []UnitChangeResult {
+	var results []UnitChangeResult
+	for _, c := range res.Content {
+		var r UnitChangeResult
+		require.NoError(t, json.Unmarshal([]byte(c.(*mcp.TextContent).Text), &r))
+		results = append(results, r)
+	}
+	return results
+}
+
+func TestChangeUnitsActivate(t *testing.T) {
+	var calls []string
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			startUnit: func(name string, mode string) (int, error) {
+				calls = append(calls, "start "+name)
+				if name == "broken.service" {
+					return 0, fmt.Errorf("unit broken.service not found")
+				}
+				return 1, nil
+			},
+			stopUnit: func(name string, mode string) (int, error) {
+				calls = append(calls, "stop "+name)
+				return 2, nil
+			},
+			jobResult: "done",
+		},
+		auth: auth,
+	}
+	names := []string{"a.service", "broken.service", "b.service"}
+
+	res, _, err := conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Names: names, Action: "start"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"start a.service", "start broken.service", "start b.service"}, calls)
+	assert.Equal(t, []UnitChangeResult{
+		{Name: "a.service", Result: "done"},
+		{Name: "broken.service", Result: "failed", Error: "unit broken.service not found"},
+		{Name: "b.service", Result: "done"},
+	}, unitResults(t, res))
+
+	calls = nil
+	res, _, err = conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Names: names, Action: "start", AllOrNothing: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"start a.service", "start broken.service", "stop a.service"}, calls)
+	assert.Equal(t, []UnitChangeResult{
+		{Name: "a.service", Result: "rolled_back"},
+		{Name: "broken.service", Result: "failed", Error: "unit broken.service not found"},
+		{Name: "b.service", Result: "skipped"},
+	}, unitResults(t, res))
+}
+
+func TestChangeUnitsEnable(t *testing.T) {
+	var calls [][]string
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			enableUnitFiles: func(files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error) {
+				calls = append(calls, files)
+				var changes []dbus.EnableUnitFileChange
+				for _, f := range files {
+					changes = append(changes, dbus.EnableUnitFileChange{Type: "symlink", Filename: "/etc/systemd/system/multi-user.target.wants/" + f, Destination: "/usr/lib/systemd/system/" + f})
+				}
+				return false, changes, nil
+			},
+			disableUnitFiles: func(files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
+				return nil, fmt.Errorf("no such file")
+			},
+		},
+		auth: auth,
+	}
+
+	res, _, err := conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Names: []string{"a.service", "b.service"}, Action: "enable", AllOrNothing: true})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a.service", "b.service"}}, calls)
+	results := unitResults(t, res)
+	require.Len(t, results, 2)
+	assert.Equal(t, []FileChange{{Type: "symlink", Filename: "/etc/systemd/system/multi-user.target.wants/b.service", Destination: "/usr/lib/systemd/system/b.service"}}, results[1].Changes)
+
+	calls = nil
+	_, _, err = conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Names: []string{"a.service", "b.service"}, Action: "enable"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a.service"}, {"b.service"}}, calls)
+
+	res, _, err = conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Names: []string{"a.service", "b.service"}, Action: "disable", AllOrNothing: true})
+	require.NoError(t, err)
+	for _, r := range unitResults(t, res) {
+		assert.Equal(t, "failed", r.Result)
+		assert.Equal(t, "no such file", r.Error)
+	}
+
+	_, _, err = conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Names: []string{"a.service"}, Action: "restart"})
+	assert.ErrorContains(t, err, "can't be performed for several units")
+	_, _, err = conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Name: "c.service", Names: []string{"a.service"}, Action: "stop"})
+	assert.ErrorContains(t, err, "either name or names")
+}
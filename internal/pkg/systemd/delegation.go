@@ -0,0 +1,232 @@
+package systemd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+)
+
+const (
+	DefaultDelegationTime = time.Hour
+	MaxDelegationTime     = 24 * time.Hour
+)
+
+// Delegation grants the actions of change_unit_state on the units to the
+// holder of its token until it expires. The token is a bearer token, any
+// session presenting it is granted the actions, but never more than the
+// policy allows. Delegations are kept in memory and signed with a key of the
+// running server, so they end with it.
+type Delegation struct {
+	ID      string    `json:"id"`
+	Units   []string  `json:"units"`
+	Actions []string  `json:"actions"`
+	Expires time.Time `json:"expires"`
+}
+
+type CreateDelegationParams struct {
+	Units   []string `json:"units" jsonschema:"Names or patterns (e.g. 'nginx*.service') of the units the delegation is valid for."`
+	Actions []string `json:"actions" jsonschema:"Actions of change_unit_state which are delegated, e.g. restart."`
+	Minutes int      `json:"minutes,omitempty" jsonschema:"Number of minutes the delegation is valid. At most one day."`
+}
+
+type CreateDelegationResult struct {
+	Delegation
+	// passed as delegation to change_unit_state by another session
+	Token string `json:"token"`
+}
+
+type RevokeDelegationParams struct {
+	ID string `json:"id" jsonschema:"Id of the delegation to revoke."`
+}
+
+func CreateCreateDelegationSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[CreateDelegationParams](nil)
+	var actions []any
+	for _, a := range ValidChanges() {
+		actions = append(actions, a)
+	}
+	inputSchema.Properties["actions"].Items.Enum = actions
+	inputSchema.Properties["minutes"].Default = json.RawMessage(fmt.Sprint(int(DefaultDelegationTime.Minutes())))
+	return inputSchema
+}
+
+func CreateRevokeDelegationSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[RevokeDelegationParams](nil)
+	return inputSchema
+}
+
+// sign returns the signature of the delegation id, the key is created with
+// the first delegation
+func (conn *Connection) sign(id string) string {
+	if conn.delegationKey == nil {
+		conn.delegationKey = make([]byte, 32)
+		rand.Read(conn.delegationKey)
+	}
+	mac := hmac.New(sha256.New, conn.delegationKey)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// mintDelegation stores a new delegation and returns its token
+func (conn *Connection) mintDelegation(units, actions []string, valid time.Duration, now time.Time) (CreateDelegationResult, error) {
+	if len(units) == 0 || len(actions) == 0 {
+		return CreateDelegationResult{}, fmt.Errorf("units and actions are required")
+	}
+	for _, unit := range units {
+		if _, err := path.Match(unit, ""); err != nil {
+			return CreateDelegationResult{}, fmt.Errorf("invalid unit pattern %s: %w", unit, err)
+		}
+	}
+	for _, action := range actions {
+		if !slices.Contains(ValidChanges(), action) {
+			return CreateDelegationResult{}, fmt.Errorf("invalid action %s, valid actions are %v", action, ValidChanges())
+		}
+	}
+	if valid <= 0 || valid > MaxDelegationTime {
+		return CreateDelegationResult{}, fmt.Errorf("a delegation must be valid for 1 to %d minutes", int(MaxDelegationTime.Minutes()))
+	}
+	for _, unit := range units {
+		for _, action := range actions {
+			if err := conn.checkPolicy(unit, action); err != nil {
+				return CreateDelegationResult{}, err
+			}
+		}
+	}
+	idBytes := make([]byte, 8)
+	rand.Read(idBytes)
+	res := CreateDelegationResult{
+		Delegation: Delegation{
+			ID:      hex.EncodeToString(idBytes),
+			Units:   units,
+			Actions: actions,
+			Expires: now.Add(valid),
+		},
+	}
+	conn.delegationsMu.Lock()
+	defer conn.delegationsMu.Unlock()
+	if conn.delegations == nil {
+		conn.delegations = make(map[string]Delegation)
+	}
+	for id, d := range conn.delegations {
+		if now.After(d.Expires) {
+			delete(conn.delegations, id)
+		}
+	}
+	res.Token = res.ID + "." + conn.sign(res.ID)
+	conn.delegations[res.ID] = res.Delegation
+	return res, nil
+}
+
+// checkPolicy returns an error if the policy denies the action of
+// change_unit_state on the unit. The actions the policy asks for are
+// authorized by the delegation.
+func (conn *Connection) checkPolicy(unit, action string) error {
+	if conn.policy == nil {
+		return nil
+	}
+	if decision, _ := conn.policy.Decide(policy.Call{Tool: "change_unit_state", Units: []string{unit}, Action: action}); decision == policy.Deny {
+		return fmt.Errorf("the policy denies %s of %s", action, unit)
+	}
+	return nil
+}
+
+// checkDelegation returns an error if the token doesn't grant the action on
+// the unit or the policy denies it
+func (conn *Connection) checkDelegation(token, unit, action string, now time.Time) error {
+	id, signature, _ := strings.Cut(token, ".")
+	conn.delegationsMu.Lock()
+	defer conn.delegationsMu.Unlock()
+	d, ok := conn.delegations[id]
+	if !ok || !hmac.Equal([]byte(signature), []byte(conn.sign(id))) {
+		return fmt.Errorf("invalid or revoked delegation")
+	}
+	if now.After(d.Expires) {
+		delete(conn.delegations, id)
+		return fmt.Errorf("delegation %s expired at %s", id, d.Expires.Format(time.DateTime))
+	}
+	if !slices.Contains(d.Actions, action) {
+		return fmt.Errorf("delegation %s doesn't grant %s, only %v", id, action, d.Actions)
+	}
+	if !slices.ContainsFunc(d.Units, func(pat string) bool {
+		match, _ := path.Match(pat, unit)
+		return match
+	}) {
+		return fmt.Errorf("delegation %s isn't valid for %s, only for %v", id, unit, d.Units)
+	}
+	// the policy may have been applied to a pattern of the unit only
+	return conn.checkPolicy(unit, action)
+}
+
+// CreateDelegation lets an authorized session hand out a token which grants
+// some actions on some units for a limited time to another session, e.g.
+// restarting two services for the next hour. Actions the policy denies on
+// one of the units can't be delegated.
+func (conn *Connection) CreateDelegation(ctx context.Context, req *mcp.CallToolRequest, params *CreateDelegationParams) (*mcp.CallToolResult, any, error) {
+	// only what the session may do itself can be delegated
+	allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsManageAction))
+	if !allowed || err != nil {
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+	}
+	defer conn.auth.Deauthorize()
+	valid := DefaultDelegationTime
+	if params.Minutes != 0 {
+		valid = time.Duration(params.Minutes) * time.Minute
+	}
+	res, err := conn.mintDelegation(params.Units, params.Actions, valid, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.Info("created delegation", "id", res.ID, "units", res.Units, "actions", res.Actions, "expires", res.Expires)
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
+
+// RevokeDelegation invalidates a delegation before it expires
+func (conn *Connection) RevokeDelegation(ctx context.Context, req *mcp.CallToolRequest, params *RevokeDelegationParams) (*mcp.CallToolResult, any, error) {
+	allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsManageAction))
+	if !allowed || err != nil {
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+	}
+	defer conn.auth.Deauthorize()
+	conn.delegationsMu.Lock()
+	defer conn.delegationsMu.Unlock()
+	if _, ok := conn.delegations[params.ID]; !ok {
+		return nil, nil, fmt.Errorf("no delegation %s", params.ID)
+	}
+	delete(conn.delegations, params.ID)
+	slog.Info("revoked delegation", "id", params.ID)
+	msg := fmt.Sprintf("revoked delegation %s", params.ID)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: msg,
+			},
+		},
+	}, util.Message{Message: msg}, nil
+}
@@ -0,0 +1,66 @@
+package systemd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegation(t *testing.T) {
+	now := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	conn := &Connection{}
+	res, err := conn.mintDelegation([]string{"nginx.service", "php-fpm*"}, []string{"restart"}, time.Hour, now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), res.Expires)
+	assert.True(t, strings.HasPrefix(res.Token, res.ID+"."))
+
+	assert.NoError(t, conn.checkDelegation(res.Token, "nginx.service", "restart", now))
+	assert.NoError(t, conn.checkDelegation(res.Token, "php-fpm@8.service", "restart", now))
+	assert.ErrorContains(t, conn.checkDelegation(res.Token, "nginx.service", "stop", now), "doesn't grant stop")
+	assert.ErrorContains(t, conn.checkDelegation(res.Token, "sshd.service", "restart", now), "isn't valid for sshd.service")
+	assert.ErrorContains(t, conn.checkDelegation(res.ID+".forged", "nginx.service", "restart", now), "invalid")
+	assert.ErrorContains(t, conn.checkDelegation(res.Token, "nginx.service", "restart", now.Add(2*time.Hour)), "expired")
+	// expired delegations are forgotten
+	assert.ErrorContains(t, conn.checkDelegation(res.Token, "nginx.service", "restart", now), "invalid")
+
+	_, err = conn.mintDelegation([]string{"nginx.service"}, []string{"reboot"}, time.Hour, now)
+	assert.Error(t, err)
+	_, err = conn.mintDelegation([]string{"nginx.service"}, []string{"restart"}, 2*MaxDelegationTime, now)
+	assert.Error(t, err)
+	_, err = conn.mintDelegation(nil, []string{"restart"}, time.Hour, now)
+	assert.Error(t, err)
+}
+
+func TestChangeUnitStateDelegation(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, false)
+	conn := &Connection{dbus: &mockDbusConnection{}, auth: auth}
+	res, err := conn.mintDelegation([]string{"nginx.service"}, []string{"restart"}, time.Hour, time.Now())
+	require.NoError(t, err)
+
+	_, _, err = conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Name: "sshd.service", Action: "restart", Delegation: res.Token})
+	assert.ErrorContains(t, err, "isn't valid for sshd.service")
+
+	_, _, err = conn.RevokeDelegation(context.Background(), nil, &RevokeDelegationParams{ID: res.ID})
+	assert.Error(t, err, "revoking needs write authorization")
+}
+
+func TestDelegationPolicy(t *testing.T) {
+	now := time.Now()
+	conn := &Connection{policy: &policy.Policy{Rules: []policy.Rule{
+		{Tool: "change_unit_state", Units: []string{"sshd.service"}, Actions: []string{"stop"}, Decision: policy.Deny},
+	}}}
+	_, err := conn.mintDelegation([]string{"nginx.service", "sshd.service"}, []string{"restart", "stop"}, time.Hour, now)
+	assert.ErrorContains(t, err, "policy denies stop of sshd.service")
+
+	// a pattern is checked against the policy again for every unit
+	res, err := conn.mintDelegation([]string{"*.service"}, []string{"stop"}, time.Hour, now)
+	require.NoError(t, err)
+	assert.NoError(t, conn.checkDelegation(res.Token, "nginx.service", "stop", now))
+	assert.ErrorContains(t, conn.checkDelegation(res.Token, "sshd.service", "stop", now), "policy denies")
+}
@@ -0,0 +1,136 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+// properties which change all the time for a running unit
+var counterProperties = []string{
+	"CPUUsageNSec", "MemoryCurrent", "MemoryAvailable", "MemoryPeak", "MemorySwapCurrent",
+	"MemorySwapPeak", "MemoryZSwapCurrent", "TasksCurrent", "IOReadBytes", "IOWriteBytes",
+	"IOReadOperations", "IOWriteOperations", "IPIngressBytes", "IPEgressBytes",
+	"IPIngressPackets", "IPEgressPackets", "EffectiveMemoryMax", "EffectiveMemoryHigh",
+	"EffectiveTasksMax",
+}
+
+type unitSnapshot struct {
+	taken time.Time
+	props map[string]interface{}
+}
+
+type DiffUnitStateParams struct {
+	Name            string `json:"name" jsonschema:"Exact name of the unit."`
+	Reset           bool   `json:"reset,omitempty" jsonschema:"Discard the stored snapshot and take a new one without reporting changes."`
+	IncludeCounters bool   `json:"include_counters,omitempty" jsonschema:"Also report changes of resource counters like CPUUsageNSec or MemoryCurrent."`
+}
+
+type PropertyChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+type DiffUnitStateResult struct {
+	Name     string                    `json:"name"`
+	Snapshot time.Time                 `json:"snapshot"`
+	Since    time.Time                 `json:"since,omitzero"`
+	Changed  map[string]PropertyChange `json:"changed,omitempty"`
+	Message  string                    `json:"message,omitempty"`
+}
+
+func CreateDiffUnitStateSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[DiffUnitStateParams](nil)
+	inputSchema.Properties["reset"].Default = json.RawMessage(`false`)
+	inputSchema.Properties["include_counters"].Default = json.RawMessage(`false`)
+	return inputSchema
+}
+
+// diffProperties returns the properties which differ in old and new
+func diffProperties(old, new map[string]interface{}, includeCounters bool) map[string]PropertyChange {
+	changed := make(map[string]PropertyChange)
+	for key, newVal := range new {
+		if !includeCounters && slices.Contains(counterProperties, key) {
+			continue
+		}
+		oldVal, ok := old[key]
+		if !ok || !reflect.DeepEqual(oldVal, newVal) {
+			changed[key] = PropertyChange{Old: oldVal, New: newVal}
+		}
+	}
+	for key, oldVal := range old {
+		if !includeCounters && slices.Contains(counterProperties, key) {
+			continue
+		}
+		if _, ok := new[key]; !ok {
+			changed[key] = PropertyChange{Old: oldVal}
+		}
+	}
+	return changed
+}
+
+// DiffUnitState stores a snapshot of the properties of a unit at the first
+// call and returns the properties which changed since the last call on
+// further calls.
+func (conn *Connection) DiffUnitState(ctx context.Context, req *mcp.CallToolRequest, params *DiffUnitStateParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	if params.Name == "" {
+		return nil, nil, fmt.Errorf("unit name is required")
+	}
+	if err := conn.units.Check(params.Name); err != nil {
+		return nil, nil, err
+	}
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, params.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	current := unitSnapshot{
+		taken: time.Now(),
+		props: props,
+	}
+
+	conn.snapshotsMu.Lock()
+	if conn.snapshots == nil {
+		conn.snapshots = make(map[string]unitSnapshot)
+	}
+	previous, ok := conn.snapshots[params.Name]
+	conn.snapshots[params.Name] = current
+	conn.snapshotsMu.Unlock()
+
+	res := DiffUnitStateResult{
+		Name:     params.Name,
+		Snapshot: current.taken,
+	}
+	if !ok || params.Reset {
+		res.Message = fmt.Sprintf("stored snapshot of %d properties, call again to get the changes", len(props))
+	} else {
+		res.Since = previous.taken
+		res.Changed = diffProperties(previous.props, current.props, params.IncludeCounters)
+		if len(res.Changed) == 0 {
+			res.Message = "no properties changed"
+		}
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,69 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffProperties(t *testing.T) {
+	old := map[string]interface{}{"MainPID": uint32(10), "ActiveState": "active", "CPUUsageNSec": uint64(1), "Gone": "x"}
+	new := map[string]interface{}{"MainPID": uint32(20), "ActiveState": "active", "CPUUsageNSec": uint64(2), "Added": "y"}
+
+	changed := diffProperties(old, new, false)
+	assert.Equal(t, map[string]PropertyChange{
+		"MainPID": {Old: uint32(10), New: uint32(20)},
+		"Gone":    {Old: "x"},
+		"Added":   {New: "y"},
+	}, changed)
+
+	changed = diffProperties(old, new, true)
+	assert.Contains(t, changed, "CPUUsageNSec")
+}
+
+func TestDiffUnitState(t *testing.T) {
+	pid := uint32(10)
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				return map[string]interface{}{"Id": unitName, "MainPID": pid}, nil
+			},
+		},
+		auth: auth,
+	}
+	call := func(params *DiffUnitStateParams) DiffUnitStateResult {
+		res, _, err := conn.DiffUnitState(context.Background(), nil, params)
+		require.NoError(t, err)
+		var result DiffUnitStateResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		return result
+	}
+
+	first := call(&DiffUnitStateParams{Name: "test.service"})
+	assert.Empty(t, first.Changed)
+	assert.True(t, first.Since.IsZero())
+
+	pid = 20
+	second := call(&DiffUnitStateParams{Name: "test.service"})
+	require.Contains(t, second.Changed, "MainPID")
+	assert.EqualValues(t, 20, second.Changed["MainPID"].New)
+	assert.False(t, second.Since.IsZero())
+
+	third := call(&DiffUnitStateParams{Name: "test.service"})
+	assert.Empty(t, third.Changed)
+	assert.Equal(t, "no properties changed", third.Message)
+
+	_, _, err := conn.DiffUnitState(context.Background(), nil, &DiffUnitStateParams{})
+	assert.Error(t, err)
+
+	conn.units = &policy.UnitAccess{Denied: []string{"sshd.service"}}
+	_, _, err = conn.DiffUnitState(context.Background(), nil, &DiffUnitStateParams{Name: "sshd.service"})
+	assert.ErrorContains(t, err, "outside of the units")
+}
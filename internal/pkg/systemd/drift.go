@@ -0,0 +1,201 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+	"go.yaml.in/yaml/v3"
+)
+
+// BaselinePath is where the baseline manifest for the drift detection is
+// stored
+var BaselinePath = "/var/lib/systemd-mcp/baseline.yaml"
+
+const (
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+type SaveBaselineParams struct {
+	Patterns []string `json:"patterns,omitempty" jsonschema:"Only store units matching these patterns (e.g. '*.service'). If empty all units are stored."`
+	Sysctl   []string `json:"sysctl,omitempty" jsonschema:"Sysctl keys to store in the baseline, e.g. 'vm.swappiness'."`
+}
+
+type CheckDriftParams struct {
+	Baseline string   `json:"baseline,omitempty" jsonschema:"Baseline manifest as YAML or JSON. Defaults to the stored baseline."`
+	Patterns []string `json:"patterns,omitempty" jsonschema:"Only report units matching these patterns which aren't in the baseline."`
+}
+
+type Deviation struct {
+	Severity string `json:"severity"`
+	Kind     string `json:"kind"`
+	Target   string `json:"target"`
+	Baseline string `json:"baseline,omitempty"`
+	Current  string `json:"current,omitempty"`
+}
+
+type DriftResult struct {
+	Baseline   string      `json:"baseline"`
+	Drifted    bool        `json:"drifted"`
+	Deviations []Deviation `json:"deviations"`
+}
+
+func CreateSaveBaselineSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[SaveBaselineParams](nil)
+	return inputSchema
+}
+
+func CreateCheckDriftSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[CheckDriftParams](nil)
+	return inputSchema
+}
+
+// changeSeverity rates a difference between the baseline and the host, a
+// changed configuration or a stopped unit weighs more than a unit which
+// runs but isn't expected to
+func changeSeverity(c Change) string {
+	switch c.Kind {
+	case "dropin":
+		return SeverityHigh
+	case "active":
+		if c.Desired == "true" {
+			return SeverityHigh
+		}
+		return SeverityLow
+	}
+	return SeverityMedium
+}
+
+// Drift compares the host against the baseline. Besides the differences of
+// the baseline, enabled units and drop-ins which aren't in the baseline are
+// reported. Units outside of the unit scope are ignored.
+func (conn *Connection) Drift(ctx context.Context, baseline *Manifest, patterns []string) ([]Deviation, error) {
+	scoped := *baseline
+	scoped.Units = slices.DeleteFunc(slices.Clone(baseline.Units), func(u UnitManifest) bool {
+		return !conn.units.Permits(u.Name)
+	})
+	baseline = &scoped
+	changes, err := conn.plan(ctx, baseline)
+	if err != nil {
+		return nil, err
+	}
+	deviations := []Deviation{}
+	for _, c := range changes {
+		dev := Deviation{Severity: changeSeverity(c), Kind: c.Kind, Target: c.Target, Baseline: c.Desired, Current: c.Current}
+		if c.Kind == "dropin" {
+			dev.Kind = "dropin-changed"
+			if c.Current == "" {
+				dev.Kind = "dropin-missing"
+			}
+		}
+		deviations = append(deviations, dev)
+	}
+
+	current, err := conn.exportManifest(ctx, &ExportManifestParams{Patterns: patterns})
+	if err != nil {
+		return nil, err
+	}
+	for _, unit := range current.Units {
+		idx := slices.IndexFunc(baseline.Units, func(u UnitManifest) bool { return u.Name == unit.Name })
+		if unit.Enabled != nil && (idx < 0 || baseline.Units[idx].Enabled == nil) {
+			deviations = append(deviations, Deviation{Severity: SeverityMedium, Kind: "unexpected-enabled", Target: unit.Name, Current: "enabled"})
+		}
+		for _, d := range unit.DropIns {
+			if idx >= 0 && slices.ContainsFunc(baseline.Units[idx].DropIns, func(b DropIn) bool { return b.Name == d.Name }) {
+				continue
+			}
+			deviations = append(deviations, Deviation{Severity: SeverityHigh, Kind: "unexpected-dropin", Target: dropinPath(unit.Name, d.Name), Current: d.Content})
+		}
+	}
+	return deviations, nil
+}
+
+// ReadBaseline reads the stored baseline manifest
+func ReadBaseline() (*Manifest, error) {
+	data, err := os.ReadFile(BaselinePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no baseline stored at %s, save one first", BaselinePath)
+		}
+		return nil, err
+	}
+	return ParseManifest(string(data))
+}
+
+// SaveBaseline stores the current configuration of the host as baseline for
+// the drift detection
+func (conn *Connection) SaveBaseline(ctx context.Context, req *mcp.CallToolRequest, params *SaveBaselineParams) (*mcp.CallToolResult, any, error) {
+	allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.FilesWriteAction))
+	if !allowed || err != nil {
+		slog.Debug("SaveBaseline wasn't authorized", "reason", err)
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+	}
+	defer conn.auth.Deauthorize()
+	manifest, err := conn.exportManifest(ctx, &ExportManifestParams{Patterns: params.Patterns, Sysctl: params.Sysctl, IncludeActive: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := yaml.Marshal(manifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal baseline: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(BaselinePath), 0700); err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(BaselinePath, data, 0600); err != nil {
+		return nil, nil, err
+	}
+	msg := fmt.Sprintf("stored baseline with %d units and %d sysctls at %s", len(manifest.Units), len(manifest.Sysctl), BaselinePath)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: msg},
+		},
+	}, util.Message{Message: msg}, nil
+}
+
+// CheckDrift lists the deviations of the host from the baseline
+func (conn *Connection) CheckDrift(ctx context.Context, req *mcp.CallToolRequest, params *CheckDriftParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	res := DriftResult{Baseline: "request"}
+	var baseline *Manifest
+	var err error
+	if params.Baseline != "" {
+		baseline, err = ParseManifest(params.Baseline)
+	} else {
+		res.Baseline = BaselinePath
+		baseline, err = ReadBaseline()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.Deviations, err = conn.Drift(ctx, baseline, params.Patterns); err != nil {
+		return nil, nil, err
+	}
+	res.Drifted = len(res.Deviations) > 0
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
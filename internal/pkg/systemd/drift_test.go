@@ -0,0 +1,101 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrift(t *testing.T) {
+	setupApply(t)
+	BaselinePath = filepath.Join(t.TempDir(), "baseline.yaml")
+	unitFiles := []dbus.UnitFile{{Path: "/usr/lib/systemd/system/foo.service", Type: "enabled"}}
+	active := "active"
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			listUnitFiles: func() ([]dbus.UnitFile, error) {
+				return unitFiles, nil
+			},
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return []dbus.UnitStatus{{Name: "foo.service", ActiveState: active}}, nil
+			},
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				state := "disabled"
+				for _, f := range unitFiles {
+					if filepath.Base(f.Path) == unitName {
+						state = f.Type
+					}
+				}
+				return map[string]interface{}{"UnitFileState": state, "ActiveState": active}, nil
+			},
+		},
+		auth: auth,
+	}
+	ctx := context.Background()
+
+	_, _, err := conn.CheckDrift(ctx, nil, &CheckDriftParams{})
+	assert.ErrorContains(t, err, "no baseline")
+
+	_, _, err = conn.SaveBaseline(ctx, nil, &SaveBaselineParams{Sysctl: []string{"vm.swappiness"}})
+	require.NoError(t, err)
+	check := func() DriftResult {
+		res, _, err := conn.CheckDrift(ctx, nil, &CheckDriftParams{})
+		require.NoError(t, err)
+		var result DriftResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		return result
+	}
+	assert.False(t, check().Drifted)
+
+	// change the host behind the back of the baseline
+	active = "inactive"
+	unitFiles = append(unitFiles, dbus.UnitFile{Path: "/etc/systemd/system/miner.service", Type: "enabled"})
+	require.NoError(t, os.WriteFile(filepath.Join(sysctlRoot, "vm", "swappiness"), []byte("1\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dropinRoot, "sshd.service.d"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dropinRoot, "sshd.service.d", "override.conf"), []byte("[Service]\n"), 0644))
+
+	result := check()
+	assert.True(t, result.Drifted)
+	assert.Equal(t, BaselinePath, result.Baseline)
+	assert.ElementsMatch(t, []Deviation{
+		{Severity: SeverityMedium, Kind: "sysctl", Target: "vm.swappiness", Baseline: "60", Current: "1"},
+		{Severity: SeverityHigh, Kind: "active", Target: "foo.service", Baseline: "true", Current: "inactive"},
+		{Severity: SeverityMedium, Kind: "unexpected-enabled", Target: "miner.service", Current: "enabled"},
+		{Severity: SeverityHigh, Kind: "unexpected-dropin", Target: filepath.Join(dropinRoot, "sshd.service.d", "override.conf"), Current: "[Service]\n"},
+	}, result.Deviations)
+
+	// a given baseline is used instead of the stored one
+	res, _, err := conn.CheckDrift(ctx, nil, &CheckDriftParams{Baseline: `units: [{name: foo.service, dropins: [{name: a.conf, content: x}]}]`, Patterns: []string{"foo.service"}})
+	require.NoError(t, err)
+	var given DriftResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &given))
+	assert.Equal(t, "request", given.Baseline)
+	assert.Equal(t, []Deviation{
+		{Severity: SeverityHigh, Kind: "dropin-missing", Target: filepath.Join(dropinRoot, "foo.service.d", "a.conf"), Baseline: "x"},
+		{Severity: SeverityMedium, Kind: "unexpected-enabled", Target: "foo.service", Current: "enabled"},
+	}, given.Deviations)
+
+	readOnly, _ := auth_pkg.NewNoAuth(true, false)
+	conn.auth = readOnly
+	_, _, err = conn.SaveBaseline(ctx, nil, &SaveBaselineParams{})
+	assert.Error(t, err)
+
+	// units out of scope are neither compared nor reported
+	conn.auth = auth
+	conn.units = &policy.UnitAccess{Denied: []string{"foo.service", "miner.service", "sshd.service"}}
+	res, _, err = conn.CheckDrift(ctx, nil, &CheckDriftParams{Baseline: `units: [{name: foo.service, dropins: [{name: a.conf, content: x}]}]`})
+	require.NoError(t, err)
+	var scoped DriftResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &scoped))
+	assert.False(t, scoped.Drifted)
+}
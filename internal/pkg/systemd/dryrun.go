@@ -0,0 +1,185 @@
+package systemd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/openSUSE/systemd-mcp/internal/pkg/dryrun"
+)
+
+const (
+	systemdManager = "org.freedesktop.systemd1.Manager"
+	logindManager  = "org.freedesktop.login1.Manager"
+)
+
+// dbus methods of the actions of change_unit_state
+var changeMethods = map[string][]string{
+	"start":         {systemdManager + ".StartUnit"},
+	"stop":          {systemdManager + ".StopUnit"},
+	"stop_kill":     {systemdManager + ".KillUnit"},
+	"restart":       {systemdManager + ".ReloadOrRestartUnit"},
+	"restart_force": {systemdManager + ".RestartUnit"},
+	"reload":        {systemdManager + ".ReloadOrRestartUnit"},
+	"enable":        {systemdManager + ".EnableUnitFiles"},
+	"enable_force":  {systemdManager + ".EnableUnitFiles"},
+	"disable":       {systemdManager + ".DisableUnitFiles"},
+	"reset_failed":  {systemdManager + ".ResetFailedUnit"},
+}
+
+// dbus methods of the actions of power_action
+var powerMethods = map[string]string{
+	"reboot":            logindManager + ".Reboot",
+	"poweroff":          logindManager + ".PowerOff",
+	"suspend":           logindManager + ".Suspend",
+	"hibernate":         logindManager + ".Hibernate",
+	"schedule_shutdown": logindManager + ".ScheduleShutdown",
+	"cancel_shutdown":   logindManager + ".CancelScheduledShutdown",
+}
+
+func stringArg(args map[string]any, key string) string {
+	s, _ := args[key].(string)
+	return s
+}
+
+func boolArg(args map[string]any, key string) bool {
+	b, _ := args[key].(bool)
+	return b
+}
+
+// unitsArg returns the units of the name and the names argument
+func unitsArg(args map[string]any) []string {
+	var units []string
+	if name := stringArg(args, "name"); name != "" {
+		units = append(units, name)
+	}
+	names, _ := args["names"].([]any)
+	for _, n := range names {
+		if s, ok := n.(string); ok {
+			units = append(units, s)
+		}
+	}
+	return units
+}
+
+// changeEffects describes a call of change_unit_state
+func changeEffects(args map[string]any) dryrun.Effects {
+	action := stringArg(args, "action")
+	effects := dryrun.Effects{DBusMethods: changeMethods[action]}
+	if action == "enable" || action == "enable_force" || action == "disable" {
+		root := dropinRoot
+		if boolArg(args, "runtime") {
+			root = filepath.Join(runtimeRoot, "system")
+		}
+		for _, unit := range unitsArg(args) {
+			effects.Files = append(effects.Files, fmt.Sprintf("links of the [Install] section of %s below %s", unit, root))
+		}
+	}
+	return effects
+}
+
+// DryRunTools describes the write tools for the dry run. apply_state,
+// apply_plan and apply_sysusers preview a call by themselves.
+func DryRunTools() map[string]dryrun.Tool {
+	effects := map[string]func(args map[string]any) dryrun.Effects{
+		"change_unit_state": changeEffects,
+		"check_restart_reload": func(args map[string]any) dryrun.Effects {
+			return dryrun.Effects{}
+		},
+		"create_delegation": func(args map[string]any) dryrun.Effects {
+			return dryrun.Effects{}
+		},
+		"revoke_delegation": func(args map[string]any) dryrun.Effects {
+			return dryrun.Effects{}
+		},
+		"set_environment": func(args map[string]any) dryrun.Effects {
+			return dryrun.Effects{DBusMethods: []string{systemdManager + ".SetEnvironment"}}
+		},
+		"unset_environment": func(args map[string]any) dryrun.Effects {
+			return dryrun.Effects{DBusMethods: []string{systemdManager + ".UnsetEnvironment"}}
+		},
+		"install_unit": func(args map[string]any) dryrun.Effects {
+			effects := dryrun.Effects{
+				DBusMethods: []string{systemdManager + ".Reload"},
+				Files:       []string{filepath.Join(unitRoot, stringArg(args, "name"))},
+			}
+			if boolArg(args, "enable") {
+				effects.DBusMethods = append(effects.DBusMethods, systemdManager+".EnableUnitFiles")
+			}
+			if boolArg(args, "start") {
+				effects.DBusMethods = append(effects.DBusMethods, systemdManager+".StartUnit")
+			}
+			return effects
+		},
+		"save_baseline": func(args map[string]any) dryrun.Effects {
+			return dryrun.Effects{Files: []string{BaselinePath}}
+		},
+		"journal_upload": func(args map[string]any) dryrun.Effects {
+			if stringArg(args, "url") == "" {
+				return dryrun.Effects{}
+			}
+			return dryrun.Effects{
+				DBusMethods: []string{systemdManager + ".EnableUnitFiles", systemdManager + ".RestartUnit"},
+				Files:       []string{filepath.Join(uploadConfRoot, "journal-upload.conf.d", uploadDropIn)},
+			}
+		},
+		"set_runbook": func(args map[string]any) dryrun.Effects {
+			path, err := runbookPath(stringArg(args, "unit"))
+			if err != nil {
+				return dryrun.Effects{}
+			}
+			return dryrun.Effects{Files: []string{path}}
+		},
+		"put_file": func(args map[string]any) dryrun.Effects {
+			return dryrun.Effects{Files: []string{stringArg(args, "path")}}
+		},
+		"switch_target": func(args map[string]any) dryrun.Effects {
+			return dryrun.Effects{DBusMethods: []string{systemdManager + ".StartUnit with mode isolate"}}
+		},
+		"set_default_target": func(args map[string]any) dryrun.Effects {
+			return dryrun.Effects{
+				DBusMethods: []string{systemdManager + ".SetDefaultTarget", systemdManager + ".Reload"},
+				Files:       []string{filepath.Join(unitRoot, "default.target")},
+			}
+		},
+		"terminate_session": func(args map[string]any) dryrun.Effects {
+			return dryrun.Effects{DBusMethods: []string{logindManager + ".TerminateSession"}}
+		},
+		"lock_seat": func(args map[string]any) dryrun.Effects {
+			return dryrun.Effects{DBusMethods: []string{logindManager + ".LockSession for each session of the seat"}}
+		},
+		"revoke_authorizations": func(args map[string]any) dryrun.Effects {
+			return dryrun.Effects{DBusMethods: []string{"org.freedesktop.PolicyKit1.Authority.RevokeTemporaryAuthorizationById"}}
+		},
+		"power_action": func(args map[string]any) dryrun.Effects {
+			effects := dryrun.Effects{}
+			if stringArg(args, "message") != "" {
+				effects.DBusMethods = append(effects.DBusMethods, logindManager+".SetWallMessage")
+			}
+			if method, ok := powerMethods[stringArg(args, "action")]; ok {
+				effects.DBusMethods = append(effects.DBusMethods, method)
+			}
+			return effects
+		},
+	}
+	previews := map[string]struct {
+		arg   string
+		value any
+	}{
+		"apply_state":    {"apply", false},
+		"apply_plan":     {"validate", true},
+		"apply_sysusers": {"dry_run", true},
+	}
+	tools := make(map[string]dryrun.Tool)
+	for name, permission := range writePermissions {
+		tool := dryrun.Tool{Permission: permission, Effects: effects[name]}
+		if p, ok := previews[name]; ok {
+			tool.PreviewArgument = p.arg
+			tool.PreviewValue = p.value
+		}
+		tools[name] = tool
+	}
+	// the temporary authorizations of the own session are revoked without
+	// polkit action
+	tools["revoke_authorizations"] = dryrun.Tool{Effects: effects["revoke_authorizations"]}
+	return tools
+}
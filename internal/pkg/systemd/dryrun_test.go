@@ -0,0 +1,33 @@
+package systemd
+
+import (
+	"testing"
+
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunTools(t *testing.T) {
+	tools := DryRunTools()
+	for name := range writePermissions {
+		assert.Contains(t, tools, name)
+	}
+
+	change := tools["change_unit_state"]
+	assert.Equal(t, dbus.UnitsManageAction, change.Permission)
+	effects := change.Effects(map[string]any{"names": []any{"a.service", "b.service"}, "action": "enable", "runtime": true})
+	assert.Equal(t, []string{systemdManager + ".EnableUnitFiles"}, effects.DBusMethods)
+	assert.Equal(t, []string{
+		"links of the [Install] section of a.service below /run/systemd/system",
+		"links of the [Install] section of b.service below /run/systemd/system",
+	}, effects.Files)
+	effects = change.Effects(map[string]any{"name": "a.service", "action": "restart"})
+	assert.Equal(t, []string{systemdManager + ".ReloadOrRestartUnit"}, effects.DBusMethods)
+	assert.Empty(t, effects.Files)
+
+	effects = tools["set_runbook"].Effects(map[string]any{"unit": "nginx.service"})
+	assert.Equal(t, []string{RunbookDir + "/nginx.service.md"}, effects.Files)
+
+	assert.Equal(t, "validate", tools["apply_plan"].PreviewArgument)
+	assert.Equal(t, true, tools["apply_plan"].PreviewValue)
+}
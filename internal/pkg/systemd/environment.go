@@ -0,0 +1,204 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+)
+
+type GetEnvironmentParams struct {
+	Unit string `json:"unit,omitempty" jsonschema:"Also show the environment of this unit and what its processes inherit."`
+}
+
+type SetEnvironmentParams struct {
+	Assignments []string `json:"assignments" jsonschema:"Variables to set in the manager environment in the form 'NAME=value'."`
+}
+
+type UnsetEnvironmentParams struct {
+	Names []string `json:"names" jsonschema:"Names of the variables to remove from the manager environment."`
+}
+
+type EnvironmentFile struct {
+	Path     string `json:"path"`
+	Optional bool   `json:"optional"`
+}
+
+type UnitEnvironment struct {
+	Name             string            `json:"name"`
+	Environment      []string          `json:"environment"`
+	EnvironmentFiles []EnvironmentFile `json:"environment_files,omitempty"`
+	PassEnvironment  []string          `json:"pass_environment,omitempty"`
+	UnsetEnvironment []string          `json:"unset_environment,omitempty"`
+	// manager environment merged with the unit settings, without the
+	// content of the environment files
+	Inherited []string `json:"inherited"`
+}
+
+type EnvironmentResult struct {
+	Manager []string         `json:"manager"`
+	Unit    *UnitEnvironment `json:"unit,omitempty"`
+}
+
+func CreateGetEnvironmentSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[GetEnvironmentParams](nil)
+	return inputSchema
+}
+
+func CreateSetEnvironmentSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[SetEnvironmentParams](nil)
+	return inputSchema
+}
+
+func CreateUnsetEnvironmentSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[UnsetEnvironmentParams](nil)
+	return inputSchema
+}
+
+// mergeEnvironment applies the assignments on top of base, later
+// assignments win, unset removes variables or single assignments
+func mergeEnvironment(base, assignments, unset []string) []string {
+	env := make(map[string]string)
+	var order []string
+	for _, assignment := range slices.Concat(base, assignments) {
+		name, _, ok := strings.Cut(assignment, "=")
+		if !ok {
+			continue
+		}
+		if _, ok := env[name]; !ok {
+			order = append(order, name)
+		}
+		env[name] = assignment
+	}
+	merged := []string{}
+	for _, name := range order {
+		if slices.Contains(unset, name) || slices.Contains(unset, env[name]) {
+			continue
+		}
+		merged = append(merged, env[name])
+	}
+	return merged
+}
+
+func stringList(val any) []string {
+	list, _ := val.([]string)
+	return list
+}
+
+// environment files are a(sb), the bool is true if the file may be missing
+func environmentFiles(val any) (files []EnvironmentFile) {
+	list, _ := val.([][]interface{})
+	for _, entry := range list {
+		if len(entry) != 2 {
+			continue
+		}
+		path, _ := entry[0].(string)
+		optional, _ := entry[1].(bool)
+		files = append(files, EnvironmentFile{Path: path, Optional: optional})
+	}
+	return files
+}
+
+// GetEnvironment returns the environment of the manager and optionally the
+// environment a unit inherits
+func (conn *Connection) GetEnvironment(ctx context.Context, req *mcp.CallToolRequest, params *GetEnvironmentParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	env, err := conn.dbus.GetManagerEnvironmentContext(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't get manager environment: %w", err)
+	}
+	res := EnvironmentResult{Manager: env}
+	if res.Manager == nil {
+		res.Manager = []string{}
+	}
+	if params.Unit != "" {
+		props, err := conn.dbus.GetAllPropertiesContext(ctx, params.Unit)
+		if err != nil {
+			return nil, nil, err
+		}
+		unit := UnitEnvironment{
+			Name:             params.Unit,
+			Environment:      stringList(props["Environment"]),
+			EnvironmentFiles: environmentFiles(props["EnvironmentFiles"]),
+			PassEnvironment:  stringList(props["PassEnvironment"]),
+			UnsetEnvironment: stringList(props["UnsetEnvironment"]),
+		}
+		if unit.Environment == nil {
+			unit.Environment = []string{}
+		}
+		unit.Inherited = mergeEnvironment(res.Manager, unit.Environment, unit.UnsetEnvironment)
+		res.Unit = &unit
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
+
+// SetEnvironment adds or changes variables of the manager environment
+func (conn *Connection) SetEnvironment(ctx context.Context, req *mcp.CallToolRequest, params *SetEnvironmentParams) (*mcp.CallToolResult, any, error) {
+	if len(params.Assignments) == 0 {
+		return nil, nil, fmt.Errorf("no assignments given")
+	}
+	for _, assignment := range params.Assignments {
+		if name, _, ok := strings.Cut(assignment, "="); !ok || name == "" {
+			return nil, nil, fmt.Errorf("invalid assignment %q, must be of the form NAME=value", assignment)
+		}
+	}
+	allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsManageAction))
+	if !allowed || err != nil {
+		slog.Debug("SetEnvironment wasn't authorized", "reason", err)
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+	}
+	defer conn.auth.Deauthorize()
+	if err := conn.dbus.SetEnvironmentContext(ctx, params.Assignments); err != nil {
+		return nil, nil, fmt.Errorf("error when setting environment: %w", err)
+	}
+	msg := fmt.Sprintf("set %s in the manager environment, units inherit it on their next start", strings.Join(params.Assignments, " "))
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: msg},
+		},
+	}, util.Message{Message: msg}, nil
+}
+
+// UnsetEnvironment removes variables from the manager environment
+func (conn *Connection) UnsetEnvironment(ctx context.Context, req *mcp.CallToolRequest, params *UnsetEnvironmentParams) (*mcp.CallToolResult, any, error) {
+	if len(params.Names) == 0 {
+		return nil, nil, fmt.Errorf("no names given")
+	}
+	allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsManageAction))
+	if !allowed || err != nil {
+		slog.Debug("UnsetEnvironment wasn't authorized", "reason", err)
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+	}
+	defer conn.auth.Deauthorize()
+	if err := conn.dbus.UnsetEnvironmentContext(ctx, params.Names); err != nil {
+		return nil, nil, fmt.Errorf("error when unsetting environment: %w", err)
+	}
+	msg := fmt.Sprintf("removed %s from the manager environment, units lose it on their next start", strings.Join(params.Names, " "))
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: msg},
+		},
+	}, util.Message{Message: msg}, nil
+}
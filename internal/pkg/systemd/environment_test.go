@@ -0,0 +1,87 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeEnvironment(t *testing.T) {
+	merged := mergeEnvironment(
+		[]string{"PATH=/usr/bin", "LANG=C", "http_proxy=http://proxy"},
+		[]string{"LANG=de_DE.UTF-8", "FOO=bar", "invalid"},
+		[]string{"http_proxy"},
+	)
+	assert.Equal(t, []string{"PATH=/usr/bin", "LANG=de_DE.UTF-8", "FOO=bar"}, merged)
+	assert.Equal(t, []string{}, mergeEnvironment(nil, nil, nil))
+	assert.Equal(t, []string{"A=2"}, mergeEnvironment([]string{"A=1"}, []string{"A=2", "B=1"}, []string{"B=1"}))
+}
+
+func TestGetEnvironment(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			managerEnvironment: func() ([]string, error) {
+				return []string{"PATH=/usr/bin", "https_proxy=http://proxy"}, nil
+			},
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				return map[string]interface{}{
+					"Environment":      []string{"FOO=bar"},
+					"EnvironmentFiles": [][]interface{}{{"/etc/sysconfig/foo", true}},
+					"UnsetEnvironment": []string{"https_proxy"},
+				}, nil
+			},
+		},
+		auth: auth,
+	}
+	res, _, err := conn.GetEnvironment(context.Background(), nil, &GetEnvironmentParams{Unit: "foo.service"})
+	require.NoError(t, err)
+	var result EnvironmentResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+	assert.Equal(t, []string{"PATH=/usr/bin", "https_proxy=http://proxy"}, result.Manager)
+	require.NotNil(t, result.Unit)
+	assert.Equal(t, []EnvironmentFile{{Path: "/etc/sysconfig/foo", Optional: true}}, result.Unit.EnvironmentFiles)
+	assert.Equal(t, []string{"PATH=/usr/bin", "FOO=bar"}, result.Unit.Inherited)
+}
+
+func TestSetUnsetEnvironment(t *testing.T) {
+	var set, unset []string
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			setEnvironment: func(assignments []string) error {
+				set = assignments
+				return nil
+			},
+			unsetEnvironment: func(names []string) error {
+				unset = names
+				return nil
+			},
+		},
+		auth: auth,
+	}
+	_, _, err := conn.SetEnvironment(context.Background(), nil, &SetEnvironmentParams{Assignments: []string{"http_proxy=http://proxy:3128"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http_proxy=http://proxy:3128"}, set)
+
+	_, _, err = conn.SetEnvironment(context.Background(), nil, &SetEnvironmentParams{Assignments: []string{"novalue"}})
+	assert.Error(t, err)
+	_, _, err = conn.SetEnvironment(context.Background(), nil, &SetEnvironmentParams{Assignments: []string{"=value"}})
+	assert.Error(t, err)
+
+	_, _, err = conn.UnsetEnvironment(context.Background(), nil, &UnsetEnvironmentParams{Names: []string{"http_proxy"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http_proxy"}, unset)
+	_, _, err = conn.UnsetEnvironment(context.Background(), nil, &UnsetEnvironmentParams{})
+	assert.Error(t, err)
+
+	readOnly, _ := auth_pkg.NewNoAuth(true, false)
+	conn.auth = readOnly
+	_, _, err = conn.SetEnvironment(context.Background(), nil, &SetEnvironmentParams{Assignments: []string{"A=1"}})
+	assert.Error(t, err)
+}
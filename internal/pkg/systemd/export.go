@@ -0,0 +1,172 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"go.yaml.in/yaml/v3"
+)
+
+type ExportManifestParams struct {
+	Patterns      []string `json:"patterns,omitempty" jsonschema:"Only export units matching these patterns (e.g. '*.service'). If empty all units are exported."`
+	Sysctl        []string `json:"sysctl,omitempty" jsonschema:"Sysctl keys to export, e.g. 'vm.swappiness'."`
+	IncludeActive bool     `json:"include_active,omitempty" jsonschema:"Also export whether the enabled units are active."`
+	Format        string   `json:"format,omitempty" jsonschema:"Format of the manifest."`
+}
+
+func CreateExportManifestSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ExportManifestParams](nil)
+	inputSchema.Properties["include_active"].Default = json.RawMessage(`true`)
+	inputSchema.Properties["format"].Enum = []any{"yaml", "json"}
+	inputSchema.Properties["format"].Default = json.RawMessage(`"yaml"`)
+	return inputSchema
+}
+
+func matchesAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pat := range patterns {
+		if match, _ := path.Match(pat, name); match {
+			return true
+		}
+	}
+	return false
+}
+
+// readDropIns returns the drop-ins below dropinRoot by unit name
+func readDropIns(patterns []string) (map[string][]DropIn, error) {
+	dirs, err := filepath.Glob(filepath.Join(dropinRoot, "*.d"))
+	if err != nil {
+		return nil, err
+	}
+	dropins := make(map[string][]DropIn)
+	for _, dir := range dirs {
+		unit := strings.TrimSuffix(filepath.Base(dir), ".d")
+		if !strings.Contains(unit, ".") || !matchesAny(patterns, unit) {
+			continue
+		}
+		files, _ := filepath.Glob(filepath.Join(dir, "*.conf"))
+		for _, file := range files {
+			if info, err := os.Lstat(file); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			dropins[unit] = append(dropins[unit], DropIn{Name: filepath.Base(file), Content: string(content)})
+		}
+	}
+	return dropins, nil
+}
+
+// exportManifest collects the enabled units, the drop-ins and the given
+// sysctls in a manifest which can be passed to ApplyManifest
+func (conn *Connection) exportManifest(ctx context.Context, params *ExportManifestParams) (*Manifest, error) {
+	unitFiles, err := conn.dbus.ListUnitFilesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	units := make(map[string]*UnitManifest)
+	var enabled []string
+	for _, file := range unitFiles {
+		name := path.Base(file.Path)
+		// templates can only be enabled with an instance
+		if file.Type != "enabled" || strings.Contains(name, "@.") || !matchesAny(params.Patterns, name) || !conn.units.Permits(name) {
+			continue
+		}
+		enabled = append(enabled, name)
+		enable := true
+		units[name] = &UnitManifest{Name: name, Enabled: &enable}
+	}
+	if params.IncludeActive && len(enabled) > 0 {
+		states, err := conn.dbus.ListUnitsByPatternsContext(ctx, nil, enabled)
+		if err != nil {
+			return nil, err
+		}
+		active := make(map[string]bool)
+		for _, state := range states {
+			active[state.Name] = isActive(state.ActiveState)
+		}
+		for _, name := range enabled {
+			state := active[name]
+			units[name].Active = &state
+		}
+	}
+	dropins, err := readDropIns(params.Patterns)
+	if err != nil {
+		return nil, err
+	}
+	for name, list := range dropins {
+		if !conn.units.Permits(name) {
+			continue
+		}
+		if _, ok := units[name]; !ok {
+			units[name] = &UnitManifest{Name: name}
+		}
+		units[name].DropIns = list
+	}
+
+	manifest := &Manifest{}
+	for _, name := range slices.Sorted(maps.Keys(units)) {
+		manifest.Units = append(manifest.Units, *units[name])
+	}
+	for _, key := range params.Sysctl {
+		if !sysctlKey.MatchString(key) {
+			return nil, fmt.Errorf("invalid sysctl key: %q", key)
+		}
+		val, err := os.ReadFile(sysctlPath(key))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read sysctl %s: %w", key, err)
+		}
+		if manifest.Sysctl == nil {
+			manifest.Sysctl = make(map[string]string)
+		}
+		manifest.Sysctl[key] = normalizeSysctl(string(val))
+	}
+	return manifest, nil
+}
+
+// ExportManifest returns the configuration of the host as manifest, the
+// inverse of ApplyManifest
+func (conn *Connection) ExportManifest(ctx context.Context, req *mcp.CallToolRequest, params *ExportManifestParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	manifest, err := conn.exportManifest(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	var out []byte
+	switch params.Format {
+	case "", "yaml":
+		out, err = yaml.Marshal(manifest)
+	case "json":
+		out, err = json.MarshalIndent(manifest, "", "  ")
+	default:
+		return nil, nil, fmt.Errorf("invalid format: %s", params.Format)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(out),
+			},
+		},
+	}, manifest, nil
+}
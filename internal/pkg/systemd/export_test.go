@@ -0,0 +1,79 @@
+package systemd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportManifest(t *testing.T) {
+	setupApply(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(dropinRoot, "foo.service.d"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dropinRoot, "foo.service.d", "10-limits.conf"), []byte("[Service]\nLimitNOFILE=4096\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dropinRoot, "foo.service.d", "notes.txt"), []byte("ignored"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dropinRoot, "bar.socket.d"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dropinRoot, "bar.socket.d", "override.conf"), []byte("[Socket]\n"), 0644))
+
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			listUnitFiles: func() ([]dbus.UnitFile, error) {
+				return []dbus.UnitFile{
+					{Path: "/usr/lib/systemd/system/foo.service", Type: "enabled"},
+					{Path: "/usr/lib/systemd/system/baz.timer", Type: "enabled"},
+					{Path: "/usr/lib/systemd/system/getty@.service", Type: "enabled"},
+					{Path: "/usr/lib/systemd/system/off.service", Type: "disabled"},
+				}, nil
+			},
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return []dbus.UnitStatus{{Name: "foo.service", ActiveState: "active"}}, nil
+			},
+		},
+		auth: auth,
+	}
+	manifest, err := conn.exportManifest(context.Background(), &ExportManifestParams{IncludeActive: true, Sysctl: []string{"vm.swappiness"}})
+	require.NoError(t, err)
+	require.Len(t, manifest.Units, 3)
+	assert.Equal(t, "bar.socket", manifest.Units[0].Name)
+	assert.Nil(t, manifest.Units[0].Enabled)
+	assert.Equal(t, []DropIn{{Name: "override.conf", Content: "[Socket]\n"}}, manifest.Units[0].DropIns)
+	assert.Equal(t, "baz.timer", manifest.Units[1].Name)
+	assert.False(t, *manifest.Units[1].Active)
+	assert.Equal(t, "foo.service", manifest.Units[2].Name)
+	assert.True(t, *manifest.Units[2].Enabled)
+	assert.True(t, *manifest.Units[2].Active)
+	assert.Len(t, manifest.Units[2].DropIns, 1)
+	assert.Equal(t, map[string]string{"vm.swappiness": "60"}, manifest.Sysctl)
+
+	manifest, err = conn.exportManifest(context.Background(), &ExportManifestParams{Patterns: []string{"*.timer"}})
+	require.NoError(t, err)
+	require.Len(t, manifest.Units, 1)
+	assert.Nil(t, manifest.Units[0].Active)
+
+	// the exported manifest is accepted by apply and results in an empty plan
+	res, _, err := conn.ExportManifest(context.Background(), nil, &ExportManifestParams{Patterns: []string{"foo.service"}, Sysctl: []string{"vm.swappiness"}})
+	require.NoError(t, err)
+	conn.dbus.(*mockDbusConnection).getAllProperties = func(unitName string) (map[string]interface{}, error) {
+		return map[string]interface{}{"UnitFileState": "enabled", "ActiveState": "active"}, nil
+	}
+	res, _, err = conn.ApplyManifest(context.Background(), nil, &ApplyParams{Manifest: res.Content[0].(*mcp.TextContent).Text})
+	require.NoError(t, err)
+	assert.Empty(t, applyResult(t, res).Plan)
+
+	_, err = conn.exportManifest(context.Background(), &ExportManifestParams{Sysctl: []string{"../etc/shadow"}})
+	assert.Error(t, err)
+
+	conn.units = &policy.UnitAccess{Denied: []string{"foo.service", "bar.socket"}}
+	manifest, err = conn.exportManifest(context.Background(), &ExportManifestParams{})
+	require.NoError(t, err)
+	require.Len(t, manifest.Units, 1)
+	assert.Equal(t, "baz.timer", manifest.Units[0].Name)
+}
@@ -0,0 +1,211 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+)
+
+type FailedUnitsParams struct {
+	Patterns []string `json:"patterns,omitempty" jsonschema:"Only report failed units matching these names or patterns (e.g. '*.service')."`
+	Lines    int      `json:"lines,omitempty" jsonschema:"Number of journal lines of the current boot to attach to every failed unit. Set to -1 to omit the log."`
+	// reduced in the order log lines, units
+	MaxTokensHint int `json:"max_tokens_hint,omitempty" jsonschema:"Approximate number of tokens the response may use. The log lines and the number of units are reduced to fit and the omissions are reported."`
+}
+
+// properties of a unit which are relevant for triage, the names
+// match the dbus properties
+type failedUnitProperties struct {
+	Description            string `json:"Description"`
+	LoadState              string `json:"LoadState"`
+	ActiveState            string `json:"ActiveState"`
+	SubState               string `json:"SubState"`
+	FragmentPath           string `json:"FragmentPath"`
+	Result                 string `json:"Result"`
+	ExecMainCode           int32  `json:"ExecMainCode"`
+	ExecMainStatus         int32  `json:"ExecMainStatus"`
+	NRestarts              uint32 `json:"NRestarts"`
+	InactiveEnterTimestamp uint64 `json:"InactiveEnterTimestamp"`
+}
+
+type FailedUnit struct {
+	Name                   string     `json:"name"`
+	Description            string     `json:"description,omitempty"`
+	DescriptionLanguage    string     `json:"description_language,omitempty"`
+	DescriptionTranslation string     `json:"description_translation,omitempty"`
+	LoadState              string     `json:"load_state"`
+	SubState               string     `json:"sub_state"`
+	FragmentPath           string     `json:"fragment_path,omitempty"`
+	Result                 string     `json:"result,omitempty"`
+	ExecMainCode           string     `json:"exec_main_code,omitempty"`
+	ExecMainStatus         int32      `json:"exec_main_status"`
+	NRestarts              uint32     `json:"n_restarts,omitempty"`
+	FailedSince            time.Time  `json:"failed_since,omitzero"`
+	Owner                  *UnitOwner `json:"owner,omitempty"`
+	HasRunbook             bool       `json:"has_runbook,omitempty"`
+	Log                    []string   `json:"log,omitempty"`
+	LogError               string     `json:"log_error,omitempty"`
+}
+
+type FailedUnitsResult struct {
+	NrFailed int           `json:"nr_failed"`
+	Units    []FailedUnit  `json:"units"`
+	Shaping  *util.Shaping `json:"shaping,omitempty"`
+}
+
+const DefaultFailedLogLines = 10
+
+func CreateFailedUnitsSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[FailedUnitsParams](nil)
+	inputSchema.Properties["lines"].Default = json.RawMessage(fmt.Sprint(DefaultFailedLogLines))
+	return inputSchema
+}
+
+// execMainCodeName translates the si_code of the main process (CLD_*) to
+// the names used by systemctl
+func execMainCodeName(code int32) string {
+	switch code {
+	case 1:
+		return "exited"
+	case 2:
+		return "killed"
+	case 3:
+		return "dumped"
+	case 4:
+		return "trapped"
+	case 5:
+		return "stopped"
+	case 6:
+		return "continued"
+	}
+	return ""
+}
+
+// shapeFailedUnits shortens the logs to the newest lines and drops units
+// until the result fits into maxTokens
+func shapeFailedUnits(res *FailedUnitsResult, maxTokens int) *util.Shaping {
+	shaping := &util.Shaping{MaxTokensHint: maxTokens}
+	lines := maxLogLines(res.Units)
+	if lines > 0 && !shaping.Fits(res) {
+		for lines > 0 && !shaping.Fits(res) {
+			lines /= 2
+			for i := range res.Units {
+				if len(res.Units[i].Log) > lines {
+					res.Units[i].Log = res.Units[i].Log[len(res.Units[i].Log)-lines:]
+				}
+			}
+		}
+		shaping.Reduce(fmt.Sprintf("log lines to %d", lines))
+	}
+	for !shaping.Fits(res) && len(res.Units) > 0 {
+		keep := shaping.Shrink(len(res.Units))
+		shaping.Omitted += len(res.Units) - keep
+		res.Units = res.Units[:keep]
+	}
+	if len(shaping.Reduced) == 0 && shaping.Omitted == 0 {
+		return nil
+	}
+	return shaping
+}
+
+func maxLogLines(units []FailedUnit) (lines int) {
+	for _, u := range units {
+		lines = max(lines, len(u.Log))
+	}
+	return lines
+}
+
+// failedUnit collects the state, result and the last log lines of a
+// failed unit
+func (conn *Connection) failedUnit(ctx context.Context, u sddbus.UnitStatus, owners Owners, lines int) FailedUnit {
+	failed := FailedUnit{
+		Name:        u.Name,
+		Description: u.Description,
+		LoadState:   u.LoadState,
+		SubState:    u.SubState,
+		Owner:       owners.Lookup(u.Name),
+		HasRunbook:  hasRunbook(u.Name),
+	}
+	failed.DescriptionLanguage, failed.DescriptionTranslation = conn.lang.Tag(ctx, u.Description)
+	if props, err := conn.dbus.GetAllPropertiesContext(ctx, u.Name); err != nil {
+		slog.Warn("failed to get properties for unit", "unit", u.Name, "error", err)
+	} else {
+		prop := failedUnitProperties{}
+		tmp, _ := json.Marshal(props)
+		if err := json.Unmarshal(tmp, &prop); err != nil {
+			slog.Warn("failed to unmarshal properties", "unit", u.Name, "error", err)
+		}
+		failed.FragmentPath = prop.FragmentPath
+		failed.Result = prop.Result
+		failed.ExecMainCode = execMainCodeName(prop.ExecMainCode)
+		failed.ExecMainStatus = prop.ExecMainStatus
+		failed.NRestarts = prop.NRestarts
+		if prop.InactiveEnterTimestamp != 0 {
+			failed.FailedSince = time.UnixMicro(int64(prop.InactiveEnterTimestamp))
+		}
+	}
+	if conn.log != nil && lines > 0 {
+		var err error
+		failed.Log, err = conn.log.UnitLog(ctx, u.Name, lines)
+		if err != nil {
+			failed.LogError = err.Error()
+		}
+	}
+	return failed
+}
+
+// ListFailedUnits collects everything needed to triage failed units in a
+// single call: state, result, exit code of the main process and the last
+// journal lines.
+func (conn *Connection) ListFailedUnits(ctx context.Context, req *mcp.CallToolRequest, params *FailedUnitsParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	lines := params.Lines
+	if lines == 0 {
+		lines = DefaultFailedLogLines
+	}
+
+	units, err := conn.dbus.ListUnitsByPatternsContext(ctx, []string{"failed"}, params.Patterns)
+	if err != nil {
+		return nil, nil, err
+	}
+	units = slices.DeleteFunc(units, func(u sddbus.UnitStatus) bool {
+		return !conn.units.Permits(u.Name)
+	})
+
+	res := FailedUnitsResult{
+		Units: []FailedUnit{},
+	}
+	owners := unitOwners()
+	for _, u := range units {
+		res.Units = append(res.Units, conn.failedUnit(ctx, u, owners, lines))
+	}
+	res.NrFailed = len(res.Units)
+	if params.MaxTokensHint > 0 {
+		res.Shaping = shapeFailedUnits(&res, params.MaxTokensHint)
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,169 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/lang"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogReader struct {
+	lines map[string][]string
+	jobs  map[string][]string
+	err   error
+}
+
+func (m *mockLogReader) UnitJobResults(ctx context.Context, unit string, count int) ([]string, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.jobs[unit], nil
+}
+
+func (m *mockLogReader) UnitLog(ctx context.Context, unit string, count int) ([]string, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	lines := m.lines[unit]
+	if len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+	return lines, nil
+}
+
+func TestListFailedUnits(t *testing.T) {
+	mock := &mockDbusConnection{
+		listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+			if len(states) != 1 || states[0] != "failed" {
+				return nil, fmt.Errorf("unexpected states %v", states)
+			}
+			return []dbus.UnitStatus{{Name: "test.service", LoadState: "loaded", ActiveState: "failed", SubState: "failed"}}, nil
+		},
+		getAllProperties: func(unitName string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"Result":                 "exit-code",
+				"ExecMainCode":           int32(1),
+				"ExecMainStatus":         int32(203),
+				"NRestarts":              uint32(2),
+				"InactiveEnterTimestamp": uint64(1700000000000000),
+			}, nil
+		},
+	}
+
+	t.Run("with log", func(t *testing.T) {
+		auth, _ := auth_pkg.NewNoAuth(true, true)
+		conn := &Connection{
+			dbus: mock,
+			auth: auth,
+			log:  &mockLogReader{lines: map[string][]string{"test.service": {"one", "two", "three"}}},
+		}
+		res, _, err := conn.ListFailedUnits(context.Background(), nil, &FailedUnitsParams{Lines: 2})
+		require.NoError(t, err)
+
+		var result FailedUnitsResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		assert.Equal(t, 1, result.NrFailed)
+		unit := result.Units[0]
+		assert.Equal(t, "test.service", unit.Name)
+		assert.Equal(t, "exit-code", unit.Result)
+		assert.Equal(t, "exited", unit.ExecMainCode)
+		assert.Equal(t, int32(203), unit.ExecMainStatus)
+		assert.Equal(t, uint32(2), unit.NRestarts)
+		assert.Equal(t, []string{"two", "three"}, unit.Log)
+		assert.False(t, unit.FailedSince.IsZero())
+	})
+
+	t.Run("log error is reported per unit", func(t *testing.T) {
+		auth, _ := auth_pkg.NewNoAuth(true, true)
+		conn := &Connection{
+			dbus: mock,
+			auth: auth,
+			log:  &mockLogReader{err: fmt.Errorf("no journal")},
+		}
+		res, _, err := conn.ListFailedUnits(context.Background(), nil, &FailedUnitsParams{})
+		require.NoError(t, err)
+
+		var result FailedUnitsResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		assert.Equal(t, "no journal", result.Units[0].LogError)
+	})
+
+	t.Run("description language", func(t *testing.T) {
+		auth, _ := auth_pkg.NewNoAuth(true, true)
+		german := &mockDbusConnection{
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return []dbus.UnitStatus{{Name: "test.service", Description: "Der Dienst für die Zeit", ActiveState: "failed"}}, nil
+			},
+			getAllProperties: mock.getAllProperties,
+		}
+		conn := &Connection{dbus: german, auth: auth, lang: lang.NewTagger(nil, "en")}
+		res, _, err := conn.ListFailedUnits(context.Background(), nil, &FailedUnitsParams{})
+		require.NoError(t, err)
+
+		var result FailedUnitsResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		assert.Equal(t, "de", result.Units[0].DescriptionLanguage)
+		assert.Empty(t, result.Units[0].DescriptionTranslation)
+	})
+
+	t.Run("read not authorized", func(t *testing.T) {
+		auth, _ := auth_pkg.NewNoAuth(false, false)
+		conn := &Connection{dbus: mock, auth: auth}
+		_, _, err := conn.ListFailedUnits(context.Background(), nil, &FailedUnitsParams{})
+		assert.Error(t, err)
+	})
+
+	t.Run("units out of scope are left out", func(t *testing.T) {
+		auth, _ := auth_pkg.NewNoAuth(true, true)
+		scoped := &mockDbusConnection{
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return []dbus.UnitStatus{{Name: "sshd.service", ActiveState: "failed"}, {Name: "test.service", ActiveState: "failed"}}, nil
+			},
+			getAllProperties: mock.getAllProperties,
+		}
+		conn := &Connection{dbus: scoped, auth: auth, units: &policy.UnitAccess{Denied: []string{"sshd.service"}}}
+		res, _, err := conn.ListFailedUnits(context.Background(), nil, &FailedUnitsParams{})
+		require.NoError(t, err)
+
+		var result FailedUnitsResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		require.Len(t, result.Units, 1)
+		assert.Equal(t, "test.service", result.Units[0].Name)
+	})
+}
+
+func TestShapeFailedUnits(t *testing.T) {
+	res := FailedUnitsResult{}
+	for i := range 10 {
+		var log []string
+		for j := range 8 {
+			log = append(log, fmt.Sprintf("unit %d log line %d", i, j))
+		}
+		res.Units = append(res.Units, FailedUnit{Name: fmt.Sprintf("unit%d.service", i), Log: log})
+	}
+	res.NrFailed = len(res.Units)
+
+	shaping := shapeFailedUnits(&res, 400)
+	require.NotNil(t, shaping)
+	assert.Equal(t, []string{"log lines to 2"}, shaping.Reduced)
+	assert.Zero(t, shaping.Omitted)
+	// the newest lines are kept
+	assert.Equal(t, []string{"unit 0 log line 6", "unit 0 log line 7"}, res.Units[0].Log)
+
+	shaping = shapeFailedUnits(&res, 60)
+	require.NotNil(t, shaping)
+	assert.Equal(t, []string{"log lines to 0"}, shaping.Reduced)
+	assert.NotZero(t, shaping.Omitted)
+	assert.Equal(t, 10, shaping.Omitted+len(res.Units))
+	assert.LessOrEqual(t, shaping.EstimatedTokens, 60)
+
+	assert.Nil(t, shapeFailedUnits(&FailedUnitsResult{Units: []FailedUnit{{Name: "a.service"}}}, 400))
+}
@@ -0,0 +1,99 @@
+package systemd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RestartLimit is the number of disruptive actions change_unit_state
+// performs on a unit within RestartWindow before it refuses further ones
+// without override, so that an agent in a loop can't flap a service. Zero
+// disables the limit.
+var (
+	RestartLimit  = 3
+	RestartWindow = 10 * time.Minute
+)
+
+// actions which interrupt the service of a unit
+var disruptiveActions = []string{"start", "stop", "stop_kill", "restart", "restart_force"}
+
+// actions which interrupt the service of a running unit or keep it from
+// starting at boot
+var destructiveActions = []string{"stop", "stop_kill", "restart", "restart_force", "disable"}
+
+// IsDestructiveChange reports if a call of change_unit_state with the
+// arguments is destructive, for the safety classification of the results
+func IsDestructiveChange(args map[string]any) bool {
+	action, _ := args["action"].(string)
+	return slices.Contains(destructiveActions, action)
+}
+
+type UnitAction struct {
+	Action string    `json:"action"`
+	Time   time.Time `json:"time"`
+}
+
+// recentActions returns the disruptive actions on the unit within the
+// window and forgets the older ones
+func (conn *Connection) recentActions(unit string, now time.Time) []UnitAction {
+	recent := slices.DeleteFunc(conn.actions[unit], func(a UnitAction) bool {
+		return now.Sub(a.Time) > RestartWindow
+	})
+	if len(recent) == 0 {
+		delete(conn.actions, unit)
+	} else {
+		conn.actions[unit] = recent
+	}
+	return recent
+}
+
+// guardAction records a disruptive action on the unit and refuses it if
+// the unit already had RestartLimit of them within RestartWindow, unless
+// override is set
+func (conn *Connection) guardAction(unit, action string, override bool, now time.Time) error {
+	if !slices.Contains(disruptiveActions, action) || RestartLimit <= 0 {
+		return nil
+	}
+	conn.actionsMu.Lock()
+	defer conn.actionsMu.Unlock()
+	if conn.actions == nil {
+		conn.actions = make(map[string][]UnitAction)
+	}
+	recent := conn.recentActions(unit, now)
+	if len(recent) >= RestartLimit && !override {
+		return refusal(unit, action, recent)
+	}
+	conn.actions[unit] = append(recent, UnitAction{Action: action, Time: now})
+	return nil
+}
+
+// checkGuard returns the error guardAction would return for the action
+// without override, but doesn't record it
+func (conn *Connection) checkGuard(unit, action string, now time.Time) error {
+	if !slices.Contains(disruptiveActions, action) || RestartLimit <= 0 {
+		return nil
+	}
+	conn.actionsMu.Lock()
+	defer conn.actionsMu.Unlock()
+	var recent []UnitAction
+	for _, a := range conn.actions[unit] {
+		if now.Sub(a.Time) <= RestartWindow {
+			recent = append(recent, a)
+		}
+	}
+	if len(recent) >= RestartLimit {
+		return refusal(unit, action, recent)
+	}
+	return nil
+}
+
+func refusal(unit, action string, recent []UnitAction) error {
+	var history []string
+	for _, a := range recent {
+		history = append(history, fmt.Sprintf("%s at %s", a.Action, a.Time.Format(time.TimeOnly)))
+	}
+	return fmt.Errorf("refusing to %s %s, it had %d start, stop or restart actions in the last %s (%s), check why it fails instead or set override to do it anyway",
+		action, unit, len(recent), RestartWindow, strings.Join(history, ", "))
+}
@@ -0,0 +1,95 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/confirm"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardAction(t *testing.T) {
+	now := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	conn := &Connection{}
+	for i := range RestartLimit {
+		require.NoError(t, conn.guardAction("nginx.service", "restart", false, now.Add(time.Duration(i)*time.Minute)))
+	}
+	// reloads and other units aren't limited
+	assert.NoError(t, conn.guardAction("nginx.service", "reload", false, now))
+	assert.NoError(t, conn.guardAction("sshd.service", "restart", false, now))
+
+	err := conn.guardAction("nginx.service", "restart", false, now.Add(5*time.Minute))
+	assert.ErrorContains(t, err, "refusing to restart nginx.service")
+	assert.ErrorContains(t, err, "restart at 10:00:00")
+	assert.NoError(t, conn.guardAction("nginx.service", "restart", true, now.Add(5*time.Minute)))
+
+	// the oldest actions leave the window
+	assert.NoError(t, conn.guardAction("nginx.service", "start", false, now.Add(RestartWindow+3*time.Minute)))
+}
+
+func TestChangeUnitStateGuard(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{},
+		auth: auth,
+		actions: map[string][]UnitAction{
+			"nginx.service": {{"restart", time.Now()}, {"restart", time.Now()}, {"restart", time.Now()}},
+		},
+	}
+	_, _, err := conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Name: "nginx.service", Action: "restart"})
+	assert.ErrorContains(t, err, "set override")
+}
+
+func TestChangeUnitStateUnitAccess(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	units, err := policy.NewUnitAccess([]string{"nginx*.service"}, nil)
+	require.NoError(t, err)
+	conn := &Connection{dbus: &mockDbusConnection{}, auth: auth}
+	conn.SetUnitAccess(units)
+	_, _, err = conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Name: "sshd.service", Action: "restart"})
+	assert.ErrorContains(t, err, "sshd.service is outside")
+}
+
+func TestIsDestructiveChange(t *testing.T) {
+	assert.True(t, IsDestructiveChange(map[string]any{"action": "stop"}))
+	assert.True(t, IsDestructiveChange(map[string]any{"action": "disable"}))
+	assert.False(t, IsDestructiveChange(map[string]any{"action": "reload"}))
+	assert.False(t, IsDestructiveChange(map[string]any{}))
+}
+
+func TestConfirmDestructive(t *testing.T) {
+	c := confirm.New(confirm.DefaultTTL)
+	c.Require("change_unit_state", IsDestructiveChange)
+	c.Require("apply_plan", IsDestructivePlan)
+	c.Require("apply_state", IsDestructiveManifest)
+	tests := []struct {
+		tool    string
+		args    string
+		confirm bool
+	}{
+		{"change_unit_state", `{"names": ["a.service", "b.service"], "action": "stop"}`, true},
+		{"change_unit_state", `{"names": ["a.service", "b.service"], "action": "disable"}`, true},
+		{"change_unit_state", `{"names": ["a.service", "b.service"], "action": "enable"}`, false},
+		{"apply_plan", `{"operations": [{"op": "write_dropin", "unit": "a.service"}, {"op": "stop", "unit": "b.service"}]}`, true},
+		{"apply_plan", `{"operations": [{"op": "disable", "unit": "a.service"}]}`, true},
+		{"apply_plan", `{"operations": [{"op": "restart", "unit": "a.service"}]}`, true},
+		{"apply_plan", `{"operations": [{"op": "write_dropin", "unit": "a.service"}, {"op": "start", "unit": "a.service"}]}`, false},
+		{"apply_plan", `{"operations": [{"op": "stop", "unit": "a.service"}], "validate": true}`, false},
+		{"apply_state", `{"manifest": "units: [{name: a.service, active: false}]", "apply": true}`, true},
+		{"apply_state", `{"manifest": "units: [{name: a.service, enabled: false}]", "apply": true}`, true},
+		{"apply_state", `{"manifest": "units: [{name: a.service, enabled: true, active: true}]", "apply": true}`, false},
+		{"apply_state", `{"manifest": "units: [{name: a.service, active: false}]"}`, false},
+	}
+	for _, tt := range tests {
+		var args map[string]any
+		require.NoError(t, json.Unmarshal([]byte(tt.args), &args))
+		request, err := c.Confirm("s1", tt.tool, args, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, tt.confirm, request != nil, "%s %s", tt.tool, tt.args)
+	}
+}
@@ -0,0 +1,204 @@
+package systemd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+// new unit files are written to this directory
+var unitRoot = "/etc/systemd/system"
+
+var (
+	unitNameRe  = regexp.MustCompile(`^[a-zA-Z0-9:_.\\-]+(@[a-zA-Z0-9:_.\\-]*)?\.[a-z]+$`)
+	unitSection = regexp.MustCompile(`^\[[A-Za-z][A-Za-z0-9-]*\]$`)
+	unitKey     = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+)
+
+var unitTypes = []string{"service", "socket", "target", "timer", "path", "mount", "automount", "swap", "slice", "scope"}
+
+type InstallUnitParams struct {
+	Name      string `json:"name" jsonschema:"Name of the unit file, e.g. backup.service."`
+	Content   string `json:"content" jsonschema:"Full content of the unit file."`
+	Overwrite bool   `json:"overwrite,omitempty" jsonschema:"Replace an existing unit file in /etc/systemd/system."`
+	Enable    bool   `json:"enable,omitempty" jsonschema:"Enable the unit after installing it."`
+	Start     bool   `json:"start,omitempty" jsonschema:"Start the unit after installing it."`
+}
+
+type InstallUnitResult struct {
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`
+	Installed  bool     `json:"installed"`
+	LoadState  string   `json:"load_state,omitempty"`
+	Enabled    bool     `json:"enabled"`
+	Started    bool     `json:"started"`
+	Error      string   `json:"error,omitempty"`
+	RolledBack []string `json:"rolled_back,omitempty"`
+}
+
+func CreateInstallUnitSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[InstallUnitParams](nil)
+	inputSchema.Properties["overwrite"].Default = json.RawMessage(`false`)
+	inputSchema.Properties["enable"].Default = json.RawMessage(`false`)
+	inputSchema.Properties["start"].Default = json.RawMessage(`false`)
+	return inputSchema
+}
+
+// validateUnitFile checks the name and the syntax of a unit file, the
+// settings themselves are checked by systemd on the reload.
+func validateUnitFile(name, content string) error {
+	if !unitNameRe.MatchString(name) {
+		return fmt.Errorf("invalid unit name: %q", name)
+	}
+	unitType := name[strings.LastIndex(name, ".")+1:]
+	if !slices.Contains(unitTypes, unitType) {
+		return fmt.Errorf("invalid unit type %q, must be one of %v", unitType, unitTypes)
+	}
+	sections, err := unitSections(content)
+	if err != nil {
+		return err
+	}
+	typeSection := strings.ToUpper(unitType[:1]) + unitType[1:]
+	if !slices.Contains(sections, typeSection) && unitType != "target" {
+		return fmt.Errorf("unit file has no [%s] section", typeSection)
+	}
+	return nil
+}
+
+// unitSections checks the syntax of a unit file or drop-in and returns its
+// sections
+func unitSections(content string) ([]string, error) {
+	var sections []string
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	continued := false
+	for nr := 1; scanner.Scan(); nr++ {
+		line := strings.TrimSpace(scanner.Text())
+		wasContinued := continued
+		continued = strings.HasSuffix(line, "\\")
+		switch {
+		case wasContinued, line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "["):
+			if !unitSection.MatchString(line) {
+				return nil, fmt.Errorf("line %d: invalid section header %q", nr, line)
+			}
+			sections = append(sections, strings.Trim(line, "[]"))
+		default:
+			key, _, ok := strings.Cut(line, "=")
+			if !ok || !unitKey.MatchString(strings.TrimSpace(key)) {
+				return nil, fmt.Errorf("line %d: expected Key=Value, got %q", nr, line)
+			}
+			if len(sections) == 0 {
+				return nil, fmt.Errorf("line %d: assignment outside of a section", nr)
+			}
+		}
+	}
+	return sections, scanner.Err()
+}
+
+// checkLoaded fails if systemd couldn't load the unit after the reload
+func (conn *Connection) checkLoaded(ctx context.Context, name string, res *InstallUnitResult) error {
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, name)
+	if err != nil {
+		return err
+	}
+	res.LoadState, _ = props["LoadState"].(string)
+	if res.LoadState != "loaded" {
+		if loadErr, ok := props["LoadError"].([]interface{}); ok && len(loadErr) == 2 {
+			return fmt.Errorf("unit is %s: %v", res.LoadState, loadErr[1])
+		}
+		return fmt.Errorf("unit is %s", res.LoadState)
+	}
+	return nil
+}
+
+// InstallUnit writes a new unit file below /etc/systemd/system, reloads the
+// manager and enables or starts the unit if requested. If a step fails the
+// already applied steps are reverted.
+func (conn *Connection) InstallUnit(ctx context.Context, req *mcp.CallToolRequest, params *InstallUnitParams) (*mcp.CallToolResult, any, error) {
+	if err := validateUnitFile(params.Name, params.Content); err != nil {
+		return nil, nil, err
+	}
+	if err := conn.units.Check(params.Name); err != nil {
+		return nil, nil, err
+	}
+	if strings.Contains(params.Name, "@.") && params.Start {
+		return nil, nil, fmt.Errorf("template %s can't be started, start an instance of it", params.Name)
+	}
+	path := filepath.Join(unitRoot, params.Name)
+	current, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	if err == nil && !params.Overwrite {
+		return nil, nil, fmt.Errorf("%s already exists, set overwrite to replace it", path)
+	}
+
+	allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.FilesWriteAction))
+	if !allowed || err != nil {
+		slog.Debug("InstallUnit wasn't authorized", "reason", err)
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+	}
+	defer conn.auth.Deauthorize()
+
+	res := InstallUnitResult{Name: params.Name, Path: path}
+	steps := []step{
+		{
+			desc: "write unit file " + path,
+			do:   func() error { return writeFileOrRemove(path, params.Content) },
+			undo: func() error { return writeFileOrRemove(path, string(current)) },
+		},
+		{
+			desc: "reload the manager configuration",
+			do:   func() error { return conn.dbus.ReloadContext(ctx) },
+			undo: func() error { return conn.dbus.ReloadContext(ctx) },
+		},
+		{
+			desc: "check that " + params.Name + " is loaded",
+			do:   func() error { return conn.checkLoaded(ctx, params.Name, &res) },
+			undo: func() error { return nil },
+		},
+	}
+	if params.Enable {
+		steps = append(steps, step{
+			desc: "enable " + params.Name,
+			do:   func() error { return conn.setEnabled(ctx, params.Name, true) },
+			undo: func() error { return conn.setEnabled(ctx, params.Name, false) },
+		})
+	}
+	if params.Start {
+		steps = append(steps, step{
+			desc: "start " + params.Name,
+			do:   func() error { return conn.setActive(ctx, params.Name, true) },
+			undo: func() error { return conn.setActive(ctx, params.Name, false) },
+		})
+	}
+	res.RolledBack, err = runSteps(steps)
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Installed, res.Enabled, res.Started = true, params.Enable, params.Start
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,138 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testUnit = `[Unit]
+Description=Nightly backup
+
+[Service]
+Type=oneshot
+ExecStart=/usr/bin/backup \
+  --all
+# comment
+`
+
+func TestValidateUnitFile(t *testing.T) {
+	assert.NoError(t, validateUnitFile("backup.service", testUnit))
+	assert.NoError(t, validateUnitFile("getty@.service", testUnit))
+	assert.NoError(t, validateUnitFile("backup.target", "[Unit]\nDescription=Backup\n"))
+
+	for name, content := range map[string]string{
+		"../backup.service": testUnit,
+		"backup":            testUnit,
+		"backup.conf":       testUnit,
+		"backup.timer":      testUnit,
+		"foo.service":       "ExecStart=/bin/true\n[Service]\n",
+		"bar.service":       "[Service]\nExecStart\n",
+		"baz.service":       "[Service\nExecStart=/bin/true\n",
+	} {
+		assert.Error(t, validateUnitFile(name, content), name)
+	}
+}
+
+func installResult(t *testing.T, res *mcp.CallToolResult) InstallUnitResult {
+	var result InstallUnitResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+	return result
+}
+
+func TestInstallUnit(t *testing.T) {
+	unitRoot = t.TempDir()
+	var calls []string
+	loadState := "loaded"
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	mock := &mockDbusConnection{
+		getAllProperties: func(unitName string) (map[string]interface{}, error) {
+			return map[string]interface{}{"LoadState": loadState,
+				"LoadError": []interface{}{"org.freedesktop.systemd1.BadUnitSetting", "Unit has a bad unit file setting."}}, nil
+		},
+		reload: func() error {
+			calls = append(calls, "reload")
+			return nil
+		},
+		startUnit: func(name string, mode string) (int, error) {
+			calls = append(calls, "start "+name)
+			return 1, nil
+		},
+		enableUnitFiles: func(files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error) {
+			calls = append(calls, "enable "+files[0])
+			return false, nil, nil
+		},
+		disableUnitFiles: func(files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
+			calls = append(calls, "disable "+files[0])
+			return nil, nil
+		},
+		jobResult: "done",
+	}
+	conn := &Connection{dbus: mock, auth: auth}
+
+	params := &InstallUnitParams{Name: "backup.service", Content: testUnit, Enable: true, Start: true}
+	res, _, err := conn.InstallUnit(context.Background(), nil, params)
+	require.NoError(t, err)
+	result := installResult(t, res)
+	assert.True(t, result.Installed)
+	assert.True(t, result.Started)
+	assert.Equal(t, "loaded", result.LoadState)
+	assert.Equal(t, []string{"reload", "enable backup.service", "start backup.service"}, calls)
+	content, err := os.ReadFile(filepath.Join(unitRoot, "backup.service"))
+	require.NoError(t, err)
+	assert.Equal(t, testUnit, string(content))
+
+	_, _, err = conn.InstallUnit(context.Background(), nil, params)
+	assert.ErrorContains(t, err, "already exists")
+
+	// a unit which systemd refuses to load is removed again
+	calls = nil
+	loadState = "bad-setting"
+	res, _, err = conn.InstallUnit(context.Background(), nil, &InstallUnitParams{Name: "broken.service", Content: testUnit, Enable: true})
+	require.NoError(t, err)
+	result = installResult(t, res)
+	assert.False(t, result.Installed)
+	assert.Contains(t, result.Error, "bad unit file setting")
+	assert.Equal(t, []string{"reload", "reload"}, calls)
+	_, err = os.Stat(filepath.Join(unitRoot, "broken.service"))
+	assert.True(t, os.IsNotExist(err))
+
+	// a failing start reverts the enable and restores the old file
+	calls = nil
+	loadState = "loaded"
+	mock.startUnit = func(name string, mode string) (int, error) {
+		return 0, fmt.Errorf("start failed")
+	}
+	params.Overwrite = true
+	params.Content = "[Service]\nExecStart=/bin/false\n"
+	res, _, err = conn.InstallUnit(context.Background(), nil, params)
+	require.NoError(t, err)
+	result = installResult(t, res)
+	assert.False(t, result.Installed)
+	assert.Len(t, result.RolledBack, 4)
+	assert.Contains(t, calls, "disable backup.service")
+	content, _ = os.ReadFile(filepath.Join(unitRoot, "backup.service"))
+	assert.Equal(t, testUnit, string(content))
+
+	readOnly, _ := auth_pkg.NewNoAuth(true, false)
+	conn.auth = readOnly
+	_, _, err = conn.InstallUnit(context.Background(), nil, &InstallUnitParams{Name: "other.service", Content: testUnit})
+	assert.Error(t, err)
+
+	conn.auth = auth
+	conn.units = &policy.UnitAccess{Denied: []string{"sshd.service"}}
+	_, _, err = conn.InstallUnit(context.Background(), nil, &InstallUnitParams{Name: "sshd.service", Content: testUnit})
+	assert.ErrorContains(t, err, "outside of the units")
+	_, err = os.Stat(filepath.Join(unitRoot, "sshd.service"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,141 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	godbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	managerDest      = "org.freedesktop.systemd1"
+	managerPath      = godbus.ObjectPath("/org/freedesktop/systemd1")
+	managerInterface = "org.freedesktop.systemd1.Manager"
+)
+
+// managerConn extends the go-systemd connection with the manager methods
+// which aren't wrapped by go-systemd
+type managerConn struct {
+	*dbus.Conn
+	bus *godbus.Conn
+}
+
+func newManagerConn(ctx context.Context, conn *dbus.Conn, connect func(...godbus.ConnOption) (*godbus.Conn, error)) (*managerConn, error) {
+	bus, err := connect(godbus.WithContext(ctx))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &managerConn{Conn: conn, bus: bus}, nil
+}
+
+// dialSystem opens the connection to the system manager
+func dialSystem(ctx context.Context) (managerConnection, error) {
+	sdConn, err := dbus.NewSystemConnectionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := newManagerConn(ctx, sdConn, godbus.ConnectSystemBus)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// dialUser opens the connection to the user manager
+func dialUser(ctx context.Context) (managerConnection, error) {
+	sdConn, err := dbus.NewUserConnectionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := newManagerConn(ctx, sdConn, godbus.ConnectSessionBus)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Connected reports if both connections to the bus are still open
+func (c *managerConn) Connected() bool {
+	return c.Conn.Connected() && c.bus.Connected()
+}
+
+func (c *managerConn) manager() godbus.BusObject {
+	return c.bus.Object(managerDest, managerPath)
+}
+
+// GetManagerEnvironmentContext returns the environment of the manager which
+// is passed to all spawned processes
+func (c *managerConn) GetManagerEnvironmentContext(ctx context.Context) ([]string, error) {
+	var variant godbus.Variant
+	err := c.manager().CallWithContext(ctx, "org.freedesktop.DBus.Properties.Get", 0, managerInterface, "Environment").Store(&variant)
+	if err != nil {
+		return nil, err
+	}
+	env, ok := variant.Value().([]string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type of Environment: %s", variant.Signature())
+	}
+	return env, nil
+}
+
+// ManagerVersionContext returns the version of the manager, e.g. 254.5
+func (c *managerConn) ManagerVersionContext(ctx context.Context) (string, error) {
+	var variant godbus.Variant
+	err := c.manager().CallWithContext(ctx, "org.freedesktop.DBus.Properties.Get", 0, managerInterface, "Version").Store(&variant)
+	if err != nil {
+		return "", err
+	}
+	version, ok := variant.Value().(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected type of Version: %s", variant.Signature())
+	}
+	return version, nil
+}
+
+// ManagerPropertiesContext returns all properties of the manager
+func (c *managerConn) ManagerPropertiesContext(ctx context.Context) (map[string]godbus.Variant, error) {
+	props := make(map[string]godbus.Variant)
+	err := c.manager().CallWithContext(ctx, "org.freedesktop.DBus.Properties.GetAll", 0, managerInterface).Store(&props)
+	return props, err
+}
+
+// GetDefaultTargetContext returns the target the system boots into
+func (c *managerConn) GetDefaultTargetContext(ctx context.Context) (string, error) {
+	var target string
+	err := c.manager().CallWithContext(ctx, managerInterface+".GetDefaultTarget", 0).Store(&target)
+	return target, err
+}
+
+// SetDefaultTargetContext changes the default.target link and returns the
+// changed links
+func (c *managerConn) SetDefaultTargetContext(ctx context.Context, target string, force bool) ([]dbus.EnableUnitFileChange, error) {
+	var changes []dbus.EnableUnitFileChange
+	err := c.manager().CallWithContext(ctx, managerInterface+".SetDefaultTarget", 0, target, force).Store(&changes)
+	return changes, err
+}
+
+func (c *managerConn) SetEnvironmentContext(ctx context.Context, assignments []string) error {
+	return c.manager().CallWithContext(ctx, managerInterface+".SetEnvironment", 0, assignments).Store()
+}
+
+func (c *managerConn) UnsetEnvironmentContext(ctx context.Context, names []string) error {
+	return c.manager().CallWithContext(ctx, managerInterface+".UnsetEnvironment", 0, names).Store()
+}
+
+// ResetFailedContext resets the failed state of all units, including the ones
+// which aren't loaded anymore
+func (c *managerConn) ResetFailedContext(ctx context.Context) error {
+	return c.manager().CallWithContext(ctx, managerInterface+".ResetFailed", 0).Store()
+}
+
+// CancelJobContext cancels a queued or running job
+func (c *managerConn) CancelJobContext(ctx context.Context, id uint32) error {
+	return c.manager().CallWithContext(ctx, managerInterface+".CancelJob", 0, id).Store()
+}
+
+func (c *managerConn) Close() {
+	c.Conn.Close()
+	c.bus.Close()
+}
@@ -0,0 +1,114 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+// procUptime holds the seconds since boot, replaced by the tests
+var procUptime = "/proc/uptime"
+
+// managerPropertiesGetter is implemented by the connection to the manager
+type managerPropertiesGetter interface {
+	ManagerPropertiesContext(ctx context.Context) (map[string]godbus.Variant, error)
+}
+
+type SystemOverviewParams struct{}
+
+type SystemOverview struct {
+	Version string `json:"version"`
+	// e.g. running, degraded or starting
+	SystemState    string   `json:"system_state"`
+	NFailedUnits   uint32   `json:"n_failed_units"`
+	NJobs          uint32   `json:"n_jobs"`
+	Uptime         string   `json:"uptime,omitempty"`
+	UptimeSeconds  uint64   `json:"uptime_seconds,omitempty"`
+	Virtualization string   `json:"virtualization,omitempty"`
+	Tainted        []string `json:"tainted,omitempty"`
+	Architecture   string   `json:"architecture,omitempty"`
+}
+
+func CreateSystemOverviewSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[SystemOverviewParams](nil)
+	return inputSchema
+}
+
+// overviewOf builds the overview from the properties of the manager
+func overviewOf(props map[string]godbus.Variant) SystemOverview {
+	o := SystemOverview{}
+	o.Version, _ = props["Version"].Value().(string)
+	o.SystemState, _ = props["SystemState"].Value().(string)
+	o.NFailedUnits, _ = props["NFailedUnits"].Value().(uint32)
+	o.NJobs, _ = props["NJobs"].Value().(uint32)
+	o.Virtualization, _ = props["Virtualization"].Value().(string)
+	o.Architecture, _ = props["Architecture"].Value().(string)
+	if tainted, _ := props["Tainted"].Value().(string); tainted != "" {
+		o.Tainted = strings.Split(tainted, ":")
+	}
+	return o
+}
+
+// readUptime returns the time since boot
+func readUptime(file string) (time.Duration, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty %s", file)
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// SystemOverview returns the state of the manager in one compact result, as
+// cheap health probe
+func (conn *Connection) SystemOverview(ctx context.Context, req *mcp.CallToolRequest, params *SystemOverviewParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	getter, ok := conn.dbus.(managerPropertiesGetter)
+	if !ok {
+		return nil, nil, fmt.Errorf("the properties of the manager can't be read")
+	}
+	props, err := getter.ManagerPropertiesContext(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the properties of the manager: %w", err)
+	}
+	res := overviewOf(props)
+	if uptime, err := readUptime(procUptime); err == nil {
+		res.Uptime = uptime.String()
+		res.UptimeSeconds = uint64(uptime.Seconds())
+	} else {
+		slog.Debug("failed to read the uptime", "error", err)
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
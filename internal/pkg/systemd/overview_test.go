@@ -0,0 +1,59 @@
+package systemd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	godbus "github.com/godbus/dbus/v5"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type propertiesDbusConnection struct {
+	mockDbusConnection
+	props map[string]godbus.Variant
+}
+
+func (m *propertiesDbusConnection) ManagerPropertiesContext(ctx context.Context) (map[string]godbus.Variant, error) {
+	return m.props, nil
+}
+
+func TestSystemOverview(t *testing.T) {
+	procUptime = filepath.Join(t.TempDir(), "uptime")
+	t.Cleanup(func() { procUptime = "/proc/uptime" })
+	require.NoError(t, os.WriteFile(procUptime, []byte("3725.42 7000.13\n"), 0644))
+
+	authorization, _ := auth_pkg.NewNoAuth(true, false)
+	conn := &Connection{
+		auth: authorization,
+		dbus: &propertiesDbusConnection{props: map[string]godbus.Variant{
+			"Version":        godbus.MakeVariant("254.5+suse.1"),
+			"SystemState":    godbus.MakeVariant("degraded"),
+			"NFailedUnits":   godbus.MakeVariant(uint32(2)),
+			"NJobs":          godbus.MakeVariant(uint32(0)),
+			"Virtualization": godbus.MakeVariant("kvm"),
+			"Tainted":        godbus.MakeVariant("unmerged-usr:local-hwclock"),
+			"Architecture":   godbus.MakeVariant("x86-64"),
+		}},
+	}
+	_, out, err := conn.SystemOverview(context.Background(), nil, &SystemOverviewParams{})
+	require.NoError(t, err)
+	assert.Equal(t, SystemOverview{
+		Version:        "254.5+suse.1",
+		SystemState:    "degraded",
+		NFailedUnits:   2,
+		Uptime:         "1h2m5s",
+		UptimeSeconds:  3725,
+		Virtualization: "kvm",
+		Tainted:        []string{"unmerged-usr", "local-hwclock"},
+		Architecture:   "x86-64",
+	}, out)
+
+	// the mock without the manager properties
+	conn.dbus = &mockDbusConnection{}
+	_, _, err = conn.SystemOverview(context.Background(), nil, &SystemOverviewParams{})
+	assert.Error(t, err)
+}
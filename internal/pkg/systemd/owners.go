@@ -0,0 +1,76 @@
+package systemd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// OwnersPath is the file which maps unit patterns to the team owning the
+// units, e.g.
+//
+//	owners:
+//	  - pattern: "nginx*.service"
+//	    team: web
+//	    contact: web-oncall@example.com
+//	    runbook: https://wiki.example.com/runbooks/nginx
+var OwnersPath = "/etc/systemd-mcp/owners.yaml"
+
+// UnitOwner tells whom to page for a unit and which runbook applies
+type UnitOwner struct {
+	Pattern string `yaml:"pattern" json:"pattern"`
+	Team    string `yaml:"team,omitempty" json:"team,omitempty"`
+	Contact string `yaml:"contact,omitempty" json:"contact,omitempty"`
+	Runbook string `yaml:"runbook,omitempty" json:"runbook,omitempty"`
+}
+
+type ownersFile struct {
+	Owners []UnitOwner `yaml:"owners"`
+}
+
+// Owners is the list of owners, the first matching pattern wins
+type Owners []UnitOwner
+
+// loadOwners reads the owners file, a missing file means that no owners
+// are known
+func loadOwners() (Owners, error) {
+	data, err := os.ReadFile(OwnersPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var file ownersFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid owners file %s: %w", OwnersPath, err)
+	}
+	for _, owner := range file.Owners {
+		if _, err := path.Match(owner.Pattern, ""); err != nil || owner.Pattern == "" {
+			return nil, fmt.Errorf("invalid pattern %q in owners file %s", owner.Pattern, OwnersPath)
+		}
+	}
+	return file.Owners, nil
+}
+
+// unitOwners loads the owners for a result, errors are only logged as the
+// owners are an addition to the result
+func unitOwners() Owners {
+	owners, err := loadOwners()
+	if err != nil {
+		slog.Warn("failed to load unit owners", "error", err)
+	}
+	return owners
+}
+
+// Lookup returns the owner of the first pattern matching the unit
+func (owners Owners) Lookup(unit string) *UnitOwner {
+	for i := range owners {
+		if match, _ := path.Match(owners[i].Pattern, unit); match {
+			return &owners[i]
+		}
+	}
+	return nil
+}
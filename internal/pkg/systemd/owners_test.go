@@ -0,0 +1,73 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOwners = `owners:
+  - pattern: "nginx*.service"
+    team: web
+    contact: web-oncall@example.com
+    runbook: https://wiki.example.com/runbooks/nginx
+  - pattern: "*.service"
+    team: platform
+`
+
+func TestOwners(t *testing.T) {
+	OwnersPath = filepath.Join(t.TempDir(), "owners.yaml")
+
+	t.Run("missing file", func(t *testing.T) {
+		owners, err := loadOwners()
+		require.NoError(t, err)
+		assert.Nil(t, owners.Lookup("nginx.service"))
+	})
+
+	t.Run("first match wins", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(OwnersPath, []byte(testOwners), 0600))
+		owners, err := loadOwners()
+		require.NoError(t, err)
+		assert.Equal(t, "web", owners.Lookup("nginx-proxy.service").Team)
+		assert.Equal(t, "platform", owners.Lookup("sshd.service").Team)
+		assert.Nil(t, owners.Lookup("fstrim.timer"))
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(OwnersPath, []byte("owners:\n  - pattern: \"[\"\n"), 0600))
+		_, err := loadOwners()
+		assert.Error(t, err)
+	})
+
+	t.Run("failed units carry the owner", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(OwnersPath, []byte(testOwners), 0600))
+		auth, _ := auth_pkg.NewNoAuth(true, true)
+		conn := &Connection{
+			dbus: &mockDbusConnection{
+				listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+					return []dbus.UnitStatus{{Name: "nginx.service", ActiveState: "failed"}}, nil
+				},
+				getAllProperties: func(unitName string) (map[string]interface{}, error) {
+					return map[string]interface{}{}, nil
+				},
+			},
+			auth: auth,
+		}
+		res, _, err := conn.ListFailedUnits(context.Background(), nil, &FailedUnitsParams{})
+		require.NoError(t, err)
+
+		var result FailedUnitsResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		require.NotNil(t, result.Units[0].Owner)
+		assert.Equal(t, "web-oncall@example.com", result.Units[0].Owner.Contact)
+		assert.Equal(t, "https://wiki.example.com/runbooks/nginx", result.Units[0].Owner.Runbook)
+	})
+}
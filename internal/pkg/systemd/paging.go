@@ -0,0 +1,103 @@
+package systemd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+)
+
+// DefaultMaxResultSize is the size in bytes of the text of a listing above
+// which it is cut into pages
+const DefaultMaxResultSize = 256 * 1024
+
+// continuation is the state of a listing cut into pages, the token is its
+// encoding
+type continuation struct {
+	// the arguments of the next page
+	Params ListLoadedUnitsParams `json:"params"`
+	// offset after the last unit the client asked for, 0 for all units
+	End int `json:"end,omitempty"`
+}
+
+func encodeContinuation(cont continuation) (string, error) {
+	data, err := json.Marshal(cont)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeContinuation(token string) (continuation, error) {
+	var cont continuation
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(data, &cont)
+	}
+	if err != nil || cont.Params.Limit <= 0 {
+		return continuation{}, fmt.Errorf("invalid continuation token")
+	}
+	return cont, nil
+}
+
+// SetMaxResultSize sets the size in bytes of the text of a listing above
+// which it is cut into pages, 0 never cuts them
+func (conn *Connection) SetMaxResultSize(size int) {
+	conn.maxResultSize = size
+}
+
+// fitResultSize lists fewer units until the content fits the maximal result
+// size, page gets the limit of the listed units. A single unit is returned
+// even if it doesn't fit.
+func (conn *Connection) fitResultSize(ctx context.Context, page *ListLoadedUnitsParams, content []mcp.Content, count, total int) ([]mcp.Content, int, error) {
+	limit := count
+	if page.Limit > 0 {
+		limit = min(limit, page.Limit)
+	}
+	page.Limit = limit
+	size := util.ContentBytes(content)
+	var err error
+	for size > conn.maxResultSize && limit > 1 {
+		limit = max(min(limit*conn.maxResultSize/size, limit-1), 1)
+		page.Limit = limit
+		if content, _, total, err = conn.scopedUnits(ctx, page); err != nil {
+			return nil, 0, err
+		}
+		size = util.ContentBytes(content)
+	}
+	return content, total, nil
+}
+
+// nextPage returns the block with the continuation token of the page after
+// the listed one, nil if it was the last page
+func nextPage(page *ListLoadedUnitsParams, end, total int) (mcp.Content, error) {
+	if page.Limit <= 0 {
+		return nil, nil
+	}
+	next := max(page.Offset, 0) + page.Limit
+	if next >= total || (end > 0 && next >= end) {
+		return nil, nil
+	}
+	cont := continuation{Params: *page, End: end}
+	cont.Params.Offset = next
+	if end > 0 {
+		cont.Params.Limit = min(page.Limit, end-next)
+	}
+	token, err := encodeContinuation(cont)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	jsonBytes, err := json.Marshal(struct {
+		Continuation string `json:"continuation"`
+		NextOffset   int    `json:"next_offset"`
+		TotalCount   int    `json:"total_count"`
+		Message      string `json:"message"`
+	}{token, next, total, "the listing was cut because of its size, call list_loaded_units with this continuation for the next page"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.TextContent{Text: string(jsonBytes)}, nil
+}
@@ -0,0 +1,87 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listPage returns the units and the continuation of a page of
+// list_loaded_units
+func listPage(t *testing.T, conn *Connection, params *ListLoadedUnitsParams) ([]string, string) {
+	res, _, err := conn.ListLoadedUnits(context.Background(), nil, params)
+	require.NoError(t, err)
+	var units []string
+	var token string
+	for _, c := range res.Content {
+		var block struct {
+			Units        []string `json:"units"`
+			Continuation string   `json:"continuation"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(c.(*mcp.TextContent).Text), &block))
+		units = append(units, block.Units...)
+		if block.Continuation != "" {
+			token = block.Continuation
+		}
+	}
+	return units, token
+}
+
+func TestListLoadedUnitsContinuation(t *testing.T) {
+	var units []dbus.UnitStatus
+	var names []string
+	for i := range 50 {
+		name := fmt.Sprintf("unit%03d.service", i)
+		units = append(units, dbus.UnitStatus{Name: name, ActiveState: "active"})
+		names = append(names, name)
+	}
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return slices.Clone(units), nil
+			},
+		},
+		auth: auth,
+	}
+
+	// without a maximal size the listing isn't cut
+	got, token := listPage(t, conn, &ListLoadedUnitsParams{})
+	assert.Equal(t, names, got)
+	assert.Empty(t, token)
+
+	conn.SetMaxResultSize(200)
+	var all []string
+	got, token = listPage(t, conn, &ListLoadedUnitsParams{})
+	pages := 1
+	all = append(all, got...)
+	for token != "" {
+		got, token = listPage(t, conn, &ListLoadedUnitsParams{Continuation: token})
+		require.NotEmpty(t, got)
+		all = append(all, got...)
+		pages++
+	}
+	assert.Equal(t, names, all)
+	assert.Greater(t, pages, 1)
+
+	// the pages end with the limit of the client
+	all = nil
+	got, token = listPage(t, conn, &ListLoadedUnitsParams{Offset: 5, Limit: 20})
+	all = append(all, got...)
+	for token != "" {
+		got, token = listPage(t, conn, &ListLoadedUnitsParams{Continuation: token})
+		all = append(all, got...)
+	}
+	assert.Equal(t, names[5:25], all)
+
+	_, _, err := conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Continuation: "garbage"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,203 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+)
+
+// DefaultPropertyTTL is the time the properties of a unit are reused by the
+// listing tools
+const DefaultPropertyTTL = 30 * time.Second
+
+var errUpdatesFull = errors.New("update channel is full")
+
+type cachedProperties struct {
+	props   map[string]interface{}
+	fetched time.Time
+}
+
+// propertyCache holds the properties of the units by name, so that listing
+// the units with their properties several times doesn't fetch them again
+type propertyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedProperties
+}
+
+func newPropertyCache(ttl time.Duration) *propertyCache {
+	return &propertyCache{
+		ttl:     ttl,
+		entries: make(map[string]cachedProperties),
+	}
+}
+
+// get returns a copy of the properties of the unit if they are younger than
+// the ttl
+func (c *propertyCache) get(name string, now time.Time) (map[string]interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+	if now.Sub(entry.fetched) >= c.ttl {
+		delete(c.entries, name)
+		return nil, false
+	}
+	return maps.Clone(entry.props), true
+}
+
+func (c *propertyCache) put(name string, props map[string]interface{}, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[name] = cachedProperties{props: maps.Clone(props), fetched: now}
+}
+
+// invalidate drops the properties of the unit, of all units for an empty
+// name
+func (c *propertyCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name == "" {
+		clear(c.entries)
+		return
+	}
+	delete(c.entries, name)
+}
+
+// SetPropertyCache caches the properties of the units for the ttl, 0
+// disables the cache. WatchPropertyCache drops the properties of the units
+// which changed.
+func (conn *Connection) SetPropertyCache(ttl time.Duration) {
+	if ttl <= 0 {
+		conn.propCache = nil
+		return
+	}
+	conn.propCache = newPropertyCache(ttl)
+}
+
+// unitProperties returns the properties of the unit from the cache or
+// fetches them, the tools changing units read the properties directly
+func (conn *Connection) unitProperties(ctx context.Context, name string) (map[string]interface{}, error) {
+	if conn.propCache == nil {
+		return conn.dbus.GetAllPropertiesContext(ctx, name)
+	}
+	now := time.Now()
+	if props, ok := conn.propCache.get(name, now); ok {
+		return props, nil
+	}
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	conn.propCache.put(name, props, now)
+	return props, nil
+}
+
+// invalidateProperties drops the cached properties of the unit, of all
+// units for an empty name. The unit file state isn't signaled, so the tools
+// enabling and disabling units call it.
+func (conn *Connection) invalidateProperties(name string) {
+	if conn.propCache != nil {
+		conn.propCache.invalidate(name)
+	}
+}
+
+// listenProperties hands the property changes of all units to ch. The
+// connection delivers them to a single subscriber, so they are dispatched
+// to all listeners.
+func (conn *Connection) listenProperties(ch chan<- *sddbus.PropertiesUpdate, errCh chan<- error) error {
+	sub, err := conn.subscribe()
+	if err != nil {
+		return err
+	}
+	conn.propsMu.Lock()
+	conn.propsListeners = append(conn.propsListeners, propertiesListener{updates: ch, errs: errCh})
+	conn.propsMu.Unlock()
+	conn.propsOnce.Do(func() {
+		updates := make(chan *sddbus.PropertiesUpdate, 256)
+		errs := make(chan error, 16)
+		sub.SetPropertiesSubscriber(updates, errs)
+		go conn.dispatchProperties(updates, errs)
+	})
+	return nil
+}
+
+type propertiesListener struct {
+	updates chan<- *sddbus.PropertiesUpdate
+	errs    chan<- error
+}
+
+// dispatchProperties passes the updates and errors to the listeners without
+// blocking, like the connection a full channel gets an error instead
+func (conn *Connection) dispatchProperties(updates <-chan *sddbus.PropertiesUpdate, errs <-chan error) {
+	send := func(fn func(l propertiesListener)) {
+		conn.propsMu.Lock()
+		defer conn.propsMu.Unlock()
+		for _, l := range conn.propsListeners {
+			fn(l)
+		}
+	}
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			send(func(l propertiesListener) {
+				select {
+				case l.updates <- update:
+				default:
+					select {
+					case l.errs <- errUpdatesFull:
+					default:
+					}
+				}
+			})
+		case err := <-errs:
+			send(func(l propertiesListener) {
+				select {
+				case l.errs <- err:
+				default:
+				}
+			})
+		}
+	}
+}
+
+// WatchPropertyCache drops the cached properties of a unit when systemd
+// signals a change of them, until the context is canceled. Missed signals
+// drop all properties.
+func (conn *Connection) WatchPropertyCache(ctx context.Context) error {
+	if conn.propCache == nil {
+		return nil
+	}
+	updates := make(chan *sddbus.PropertiesUpdate, 256)
+	errs := make(chan error, 16)
+	if err := conn.listenProperties(updates, errs); err != nil {
+		return err
+	}
+	slog.Info("caching the properties of the units", "ttl", conn.propCache.ttl)
+	invalidateOnChange(ctx, conn.propCache, updates, errs)
+	return nil
+}
+
+func invalidateOnChange(ctx context.Context, cache *propertyCache, updates <-chan *sddbus.PropertiesUpdate, errs <-chan error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-errs:
+			slog.Debug("dropping the cached properties of all units", "reason", err)
+			cache.invalidate("")
+		case update := <-updates:
+			cache.invalidate(update.UnitName)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package systemd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitPropertiesCache(t *testing.T) {
+	calls := 0
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				calls++
+				return map[string]interface{}{"Id": unitName, "ActiveState": "active"}, nil
+			},
+		},
+	}
+	ctx := context.Background()
+
+	// without cache every call fetches the properties
+	_, err := conn.unitProperties(ctx, "a.service")
+	require.NoError(t, err)
+	_, err = conn.unitProperties(ctx, "a.service")
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	conn.SetPropertyCache(time.Minute)
+	calls = 0
+	props, err := conn.unitProperties(ctx, "a.service")
+	require.NoError(t, err)
+	// the cached properties can't be changed by the callers
+	props["Manager"] = "system"
+	props, err = conn.unitProperties(ctx, "a.service")
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.NotContains(t, props, "Manager")
+
+	conn.invalidateProperties("a.service")
+	_, err = conn.unitProperties(ctx, "a.service")
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestPropertyCacheTTL(t *testing.T) {
+	cache := newPropertyCache(time.Minute)
+	now := time.Now()
+	cache.put("a.service", map[string]interface{}{"Id": "a.service"}, now)
+	_, ok := cache.get("a.service", now.Add(30*time.Second))
+	assert.True(t, ok)
+	_, ok = cache.get("a.service", now.Add(time.Minute))
+	assert.False(t, ok)
+}
+
+func TestInvalidateOnChange(t *testing.T) {
+	cache := newPropertyCache(time.Minute)
+	now := time.Now()
+	cache.put("a.service", map[string]interface{}{}, now)
+	cache.put("b.service", map[string]interface{}{}, now)
+	cache.put("c.service", map[string]interface{}{}, now)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan *sddbus.PropertiesUpdate)
+	errs := make(chan error)
+	done := make(chan struct{})
+	go func() {
+		invalidateOnChange(ctx, cache, updates, errs)
+		close(done)
+	}()
+	updates <- &sddbus.PropertiesUpdate{UnitName: "a.service"}
+	// the unbuffered send only returns once the first update was taken
+	updates <- &sddbus.PropertiesUpdate{UnitName: "a.service"}
+	_, ok := cache.get("a.service", now)
+	assert.False(t, ok)
+	_, ok = cache.get("b.service", now)
+	assert.True(t, ok)
+
+	errs <- errUpdatesFull
+	updates <- &sddbus.PropertiesUpdate{UnitName: "a.service"}
+	_, ok = cache.get("c.service", now)
+	assert.False(t, ok)
+	cancel()
+	<-done
+}
+
+func TestDispatchProperties(t *testing.T) {
+	conn := &Connection{}
+	first := make(chan *sddbus.PropertiesUpdate, 1)
+	second := make(chan *sddbus.PropertiesUpdate, 1)
+	secondErrs := make(chan error, 1)
+	conn.propsListeners = []propertiesListener{
+		{updates: first, errs: make(chan error, 1)},
+		{updates: second, errs: secondErrs},
+	}
+	updates := make(chan *sddbus.PropertiesUpdate)
+	go conn.dispatchProperties(updates, make(chan error))
+
+	updates <- &sddbus.PropertiesUpdate{UnitName: "a.service"}
+	assert.Equal(t, "a.service", (<-first).UnitName)
+	// the second channel is full, its listener gets an error
+	updates <- &sddbus.PropertiesUpdate{UnitName: "b.service"}
+	updates <- &sddbus.PropertiesUpdate{UnitName: "c.service"}
+	close(updates)
+	assert.Equal(t, "b.service", (<-first).UnitName)
+	assert.Equal(t, "a.service", (<-second).UnitName)
+	assert.Equal(t, errUpdatesFull, <-secondErrs)
+}
@@ -0,0 +1,398 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/metrics"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/tracing"
+)
+
+// delays between the attempts to reconnect, doubled after every attempt
+var (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 30 * time.Second
+)
+
+var errReconnecting = errors.New("the connection to systemd was lost and is being re-established, retry the call in a few seconds")
+
+var errResubscribed = errors.New("subscribed again after reconnecting, changes may have been missed")
+
+// managerConnection is the connection to a manager with all the optional
+// methods, as the managerConn implements it
+type managerConnection interface {
+	DbusConnection
+	jobCanceler
+	managerPropertiesGetter
+	versioner
+	defaultTargeter
+	unitSubscriber
+	Connected() bool
+}
+
+// resilientConn delegates to a connection to the manager and opens a new one
+// with backoff if it was lost, e.g. because dbus was restarted. The unit
+// change signals are subscribed again on the new connection. While there is
+// no connection the calls fail with an error telling so.
+type resilientConn struct {
+	// opens a connection, ctx is its lifetime
+	dial func(ctx context.Context) (managerConnection, error)
+	ctx  context.Context
+
+	mu sync.Mutex
+	// nil while reconnecting
+	conn         managerConnection
+	reconnecting bool
+	attempts     int
+	lastErr      error
+	closed       bool
+
+	// the subscription which is restored on a new connection
+	subscribed      bool
+	subStateUpdates chan<- *dbus.SubStateUpdate
+	subStateErrs    chan<- error
+	propsUpdates    chan<- *dbus.PropertiesUpdate
+	propsErrs       chan<- error
+
+	// records the latency of the calls, set before the first call
+	metrics *metrics.Metrics
+}
+
+func newResilientConn(ctx context.Context, dial func(ctx context.Context) (managerConnection, error)) (*resilientConn, error) {
+	conn, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &resilientConn{dial: dial, ctx: ctx, conn: conn}, nil
+}
+
+// SetMetrics records the latency of the calls to the manager
+func (conn *Connection) SetMetrics(m *metrics.Metrics) {
+	if r, ok := conn.dbus.(*resilientConn); ok {
+		r.metrics = m
+	}
+}
+
+// reconnectingErr describes the state of the reconnection, r.mu is held
+func (r *resilientConn) reconnectingErr() error {
+	if r.lastErr != nil {
+		return fmt.Errorf("%w (%d failed attempts, last error: %s)", errReconnecting, r.attempts, r.lastErr)
+	}
+	return errReconnecting
+}
+
+// current returns the connection, if it was lost the reconnection is
+// started in the background
+func (r *resilientConn) current() (managerConnection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, fmt.Errorf("the connection to systemd is closed")
+	}
+	if r.conn != nil && !r.conn.Connected() {
+		slog.Warn("lost the connection to systemd, reconnecting")
+		r.conn.Close()
+		r.conn = nil
+	}
+	if r.conn == nil {
+		if !r.reconnecting {
+			r.reconnecting = true
+			go r.reconnect()
+		}
+		return nil, r.reconnectingErr()
+	}
+	return r.conn, nil
+}
+
+// Reconnecting reports if the connection was lost and isn't re-established
+// yet
+func (r *resilientConn) Reconnecting() bool {
+	_, err := r.current()
+	return errors.Is(err, errReconnecting)
+}
+
+// reconnect dials until a connection is established or the connection is
+// closed
+func (r *resilientConn) reconnect() {
+	delay := reconnectMinDelay
+	for {
+		r.mu.Lock()
+		closed := r.closed
+		r.mu.Unlock()
+		if closed || r.ctx.Err() != nil {
+			return
+		}
+		conn, err := r.dial(r.ctx)
+		if err == nil {
+			if err = r.restore(conn); err != nil {
+				conn.Close()
+			}
+		}
+		r.mu.Lock()
+		if err == nil {
+			if r.closed {
+				r.mu.Unlock()
+				conn.Close()
+				return
+			}
+			r.conn, r.reconnecting, r.attempts, r.lastErr = conn, false, 0, nil
+			r.mu.Unlock()
+			slog.Info("reconnected to systemd")
+			return
+		}
+		r.attempts++
+		r.lastErr = err
+		r.mu.Unlock()
+		slog.Warn("failed to reconnect to systemd", "error", err, "retry", delay)
+		select {
+		case <-time.After(delay):
+		case <-r.ctx.Done():
+			return
+		}
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+}
+
+// restore subscribes the new connection like the lost one
+func (r *resilientConn) restore(conn managerConnection) error {
+	r.mu.Lock()
+	subscribed := r.subscribed
+	subStateUpdates, subStateErrs := r.subStateUpdates, r.subStateErrs
+	propsUpdates, propsErrs := r.propsUpdates, r.propsErrs
+	r.mu.Unlock()
+	if !subscribed {
+		return nil
+	}
+	if err := conn.Subscribe(); err != nil {
+		return fmt.Errorf("failed to subscribe to unit changes: %w", err)
+	}
+	if subStateUpdates != nil {
+		conn.SetSubStateSubscriber(subStateUpdates, subStateErrs)
+	}
+	if propsUpdates != nil {
+		conn.SetPropertiesSubscriber(propsUpdates, propsErrs)
+	}
+	// the listeners drop what they derived from the missed signals
+	for _, errCh := range []chan<- error{subStateErrs, propsErrs} {
+		if errCh == nil {
+			continue
+		}
+		select {
+		case errCh <- errResubscribed:
+		default:
+		}
+	}
+	return nil
+}
+
+// call calls fn with the connection, if the connection got lost the
+// error also tells that it is being re-established
+func call[T any](ctx context.Context, r *resilientConn, method string, fn func(c managerConnection) (T, error)) (res T, err error) {
+	_, span := tracing.Start(ctx, systemdManager+"/"+method)
+	span.SetAttribute("rpc.system", "dbus")
+	span.SetAttribute("rpc.method", method)
+	defer func() { span.End(err) }()
+	c, err := r.current()
+	if err != nil {
+		return res, err
+	}
+	start := time.Now()
+	res, err = fn(c)
+	r.metrics.ObserveDBus(method, time.Since(start))
+	if err != nil && !c.Connected() {
+		if _, cerr := r.current(); cerr != nil {
+			return res, fmt.Errorf("%w: %w", err, cerr)
+		}
+	}
+	return res, err
+}
+
+// callErr is call for the methods only returning an error
+func callErr(ctx context.Context, r *resilientConn, method string, fn func(c managerConnection) error) error {
+	_, err := call(ctx, r, method, func(c managerConnection) (struct{}, error) {
+		return struct{}{}, fn(c)
+	})
+	return err
+}
+
+func (r *resilientConn) ListUnitsByPatternsContext(ctx context.Context, states []string, patterns []string) ([]dbus.UnitStatus, error) {
+	return call(ctx, r, "ListUnitsByPatterns", func(c managerConnection) ([]dbus.UnitStatus, error) {
+		return c.ListUnitsByPatternsContext(ctx, states, patterns)
+	})
+}
+
+func (r *resilientConn) GetAllPropertiesContext(ctx context.Context, unitName string) (map[string]interface{}, error) {
+	return call(ctx, r, "GetAllProperties", func(c managerConnection) (map[string]interface{}, error) {
+		return c.GetAllPropertiesContext(ctx, unitName)
+	})
+}
+
+func (r *resilientConn) ReloadOrRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return call(ctx, r, "ReloadOrRestartUnit", func(c managerConnection) (int, error) {
+		return c.ReloadOrRestartUnitContext(ctx, name, mode, ch)
+	})
+}
+
+func (r *resilientConn) RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return call(ctx, r, "RestartUnit", func(c managerConnection) (int, error) {
+		return c.RestartUnitContext(ctx, name, mode, ch)
+	})
+}
+
+func (r *resilientConn) StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return call(ctx, r, "StartUnit", func(c managerConnection) (int, error) {
+		return c.StartUnitContext(ctx, name, mode, ch)
+	})
+}
+
+func (r *resilientConn) StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return call(ctx, r, "StopUnit", func(c managerConnection) (int, error) {
+		return c.StopUnitContext(ctx, name, mode, ch)
+	})
+}
+
+func (r *resilientConn) KillUnitWithTarget(ctx context.Context, name string, target dbus.Who, signal int32) error {
+	return callErr(ctx, r, "KillUnit", func(c managerConnection) error {
+		return c.KillUnitWithTarget(ctx, name, target, signal)
+	})
+}
+
+func (r *resilientConn) ResetFailedUnitContext(ctx context.Context, name string) error {
+	return callErr(ctx, r, "ResetFailedUnit", func(c managerConnection) error {
+		return c.ResetFailedUnitContext(ctx, name)
+	})
+}
+
+func (r *resilientConn) ResetFailedContext(ctx context.Context) error {
+	return callErr(ctx, r, "ResetFailed", func(c managerConnection) error {
+		return c.ResetFailedContext(ctx)
+	})
+}
+
+func (r *resilientConn) EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error) {
+	var changes []dbus.EnableUnitFileChange
+	carriesInstall, err := call(ctx, r, "EnableUnitFiles", func(c managerConnection) (bool, error) {
+		var carries bool
+		var err error
+		carries, changes, err = c.EnableUnitFilesContext(ctx, files, runtime, force)
+		return carries, err
+	})
+	return carriesInstall, changes, err
+}
+
+func (r *resilientConn) DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
+	return call(ctx, r, "DisableUnitFiles", func(c managerConnection) ([]dbus.DisableUnitFileChange, error) {
+		return c.DisableUnitFilesContext(ctx, files, runtime)
+	})
+}
+
+func (r *resilientConn) ListUnitFilesContext(ctx context.Context) ([]dbus.UnitFile, error) {
+	return call(ctx, r, "ListUnitFiles", func(c managerConnection) ([]dbus.UnitFile, error) {
+		return c.ListUnitFilesContext(ctx)
+	})
+}
+
+func (r *resilientConn) GetManagerEnvironmentContext(ctx context.Context) ([]string, error) {
+	return call(ctx, r, "GetManagerEnvironment", func(c managerConnection) ([]string, error) {
+		return c.GetManagerEnvironmentContext(ctx)
+	})
+}
+
+func (r *resilientConn) SetEnvironmentContext(ctx context.Context, assignments []string) error {
+	return callErr(ctx, r, "SetEnvironment", func(c managerConnection) error {
+		return c.SetEnvironmentContext(ctx, assignments)
+	})
+}
+
+func (r *resilientConn) UnsetEnvironmentContext(ctx context.Context, names []string) error {
+	return callErr(ctx, r, "UnsetEnvironment", func(c managerConnection) error {
+		return c.UnsetEnvironmentContext(ctx, names)
+	})
+}
+
+func (r *resilientConn) ReloadContext(ctx context.Context) error {
+	return callErr(ctx, r, "Reload", func(c managerConnection) error {
+		return c.ReloadContext(ctx)
+	})
+}
+
+func (r *resilientConn) CancelJobContext(ctx context.Context, id uint32) error {
+	return callErr(ctx, r, "CancelJob", func(c managerConnection) error {
+		return c.CancelJobContext(ctx, id)
+	})
+}
+
+func (r *resilientConn) ManagerPropertiesContext(ctx context.Context) (map[string]godbus.Variant, error) {
+	return call(ctx, r, "ManagerProperties", func(c managerConnection) (map[string]godbus.Variant, error) {
+		return c.ManagerPropertiesContext(ctx)
+	})
+}
+
+func (r *resilientConn) ManagerVersionContext(ctx context.Context) (string, error) {
+	return call(ctx, r, "ManagerVersion", func(c managerConnection) (string, error) {
+		return c.ManagerVersionContext(ctx)
+	})
+}
+
+func (r *resilientConn) GetDefaultTargetContext(ctx context.Context) (string, error) {
+	return call(ctx, r, "GetDefaultTarget", func(c managerConnection) (string, error) {
+		return c.GetDefaultTargetContext(ctx)
+	})
+}
+
+func (r *resilientConn) SetDefaultTargetContext(ctx context.Context, target string, force bool) ([]dbus.EnableUnitFileChange, error) {
+	return call(ctx, r, "SetDefaultTarget", func(c managerConnection) ([]dbus.EnableUnitFileChange, error) {
+		return c.SetDefaultTargetContext(ctx, target, force)
+	})
+}
+
+// Subscribe subscribes to the unit change signals, also the connections
+// replacing a lost one
+func (r *resilientConn) Subscribe() error {
+	err := callErr(context.Background(), r, "Subscribe", func(c managerConnection) error {
+		return c.Subscribe()
+	})
+	if err == nil {
+		r.mu.Lock()
+		r.subscribed = true
+		r.mu.Unlock()
+	}
+	return err
+}
+
+func (r *resilientConn) SetSubStateSubscriber(updateCh chan<- *dbus.SubStateUpdate, errCh chan<- error) {
+	r.mu.Lock()
+	r.subStateUpdates, r.subStateErrs = updateCh, errCh
+	conn := r.conn
+	r.mu.Unlock()
+	// a connection opened meanwhile gets the subscriber from restore
+	if conn != nil {
+		conn.SetSubStateSubscriber(updateCh, errCh)
+	}
+}
+
+func (r *resilientConn) SetPropertiesSubscriber(updateCh chan<- *dbus.PropertiesUpdate, errCh chan<- error) {
+	r.mu.Lock()
+	r.propsUpdates, r.propsErrs = updateCh, errCh
+	conn := r.conn
+	r.mu.Unlock()
+	if conn != nil {
+		conn.SetPropertiesSubscriber(updateCh, errCh)
+	}
+}
+
+func (r *resilientConn) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+}
@@ -0,0 +1,118 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeManagerConn is a connection which can be dropped
+type fakeManagerConn struct {
+	managerConnection
+	id         int
+	lost       atomic.Bool
+	mu         sync.Mutex
+	subscribed bool
+	propsCh    chan<- *sddbus.PropertiesUpdate
+}
+
+func (f *fakeManagerConn) Connected() bool {
+	return !f.lost.Load()
+}
+
+func (f *fakeManagerConn) ManagerVersionContext(ctx context.Context) (string, error) {
+	if f.lost.Load() {
+		return "", errors.New("connection closed by user")
+	}
+	return "25" + string(rune('0'+f.id)), nil
+}
+
+func (f *fakeManagerConn) Subscribe() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribed = true
+	return nil
+}
+
+func (f *fakeManagerConn) SetPropertiesSubscriber(updateCh chan<- *sddbus.PropertiesUpdate, errCh chan<- error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.propsCh = updateCh
+}
+
+func (f *fakeManagerConn) Close() {
+	f.lost.Store(true)
+}
+
+func TestResilientConn(t *testing.T) {
+	reconnectMinDelay, reconnectMaxDelay = time.Millisecond, 4*time.Millisecond
+	t.Cleanup(func() { reconnectMinDelay, reconnectMaxDelay = time.Second, 30*time.Second })
+
+	var mu sync.Mutex
+	var conns []*fakeManagerConn
+	failures := 0
+	dial := func(ctx context.Context) (managerConnection, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		// the first reconnection attempts fail
+		if len(conns) == 1 && failures < 2 {
+			failures++
+			return nil, errors.New("no such file or directory")
+		}
+		conn := &fakeManagerConn{id: len(conns)}
+		conns = append(conns, conn)
+		return conn, nil
+	}
+	r, err := newResilientConn(context.Background(), dial)
+	require.NoError(t, err)
+	defer r.Close()
+
+	version, err := r.ManagerVersionContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "250", version)
+	require.NoError(t, r.Subscribe())
+	updates := make(chan *sddbus.PropertiesUpdate, 1)
+	errs := make(chan error, 1)
+	r.SetPropertiesSubscriber(updates, errs)
+
+	// a call on the lost connection tells about the reconnection
+	conns[0].lost.Store(true)
+	_, err = r.ManagerVersionContext(context.Background())
+	assert.ErrorIs(t, err, errReconnecting)
+
+	require.Eventually(t, func() bool {
+		return !r.Reconnecting()
+	}, time.Second, time.Millisecond)
+	version, err = r.ManagerVersionContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "251", version)
+	assert.Equal(t, 2, failures)
+
+	// the subscription is restored and the listener learns about the gap
+	mu.Lock()
+	conn := conns[1]
+	mu.Unlock()
+	conn.mu.Lock()
+	assert.True(t, conn.subscribed)
+	assert.Equal(t, chan<- *sddbus.PropertiesUpdate(updates), conn.propsCh)
+	conn.mu.Unlock()
+	assert.ErrorIs(t, <-errs, errResubscribed)
+}
+
+func TestResilientConnClosed(t *testing.T) {
+	r, err := newResilientConn(context.Background(), func(ctx context.Context) (managerConnection, error) {
+		return &fakeManagerConn{}, nil
+	})
+	require.NoError(t, err)
+	r.Close()
+	_, err = r.ManagerVersionContext(context.Background())
+	assert.ErrorContains(t, err, "closed")
+	assert.False(t, r.Reconnecting())
+}
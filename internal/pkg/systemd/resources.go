@@ -0,0 +1,127 @@
+package systemd
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// first systemd version with MemoryPeak and MemoryZSwapCurrent
+const memoryMetricsVersion = 254
+
+// cgroupRoot is where the cgroup v2 hierarchy is mounted
+var cgroupRoot = "/sys/fs/cgroup"
+
+// versioner is implemented by the connection to the manager
+type versioner interface {
+	ManagerVersionContext(ctx context.Context) (string, error)
+}
+
+// PressureStall is a line of a PSI file, the averages are the percentage of
+// time tasks stalled in the last 10, 60 and 300 seconds
+type PressureStall struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	// total stall time in microseconds
+	Total uint64 `json:"total_usec"`
+}
+
+// MemoryPressure is the memory.pressure of the cgroup of a unit, some
+// counts the time at least one task stalled, full the time all did
+type MemoryPressure struct {
+	Some *PressureStall `json:"some,omitempty"`
+	Full *PressureStall `json:"full,omitempty"`
+}
+
+// majorVersion returns the major version of a systemd version string like
+// 254.5+suse.1, zero if it can't be parsed
+func majorVersion(version string) int {
+	end := strings.IndexFunc(version, func(r rune) bool { return r < '0' || r > '9' })
+	if end >= 0 {
+		version = version[:end]
+	}
+	major, _ := strconv.Atoi(version)
+	return major
+}
+
+// managerVersion returns the major version of the manager, zero if it is
+// unknown
+func (conn *Connection) managerVersion(ctx context.Context) int {
+	conn.versionOnce.Do(func() {
+		v, ok := conn.dbus.(versioner)
+		if !ok {
+			return
+		}
+		version, err := v.ManagerVersionContext(ctx)
+		if err != nil {
+			slog.Debug("failed to get the systemd version", "error", err)
+			return
+		}
+		conn.version = majorVersion(version)
+	})
+	return conn.version
+}
+
+// readPressure parses a PSI file like memory.pressure
+func readPressure(file string) (*MemoryPressure, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pressure := &MemoryPressure{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		stall := &PressureStall{}
+		for _, field := range fields[1:] {
+			key, val, _ := strings.Cut(field, "=")
+			switch key {
+			case "avg10":
+				stall.Avg10, _ = strconv.ParseFloat(val, 64)
+			case "avg60":
+				stall.Avg60, _ = strconv.ParseFloat(val, 64)
+			case "avg300":
+				stall.Avg300, _ = strconv.ParseFloat(val, 64)
+			case "total":
+				stall.Total, _ = strconv.ParseUint(val, 10, 64)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			pressure.Some = stall
+		case "full":
+			pressure.Full = stall
+		}
+	}
+	return pressure, scanner.Err()
+}
+
+// addMemoryMetrics fills the memory metrics of newer systemd versions, on
+// older hosts they are left out
+func (conn *Connection) addMemoryMetrics(ctx context.Context, prop *UnitProperties, props map[string]interface{}) {
+	if conn.managerVersion(ctx) < memoryMetricsVersion {
+		prop.MemoryPeak, prop.MemoryZSwapCurrent = 0, 0
+		return
+	}
+	// unset counters are reported as the maximal value
+	prop.MemoryPeak = propUint(props, "MemoryPeak")
+	prop.MemoryZSwapCurrent = propUint(props, "MemoryZSwapCurrent")
+	if prop.ControlGroup == "" {
+		return
+	}
+	pressure, err := readPressure(filepath.Join(cgroupRoot, prop.ControlGroup, "memory.pressure"))
+	if err != nil {
+		slog.Debug("no memory pressure of unit", "unit", prop.Id, "error", err)
+		return
+	}
+	prop.MemoryPressure = pressure
+}
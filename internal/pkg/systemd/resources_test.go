@@ -0,0 +1,58 @@
+package systemd
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type versionedDbusConnection struct {
+	mockDbusConnection
+	version string
+}
+
+func (m *versionedDbusConnection) ManagerVersionContext(ctx context.Context) (string, error) {
+	return m.version, nil
+}
+
+func TestMajorVersion(t *testing.T) {
+	assert.Equal(t, 254, majorVersion("254.5+suse.1"))
+	assert.Equal(t, 249, majorVersion("249"))
+	assert.Equal(t, 0, majorVersion("unknown"))
+}
+
+func TestAddMemoryMetrics(t *testing.T) {
+	cgroupRoot = t.TempDir()
+	t.Cleanup(func() { cgroupRoot = "/sys/fs/cgroup" })
+	dir := filepath.Join(cgroupRoot, "system.slice", "nginx.service")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.pressure"),
+		[]byte("some avg10=1.50 avg60=0.30 avg300=0.10 total=123456\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=42\n"), 0644))
+	props := map[string]interface{}{"MemoryPeak": uint64(4096), "MemoryZSwapCurrent": uint64(math.MaxUint64)}
+
+	conn := &Connection{dbus: &versionedDbusConnection{version: "254.5"}}
+	prop := UnitProperties{Id: "nginx.service", ControlGroup: "/system.slice/nginx.service", MemoryZSwapCurrent: math.MaxUint64}
+	conn.addMemoryMetrics(context.Background(), &prop, props)
+	assert.Equal(t, uint64(4096), prop.MemoryPeak)
+	assert.Zero(t, prop.MemoryZSwapCurrent)
+	require.NotNil(t, prop.MemoryPressure)
+	assert.Equal(t, 1.5, prop.MemoryPressure.Some.Avg10)
+	assert.Equal(t, uint64(123456), prop.MemoryPressure.Some.Total)
+	assert.Equal(t, uint64(42), prop.MemoryPressure.Full.Total)
+
+	// older hosts don't report the metrics
+	conn = &Connection{dbus: &versionedDbusConnection{version: "249.17"}}
+	prop = UnitProperties{Id: "nginx.service", ControlGroup: "/system.slice/nginx.service", MemoryPeak: 4096}
+	conn.addMemoryMetrics(context.Background(), &prop, props)
+	assert.Zero(t, prop.MemoryPeak)
+	assert.Nil(t, prop.MemoryPressure)
+
+	// the version isn't known without the manager
+	conn = &Connection{dbus: &mockDbusConnection{}}
+	assert.Zero(t, conn.managerVersion(context.Background()))
+}
@@ -0,0 +1,185 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+)
+
+// RunbookDir is where the markdown runbooks of the units are stored, one
+// file per unit
+var RunbookDir = "/var/lib/systemd-mcp/runbooks"
+
+// runbooks are meant as short site specific procedures
+const maxRunbookSize = 64 * 1024
+
+type SetRunbookParams struct {
+	Unit    string `json:"unit" jsonschema:"Name of the unit, e.g. nginx.service. Use a template name like getty@.service for all its instances."`
+	Content string `json:"content,omitempty" jsonschema:"Runbook in markdown. If empty the runbook of the unit is removed."`
+}
+
+type GetRunbookParams struct {
+	Unit string `json:"unit" jsonschema:"Name of the unit, for an instance the runbook of its template is returned if it has none."`
+}
+
+type RunbookResult struct {
+	Unit     string    `json:"unit"`
+	Content  string    `json:"content"`
+	Modified time.Time `json:"modified,omitzero"`
+	// the unit the runbook was stored for, e.g. the template of an instance
+	StoredFor string `json:"stored_for,omitempty"`
+	// runbook URL of the unit owners
+	Link string `json:"link,omitempty"`
+}
+
+func CreateSetRunbookSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[SetRunbookParams](nil)
+	return inputSchema
+}
+
+func CreateGetRunbookSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[GetRunbookParams](nil)
+	return inputSchema
+}
+
+func runbookPath(unit string) (string, error) {
+	if !unitNameRe.MatchString(unit) {
+		return "", fmt.Errorf("invalid unit name: %q", unit)
+	}
+	return filepath.Join(RunbookDir, unit+".md"), nil
+}
+
+// runbookUnits returns the unit and, for an instance, its template
+func runbookUnits(unit string) []string {
+	units := []string{unit}
+	if prefix, instance, ok := strings.Cut(unit, "@"); ok {
+		if dot := strings.LastIndex(instance, "."); dot > 0 {
+			units = append(units, prefix+"@"+instance[dot:])
+		}
+	}
+	return units
+}
+
+// readRunbook returns the stored runbook of the unit or its template, the
+// returned name is the unit it was stored for
+func readRunbook(unit string) (content []byte, storedFor string, modified time.Time, err error) {
+	for _, name := range runbookUnits(unit) {
+		path, err := runbookPath(name)
+		if err != nil {
+			return nil, "", time.Time{}, err
+		}
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, "", time.Time{}, err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", time.Time{}, err
+		}
+		return content, name, info.ModTime(), nil
+	}
+	return nil, "", time.Time{}, nil
+}
+
+// hasRunbook reports if a runbook is stored for the unit, so that triage
+// results can point to get_runbook
+func hasRunbook(unit string) bool {
+	for _, name := range runbookUnits(unit) {
+		if path, err := runbookPath(name); err == nil {
+			if _, err := os.Stat(path); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetRunbook stores or removes the markdown runbook of a unit
+func (conn *Connection) SetRunbook(ctx context.Context, req *mcp.CallToolRequest, params *SetRunbookParams) (*mcp.CallToolResult, any, error) {
+	path, err := runbookPath(params.Unit)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := conn.units.Check(params.Unit); err != nil {
+		return nil, nil, err
+	}
+	if len(params.Content) > maxRunbookSize {
+		return nil, nil, fmt.Errorf("runbook has %d bytes, only %d bytes are allowed", len(params.Content), maxRunbookSize)
+	}
+	allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.FilesWriteAction))
+	if !allowed || err != nil {
+		slog.Debug("SetRunbook wasn't authorized", "reason", err)
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+	}
+	defer conn.auth.Deauthorize()
+	msg := fmt.Sprintf("stored runbook of %s at %s", params.Unit, path)
+	if params.Content == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+		msg = fmt.Sprintf("removed runbook of %s", params.Unit)
+	} else {
+		if err := os.MkdirAll(RunbookDir, 0700); err != nil {
+			return nil, nil, err
+		}
+		if err := os.WriteFile(path, []byte(params.Content), 0600); err != nil {
+			return nil, nil, err
+		}
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: msg},
+		},
+	}, util.Message{Message: msg}, nil
+}
+
+// GetRunbook returns the stored runbook of a unit together with the runbook
+// link of its owners
+func (conn *Connection) GetRunbook(ctx context.Context, req *mcp.CallToolRequest, params *GetRunbookParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	if err := conn.units.Check(params.Unit); err != nil {
+		return nil, nil, err
+	}
+	content, storedFor, modified, err := readRunbook(params.Unit)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := RunbookResult{Unit: params.Unit, Content: string(content), Modified: modified}
+	if storedFor != params.Unit {
+		res.StoredFor = storedFor
+	}
+	if owner := unitOwners().Lookup(params.Unit); owner != nil {
+		res.Link = owner.Runbook
+	}
+	if content == nil && res.Link == "" {
+		return nil, nil, fmt.Errorf("no runbook stored for %s", params.Unit)
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,90 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunbook(t *testing.T) {
+	RunbookDir = filepath.Join(t.TempDir(), "runbooks")
+	OwnersPath = filepath.Join(t.TempDir(), "owners.yaml")
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{auth: auth}
+	getRunbook := func(unit string) (RunbookResult, error) {
+		var result RunbookResult
+		res, _, err := conn.GetRunbook(context.Background(), nil, &GetRunbookParams{Unit: unit})
+		if err != nil {
+			return result, err
+		}
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		return result, nil
+	}
+
+	_, err := getRunbook("nginx.service")
+	assert.ErrorContains(t, err, "no runbook")
+	assert.False(t, hasRunbook("nginx.service"))
+
+	_, _, err = conn.SetRunbook(context.Background(), nil, &SetRunbookParams{Unit: "nginx.service", Content: "# Restart\nCheck the certificates first."})
+	require.NoError(t, err)
+	assert.True(t, hasRunbook("nginx.service"))
+	result, err := getRunbook("nginx.service")
+	require.NoError(t, err)
+	assert.Contains(t, result.Content, "certificates")
+	assert.Empty(t, result.StoredFor)
+	assert.False(t, result.Modified.IsZero())
+
+	t.Run("template runbook applies to instances", func(t *testing.T) {
+		_, _, err := conn.SetRunbook(context.Background(), nil, &SetRunbookParams{Unit: "getty@.service", Content: "getty"})
+		require.NoError(t, err)
+		result, err := getRunbook("getty@tty1.service")
+		require.NoError(t, err)
+		assert.Equal(t, "getty", result.Content)
+		assert.Equal(t, "getty@.service", result.StoredFor)
+	})
+
+	t.Run("owner link", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(OwnersPath, []byte("owners:\n  - pattern: \"sshd.service\"\n    runbook: https://wiki.example.com/sshd\n"), 0600))
+		result, err := getRunbook("sshd.service")
+		require.NoError(t, err)
+		assert.Empty(t, result.Content)
+		assert.Equal(t, "https://wiki.example.com/sshd", result.Link)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, _, err := conn.SetRunbook(context.Background(), nil, &SetRunbookParams{Unit: "../passwd", Content: "x"})
+		assert.Error(t, err)
+		_, _, err = conn.SetRunbook(context.Background(), nil, &SetRunbookParams{Unit: "big.service", Content: strings.Repeat("x", maxRunbookSize+1)})
+		assert.Error(t, err)
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		_, _, err := conn.SetRunbook(context.Background(), nil, &SetRunbookParams{Unit: "nginx.service"})
+		require.NoError(t, err)
+		assert.False(t, hasRunbook("nginx.service"))
+	})
+
+	t.Run("write not authorized", func(t *testing.T) {
+		readOnly, _ := auth_pkg.NewNoAuth(true, false)
+		conn := &Connection{auth: readOnly}
+		_, _, err := conn.SetRunbook(context.Background(), nil, &SetRunbookParams{Unit: "nginx.service", Content: "x"})
+		assert.Error(t, err)
+	})
+
+	t.Run("unit scope", func(t *testing.T) {
+		conn := &Connection{auth: auth, units: &policy.UnitAccess{Denied: []string{"sshd.service"}}}
+		_, _, err := conn.SetRunbook(context.Background(), nil, &SetRunbookParams{Unit: "sshd.service", Content: "x"})
+		assert.ErrorContains(t, err, "outside of the units")
+		_, _, err = conn.GetRunbook(context.Background(), nil, &GetRunbookParams{Unit: "sshd.service"})
+		assert.ErrorContains(t, err, "outside of the units")
+	})
+}
@@ -0,0 +1,175 @@
+package systemd
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+// command used for the security assessment, replaced in the tests
+var systemdAnalyze = "systemd-analyze"
+
+var overallExposureRe = regexp.MustCompile(`Overall exposure level for \S+: ([\d.]+) (\S+)`)
+
+type AnalyzeSecurityParams struct {
+	Name          string `json:"name" jsonschema:"Exact name of the service unit."`
+	IncludePassed bool   `json:"include_passed,omitempty" jsonschema:"Also return the directives which are already set and don't add to the exposure."`
+}
+
+// a single check of systemd-analyze security
+type SecurityFinding struct {
+	// setting as shown by systemd-analyze, e.g. PrivateNetwork=
+	Directive   string  `json:"directive"`
+	Field       string  `json:"field,omitempty"`
+	Description string  `json:"description"`
+	Passed      bool    `json:"passed"`
+	Exposure    float64 `json:"exposure"`
+}
+
+type AnalyzeSecurityResult struct {
+	Name string `json:"name"`
+	// 0.0 (sandboxed) to 10.0 (fully exposed)
+	Exposure  float64 `json:"exposure"`
+	Predicate string  `json:"predicate,omitempty"`
+	NrChecks  int     `json:"nr_checks"`
+	NrFailed  int     `json:"nr_failed"`
+	// directives which reduce the exposure most, most effective first
+	Suggestions []string          `json:"suggestions,omitempty"`
+	Findings    []SecurityFinding `json:"findings"`
+}
+
+func CreateAnalyzeSecuritySchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[AnalyzeSecurityParams](nil)
+	return inputSchema
+}
+
+// parseSecurityJSON parses the output of systemd-analyze security --json=short,
+// the exposure is a string like "0.2" or null for passed checks
+func parseSecurityJSON(out []byte) ([]SecurityFinding, error) {
+	var raw []struct {
+		Set         bool            `json:"set"`
+		Name        string          `json:"name"`
+		JSONField   string          `json:"json_field"`
+		Description string          `json:"description"`
+		Exposure    json.RawMessage `json:"exposure"`
+	}
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("couldn't parse output of systemd-analyze: %w", err)
+	}
+	findings := make([]SecurityFinding, 0, len(raw))
+	for _, r := range raw {
+		f := SecurityFinding{
+			Directive:   r.Name,
+			Field:       r.JSONField,
+			Description: r.Description,
+			Passed:      r.Set,
+		}
+		exposure := strings.Trim(string(r.Exposure), `"`)
+		if exposure != "" && exposure != "null" {
+			f.Exposure, _ = strconv.ParseFloat(exposure, 64)
+		}
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+// parseOverallExposure returns the score and predicate from the plain text
+// output of systemd-analyze security, which isn't part of the JSON output
+func parseOverallExposure(out []byte) (float64, string, bool) {
+	m := overallExposureRe.FindSubmatch(out)
+	if m == nil {
+		return 0, "", false
+	}
+	score, err := strconv.ParseFloat(string(m[1]), 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return score, string(m[2]), true
+}
+
+func runAnalyzeSecurity(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, systemdAnalyze, append([]string{"security", "--no-pager"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("systemd-analyze security failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (conn *Connection) AnalyzeSecurity(ctx context.Context, req *mcp.CallToolRequest, params *AnalyzeSecurityParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	if params.Name == "" {
+		return nil, nil, fmt.Errorf("unit name is required")
+	}
+	name := params.Name
+	if !strings.Contains(name, ".") {
+		name += ".service"
+	}
+	if !strings.HasSuffix(name, ".service") {
+		return nil, nil, fmt.Errorf("only service units can be analyzed: %s", name)
+	}
+	if err := conn.units.Check(name); err != nil {
+		return nil, nil, err
+	}
+
+	out, err := runAnalyzeSecurity(ctx, "--json=short", "--", name)
+	if err != nil {
+		return nil, nil, err
+	}
+	findings, err := parseSecurityJSON(out)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := AnalyzeSecurityResult{
+		Name:     name,
+		NrChecks: len(findings),
+		Findings: []SecurityFinding{},
+	}
+	if out, err := runAnalyzeSecurity(ctx, "--", name); err != nil {
+		slog.Warn("couldn't get overall exposure", "unit", name, "error", err)
+	} else if score, predicate, ok := parseOverallExposure(out); ok {
+		res.Exposure, res.Predicate = score, predicate
+	}
+
+	slices.SortStableFunc(findings, func(a, b SecurityFinding) int {
+		return cmp.Compare(b.Exposure, a.Exposure)
+	})
+	for _, f := range findings {
+		if !f.Passed {
+			res.NrFailed++
+			if f.Exposure > 0 {
+				res.Suggestions = append(res.Suggestions, f.Directive)
+			}
+		}
+		if f.Passed && !params.IncludePassed {
+			continue
+		}
+		res.Findings = append(res.Findings, f)
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: string(jsonBytes)}},
+	}, res, nil
+}
@@ -0,0 +1,89 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const securityJSON = `[{"set":true,"name":"PrivateNetwork=","json_field":"PrivateNetwork","description":"Service has no access to the host's network","exposure":null},
+{"set":false,"name":"ProtectHome=","json_field":"ProtectHome","description":"Service has full access to home directories","exposure":"0.2"},
+{"set":false,"name":"User=/DynamicUser=","json_field":"UserOrDynamicUser","description":"Service runs as root user","exposure":"0.4"},
+{"set":false,"name":"KeyringMode=","json_field":"KeyringMode","description":"Service shares key chain with the host","exposure":null}]`
+
+func TestParseSecurityJSON(t *testing.T) {
+	findings, err := parseSecurityJSON([]byte(securityJSON))
+	require.NoError(t, err)
+	require.Len(t, findings, 4)
+	assert.True(t, findings[0].Passed)
+	assert.Equal(t, 0.0, findings[0].Exposure)
+	assert.Equal(t, "ProtectHome=", findings[1].Directive)
+	assert.Equal(t, 0.2, findings[1].Exposure)
+
+	_, err = parseSecurityJSON([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestParseOverallExposure(t *testing.T) {
+	score, predicate, ok := parseOverallExposure([]byte("  NAME  DESCRIPTION  EXPOSURE\n\n→ Overall exposure level for nginx.service: 9.2 UNSAFE 😨\n"))
+	require.True(t, ok)
+	assert.Equal(t, 9.2, score)
+	assert.Equal(t, "UNSAFE", predicate)
+
+	_, _, ok = parseOverallExposure([]byte("nothing"))
+	assert.False(t, ok)
+}
+
+func TestAnalyzeSecurity(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "systemd-analyze")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+case "$*" in
+*--json=short*) cat <<'END'
+`+securityJSON+`
+END
+;;
+*) echo "→ Overall exposure level for nginx.service: 9.2 UNSAFE" ;;
+esac
+`), 0o755))
+	orig := systemdAnalyze
+	systemdAnalyze = script
+	t.Cleanup(func() { systemdAnalyze = orig })
+
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{auth: auth}
+
+	res, _, err := conn.AnalyzeSecurity(context.Background(), nil, &AnalyzeSecurityParams{Name: "nginx"})
+	require.NoError(t, err)
+	var result AnalyzeSecurityResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+	assert.Equal(t, "nginx.service", result.Name)
+	assert.Equal(t, 9.2, result.Exposure)
+	assert.Equal(t, "UNSAFE", result.Predicate)
+	assert.Equal(t, 4, result.NrChecks)
+	assert.Equal(t, 3, result.NrFailed)
+	assert.Equal(t, []string{"User=/DynamicUser=", "ProtectHome="}, result.Suggestions)
+	assert.Len(t, result.Findings, 3)
+
+	res, _, err = conn.AnalyzeSecurity(context.Background(), nil, &AnalyzeSecurityParams{Name: "nginx.service", IncludePassed: true})
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+	assert.Len(t, result.Findings, 4)
+
+	_, _, err = conn.AnalyzeSecurity(context.Background(), nil, &AnalyzeSecurityParams{Name: "foo.socket"})
+	assert.Error(t, err)
+	_, _, err = conn.AnalyzeSecurity(context.Background(), nil, &AnalyzeSecurityParams{})
+	assert.Error(t, err)
+
+	conn.units = &policy.UnitAccess{Denied: []string{"sshd.service"}}
+	_, _, err = conn.AnalyzeSecurity(context.Background(), nil, &AnalyzeSecurityParams{Name: "sshd"})
+	assert.ErrorContains(t, err, "outside of the units")
+}
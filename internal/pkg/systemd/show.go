@@ -0,0 +1,319 @@
+package systemd
+
+import (
+	"cmp"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+	"golang.org/x/sys/unix"
+)
+
+type ShowUnitParams struct {
+	Names      []string `json:"names" jsonschema:"Exact names of the units."`
+	Properties []string `json:"properties,omitempty" jsonschema:"Names of the properties to return, e.g. 'MainPID', 'ActiveState' or 'NRestarts'. If empty a default set of properties is returned."`
+	Output     string   `json:"output,omitempty" jsonschema:"Format of the response: json, or show for the KEY=VALUE lines of 'systemctl show' so that scripts parsing systemctl work unchanged. Without properties show returns all set properties like systemctl."`
+}
+
+type ShowUnitResult struct {
+	Name       string         `json:"name"`
+	Properties map[string]any `json:"properties,omitempty"`
+	// requested properties the unit doesn't have
+	Unknown []string   `json:"unknown,omitempty"`
+	Owner   *UnitOwner `json:"owner,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+func ValidShowOutputs() []string {
+	return []string{"json", "show"}
+}
+
+func CreateShowUnitSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ShowUnitParams](nil)
+	var outputs []any
+	for _, o := range ValidShowOutputs() {
+		outputs = append(outputs, o)
+	}
+	inputSchema.Properties["output"].Enum = outputs
+	inputSchema.Properties["output"].Default = json.RawMessage("\"json\"")
+	return inputSchema
+}
+
+// selectProperties returns the requested properties, the names are matched
+// case insensitive as clients often get the case wrong
+func selectProperties(props map[string]interface{}, names []string) (selected map[string]any, unknown []string) {
+	selected = make(map[string]any)
+	lower := make(map[string]string, len(props))
+	for key := range props {
+		lower[strings.ToLower(key)] = key
+	}
+	for _, name := range names {
+		key, ok := lower[strings.ToLower(name)]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		selected[key] = props[key]
+	}
+	return selected, unknown
+}
+
+// ShowUnit is the equivalent of 'systemctl show -p', it only returns the
+// requested properties of the units
+func (conn *Connection) ShowUnit(ctx context.Context, req *mcp.CallToolRequest, params *ShowUnitParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	if len(params.Names) == 0 {
+		return nil, nil, fmt.Errorf("unit name is required")
+	}
+	for _, name := range params.Names {
+		if err := conn.units.Check(name); err != nil {
+			return nil, nil, err
+		}
+	}
+	switch params.Output {
+	case "", "json":
+	case "show":
+		return conn.showUnitLines(ctx, params)
+	default:
+		return nil, nil, fmt.Errorf("invalid output: %s, valid values are %v", params.Output, ValidShowOutputs())
+	}
+	results := []ShowUnitResult{}
+	owners := unitOwners()
+	for _, name := range params.Names {
+		res := ShowUnitResult{Name: name, Owner: owners.Lookup(name)}
+		props, err := conn.dbus.GetAllPropertiesContext(ctx, name)
+		if err != nil {
+			res.Error = err.Error()
+			results = append(results, res)
+			continue
+		}
+		if len(params.Properties) > 0 {
+			res.Properties, res.Unknown = selectProperties(props, params.Properties)
+		} else {
+			prop := UnitProperties{}
+			tmp, _ := json.Marshal(props)
+			if err := json.Unmarshal(tmp, &prop); err != nil {
+				slog.Warn("failed to unmarshal properties", "unit", name, "error", err)
+			}
+			tmp, _ = json.Marshal(prop)
+			json.Unmarshal(tmp, &res.Properties)
+		}
+		results = append(results, res)
+	}
+
+	jsonBytes, err := json.Marshal(results)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, util.NewItems(results), nil
+}
+
+// showUnitLines returns the properties as KEY=VALUE lines like systemctl
+// show, the units are separated by an empty line
+func (conn *Connection) showUnitLines(ctx context.Context, params *ShowUnitParams) (*mcp.CallToolResult, any, error) {
+	var units []string
+	content := []mcp.Content{}
+	for _, name := range params.Names {
+		props, err := conn.dbus.GetAllPropertiesContext(ctx, name)
+		if err != nil {
+			content = append(content, &mcp.TextContent{
+				Text: fmt.Sprintf("failed to show %s: %s", name, err),
+			})
+			continue
+		}
+		units = append(units, showLines(props, params.Properties))
+	}
+	content = append([]mcp.Content{&mcp.TextContent{Text: strings.Join(units, "\n")}}, content...)
+	return &mcp.CallToolResult{
+		Content: content,
+	}, nil, nil
+}
+
+// showLines formats the properties like systemctl show, without names all
+// set properties are sorted by name, requested properties are printed even
+// if empty
+func showLines(props map[string]interface{}, names []string) string {
+	var keys []string
+	all := len(names) == 0
+	if all {
+		for key := range props {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+	} else {
+		// in the order of the request, matched like selectProperties
+		for _, name := range names {
+			for key := range props {
+				if strings.EqualFold(key, name) && !slices.Contains(keys, key) {
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+	var sb strings.Builder
+	for _, key := range keys {
+		val := showValue(key, props[key])
+		if val == "" && all {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s=%s\n", key, val)
+	}
+	return sb.String()
+}
+
+// showValue formats a property value the way systemctl show does
+func showValue(name string, val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case bool:
+		return yesNo(v)
+	case []byte:
+		return hex.EncodeToString(v)
+	case []string:
+		return strings.Join(v, " ")
+	case uint64:
+		switch {
+		case strings.HasSuffix(name, "Timestamp"):
+			return showTimestamp(v)
+		case v == math.MaxUint64 && (strings.HasSuffix(name, "Current") || strings.HasSuffix(name, "NSec") || strings.HasSuffix(name, "Bytes") || strings.HasSuffix(name, "Packets") || strings.HasSuffix(name, "Peak")):
+			return "[not set]"
+		case strings.HasSuffix(name, "USec"):
+			return formatTimespan(v)
+		case v == math.MaxUint64:
+			return "infinity"
+		}
+		return strconv.FormatUint(v, 10)
+	case [][]interface{}:
+		if strings.HasPrefix(name, "Exec") {
+			var cmds []string
+			for _, cmd := range v {
+				if s, ok := showExecCommand(cmd); ok {
+					cmds = append(cmds, s)
+				}
+			}
+			return strings.Join(cmds, " ")
+		}
+	}
+	if rv := reflect.ValueOf(val); rv.Kind() == reflect.Slice {
+		elems := make([]string, rv.Len())
+		for i := range elems {
+			elems[i] = fmt.Sprint(rv.Index(i).Interface())
+		}
+		return strings.Join(elems, " ")
+	}
+	return fmt.Sprint(val)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// showTimestamp formats a realtime timestamp in microseconds, unset
+// timestamps are empty
+func showTimestamp(usec uint64) string {
+	if usec == 0 || usec == math.MaxUint64 {
+		return ""
+	}
+	return time.UnixMicro(int64(usec)).Format("Mon 2006-01-02 15:04:05 MST")
+}
+
+// formatTimespan formats microseconds like format_timespan() of systemd
+// without rounding, e.g. "1min 30s" or "1.5s"
+func formatTimespan(usec uint64) string {
+	if usec == math.MaxUint64 {
+		return "infinity"
+	}
+	if usec == 0 {
+		return "0"
+	}
+	units := []struct {
+		suffix string
+		usec   uint64
+	}{
+		{"y", 31557600 * 1000000},
+		{"month", 2629800 * 1000000},
+		{"w", 7 * 24 * 3600 * 1000000},
+		{"d", 24 * 3600 * 1000000},
+		{"h", 3600 * 1000000},
+		{"min", 60 * 1000000},
+		{"s", 1000000},
+		{"ms", 1000},
+		{"us", 1},
+	}
+	var parts []string
+	for _, u := range units {
+		if usec == 0 {
+			break
+		}
+		if usec < u.usec {
+			continue
+		}
+		a, b := usec/u.usec, usec%u.usec
+		// below a minute the rest is printed as fraction
+		if usec < 60*1000000 && b > 0 {
+			digits := len(strconv.FormatUint(u.usec, 10)) - 1
+			frac := strings.TrimRight(fmt.Sprintf("%0*d", digits, b), "0")
+			parts = append(parts, fmt.Sprintf("%d.%s%s", a, frac, u.suffix))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%d%s", a, u.suffix))
+		usec = b
+	}
+	return strings.Join(parts, " ")
+}
+
+// showExecCommand formats an entry of the Exec* properties with the
+// signature (sasbttttuii)
+func showExecCommand(cmd []interface{}) (string, bool) {
+	if len(cmd) < 10 {
+		return "", false
+	}
+	path, _ := cmd[0].(string)
+	argv, _ := cmd[1].([]string)
+	ignore, _ := cmd[2].(bool)
+	start, _ := cmd[3].(uint64)
+	stop, _ := cmd[5].(uint64)
+	pid, _ := cmd[7].(uint32)
+	code, _ := cmd[8].(int32)
+	status, _ := cmd[9].(int32)
+	codeStr, statusStr := "(null)", fmt.Sprintf("%d/%d", status, status)
+	switch code {
+	case 1:
+		codeStr, statusStr = "exited", strconv.Itoa(int(status))
+	case 2, 3:
+		codeStr = "killed"
+		if code == 3 {
+			codeStr = "dumped"
+		}
+		statusStr = fmt.Sprintf("%d/%s", status, unix.SignalName(syscall.Signal(status)))
+	}
+	return fmt.Sprintf("{ path=%s ; argv[]=%s ; ignore_errors=%s ; start_time=[%s] ; stop_time=[%s] ; pid=%d ; code=%s ; status=%s }",
+		path, strings.Join(argv, " "), yesNo(ignore), cmp.Or(showTimestamp(start), "n/a"), cmp.Or(showTimestamp(stop), "n/a"), pid, codeStr, statusStr), true
+}
@@ -0,0 +1,140 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShowUnit(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				if unitName == "missing.service" {
+					return nil, fmt.Errorf("unit %s not found", unitName)
+				}
+				return map[string]interface{}{
+					"Id":          unitName,
+					"MainPID":     uint32(42),
+					"ActiveState": "active",
+					"NRestarts":   uint32(3),
+					"StatusText":  "",
+					"Environment": []string{"FOO=bar"},
+				}, nil
+			},
+		},
+		auth: auth,
+	}
+	tests := []struct {
+		name   string
+		params *ShowUnitParams
+		want   string
+	}{
+		{
+			name:   "selected properties",
+			params: &ShowUnitParams{Names: []string{"foo.service"}, Properties: []string{"MainPID", "nrestarts", "StatusText", "Bogus"}},
+			want:   `[{"name":"foo.service","properties":{"MainPID":42,"NRestarts":3,"StatusText":""},"unknown":["Bogus"]}]`,
+		},
+		{
+			name:   "several units",
+			params: &ShowUnitParams{Names: []string{"foo.service", "missing.service"}, Properties: []string{"ActiveState"}},
+			want:   `[{"name":"foo.service","properties":{"ActiveState":"active"}},{"name":"missing.service","error":"unit missing.service not found"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, _, err := conn.ShowUnit(context.Background(), nil, tt.params)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, res.Content[0].(*mcp.TextContent).Text)
+		})
+	}
+
+	res, _, err := conn.ShowUnit(context.Background(), nil, &ShowUnitParams{Names: []string{"foo.service"}})
+	require.NoError(t, err)
+	var results []ShowUnitResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &results))
+	assert.Equal(t, "foo.service", results[0].Properties["Id"])
+	assert.NotContains(t, results[0].Properties, "Environment")
+
+	_, _, err = conn.ShowUnit(context.Background(), nil, &ShowUnitParams{})
+	assert.Error(t, err)
+
+	conn.units = &policy.UnitAccess{Denied: []string{"sshd.service"}}
+	for _, output := range []string{"json", "show"} {
+		_, _, err = conn.ShowUnit(context.Background(), nil, &ShowUnitParams{Names: []string{"foo.service", "sshd.service"}, Output: output})
+		assert.ErrorContains(t, err, "outside of the units", output)
+	}
+}
+
+func TestShowUnitLines(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	started := time.Date(2026, 10, 15, 12, 0, 0, 0, time.Local)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				if unitName == "missing.service" {
+					return nil, fmt.Errorf("unit %s not found", unitName)
+				}
+				return map[string]interface{}{
+					"Id":                   unitName,
+					"MainPID":              uint32(42),
+					"ActiveState":          "active",
+					"StatusText":           "",
+					"CanStart":             true,
+					"Names":                []string{unitName, "alias.service"},
+					"InvocationID":         []byte{0xab, 0xcd},
+					"MemoryCurrent":        uint64(math.MaxUint64),
+					"MemoryMax":            uint64(math.MaxUint64),
+					"TimeoutStartUSec":     uint64(90 * time.Second / time.Microsecond),
+					"ActiveEnterTimestamp": uint64(started.UnixMicro()),
+					"ExecStart": [][]interface{}{
+						{"/usr/bin/foo", []string{"/usr/bin/foo", "-d"}, false, uint64(0), uint64(0), uint64(0), uint64(0), uint32(0), int32(0), int32(0)},
+					},
+				}, nil
+			},
+		},
+		auth: auth,
+	}
+
+	res, _, err := conn.ShowUnit(context.Background(), nil, &ShowUnitParams{Names: []string{"foo.service"}, Output: "show"})
+	require.NoError(t, err)
+	assert.Equal(t, "ActiveEnterTimestamp="+started.Format("Mon 2006-01-02 15:04:05 MST")+"\n"+
+		"ActiveState=active\n"+
+		"CanStart=yes\n"+
+		"ExecStart={ path=/usr/bin/foo ; argv[]=/usr/bin/foo -d ; ignore_errors=no ; start_time=[n/a] ; stop_time=[n/a] ; pid=0 ; code=(null) ; status=0/0 }\n"+
+		"Id=foo.service\n"+
+		"InvocationID=abcd\n"+
+		"MainPID=42\n"+
+		"MemoryCurrent=[not set]\n"+
+		"MemoryMax=infinity\n"+
+		"Names=foo.service alias.service\n"+
+		"TimeoutStartUSec=1min 30s\n", res.Content[0].(*mcp.TextContent).Text)
+
+	res, _, err = conn.ShowUnit(context.Background(), nil, &ShowUnitParams{Names: []string{"foo.service", "missing.service", "bar.service"}, Properties: []string{"statustext", "MainPID"}, Output: "show"})
+	require.NoError(t, err)
+	require.Len(t, res.Content, 2)
+	assert.Equal(t, "StatusText=\nMainPID=42\n\nStatusText=\nMainPID=42\n", res.Content[0].(*mcp.TextContent).Text)
+	assert.Equal(t, "failed to show missing.service: unit missing.service not found", res.Content[1].(*mcp.TextContent).Text)
+
+	_, _, err = conn.ShowUnit(context.Background(), nil, &ShowUnitParams{Names: []string{"foo.service"}, Output: "yaml"})
+	assert.Error(t, err)
+}
+
+func TestFormatTimespan(t *testing.T) {
+	assert.Equal(t, "0", formatTimespan(0))
+	assert.Equal(t, "100ms", formatTimespan(100000))
+	assert.Equal(t, "1.5s", formatTimespan(1500000))
+	assert.Equal(t, "1min 30s", formatTimespan(90000000))
+	assert.Equal(t, "1d 2h", formatTimespan(26*3600*1000000))
+	assert.Equal(t, "infinity", formatTimespan(math.MaxUint64))
+}
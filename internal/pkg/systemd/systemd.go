@@ -2,9 +2,12 @@ package systemd
 
 import (
 	"context"
+	"sync"
 
 	"github.com/coreos/go-systemd/v22/dbus"
 	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/lang"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
 )
 
 // DbusConnection is an interface that abstracts the dbus connection.
@@ -16,25 +19,79 @@ type DbusConnection interface {
 	RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
 	StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
 	StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
-	KillUnitContext(ctx context.Context, name string, signal int32)
+	KillUnitWithTarget(ctx context.Context, name string, target dbus.Who, signal int32) error
+	ResetFailedUnitContext(ctx context.Context, name string) error
+	ResetFailedContext(ctx context.Context) error
 	EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error)
 	DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error)
 	ListUnitFilesContext(ctx context.Context) ([]dbus.UnitFile, error)
+	GetManagerEnvironmentContext(ctx context.Context) ([]string, error)
+	SetEnvironmentContext(ctx context.Context, assignments []string) error
+	UnsetEnvironmentContext(ctx context.Context, names []string) error
+	ReloadContext(ctx context.Context) error
 
 	Close()
 }
 
+// LogReader provides the last log lines of a unit, so that results can
+// carry the relevant journal excerpt.
+type LogReader interface {
+	UnitLog(ctx context.Context, unit string, count int) ([]string, error)
+	UnitJobResults(ctx context.Context, unit string, count int) ([]string, error)
+}
+
 type Connection struct {
 	rchannel chan string
 	dbus     DbusConnection
 	auth     auth.AuthKeeper
+	log      LogReader
+	lang     *lang.Tagger
+	// the units the tools may list and change, nil for all
+	units *policy.UnitAccess
+	// the policy the delegations are checked against, nil for none
+	policy *policy.Policy
+	// system or user
+	manager string
+	// the user manager of the server, for the scopes user and both
+	user *Connection
+
+	// major version of the manager, read on first use
+	versionOnce sync.Once
+	version     int
+
+	// subscription to the unit change signals
+	subscribeOnce sync.Once
+	subscribeErr  error
+
+	// size of a listing above which it is cut into pages, 0 for no limit
+	maxResultSize int
+
+	// properties of the units, nil if they aren't cached
+	propCache *propertyCache
+	// the property changes of the units, dispatched to all listeners
+	propsOnce      sync.Once
+	propsMu        sync.Mutex
+	propsListeners []propertiesListener
+
+	snapshotsMu sync.Mutex
+	snapshots   map[string]unitSnapshot
+
+	// disruptive actions of change_unit_state per unit
+	actionsMu sync.Mutex
+	actions   map[string][]UnitAction
+
+	// delegations of change_unit_state by id
+	delegationsMu sync.Mutex
+	delegations   map[string]Delegation
+	delegationKey []byte
 }
 
-// opens a new user connection to the dbus
+// opens a new user connection to the dbus, which is reopened if it gets lost
 func NewUser(ctx context.Context) (conn *Connection, err error) {
 	conn = new(Connection)
+	conn.manager = "user"
 	conn.rchannel = make(chan string, 1)
-	conn.dbus, err = dbus.NewUserConnectionContext(ctx)
+	conn.dbus, err = newResilientConn(ctx, dialUser)
 	if err != nil {
 		return nil, err
 	}
@@ -42,15 +99,50 @@ func NewUser(ctx context.Context) (conn *Connection, err error) {
 }
 func NewSystem(ctx context.Context, auth auth.AuthKeeper) (conn *Connection, err error) {
 	conn = new(Connection)
+	conn.manager = "system"
 	conn.auth = auth
 	conn.rchannel = make(chan string, 1)
-	conn.dbus, err = dbus.NewSystemConnectionContext(ctx)
+	conn.dbus, err = newResilientConn(ctx, dialSystem)
 	if err != nil {
 		return nil, err
 	}
 	return conn, err
 }
 
+// set the reader which is used to attach journal excerpts to results
+func (conn *Connection) SetLogReader(log LogReader) {
+	conn.log = log
+}
+
+// set the tagger which adds the language of descriptions to results
+func (conn *Connection) SetTagger(tagger *lang.Tagger) {
+	conn.lang = tagger
+}
+
+// set the units the tools may list and change
+func (conn *Connection) SetUnitAccess(units *policy.UnitAccess) {
+	conn.units = units
+}
+
+// set the policy which is applied to the delegations, as they replace the
+// authorization of the session using them
+func (conn *Connection) SetPolicy(p *policy.Policy) {
+	conn.policy = p
+}
+
+// set the connection to the user manager of the server, whose units are
+// listed with the scopes user and both
+func (conn *Connection) SetUserConnection(user *Connection) {
+	conn.user = user
+}
+
+// Ping checks that the manager still answers, used as health check of the
+// watchdog
+func (conn *Connection) Ping(ctx context.Context) error {
+	_, err := conn.dbus.ListUnitsByPatternsContext(ctx, nil, []string{"init.scope"})
+	return err
+}
+
 // close the connection
 func (conn *Connection) Close() {
 	conn.dbus.Close()
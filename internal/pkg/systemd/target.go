@@ -0,0 +1,189 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+)
+
+// SwitchTargetPermission is the polkit action for isolating a target, it is
+// separate from manage-units as isolating stops most of the running units
+const SwitchTargetPermission = "com.suse.gatekeeper.switch-target"
+
+type SwitchTargetParams struct {
+	Target  string `json:"target" jsonschema:"Target to isolate, e.g. 'multi-user.target'."`
+	Confirm bool   `json:"confirm,omitempty" jsonschema:"Must be true, isolating a target stops all units which the target doesn't pull in."`
+}
+
+type GetDefaultTargetParams struct{}
+
+type SetDefaultTargetParams struct {
+	Target string `json:"target" jsonschema:"Target to boot into, e.g. 'multi-user.target' or 'graphical.target'."`
+}
+
+type Target struct {
+	Name         string `json:"name"`
+	Description  string `json:"description,omitempty"`
+	ActiveState  string `json:"active_state"`
+	AllowIsolate bool   `json:"allow_isolate"`
+}
+
+type DefaultTargetResult struct {
+	DefaultTarget string `json:"default_target"`
+	// the loaded targets, the ones allowing isolate can be switched to
+	Targets []Target `json:"targets"`
+}
+
+// defaultTargeter is implemented by the connection to the manager
+type defaultTargeter interface {
+	GetDefaultTargetContext(ctx context.Context) (string, error)
+	SetDefaultTargetContext(ctx context.Context, target string, force bool) ([]sddbus.EnableUnitFileChange, error)
+}
+
+func CreateSwitchTargetSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[SwitchTargetParams](nil)
+	return inputSchema
+}
+
+func CreateGetDefaultTargetSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[GetDefaultTargetParams](nil)
+	return inputSchema
+}
+
+func CreateSetDefaultTargetSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[SetDefaultTargetParams](nil)
+	return inputSchema
+}
+
+// SwitchTarget isolates a target. It needs the confirm argument and its own
+// polkit action, as isolating e.g. rescue.target takes down the host.
+func (conn *Connection) SwitchTarget(ctx context.Context, req *mcp.CallToolRequest, params *SwitchTargetParams) (*mcp.CallToolResult, any, error) {
+	if !strings.HasSuffix(params.Target, ".target") {
+		return nil, nil, fmt.Errorf("invalid target %q, must end with .target", params.Target)
+	}
+	if err := conn.units.Check(params.Target); err != nil {
+		return nil, nil, err
+	}
+	if !params.Confirm {
+		return nil, nil, fmt.Errorf("isolating %s stops all units which it doesn't pull in, call again with confirm set to true if this is intended", params.Target)
+	}
+	allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, SwitchTargetPermission))
+	if !allowed || err != nil {
+		slog.Debug("SwitchTarget wasn't authorized", "reason", err)
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+	}
+	defer conn.auth.Deauthorize()
+
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, params.Target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if loadState, _ := props["LoadState"].(string); loadState != "loaded" {
+		return nil, nil, fmt.Errorf("%s can't be isolated, its load state is %s", params.Target, loadState)
+	}
+	if allowIsolate, _ := props["AllowIsolate"].(bool); !allowIsolate {
+		return nil, nil, fmt.Errorf("%s doesn't allow to be isolated (AllowIsolate=no)", params.Target)
+	}
+	slog.Info("isolating target", "target", params.Target)
+	err = conn.waitJob(ctx, func(ch chan<- string) (int, error) {
+		return conn.dbus.StartUnitContext(ctx, params.Target, "isolate", ch)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error when isolating %s: %w", params.Target, err)
+	}
+	msg := fmt.Sprintf("isolated %s", params.Target)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: msg},
+		},
+	}, util.Message{Message: msg}, nil
+}
+
+// GetDefaultTarget returns the target the system boots into together with
+// the loaded targets
+func (conn *Connection) GetDefaultTarget(ctx context.Context, req *mcp.CallToolRequest, params *GetDefaultTargetParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	targeter, ok := conn.dbus.(defaultTargeter)
+	if !ok {
+		return nil, nil, fmt.Errorf("the default target can't be read")
+	}
+	defaultTarget, err := targeter.GetDefaultTargetContext(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the default target: %w", err)
+	}
+	units, err := conn.dbus.ListUnitsByPatternsContext(ctx, []string{}, []string{"*.target"})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list the targets: %w", err)
+	}
+	res := DefaultTargetResult{DefaultTarget: defaultTarget, Targets: []Target{}}
+	for _, unit := range units {
+		target := Target{Name: unit.Name, Description: unit.Description, ActiveState: unit.ActiveState}
+		if props, err := conn.dbus.GetAllPropertiesContext(ctx, unit.Name); err == nil {
+			target.AllowIsolate, _ = props["AllowIsolate"].(bool)
+		}
+		res.Targets = append(res.Targets, target)
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
+
+// SetDefaultTarget changes the target the system boots into, the running
+// units aren't touched
+func (conn *Connection) SetDefaultTarget(ctx context.Context, req *mcp.CallToolRequest, params *SetDefaultTargetParams) (*mcp.CallToolResult, any, error) {
+	if !strings.HasSuffix(params.Target, ".target") {
+		return nil, nil, fmt.Errorf("invalid target %q, must end with .target", params.Target)
+	}
+	if err := conn.units.Check(params.Target); err != nil {
+		return nil, nil, err
+	}
+	allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsManageAction))
+	if !allowed || err != nil {
+		slog.Debug("SetDefaultTarget wasn't authorized", "reason", err)
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+	}
+	defer conn.auth.Deauthorize()
+
+	targeter, ok := conn.dbus.(defaultTargeter)
+	if !ok {
+		return nil, nil, fmt.Errorf("the default target can't be changed")
+	}
+	changes, err := targeter.SetDefaultTargetContext(ctx, params.Target, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error when setting the default target to %s: %w", params.Target, err)
+	}
+	if err := conn.dbus.ReloadContext(ctx); err != nil {
+		return nil, nil, fmt.Errorf("set the default target but failed to reload the manager: %w", err)
+	}
+	slog.Info("set default target", "target", params.Target)
+	msg := fmt.Sprintf("set the default target to %s, use switch_target to isolate it now", params.Target)
+	for _, change := range changes {
+		msg += fmt.Sprintf("\n%s %s -> %s", change.Type, change.Filename, change.Destination)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: msg},
+		},
+	}, util.Message{Message: msg}, nil
+}
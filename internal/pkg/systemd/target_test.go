@@ -0,0 +1,133 @@
+package systemd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwitchTarget(t *testing.T) {
+	var mode string
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				return map[string]interface{}{
+					"LoadState":    "loaded",
+					"AllowIsolate": unitName != "network.target",
+				}, nil
+			},
+			startUnit: func(name string, m string) (int, error) {
+				mode = m
+				return 1, nil
+			},
+			jobResult: "done",
+		},
+		auth: auth,
+	}
+	tests := []struct {
+		name    string
+		params  *SwitchTargetParams
+		wantErr string
+	}{
+		{"no target", &SwitchTargetParams{Target: "sshd.service", Confirm: true}, "must end with .target"},
+		{"not confirmed", &SwitchTargetParams{Target: "rescue.target"}, "confirm"},
+		{"no isolate", &SwitchTargetParams{Target: "network.target", Confirm: true}, "AllowIsolate"},
+		{"isolate", &SwitchTargetParams{Target: "multi-user.target", Confirm: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode = ""
+			res, _, err := conn.SwitchTarget(context.Background(), nil, tt.params)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Empty(t, mode)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "isolate", mode)
+			assert.Equal(t, "isolated multi-user.target", res.Content[0].(*mcp.TextContent).Text)
+		})
+	}
+
+	_, _, err := conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Name: "rescue.target", Action: "start", Mode: "isolate"})
+	assert.ErrorContains(t, err, "switch_target")
+
+	mode = ""
+	conn.units = &policy.UnitAccess{Denied: []string{"rescue.target"}}
+	_, _, err = conn.SwitchTarget(context.Background(), nil, &SwitchTargetParams{Target: "rescue.target", Confirm: true})
+	assert.ErrorContains(t, err, "outside of the units")
+	assert.Empty(t, mode)
+}
+
+type targetDbusConnection struct {
+	mockDbusConnection
+	defaultTarget string
+	force         bool
+}
+
+func (m *targetDbusConnection) GetDefaultTargetContext(ctx context.Context) (string, error) {
+	return m.defaultTarget, nil
+}
+
+func (m *targetDbusConnection) SetDefaultTargetContext(ctx context.Context, target string, force bool) ([]dbus.EnableUnitFileChange, error) {
+	m.defaultTarget = target
+	m.force = force
+	return []dbus.EnableUnitFileChange{{Type: "symlink", Filename: "/etc/systemd/system/default.target", Destination: "/usr/lib/systemd/system/" + target}}, nil
+}
+
+func TestDefaultTarget(t *testing.T) {
+	reloaded := false
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	mock := &targetDbusConnection{
+		mockDbusConnection: mockDbusConnection{
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				assert.Equal(t, []string{"*.target"}, patterns)
+				return []dbus.UnitStatus{
+					{Name: "graphical.target", Description: "Graphical Interface", ActiveState: "active"},
+					{Name: "network.target", Description: "Network", ActiveState: "active"},
+				}, nil
+			},
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				return map[string]interface{}{"AllowIsolate": unitName != "network.target"}, nil
+			},
+			reload: func() error {
+				reloaded = true
+				return nil
+			},
+		},
+		defaultTarget: "graphical.target",
+	}
+	conn := &Connection{dbus: mock, auth: auth}
+
+	_, out, err := conn.GetDefaultTarget(context.Background(), nil, &GetDefaultTargetParams{})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTargetResult{
+		DefaultTarget: "graphical.target",
+		Targets: []Target{
+			{Name: "graphical.target", Description: "Graphical Interface", ActiveState: "active", AllowIsolate: true},
+			{Name: "network.target", Description: "Network", ActiveState: "active"},
+		},
+	}, out)
+
+	_, _, err = conn.SetDefaultTarget(context.Background(), nil, &SetDefaultTargetParams{Target: "sshd.service"})
+	assert.ErrorContains(t, err, "must end with .target")
+	res, _, err := conn.SetDefaultTarget(context.Background(), nil, &SetDefaultTargetParams{Target: "multi-user.target"})
+	require.NoError(t, err)
+	assert.Equal(t, "multi-user.target", mock.defaultTarget)
+	assert.True(t, mock.force)
+	assert.True(t, reloaded)
+	assert.Contains(t, res.Content[0].(*mcp.TextContent).Text, "/etc/systemd/system/default.target -> /usr/lib/systemd/system/multi-user.target")
+
+	conn.units = &policy.UnitAccess{Denied: []string{"rescue.target"}}
+	_, _, err = conn.SetDefaultTarget(context.Background(), nil, &SetDefaultTargetParams{Target: "rescue.target"})
+	assert.ErrorContains(t, err, "outside of the units")
+	assert.Equal(t, "multi-user.target", mock.defaultTarget)
+}
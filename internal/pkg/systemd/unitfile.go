@@ -0,0 +1,209 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+// systemd keeps the definitions of transient units, the output of the
+// generators and the runtime markers of the units below this directory
+var runtimeRoot = "/run/systemd"
+
+// unit files are cut to this size, they are rarely bigger
+const maxUnitFileSize = 64 * 1024
+
+// directories of the generators, searched if the unit has no fragment
+var generatorDirs = []string{"generator.early", "generator", "generator.late"}
+
+type GetUnitFileContentParams struct {
+	Name string `json:"name" jsonschema:"Exact name of the unit."`
+}
+
+type UnitFileSource struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	// the file was bigger than the returned content
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// UnitRuntimeState are the markers systemd keeps for a running unit in
+// /run/systemd/units, e.g. its invocation id
+type UnitRuntimeState struct {
+	InvocationID string            `json:"invocation_id,omitempty"`
+	Transient    bool              `json:"transient"`
+	Markers      map[string]string `json:"markers,omitempty"`
+}
+
+type UnitFileContentResult struct {
+	Name string `json:"name"`
+	// fragment, transient or generator, depending where the definition was
+	// found
+	Source   string           `json:"source,omitempty"`
+	Fragment *UnitFileSource  `json:"fragment,omitempty"`
+	DropIns  []UnitFileSource `json:"drop_ins,omitempty"`
+	Runtime  UnitRuntimeState `json:"runtime"`
+	Error    string           `json:"error,omitempty"`
+}
+
+func CreateGetUnitFileContentSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[GetUnitFileContentParams](nil)
+	return inputSchema
+}
+
+// readUnitFile reads a unit file or drop-in, cut to maxUnitFileSize
+func readUnitFile(path string) (*UnitFileSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxUnitFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	src := &UnitFileSource{Path: path}
+	if len(data) > maxUnitFileSize {
+		data, src.Truncated = data[:maxUnitFileSize], true
+	}
+	src.Content = string(data)
+	return src, nil
+}
+
+// runtimeFragment looks for the definition of a unit without fragment in
+// the directories of the transient units and of the generators
+func runtimeFragment(name string) (source string, path string) {
+	candidate := filepath.Join(runtimeRoot, "transient", name)
+	if _, err := os.Stat(candidate); err == nil {
+		return "transient", candidate
+	}
+	for _, dir := range generatorDirs {
+		candidate = filepath.Join(runtimeRoot, dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return "generator", candidate
+		}
+	}
+	return "", ""
+}
+
+// runtimeMarkers reads the markers of the unit in /run/systemd/units, they
+// are symlinks named <marker>:<unit> pointing to the value
+func runtimeMarkers(name string) map[string]string {
+	entries, err := os.ReadDir(filepath.Join(runtimeRoot, "units"))
+	if err != nil {
+		return nil
+	}
+	markers := make(map[string]string)
+	for _, entry := range entries {
+		marker, unit, ok := strings.Cut(entry.Name(), ":")
+		if !ok || unit != name {
+			continue
+		}
+		if target, err := os.Readlink(filepath.Join(runtimeRoot, "units", entry.Name())); err == nil {
+			markers[marker] = target
+		}
+	}
+	return markers
+}
+
+// sourceOf returns where a fragment path is located
+func sourceOf(path string) string {
+	rel, err := filepath.Rel(runtimeRoot, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "fragment"
+	}
+	dir, _, _ := strings.Cut(rel, string(filepath.Separator))
+	switch {
+	case dir == "transient":
+		return "transient"
+	case strings.HasPrefix(dir, "generator"):
+		return "generator"
+	}
+	return "fragment"
+}
+
+// unitFileContent collects the definition of the unit, for units without a
+// fragment on disk the runtime directories of systemd are read instead
+func (conn *Connection) unitFileContent(ctx context.Context, name string) UnitFileContentResult {
+	res := UnitFileContentResult{Name: name}
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, name)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Runtime.Transient, _ = props["Transient"].(bool)
+	if id, ok := props["InvocationID"].([]byte); ok && len(id) > 0 {
+		res.Runtime.InvocationID = fmt.Sprintf("%x", id)
+	}
+	res.Runtime.Markers = runtimeMarkers(name)
+	if res.Runtime.InvocationID == "" {
+		res.Runtime.InvocationID = res.Runtime.Markers["invocation"]
+	}
+
+	path, _ := props["FragmentPath"].(string)
+	if path == "" {
+		path, _ = props["SourcePath"].(string)
+	}
+	if path != "" {
+		res.Source = sourceOf(path)
+	} else {
+		res.Source, path = runtimeFragment(name)
+	}
+	if path != "" {
+		if res.Fragment, err = readUnitFile(path); err != nil {
+			res.Error = err.Error()
+		}
+	}
+	dropins, _ := props["DropInPaths"].([]string)
+	for _, dropin := range dropins {
+		src, err := readUnitFile(dropin)
+		if err != nil {
+			slog.Warn("failed to read drop-in", "unit", name, "path", dropin, "error", err)
+			continue
+		}
+		res.DropIns = append(res.DropIns, *src)
+	}
+	if res.Fragment == nil && res.Error == "" {
+		res.Error = "the unit has no definition on disk"
+	}
+	return res
+}
+
+// GetUnitFileContent returns the unit file and the drop-ins of a unit like
+// 'systemctl cat', together with the runtime state systemd keeps for it, so
+// that transient and generated units can be debugged as well
+func (conn *Connection) GetUnitFileContent(ctx context.Context, req *mcp.CallToolRequest, params *GetUnitFileContentParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.FilesReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	if params.Name == "" {
+		return nil, nil, fmt.Errorf("unit name is required")
+	}
+	if err := conn.units.Check(params.Name); err != nil {
+		return nil, nil, err
+	}
+	res := conn.unitFileContent(ctx, params.Name)
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,87 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUnitFileContent(t *testing.T) {
+	etc := t.TempDir()
+	runtimeRoot = t.TempDir()
+	defer func() { runtimeRoot = "/run/systemd" }()
+	require.NoError(t, os.WriteFile(filepath.Join(etc, "foo.service"), []byte("[Service]\nExecStart=/usr/bin/foo\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(etc, "foo.conf"), []byte("[Service]\nNice=5\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(runtimeRoot, "transient"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(runtimeRoot, "transient", "run-u1.service"), []byte("[Service]\nExecStart=/bin/true\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(runtimeRoot, "units"), 0755))
+	require.NoError(t, os.Symlink("0123abcd", filepath.Join(runtimeRoot, "units", "invocation:run-u1.service")))
+	require.NoError(t, os.Symlink("7", filepath.Join(runtimeRoot, "units", "log-level-max:run-u1.service")))
+	require.NoError(t, os.Symlink("ffff", filepath.Join(runtimeRoot, "units", "invocation:other.service")))
+
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				switch unitName {
+				case "foo.service":
+					return map[string]interface{}{
+						"FragmentPath": filepath.Join(etc, "foo.service"),
+						"DropInPaths":  []string{filepath.Join(etc, "foo.conf")},
+						"InvocationID": []byte{0xab, 0xcd},
+					}, nil
+				case "run-u1.service", "gone.service":
+					return map[string]interface{}{"Transient": true}, nil
+				}
+				return nil, fmt.Errorf("unit %s not found", unitName)
+			},
+		},
+		auth: auth,
+	}
+	get := func(name string) UnitFileContentResult {
+		res, _, err := conn.GetUnitFileContent(context.Background(), nil, &GetUnitFileContentParams{Name: name})
+		require.NoError(t, err)
+		var out UnitFileContentResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &out))
+		return out
+	}
+
+	res := get("foo.service")
+	assert.Equal(t, "fragment", res.Source)
+	assert.Equal(t, "[Service]\nExecStart=/usr/bin/foo\n", res.Fragment.Content)
+	require.Len(t, res.DropIns, 1)
+	assert.Equal(t, "[Service]\nNice=5\n", res.DropIns[0].Content)
+	assert.Equal(t, "abcd", res.Runtime.InvocationID)
+	assert.Empty(t, res.Error)
+
+	res = get("run-u1.service")
+	assert.Equal(t, "transient", res.Source)
+	assert.Equal(t, filepath.Join(runtimeRoot, "transient", "run-u1.service"), res.Fragment.Path)
+	assert.True(t, res.Runtime.Transient)
+	assert.Equal(t, "0123abcd", res.Runtime.InvocationID)
+	assert.Equal(t, map[string]string{"invocation": "0123abcd", "log-level-max": "7"}, res.Runtime.Markers)
+
+	res = get("gone.service")
+	assert.Nil(t, res.Fragment)
+	assert.NotEmpty(t, res.Error)
+
+	res = get("missing.service")
+	assert.Equal(t, "unit missing.service not found", res.Error)
+
+	_, _, err := conn.GetUnitFileContent(context.Background(), nil, &GetUnitFileContentParams{})
+	assert.Error(t, err)
+}
+
+func TestSourceOf(t *testing.T) {
+	assert.Equal(t, "fragment", sourceOf("/usr/lib/systemd/system/foo.service"))
+	assert.Equal(t, "transient", sourceOf("/run/systemd/transient/run-u1.service"))
+	assert.Equal(t, "generator", sourceOf("/run/systemd/generator.late/foo.service"))
+}
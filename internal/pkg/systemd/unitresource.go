@@ -0,0 +1,144 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+// template of the resources describing the state of a unit
+const UnitResourceTemplate = "systemd://unit/{name}"
+
+const unitResourcePrefix = "systemd://unit/"
+
+// UnitResourceURI returns the uri of the resource of the unit
+func UnitResourceURI(name string) string {
+	return unitResourcePrefix + name
+}
+
+// unitOfResource returns the unit of a resource uri
+func unitOfResource(uri string) (string, error) {
+	name, ok := strings.CutPrefix(uri, unitResourcePrefix)
+	if !ok || name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("%s isn't a unit resource, use %s", uri, UnitResourceTemplate)
+	}
+	return name, nil
+}
+
+// UnitResourceState is the content of a unit resource
+type UnitResourceState struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	LoadState   string `json:"load_state"`
+	ActiveState string `json:"active_state"`
+	SubState    string `json:"sub_state"`
+}
+
+// authorizeUnitResource checks if the resource of the unit may be read
+func (conn *Connection) authorizeUnitResource(ctx context.Context, name string) error {
+	if err := conn.units.Check(name); err != nil {
+		return err
+	}
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return err
+	} else if !allowed {
+		return fmt.Errorf("calling method was canceled by user")
+	}
+	return nil
+}
+
+// ReadUnitResource returns the state of the unit of a systemd://unit/ uri
+func (conn *Connection) ReadUnitResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	slog.Debug("ReadUnitResource called", "uri", req.Params.URI)
+	name, err := unitOfResource(req.Params.URI)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	if err := conn.authorizeUnitResource(ctx, name); err != nil {
+		return nil, err
+	}
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get properties of %s: %w", name, err)
+	}
+	state := UnitResourceState{Name: name}
+	state.Description, _ = props["Description"].(string)
+	state.LoadState, _ = props["LoadState"].(string)
+	state.ActiveState, _ = props["ActiveState"].(string)
+	state.SubState, _ = props["SubState"].(string)
+	if state.LoadState == "not-found" {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	jsonBytes, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{{
+			URI:      req.Params.URI,
+			MIMEType: "application/json",
+			Text:     string(jsonBytes),
+		}},
+	}, nil
+}
+
+// SubscribeUnitResource is the subscribe handler of the server, only the
+// resources of units the client may read can be subscribed
+func (conn *Connection) SubscribeUnitResource(ctx context.Context, req *mcp.SubscribeRequest) error {
+	name, err := unitOfResource(req.Params.URI)
+	if err != nil {
+		return err
+	}
+	return conn.authorizeUnitResource(ctx, name)
+}
+
+// WatchUnitResources notifies the sessions subscribed to the resource of a
+// unit when its ActiveState changes, until the context is canceled
+func (conn *Connection) WatchUnitResources(ctx context.Context, server *mcp.Server) error {
+	updates := make(chan *sddbus.PropertiesUpdate, 256)
+	errs := make(chan error, 16)
+	if err := conn.listenProperties(updates, errs); err != nil {
+		return err
+	}
+	slog.Info("watching the state of units for resource subscriptions")
+	watchActiveState(ctx, updates, errs, func(name string) {
+		if err := server.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: UnitResourceURI(name)}); err != nil {
+			slog.Debug("failed to notify the subscribers", "unit", name, "error", err)
+		}
+	})
+	return nil
+}
+
+// watchActiveState calls changed for every change of the ActiveState of a
+// unit
+func watchActiveState(ctx context.Context, updates <-chan *sddbus.PropertiesUpdate, errs <-chan error, changed func(name string)) {
+	// the signals carry all properties of the unit interface, so only
+	// changes are reported
+	states := make(map[string]string)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-errs:
+			slog.Warn("error while watching units", "error", err)
+		case update := <-updates:
+			v, ok := update.Changed["ActiveState"]
+			if !ok {
+				continue
+			}
+			state, _ := v.Value().(string)
+			prev, known := states[update.UnitName]
+			states[update.UnitName] = state
+			if known && prev == state {
+				continue
+			}
+			changed(update.UnitName)
+		}
+	}
+}
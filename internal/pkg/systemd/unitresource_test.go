@@ -0,0 +1,95 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitOfResource(t *testing.T) {
+	name, err := unitOfResource(UnitResourceURI("nginx.service"))
+	require.NoError(t, err)
+	assert.Equal(t, "nginx.service", name)
+
+	for _, uri := range []string{"systemd://unit/", "systemd://unit/a/b", "file:///etc/passwd"} {
+		_, err := unitOfResource(uri)
+		assert.Error(t, err, uri)
+	}
+}
+
+func TestReadUnitResource(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, false)
+	units, err := policy.NewUnitAccess(nil, []string{"sshd.service"})
+	require.NoError(t, err)
+	conn := &Connection{
+		auth: auth,
+		dbus: &mockDbusConnection{
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				if unitName == "missing.service" {
+					return map[string]interface{}{"LoadState": "not-found"}, nil
+				}
+				return map[string]interface{}{
+					"Description": "web server",
+					"LoadState":   "loaded",
+					"ActiveState": "active",
+					"SubState":    "running",
+				}, nil
+			},
+		},
+		units: units,
+	}
+	read := func(name string) (*mcp.ReadResourceResult, error) {
+		return conn.ReadUnitResource(context.Background(), &mcp.ReadResourceRequest{Params: &mcp.ReadResourceParams{URI: UnitResourceURI(name)}})
+	}
+
+	res, err := read("nginx.service")
+	require.NoError(t, err)
+	require.Len(t, res.Contents, 1)
+	var state UnitResourceState
+	require.NoError(t, json.Unmarshal([]byte(res.Contents[0].Text), &state))
+	assert.Equal(t, UnitResourceState{Name: "nginx.service", Description: "web server", LoadState: "loaded", ActiveState: "active", SubState: "running"}, state)
+
+	_, err = read("missing.service")
+	assert.Error(t, err)
+	_, err = read("sshd.service")
+	assert.Error(t, err)
+	assert.Error(t, conn.SubscribeUnitResource(context.Background(), &mcp.SubscribeRequest{Params: &mcp.SubscribeParams{URI: UnitResourceURI("sshd.service")}}))
+	assert.NoError(t, conn.SubscribeUnitResource(context.Background(), &mcp.SubscribeRequest{Params: &mcp.SubscribeParams{URI: UnitResourceURI("nginx.service")}}))
+}
+
+func TestWatchActiveState(t *testing.T) {
+	updates := make(chan *dbus.PropertiesUpdate)
+	errs := make(chan error)
+	var changed []string
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watchActiveState(ctx, updates, errs, func(name string) {
+			changed = append(changed, name)
+		})
+		close(done)
+	}()
+
+	for _, update := range []dbus.PropertiesUpdate{
+		{UnitName: "nginx.service", Changed: map[string]godbus.Variant{"ActiveState": godbus.MakeVariant("activating")}},
+		{UnitName: "nginx.service", Changed: map[string]godbus.Variant{"ActiveState": godbus.MakeVariant("active")}},
+		// repeated states and other properties aren't reported
+		{UnitName: "nginx.service", Changed: map[string]godbus.Variant{"ActiveState": godbus.MakeVariant("active")}},
+		{UnitName: "sshd.service", Changed: map[string]godbus.Variant{"Description": godbus.MakeVariant("ssh")}},
+		{UnitName: "sshd.service", Changed: map[string]godbus.Variant{"ActiveState": godbus.MakeVariant("failed")}},
+	} {
+		updates <- &update
+	}
+	cancel()
+	<-done
+
+	assert.Equal(t, []string{"nginx.service", "nginx.service", "sshd.service"}, changed)
+}
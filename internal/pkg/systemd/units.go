@@ -1,19 +1,26 @@
 package systemd
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
 	"path"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
 	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/openSUSE/systemd-mcp/dbus"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+	"golang.org/x/sys/unix"
 )
 
 func ValidStates() []string {
@@ -60,6 +67,11 @@ type UnitProperties struct {
 	// Additional fields that might be useful
 	Restart       string `json:"Restart"`
 	MemoryCurrent uint64 `json:"MemoryCurrent"`
+
+	// only reported by systemd 254 and newer
+	MemoryPeak         uint64          `json:"MemoryPeak,omitempty"`
+	MemoryZSwapCurrent uint64          `json:"MemoryZSwapCurrent,omitempty"`
+	MemoryPressure     *MemoryPressure `json:"MemoryPressure,omitempty"`
 }
 
 type ListLoadedUnitsParams struct {
@@ -68,8 +80,24 @@ type ListLoadedUnitsParams struct {
 	Properties         bool     `json:"properties,omitempty" jsonschema:"If true, return detailed properties for each unit."`
 	IncludeDescription bool     `json:"include_description,omitempty" jsonschema:"If true, include the description for each unit."`
 	Verbose            bool     `json:"verbose,omitempty" jsonschema:"Return more details in the response."`
+	Offset             int      `json:"offset,omitempty" jsonschema:"Number of units to skip."`
+	Limit              int      `json:"limit,omitempty" jsonschema:"Maximum number of units to return. Set to 0 to return all units."`
+	SortBy             string   `json:"sort_by,omitempty" jsonschema:"Sort the units by name, state, memory or cpu. Memory and cpu sort the biggest consumers first."`
+	MaxTokensHint      int      `json:"max_tokens_hint,omitempty" jsonschema:"Approximate number of tokens the response may use. Verbosity and the number of units are reduced to fit and the omissions are reported."`
+	Scope              string   `json:"scope,omitempty" jsonschema:"Manager of the units: system, user for the user manager of the server or both. With both every entry is tagged with its manager and offset and limit apply to each manager."`
+	Continuation       string   `json:"continuation,omitempty" jsonschema:"Token returned with a listing which was cut into pages because of its size, returns the next page. The other arguments are ignored."`
+}
+
+func ValidSortBy() []string {
+	return []string{"name", "state", "memory", "cpu"}
 }
 
+func ValidScopes() []string {
+	return []string{"system", "user", "both"}
+}
+
+const DefaultUnitLimit = 100
+
 func CreateListLoadedUnitsSchema() *jsonschema.Schema {
 	inputSchema, _ := jsonschema.For[ListLoadedUnitsParams](nil)
 	var states []any
@@ -81,19 +109,220 @@ func CreateListLoadedUnitsSchema() *jsonschema.Schema {
 		inputSchema.Properties["state"].Enum = states
 		inputSchema.Properties["state"].Default = json.RawMessage("\"active\"")
 	}
+	var sortBy []any
+	for _, s := range ValidSortBy() {
+		sortBy = append(sortBy, s)
+	}
+	inputSchema.Properties["sort_by"].Enum = sortBy
+	inputSchema.Properties["sort_by"].Default = json.RawMessage("\"name\"")
+	inputSchema.Properties["limit"].Default = json.RawMessage(fmt.Sprint(DefaultUnitLimit))
+	var scopes []any
+	for _, s := range ValidScopes() {
+		scopes = append(scopes, s)
+	}
+	inputSchema.Properties["scope"].Enum = scopes
+	inputSchema.Properties["scope"].Default = json.RawMessage("\"system\"")
 
 	return inputSchema
 }
 
+// propUint returns an unsigned property, systemd reports unset counters as
+// the maximal value
+func propUint(props map[string]interface{}, name string) uint64 {
+	val, _ := props[name].(uint64)
+	if val == math.MaxUint64 {
+		return 0
+	}
+	return val
+}
+
+// sortUnits sorts the units in place, for memory and cpu the properties of
+// all units are fetched and returned so that they can be reused
+func (conn *Connection) sortUnits(ctx context.Context, units []sddbus.UnitStatus, sortBy string) (map[string]map[string]interface{}, error) {
+	switch sortBy {
+	case "", "name":
+		slices.SortFunc(units, func(a, b sddbus.UnitStatus) int { return strings.Compare(a.Name, b.Name) })
+	case "state":
+		slices.SortFunc(units, func(a, b sddbus.UnitStatus) int {
+			return cmp.Or(strings.Compare(a.ActiveState, b.ActiveState), strings.Compare(a.SubState, b.SubState), strings.Compare(a.Name, b.Name))
+		})
+	case "memory", "cpu":
+		property := "MemoryCurrent"
+		if sortBy == "cpu" {
+			property = "CPUUsageNSec"
+		}
+		allProps := make(map[string]map[string]interface{}, len(units))
+		for _, u := range units {
+			props, err := conn.unitProperties(ctx, u.Name)
+			if err != nil {
+				slog.Warn("failed to get properties for unit", "unit", u.Name, "error", err)
+				continue
+			}
+			allProps[u.Name] = props
+		}
+		slices.SortFunc(units, func(a, b sddbus.UnitStatus) int {
+			return cmp.Or(cmp.Compare(propUint(allProps[b.Name], property), propUint(allProps[a.Name], property)), strings.Compare(a.Name, b.Name))
+		})
+		return allProps, nil
+	default:
+		return nil, fmt.Errorf("invalid sort_by: %s, valid values are %v", sortBy, ValidSortBy())
+	}
+	return nil, nil
+}
+
+type unitDescription struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Language    string `json:"language,omitempty"`
+	Translation string `json:"translation,omitempty"`
+}
+
+// describedUnit tags the description with its language if a tagger is set
+func (conn *Connection) describedUnit(ctx context.Context, name, description string) unitDescription {
+	unit := unitDescription{Name: name, Description: description}
+	unit.Language, unit.Translation = conn.lang.Tag(ctx, description)
+	return unit
+}
+
 func (conn *Connection) ListLoadedUnits(ctx context.Context, req *mcp.CallToolRequest, params *ListLoadedUnitsParams) (*mcp.CallToolResult, any, error) {
-	slog.Debug("ListLoadedUnits called", "params", params)
-	if allowed, err := conn.auth.IsReadAuthorized(ctx); err != nil {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
 		return nil, nil, err
 	} else if !allowed {
 		return nil, nil, fmt.Errorf("calling method was canceled by user")
 	}
 
+	// a listing is continued with the arguments of the token
+	continued := params.Continuation != ""
+	var end int
+	if continued {
+		cont, err := decodeContinuation(params.Continuation)
+		if err != nil {
+			return nil, nil, err
+		}
+		params, end = &cont.Params, cont.End
+	} else if params.Limit > 0 {
+		end = max(params.Offset, 0) + params.Limit
+	}
+
+	txtContentList, count, total, err := conn.scopedUnits(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	page := *params
+	if params.MaxTokensHint > 0 {
+		// reduce the verbosity first and then the number of units
+		shaping := &util.Shaping{MaxTokensHint: params.MaxTokensHint}
+		shaped := *params
+		shapedCount := count
+		for !shaping.FitsContent(txtContentList) && shapedCount > 0 {
+			switch {
+			case shaped.Verbose:
+				shaped.Verbose = false
+				shaping.Reduce("verbose")
+			case shaped.Properties:
+				shaped.Properties = false
+				shaping.Reduce("properties")
+			case shaped.IncludeDescription:
+				shaped.IncludeDescription = false
+				shaping.Reduce("include_description")
+			default:
+				// a limit of 0 would list all units
+				if shaped.Limit = shaping.Shrink(shapedCount); shaped.Limit == 0 {
+					txtContentList, shapedCount = nil, 0
+					continue
+				}
+			}
+			if txtContentList, shapedCount, _, err = conn.scopedUnits(ctx, &shaped); err != nil {
+				return nil, nil, err
+			}
+		}
+		if len(shaping.Reduced) > 0 || shapedCount < count {
+			shaping.Omitted = count - shapedCount
+			txtContentList = append(txtContentList, shaping.Content())
+		}
+	} else if conn.maxResultSize > 0 && util.ContentBytes(txtContentList) > conn.maxResultSize {
+		if txtContentList, total, err = conn.fitResultSize(ctx, &page, txtContentList, count, total); err != nil {
+			return nil, nil, err
+		}
+		continued = true
+	}
+	if continued {
+		block, err := nextPage(&page, end, total)
+		if err != nil {
+			return nil, nil, err
+		}
+		if block != nil {
+			txtContentList = append(txtContentList, block)
+		}
+	}
+
+	if len(txtContentList) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "[]"}},
+		}, nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: txtContentList,
+	}, nil, nil
+}
+
+// scopedUnits returns the content of the managers of the scope, the
+// managers are queried concurrently. The total is the most units one of the
+// managers has before paging.
+func (conn *Connection) scopedUnits(ctx context.Context, params *ListLoadedUnitsParams) ([]mcp.Content, int, int, error) {
+	var managers []*Connection
+	switch params.Scope {
+	case "", "system":
+		return conn.loadedUnits(ctx, params)
+	case "user":
+		managers = []*Connection{conn.user}
+	case "both":
+		managers = []*Connection{conn, conn.user}
+	default:
+		return nil, 0, 0, fmt.Errorf("invalid scope: %s, valid values are %v", params.Scope, ValidScopes())
+	}
+	if conn.user == nil {
+		return nil, 0, 0, fmt.Errorf("no connection to the user manager")
+	}
+	type result struct {
+		content []mcp.Content
+		count   int
+		total   int
+		err     error
+	}
+	results := make([]result, len(managers))
+	var wg sync.WaitGroup
+	for i, m := range managers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i].content, results[i].count, results[i].total, results[i].err = m.loadedUnits(ctx, params)
+		}()
+	}
+	wg.Wait()
+	var content []mcp.Content
+	count, total := 0, 0
+	for _, r := range results {
+		if r.err != nil {
+			return nil, 0, 0, r.err
+		}
+		content = append(content, r.content...)
+		count += r.count
+		total = max(total, r.total)
+	}
+	return content, count, total, nil
+}
+
+// loadedUnits returns the content for ListLoadedUnits, the number of units
+// in it and the number of units before paging
+func (conn *Connection) loadedUnits(ctx context.Context, params *ListLoadedUnitsParams) ([]mcp.Content, int, int, error) {
 	var reqStates []string
+	// the entries are only tagged if the managers are merged
+	var manager string
+	if params.Scope == "both" {
+		manager = conn.manager
+	}
 
 	if params.State == "all" {
 		// List all states
@@ -107,22 +336,40 @@ func (conn *Connection) ListLoadedUnits(ctx context.Context, req *mcp.CallToolRe
 
 	units, err := conn.dbus.ListUnitsByPatternsContext(ctx, reqStates, params.Patterns)
 	if err != nil {
-		return nil, nil, err
+		return nil, 0, 0, err
+	}
+	units = slices.DeleteFunc(units, func(u sddbus.UnitStatus) bool {
+		return !conn.units.Permits(u.Name)
+	})
+	allProps, err := conn.sortUnits(ctx, units, params.SortBy)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	totalCount := len(units)
+	units = units[min(max(params.Offset, 0), totalCount):]
+	if params.Limit > 0 && len(units) > params.Limit {
+		units = units[:params.Limit]
 	}
 
 	txtContentList := []mcp.Content{}
 
 	if params.Properties {
 		for _, u := range units {
-			props, err := conn.dbus.GetAllPropertiesContext(ctx, u.Name)
-			if err != nil {
-				slog.Warn("failed to get properties for unit", "unit", u.Name, "error", err)
-				continue
+			props, ok := allProps[u.Name]
+			if !ok {
+				props, err = conn.unitProperties(ctx, u.Name)
+				if err != nil {
+					slog.Warn("failed to get properties for unit", "unit", u.Name, "error", err)
+					continue
+				}
 			}
 			props = util.ClearMap(props)
 
 			var jsonByte []byte
 			if params.Verbose {
+				if manager != "" {
+					props["Manager"] = manager
+				}
 				jsonByte, err = json.Marshal(&props)
 			} else {
 				prop := UnitProperties{}
@@ -131,10 +378,14 @@ func (conn *Connection) ListLoadedUnits(ctx context.Context, req *mcp.CallToolRe
 					slog.Warn("failed to unmarshal properties", "unit", u.Name, "error", err)
 					continue
 				}
-				jsonByte, err = json.Marshal(&prop)
+				conn.addMemoryMetrics(ctx, &prop, props)
+				jsonByte, err = json.Marshal(&struct {
+					UnitProperties
+					Manager string `json:"Manager,omitempty"`
+				}{prop, manager})
 			}
 			if err != nil {
-				return nil, nil, err
+				return nil, 0, 0, err
 			}
 			txtContentList = append(txtContentList, &mcp.TextContent{
 				Text: string(jsonByte),
@@ -142,7 +393,10 @@ func (conn *Connection) ListLoadedUnits(ctx context.Context, req *mcp.CallToolRe
 		}
 	} else if params.Verbose {
 		for _, u := range units {
-			jsonByte, _ := json.Marshal(&u)
+			jsonByte, _ := json.Marshal(&struct {
+				sddbus.UnitStatus
+				Manager string `json:"Manager,omitempty"`
+			}{u, manager})
 			txtContentList = append(txtContentList, &mcp.TextContent{
 				Text: string(jsonByte),
 			})
@@ -152,10 +406,7 @@ func (conn *Connection) ListLoadedUnits(ctx context.Context, req *mcp.CallToolRe
 		for _, u := range units {
 			var unitData any
 			if params.IncludeDescription {
-				unitData = struct {
-					Name        string `json:"name"`
-					Description string `json:"description"`
-				}{Name: u.Name, Description: u.Description}
+				unitData = conn.describedUnit(ctx, u.Name, u.Description)
 			} else {
 				unitData = u.Name
 			}
@@ -171,9 +422,10 @@ func (conn *Connection) ListLoadedUnits(ctx context.Context, req *mcp.CallToolRe
 
 		for _, state := range states {
 			res := struct {
-				State string `json:"state"`
-				Units any    `json:"units"`
-			}{State: state, Units: groups[state]}
+				Manager string `json:"manager,omitempty"`
+				State   string `json:"state"`
+				Units   any    `json:"units"`
+			}{Manager: manager, State: state, Units: groups[state]}
 			jsonByte, _ := json.Marshal(res)
 			txtContentList = append(txtContentList, &mcp.TextContent{
 				Text: string(jsonByte),
@@ -181,15 +433,21 @@ func (conn *Connection) ListLoadedUnits(ctx context.Context, req *mcp.CallToolRe
 		}
 	}
 
-	if len(txtContentList) == 0 {
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: "[]"}},
-		}, nil, nil
+	if params.Offset > 0 || params.Limit > 0 {
+		// the paging is only reported when requested, so that the total
+		// count tells the client whether further calls are needed
+		jsonByte, _ := json.Marshal(struct {
+			Manager    string `json:"manager,omitempty"`
+			TotalCount int    `json:"total_count"`
+			Offset     int    `json:"offset"`
+			Count      int    `json:"count"`
+		}{Manager: manager, TotalCount: totalCount, Offset: params.Offset, Count: len(units)})
+		txtContentList = append(txtContentList, &mcp.TextContent{
+			Text: string(jsonByte),
+		})
 	}
 
-	return &mcp.CallToolResult{
-		Content: txtContentList,
-	}, nil, nil
+	return txtContentList, len(units), totalCount, nil
 }
 
 type ListUnitFilesParams struct {
@@ -214,8 +472,7 @@ func CreateListUnitFilesSchema() *jsonschema.Schema {
 }
 
 func (conn *Connection) ListUnitFiles(ctx context.Context, req *mcp.CallToolRequest, params *ListUnitFilesParams) (*mcp.CallToolResult, any, error) {
-	slog.Debug("ListUnitFiles called", "params", params)
-	if allowed, err := conn.auth.IsReadAuthorized(ctx); err != nil {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
 		return nil, nil, err
 	} else if !allowed {
 		return nil, nil, fmt.Errorf("calling method was canceled by user")
@@ -233,6 +490,9 @@ func (conn *Connection) ListUnitFiles(ctx context.Context, req *mcp.CallToolRequ
 
 	for _, unit := range unitList {
 		name := path.Base(unit.Path)
+		if !conn.units.Permits(name) {
+			continue
+		}
 		state := unit.Type // In ListUnitFiles, Type corresponds to enablement state
 
 		// Filter by state
@@ -270,10 +530,7 @@ func (conn *Connection) ListUnitFiles(ctx context.Context, req *mcp.CallToolRequ
 					description = d
 				}
 			}
-			unitData = struct {
-				Name        string `json:"name"`
-				Description string `json:"description"`
-			}{Name: name, Description: description}
+			unitData = conn.describedUnit(ctx, name, description)
 		} else {
 			unitData = name
 		}
@@ -344,7 +601,7 @@ type RestartReloadParams struct {
 
 // return which are define in the upstream documentation as:
 func ValidRestartModes() []string {
-	return []string{"replace", "fail", "isolate", "ignore-dependencies", "ignore-requirements"}
+	return []string{"replace", "fail", "ignore-dependencies", "ignore-requirements"}
 }
 
 const MaxTimeOut uint = 60
@@ -368,7 +625,6 @@ type CheckReloadRestartParams struct {
 
 // check status of reload or restart
 func (conn *Connection) CheckForRestartReloadRunning(ctx context.Context, req *mcp.CallToolRequest, params *RestartReloadParams) (res *mcp.CallToolResult, _ any, err error) {
-	slog.Debug("CheckForRestartReloadRunning called", "params", params)
 
 	allowed, err := conn.auth.IsWriteAuthorized(ctx)
 	if err != nil {
@@ -377,47 +633,48 @@ func (conn *Connection) CheckForRestartReloadRunning(ctx context.Context, req *m
 	if !allowed {
 		return nil, nil, fmt.Errorf("calling method was canceled by user")
 	}
+	var msg string
 	select {
-	case result := <-conn.rchannel:
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{
-					Text: result,
-				},
-			},
-		}, nil, nil
+	case msg = <-conn.rchannel:
 	case <-time.After(3 * time.Second):
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{
-					Text: "Reload or restart still in progress.",
-				},
-			},
-		}, nil, nil
+		msg = "Reload or restart still in progress."
 	default:
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{
-					Text: "Finished",
-				},
-			},
-		}, nil, nil
+		msg = "Finished"
 	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: msg,
+			},
+		},
+	}, util.Message{Message: msg}, nil
 }
 
 type ChangeUnitStateParams struct {
-	Name    string `json:"name" jsonschema:"Exact name of unit to change state"`
-	Action  string `json:"action" jsonschema:"Action to perform."`
-	Mode    string `json:"mode,omitempty" jsonschema:"Mode when restarting a unit. Defaults to 'replace'."`
-	TimeOut uint   `json:"timeout,omitempty" jsonschema:"Time to wait for the operation to finish. Max 60s."`
-	Runtime bool   `json:"runtime,omitempty" jsonschema:"Enable/Disable only temporarily (runtime)."`
+	Name         string   `json:"name,omitempty" jsonschema:"Exact name of unit to change state. For 'reset_failed' an empty name resets all failed units."`
+	Names        []string `json:"names,omitempty" jsonschema:"Exact names of several units to enable, disable, start or stop at once instead of name. The result is reported for every unit."`
+	AllOrNothing bool     `json:"all_or_nothing,omitempty" jsonschema:"With names: enable or disable all unit files in a single call, or stop at the first unit which fails to start or stop and change the others back."`
+	Action       string   `json:"action" jsonschema:"Action to perform."`
+	Mode         string   `json:"mode,omitempty" jsonschema:"Mode when restarting a unit. Defaults to 'replace'."`
+	TimeOut      uint     `json:"timeout,omitempty" jsonschema:"Time to wait for the operation to finish. Max 60s."`
+	Runtime      bool     `json:"runtime,omitempty" jsonschema:"Enable/Disable only temporarily (runtime)."`
+	Signal       string   `json:"signal,omitempty" jsonschema:"Signal to send with 'stop_kill', as name (e.g. 'SIGHUP' or 'HUP') or number. Defaults to 'SIGKILL'."`
+	KillWho      string   `json:"kill_who,omitempty" jsonschema:"Processes which get the signal with 'stop_kill'. Defaults to 'all'."`
+	// bypasses the restart storm guard
+	Override bool `json:"override,omitempty" jsonschema:"Perform a start, stop or restart even if the unit had too many of them recently. Only set it after finding out why the unit keeps failing."`
+	// replaces the authorization of the session
+	Delegation string `json:"delegation,omitempty" jsonschema:"Bearer token of a delegation created by create_delegation which grants the action on the unit."`
 }
 
 func ValidChanges() []string {
-	return []string{"restart", "restart_force", "start", "stop", "stop_kill", "reload", "enable", "enable_force", "disable"}
+	return []string{"restart", "restart_force", "start", "stop", "stop_kill", "reload", "enable", "enable_force", "disable", "reset_failed"}
+}
+func ValidKillWho() []string {
+	return []string{"all", "main", "control"}
 }
+
 func ValidModes() []string {
-	return []string{"replace", "fail", "isolate", "ignore-dependencies", "ignore-requirements"}
+	return []string{"replace", "fail", "ignore-dependencies", "ignore-requirements"}
 }
 
 func CreateChangeInputSchema() *jsonschema.Schema {
@@ -435,31 +692,52 @@ func CreateChangeInputSchema() *jsonschema.Schema {
 	inputSchmema.Properties["mode"].Enum = modes
 	inputSchmema.Properties["mode"].Default = json.RawMessage("\"replace\"")
 	inputSchmema.Properties["timeout"].Default = json.RawMessage("30")
+	var who []any
+	for _, w := range ValidKillWho() {
+		who = append(who, w)
+	}
+	inputSchmema.Properties["kill_who"].Enum = who
+	inputSchmema.Properties["kill_who"].Default = json.RawMessage("\"all\"")
+	inputSchmema.Properties["signal"].Default = json.RawMessage("\"SIGKILL\"")
 
 	return inputSchmema
 }
 
 func (conn *Connection) ChangeUnitState(ctx context.Context, req *mcp.CallToolRequest, params *ChangeUnitStateParams) (res *mcp.CallToolResult, _ any, err error) {
-	slog.Debug("ChangeUnitState called", "params", params)
-
-	var permission string
-	if params.Action == "enable" || params.Action == "enable_force" || params.Action == "disable" {
-		permission = "org.freedesktop.systemd1.manage-unit-files"
-	} else {
-		permission = "org.freedesktop.systemd1.manage-units"
+	if params.Mode == "isolate" {
+		return nil, nil, fmt.Errorf("mode isolate isn't supported here, use the switch_target tool")
+	}
+	if len(params.Names) > 0 {
+		return conn.changeUnits(ctx, params)
+	}
+	// reset_failed without a name only touches the units of the scope
+	if params.Name != "" || params.Action != "reset_failed" {
+		if err := conn.units.Check(params.Name); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, permission))
-	if !allowed || err != nil {
-		slog.Debug("ChangeUnit wasn't authorized", "reason", err)
-		return nil, nil, fmt.Errorf("calling method wasn't authorized: %s", err)
+	if params.Delegation != "" {
+		if err := conn.checkDelegation(params.Delegation, params.Name, params.Action, time.Now()); err != nil {
+			return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+		}
+	} else {
+		allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsManageAction))
+		if !allowed || err != nil {
+			slog.Debug("ChangeUnit wasn't authorized", "reason", err)
+			return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+		}
+		defer conn.auth.Deauthorize()
 	}
-	defer conn.auth.Deauthorize()
 
 	if params.TimeOut > MaxTimeOut {
 		return nil, nil, fmt.Errorf("not waiting longer than MaxTimeOut(%d), longer operation will run in the background and result can be gathered with separate function.", MaxTimeOut)
 	}
+	if err := conn.guardAction(params.Name, params.Action, params.Override, time.Now()); err != nil {
+		return nil, nil, err
+	}
 
+	var jobID int
 	switch params.Action {
 	case "start":
 		if params.Mode == "" {
@@ -468,19 +746,20 @@ func (conn *Connection) ChangeUnitState(ctx context.Context, req *mcp.CallToolRe
 		if !slices.Contains(ValidRestartModes(), params.Mode) {
 			return nil, nil, fmt.Errorf("invalid mode for start: %s", params.Mode)
 		}
-		_, err = conn.dbus.StartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
+		jobID, err = conn.dbus.StartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
 	case "stop":
-		_, err = conn.dbus.StopUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
+		jobID, err = conn.dbus.StopUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
 	case "stop_kill":
-		conn.dbus.KillUnitContext(ctx, params.Name, int32(9))
+		return conn.killUnit(ctx, params)
 	case "restart_force":
-		_, err = conn.dbus.RestartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
+		jobID, err = conn.dbus.RestartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
 	case "restart":
-		_, err = conn.dbus.ReloadOrRestartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
+		jobID, err = conn.dbus.ReloadOrRestartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
 	case "reload":
-		_, err = conn.dbus.ReloadOrRestartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
+		jobID, err = conn.dbus.ReloadOrRestartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
 	case "enable", "enable_force":
 		_, enabledRes, err := conn.dbus.EnableUnitFilesContext(ctx, []string{params.Name}, params.Runtime, strings.HasSuffix(params.Action, "_force"))
+		conn.invalidateProperties(params.Name)
 		if err != nil {
 			slog.Error("error when enabling", "dbus.error", err)
 			return nil, nil, fmt.Errorf("error when enabling: %w", err)
@@ -505,6 +784,7 @@ func (conn *Connection) ChangeUnitState(ctx context.Context, req *mcp.CallToolRe
 		return &mcp.CallToolResult{Content: txtContentList}, nil, nil
 	case "disable":
 		disabledRes, err := conn.dbus.DisableUnitFilesContext(ctx, []string{params.Name}, params.Runtime)
+		conn.invalidateProperties(params.Name)
 		if err != nil {
 			return nil, nil, fmt.Errorf("error when disabling: %w", err)
 		}
@@ -526,6 +806,8 @@ func (conn *Connection) ChangeUnitState(ctx context.Context, req *mcp.CallToolRe
 			txtContentList = append(txtContentList, &mcp.TextContent{Text: string(jsonByte)})
 		}
 		return &mcp.CallToolResult{Content: txtContentList}, nil, nil
+	case "reset_failed":
+		return conn.resetFailed(ctx, params.Name)
 	default:
 		return nil, nil, fmt.Errorf("invalid action: %s", params.Action)
 	}
@@ -533,8 +815,103 @@ func (conn *Connection) ChangeUnitState(ctx context.Context, req *mcp.CallToolRe
 	if err != nil {
 		return nil, nil, err
 	}
+	if params.TimeOut > 0 {
+		return conn.waitUnitJob(ctx, jobID, params.TimeOut)
+	}
 
 	return conn.CheckForRestartReloadRunning(ctx, req, &RestartReloadParams{
 		TimeOut: params.TimeOut,
 	})
 }
+
+// reset the failed state and the start rate limit counter of the given unit
+// or of all failed units if name is empty. Without a scope of the units the
+// manager resets all units at once, so that units failing meanwhile or which
+// aren't loaded are reset too.
+func (conn *Connection) resetFailed(ctx context.Context, name string) (*mcp.CallToolResult, any, error) {
+	var names []string
+	if name == "" && conn.units == nil {
+		if err := conn.dbus.ResetFailedContext(ctx); err != nil {
+			return nil, nil, fmt.Errorf("error when resetting failed state: %w", err)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "reset failed state of all units"},
+			},
+		}, nil, nil
+	}
+	if name != "" {
+		names = []string{name}
+	} else {
+		units, err := conn.dbus.ListUnitsByPatternsContext(ctx, []string{"failed"}, []string{})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, u := range units {
+			if conn.units.Permits(u.Name) {
+				names = append(names, u.Name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "no failed units"},
+			},
+		}, nil, nil
+	}
+	txtContentList := []mcp.Content{}
+	for _, n := range names {
+		if err := conn.dbus.ResetFailedUnitContext(ctx, n); err != nil {
+			return nil, nil, fmt.Errorf("error when resetting failed state of %s: %w", n, err)
+		}
+		txtContentList = append(txtContentList, &mcp.TextContent{Text: fmt.Sprintf("reset failed state of %s", n)})
+	}
+	return &mcp.CallToolResult{Content: txtContentList}, nil, nil
+}
+
+// parseSignal accepts signal names with or without the SIG prefix and
+// signal numbers
+func parseSignal(signal string) (syscall.Signal, error) {
+	if signal == "" {
+		return syscall.SIGKILL, nil
+	}
+	if num, err := strconv.Atoi(signal); err == nil {
+		if num <= 0 || num > 64 {
+			return 0, fmt.Errorf("invalid signal number: %d", num)
+		}
+		return syscall.Signal(num), nil
+	}
+	name := strings.ToUpper(signal)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return 0, fmt.Errorf("unknown signal: %s", signal)
+	}
+	return sig, nil
+}
+
+// send a signal to the processes of a unit
+func (conn *Connection) killUnit(ctx context.Context, params *ChangeUnitStateParams) (*mcp.CallToolResult, any, error) {
+	sig, err := parseSignal(params.Signal)
+	if err != nil {
+		return nil, nil, err
+	}
+	who := params.KillWho
+	if who == "" {
+		who = "all"
+	}
+	if !slices.Contains(ValidKillWho(), who) {
+		return nil, nil, fmt.Errorf("invalid kill_who: %s", who)
+	}
+	if err := conn.dbus.KillUnitWithTarget(ctx, params.Name, sddbus.Who(who), int32(sig)); err != nil {
+		return nil, nil, fmt.Errorf("error when killing %s: %w", params.Name, err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("sent %s to %s processes of %s", unix.SignalName(sig), who, params.Name)},
+		},
+	}, nil, nil
+}
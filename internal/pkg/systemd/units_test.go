@@ -2,13 +2,19 @@ package systemd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
+	"slices"
 	"testing"
 
 	"github.com/coreos/go-systemd/v22/dbus"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockDbusConnection struct {
@@ -22,9 +28,17 @@ type mockDbusConnection struct {
 	stopUnit            func(name string, mode string) (int, error)
 	restartUnit         func(name string, mode string) (int, error)
 	reloadOrRestartUnit func(name string, mode string) (int, error)
-	killUnit            func(name string, signal int32)
+	killUnit            func(name string, who dbus.Who, signal int32) error
 	enableUnitFiles     func(files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error)
 	disableUnitFiles    func(files []string, runtime bool) ([]dbus.DisableUnitFileChange, error)
+	resetFailedUnit     func(name string) error
+	resetFailed         func() error
+	managerEnvironment  func() ([]string, error)
+	setEnvironment      func(assignments []string) error
+	unsetEnvironment    func(names []string) error
+	reload              func() error
+	// result sent on the job channel of start, stop and restart if set
+	jobResult string
 }
 
 func (m *mockDbusConnection) ListUnitsContext(ctx context.Context) ([]dbus.UnitStatus, error) {
@@ -51,6 +65,9 @@ func (m *mockDbusConnection) GetAllPropertiesContext(ctx context.Context, unitNa
 }
 
 func (m *mockDbusConnection) StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	if m.jobResult != "" {
+		ch <- m.jobResult
+	}
 	if m.startUnit != nil {
 		return m.startUnit(name, mode)
 	}
@@ -58,6 +75,9 @@ func (m *mockDbusConnection) StartUnitContext(ctx context.Context, name string,
 }
 
 func (m *mockDbusConnection) StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	if m.jobResult != "" {
+		ch <- m.jobResult
+	}
 	if m.stopUnit != nil {
 		return m.stopUnit(name, mode)
 	}
@@ -65,6 +85,9 @@ func (m *mockDbusConnection) StopUnitContext(ctx context.Context, name string, m
 }
 
 func (m *mockDbusConnection) RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	if m.jobResult != "" {
+		ch <- m.jobResult
+	}
 	if m.restartUnit != nil {
 		return m.restartUnit(name, mode)
 	}
@@ -78,10 +101,25 @@ func (m *mockDbusConnection) ReloadOrRestartUnitContext(ctx context.Context, nam
 	return 0, nil
 }
 
-func (m *mockDbusConnection) KillUnitContext(ctx context.Context, name string, signal int32) {
+func (m *mockDbusConnection) KillUnitWithTarget(ctx context.Context, name string, who dbus.Who, signal int32) error {
 	if m.killUnit != nil {
-		m.killUnit(name, signal)
+		return m.killUnit(name, who, signal)
+	}
+	return nil
+}
+
+func (m *mockDbusConnection) ResetFailedUnitContext(ctx context.Context, name string) error {
+	if m.resetFailedUnit != nil {
+		return m.resetFailedUnit(name)
+	}
+	return nil
+}
+
+func (m *mockDbusConnection) ResetFailedContext(ctx context.Context) error {
+	if m.resetFailed != nil {
+		return m.resetFailed()
 	}
+	return nil
 }
 
 func (m *mockDbusConnection) EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error) {
@@ -98,6 +136,34 @@ func (m *mockDbusConnection) DisableUnitFilesContext(ctx context.Context, files
 	return nil, nil
 }
 
+func (m *mockDbusConnection) GetManagerEnvironmentContext(ctx context.Context) ([]string, error) {
+	if m.managerEnvironment != nil {
+		return m.managerEnvironment()
+	}
+	return nil, nil
+}
+
+func (m *mockDbusConnection) SetEnvironmentContext(ctx context.Context, assignments []string) error {
+	if m.setEnvironment != nil {
+		return m.setEnvironment(assignments)
+	}
+	return nil
+}
+
+func (m *mockDbusConnection) UnsetEnvironmentContext(ctx context.Context, names []string) error {
+	if m.unsetEnvironment != nil {
+		return m.unsetEnvironment(names)
+	}
+	return nil
+}
+
+func (m *mockDbusConnection) ReloadContext(ctx context.Context) error {
+	if m.reload != nil {
+		return m.reload()
+	}
+	return nil
+}
+
 func TestListLoadedUnits(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -376,6 +442,122 @@ func TestChangeUnitState(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "reset failed of single unit",
+			params: &ChangeUnitStateParams{
+				Name:   "test.service",
+				Action: "reset_failed",
+			},
+			mockDbus: &mockDbusConnection{
+				resetFailedUnit: func(name string) error {
+					if name != "test.service" {
+						return fmt.Errorf("wrong name")
+					}
+					return nil
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "reset failed of all units",
+			params: &ChangeUnitStateParams{
+				Action: "reset_failed",
+			},
+			mockDbus: &mockDbusConnection{
+				resetFailed: func() error {
+					return nil
+				},
+				resetFailedUnit: func(name string) error {
+					return fmt.Errorf("units are reset by the manager at once")
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "reset failed error",
+			params: &ChangeUnitStateParams{
+				Name:   "test.service",
+				Action: "reset_failed",
+			},
+			mockDbus: &mockDbusConnection{
+				resetFailedUnit: func(name string) error {
+					return fmt.Errorf("unit not loaded")
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "kill defaults to SIGKILL to all processes",
+			params: &ChangeUnitStateParams{
+				Name:   "test.service",
+				Action: "stop_kill",
+			},
+			mockDbus: &mockDbusConnection{
+				killUnit: func(name string, who dbus.Who, signal int32) error {
+					if who != dbus.All || signal != 9 {
+						return fmt.Errorf("wrong target %s or signal %d", who, signal)
+					}
+					return nil
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "kill main process with SIGHUP",
+			params: &ChangeUnitStateParams{
+				Name:    "test.service",
+				Action:  "stop_kill",
+				Signal:  "hup",
+				KillWho: "main",
+			},
+			mockDbus: &mockDbusConnection{
+				killUnit: func(name string, who dbus.Who, signal int32) error {
+					if who != dbus.Main || signal != 1 {
+						return fmt.Errorf("wrong target %s or signal %d", who, signal)
+					}
+					return nil
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "kill with signal number",
+			params: &ChangeUnitStateParams{
+				Name:    "test.service",
+				Action:  "stop_kill",
+				Signal:  "10",
+				KillWho: "control",
+			},
+			mockDbus: &mockDbusConnection{
+				killUnit: func(name string, who dbus.Who, signal int32) error {
+					if who != dbus.Control || signal != 10 {
+						return fmt.Errorf("wrong target %s or signal %d", who, signal)
+					}
+					return nil
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "kill with unknown signal",
+			params: &ChangeUnitStateParams{
+				Name:   "test.service",
+				Action: "stop_kill",
+				Signal: "SIGFOO",
+			},
+			mockDbus: &mockDbusConnection{},
+			wantErr:  true,
+		},
+		{
+			name: "kill with invalid target",
+			params: &ChangeUnitStateParams{
+				Name:    "test.service",
+				Action:  "stop_kill",
+				KillWho: "children",
+			},
+			mockDbus: &mockDbusConnection{},
+			wantErr:  true,
+		},
 		{
 			name: "invalid action",
 			params: &ChangeUnitStateParams{
@@ -403,3 +585,168 @@ func TestChangeUnitState(t *testing.T) {
 		})
 	}
 }
+
+func TestResetFailedScope(t *testing.T) {
+	var reset []string
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return []dbus.UnitStatus{{Name: "sshd.service", ActiveState: "failed"}, {Name: "test.service", ActiveState: "failed"}}, nil
+			},
+			resetFailed: func() error {
+				return fmt.Errorf("the manager would reset units out of scope")
+			},
+			resetFailedUnit: func(name string) error {
+				reset = append(reset, name)
+				return nil
+			},
+		},
+		auth:  auth,
+		units: &policy.UnitAccess{Denied: []string{"sshd.service"}},
+	}
+
+	_, _, err := conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Action: "reset_failed"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test.service"}, reset)
+
+	_, _, err = conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Name: "sshd.service", Action: "reset_failed"})
+	assert.ErrorContains(t, err, "outside of the units")
+}
+
+func TestListLoadedUnitsPaging(t *testing.T) {
+	units := []dbus.UnitStatus{
+		{Name: "c.service", ActiveState: "active", SubState: "running"},
+		{Name: "a.service", ActiveState: "active", SubState: "running"},
+		{Name: "b.service", ActiveState: "active", SubState: "exited"},
+		{Name: "d.service", ActiveState: "active", SubState: "running"},
+	}
+	memory := map[string]uint64{"a.service": 10, "b.service": math.MaxUint64, "c.service": 30, "d.service": 20}
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return slices.Clone(units), nil
+			},
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				return map[string]interface{}{"MemoryCurrent": memory[unitName], "CPUUsageNSec": uint64(0)}, nil
+			},
+		},
+		auth: auth,
+	}
+	tests := []struct {
+		name   string
+		params *ListLoadedUnitsParams
+		want   []string
+	}{
+		{
+			name:   "sorted by name",
+			params: &ListLoadedUnitsParams{},
+			want:   []string{`{"state":"active","units":["a.service","b.service","c.service","d.service"]}`},
+		},
+		{
+			name:   "page",
+			params: &ListLoadedUnitsParams{Offset: 1, Limit: 2},
+			want:   []string{`{"state":"active","units":["b.service","c.service"]}`, `{"total_count":4,"offset":1,"count":2}`},
+		},
+		{
+			name:   "offset beyond the end",
+			params: &ListLoadedUnitsParams{Offset: 10, Limit: 2},
+			want:   []string{`{"total_count":4,"offset":10,"count":0}`},
+		},
+		{
+			name:   "sorted by state",
+			params: &ListLoadedUnitsParams{SortBy: "state"},
+			want:   []string{`{"state":"active","units":["b.service","a.service","c.service","d.service"]}`},
+		},
+		{
+			name:   "top memory consumers",
+			params: &ListLoadedUnitsParams{SortBy: "memory", Limit: 3},
+			want:   []string{`{"state":"active","units":["c.service","d.service","a.service"]}`, `{"total_count":4,"offset":0,"count":3}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, _, err := conn.ListLoadedUnits(context.Background(), nil, tt.params)
+			assert.NoError(t, err)
+			var got []string
+			for _, c := range res.Content {
+				got = append(got, c.(*mcp.TextContent).Text)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	_, _, err := conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{SortBy: "size"})
+	assert.Error(t, err)
+}
+
+func TestListLoadedUnitsMaxTokensHint(t *testing.T) {
+	var units []dbus.UnitStatus
+	for i := range 100 {
+		units = append(units, dbus.UnitStatus{Name: fmt.Sprintf("unit%03d.service", i), ActiveState: "active", Description: "A unit with a rather long description"})
+	}
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return slices.Clone(units), nil
+			},
+		},
+		auth: auth,
+	}
+	res, _, err := conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{IncludeDescription: true, MaxTokensHint: 200})
+	require.NoError(t, err)
+	assert.LessOrEqual(t, util.ContentTokens(res.Content), 300)
+	var shaping struct {
+		Shaping util.Shaping `json:"shaping"`
+	}
+	last := res.Content[len(res.Content)-1].(*mcp.TextContent).Text
+	require.NoError(t, json.Unmarshal([]byte(last), &shaping))
+	assert.Equal(t, []string{"include_description"}, shaping.Shaping.Reduced)
+	assert.NotZero(t, shaping.Shaping.Omitted)
+	assert.LessOrEqual(t, shaping.Shaping.EstimatedTokens, 200)
+	assert.Contains(t, res.Content[len(res.Content)-2].(*mcp.TextContent).Text, `"total_count":100`)
+
+	// fits without shaping
+	res, _, err = conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Limit: 2, MaxTokensHint: 200})
+	require.NoError(t, err)
+	assert.Len(t, res.Content, 2)
+}
+
+func TestListLoadedUnitsScope(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	listUnits := func(name string) func([]string, []string) ([]dbus.UnitStatus, error) {
+		return func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+			return []dbus.UnitStatus{{Name: name, ActiveState: "active"}}, nil
+		}
+	}
+	conn := &Connection{
+		manager: "system",
+		dbus:    &mockDbusConnection{listUnitsByPatterns: listUnits("sshd.service")},
+		auth:    auth,
+	}
+	_, _, err := conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Scope: "both"})
+	assert.ErrorContains(t, err, "no connection to the user manager")
+
+	conn.SetUserConnection(&Connection{
+		manager: "user",
+		dbus:    &mockDbusConnection{listUnitsByPatterns: listUnits("pipewire.service")},
+	})
+	res, _, err := conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Scope: "both"})
+	require.NoError(t, err)
+	require.Len(t, res.Content, 2)
+	assert.Equal(t, `{"manager":"system","state":"active","units":["sshd.service"]}`, res.Content[0].(*mcp.TextContent).Text)
+	assert.Equal(t, `{"manager":"user","state":"active","units":["pipewire.service"]}`, res.Content[1].(*mcp.TextContent).Text)
+
+	// a single manager isn't tagged
+	res, _, err = conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Scope: "user"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"state":"active","units":["pipewire.service"]}`, res.Content[0].(*mcp.TextContent).Text)
+
+	res, _, err = conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Scope: "both", Verbose: true})
+	require.NoError(t, err)
+	assert.Contains(t, res.Content[1].(*mcp.TextContent).Text, `"Manager":"user"`)
+
+	_, _, err = conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Scope: "session"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,282 @@
+package systemd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+const journalUploadUnit = "systemd-journal-upload.service"
+
+var (
+	// journal-upload.conf and its drop-in directory are below this directory
+	uploadConfRoot = "/etc/systemd"
+	// systemd-journal-upload stores the cursor of the last uploaded entry here
+	uploadStateFile = "/var/lib/systemd/journal-upload/state"
+)
+
+// name of the drop-in which is written by the journal_upload tool
+const uploadDropIn = "50-systemd-mcp.conf"
+
+type JournalUploadParams struct {
+	URL                    string `json:"url,omitempty" jsonschema:"URL of the systemd-journal-remote collector, e.g. https://loghost:19532. Without it only the upload health is reported."`
+	ServerKeyFile          string `json:"server_key_file,omitempty" jsonschema:"Absolute path of the SSL key of this host in PEM format."`
+	ServerCertificateFile  string `json:"server_certificate_file,omitempty" jsonschema:"Absolute path of the SSL certificate of this host in PEM format."`
+	TrustedCertificateFile string `json:"trusted_certificate_file,omitempty" jsonschema:"Absolute path of the CA certificate the collector certificate is checked against."`
+	Lines                  int    `json:"lines,omitempty" jsonschema:"Number of journal lines of systemd-journal-upload to attach. Set to -1 to omit the log."`
+}
+
+type JournalUploadConfig struct {
+	URL                    string `json:"url,omitempty"`
+	ServerKeyFile          string `json:"server_key_file,omitempty"`
+	ServerCertificateFile  string `json:"server_certificate_file,omitempty"`
+	TrustedCertificateFile string `json:"trusted_certificate_file,omitempty"`
+}
+
+type JournalUploadResult struct {
+	Config        JournalUploadConfig `json:"config"`
+	Configured    bool                `json:"configured"`
+	UnitFileState string              `json:"unit_file_state,omitempty"`
+	ActiveState   string              `json:"active_state,omitempty"`
+	SubState      string              `json:"sub_state,omitempty"`
+	Result        string              `json:"result,omitempty"`
+	// cursor of the last entry the collector accepted
+	LastCursor string    `json:"last_cursor,omitempty"`
+	LastUpload time.Time `json:"last_upload,omitzero"`
+	Healthy    bool      `json:"healthy"`
+	Changed    bool      `json:"changed,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	RolledBack []string  `json:"rolled_back,omitempty"`
+	Log        []string  `json:"log,omitempty"`
+	LogError   string    `json:"log_error,omitempty"`
+}
+
+func CreateJournalUploadSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[JournalUploadParams](nil)
+	inputSchema.Properties["lines"].Default = json.RawMessage(fmt.Sprint(DefaultFailedLogLines))
+	return inputSchema
+}
+
+func (params *JournalUploadParams) validate() error {
+	u, err := url.Parse(params.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid collector url %q, must be a http or https url", params.URL)
+	}
+	for _, file := range []string{params.ServerKeyFile, params.ServerCertificateFile, params.TrustedCertificateFile} {
+		if file == "" {
+			continue
+		}
+		if !filepath.IsAbs(file) {
+			return fmt.Errorf("certificate file %q must be an absolute path", file)
+		}
+		if _, err := os.Stat(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadDropInContent renders the [Upload] section for the parameters
+func (params *JournalUploadParams) uploadDropInContent() string {
+	var sb strings.Builder
+	sb.WriteString("# written by systemd-mcp\n[Upload]\n")
+	fmt.Fprintf(&sb, "URL=%s\n", params.URL)
+	for _, setting := range []struct{ key, val string }{
+		{"ServerKeyFile", params.ServerKeyFile},
+		{"ServerCertificateFile", params.ServerCertificateFile},
+		{"TrustedCertificateFile", params.TrustedCertificateFile},
+	} {
+		if setting.val != "" {
+			fmt.Fprintf(&sb, "%s=%s\n", setting.key, setting.val)
+		}
+	}
+	return sb.String()
+}
+
+// readUploadConfig merges journal-upload.conf and its drop-ins in the order
+// systemd-journal-upload reads them, later settings win
+func readUploadConfig() (JournalUploadConfig, error) {
+	var config JournalUploadConfig
+	files := []string{filepath.Join(uploadConfRoot, "journal-upload.conf")}
+	dropins, err := filepath.Glob(filepath.Join(uploadConfRoot, "journal-upload.conf.d", "*.conf"))
+	if err != nil {
+		return config, err
+	}
+	files = append(files, dropins...)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return config, err
+		}
+		section := ""
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "[") {
+				section = strings.Trim(line, "[]")
+				continue
+			}
+			key, val, ok := strings.Cut(line, "=")
+			if !ok || section != "Upload" {
+				continue
+			}
+			val = strings.TrimSpace(val)
+			switch strings.TrimSpace(key) {
+			case "URL":
+				config.URL = val
+			case "ServerKeyFile":
+				config.ServerKeyFile = val
+			case "ServerCertificateFile":
+				config.ServerCertificateFile = val
+			case "TrustedCertificateFile":
+				config.TrustedCertificateFile = val
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// uploadHealth fills the state of the service and of the last upload
+func (conn *Connection) uploadHealth(ctx context.Context, res *JournalUploadResult, lines int) error {
+	var err error
+	if res.Config, err = readUploadConfig(); err != nil {
+		return fmt.Errorf("couldn't read the upload configuration: %w", err)
+	}
+	res.Configured = res.Config.URL != ""
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, journalUploadUnit)
+	if err != nil {
+		return fmt.Errorf("couldn't get state of %s: %w", journalUploadUnit, err)
+	}
+	res.UnitFileState, _ = props["UnitFileState"].(string)
+	res.ActiveState, _ = props["ActiveState"].(string)
+	res.SubState, _ = props["SubState"].(string)
+	res.Result, _ = props["Result"].(string)
+	if info, err := os.Stat(uploadStateFile); err == nil {
+		res.LastUpload = info.ModTime()
+		if state, err := os.ReadFile(uploadStateFile); err == nil {
+			for _, line := range strings.Split(string(state), "\n") {
+				if cursor, ok := strings.CutPrefix(line, "LAST_CURSOR="); ok {
+					res.LastCursor = cursor
+				}
+			}
+		}
+	}
+	res.Healthy = res.Configured && res.ActiveState == "active" && res.Result == "success"
+	if conn.log != nil && lines > 0 {
+		if res.Log, err = conn.log.UnitLog(ctx, journalUploadUnit, lines); err != nil {
+			res.LogError = err.Error()
+		}
+	}
+	return nil
+}
+
+// JournalUpload reports if the journal is uploaded to a collector and, if a
+// collector url is given, configures systemd-journal-upload for it, enables
+// and restarts it. If a step fails the already applied steps are reverted.
+func (conn *Connection) JournalUpload(ctx context.Context, req *mcp.CallToolRequest, params *JournalUploadParams) (*mcp.CallToolResult, any, error) {
+	lines := params.Lines
+	if lines == 0 {
+		lines = DefaultFailedLogLines
+	}
+	res := JournalUploadResult{}
+	if params.URL == "" {
+		if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+			return nil, nil, err
+		} else if !allowed {
+			return nil, nil, fmt.Errorf("calling method was canceled by user")
+		}
+	} else {
+		if err := params.validate(); err != nil {
+			return nil, nil, err
+		}
+		allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.FilesWriteAction))
+		if !allowed || err != nil {
+			slog.Debug("JournalUpload wasn't authorized", "reason", err)
+			return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+		}
+		defer conn.auth.Deauthorize()
+
+		path := filepath.Join(uploadConfRoot, "journal-upload.conf.d", uploadDropIn)
+		current, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+		props, err := conn.dbus.GetAllPropertiesContext(ctx, journalUploadUnit)
+		if err != nil {
+			return nil, nil, fmt.Errorf("couldn't get state of %s: %w", journalUploadUnit, err)
+		}
+		unitFileState, _ := props["UnitFileState"].(string)
+		if unitFileState == "" || unitFileState == "not-found" {
+			return nil, nil, fmt.Errorf("%s isn't installed", journalUploadUnit)
+		}
+		activeState, _ := props["ActiveState"].(string)
+		content := params.uploadDropInContent()
+		steps := []step{{
+			desc: "write upload configuration " + path,
+			do:   func() error { return writeFileOrRemove(path, content) },
+			undo: func() error { return writeFileOrRemove(path, string(current)) },
+		}}
+		if !isEnabled(unitFileState) {
+			steps = append(steps, step{
+				desc: "enable " + journalUploadUnit,
+				do:   func() error { return conn.setEnabled(ctx, journalUploadUnit, true) },
+				undo: func() error { return conn.setEnabled(ctx, journalUploadUnit, false) },
+			})
+		}
+		// the configuration is only read on startup
+		steps = append(steps, step{
+			desc: "restart " + journalUploadUnit,
+			do: func() error {
+				return conn.waitJob(ctx, func(ch chan<- string) (int, error) {
+					return conn.dbus.RestartUnitContext(ctx, journalUploadUnit, "replace", ch)
+				})
+			},
+			undo: func() error {
+				if isActive(activeState) {
+					return conn.waitJob(ctx, func(ch chan<- string) (int, error) {
+						return conn.dbus.RestartUnitContext(ctx, journalUploadUnit, "replace", ch)
+					})
+				}
+				return conn.setActive(ctx, journalUploadUnit, false)
+			},
+		})
+		res.RolledBack, err = runSteps(steps)
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.Changed = true
+		}
+	}
+	if err := conn.uploadHealth(ctx, &res, lines); err != nil {
+		return nil, nil, err
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,118 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupUpload(t *testing.T) {
+	uploadConfRoot = t.TempDir()
+	uploadStateFile = filepath.Join(t.TempDir(), "state")
+	require.NoError(t, os.WriteFile(filepath.Join(uploadConfRoot, "journal-upload.conf"),
+		[]byte("[Upload]\n# URL=\nTrustedCertificateFile=/etc/ssl/ca.pem\n"), 0644))
+}
+
+func uploadResult(t *testing.T, res *mcp.CallToolResult) JournalUploadResult {
+	var result JournalUploadResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+	return result
+}
+
+func TestJournalUpload(t *testing.T) {
+	setupUpload(t)
+	var calls []string
+	props := map[string]interface{}{"UnitFileState": "disabled", "ActiveState": "inactive", "SubState": "dead", "Result": "success"}
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	mock := &mockDbusConnection{
+		getAllProperties: func(unitName string) (map[string]interface{}, error) {
+			return props, nil
+		},
+		enableUnitFiles: func(files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error) {
+			calls = append(calls, "enable "+files[0])
+			return false, nil, nil
+		},
+		disableUnitFiles: func(files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
+			calls = append(calls, "disable "+files[0])
+			return nil, nil
+		},
+		restartUnit: func(name string, mode string) (int, error) {
+			calls = append(calls, "restart "+name)
+			return 1, nil
+		},
+		jobResult: "done",
+	}
+	conn := &Connection{dbus: mock, auth: auth, log: &mockLogReader{lines: map[string][]string{journalUploadUnit: {"upload line"}}}}
+
+	res, _, err := conn.JournalUpload(context.Background(), nil, &JournalUploadParams{})
+	require.NoError(t, err)
+	result := uploadResult(t, res)
+	assert.False(t, result.Configured)
+	assert.False(t, result.Healthy)
+	assert.Equal(t, "/etc/ssl/ca.pem", result.Config.TrustedCertificateFile)
+	assert.Equal(t, []string{"upload line"}, result.Log)
+	assert.Empty(t, calls)
+
+	cert := filepath.Join(t.TempDir(), "cert.pem")
+	require.NoError(t, os.WriteFile(cert, []byte("cert"), 0644))
+	params := &JournalUploadParams{URL: "https://loghost:19532", ServerCertificateFile: cert}
+	res, _, err = conn.JournalUpload(context.Background(), nil, params)
+	require.NoError(t, err)
+	result = uploadResult(t, res)
+	assert.True(t, result.Changed)
+	assert.True(t, result.Configured)
+	assert.Equal(t, "https://loghost:19532", result.Config.URL)
+	assert.Equal(t, cert, result.Config.ServerCertificateFile)
+	assert.Equal(t, "/etc/ssl/ca.pem", result.Config.TrustedCertificateFile)
+	assert.Equal(t, []string{"enable " + journalUploadUnit, "restart " + journalUploadUnit}, calls)
+
+	require.NoError(t, os.WriteFile(uploadStateFile, []byte("# This is private data.\nLAST_CURSOR=s=abc;i=1\n"), 0644))
+	props["UnitFileState"], props["ActiveState"] = "enabled", "active"
+	res, _, err = conn.JournalUpload(context.Background(), nil, &JournalUploadParams{Lines: -1})
+	require.NoError(t, err)
+	result = uploadResult(t, res)
+	assert.True(t, result.Healthy)
+	assert.Equal(t, "s=abc;i=1", result.LastCursor)
+	assert.False(t, result.LastUpload.IsZero())
+	assert.Nil(t, result.Log)
+
+	// a failing restart restores the old configuration
+	calls = nil
+	mock.restartUnit = func(name string, mode string) (int, error) {
+		calls = append(calls, "restart "+name)
+		if len(calls) == 1 {
+			return 0, fmt.Errorf("restart failed")
+		}
+		return 1, nil
+	}
+	res, _, err = conn.JournalUpload(context.Background(), nil, &JournalUploadParams{URL: "http://other:19532"})
+	require.NoError(t, err)
+	result = uploadResult(t, res)
+	assert.False(t, result.Changed)
+	assert.Contains(t, result.Error, "restart failed")
+	assert.Equal(t, "https://loghost:19532", result.Config.URL)
+
+	for _, invalid := range []*JournalUploadParams{
+		{URL: "loghost"},
+		{URL: "ftp://loghost"},
+		{URL: "https://loghost", ServerKeyFile: "key.pem"},
+		{URL: "https://loghost", ServerKeyFile: "/nonexistent/key.pem"},
+	} {
+		_, _, err = conn.JournalUpload(context.Background(), nil, invalid)
+		assert.Error(t, err, invalid.URL)
+	}
+
+	readOnly, _ := auth_pkg.NewNoAuth(true, false)
+	conn.auth = readOnly
+	_, _, err = conn.JournalUpload(context.Background(), nil, params)
+	assert.Error(t, err)
+}
@@ -0,0 +1,106 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// number of journal lines attached to a failure notification
+const watchLogLines = 5
+
+// unitSubscriber is implemented by the connection to systemd, it delivers
+// the changes of the sub state and the properties of all units
+type unitSubscriber interface {
+	Subscribe() error
+	SetSubStateSubscriber(updateCh chan<- *dbus.SubStateUpdate, errCh chan<- error)
+	SetPropertiesSubscriber(updateCh chan<- *dbus.PropertiesUpdate, errCh chan<- error)
+}
+
+// subscribe subscribes the connection to the unit change signals, systemd
+// refuses a second subscription of a client so it's done once
+func (conn *Connection) subscribe() (unitSubscriber, error) {
+	sub, ok := conn.dbus.(unitSubscriber)
+	if !ok {
+		return nil, fmt.Errorf("connection doesn't support unit change signals")
+	}
+	conn.subscribeOnce.Do(func() {
+		if err := sub.Subscribe(); err != nil {
+			conn.subscribeErr = fmt.Errorf("failed to subscribe to unit changes: %w", err)
+		}
+	})
+	return sub, conn.subscribeErr
+}
+
+// WatchFailed sends a log message of level error to every session of the
+// server when a unit matching one of the patterns enters the failed state,
+// until the context is canceled. The message carries the same data as an
+// entry of failed_units. Clients only get the messages after they set a log
+// level.
+func (conn *Connection) WatchFailed(ctx context.Context, server *mcp.Server, patterns []string) error {
+	sub, err := conn.subscribe()
+	if err != nil {
+		return err
+	}
+	updates := make(chan *dbus.SubStateUpdate, 256)
+	errs := make(chan error, 16)
+	sub.SetSubStateSubscriber(updates, errs)
+	slog.Info("watching for failed units", "patterns", patterns)
+	conn.watchFailed(ctx, updates, errs, patterns, func(failed FailedUnit) {
+		for session := range server.Sessions() {
+			if err := session.Log(ctx, &mcp.LoggingMessageParams{
+				Logger: "failed_units",
+				Level:  "error",
+				Data:   failed,
+			}); err != nil {
+				slog.Debug("failed to notify session", "session", session.ID(), "error", err)
+			}
+		}
+	})
+	return nil
+}
+
+// watchFailed calls notify for every transition of a matching unit into
+// the failed state
+func (conn *Connection) watchFailed(ctx context.Context, updates <-chan *dbus.SubStateUpdate, errs <-chan error, patterns []string, notify func(FailedUnit)) {
+	// sub state changes are signaled for every changed property of a
+	// unit, so only transitions are reported
+	states := make(map[string]string)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-errs:
+			slog.Warn("error while watching units", "error", err)
+		case update := <-updates:
+			prev := states[update.UnitName]
+			states[update.UnitName] = update.SubState
+			if update.SubState != "failed" || prev == "failed" || !matchAny(patterns, update.UnitName) {
+				continue
+			}
+			units, err := conn.dbus.ListUnitsByPatternsContext(ctx, nil, []string{update.UnitName})
+			if err != nil || len(units) == 0 {
+				units = []dbus.UnitStatus{{Name: update.UnitName, SubState: update.SubState}}
+			}
+			notify(conn.failedUnit(ctx, units[0], unitOwners(), watchLogLines))
+		}
+	}
+}
+
+// matchAny reports if the name matches one of the patterns, no patterns
+// match every name
+func matchAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pat := range patterns {
+		if match, _ := path.Match(pat, name); match {
+			return true
+		}
+	}
+	return false
+}
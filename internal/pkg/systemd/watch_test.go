@@ -0,0 +1,64 @@
+package systemd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchFailed(t *testing.T) {
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return []dbus.UnitStatus{{Name: patterns[0], LoadState: "loaded", SubState: "failed"}}, nil
+			},
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				return map[string]interface{}{"Result": "exit-code"}, nil
+			},
+		},
+		log: &mockLogReader{lines: map[string][]string{"nginx.service": {"bind failed"}}},
+	}
+	updates := make(chan *dbus.SubStateUpdate)
+	errs := make(chan error)
+	notified := make(chan FailedUnit, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		conn.watchFailed(ctx, updates, errs, []string{"nginx*"}, func(failed FailedUnit) {
+			notified <- failed
+		})
+		close(done)
+	}()
+
+	for _, update := range []dbus.SubStateUpdate{
+		{UnitName: "nginx.service", SubState: "running"},
+		{UnitName: "sshd.service", SubState: "failed"},
+		{UnitName: "nginx.service", SubState: "failed"},
+		// repeated signals of a failed unit aren't reported again
+		{UnitName: "nginx.service", SubState: "failed"},
+	} {
+		updates <- &update
+	}
+	cancel()
+	<-done
+
+	require.Len(t, notified, 1)
+	failed := <-notified
+	assert.Equal(t, "nginx.service", failed.Name)
+	assert.Equal(t, "exit-code", failed.Result)
+	assert.Equal(t, []string{"bind failed"}, failed.Log)
+}
+
+func TestMatchAny(t *testing.T) {
+	assert.True(t, matchAny(nil, "nginx.service"))
+	assert.True(t, matchAny([]string{"*"}, "nginx.service"))
+	assert.False(t, matchAny([]string{"*.timer"}, "nginx.service"))
+}
+
+func TestWatchFailedUnsupported(t *testing.T) {
+	conn := &Connection{dbus: &mockDbusConnection{}}
+	assert.Error(t, conn.WatchFailed(context.Background(), nil, nil))
+}
@@ -0,0 +1,263 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+type WhyNotRunningParams struct {
+	Name  string `json:"name" jsonschema:"Exact name of the unit."`
+	Lines int    `json:"lines,omitempty" jsonschema:"Number of journal lines of the current boot to attach. Set to -1 to omit the log."`
+}
+
+// a condition or assert as reported in the Conditions and Asserts
+// properties
+type ConditionCheck struct {
+	Type      string `json:"type"`
+	Parameter string `json:"parameter"`
+	Trigger   bool   `json:"trigger,omitempty"`
+	Negate    bool   `json:"negate,omitempty"`
+	// >0 passed, <0 failed and 0 not checked
+	State int32 `json:"state"`
+}
+
+func (c ConditionCheck) String() string {
+	var b strings.Builder
+	b.WriteString(c.Type + "=")
+	if c.Trigger {
+		b.WriteString("|")
+	}
+	if c.Negate {
+		b.WriteString("!")
+	}
+	b.WriteString(c.Parameter)
+	return b.String()
+}
+
+type Reason struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+type WhyNotRunningResult struct {
+	Name        string     `json:"name"`
+	LoadState   string     `json:"load_state"`
+	ActiveState string     `json:"active_state"`
+	SubState    string     `json:"sub_state"`
+	Running     bool       `json:"running"`
+	Reasons     []Reason   `json:"reasons"`
+	JobResults  []string   `json:"job_results,omitempty"`
+	Owner       *UnitOwner `json:"owner,omitempty"`
+	HasRunbook  bool       `json:"has_runbook,omitempty"`
+	Log         []string   `json:"log,omitempty"`
+	LogError    string     `json:"log_error,omitempty"`
+}
+
+// properties which explain why a unit isn't running
+type whyNotProperties struct {
+	LoadState              string           `json:"LoadState"`
+	ActiveState            string           `json:"ActiveState"`
+	SubState               string           `json:"SubState"`
+	UnitFileState          string           `json:"UnitFileState"`
+	Result                 string           `json:"Result"`
+	ExecMainCode           int32            `json:"ExecMainCode"`
+	ExecMainStatus         int32            `json:"ExecMainStatus"`
+	ConditionResult        bool             `json:"ConditionResult"`
+	ConditionTimestamp     uint64           `json:"ConditionTimestamp"`
+	AssertResult           bool             `json:"AssertResult"`
+	AssertTimestamp        uint64           `json:"AssertTimestamp"`
+	StartLimitBurst        uint32           `json:"StartLimitBurst"`
+	StartLimitIntervalUSec uint64           `json:"StartLimitIntervalUSec"`
+	Requires               []string         `json:"Requires"`
+	Requisite              []string         `json:"Requisite"`
+	BindsTo                []string         `json:"BindsTo"`
+	Conditions             []ConditionCheck `json:"-"`
+	Asserts                []ConditionCheck `json:"-"`
+	LoadError              string           `json:"-"`
+	JobID                  uint32           `json:"-"`
+}
+
+func CreateWhyNotRunningSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[WhyNotRunningParams](nil)
+	inputSchema.Properties["lines"].Default = json.RawMessage(fmt.Sprint(DefaultFailedLogLines))
+	return inputSchema
+}
+
+// conditions are a(sbbsi)
+func conditionChecks(val any) (checks []ConditionCheck) {
+	list, _ := val.([][]interface{})
+	for _, entry := range list {
+		if len(entry) != 5 {
+			continue
+		}
+		c := ConditionCheck{}
+		c.Type, _ = entry[0].(string)
+		c.Trigger, _ = entry[1].(bool)
+		c.Negate, _ = entry[2].(bool)
+		c.Parameter, _ = entry[3].(string)
+		c.State, _ = entry[4].(int32)
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+func parseWhyNotProperties(props map[string]interface{}) whyNotProperties {
+	prop := whyNotProperties{}
+	tmp, _ := json.Marshal(props)
+	if err := json.Unmarshal(tmp, &prop); err != nil {
+		slog.Warn("failed to unmarshal properties", "error", err)
+	}
+	prop.Conditions = conditionChecks(props["Conditions"])
+	prop.Asserts = conditionChecks(props["Asserts"])
+	// LoadError is (ss), the name of the error and the message
+	if loadErr, ok := props["LoadError"].([]interface{}); ok && len(loadErr) == 2 {
+		prop.LoadError, _ = loadErr[1].(string)
+	}
+	// Job is (uo), the id is 0 without a pending job
+	if job, ok := props["Job"].([]interface{}); ok && len(job) == 2 {
+		prop.JobID, _ = job[0].(uint32)
+	}
+	return prop
+}
+
+// explainNotRunning returns the reasons why systemd doesn't start the unit,
+// failedDeps are the required units which are in the failed state
+func explainNotRunning(name string, prop whyNotProperties, failedDeps []string) []Reason {
+	reasons := []Reason{}
+	switch prop.LoadState {
+	case "not-found":
+		return append(reasons, Reason{"not-found", fmt.Sprintf("no unit file for %s was found", name)})
+	case "masked":
+		return append(reasons, Reason{"masked", fmt.Sprintf("%s is masked and can't be started until it is unmasked", name)})
+	case "error", "bad-setting":
+		msg := fmt.Sprintf("%s couldn't be loaded", name)
+		if prop.LoadError != "" {
+			msg += ": " + prop.LoadError
+		}
+		return append(reasons, Reason{"load-error", msg})
+	}
+	if prop.ActiveState == "active" || prop.ActiveState == "reloading" {
+		return append(reasons, Reason{"running", fmt.Sprintf("%s is %s (%s)", name, prop.ActiveState, prop.SubState)})
+	}
+	if prop.Result == "start-limit-hit" {
+		reasons = append(reasons, Reason{"start-limit-hit", fmt.Sprintf("%s was started more than %d times within %s and is refused until the rate limit is reset with the 'reset_failed' action",
+			name, prop.StartLimitBurst, time.Duration(prop.StartLimitIntervalUSec)*time.Microsecond)})
+	}
+	if !prop.ConditionResult && prop.ConditionTimestamp != 0 {
+		var failed []string
+		for _, c := range prop.Conditions {
+			if c.State < 0 {
+				failed = append(failed, c.String())
+			}
+		}
+		reasons = append(reasons, Reason{"condition", fmt.Sprintf("the start was skipped because of unmet conditions: %s", strings.Join(failed, " "))})
+	}
+	if !prop.AssertResult && prop.AssertTimestamp != 0 {
+		var failed []string
+		for _, c := range prop.Asserts {
+			if c.State < 0 {
+				failed = append(failed, c.String())
+			}
+		}
+		reasons = append(reasons, Reason{"assert", fmt.Sprintf("the start failed because of unmet asserts: %s", strings.Join(failed, " "))})
+	}
+	for _, dep := range failedDeps {
+		reasons = append(reasons, Reason{"dependency", fmt.Sprintf("the required unit %s failed", dep)})
+	}
+	if prop.JobID != 0 {
+		reasons = append(reasons, Reason{"job-pending", fmt.Sprintf("job %d for %s is still waiting, e.g. for its dependencies", prop.JobID, name)})
+	}
+	if prop.Result != "" && prop.Result != "success" && prop.Result != "start-limit-hit" {
+		msg := fmt.Sprintf("the last run ended with result '%s'", prop.Result)
+		if code := execMainCodeName(prop.ExecMainCode); code != "" {
+			msg += fmt.Sprintf(", main process %s with status %d", code, prop.ExecMainStatus)
+		}
+		reasons = append(reasons, Reason{"result", msg})
+	}
+	if len(reasons) == 0 {
+		msg := fmt.Sprintf("%s is %s and was not started", name, prop.ActiveState)
+		if prop.UnitFileState == "disabled" {
+			msg += ", it is disabled so it isn't started at boot"
+		}
+		reasons = append(reasons, Reason{"inactive", msg})
+	}
+	return reasons
+}
+
+// WhyNotRunning explains why systemd doesn't start or refuses to start the
+// unit by inspecting the load state, conditions, asserts, the start rate limit,
+// the required units and the recent job results.
+func (conn *Connection) WhyNotRunning(ctx context.Context, req *mcp.CallToolRequest, params *WhyNotRunningParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.UnitsReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	if params.Name == "" {
+		return nil, nil, fmt.Errorf("unit name is required")
+	}
+	if err := conn.units.Check(params.Name); err != nil {
+		return nil, nil, err
+	}
+	lines := params.Lines
+	if lines == 0 {
+		lines = DefaultFailedLogLines
+	}
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, params.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	prop := parseWhyNotProperties(props)
+
+	var failedDeps []string
+	deps := slices.Concat(prop.Requires, prop.Requisite, prop.BindsTo)
+	if len(deps) > 0 {
+		units, err := conn.dbus.ListUnitsByPatternsContext(ctx, []string{"failed"}, deps)
+		if err != nil {
+			slog.Warn("failed to get state of dependencies", "unit", params.Name, "error", err)
+		}
+		for _, u := range units {
+			failedDeps = append(failedDeps, u.Name)
+		}
+	}
+
+	res := WhyNotRunningResult{
+		Name:        params.Name,
+		LoadState:   prop.LoadState,
+		ActiveState: prop.ActiveState,
+		SubState:    prop.SubState,
+		Running:     prop.ActiveState == "active" || prop.ActiveState == "reloading",
+		Reasons:     explainNotRunning(params.Name, prop, failedDeps),
+		Owner:       unitOwners().Lookup(params.Name),
+		HasRunbook:  hasRunbook(params.Name),
+	}
+	if conn.log != nil && lines > 0 {
+		if res.JobResults, err = conn.log.UnitJobResults(ctx, params.Name, lines); err != nil {
+			res.LogError = err.Error()
+		}
+		if res.Log, err = conn.log.UnitLog(ctx, params.Name, lines); err != nil {
+			res.LogError = err.Error()
+		}
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
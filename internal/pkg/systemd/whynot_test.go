@@ -0,0 +1,125 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainNotRunning(t *testing.T) {
+	tests := []struct {
+		name       string
+		props      map[string]interface{}
+		failedDeps []string
+		wantKinds  []string
+		contains   string
+	}{
+		{
+			name:      "masked",
+			props:     map[string]interface{}{"LoadState": "masked", "ActiveState": "inactive"},
+			wantKinds: []string{"masked"},
+		},
+		{
+			name: "load error",
+			props: map[string]interface{}{"LoadState": "bad-setting", "ActiveState": "inactive",
+				"LoadError": []interface{}{"org.freedesktop.systemd1.BadUnitSetting", "Unit has a bad unit file setting."}},
+			wantKinds: []string{"load-error"},
+			contains:  "bad unit file setting",
+		},
+		{
+			name:      "running",
+			props:     map[string]interface{}{"LoadState": "loaded", "ActiveState": "active", "SubState": "running"},
+			wantKinds: []string{"running"},
+		},
+		{
+			name: "start limit hit",
+			props: map[string]interface{}{"LoadState": "loaded", "ActiveState": "failed", "Result": "start-limit-hit",
+				"StartLimitBurst": uint32(5), "StartLimitIntervalUSec": uint64(10000000), "ConditionResult": true, "AssertResult": true},
+			wantKinds: []string{"start-limit-hit"},
+			contains:  "5 times within 10s",
+		},
+		{
+			name: "unmet condition",
+			props: map[string]interface{}{"LoadState": "loaded", "ActiveState": "inactive", "Result": "success",
+				"ConditionResult": false, "ConditionTimestamp": uint64(1), "AssertResult": true,
+				"Conditions": [][]interface{}{
+					{"ConditionPathExists", false, true, "/etc/foo", int32(-1)},
+					{"ConditionVirtualization", false, false, "vm", int32(1)},
+				}},
+			wantKinds: []string{"condition"},
+			contains:  "ConditionPathExists=!/etc/foo",
+		},
+		{
+			name: "failed dependency and exit code",
+			props: map[string]interface{}{"LoadState": "loaded", "ActiveState": "failed", "Result": "exit-code",
+				"ExecMainCode": int32(1), "ExecMainStatus": int32(2), "ConditionResult": true, "AssertResult": true},
+			failedDeps: []string{"db.service"},
+			wantKinds:  []string{"dependency", "result"},
+			contains:   "exited with status 2",
+		},
+		{
+			name: "disabled",
+			props: map[string]interface{}{"LoadState": "loaded", "ActiveState": "inactive", "UnitFileState": "disabled",
+				"ConditionResult": true, "AssertResult": true},
+			wantKinds: []string{"inactive"},
+			contains:  "disabled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasons := explainNotRunning("test.service", parseWhyNotProperties(tt.props), tt.failedDeps)
+			var kinds []string
+			var messages string
+			for _, r := range reasons {
+				kinds = append(kinds, r.Kind)
+				messages += r.Message + "\n"
+			}
+			assert.Equal(t, tt.wantKinds, kinds)
+			assert.Contains(t, messages, tt.contains)
+		})
+	}
+}
+
+func TestWhyNotRunning(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				return map[string]interface{}{"LoadState": "loaded", "ActiveState": "inactive",
+					"ConditionResult": true, "AssertResult": true, "Requires": []string{"db.service"},
+					"Job": []interface{}{uint32(42), "/org/freedesktop/systemd1/job/42"}}, nil
+			},
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return []dbus.UnitStatus{}, nil
+			},
+		},
+		auth: auth,
+		log: &mockLogReader{
+			lines: map[string][]string{"test.service": {"line"}},
+			jobs:  map[string][]string{"test.service": {"Oct 15 10:00:00 start job: dependency"}},
+		},
+	}
+	res, _, err := conn.WhyNotRunning(context.Background(), nil, &WhyNotRunningParams{Name: "test.service"})
+	require.NoError(t, err)
+	var result WhyNotRunningResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+	assert.False(t, result.Running)
+	require.Len(t, result.Reasons, 1)
+	assert.Equal(t, "job-pending", result.Reasons[0].Kind)
+	assert.Equal(t, []string{"Oct 15 10:00:00 start job: dependency"}, result.JobResults)
+	assert.Equal(t, []string{"line"}, result.Log)
+
+	_, _, err = conn.WhyNotRunning(context.Background(), nil, &WhyNotRunningParams{})
+	assert.Error(t, err)
+
+	conn.units = &policy.UnitAccess{Denied: []string{"sshd.service"}}
+	_, _, err = conn.WhyNotRunning(context.Background(), nil, &WhyNotRunningParams{Name: "sshd.service"})
+	assert.ErrorContains(t, err, "outside of the units")
+}
@@ -0,0 +1,279 @@
+package sysusers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+)
+
+// directories of the sysusers.d files, a file of an earlier directory
+// overrides the files with the same name of the later ones
+var configDirs = []string{"/etc/sysusers.d", "/run/sysusers.d", "/usr/local/lib/sysusers.d", "/usr/lib/sysusers.d"}
+
+var sysusersBin = "systemd-sysusers"
+
+// replaced by the tests
+var (
+	lookupUser  = user.Lookup
+	lookupGroup = user.LookupGroup
+)
+
+type Sysusers struct {
+	Auth auth.AuthKeeper
+}
+
+type ListSysusersParams struct {
+	Name    string `json:"name,omitempty" jsonschema:"Only the entries of this user or group."`
+	Missing bool   `json:"missing,omitempty" jsonschema:"Only the entries whose user or group doesn't exist yet."`
+}
+
+type Entry struct {
+	// u, g, m or r
+	Type  string `json:"type"`
+	Name  string `json:"name,omitempty"`
+	ID    string `json:"id,omitempty"`
+	GECOS string `json:"gecos,omitempty"`
+	Home  string `json:"home,omitempty"`
+	Shell string `json:"shell,omitempty"`
+	File  string `json:"file"`
+	// whether the user or group exists, unset for the m and r lines
+	Exists *bool `json:"exists,omitempty"`
+}
+
+type ListSysusersResult struct {
+	Entries []Entry `json:"entries"`
+	// the users and groups which applying the entries would create
+	Missing []string `json:"missing,omitempty"`
+}
+
+type ApplySysusersParams struct {
+	Config string `json:"config,omitempty" jsonschema:"Only apply this sysusers.d file, e.g. 'nginx.conf'. All files are applied if not set."`
+	DryRun bool   `json:"dry_run,omitempty" jsonschema:"Only show what would be created."`
+}
+
+func CreateListSysusersSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ListSysusersParams](nil)
+	return inputSchema
+}
+
+func CreateApplySysusersSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ApplySysusersParams](nil)
+	return inputSchema
+}
+
+// configFiles returns the effective files by name, files linked to
+// /dev/null mask the files of the later directories
+func configFiles(dirs []string) []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.conf"))
+		for _, file := range matches {
+			name := filepath.Base(file)
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if target, err := os.Readlink(file); err == nil && target == os.DevNull {
+				continue
+			}
+			files = append(files, file)
+		}
+	}
+	slices.SortFunc(files, func(a, b string) int {
+		return strings.Compare(filepath.Base(a), filepath.Base(b))
+	})
+	return files
+}
+
+// splitFields splits a line of a sysusers.d file, fields may be quoted
+func splitFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	var quote rune
+	inField := false
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			field.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// parseFile returns the entries of a sysusers.d file, "-" is an unset field
+func parseFile(file string) ([]Entry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitFields(line)
+		for len(fields) < 6 {
+			fields = append(fields, "-")
+		}
+		for i := range fields {
+			if fields[i] == "-" {
+				fields[i] = ""
+			}
+		}
+		entries = append(entries, Entry{
+			Type:  fields[0],
+			Name:  fields[1],
+			ID:    fields[2],
+			GECOS: fields[3],
+			Home:  fields[4],
+			Shell: fields[5],
+			File:  file,
+		})
+	}
+	return entries, scanner.Err()
+}
+
+// exists reports if the user or group of the entry exists
+func exists(e Entry) *bool {
+	var err error
+	switch e.Type {
+	case "u":
+		_, err = lookupUser(e.Name)
+	case "g":
+		_, err = lookupGroup(e.Name)
+	default:
+		return nil
+	}
+	found := err == nil
+	return &found
+}
+
+// ListSysusers lists the effective sysusers.d entries and whether their
+// users and groups exist
+func (s *Sysusers) ListSysusers(ctx context.Context, req *mcp.CallToolRequest, params *ListSysusersParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := s.Auth.IsReadAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.FilesReadAction)); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	res := ListSysusersResult{Entries: []Entry{}}
+	for _, file := range configFiles(configDirs) {
+		entries, err := parseFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		for _, e := range entries {
+			if params.Name != "" && e.Name != params.Name && !(e.Type == "m" && e.ID == params.Name) {
+				continue
+			}
+			e.Exists = exists(e)
+			missing := e.Exists != nil && !*e.Exists
+			if params.Missing && !missing {
+				continue
+			}
+			if missing {
+				res.Missing = append(res.Missing, e.Type+" "+e.Name)
+			}
+			res.Entries = append(res.Entries, e)
+		}
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
+
+// sysusersArgs returns the arguments of systemd-sysusers, a config is looked
+// up in the sysusers.d directories
+func sysusersArgs(params *ApplySysusersParams) ([]string, error) {
+	var args []string
+	if params.DryRun {
+		args = append(args, "--dry-run")
+	}
+	if params.Config != "" {
+		if strings.ContainsRune(params.Config, '/') || !strings.HasSuffix(params.Config, ".conf") {
+			return nil, fmt.Errorf("invalid config: %s, it must be the name of a .conf file in a sysusers.d directory", params.Config)
+		}
+		args = append(args, params.Config)
+	}
+	return args, nil
+}
+
+// ApplySysusers creates the missing users and groups of the sysusers.d
+// files with systemd-sysusers
+func (s *Sysusers) ApplySysusers(ctx context.Context, req *mcp.CallToolRequest, params *ApplySysusersParams) (*mcp.CallToolResult, any, error) {
+	args, err := sysusersArgs(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	allowed, err := s.Auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, dbus.FilesWriteAction))
+	if !allowed || err != nil {
+		slog.Debug("ApplySysusers wasn't authorized", "reason", err)
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %w", err)
+	}
+	defer s.Auth.Deauthorize()
+
+	cmd := exec.CommandContext(ctx, sysusersBin, args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return nil, nil, fmt.Errorf("systemd-sysusers failed: %w: %s", err, strings.TrimSpace(out.String()))
+	}
+	msg := strings.TrimSpace(out.String())
+	if msg == "" {
+		msg = "all users and groups exist"
+	}
+	if !params.DryRun {
+		slog.Info("applied sysusers.d", "config", params.Config)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: msg},
+		},
+	}, util.Message{Message: msg}, nil
+}
@@ -0,0 +1,60 @@
+package sysusers
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitFields(t *testing.T) {
+	assert.Equal(t, []string{"u", "nginx", "-", "Nginx web server", "/var/lib/nginx", "-"},
+		splitFields(`u nginx - "Nginx web server" /var/lib/nginx -`))
+	assert.Equal(t, []string{"g", "input", "-"}, splitFields("g\tinput  -"))
+	assert.Equal(t, []string{"u", "a", "1:2", "it's"}, splitFields(`u a 1:2 "it's"`))
+}
+
+func TestConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	etc := filepath.Join(dir, "etc")
+	usr := filepath.Join(dir, "usr")
+	require.NoError(t, os.MkdirAll(etc, 0755))
+	require.NoError(t, os.MkdirAll(usr, 0755))
+	for _, file := range []string{filepath.Join(usr, "base.conf"), filepath.Join(usr, "nginx.conf"), filepath.Join(usr, "masked.conf"), filepath.Join(etc, "nginx.conf")} {
+		require.NoError(t, os.WriteFile(file, []byte("u nginx -\n"), 0644))
+	}
+	require.NoError(t, os.Symlink(os.DevNull, filepath.Join(etc, "masked.conf")))
+	assert.Equal(t, []string{filepath.Join(usr, "base.conf"), filepath.Join(etc, "nginx.conf")}, configFiles([]string{etc, usr}))
+}
+
+func TestParseFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "nginx.conf")
+	require.NoError(t, os.WriteFile(file, []byte("# web server\nu nginx - \"Nginx web server\" /var/lib/nginx\nm nginx www\n\nr - 500-900\n"), 0644))
+	entries, err := parseFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{
+		{Type: "u", Name: "nginx", GECOS: "Nginx web server", Home: "/var/lib/nginx", File: file},
+		{Type: "m", Name: "nginx", ID: "www", File: file},
+		{Type: "r", ID: "500-900", File: file},
+	}, entries)
+
+	lookupUser = func(name string) (*user.User, error) { return nil, user.UnknownUserError(name) }
+	lookupGroup = func(name string) (*user.Group, error) { return &user.Group{Name: name}, nil }
+	defer func() { lookupUser, lookupGroup = user.Lookup, user.LookupGroup }()
+	assert.False(t, *exists(entries[0]))
+	assert.True(t, *exists(Entry{Type: "g", Name: "www"}))
+	assert.Nil(t, exists(entries[1]))
+}
+
+func TestSysusersArgs(t *testing.T) {
+	args, err := sysusersArgs(&ApplySysusersParams{Config: "nginx.conf", DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--dry-run", "nginx.conf"}, args)
+	_, err = sysusersArgs(&ApplySysusersParams{Config: "/tmp/evil.conf"})
+	assert.Error(t, err)
+	_, err = sysusersArgs(&ApplySysusersParams{Config: "nginx"})
+	assert.Error(t, err)
+}
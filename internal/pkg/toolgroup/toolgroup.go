@@ -0,0 +1,123 @@
+package toolgroup
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Default is the group of the tools whose name matches no other group, as
+// most tools deal with the units of the service manager
+const Default = "units"
+
+// groups in the order they are matched, a tool belongs to the first group
+// with a word of its name, so that new tools land in their group by their
+// name
+var groups = []struct {
+	name  string
+	words []string
+}{
+	{Default, []string{"unit", "units", "target"}},
+	{"files", []string{"file"}},
+	{"journal", []string{"log", "journal", "boots", "coredump", "coredumps", "login"}},
+	{"man", []string{"man"}},
+	{"power", []string{"power", "inhibitors"}},
+	{"network", []string{"network", "resolved", "resolve"}},
+	{"auth", []string{"auth", "authorizations", "delegation", "audit"}},
+	{"sessions", []string{"session", "sessions", "seat"}},
+	{"machines", []string{"machine", "machines"}},
+	{"storage", []string{"disk", "storage", "tpm"}},
+	{"users", []string{"sysusers"}},
+}
+
+// Access of the tools of a group
+const (
+	Read  = "read"
+	Write = "write"
+)
+
+// Of returns the group of a tool
+func Of(tool string) string {
+	words := strings.Split(tool, "_")
+	for _, g := range groups {
+		for _, w := range g.words {
+			if slices.Contains(words, w) {
+				return g.name
+			}
+		}
+	}
+	return Default
+}
+
+// Names returns the names of the groups
+func Names() []string {
+	names := make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = g.name
+	}
+	return names
+}
+
+func isGroup(name string) bool {
+	return slices.Contains(Names(), name)
+}
+
+// Selection selects the tools by name, by group or by the read or write
+// tools of a group. An empty selection selects all tools.
+type Selection struct {
+	tools map[string]bool
+	// access by group, empty for all tools of the group
+	groups map[string][]string
+}
+
+// Parse parses entries like list_log, journal or units:read, names which
+// are neither a group nor a known tool are kept as tool names
+func Parse(entries []string) (*Selection, error) {
+	s := &Selection{
+		tools:  make(map[string]bool),
+		groups: make(map[string][]string),
+	}
+	for _, e := range entries {
+		group, access, ok := strings.Cut(e, ":")
+		switch {
+		case ok && !isGroup(group):
+			return nil, fmt.Errorf("unknown tool group %q, groups are %s", group, strings.Join(Names(), ", "))
+		case ok && access != Read && access != Write:
+			return nil, fmt.Errorf("invalid access %q of tool group %s, use %s or %s", access, group, Read, Write)
+		case ok:
+			if accesses, found := s.groups[group]; !found || len(accesses) > 0 {
+				s.groups[group] = append(accesses, access)
+			}
+		case isGroup(e):
+			s.groups[e] = []string{}
+		default:
+			s.tools[e] = true
+		}
+	}
+	return s, nil
+}
+
+// Enabled reports if the tool is selected, its read-only annotation has to
+// be final
+func (s *Selection) Enabled(tool *mcp.Tool) bool {
+	if s == nil || (len(s.tools) == 0 && len(s.groups) == 0) {
+		return true
+	}
+	if s.tools[tool.Name] {
+		return true
+	}
+	accesses, ok := s.groups[Of(tool.Name)]
+	if !ok {
+		return false
+	}
+	if len(accesses) == 0 {
+		return true
+	}
+	access := Write
+	if tool.Annotations != nil && tool.Annotations.ReadOnlyHint {
+		access = Read
+	}
+	return slices.Contains(accesses, access)
+}
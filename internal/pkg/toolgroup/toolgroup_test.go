@@ -0,0 +1,71 @@
+package toolgroup
+
+import (
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOf(t *testing.T) {
+	for tool, group := range map[string]string{
+		"list_loaded_units":     "units",
+		"list_unit_files":       "units",
+		"get_unit_file_content": "units",
+		"switch_target":         "units",
+		"system_overview":       "units",
+		"get_file":              "files",
+		"list_log":              "journal",
+		"follow_log":            "journal",
+		"login_failures":        "journal",
+		"get_coredump_info":     "journal",
+		"get_man_page":          "man",
+		"power_action":          "power",
+		"list_inhibitors":       "power",
+		"network_status":        "network",
+		"resolve_query":         "network",
+		"create_delegation":     "auth",
+		"get_auth_status":       "auth",
+		"terminate_session":     "sessions",
+		"lock_seat":             "sessions",
+		"list_machines":         "machines",
+		"tpm_status":            "storage",
+		"apply_sysusers":        "users",
+	} {
+		assert.Equal(t, group, Of(tool), tool)
+	}
+}
+
+func TestSelection(t *testing.T) {
+	read := &mcp.Tool{Name: "list_loaded_units", Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true}}
+	write := &mcp.Tool{Name: "change_unit_state"}
+	log := &mcp.Tool{Name: "list_log", Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true}}
+	file := &mcp.Tool{Name: "get_file", Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true}}
+
+	all, err := Parse(nil)
+	require.NoError(t, err)
+	assert.True(t, all.Enabled(write))
+
+	s, err := Parse([]string{"units:read", "journal", "get_file"})
+	require.NoError(t, err)
+	assert.True(t, s.Enabled(read))
+	assert.False(t, s.Enabled(write))
+	assert.True(t, s.Enabled(log))
+	assert.True(t, s.Enabled(file))
+	assert.False(t, s.Enabled(&mcp.Tool{Name: "power_action"}))
+
+	// the whole group wins over a part of it
+	s, err = Parse([]string{"units", "units:read"})
+	require.NoError(t, err)
+	assert.True(t, s.Enabled(write))
+	s, err = Parse([]string{"units:write", "units:read"})
+	require.NoError(t, err)
+	assert.True(t, s.Enabled(read))
+	assert.True(t, s.Enabled(write))
+
+	_, err = Parse([]string{"unit:read"})
+	assert.ErrorContains(t, err, `unknown tool group "unit"`)
+	_, err = Parse([]string{"units:all"})
+	assert.ErrorContains(t, err, `invalid access "all" of tool group units`)
+}
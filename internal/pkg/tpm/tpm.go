@@ -0,0 +1,334 @@
+package tpm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+)
+
+var (
+	tpmClassDir   = "/sys/class/tpm"
+	crypttabPath  = "/etc/crypttab"
+	pcrlockPolicy = "/var/lib/systemd/pcrlock.json"
+	pcrlockDirs   = []string{"/etc/pcrlock.d", "/run/pcrlock.d", "/var/lib/pcrlock.d", "/usr/lib/pcrlock.d"}
+)
+
+// pcrChanges describes which events modify a PCR, used to explain if
+// a binding survives the next update and reboot
+var pcrChanges = map[int]string{
+	0:  "firmware updates",
+	1:  "firmware configuration changes",
+	2:  "option ROM and firmware updates",
+	3:  "option ROM configuration changes",
+	4:  "boot loader and kernel updates",
+	5:  "partition table changes",
+	7:  "Secure Boot db/dbx updates",
+	8:  "kernel command line changes (grub)",
+	9:  "kernel and initrd updates (grub)",
+	11: "unified kernel image updates",
+	12: "kernel command line and credential changes",
+	13: "system extension changes",
+	14: "shim MOK changes",
+}
+
+// PCRs which change on regular kernel or boot loader updates
+var volatilePCRs = []int{4, 8, 9, 11}
+
+type TPM struct {
+	Auth auth.AuthKeeper
+}
+
+type TPMStatusParams struct {
+	ShowPCRs bool `json:"show_pcrs,omitempty" jsonschema:"Include the current sha256 PCR values."`
+}
+
+type Pcrlock struct {
+	PolicyFile    string   `json:"policy_file"`
+	PolicyPresent bool     `json:"policy_present"`
+	Components    []string `json:"components,omitempty"`
+}
+
+type TPM2Token struct {
+	PCRs       []int  `json:"pcrs"`
+	PCRBank    string `json:"pcr_bank,omitempty"`
+	PubkeyPCRs []int  `json:"pubkey_pcrs,omitempty"`
+	Pcrlock    bool   `json:"pcrlock"`
+}
+
+type CryptVolume struct {
+	Name           string      `json:"name"`
+	Device         string      `json:"device"`
+	Options        []string    `json:"options,omitempty"`
+	TPM2           bool        `json:"tpm2"`
+	Tokens         []TPM2Token `json:"tokens,omitempty"`
+	SurvivesReboot string      `json:"survives_reboot,omitempty"`
+	Warnings       []string    `json:"warnings,omitempty"`
+	Error          string      `json:"error,omitempty"`
+}
+
+type TPMStatusResult struct {
+	Present  bool              `json:"present"`
+	Devices  []string          `json:"devices,omitempty"`
+	Version  string            `json:"version,omitempty"`
+	Support  string            `json:"support,omitempty"`
+	PCRs     map[string]string `json:"pcrs,omitempty"`
+	Pcrlock  Pcrlock           `json:"pcrlock"`
+	Volumes  []CryptVolume     `json:"volumes"`
+	Warnings []string          `json:"warnings,omitempty"`
+}
+
+func CreateTPMStatusSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[TPMStatusParams](nil)
+	inputSchema.Properties["show_pcrs"].Default = json.RawMessage(`false`)
+	return inputSchema
+}
+
+// parseCrypttab returns the volumes of a crypttab, options are split at ','
+func parseCrypttab(path string) ([]CryptVolume, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var volumes []CryptVolume
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		vol := CryptVolume{
+			Name:   fields[0],
+			Device: fields[1],
+		}
+		if len(fields) >= 4 {
+			vol.Options = strings.Split(fields[3], ",")
+		}
+		for _, opt := range vol.Options {
+			if strings.HasPrefix(opt, "tpm2-") {
+				vol.TPM2 = true
+			}
+		}
+		volumes = append(volumes, vol)
+	}
+	return volumes, scanner.Err()
+}
+
+// resolve the UUID=, PARTUUID= and LABEL= notations of crypttab
+func resolveDevice(device string) string {
+	switch {
+	case strings.HasPrefix(device, "UUID="):
+		return filepath.Join("/dev/disk/by-uuid", strings.TrimPrefix(device, "UUID="))
+	case strings.HasPrefix(device, "PARTUUID="):
+		return filepath.Join("/dev/disk/by-partuuid", strings.TrimPrefix(device, "PARTUUID="))
+	case strings.HasPrefix(device, "LABEL="):
+		return filepath.Join("/dev/disk/by-label", strings.TrimPrefix(device, "LABEL="))
+	}
+	return device
+}
+
+// parseLuksTokens extracts the systemd-tpm2 tokens from the output of
+// cryptsetup luksDump --dump-json-metadata
+func parseLuksTokens(data []byte) ([]TPM2Token, error) {
+	var metadata struct {
+		Tokens map[string]struct {
+			Type       string `json:"type"`
+			PCRs       []int  `json:"tpm2-pcrs"`
+			PCRBank    string `json:"tpm2-pcr-bank"`
+			PubkeyPCRs []int  `json:"tpm2-pubkey-pcrs"`
+			Pcrlock    bool   `json:"tpm2-pcrlock"`
+		} `json:"tokens"`
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse luks metadata: %w", err)
+	}
+	ids := make([]string, 0, len(metadata.Tokens))
+	for id := range metadata.Tokens {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	var tokens []TPM2Token
+	for _, id := range ids {
+		tok := metadata.Tokens[id]
+		if tok.Type != "systemd-tpm2" {
+			continue
+		}
+		tokens = append(tokens, TPM2Token{
+			PCRs:       tok.PCRs,
+			PCRBank:    tok.PCRBank,
+			PubkeyPCRs: tok.PubkeyPCRs,
+			Pcrlock:    tok.Pcrlock,
+		})
+	}
+	return tokens, nil
+}
+
+// assessToken checks if an unlock with the token will still work after the
+// usual updates and the following reboot
+func assessToken(tok TPM2Token, policyPresent bool) (survives string, warnings []string) {
+	if tok.Pcrlock {
+		if !policyPresent {
+			return "no", []string{"token is bound to a pcrlock policy, but no policy is present"}
+		}
+		return "yes", []string{"token uses a pcrlock policy, run 'systemd-pcrlock make-policy' after firmware, boot loader or kernel updates"}
+	}
+	survives = "yes"
+	for _, pcr := range tok.PCRs {
+		if slices.Contains(volatilePCRs, pcr) {
+			survives = "no"
+			warnings = append(warnings, fmt.Sprintf("bound to PCR %d which changes with %s, re-enroll after such an update", pcr, pcrChanges[pcr]))
+		} else if what, ok := pcrChanges[pcr]; ok {
+			if survives == "yes" {
+				survives = "unless-changed"
+			}
+			warnings = append(warnings, fmt.Sprintf("bound to PCR %d which changes with %s", pcr, what))
+		}
+	}
+	if len(tok.PubkeyPCRs) > 0 {
+		warnings = append(warnings, fmt.Sprintf("signed policy for PCRs %v survives updates of signed images", tok.PubkeyPCRs))
+	}
+	return survives, warnings
+}
+
+// survivalRank orders the assessments of the tokens from worst to best
+var survivalRank = []string{"no", "unless-changed", "yes"}
+
+// assessTokens checks if the volume still unlocks after the usual updates and
+// the following reboot. Any token unlocks the volume, so the best token
+// decides, the warnings of all tokens are returned.
+func assessTokens(tokens []TPM2Token, policyPresent bool) (survives string, warnings []string) {
+	for _, tok := range tokens {
+		s, w := assessToken(tok, policyPresent)
+		if slices.Index(survivalRank, s) > slices.Index(survivalRank, survives) {
+			survives = s
+		}
+		warnings = append(warnings, w...)
+	}
+	return survives, warnings
+}
+
+// readPCRs reads the sha256 PCR values exposed by the kernel
+func readPCRs(dev string) map[string]string {
+	pcrs := make(map[string]string)
+	entries, err := os.ReadDir(filepath.Join(tpmClassDir, dev, "pcr-sha256"))
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		val, err := os.ReadFile(filepath.Join(tpmClassDir, dev, "pcr-sha256", e.Name()))
+		if err != nil {
+			continue
+		}
+		pcrs[e.Name()] = strings.TrimSpace(string(val))
+	}
+	return pcrs
+}
+
+// Status reports if a TPM is present, the state of the pcrlock policy and
+// which encrypted volumes are bound to the TPM and if these bindings
+// will survive the next reboot
+func (t *TPM) Status(ctx context.Context, req *mcp.CallToolRequest, params *TPMStatusParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := t.Auth.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+
+	res := TPMStatusResult{
+		Volumes: []CryptVolume{},
+	}
+	if entries, err := os.ReadDir(tpmClassDir); err == nil {
+		for _, e := range entries {
+			res.Devices = append(res.Devices, e.Name())
+		}
+	}
+	res.Present = len(res.Devices) > 0
+	if res.Present {
+		if ver, err := os.ReadFile(filepath.Join(tpmClassDir, res.Devices[0], "tpm_version_major")); err == nil {
+			res.Version = strings.TrimSpace(string(ver))
+		}
+		if params.ShowPCRs {
+			res.PCRs = readPCRs(res.Devices[0])
+		}
+	}
+	// has-tpm2 is available since systemd 254 and also checks firmware and
+	// the boot loader, the exit code is non zero for partial support
+	if out, err := exec.CommandContext(ctx, "systemd-analyze", "has-tpm2").Output(); len(out) > 0 {
+		res.Support = strings.Join(strings.Fields(string(out)), " ")
+	} else if err != nil {
+		slog.Debug("systemd-analyze has-tpm2 failed", "error", err)
+	}
+
+	res.Pcrlock.PolicyFile = pcrlockPolicy
+	if _, err := os.Stat(pcrlockPolicy); err == nil {
+		res.Pcrlock.PolicyPresent = true
+	}
+	for _, dir := range pcrlockDirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			res.Pcrlock.Components = append(res.Pcrlock.Components, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	volumes, err := parseCrypttab(crypttabPath)
+	if err != nil && !os.IsNotExist(err) {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("couldn't read %s: %s", crypttabPath, err))
+	}
+	for _, vol := range volumes {
+		out, err := exec.CommandContext(ctx, "cryptsetup", "luksDump", "--dump-json-metadata", resolveDevice(vol.Device)).Output()
+		if err != nil {
+			if vol.TPM2 {
+				vol.Error = fmt.Sprintf("couldn't read luks header: %s", err)
+			}
+			res.Volumes = append(res.Volumes, vol)
+			continue
+		}
+		vol.Tokens, err = parseLuksTokens(out)
+		if err != nil {
+			vol.Error = err.Error()
+		}
+		if len(vol.Tokens) > 0 {
+			vol.TPM2 = true
+		}
+		vol.SurvivesReboot, vol.Warnings = assessTokens(vol.Tokens, res.Pcrlock.PolicyPresent)
+		res.Volumes = append(res.Volumes, vol)
+	}
+	if !res.Present {
+		for _, vol := range res.Volumes {
+			if vol.TPM2 {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("volume %s uses TPM2 but no TPM device is present", vol.Name))
+			}
+		}
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, res, nil
+}
@@ -0,0 +1,76 @@
+package tpm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCrypttab(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crypttab")
+	content := `# comment
+cr_root UUID=1234 none tpm2-device=auto,discard
+cr_home /dev/sda3 /etc/keys/home.key
+`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	volumes, err := parseCrypttab(path)
+	require.NoError(t, err)
+	require.Len(t, volumes, 2)
+	assert.Equal(t, "cr_root", volumes[0].Name)
+	assert.Equal(t, "UUID=1234", volumes[0].Device)
+	assert.Equal(t, []string{"tpm2-device=auto", "discard"}, volumes[0].Options)
+	assert.True(t, volumes[0].TPM2)
+	assert.False(t, volumes[1].TPM2)
+	assert.Equal(t, "/dev/disk/by-uuid/1234", resolveDevice(volumes[0].Device))
+}
+
+func TestParseLuksTokens(t *testing.T) {
+	data := `{"keyslots":{},"tokens":{
+		"0":{"type":"systemd-tpm2","keyslots":["1"],"tpm2-pcrs":[7],"tpm2-pcr-bank":"sha256","tpm2-pubkey-pcrs":[],"tpm2-pcrlock":false},
+		"1":{"type":"systemd-fido2","keyslots":["2"]}
+	}}`
+	tokens, err := parseLuksTokens([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, []int{7}, tokens[0].PCRs)
+	assert.Equal(t, "sha256", tokens[0].PCRBank)
+
+	_, err = parseLuksTokens([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestAssessToken(t *testing.T) {
+	survives, _ := assessToken(TPM2Token{PCRs: []int{7}}, false)
+	assert.Equal(t, "unless-changed", survives)
+
+	survives, warnings := assessToken(TPM2Token{PCRs: []int{4, 7}}, false)
+	assert.Equal(t, "no", survives)
+	assert.Len(t, warnings, 2)
+
+	survives, _ = assessToken(TPM2Token{Pcrlock: true}, true)
+	assert.Equal(t, "yes", survives)
+
+	survives, _ = assessToken(TPM2Token{Pcrlock: true}, false)
+	assert.Equal(t, "no", survives)
+
+	survives, _ = assessToken(TPM2Token{PCRs: []int{15}}, false)
+	assert.Equal(t, "yes", survives)
+}
+
+func TestAssessTokens(t *testing.T) {
+	// the pcrlock token still unlocks after the PCR 4 bound one broke
+	survives, warnings := assessTokens([]TPM2Token{{PCRs: []int{4}}, {Pcrlock: true}}, true)
+	assert.Equal(t, "yes", survives)
+	assert.Len(t, warnings, 2)
+
+	survives, _ = assessTokens([]TPM2Token{{PCRs: []int{4}}, {PCRs: []int{7}}}, false)
+	assert.Equal(t, "unless-changed", survives)
+
+	survives, warnings = assessTokens(nil, false)
+	assert.Empty(t, survives)
+	assert.Empty(t, warnings)
+}
@@ -0,0 +1,323 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// spans kept until the next export, further spans are dropped
+	queueSize = 2048
+	// spans sent in one request
+	batchSize = 512
+	// time between the exports
+	exportInterval = 5 * time.Second
+)
+
+// OTLP span kinds
+const (
+	kindServer = 2
+	kindClient = 3
+)
+
+// OTLP status codes
+const (
+	statusOk    = 1
+	statusError = 2
+)
+
+// Span is an operation of a trace, the methods do nothing on a nil Span
+type Span struct {
+	tracer   *Tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID []byte
+	name     string
+	kind     int
+	start    time.Time
+	mu       sync.Mutex
+	attrs    map[string]string
+}
+
+type spanKey struct{}
+
+// SetAttribute adds an attribute to the span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs[key] = value
+}
+
+// End ends the span, a non nil error marks it as failed
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Status:            otlpStatus{Code: statusOk},
+	}
+	if s.parentID != nil {
+		span.ParentSpanID = hex.EncodeToString(s.parentID)
+	}
+	for k, v := range s.attrs {
+		span.Attributes = append(span.Attributes, attribute(k, v))
+	}
+	if err != nil {
+		span.Status = otlpStatus{Code: statusError, Message: err.Error()}
+	}
+	s.tracer.enqueue(span)
+}
+
+// Start starts a span of a call to another service as child of the span in
+// the context, without span in the context nothing is traced
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent, _ := ctx.Value(spanKey{}).(*Span)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := parent.tracer.newSpan(name, kindClient)
+	span.traceID = parent.traceID
+	span.parentID = parent.spanID[:]
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Tracer exports the spans of the tool calls and the calls they make with
+// the OTLP/HTTP JSON protocol to a collector
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	version  string
+	client   *http.Client
+	queue    chan otlpSpan
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// New exports the spans to the collector at endpoint, e.g.
+// http://collector:4318, with the headers given as key=value
+func New(endpoint string, headers []string, service, version string) (*Tracer, error) {
+	t := &Tracer{
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		headers:  make(map[string]string),
+		service:  service,
+		version:  version,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan otlpSpan, queueSize),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	for _, h := range headers {
+		key, value, ok := strings.Cut(h, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q, use KEY=VALUE", h)
+		}
+		t.headers[key] = value
+	}
+	go t.run()
+	return t, nil
+}
+
+func (t *Tracer) newSpan(name string, kind int) *Span {
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now(), attrs: make(map[string]string)}
+	rand.Read(span.traceID[:])
+	rand.Read(span.spanID[:])
+	return span
+}
+
+func (t *Tracer) enqueue(span otlpSpan) {
+	select {
+	case t.queue <- span:
+	default:
+		slog.Debug("dropping span, the export queue is full", "span", span.Name)
+	}
+}
+
+// run exports the spans in batches until Shutdown
+func (t *Tracer) run() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	var batch []otlpSpan
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(batch); err != nil {
+			slog.Warn("failed to export spans", "spans", len(batch), "error", err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.done:
+			for {
+				select {
+				case span := <-t.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// export sends the spans to the collector
+func (t *Tracer) export(spans []otlpSpan) error {
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			attribute("service.name", t.service),
+			attribute("service.version", t.version),
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: t.service},
+			Spans: spans,
+		}},
+	}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Shutdown exports the remaining spans, waits until the context ends at
+// most
+func (t *Tracer) Shutdown(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	close(t.done)
+	select {
+	case <-t.stopped:
+	case <-ctx.Done():
+	}
+}
+
+// Middleware traces the tool calls with the session and the tool as
+// attributes, the spans of the calls they make are children of it
+func (t *Tracer) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	if t == nil {
+		return next
+	}
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || call.Params == nil {
+			return next(ctx, method, req)
+		}
+		span := t.newSpan("tools/call "+call.Params.Name, kindServer)
+		span.SetAttribute("mcp.tool.name", call.Params.Name)
+		if call.Session != nil {
+			span.SetAttribute("mcp.session.id", call.Session.ID())
+		}
+		result, err := next(context.WithValue(ctx, spanKey{}, span), method, req)
+		callErr := err
+		if res, ok := result.(*mcp.CallToolResult); callErr == nil && ok && res.IsError {
+			callErr = res.GetError()
+			if callErr == nil {
+				callErr = fmt.Errorf("tool call failed")
+			}
+		}
+		span.End(callErr)
+		return result, err
+	}
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func attribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: value}}
+}
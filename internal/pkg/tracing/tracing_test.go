@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var mu sync.Mutex
+	var spans []otlpSpan
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		var req otlpRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	tracer, err := New(collector.URL, []string{"Authorization=Bearer secret"}, "systemd-mcp", "1.0")
+	require.NoError(t, err)
+	handler := tracer.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		_, span := Start(ctx, "org.freedesktop.systemd1.Manager/StartUnit")
+		span.End(errors.New("unit not found"))
+		return &mcp.CallToolResult{}, nil
+	})
+	_, err = handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "change_unit_state"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	tracer.Shutdown(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, spans, 2)
+	child, tool := spans[0], spans[1]
+	assert.Equal(t, "tools/call change_unit_state", tool.Name)
+	assert.Equal(t, kindServer, tool.Kind)
+	assert.Equal(t, statusOk, tool.Status.Code)
+	assert.Contains(t, tool.Attributes, attribute("mcp.tool.name", "change_unit_state"))
+	assert.Equal(t, tool.TraceID, child.TraceID)
+	assert.Equal(t, tool.SpanID, child.ParentSpanID)
+	assert.Equal(t, statusError, child.Status.Code)
+	assert.Equal(t, "unit not found", child.Status.Message)
+}
+
+func TestDisabled(t *testing.T) {
+	// without span in the context nothing is traced
+	_, span := Start(context.Background(), "org.freedesktop.systemd1.Manager/StartUnit")
+	assert.Nil(t, span)
+	span.SetAttribute("rpc.system", "dbus")
+	span.End(nil)
+
+	var tracer *Tracer
+	called := false
+	handler := tracer.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		called = true
+		return &mcp.CallToolResult{}, nil
+	})
+	_, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_units"}})
+	require.NoError(t, err)
+	assert.True(t, called)
+
+	_, err = New("http://collector:4318", []string{"Authorization"}, "systemd-mcp", "1.0")
+	assert.Error(t, err)
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Items is the structured content of the tools returning a list
+type Items[T any] struct {
+	Count int `json:"count"`
+	Items []T `json:"items"`
+}
+
+// NewItems returns the items together with their count
+func NewItems[T any](items []T) Items[T] {
+	return Items[T]{Count: len(items), Items: items}
+}
+
+// Message is the structured content of the tools only reporting what they
+// did
+type Message struct {
+	Message string `json:"message"`
+}
+
+// ContentItems returns the JSON text blocks of the content as items, the
+// structured content of the tools returning an entry per block. Blocks
+// holding a JSON array add its elements and blocks which aren't JSON are
+// added as string.
+func ContentItems(content []mcp.Content) Items[any] {
+	items := []any{}
+	for _, c := range content {
+		txt, ok := c.(*mcp.TextContent)
+		if !ok {
+			continue
+		}
+		var elems []json.RawMessage
+		switch {
+		case json.Unmarshal([]byte(txt.Text), &elems) == nil:
+			for _, e := range elems {
+				items = append(items, e)
+			}
+		case json.Valid([]byte(txt.Text)):
+			items = append(items, json.RawMessage(txt.Text))
+		default:
+			items = append(items, txt.Text)
+		}
+	}
+	return NewItems(items)
+}
+
+// WithContentItems returns the text blocks of the results of the handler as
+// structured content, for the tools returning a varying number of blocks.
+// Unless perItem is set, the blocks are also replaced by a single block
+// holding the items and their count, as some clients concatenate the blocks
+// badly.
+func WithContentItems[In any](h mcp.ToolHandlerFor[In, any], perItem bool) mcp.ToolHandlerFor[In, any] {
+	return func(ctx context.Context, req *mcp.CallToolRequest, in In) (*mcp.CallToolResult, any, error) {
+		res, _, err := h(ctx, req, in)
+		if err != nil || res == nil || res.IsError {
+			return res, nil, err
+		}
+		items := ContentItems(res.Content)
+		if !perItem {
+			jsonBytes, err := json.Marshal(items)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+			}
+			res.Content = []mcp.Content{&mcp.TextContent{Text: string(jsonBytes)}}
+		}
+		return res, items, nil
+	}
+}
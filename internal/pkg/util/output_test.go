@@ -0,0 +1,38 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentItems(t *testing.T) {
+	items := ContentItems([]mcp.Content{&mcp.TextContent{Text: `{"state":"active"}`}, &mcp.TextContent{Text: "done"}})
+	data, err := json.Marshal(items)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"count":2,"items":[{"state":"active"},"done"]}`, string(data))
+	assert.Equal(t, []any{}, ContentItems(nil).Items)
+	assert.Equal(t, 0, ContentItems([]mcp.Content{&mcp.TextContent{Text: "[]"}}).Count)
+}
+
+func TestWithContentItems(t *testing.T) {
+	h := func(ctx context.Context, req *mcp.CallToolRequest, in any) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{
+			&mcp.TextContent{Text: `{"state":"active","units":["a.service"]}`},
+			&mcp.TextContent{Text: `{"state":"failed","units":["b.service"]}`},
+		}}, nil, nil
+	}
+	res, out, err := WithContentItems(h, false)(context.Background(), nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, res.Content, 1)
+	assert.JSONEq(t, `{"count":2,"items":[{"state":"active","units":["a.service"]},{"state":"failed","units":["b.service"]}]}`, res.Content[0].(*mcp.TextContent).Text)
+	assert.Equal(t, 2, out.(Items[any]).Count)
+
+	res, out, err = WithContentItems(h, true)(context.Background(), nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, res.Content, 2)
+	assert.Equal(t, 2, out.(Items[any]).Count)
+}
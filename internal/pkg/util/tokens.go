@@ -0,0 +1,82 @@
+package util
+
+import (
+	"encoding/json"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// BytesPerToken is the heuristic for estimating the tokens of a response
+const BytesPerToken = 4
+
+// EstimateTokens estimates the number of tokens a client needs for data
+func EstimateTokens(data []byte) int {
+	return (len(data) + BytesPerToken - 1) / BytesPerToken
+}
+
+// ContentBytes returns the size of the text content of a result
+func ContentBytes(content []mcp.Content) int {
+	size := 0
+	for _, c := range content {
+		if txt, ok := c.(*mcp.TextContent); ok {
+			size += len(txt.Text)
+		}
+	}
+	return size
+}
+
+// ContentTokens estimates the tokens of the text content of a result
+func ContentTokens(content []mcp.Content) int {
+	tokens := 0
+	for _, c := range content {
+		if txt, ok := c.(*mcp.TextContent); ok {
+			tokens += EstimateTokens([]byte(txt.Text))
+		}
+	}
+	return tokens
+}
+
+// Shaping reports how a response was reduced to fit max_tokens_hint
+type Shaping struct {
+	MaxTokensHint   int      `json:"max_tokens_hint"`
+	EstimatedTokens int      `json:"estimated_tokens"`
+	Reduced         []string `json:"reduced,omitempty"`
+	Omitted         int      `json:"omitted,omitempty"`
+}
+
+// Fits reports if the estimated tokens of v fit into the hint, it also
+// records the estimation
+func (s *Shaping) Fits(v any) bool {
+	data, _ := json.Marshal(v)
+	s.EstimatedTokens = EstimateTokens(data)
+	return s.MaxTokensHint <= 0 || s.EstimatedTokens <= s.MaxTokensHint
+}
+
+// Reduce records a reduction of the verbosity
+func (s *Shaping) Reduce(what string) {
+	s.Reduced = append(s.Reduced, what)
+}
+
+// Shrink returns the number of items to keep of total so that an estimate
+// of tokens fits, it always drops at least one item
+func (s *Shaping) Shrink(total int) int {
+	if total <= 0 || s.EstimatedTokens <= 0 {
+		return 0
+	}
+	keep := total * s.MaxTokensHint / s.EstimatedTokens
+	return max(min(keep, total-1), 0)
+}
+
+// FitsContent is Fits for the content of a result
+func (s *Shaping) FitsContent(content []mcp.Content) bool {
+	s.EstimatedTokens = ContentTokens(content)
+	return s.MaxTokensHint <= 0 || s.EstimatedTokens <= s.MaxTokensHint
+}
+
+// Content returns the report as content block
+func (s *Shaping) Content() mcp.Content {
+	data, _ := json.Marshal(struct {
+		Shaping *Shaping `json:"shaping"`
+	}{s})
+	return &mcp.TextContent{Text: string(data)}
+}
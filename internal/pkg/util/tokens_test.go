@@ -0,0 +1,30 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens(nil))
+	assert.Equal(t, 1, EstimateTokens([]byte("abc")))
+	assert.Equal(t, 2, EstimateTokens([]byte("abcde")))
+	assert.Equal(t, 3, ContentTokens([]mcp.Content{&mcp.TextContent{Text: "abcd"}, &mcp.TextContent{Text: "abcde"}}))
+	assert.Equal(t, 9, ContentBytes([]mcp.Content{&mcp.TextContent{Text: "abcd"}, &mcp.TextContent{Text: "abcde"}}))
+}
+
+func TestShaping(t *testing.T) {
+	s := &Shaping{MaxTokensHint: 10}
+	assert.True(t, s.Fits("short"))
+	assert.False(t, s.Fits(make([]int, 40)))
+	assert.Equal(t, 21, s.EstimatedTokens)
+	assert.Equal(t, 19, s.Shrink(40))
+	// always drops at least one item
+	s.EstimatedTokens = 11
+	assert.Equal(t, 0, s.Shrink(1))
+	assert.Equal(t, 9, s.Shrink(10))
+	assert.Equal(t, `{"shaping":{"max_tokens_hint":10,"estimated_tokens":11}}`, s.Content().(*mcp.TextContent).Text)
+	assert.True(t, (&Shaping{}).Fits(make([]int, 1000)))
+}
@@ -0,0 +1,225 @@
+package varlink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// Interface is the varlink interface which upgrades a connection to MCP
+const Interface = "org.opensuse.systemdmcp.MCP"
+
+const serviceInterface = "org.varlink.service"
+
+// description of Interface returned by GetInterfaceDescription
+const description = `# Model Context Protocol server for systemd
+interface org.opensuse.systemdmcp.MCP
+
+# Upgrades the connection to MCP, after the reply the connection carries
+# JSON-RPC messages separated by newlines like MCP over stdio.
+method Connect() -> ()
+
+# Connect was called without upgrade.
+error UpgradeRequired ()
+`
+
+// description of the service interface every varlink service implements
+const serviceDescription = `# The Varlink Service Interface is provided by every varlink service.
+interface org.varlink.service
+
+method GetInfo() -> (
+  vendor: string,
+  product: string,
+  version: string,
+  url: string,
+  interfaces: []string
+)
+
+method GetInterfaceDescription(interface: string) -> (description: string)
+
+error InterfaceNotFound (interface: string)
+error MethodNotFound (method: string)
+error MethodNotImplemented (method: string)
+error InvalidParameter (parameter: string)
+`
+
+// call is a call of a varlink client
+type call struct {
+	Method     string          `json:"method"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+	OneWay     bool            `json:"oneway,omitempty"`
+	More       bool            `json:"more,omitempty"`
+	Upgrade    bool            `json:"upgrade,omitempty"`
+}
+
+// reply is the reply to a call
+type reply struct {
+	Parameters any    `json:"parameters,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Server serves MCP over varlink. The clients call Connect with upgrade set
+// and speak MCP on the connection after the reply, e.g. with
+// varlinkctl call --upgrade unix:PATH org.opensuse.systemdmcp.MCP.Connect {}
+type Server struct {
+	Vendor  string
+	Product string
+	Version string
+	URL     string
+	// ConnContext returns the context of the MCP session of a connection,
+	// e.g. with the credentials of the peer
+	ConnContext func(ctx context.Context, c net.Conn) context.Context
+	// Connect starts serving MCP on an upgraded connection, which is closed
+	// by the MCP session
+	Connect func(ctx context.Context, rwc io.ReadWriteCloser) error
+
+	wg sync.WaitGroup
+	mu sync.Mutex
+	// connections which aren't upgraded
+	conns map[net.Conn]struct{}
+}
+
+// Serve accepts connections until the listener is closed. Then it closes the
+// connections which weren't upgraded, the upgraded ones belong to their MCP
+// sessions.
+func (s *Server) Serve(l net.Listener) error {
+	defer s.wg.Wait()
+	defer s.closeConns()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s.track(conn, true)
+		s.wg.Go(func() {
+			s.handle(conn)
+		})
+	}
+}
+
+func (s *Server) track(conn net.Conn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	if add {
+		s.conns[conn] = struct{}{}
+	} else {
+		delete(s.conns, conn)
+	}
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// upgraded is a connection after the upgrade, the bytes read ahead are read
+// first
+type upgraded struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (u *upgraded) Read(p []byte) (int, error) {
+	return u.r.Read(p)
+}
+
+// handle answers the calls of the connection until it's closed or upgraded
+func (s *Server) handle(conn net.Conn) {
+	defer s.track(conn, false)
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := r.ReadBytes(0)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				slog.Debug("varlink connection failed", "error", err)
+			}
+			conn.Close()
+			return
+		}
+		var c call
+		if err := json.Unmarshal(msg[:len(msg)-1], &c); err != nil {
+			slog.Debug("invalid varlink call", "error", err)
+			conn.Close()
+			return
+		}
+		rep, upgrade := s.answer(&c)
+		if !c.OneWay {
+			if err := send(conn, rep); err != nil {
+				conn.Close()
+				return
+			}
+		}
+		if upgrade {
+			// the connection belongs to the MCP session now
+			s.track(conn, false)
+			ctx := context.Background()
+			if s.ConnContext != nil {
+				ctx = s.ConnContext(ctx, conn)
+			}
+			if err := s.Connect(ctx, &upgraded{Conn: conn, r: r}); err != nil {
+				slog.Warn("couldn't serve MCP over varlink", "error", err)
+				conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// answer returns the reply to a call, upgrade is set if the connection
+// carries MCP after it
+func (s *Server) answer(c *call) (rep reply, upgrade bool) {
+	switch c.Method {
+	case serviceInterface + ".GetInfo":
+		return reply{Parameters: map[string]any{
+			"vendor":     s.Vendor,
+			"product":    s.Product,
+			"version":    s.Version,
+			"url":        s.URL,
+			"interfaces": []string{serviceInterface, Interface},
+		}}, false
+	case serviceInterface + ".GetInterfaceDescription":
+		var params struct {
+			Interface string `json:"interface"`
+		}
+		if err := json.Unmarshal(c.Parameters, &params); err != nil || params.Interface == "" {
+			return reply{Error: serviceInterface + ".InvalidParameter", Parameters: map[string]string{"parameter": "interface"}}, false
+		}
+		switch params.Interface {
+		case serviceInterface:
+			return reply{Parameters: map[string]string{"description": serviceDescription}}, false
+		case Interface:
+			return reply{Parameters: map[string]string{"description": description}}, false
+		}
+		return reply{Error: serviceInterface + ".InterfaceNotFound", Parameters: map[string]string{"interface": params.Interface}}, false
+	case Interface + ".Connect":
+		if !c.Upgrade {
+			return reply{Error: Interface + ".UpgradeRequired", Parameters: map[string]any{}}, false
+		}
+		return reply{Parameters: map[string]any{}}, true
+	}
+	return reply{Error: serviceInterface + ".MethodNotFound", Parameters: map[string]string{"method": c.Method}}, false
+}
+
+// send sends a reply terminated by NUL
+func send(w io.Writer, rep reply) error {
+	data, err := json.Marshal(rep)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, 0))
+	return err
+}
@@ -0,0 +1,106 @@
+package varlink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ctxKey struct{}
+
+// serve serves a MCP server with an echo tool on a socket
+func serve(t *testing.T) string {
+	t.Helper()
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "whoami"}, func(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+		peer, _ := ctx.Value(ctxKey{}).(string)
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: peer}}}, nil, nil
+	})
+	path := filepath.Join(t.TempDir(), "mcp.varlink")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	s := &Server{
+		Vendor:  "openSUSE",
+		Product: "systemd-mcp",
+		Version: "1.0",
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, ctxKey{}, "peer")
+		},
+		Connect: func(ctx context.Context, rwc io.ReadWriteCloser) error {
+			_, err := server.Connect(ctx, &mcp.IOTransport{Reader: rwc, Writer: rwc}, nil)
+			return err
+		},
+	}
+	done := make(chan error)
+	go func() {
+		done <- s.Serve(l)
+	}()
+	t.Cleanup(func() {
+		l.Close()
+		assert.NoError(t, <-done)
+	})
+	return path
+}
+
+// roundTrip sends a call and returns the reply
+func roundTrip(t *testing.T, conn net.Conn, r *bufio.Reader, c call) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(c)
+	require.NoError(t, err)
+	_, err = conn.Write(append(data, 0))
+	require.NoError(t, err)
+	msg, err := r.ReadBytes(0)
+	require.NoError(t, err)
+	var rep map[string]any
+	require.NoError(t, json.Unmarshal(msg[:len(msg)-1], &rep))
+	return rep
+}
+
+func TestService(t *testing.T) {
+	path := serve(t)
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	rep := roundTrip(t, conn, r, call{Method: "org.varlink.service.GetInfo"})
+	info := rep["parameters"].(map[string]any)
+	assert.Equal(t, "systemd-mcp", info["product"])
+	assert.Equal(t, []any{"org.varlink.service", Interface}, info["interfaces"])
+
+	rep = roundTrip(t, conn, r, call{Method: "org.varlink.service.GetInterfaceDescription", Parameters: json.RawMessage(`{"interface": "` + Interface + `"}`)})
+	assert.Contains(t, rep["parameters"].(map[string]any)["description"], "method Connect() -> ()")
+	rep = roundTrip(t, conn, r, call{Method: "org.varlink.service.GetInterfaceDescription", Parameters: json.RawMessage(`{"interface": "io.systemd.Unit"}`)})
+	assert.Equal(t, "org.varlink.service.InterfaceNotFound", rep["error"])
+
+	rep = roundTrip(t, conn, r, call{Method: Interface + ".Connect"})
+	assert.Equal(t, Interface+".UpgradeRequired", rep["error"])
+	rep = roundTrip(t, conn, r, call{Method: Interface + ".Disconnect"})
+	assert.Equal(t, "org.varlink.service.MethodNotFound", rep["error"])
+}
+
+func TestUpgrade(t *testing.T) {
+	path := serve(t)
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	r := bufio.NewReader(conn)
+	rep := roundTrip(t, conn, r, call{Method: Interface + ".Connect", Upgrade: true})
+	assert.Empty(t, rep["error"])
+
+	// the connection carries MCP after the reply
+	client := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil)
+	session, err := client.Connect(context.Background(), &mcp.IOTransport{Reader: conn, Writer: conn}, nil)
+	require.NoError(t, err)
+	defer session.Close()
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "whoami"})
+	require.NoError(t, err)
+	assert.Equal(t, "peer", res.Content[0].(*mcp.TextContent).Text)
+}
@@ -0,0 +1,177 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// PingInterval is the time between the pings which keep idle connections
+// open through proxies, 0 disables the pings
+var PingInterval = 30 * time.Second
+
+// BearerProtocolPrefix marks the subprotocol carrying the bearer token, as
+// browsers can't set the Authorization header of a WebSocket
+const BearerProtocolPrefix = "bearer."
+
+// Transport is a mcp.Transport for an upgraded WebSocket connection
+type Transport struct {
+	Conn *Conn
+}
+
+type message struct {
+	msg jsonrpc.Message
+	err error
+}
+
+type connection struct {
+	ws        *Conn
+	sessionID string
+	incoming  chan message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (t *Transport) Connect(ctx context.Context) (mcp.Connection, error) {
+	c := &connection{
+		ws:        t.Conn,
+		sessionID: rand.Text(),
+		incoming:  make(chan message),
+		done:      make(chan struct{}),
+	}
+	// read in the background, so that Read can be canceled
+	go func() {
+		for {
+			data, err := c.ws.ReadMessage()
+			var msg jsonrpc.Message
+			if err == nil {
+				msg, err = jsonrpc.DecodeMessage(data)
+			}
+			select {
+			case c.incoming <- message{msg, err}:
+			case <-c.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	if PingInterval > 0 {
+		go c.ping(PingInterval)
+	}
+	return c, nil
+}
+
+// ping pings the client until the connection is closed
+func (c *connection) ping(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.ws.Ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *connection) Read(ctx context.Context) (jsonrpc.Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, io.EOF
+	case m := <-c.incoming:
+		return m.msg, m.err
+	}
+}
+
+func (c *connection) Write(ctx context.Context, msg jsonrpc.Message) error {
+	data, err := jsonrpc.EncodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	return c.ws.WriteMessage(data)
+}
+
+func (c *connection) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return c.ws.Close()
+}
+
+func (c *connection) SessionID() string {
+	return c.sessionID
+}
+
+// BearerFromProtocol passes the token of a bearer.TOKEN subprotocol as
+// Authorization header to next, so that browsers can authenticate the
+// WebSocket. The subprotocol is removed, it's never selected.
+func BearerFromProtocol(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		var protocols []string
+		for _, field := range r.Header.Values("Sec-WebSocket-Protocol") {
+			for _, p := range strings.Split(field, ",") {
+				p = strings.TrimSpace(p)
+				if t, ok := strings.CutPrefix(p, BearerProtocolPrefix); ok {
+					token = t
+				} else if p != "" {
+					protocols = append(protocols, p)
+				}
+			}
+		}
+		if token != "" {
+			r = r.Clone(r.Context())
+			r.Header.Del("Sec-WebSocket-Protocol")
+			if len(protocols) > 0 {
+				r.Header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+			}
+			if r.Header.Get("Authorization") == "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewHandler returns a handler which upgrades the requests to WebSockets
+// and connects them to the server returned by getServer
+func NewHandler(getServer func(*http.Request) *mcp.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := Upgrade(w, r)
+		if err != nil {
+			slog.Debug("websocket upgrade failed", "remote_addr", r.RemoteAddr, "error", err)
+			return
+		}
+		server := getServer(r)
+		if server == nil {
+			ws.Close()
+			return
+		}
+		// the request context ends with the handler, the session must not
+		session, err := server.Connect(context.WithoutCancel(r.Context()), &Transport{Conn: ws}, nil)
+		if err != nil {
+			slog.Error("couldn't connect websocket session", "error", err)
+			ws.Close()
+			return
+		}
+		slog.Debug("websocket session started", "ID", session.ID(), "remote_addr", r.RemoteAddr)
+		if err := session.Wait(); err != nil {
+			slog.Debug("websocket session ended", "ID", session.ID(), "error", err)
+		}
+	})
+}
@@ -0,0 +1,287 @@
+// Package websocket implements the server side of RFC 6455 as far as it is
+// needed to speak MCP over a WebSocket: every JSON-RPC message is sent as a
+// single text message.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// MaxMessageSize is the maximal size of a received message
+var MaxMessageSize = 16 << 20
+
+// AllowedOrigins are the origins, e.g. https://ui.example.com, of the web
+// pages which may open a WebSocket besides the pages of the server itself,
+// "*" allows all of them. Requests without Origin don't come from a browser
+// and are always allowed.
+var AllowedOrigins []string
+
+const (
+	// Subprotocol is selected if the client offers it
+	Subprotocol = "mcp"
+	acceptGUID  = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+const (
+	closeNormal        = 1000
+	closeProtocolError = 1002
+	closeInvalidData   = 1007
+	closeTooBig        = 1009
+)
+
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func headerContains(h http.Header, name, value string) bool {
+	for _, field := range h.Values(name) {
+		for _, token := range strings.Split(field, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// originAllowed reports if the page sending the request may open a
+// WebSocket, so that a foreign page can't use the credentials the browser
+// sends on its own, like a client certificate
+func originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || slices.Contains(AllowedOrigins, "*") || slices.Contains(AllowedOrigins, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Upgrade performs the opening handshake and takes over the connection of
+// the request. On failure an error response was already sent.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "websocket handshake requires GET", http.StatusMethodNotAllowed)
+		return nil, fmt.Errorf("invalid method: %s", r.Method)
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("not a websocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("unsupported websocket version: %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	if !originAllowed(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, fmt.Errorf("origin not allowed: %q", r.Header.Get("Origin"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, fmt.Errorf("invalid websocket key: %q", key)
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("response writer can't be hijacked")
+	}
+	netConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	resp := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + acceptKey(key) + "\r\n"
+	if headerContains(r.Header, "Sec-WebSocket-Protocol", Subprotocol) {
+		resp += "Sec-WebSocket-Protocol: " + Subprotocol + "\r\n"
+	}
+	if _, err := netConn.Write([]byte(resp + "\r\n")); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return &Conn{conn: netConn, br: rw.Reader}, nil
+}
+
+type frame struct {
+	fin     bool
+	opcode  byte
+	payload []byte
+}
+
+func (c *Conn) readFrame() (frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{fin: header[0]&0x80 != 0, opcode: header[0] & 0x0f}
+	if header[0]&0x70 != 0 {
+		return f, c.fail(closeProtocolError, "reserved bits set")
+	}
+	// frames of clients must be masked
+	if header[1]&0x80 == 0 {
+		return f, c.fail(closeProtocolError, "unmasked client frame")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return f, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return f, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if f.opcode >= opClose && (length > 125 || !f.fin) {
+		return f, c.fail(closeProtocolError, "invalid control frame")
+	}
+	if length > uint64(MaxMessageSize) {
+		return f, c.fail(closeTooBig, "message too big")
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return f, err
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return f, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	header := []byte{0x80 | opcode, 0}
+	switch {
+	case len(payload) < 126:
+		header[1] = byte(len(payload))
+	case len(payload) <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+	}
+	_, err := c.conn.Write(slices.Concat(header, payload))
+	return err
+}
+
+// fail sends a close frame with the status code and closes the connection
+func (c *Conn) fail(code uint16, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	c.writeFrame(opClose, append(payload, reason...))
+	c.Close()
+	return fmt.Errorf("websocket: %s", reason)
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered
+// while reading, io.EOF is returned if the client closed the connection.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var msg []byte
+	var opcode byte
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch f.opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, f.payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			code := uint16(closeNormal)
+			if len(f.payload) >= 2 {
+				code = binary.BigEndian.Uint16(f.payload)
+			}
+			c.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, code))
+			c.Close()
+			return nil, io.EOF
+		case opText, opBinary:
+			if opcode != 0 {
+				return nil, c.fail(closeProtocolError, "new message before the last one was finished")
+			}
+			opcode = f.opcode
+		case opContinuation:
+			if opcode == 0 {
+				return nil, c.fail(closeProtocolError, "continuation without a message")
+			}
+		default:
+			return nil, c.fail(closeProtocolError, fmt.Sprintf("unknown opcode %d", f.opcode))
+		}
+		if len(msg)+len(f.payload) > MaxMessageSize {
+			return nil, c.fail(closeTooBig, "message too big")
+		}
+		msg = append(msg, f.payload...)
+		if f.fin {
+			if opcode == opText && !utf8.Valid(msg) {
+				return nil, c.fail(closeInvalidData, "text message isn't valid UTF-8")
+			}
+			return msg, nil
+		}
+	}
+}
+
+// Ping sends a ping, which the clients answer with a pong
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// WriteMessage sends data as a single text message
+func (c *Conn) WriteMessage(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// Close closes the underlying connection without a closing handshake
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.conn.Close()
+	})
+	if errors.Is(c.closeErr, net.ErrClosed) {
+		return nil
+	}
+	return c.closeErr
+}
@@ -0,0 +1,245 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClient is a minimal websocket client which sends masked frames
+type testClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dial(t *testing.T, url string, header string) (*testClient, string) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	req := "GET /mcp HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n" + header + "\r\n"
+	_, err = conn.Write([]byte(req))
+	require.NoError(t, err)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	// example of RFC 6455
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	return &testClient{conn: conn, br: br}, resp.Header.Get("Sec-WebSocket-Protocol")
+}
+
+func (c *testClient) writeFrame(t *testing.T, fin bool, opcode byte, payload []byte) {
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	default:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func (c *testClient) readFrame(t *testing.T) (byte, []byte) {
+	var header [2]byte
+	_, err := io.ReadFull(c.br, header[:])
+	require.NoError(t, err)
+	require.Zero(t, header[1]&0x80, "server frames must not be masked")
+	length := int(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.br, payload)
+	require.NoError(t, err)
+	return header[0] & 0x0f, payload
+}
+
+func TestConn(t *testing.T) {
+	received := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			msg, err := ws.ReadMessage()
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- msg
+			ws.WriteMessage(append([]byte("echo "), msg...))
+		}
+	}))
+	defer srv.Close()
+
+	client, protocol := dial(t, srv.URL, "Sec-WebSocket-Protocol: chat, mcp\r\n")
+	assert.Equal(t, Subprotocol, protocol)
+
+	client.writeFrame(t, true, opText, []byte("hello"))
+	assert.Equal(t, []byte("hello"), <-received)
+	op, payload := client.readFrame(t)
+	assert.Equal(t, byte(opText), op)
+	assert.Equal(t, "echo hello", string(payload))
+
+	// fragmented message with a ping in between
+	client.writeFrame(t, false, opText, []byte("frag"))
+	client.writeFrame(t, true, opPing, []byte("ping"))
+	op, payload = client.readFrame(t)
+	assert.Equal(t, byte(opPong), op)
+	assert.Equal(t, "ping", string(payload))
+	long := strings.Repeat("x", 300)
+	client.writeFrame(t, true, opContinuation, []byte(long))
+	assert.Equal(t, "frag"+long, string(<-received))
+	op, _ = client.readFrame(t)
+	assert.Equal(t, byte(opText), op)
+
+	client.writeFrame(t, true, opClose, binary.BigEndian.AppendUint16(nil, closeNormal))
+	op, payload = client.readFrame(t)
+	assert.Equal(t, byte(opClose), op)
+	assert.Equal(t, uint16(closeNormal), binary.BigEndian.Uint16(payload))
+	_, ok := <-received
+	assert.False(t, ok)
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Upgrade(w, r)
+	}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+}
+
+func TestUpgradeOrigin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ws, err := Upgrade(w, r); err == nil {
+			ws.Close()
+		}
+	}))
+	defer srv.Close()
+	defer func() { AllowedOrigins = nil }()
+	handshake := func(origin string) int {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/mcp", nil)
+		require.NoError(t, err)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusSwitchingProtocols, handshake(""))
+	assert.Equal(t, http.StatusSwitchingProtocols, handshake(srv.URL))
+	assert.Equal(t, http.StatusForbidden, handshake("https://evil.example.com"))
+	AllowedOrigins = []string{"https://ui.example.com"}
+	assert.Equal(t, http.StatusSwitchingProtocols, handshake("https://ui.example.com"))
+	assert.Equal(t, http.StatusForbidden, handshake("https://evil.example.com"))
+}
+
+type ctxKey struct{}
+
+func TestHandler(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "1"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "whoami"}, func(ctx context.Context, req *mcp.CallToolRequest, _ *struct{}) (*mcp.CallToolResult, any, error) {
+		// values of the request context, e.g. the token info, reach the tools
+		user, _ := ctx.Value(ctxKey{}).(string)
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: user}}}, nil, nil
+	})
+	handler := NewHandler(func(*http.Request) *mcp.Server { return server })
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, "alice")))
+	}))
+	defer srv.Close()
+
+	client, _ := dial(t, srv.URL, "")
+	client.writeFrame(t, true, opText, []byte(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`))
+	_, payload := client.readFrame(t)
+	assert.Contains(t, string(payload), `"serverInfo":{"name":"test","version":"1"}`)
+	client.writeFrame(t, true, opText, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized","params":{}}`))
+	client.writeFrame(t, true, opText, []byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"whoami","arguments":{}}}`))
+	_, payload = client.readFrame(t)
+	var resp struct {
+		ID     int                `json:"id"`
+		Result mcp.CallToolResult `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(payload, &resp))
+	assert.Equal(t, 2, resp.ID)
+	require.Len(t, resp.Result.Content, 1)
+	assert.Equal(t, "alice", resp.Result.Content[0].(*mcp.TextContent).Text)
+}
+
+func TestBearerFromProtocol(t *testing.T) {
+	var auth, protocols string
+	handler := BearerFromProtocol(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		protocols = r.Header.Get("Sec-WebSocket-Protocol")
+		Upgrade(w, r)
+	}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	_, protocol := dial(t, srv.URL, "Sec-WebSocket-Protocol: mcp, bearer.eyJhbGciOi.eyJzdWIi.c2ln\r\n")
+	assert.Equal(t, "Bearer eyJhbGciOi.eyJzdWIi.c2ln", auth)
+	assert.Equal(t, "mcp", protocols)
+	// the token is never echoed
+	assert.Equal(t, "mcp", protocol)
+
+	// a header set by the client wins
+	dial(t, srv.URL, "Authorization: Bearer header\r\nSec-WebSocket-Protocol: bearer.protocol, mcp\r\n")
+	assert.Equal(t, "Bearer header", auth)
+}
+
+func TestPing(t *testing.T) {
+	interval := PingInterval
+	PingInterval = 10 * time.Millisecond
+	defer func() { PingInterval = interval }()
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "1"}, nil)
+	srv := httptest.NewServer(NewHandler(func(*http.Request) *mcp.Server { return server }))
+	defer srv.Close()
+
+	client, _ := dial(t, srv.URL, "")
+	opcode, payload := client.readFrame(t)
+	assert.Equal(t, byte(opPing), opcode)
+	assert.Empty(t, payload)
+}
@@ -2,8 +2,6 @@ package remoteauth
 
 import (
 	"context"
-	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -28,6 +26,12 @@ var (
 type Oauth2Auth struct {
 	KeyFunc keyfunc.Keyfunc // Check oauth2 token func
 	JwksUri string
+	// expected iss claim, not checked if empty
+	Issuer string
+	// expected aud claim, Audience if empty
+	Audience string
+	// tolerated clock skew
+	Leeway time.Duration
 	claims  jwt.MapClaims
 }
 
@@ -41,49 +45,27 @@ func NewOutah2Auth() Oauth2Auth {
 // getJwksUri gets the jwks_uri from the OpenID Provider configuration information.
 // See https://openid.net/specs/openid-connect-discovery-1_0.html
 func GetJwksURI(issuer string, skipVerify bool) (string, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	if skipVerify {
-		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-	}
-	resp, err := client.Get(issuer + "/.well-known/openid-configuration")
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		slog.Warn("failed to get openid-configuration", "status", resp.Status, "url", issuer+"/.well-known/openid-configuration")
-		return "", fmt.Errorf("failed to get openid-configuration: %s", resp.Status)
-	}
-
-	openIDConfig := struct {
-		JwksURI string `json:"jwks_uri"`
-	}{}
-
-	err = json.NewDecoder(resp.Body).Decode(&openIDConfig)
+	config, err := Discover(issuer, skipVerify)
 	if err != nil {
+		slog.Warn("failed to get openid-configuration", "error", err, "url", issuer+"/.well-known/openid-configuration")
 		return "", err
 	}
-
-	return openIDConfig.JwksURI, nil
+	return config.JwksURI, nil
 }
 
 func (a *Oauth2Auth) VerifyJWT(ctx context.Context, tokenString string, r *http.Request) (*auth.TokenInfo, error) {
 	slog.Debug("verifier received token", "value", tokenString, "remote_addr", r.RemoteAddr)
 	claims := make(jwt.MapClaims)
-	token, err := jwt.ParseWithClaims(tokenString, claims, a.KeyFunc.Keyfunc, jwt.WithAudience(Audience),
-		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Name}))
+	token, err := jwt.ParseWithClaims(tokenString, claims, a.KeyFunc.Keyfunc, a.parserOptions()...)
 	if err != nil {
 		slog.Debug("couldn't parse or validate token", "error", err, "remote_addr", r.RemoteAddr)
-		return nil, fmt.Errorf("%v: %w", auth.ErrInvalidToken, err)
+		return nil, fmt.Errorf("%w: %w", auth.ErrInvalidToken, err)
 	}
 	if token.Valid {
 		expireTime, err := claims.GetExpirationTime()
 		if err != nil {
 			slog.Debug("failed to get expiration time from token", "error", err)
-			return nil, fmt.Errorf("%v: %w", auth.ErrInvalidToken, err)
+			return nil, fmt.Errorf("%w: %w", auth.ErrInvalidToken, err)
 		}
 		scopes, ok := claims["scope"].(string)
 		if !ok {
@@ -103,9 +85,13 @@ func (a *Oauth2Auth) VerifyJWT(ctx context.Context, tokenString string, r *http.
 		}
 
 		slog.Debug("token successfully validated", "scopes", strings.Split(scopes, " "), "roles", roles, "remote_addr", r.RemoteAddr)
+		// the subject identifies the caller in the audit log
+		subject, _ := claims["sub"].(string)
 		return &auth.TokenInfo{
 			Scopes:     strings.Split(scopes, " "),
-			Expiration: expireTime.Time,
+			// the middleware checks the expiration again without leeway
+			Expiration: expireTime.Time.Add(a.Leeway),
+			UserID:     subject,
 			Extra: map[string]any{
 				"roles": roles,
 			},
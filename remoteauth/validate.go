@@ -0,0 +1,138 @@
+package remoteauth
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"golang.org/x/time/rate"
+)
+
+// DefaultLeeway is the tolerated clock skew between the server and the
+// identity provider
+const DefaultLeeway = 30 * time.Second
+
+// Options of the token validation, the zero values select the defaults
+type Options struct {
+	// expected aud claim, Audience if empty
+	Audience string
+	// tolerated clock skew when checking exp, nbf and iat
+	Leeway time.Duration
+	// the cached keys are refreshed in this interval, one hour by default
+	RefreshInterval time.Duration
+	// a token signed by an unknown key, e.g. after a key rotation of the
+	// provider, refreshes the keys at most once in this interval, five
+	// minutes by default
+	RefreshUnknownKID time.Duration
+	SkipTLSVerify     bool
+}
+
+// ProviderConfig is the part of the OpenID provider configuration the
+// tokens are validated with
+type ProviderConfig struct {
+	Issuer  string `json:"issuer"`
+	JwksURI string `json:"jwks_uri"`
+}
+
+func httpClient(skipVerify bool) *http.Client {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if skipVerify {
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	return client
+}
+
+// Discover reads the OpenID provider configuration of the provider. See
+// https://openid.net/specs/openid-connect-discovery-1_0.html
+func Discover(provider string, skipVerify bool) (*ProviderConfig, error) {
+	configURL := strings.TrimSuffix(provider, "/") + "/.well-known/openid-configuration"
+	resp, err := httpClient(skipVerify).Get(configURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get openid-configuration: %s", resp.Status)
+	}
+	config := &ProviderConfig{}
+	if err := json.NewDecoder(resp.Body).Decode(config); err != nil {
+		return nil, err
+	}
+	if config.JwksURI == "" {
+		return nil, fmt.Errorf("openid-configuration of %s has no jwks_uri", provider)
+	}
+	return config, nil
+}
+
+// New discovers the issuer and the keys of the provider. The keys are
+// cached and refreshed in the background and when a token is signed by an
+// unknown key, so that key rotations of the provider are picked up.
+func New(ctx context.Context, provider string, opts Options) (*Oauth2Auth, error) {
+	config, err := Discover(provider, opts.SkipTLSVerify)
+	if err != nil {
+		return nil, err
+	}
+	override := keyfunc.Override{
+		Client:          httpClient(opts.SkipTLSVerify),
+		RefreshInterval: opts.RefreshInterval,
+	}
+	if opts.RefreshUnknownKID > 0 {
+		override.RefreshUnknownKID = rate.NewLimiter(rate.Every(opts.RefreshUnknownKID), 1)
+	}
+	keyf, err := keyfunc.NewDefaultOverrideCtx(ctx, []string{config.JwksURI}, override)
+	if err != nil {
+		return nil, err
+	}
+	a := &Oauth2Auth{
+		KeyFunc:  keyf,
+		JwksUri:  config.JwksURI,
+		Issuer:   config.Issuer,
+		Audience: opts.Audience,
+		Leeway:   opts.Leeway,
+	}
+	if a.Issuer == "" {
+		a.Issuer = provider
+	}
+	if a.Audience == "" {
+		a.Audience = Audience
+	}
+	return a, nil
+}
+
+// parserOptions are the checks of a token besides its signature, the
+// expiry is required
+func (a *Oauth2Auth) parserOptions() []jwt.ParserOption {
+	audience := a.Audience
+	if audience == "" {
+		audience = Audience
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithAudience(audience),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Name}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(a.Leeway),
+	}
+	if a.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(a.Issuer))
+	}
+	return opts
+}
+
+// Middleware returns the http middleware which rejects requests without a
+// valid bearer token carrying the scopes, the token info of the accepted
+// requests is passed to the tools in the context
+func (a *Oauth2Auth) Middleware(scopes []string) func(http.Handler) http.Handler {
+	return auth.RequireBearerToken(a.VerifyJWT, &auth.RequireBearerTokenOptions{
+		Scopes: scopes,
+	})
+}
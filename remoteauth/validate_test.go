@@ -0,0 +1,226 @@
+package remoteauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/modelcontextprotocol/go-sdk/auth"
+)
+
+// fakeIdP serves the OpenID configuration and the keys of an identity
+// provider, the keys can be rotated
+type fakeIdP struct {
+	*httptest.Server
+	mu   sync.Mutex
+	keys map[string]*rsa.PrivateKey
+	// number of requests of the JWKS
+	fetches int
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	idp := &fakeIdP{keys: make(map[string]*rsa.PrivateKey)}
+	idp.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(ProviderConfig{Issuer: idp.URL, JwksURI: idp.URL + "/certs"})
+		case "/certs":
+			idp.mu.Lock()
+			defer idp.mu.Unlock()
+			idp.fetches++
+			var keys []map[string]string
+			for kid, key := range idp.keys {
+				keys = append(keys, map[string]string{
+					"kty": "RSA",
+					"kid": kid,
+					"alg": "RS256",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(idp.Close)
+	idp.rotate(t, "key1")
+	return idp
+}
+
+// rotate replaces the keys of the provider by a new key
+func (idp *fakeIdP) rotate(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.keys = map[string]*rsa.PrivateKey{kid: key}
+}
+
+func (idp *fakeIdP) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	idp.mu.Lock()
+	key := idp.keys[kid]
+	idp.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (idp *fakeIdP) claims(modify func(jwt.MapClaims)) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   idp.URL,
+		"aud":   Audience,
+		"sub":   "alice",
+		"scope": "mcp:read mcp:write",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	if modify != nil {
+		modify(claims)
+	}
+	return claims
+}
+
+func TestVerifyJWT(t *testing.T) {
+	idp := newFakeIdP(t)
+	a, err := New(context.Background(), idp.URL, Options{Leeway: time.Minute})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if a.Issuer != idp.URL {
+		t.Errorf("expected issuer %s, got %s", idp.URL, a.Issuer)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+
+	info, err := a.VerifyJWT(context.Background(), idp.sign(t, "key1", idp.claims(nil)), req)
+	if err != nil {
+		t.Fatalf("expected valid token, got %v", err)
+	}
+	if info.UserID != "alice" || len(info.Scopes) != 2 {
+		t.Errorf("unexpected token info %+v", info)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+		valid  bool
+	}{
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other" }, false},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "http://evil.example.com" }, false},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-5 * time.Minute).Unix() }, false},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, false},
+		{"not yet valid", func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(5 * time.Minute).Unix() }, false},
+		{"issued in the future", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(5 * time.Minute).Unix() }, false},
+		// within the leeway
+		{"just expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-30 * time.Second).Unix() }, true},
+		{"clock behind", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(30 * time.Second).Unix() }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.VerifyJWT(context.Background(), idp.sign(t, "key1", idp.claims(tt.modify)), req)
+			if tt.valid && err != nil {
+				t.Errorf("expected valid token, got %v", err)
+			}
+			if !tt.valid && !errors.Is(err, auth.ErrInvalidToken) {
+				t.Errorf("expected invalid token, got %v", err)
+			}
+		})
+	}
+
+	t.Run("wrong signature", func(t *testing.T) {
+		other := newFakeIdP(t)
+		_, err := a.VerifyJWT(context.Background(), other.sign(t, "key1", idp.claims(nil)), req)
+		if !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("expected invalid token, got %v", err)
+		}
+	})
+
+	t.Run("HS256", func(t *testing.T) {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.claims(nil)).SignedString([]byte("secret"))
+		if _, err := a.VerifyJWT(context.Background(), token, req); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("expected invalid token, got %v", err)
+		}
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	idp := newFakeIdP(t)
+	a, err := New(context.Background(), idp.URL, Options{RefreshUnknownKID: time.Millisecond})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	for range 3 {
+		if _, err := a.VerifyJWT(context.Background(), idp.sign(t, "key1", idp.claims(nil)), req); err != nil {
+			t.Fatalf("expected valid token, got %v", err)
+		}
+	}
+	idp.mu.Lock()
+	fetches := idp.fetches
+	idp.mu.Unlock()
+	if fetches != 1 {
+		t.Errorf("expected the keys to be cached, fetched %d times", fetches)
+	}
+
+	// the unknown key refreshes the cache
+	idp.rotate(t, "key2")
+	time.Sleep(5 * time.Millisecond)
+	if _, err := a.VerifyJWT(context.Background(), idp.sign(t, "key2", idp.claims(nil)), req); err != nil {
+		t.Fatalf("expected token of the rotated key to be valid, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	idp := newFakeIdP(t)
+	a, err := New(context.Background(), idp.URL, Options{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	handler := a.Middleware([]string{"mcp:read"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ti := auth.TokenInfoFromContext(r.Context()); ti == nil || ti.UserID != "alice" {
+			t.Errorf("expected token info of alice, got %+v", ti)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"valid", idp.sign(t, "key1", idp.claims(nil)), http.StatusOK},
+		{"no token", "", http.StatusUnauthorized},
+		{"expired", idp.sign(t, "key1", idp.claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() })), http.StatusUnauthorized},
+		{"missing scope", idp.sign(t, "key1", idp.claims(func(c jwt.MapClaims) { c["scope"] = "profile" })), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected status %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// drainer lets the calls in flight finish when the server is stopped, e.g.
+// by systemctl stop, before the sessions and the connections are closed
+type drainer struct {
+	server  *mcp.Server
+	timeout time.Duration
+	calls   atomic.Int64
+}
+
+func newDrainer(server *mcp.Server, timeout time.Duration) *drainer {
+	d := &drainer{server: server, timeout: timeout}
+	server.AddReceivingMiddleware(d.Middleware)
+	return d
+}
+
+// Middleware counts the requests in flight
+func (d *drainer) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		d.calls.Add(1)
+		defer d.calls.Add(-1)
+		return next(ctx, method, req)
+	}
+}
+
+// wait returns once no calls are in flight or the context ends
+func (d *drainer) wait(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for d.calls.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d calls still in flight after %s", d.calls.Load(), d.timeout)
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// closeSessions ends the sessions, which also ends their event streams
+func (d *drainer) closeSessions() {
+	for session := range d.server.Sessions() {
+		session.Close()
+	}
+}
+
+// serve runs the http server until the context ends. Then it stops accepting
+// connections, waits up to the timeout for the calls in flight and closes the
+// sessions, whose event streams would keep the connections open otherwise.
+func (d *drainer) serve(ctx context.Context, s *http.Server, serve func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	drainCtx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(drainCtx)
+	}()
+	if err := d.wait(drainCtx); err != nil {
+		// closing a session waits for its calls, so the connections are
+		// closed instead
+		s.Close()
+		return err
+	}
+	d.closeSessions()
+	if err := <-shutdown; err != nil {
+		s.Close()
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serveListener accepts connections with serve until the context ends. Then
+// it closes the listener, waits up to the timeout for the calls in flight and
+// closes the sessions.
+func (d *drainer) serveListener(ctx context.Context, l net.Listener, serve func(net.Listener) error) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve(l)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	l.Close()
+	drainCtx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	if err := d.wait(drainCtx); err != nil {
+		// closing a session waits for its calls
+		return err
+	}
+	d.closeSessions()
+	return <-errc
+}
+
+// run serves over stdio until the context ends and the calls in flight
+// finished, the session keeps the values of the context, e.g. the transport
+func (d *drainer) run(ctx context.Context, transport mcp.Transport) error {
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-runCtx.Done():
+			return
+		}
+		drainCtx, cancelDrain := context.WithTimeout(context.Background(), d.timeout)
+		defer cancelDrain()
+		d.wait(drainCtx)
+		cancel()
+	}()
+	err := d.server.Run(runCtx, transport)
+	if runCtx.Err() != nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startDrained serves a server with a tool which blocks until release is
+// closed, the call is started and in flight when it returns
+func startDrained(t *testing.T, timeout time.Duration, release chan struct{}) (context.CancelFunc, chan error, chan error) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	started := make(chan struct{})
+	mcp.AddTool(server, &mcp.Tool{Name: "slow"}, func(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
+		close(started)
+		<-release
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "done"}}}, nil, nil
+	})
+	drain := newDrainer(server, timeout)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &http.Server{Handler: mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil)}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- drain.serve(ctx, s, func() error { return s.Serve(l) })
+	}()
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil)
+	session, err := client.Connect(context.Background(), &mcp.StreamableClientTransport{Endpoint: "http://" + l.Addr().String(), MaxRetries: -1}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { session.Close() })
+	called := make(chan error, 1)
+	go func() {
+		_, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "slow"})
+		called <- err
+	}()
+	<-started
+	return cancel, served, called
+}
+
+func TestDrainerServe(t *testing.T) {
+	release := make(chan struct{})
+	stop, served, called := startDrained(t, 5*time.Second, release)
+	stop()
+	// the server waits for the call in flight
+	select {
+	case err := <-served:
+		t.Fatalf("server returned with a call in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	assert.NoError(t, <-called)
+	select {
+	case err := <-served:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server wasn't shut down after the call finished")
+	}
+}
+
+func TestDrainerTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	stop, served, _ := startDrained(t, 100*time.Millisecond, release)
+	stop()
+	select {
+	case err := <-served:
+		assert.ErrorContains(t, err, "1 calls still in flight")
+	case <-time.After(5 * time.Second):
+		t.Fatal("server wasn't shut down after the drain timeout")
+	}
+}
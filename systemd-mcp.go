@@ -2,29 +2,64 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"slices"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	_ "embed"
 
 	"github.com/cheynewallace/tabby"
-	"github.com/modelcontextprotocol/go-sdk/auth"
+	godbus "github.com/godbus/dbus/v5"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/modelcontextprotocol/go-sdk/oauthex"
 	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/audit"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/batch"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/confirm"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/dbusapi"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/deadline"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/dryrun"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/file"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/journal"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/lang"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/logind"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/machine"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/man"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/metrics"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/network"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/notify"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/oomd"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/policy"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/polkit"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/power"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/ratelimit"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/reqlog"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/resolved"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/safety"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/storage"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/sysusers"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/toolgroup"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/tpm"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/tracing"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/varlink"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/websocket"
 	"github.com/openSUSE/systemd-mcp/remoteauth"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -32,6 +67,7 @@ const (
 	DBusName    = "org.opensuse.systemdmcp"
 	DBusPath    = "/org/opensuse/systemdmcp"
 	mcpPath     = "/mcp"
+	metricsPath = "/metrics"
 	magicNoauth = "ThisIsInsecure"
 )
 
@@ -52,6 +88,16 @@ func NewRootCmd() *cobra.Command {
 			viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 			viper.AutomaticEnv()
 			viper.BindPFlags(cmd.Flags())
+			if err := loadConfig(cmd); err != nil {
+				return err
+			}
+			if viper.GetBool("check-config") {
+				if err := checkConfig(); err != nil {
+					return err
+				}
+				fmt.Println("configuration is valid")
+				return nil
+			}
 
 			logLevel := slog.LevelInfo
 			if viper.GetBool("debug") {
@@ -80,32 +126,166 @@ func NewRootCmd() *cobra.Command {
 			slog.SetDefault(logger)
 			slog.Debug("Logger initialized", "level", logLevel)
 
+			// systemctl stop sends SIGTERM, the calls in flight are drained
+			// before the connections to systemd and the journal are closed
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			drainTimeout := viper.GetDuration("drain-timeout")
+
 			var authorization authkeeper.AuthKeeper
+			var elicit *authkeeper.ElicitAuth
 			var err error
 
-			isHttp := viper.GetString("http") != ""
+			isHttp := viper.GetString("http") != "" || viper.GetString("ws") != ""
 			hasNoauth := viper.GetString("noauth") == magicNoauth
 			hasController := viper.GetString("controller") != ""
 
 			if isHttp && !hasNoauth && !hasController {
 				return fmt.Errorf("http mode requires either --controller or --noauth=" + magicNoauth)
 			}
+			listen := viper.GetString("listen")
+			if listen != "" && !strings.HasPrefix(listen, "unix:") {
+				return fmt.Errorf("invalid --listen %s, use unix:PATH", listen)
+			}
+			varlinkAddr := viper.GetString("varlink")
+			if varlinkAddr != "" && !strings.HasPrefix(varlinkAddr, "unix:") {
+				return fmt.Errorf("invalid --varlink %s, use unix:PATH", varlinkAddr)
+			}
+			isUnix := listen != "" || varlinkAddr != ""
+			// stdio is served if no other transport is given or next to them
+			// with --stdio
+			isStdio := viper.GetBool("stdio") || (!isHttp && !isUnix)
+			if viper.GetString("tls-client-ca") != "" && viper.GetString("cert-file") == "" {
+				return fmt.Errorf("--tls-client-ca requires --tls-cert and --tls-key")
+			}
+			// with a client CA the http and websocket clients have to present
+			// a certificate signed by it
+			serverTLS, err := clientTLSConfig(viper.GetString("tls-client-ca"))
+			if err != nil {
+				return err
+			}
 
+			// the bearer tokens are verified by the authorization of the http
+			// transports itself, the tools are authorized through the policy
+			var bearerAuth authkeeper.AuthKeeper
 			if hasNoauth {
 				authorization, _ = authkeeper.NewNoAuth(true, true)
-			} else if hasController {
-				authorization, err = authkeeper.NewOauth(viper.GetString("controller"), viper.GetBool("skip-tls-verify"))
-				if err != nil {
-					return fmt.Errorf("couldn't create connection to controller: %w", err)
-				}
 			} else {
-				authorization, err = authkeeper.NewPolkitAuth(DBusName, DBusPath, viper.GetUint32("timeout"))
-				if err != nil {
-					return fmt.Errorf("failed to setup dbus: %w", err)
+				// every transport in use gets its own authorization, the one
+				// of the network transports, else of the unix sockets, else
+				// of stdio authorizes the calls without transport, e.g. over
+				// the dbus API
+				keepers := make(map[string]authkeeper.AuthKeeper)
+				closeKeepers := func() {
+					for _, keeper := range keepers {
+						keeper.Close()
+					}
+				}
+				fallback := authkeeper.TransportStdio
+				if isStdio {
+					stdioAuth, err := authkeeper.NewPolkitAuth(DBusName, DBusPath, viper.GetUint32("timeout"))
+					if err != nil {
+						return fmt.Errorf("failed to setup dbus: %w", err)
+					}
+					if viper.GetBool("elicit-approval") {
+						// without polkit agent the user of the client is asked
+						elicit = authkeeper.NewElicitAuth(stdioAuth)
+						stdioAuth = elicit
+					}
+					keepers[authkeeper.TransportStdio] = stdioAuth
+				}
+				if isUnix {
+					// the peers of the unix socket are authorized by their
+					// credentials, nobody is asked
+					peerAuth, err := authkeeper.NewPeerCredAuth(viper.GetStringSlice("listen-read"), viper.GetStringSlice("listen-write"))
+					if err != nil {
+						closeKeepers()
+						return err
+					}
+					keepers[authkeeper.TransportUnix] = peerAuth
+					fallback = authkeeper.TransportUnix
+				}
+				if isHttp {
+					bearerAuth, err = authkeeper.NewOauth(viper.GetString("controller"), remoteauth.Options{
+						Audience:      viper.GetString("audience"),
+						Leeway:        viper.GetDuration("token-leeway"),
+						SkipTLSVerify: viper.GetBool("skip-tls-verify"),
+					})
+					if err != nil {
+						closeKeepers()
+						return fmt.Errorf("couldn't create connection to controller: %w", err)
+					}
+					keepers[authkeeper.TransportHTTP] = bearerAuth
+					fallback = authkeeper.TransportHTTP
+				}
+				if len(keepers) == 1 {
+					authorization = keepers[fallback]
+				} else {
+					authorization = authkeeper.NewTransportAuth(keepers, fallback)
 				}
 			}
 			defer authorization.Close()
+			// the authorizations granted to a session are kept for the ttl
+			var grants *authkeeper.GrantAuth
+			// the connection owning DBusName, shared with the dbus API
+			var renewConn *godbus.Conn
+			if ttl := viper.GetDuration("auth-ttl"); ttl > 0 {
+				grants = authkeeper.NewGrantAuth(authorization, ttl)
+				authorization = grants
+				if conn, err := grants.ServeRenewal(DBusName, DBusPath); err != nil {
+					slog.Warn("couldn't export the renewal of the authorizations over dbus", slog.Any("error", err))
+				} else {
+					defer conn.Close()
+					renewConn = conn
+				}
+			}
+			var pol *policy.Policy
+			if policyFile := viper.GetString("policy-file"); policyFile != "" {
+				if pol, err = policy.Load(policyFile); err != nil {
+					return err
+				}
+				authorization = policy.NewKeeper(authorization, pol)
+			}
+			// every session keeps to the client first authorized in it
+			sessions := authkeeper.NewSessionAuth(authorization)
+			authorization = sessions
+			// the units of the policy file add to the ones of the flags
+			allowedUnits, deniedUnits := viper.GetStringSlice("allowed-units"), viper.GetStringSlice("denied-units")
+			if pol != nil {
+				allowedUnits = append(allowedUnits, pol.Allowed...)
+				deniedUnits = append(deniedUnits, pol.Denied...)
+			}
+			unitAccess, err := policy.NewUnitAccess(allowedUnits, deniedUnits)
+			if err != nil {
+				return err
+			}
+			file.Units = unitAccess
+			file.Roots = viper.GetStringSlice("file-roots")
+			file.WriteRoots = viper.GetStringSlice("file-write-roots")
+			file.Auth = authorization
+			// a client calling a tool in a loop can't saturate dbus or the
+			// journal
+			limiter := ratelimit.New(viper.GetFloat64("rate-limit"), viper.GetInt("rate-burst"), viper.GetInt("max-concurrent-dbus-calls"))
+			if err := limiter.SetToolRates(viper.GetStringSlice("tool-rate-limit")); err != nil {
+				return err
+			}
+			// a hung systemd or a slow journal can't make the calls pile up,
+			// the tools waiting for jobs or entries get their waits on top
+			callDeadline := deadline.New(viper.GetDuration("call-timeout"))
+			if timeout := viper.GetDuration("call-timeout"); timeout > 0 {
+				callDeadline.SetToolTimeout("follow_log", timeout+journal.MaxFollowSeconds*time.Second)
+				callDeadline.SetToolTimeout("change_unit_state", timeout+time.Duration(systemd.MaxTimeOut)*time.Second)
+				// wait for the job of every unit
+				callDeadline.SetToolTimeout("apply_state", 0)
+				callDeadline.SetToolTimeout("apply_plan", 0)
+			}
+			if err := callDeadline.SetToolTimeouts(viper.GetStringSlice("tool-call-timeout")); err != nil {
+				return err
+			}
 
+			// the connection serving the unit resources, set once connected
+			// to systemd
+			var unitResources *systemd.Connection
 			server := mcp.NewServer(&mcp.Implementation{
 				Name:    "Systemd connection",
 				Version: strings.TrimSpace(version),
@@ -113,13 +293,92 @@ func NewRootCmd() *cobra.Command {
 				&mcp.ServerOptions{
 					InitializedHandler: func(ctx context.Context, req *mcp.InitializedRequest) {
 						slog.Debug("Session started", "ID", req.Session.ID())
+						go func() {
+							req.Session.Wait()
+							sessions.Forget(req.Session.ID())
+							limiter.Forget(req.Session.ID())
+						}()
+					},
+					SubscribeHandler: func(ctx context.Context, req *mcp.SubscribeRequest) error {
+						if unitResources == nil {
+							return fmt.Errorf("no connection to systemd")
+						}
+						return unitResources.SubscribeUnitResource(ctx, req)
+					},
+					UnsubscribeHandler: func(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+						return nil
 					},
 				})
+			var tagger *lang.Tagger
+			if viper.GetBool("detect-language") || viper.GetString("translate-cmd") != "" {
+				tagger = lang.NewTagger(strings.Fields(viper.GetString("translate-cmd")), viper.GetString("translate-to"))
+			}
+			members, err := journal.ParseMembers(viper.GetStringSlice("journal-remote"))
+			if err != nil {
+				return err
+			}
+			// the metrics are only collected if they are served
+			var serverMetrics *metrics.Metrics
+			if viper.GetBool("metrics") {
+				serverMetrics = metrics.New()
+			}
+			// the tool calls and their dbus calls are traced if a collector
+			// is configured
+			var tracer *tracing.Tracer
+			if endpoint := viper.GetString("otlp-endpoint"); endpoint != "" {
+				tracer, err = tracing.New(endpoint, viper.GetStringSlice("otlp-header"), "systemd-mcp", strings.TrimSpace(version))
+				if err != nil {
+					return err
+				}
+				defer func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					tracer.Shutdown(ctx)
+				}()
+			}
+			syslog := journal.HostLog{
+				Auth:       authorization,
+				Lang:       tagger,
+				Units:      unitAccess,
+				Metrics:    serverMetrics,
+				MaxEntries: viper.GetInt("journal-max-entries"),
+				Remote: &journal.RemoteLog{
+					Gateway:    viper.GetString("journal-gateway"),
+					Members:    members,
+					Dir:        viper.GetString("remote-journal-dir"),
+					Auth:       authorization,
+					Lang:       tagger,
+					Units:      unitAccess,
+					Metrics:    serverMetrics,
+					MaxEntries: viper.GetInt("journal-max-entries"),
+				},
+			}
+			defer syslog.Close()
+			// the calls of the write tools are recorded
+			auditLog := audit.New(viper.GetString("audit-file"), authorization, &syslog)
+			systemd.OwnersPath = viper.GetString("owners-file")
+			systemd.RestartLimit = viper.GetInt("restart-limit")
+			systemd.RestartWindow = viper.GetDuration("restart-window")
+			perItem := viper.GetBool("per-item-content")
 			systemConn, err := systemd.NewSystem(context.Background(), authorization)
 			if err != nil {
 				slog.Warn("couldn't add systemd tools", slog.Any("error", err))
 			}
 
+			if viper.GetBool("check-drift") {
+				if systemConn == nil {
+					return fmt.Errorf("no connection to systemd")
+				}
+				defer systemConn.Close()
+				return checkDrift(context.Background(), systemConn)
+			}
+
+			// read-only tools are registered with batch.AddTool so that they
+			// can be combined in a single batch call
+			batchTools := batch.New()
+			batchTools.SetPolicy(pol)
+			// mutating tools are destructive unless marked otherwise
+			notDestructive := false
 			tools := []struct {
 				Tool     *mcp.Tool
 				Register func(server *mcp.Server, tool *mcp.Tool)
@@ -127,19 +386,410 @@ func NewRootCmd() *cobra.Command {
 
 			if systemConn != nil {
 				defer systemConn.Close()
+				systemConn.SetLogReader(&syslog)
+				systemConn.SetTagger(tagger)
+				systemConn.SetUnitAccess(unitAccess)
+				systemConn.SetPolicy(pol)
+				systemConn.SetPropertyCache(viper.GetDuration("property-ttl"))
+				systemConn.SetMaxResultSize(viper.GetInt("max-result-size"))
+				systemConn.SetMetrics(serverMetrics)
+				if userConn, err := systemd.NewUser(context.Background()); err != nil {
+					slog.Debug("no connection to the user manager", "error", err)
+				} else {
+					defer userConn.Close()
+					userConn.SetTagger(tagger)
+					userConn.SetUnitAccess(unitAccess)
+					userConn.SetMetrics(serverMetrics)
+					systemConn.SetUserConnection(userConn)
+				}
+				unitResources = systemConn
+				server.AddResourceTemplate(&mcp.ResourceTemplate{
+					Name:        "unit",
+					Title:       "State of a unit",
+					URITemplate: systemd.UnitResourceTemplate,
+					Description: "Load, active and sub state of a systemd unit. Subscribers are notified when the active state changes.",
+					MIMEType:    "application/json",
+				}, systemConn.ReadUnitResource)
 				tools = append(tools,
 					struct {
 						Tool     *mcp.Tool
 						Register func(server *mcp.Server, tool *mcp.Tool)
 					}{
 						Tool: &mcp.Tool{
-							Title:       "List loaded units",
-							Name:        "list_loaded_units",
-							Description: fmt.Sprintf("List systemd units that are currently loaded in memory. Filter by states (%v) or patterns. Can return detailed properties.", systemd.ValidStates()),
-							InputSchema: systemd.CreateListLoadedUnitsSchema(),
+							Title:        "List loaded units",
+							Name:         "list_loaded_units",
+							Description:  fmt.Sprintf("List systemd units that are currently loaded in memory. Filter by states (%v) or patterns. Can return detailed properties. Supports paging and sorting by name, state, memory or cpu. With scope the units of the user manager are listed, or merged with the system units.", systemd.ValidStates()),
+							InputSchema:  systemd.CreateListLoadedUnitsSchema(),
+							OutputSchema: safety.OutputSchema[util.Items[any]](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, util.WithContentItems(systemConn.ListLoadedUnits, perItem))
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "List unit files",
+							Name:         "list_unit_files",
+							Description:  fmt.Sprintf("List all systemd unit files on disk. Filter by enablement states (%v) or patterns.", systemd.ValidUnitFileStates()),
+							InputSchema:  systemd.CreateListUnitFilesSchema(),
+							OutputSchema: safety.OutputSchema[util.Items[any]](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, util.WithContentItems(systemConn.ListUnitFiles, perItem))
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Show unit properties",
+							Name:         "show_unit",
+							Description:  "Return only the requested properties (e.g. MainPID, ActiveState, NRestarts) of one or more units, like 'systemctl show -p'.",
+							InputSchema:  systemd.CreateShowUnitSchema(),
+							OutputSchema: safety.OutputSchema[util.Items[systemd.ShowUnitResult]](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, systemConn.ShowUnit)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Get unit file content",
+							Name:         "get_unit_file_content",
+							Description:  "Return the unit file and the drop-ins of a unit like 'systemctl cat', together with its invocation id and the runtime markers of systemd. For transient and generated units without a fragment on disk the definition is read from /run/systemd.",
+							InputSchema:  systemd.CreateGetUnitFileContentSchema(),
+							OutputSchema: safety.OutputSchema[systemd.UnitFileContentResult](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, systemConn.GetUnitFileContent)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Get default target",
+							Name:         "get_default_target",
+							Description:  "Return the target the system boots into together with the loaded targets, their state and whether they can be isolated with switch_target.",
+							InputSchema:  systemd.CreateGetDefaultTargetSchema(),
+							OutputSchema: safety.OutputSchema[systemd.DefaultTargetResult](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, systemConn.GetDefaultTarget)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "System overview",
+							Name:         "system_overview",
+							Description:  "Return the systemd version, system state, number of failed units and jobs, uptime, virtualization, taint flags and architecture in one compact result, as cheap health probe.",
+							InputSchema:  systemd.CreateSystemOverviewSchema(),
+							OutputSchema: safety.OutputSchema[systemd.SystemOverview](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, systemConn.SystemOverview)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Triage failed units",
+							Name:         "failed_units",
+							Description:  "List failed units together with their result, exit code of the main process and the last journal lines, so that a single call is enough for triage.",
+							InputSchema:  systemd.CreateFailedUnitsSchema(),
+							OutputSchema: safety.OutputSchema[systemd.FailedUnitsResult](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, systemConn.ListFailedUnits)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Why is a unit not running",
+							Name:         "why_not_running",
+							Description:  "Explain why systemd doesn't start or refuses to start a unit by inspecting its load state, conditions, asserts, start rate limit, required units and recent job results.",
+							InputSchema:  systemd.CreateWhyNotRunningSchema(),
+							OutputSchema: safety.OutputSchema[systemd.WhyNotRunningResult](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, systemConn.WhyNotRunning)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Get runbook",
+							Name:         "get_runbook",
+							Description:  "Return the site specific markdown runbook stored for a unit or its template and the runbook link of its owners. Triage results mark units with a stored runbook with has_runbook.",
+							InputSchema:  systemd.CreateGetRunbookSchema(),
+							OutputSchema: safety.OutputSchema[systemd.RunbookResult](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, systemConn.GetRunbook)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Set runbook",
+							Name:         "set_runbook",
+							Description:  "Store a short markdown runbook with site specific procedures for a unit, or remove it if the content is empty.",
+							InputSchema:  systemd.CreateSetRunbookSchema(),
+							OutputSchema: safety.OutputSchema[util.Message](),
+							Annotations:  &mcp.ToolAnnotations{DestructiveHint: &notDestructive},
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.SetRunbook)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Analyze service security",
+							Name:         "analyze_security",
+							Description:  "Return the sandboxing exposure score (0.0 safe to 10.0 unsafe) and the per-directive findings of 'systemd-analyze security' for a service, together with the directives which would reduce the exposure most. Use it to suggest hardening options.",
+							InputSchema:  systemd.CreateAnalyzeSecuritySchema(),
+							OutputSchema: safety.OutputSchema[systemd.AnalyzeSecurityResult](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, systemConn.AnalyzeSecurity)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Diff unit state",
+							Name:         "diff_unit_state",
+							Description:  "Snapshot the properties of a unit on the first call and return only the changed properties on later calls, e.g. to see what changed after a restart.",
+							InputSchema:  systemd.CreateDiffUnitStateSchema(),
+							OutputSchema: safety.OutputSchema[systemd.DiffUnitStateResult](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, systemConn.DiffUnitState)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Check authorization",
+							Name:         "can_i",
+							Description:  "Report if calling a tool, e.g. change_unit_state with an action and unit, would be authorized and by which mechanism (noauth, root, polkit or oauth2), without calling it and without asking the user. Reports also if the restart limit would refuse the action.",
+							InputSchema:  systemd.CreateCanISchema(),
+							OutputSchema: safety.OutputSchema[systemd.CanIResult](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, systemConn.CanI)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Change unit state",
+							Name:         "change_unit_state",
+							Description:  "Change the state of a unit or service (start, stop, restart, reload, enable, disable, reset_failed).",
+							InputSchema:  systemd.CreateChangeInputSchema(),
+							OutputSchema: safety.OutputSchema[util.Items[any]](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, util.WithContentItems(systemConn.ChangeUnitState, perItem))
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Create delegation",
+							Name:         "create_delegation",
+							Description:  "Create a bearer token which lets any session holding it perform the given actions of change_unit_state on the given units without further authorization until it expires, e.g. restart two services for the next hour. Actions the policy denies can't be delegated.",
+							InputSchema:  systemd.CreateCreateDelegationSchema(),
+							OutputSchema: safety.OutputSchema[systemd.CreateDelegationResult](),
+							Annotations:  &mcp.ToolAnnotations{DestructiveHint: &notDestructive},
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.CreateDelegation)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Revoke delegation",
+							Name:         "revoke_delegation",
+							Description:  "Revoke a delegation created by create_delegation before it expires.",
+							InputSchema:  systemd.CreateRevokeDelegationSchema(),
+							OutputSchema: safety.OutputSchema[util.Message](),
+							Annotations:  &mcp.ToolAnnotations{DestructiveHint: &notDestructive},
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.RevokeDelegation)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Install unit file",
+							Name:         "install_unit",
+							Description:  "Install a new unit file with the given content in /etc/systemd/system, reload the manager and optionally enable and start the unit. The file is removed again if systemd can't load the unit or a later step fails.",
+							InputSchema:  systemd.CreateInstallUnitSchema(),
+							OutputSchema: safety.OutputSchema[systemd.InstallUnitResult](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.InstallUnit)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Journal upload",
+							Name:         "journal_upload",
+							Description:  "Report if the journal is uploaded to a central collector by systemd-journal-upload, with the configuration, the service state and the last uploaded entry. With url the upload to this collector and the certificates is configured, enabled and restarted.",
+							InputSchema:  systemd.CreateJournalUploadSchema(),
+							OutputSchema: safety.OutputSchema[systemd.JournalUploadResult](),
+							Annotations:  &mcp.ToolAnnotations{DestructiveHint: &notDestructive},
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.JournalUpload)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Get environment",
+							Name:         "get_environment",
+							Description:  "Show the environment of the service manager and, for a given unit, the environment its processes inherit.",
+							InputSchema:  systemd.CreateGetEnvironmentSchema(),
+							OutputSchema: safety.OutputSchema[systemd.EnvironmentResult](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, systemConn.GetEnvironment)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Set environment",
+							Name:         "set_environment",
+							Description:  "Set variables in the environment of the service manager (e.g. proxies), units inherit them on their next start.",
+							InputSchema:  systemd.CreateSetEnvironmentSchema(),
+							OutputSchema: safety.OutputSchema[util.Message](),
+							Annotations:  &mcp.ToolAnnotations{DestructiveHint: &notDestructive},
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.SetEnvironment)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Unset environment",
+							Name:         "unset_environment",
+							Description:  "Remove variables from the environment of the service manager.",
+							InputSchema:  systemd.CreateUnsetEnvironmentSchema(),
+							OutputSchema: safety.OutputSchema[util.Message](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.UnsetEnvironment)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Apply desired state",
+							Name:         "apply_state",
+							Description:  "Compare a YAML or JSON manifest of desired unit states, drop-ins and sysctl values with the host and show the plan. With apply set, the plan is applied and rolled back if a step fails.",
+							InputSchema:  systemd.CreateApplySchema(),
+							OutputSchema: safety.OutputSchema[systemd.ApplyResult](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.ApplyManifest)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Apply plan",
+							Name:         "apply_plan",
+							Description:  "Perform an ordered list of operations like writing a drop-in, enabling and restarting units as one transaction: all operations are validated up-front, and if one fails the performed ones are reverted. Restarts and reloads can't be reverted and are reported as not_reverted. Returns a report of every step.",
+							InputSchema:  systemd.CreateApplyPlanSchema(),
+							OutputSchema: safety.OutputSchema[systemd.ApplyPlanResult](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.ApplyPlan)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Export manifest",
+							Name:         "export_state",
+							Description:  "Export the enabled units, their active state, the drop-ins and the given sysctl values of the host as manifest which can be applied on another host with apply_state.",
+							InputSchema:  systemd.CreateExportManifestSchema(),
+							OutputSchema: safety.OutputSchema[systemd.Manifest](),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							batch.AddTool(batchTools, server, tool, systemConn.ExportManifest)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Save baseline",
+							Name:         "save_baseline",
+							Description:  "Store the enabled units, their active state, the drop-ins and the given sysctl values of the host as baseline for check_drift.",
+							InputSchema:  systemd.CreateSaveBaselineSchema(),
+							OutputSchema: safety.OutputSchema[util.Message](),
+							Annotations:  &mcp.ToolAnnotations{DestructiveHint: &notDestructive},
 						},
 						Register: func(server *mcp.Server, tool *mcp.Tool) {
-							mcp.AddTool(server, tool, systemConn.ListLoadedUnits)
+							mcp.AddTool(server, tool, systemConn.SaveBaseline)
 						},
 					},
 					struct {
@@ -147,13 +797,14 @@ func NewRootCmd() *cobra.Command {
 						Register func(server *mcp.Server, tool *mcp.Tool)
 					}{
 						Tool: &mcp.Tool{
-							Title:       "List unit files",
-							Name:        "list_unit_files",
-							Description: fmt.Sprintf("List all systemd unit files on disk. Filter by enablement states (%v) or patterns.", systemd.ValidUnitFileStates()),
-							InputSchema: systemd.CreateListUnitFilesSchema(),
+							Title:        "Check drift",
+							Name:         "check_drift",
+							Description:  "Compare the host against the stored or given baseline manifest and list the deviations with their severity, including enabled units and drop-ins which aren't in the baseline.",
+							InputSchema:  systemd.CreateCheckDriftSchema(),
+							OutputSchema: safety.OutputSchema[systemd.DriftResult](),
 						},
 						Register: func(server *mcp.Server, tool *mcp.Tool) {
-							mcp.AddTool(server, tool, systemConn.ListUnitFiles)
+							batch.AddTool(batchTools, server, tool, systemConn.CheckDrift)
 						},
 					},
 					struct {
@@ -161,13 +812,14 @@ func NewRootCmd() *cobra.Command {
 						Register func(server *mcp.Server, tool *mcp.Tool)
 					}{
 						Tool: &mcp.Tool{
-							Title:       "Change unit state",
-							Name:        "change_unit_state",
-							Description: "Change the state of a unit or service (start, stop, restart, reload, enable, disable).",
-							InputSchema: systemd.CreateChangeInputSchema(),
+							Title:        "Switch target",
+							Name:         "switch_target",
+							Description:  "Isolate a target like multi-user.target, which stops all units the target doesn't pull in. Requires confirm set to true and its own polkit authorization.",
+							InputSchema:  systemd.CreateSwitchTargetSchema(),
+							OutputSchema: safety.OutputSchema[util.Message](),
 						},
 						Register: func(server *mcp.Server, tool *mcp.Tool) {
-							mcp.AddTool(server, tool, systemConn.ChangeUnitState)
+							mcp.AddTool(server, tool, systemConn.SwitchTarget)
 						},
 					},
 					struct {
@@ -175,9 +827,26 @@ func NewRootCmd() *cobra.Command {
 						Register func(server *mcp.Server, tool *mcp.Tool)
 					}{
 						Tool: &mcp.Tool{
-							Title:       "Check restart/reload status",
-							Name:        "check_restart_reload",
-							Description: "Check the reload or restart status of a unit. Can only be called if the restart or reload job timed out.",
+							Title:        "Set default target",
+							Name:         "set_default_target",
+							Description:  "Set the target the system boots into, e.g. graphical.target or multi-user.target, like 'systemctl set-default'. The running units aren't changed, use switch_target for that.",
+							InputSchema:  systemd.CreateSetDefaultTargetSchema(),
+							OutputSchema: safety.OutputSchema[util.Message](),
+							Annotations:  &mcp.ToolAnnotations{DestructiveHint: &notDestructive},
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.SetDefaultTarget)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:        "Check restart/reload status",
+							Name:         "check_restart_reload",
+							Description:  "Check the reload or restart status of a unit. Can only be called if the restart or reload job timed out.",
+							OutputSchema: safety.OutputSchema[util.Message](),
 						},
 						Register: func(server *mcp.Server, tool *mcp.Tool) {
 							mcp.AddTool(server, tool, systemConn.CheckForRestartReloadRunning)
@@ -185,45 +854,280 @@ func NewRootCmd() *cobra.Command {
 					},
 				)
 			}
-			syslog := journal.HostLog{
+			if err != nil {
+				slog.Warn("couldn't open log, not adding journal tool", slog.Any("error", err))
+			} else {
+				tools = append(tools, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "List system log",
+						Name:         "list_log",
+						Description:  "Get the last log entries for the given service or unit. With host the log of a remote host forwarding its journal to this host is read.",
+						InputSchema:  journal.CreateListLogsSchema(),
+						OutputSchema: safety.OutputSchema[journal.ListLogResult](),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						batch.AddTool(batchTools, server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *journal.ListLogParams) (*mcp.CallToolResult, any, error) {
+							res, out, err := syslog.ListLog(ctx, req, args)
+							return res, out, err
+						})
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "Compare boots",
+						Name:         "compare_boots",
+						Description:  "Compare the boot time, unit startup times and failed units of the last boots and highlight the regressions of the current boot.",
+						InputSchema:  journal.CreateCompareBootsSchema(),
+						OutputSchema: safety.OutputSchema[journal.CompareBootsResult](),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						batch.AddTool(batchTools, server, tool, syslog.CompareBoots)
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "Follow log",
+						Name:         "follow_log",
+						Description:  "Wait for new log entries of a unit for some seconds or until a message matches a pattern, e.g. after a restart. The entries are streamed as progress notifications, or as log messages if the client didn't request progress, and returned at the end.",
+						InputSchema:  journal.CreateFollowLogSchema(),
+						OutputSchema: safety.OutputSchema[journal.FollowLogResult](),
+						Annotations:  &mcp.ToolAnnotations{ReadOnlyHint: true},
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, syslog.FollowLog)
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "Login failures",
+						Name:         "login_failures",
+						Description:  "Summarize the failed SSH and PAM logins of a time window by source address and by user with counts and first and last seen, marking sources banned by fail2ban and sources which also logged in successfully.",
+						InputSchema:  journal.CreateLoginFailuresSchema(),
+						OutputSchema: safety.OutputSchema[journal.LoginFailuresResult](),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						batch.AddTool(batchTools, server, tool, syslog.LoginFailures)
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "Log statistics",
+						Name:         "log_stats",
+						Description:  "Count the log messages of a time window per unit and per priority and report the disk usage of the journal, to find out which units flood the log without reading the entries.",
+						InputSchema:  journal.CreateLogStatsSchema(),
+						OutputSchema: safety.OutputSchema[journal.LogStatsResult](),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						batch.AddTool(batchTools, server, tool, syslog.LogStats)
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "Journal fields",
+						Name:         "journal_fields",
+						Description:  "List the unique values of a journal field, e.g. all SYSLOG_IDENTIFIER or _SYSTEMD_UNIT values, or without a field the names of the fields, to build correct filters for list_log.",
+						InputSchema:  journal.CreateJournalFieldsSchema(),
+						OutputSchema: safety.OutputSchema[journal.JournalFieldsResult](),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						batch.AddTool(batchTools, server, tool, syslog.JournalFields)
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "List coredumps",
+						Name:         "list_coredumps",
+						Description:  "List the crashes recorded by systemd-coredump, the newest first, with signal, executable, unit and time. Filter by unit or executable.",
+						InputSchema:  journal.CreateListCoredumpsSchema(),
+						OutputSchema: safety.OutputSchema[journal.ListCoredumpsResult](),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						batch.AddTool(batchTools, server, tool, syslog.ListCoredumps)
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "Get coredump info",
+						Name:         "get_coredump_info",
+						Description:  "Return the details of a crash listed by list_coredumps, like coredumpctl info, with the command line, the package and an excerpt of the backtrace.",
+						InputSchema:  journal.CreateGetCoredumpInfoSchema(),
+						OutputSchema: safety.OutputSchema[journal.CoredumpInfo](),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						batch.AddTool(batchTools, server, tool, syslog.GetCoredumpInfo)
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "Get audit log",
+						Name:         "get_audit_log",
+						Description:  "Return the recorded calls of the write tools with their arguments, caller, result and time, from the audit file or the journal.",
+						InputSchema:  audit.CreateGetAuditLogSchema(),
+						OutputSchema: safety.OutputSchema[audit.GetAuditLogResult](),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						batch.AddTool(batchTools, server, tool, auditLog.GetAuditLog)
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "Get content of file",
+						Name:         "get_file",
+						Description:  "Read a file from the system. Can show content and metadata. Supports pagination by lines or a byte range for large files, only the metadata of binary files is returned.",
+						InputSchema:  file.CreateFileSchema(),
+						OutputSchema: safety.OutputSchema[file.GetFileResult](),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						batch.AddTool(batchTools, server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *file.GetFileParams) (*mcp.CallToolResult, any, error) {
+							res, out, err := file.GetFile(ctx, req, args)
+							return res, out, err
+						})
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "Find files",
+						Name:         "find_files",
+						Description:  "Search the directory tree below a path for files by glob on the name, regular expression on the path or on the lines of the content, type, depth, modification time and size, e.g. all drop-ins setting MemoryMax. The matching lines are returned with the files.",
+						InputSchema:  file.CreateFindFilesSchema(),
+						OutputSchema: safety.OutputSchema[file.FindFilesResult](),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						batch.AddTool(batchTools, server, tool, file.FindFiles)
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "Search file contents",
+						Name:         "grep_files",
+						Description:  "Search the lines of the files below a path, or of all directories files can be read from, for a regular expression and return the matches with file, line number and the lines around them. The number of matches and the bytes read are limited.",
+						InputSchema:  file.CreateGrepFilesSchema(),
+						OutputSchema: safety.OutputSchema[file.GrepFilesResult](),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						batch.AddTool(batchTools, server, tool, file.GrepFiles)
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "Create or update file",
+						Name:         "put_file",
+						Description:  "Create or update a configuration file below the directories files can be written to, with the full content or a unified diff against the current content, exactly one of them or empty has to be given. The file is replaced atomically, an existing file is backed up with a timestamp first and keeps its owner and permissions. The last five backups of a file are kept.",
+						InputSchema:  file.CreatePutFileSchema(),
+						OutputSchema: safety.OutputSchema[file.PutFileResult](),
+						Annotations:  &mcp.ToolAnnotations{DestructiveHint: &notDestructive},
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, file.PutFile)
+					},
+				})
+			}
+			tpmStatus := tpm.TPM{
+				Auth: authorization,
+			}
+			storageInfo := storage.Storage{
+				Auth: authorization,
+			}
+			powerInfo := power.Power{
+				Auth: authorization,
+			}
+			logins := logind.Logind{
+				Auth: authorization,
+			}
+			resolver := resolved.Resolved{
+				Auth: authorization,
+			}
+			networkInfo := network.Network{
+				Auth: authorization,
+			}
+			machines := machine.Machines{
 				Auth: authorization,
 			}
-			if err != nil {
-				slog.Warn("couldn't open log, not adding journal tool", slog.Any("error", err))
-			} else {
+			sysUsers := sysusers.Sysusers{
+				Auth: authorization,
+			}
+			oomdInfo := oomd.Oomd{
+				Auth:   authorization,
+				Reader: &syslog,
+			}
+			if !hasNoauth && !hasController {
+				// temporary authorizations only exist with polkit
+				authorizations := polkit.Authorizations{
+					Auth: authorization,
+				}
 				tools = append(tools, struct {
 					Tool     *mcp.Tool
 					Register func(server *mcp.Server, tool *mcp.Tool)
 				}{
 					Tool: &mcp.Tool{
-						Title:       "List system log",
-						Name:        "list_log",
-						Description: "Get the last log entries for the given service or unit.",
-						InputSchema: journal.CreateListLogsSchema(),
+						Title:        "List temporary authorizations",
+						Name:         "list_authorizations",
+						Description:  "List the temporary polkit authorizations of the MCP actions, which polkit keeps for some minutes after the user authenticated, with the time they expire.",
+						InputSchema:  polkit.CreateListAuthorizationsSchema(),
+						OutputSchema: safety.OutputSchema[polkit.AuthorizationsResult](),
 					},
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
-						mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *journal.ListLogParams) (*mcp.CallToolResult, any, error) {
-							slog.Debug("list_log called", "args", args)
-							res, out, err := syslog.ListLog(ctx, req, args)
-							return res, out, err
-						})
+						batch.AddTool(batchTools, server, tool, authorizations.List)
 					},
 				}, struct {
 					Tool     *mcp.Tool
 					Register func(server *mcp.Server, tool *mcp.Tool)
 				}{
 					Tool: &mcp.Tool{
-						Title:       "Get content of file",
-						Name:        "get_file",
-						Description: "Read a file from the system. Can show content and metadata. Supports pagination for large files.",
-						InputSchema: file.CreateFileSchema(),
+						Title:        "Revoke temporary authorizations",
+						Name:         "revoke_authorizations",
+						Description:  "Revoke the temporary polkit authorization with the given id, or all of the MCP actions, so that the user is asked again for the next action.",
+						InputSchema:  polkit.CreateRevokeAuthorizationsSchema(),
+						OutputSchema: safety.OutputSchema[polkit.AuthorizationsResult](),
+						Annotations:  &mcp.ToolAnnotations{DestructiveHint: &notDestructive},
 					},
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
-						mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *file.GetFileParams) (*mcp.CallToolResult, any, error) {
-							slog.Debug("get_file called", "args", args)
-							res, out, err := file.GetFile(ctx, req, args)
-							return res, out, err
-						})
+						mcp.AddTool(server, tool, authorizations.Revoke)
+					},
+				})
+			}
+			if grants != nil {
+				tools = append(tools, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:        "Get authorization status",
+						Name:         "get_auth_status",
+						Description:  "Report the read and write authorizations granted to this session and the seconds they remain valid before they have to be authorized again.",
+						InputSchema:  authkeeper.CreateGetAuthStatusSchema(),
+						OutputSchema: safety.OutputSchema[authkeeper.AuthStatus](),
+						Annotations:  &mcp.ToolAnnotations{ReadOnlyHint: true},
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						batch.AddTool(batchTools, server, tool, grants.GetAuthStatus)
 					},
 				})
 			}
@@ -232,18 +1136,287 @@ func NewRootCmd() *cobra.Command {
 				Register func(server *mcp.Server, tool *mcp.Tool)
 			}{
 				Tool: &mcp.Tool{
-					Title:       "Display man page",
-					Name:        "get_man_page",
-					Description: "Retrieve a man page. Supports filtering by section and chapters, and pagination.",
-					InputSchema: man.CreateManPageSchema(),
+					Title:        "TPM and measured boot status",
+					Name:         "tpm_status",
+					Description:  "Report the TPM, the systemd-pcrlock policy and the TPM2 bound encrypted volumes, including whether their unlock policy survives the next update and reboot.",
+					InputSchema:  tpm.CreateTPMStatusSchema(),
+					OutputSchema: safety.OutputSchema[tpm.TPMStatusResult](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, tpmStatus.Status)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "Disk layout",
+					Name:         "disk_layout",
+					Description:  "List the block devices with their partitions, GPT labels and types, free space and the systemd-repart and growfs definitions.",
+					InputSchema:  storage.CreateDiskLayoutSchema(),
+					OutputSchema: safety.OutputSchema[storage.DiskLayoutResult](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, storageInfo.DiskLayout)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "Storage health",
+					Name:         "storage_health",
+					Description:  "Summarize the state of md RAID arrays, LVM volume groups and logical volumes and the SMART health of the disks together with the affected mount and swap units.",
+					InputSchema:  storage.CreateStorageHealthSchema(),
+					OutputSchema: safety.OutputSchema[storage.StorageHealthResult](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, storageInfo.StorageHealth)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "Power state",
+					Name:         "power_state",
+					Description:  "Report the AC and battery state, the thermal zones and if suspend and hibernation are configured or inhibited.",
+					InputSchema:  power.CreatePowerStateSchema(),
+					OutputSchema: safety.OutputSchema[power.PowerStateResult](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, powerInfo.State)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "List inhibitor locks",
+					Name:         "list_inhibitors",
+					Description:  "List the inhibitor locks of logind with who holds them, what they inhibit, why and whether they block or delay, to explain why a reboot or suspend is blocked before forcing it.",
+					InputSchema:  power.CreateListInhibitorsSchema(),
+					OutputSchema: safety.OutputSchema[power.ListInhibitorsResult](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, powerInfo.ListInhibitors)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "Power action",
+					Name:         "power_action",
+					Description:  "Reboot, power off, suspend or hibernate the host, or schedule a shutdown with a wall message to the logged in users. Requires confirm set to true and its own polkit authorization.",
+					InputSchema:  power.CreatePowerActionSchema(),
+					OutputSchema: safety.OutputSchema[util.Message](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, powerInfo.Action)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "Network status",
+					Name:         "network_status",
+					Description:  "Report the network links with their systemd-networkd state, addresses, routes and DHCP leases, like 'networkctl status --all'.",
+					InputSchema:  network.CreateNetworkStatusSchema(),
+					OutputSchema: safety.OutputSchema[network.NetworkStatusResult](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, networkInfo.Status)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "OOM daemon status",
+					Name:         "oomd_status",
+					Description:  "Report the cgroups systemd-oomd monitors with their limits and current memory pressure, the memory pressure of the system and the recent kills of systemd-oomd from the journal, to diagnose memory pressure incidents.",
+					InputSchema:  oomd.CreateOomdStatusSchema(),
+					OutputSchema: safety.OutputSchema[oomd.OomdStatusResult](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, oomdInfo.Status)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "DNS resolver status",
+					Name:         "resolved_status",
+					Description:  "Show the DNS servers and search domains of systemd-resolved, globally and per link, with the current server and the DNSSEC and DNS over TLS state, like 'resolvectl status'.",
+					InputSchema:  resolved.CreateResolvedStatusSchema(),
+					OutputSchema: safety.OutputSchema[resolved.ResolvedStatusResult](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, resolver.Status)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "DNS query",
+					Name:         "resolve_query",
+					Description:  "Resolve a host name to addresses or an address to host names with systemd-resolved, like 'resolvectl query', reporting the answering protocol, whether DNSSEC authenticated the answer and the time the query took.",
+					InputSchema:  resolved.CreateResolveQuerySchema(),
+					OutputSchema: safety.OutputSchema[resolved.ResolveQueryResult](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, resolver.Query)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "List machines",
+					Name:         "list_machines",
+					Description:  "List the containers and virtual machines registered with systemd-machined, like 'machinectl list', with their scope unit and machine id.",
+					InputSchema:  machine.CreateListMachinesSchema(),
+					OutputSchema: safety.OutputSchema[machine.ListMachinesResult](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, machines.ListMachines)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "Machine info",
+					Name:         "machine_info",
+					Description:  "Show a container or virtual machine of systemd-machined with its addresses and os release, like 'machinectl status'. Its unit can be inspected with the unit tools and its journal with list_log and the machine id.",
+					InputSchema:  machine.CreateMachineInfoSchema(),
+					OutputSchema: safety.OutputSchema[machine.Machine](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, machines.MachineInfo)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "List login sessions",
+					Name:         "list_sessions",
+					Description:  "List the login sessions of logind with their user, seat, tty, remote host, state and idle hint, together with the logged in users and the seats, to see who is logged in.",
+					InputSchema:  logind.CreateListSessionsSchema(),
+					OutputSchema: safety.OutputSchema[logind.ListSessionsResult](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, logins.ListSessions)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "Session details",
+					Name:         "session_info",
+					Description:  "Return the details of a login session from list_sessions, like 'loginctl session-status', including its leader process, scope and since when it is idle.",
+					InputSchema:  logind.CreateSessionInfoSchema(),
+					OutputSchema: safety.OutputSchema[logind.Session](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, logins.SessionInfo)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "Terminate a login session",
+					Name:         "terminate_session",
+					Description:  "Terminate a login session by killing all its processes, like 'loginctl terminate-session'.",
+					InputSchema:  logind.CreateTerminateSessionSchema(),
+					OutputSchema: safety.OutputSchema[util.Message](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, logins.TerminateSession)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "Lock a seat",
+					Name:         "lock_seat",
+					Description:  "Lock the screens of all sessions of a seat, like 'loginctl lock-session' for each of them.",
+					InputSchema:  logind.CreateLockSeatSchema(),
+					OutputSchema: safety.OutputSchema[util.Message](),
+					Annotations:  &mcp.ToolAnnotations{DestructiveHint: &notDestructive},
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, logins.LockSeat)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "List sysusers.d entries",
+					Name:         "list_sysusers",
+					Description:  "List the effective sysusers.d entries with the file declaring them and whether their user or group exists, to find the cause of 'user does not exist' failures of services.",
+					InputSchema:  sysusers.CreateListSysusersSchema(),
+					OutputSchema: safety.OutputSchema[sysusers.ListSysusersResult](),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					batch.AddTool(batchTools, server, tool, sysUsers.ListSysusers)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "Apply sysusers.d",
+					Name:         "apply_sysusers",
+					Description:  "Create the missing users and groups of the sysusers.d files with systemd-sysusers, optionally of only one file or as dry run. Existing users and groups are never changed.",
+					InputSchema:  sysusers.CreateApplySysusersSchema(),
+					OutputSchema: safety.OutputSchema[util.Message](),
+					Annotations:  &mcp.ToolAnnotations{DestructiveHint: &notDestructive},
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, sysUsers.ApplySysusers)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "Display man page",
+					Name:         "get_man_page",
+					Description:  "Retrieve a man page. Supports filtering by section and chapters, and pagination.",
+					InputSchema:  man.CreateManPageSchema(),
+					OutputSchema: safety.OutputSchema[man.ManPageResult](),
 				},
 				Register: func(server *mcp.Server, tool *mcp.Tool) {
-					mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *man.GetManPageParams) (*mcp.CallToolResult, any, error) {
-						slog.Debug("get_man_page called", "args", args)
+					batch.AddTool(batchTools, server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *man.GetManPageParams) (*mcp.CallToolResult, any, error) {
 						res, out, err := man.GetManPage(ctx, req, args)
 						return res, out, err
 					})
 				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:        "Batch read-only tools",
+					Name:         "batch",
+					Description:  "Call several read-only tools concurrently and return their combined results, e.g. unit status, logs and a file in one step.",
+					InputSchema:  batch.CreateBatchSchema(),
+					OutputSchema: safety.OutputSchema[batch.BatchResult](),
+					Annotations:  &mcp.ToolAnnotations{ReadOnlyHint: true},
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, batchTools.Call)
+				},
 			},
 			)
 
@@ -254,9 +1427,9 @@ func NewRootCmd() *cobra.Command {
 			if viper.GetBool("list-tools") {
 				if viper.GetBool("verbose") {
 					tb := tabby.New()
-					tb.AddHeader("TOOL", "DESCRIPTION")
+					tb.AddHeader("TOOL", "GROUP", "DESCRIPTION")
 					for _, tool := range tools {
-						tb.AddLine(tool.Tool.Name, tool.Tool.Description)
+						tb.AddLine(tool.Tool.Name, toolgroup.Of(tool.Tool.Name), tool.Tool.Description)
 					}
 					tb.Print()
 
@@ -265,45 +1438,216 @@ func NewRootCmd() *cobra.Command {
 				}
 				return nil
 			}
-			var enabledTools []string
-			if !cmd.Flags().Changed("enabled-tools") {
-				enabledTools = allTools
-			} else {
-				enabledTools = viper.GetStringSlice("enabled-tools")
+			enabledTools, err := toolgroup.Parse(viper.GetStringSlice("enabled-tools"))
+			if err != nil {
+				return err
+			}
+			// register the enabled tools, the results carry their safety
+			// classification and the write tools accept dry_run, the
+			// destructive calls have to be confirmed with a token
+			classifier := safety.New()
+			dryRun := dryrun.New(viper.GetBool("dry-run"), systemd.DryRunTools())
+			confirmer := confirm.New(confirm.DefaultTTL)
+			if viper.GetBool("confirm-destructive") {
+				confirmer.Require("change_unit_state", systemd.IsDestructiveChange)
+				confirmer.Require("apply_plan", systemd.IsDestructivePlan)
+				confirmer.Require("apply_state", systemd.IsDestructiveManifest)
+				confirmer.Require("switch_target", nil)
+				confirmer.Require("terminate_session", nil)
+				confirmer.Require("power_action", power.IsInterruptingAction)
 			}
-			// register the enabled tools
+			// the tools are registered before they are selected, as the
+			// read-only annotation of the batched tools is set on registration
+			var disabledTools []string
 			for _, tool := range tools {
-				if slices.Contains(enabledTools, tool.Tool.Name) {
-					tool.Register(server, tool.Tool)
+				dryRun.Add(tool.Tool)
+				confirmer.Add(tool.Tool)
+				tool.Register(server, tool.Tool)
+				if !enabledTools.Enabled(tool.Tool) {
+					disabledTools = append(disabledTools, tool.Tool.Name)
+					continue
+				}
+				classifier.Add(tool.Tool)
+				auditLog.Add(tool.Tool)
+			}
+			server.RemoveTools(disabledTools...)
+			batchTools.Remove(disabledTools...)
+			// local tools without MCP client call the read-only tools over
+			// dbus, the name may already be owned for the renewal
+			if viper.GetBool("dbus-api") {
+				apiConn := renewConn
+				var apiErr error
+				if apiConn == nil {
+					if apiConn, apiErr = dbusapi.Connect(DBusName); apiErr == nil {
+						defer apiConn.Close()
+					}
+				}
+				if apiErr == nil {
+					apiErr = dbusapi.New(batchTools, callDeadline).Export(apiConn, DBusPath)
+				}
+				if apiErr != nil {
+					slog.Warn("couldn't export the tools over dbus", slog.Any("error", apiErr))
+				}
+			}
+			classifier.SetDestructive("change_unit_state", systemd.IsDestructiveChange)
+			server.AddReceivingMiddleware(tracer.Middleware, serverMetrics.Middleware, reqlog.Middleware, callDeadline.Middleware, limiter.Middleware, classifier.Middleware, dryRun.Middleware, confirmer.Middleware, auditLog.Middleware, sessions.Middleware, authkeeper.ErrorMiddleware)
+			if pol != nil {
+				server.AddReceivingMiddleware(pol.Middleware)
+			}
+			if elicit != nil {
+				server.AddReceivingMiddleware(elicit.Middleware)
+			}
+			drain := newDrainer(server, drainTimeout)
+			if systemConn != nil {
+				go func() {
+					if err := systemConn.WatchUnitResources(ctx, server); err != nil {
+						slog.Warn("couldn't watch the units for resource subscriptions", slog.Any("error", err))
+					}
+				}()
+			}
+			if systemConn != nil && viper.GetDuration("property-ttl") > 0 {
+				go func() {
+					if err := systemConn.WatchPropertyCache(ctx); err != nil {
+						slog.Warn("couldn't watch the units for changed properties", slog.Any("error", err))
+					}
+				}()
+			}
+			if patterns := viper.GetStringSlice("watch-failed"); len(patterns) > 0 && systemConn != nil {
+				go func() {
+					if err := systemConn.WatchFailed(ctx, server, patterns); err != nil {
+						slog.Warn("couldn't watch for failed units", slog.Any("error", err))
+					}
+				}()
+			}
+
+			// as a service with WatchdogSec the watchdog is pinged as long as
+			// the manager answers
+			go notify.Watchdog(ctx, func(ctx context.Context) error {
+				if systemConn == nil {
+					return nil
+				}
+				return systemConn.Ping(ctx)
+			})
+			// the transports share the server and are served at the same
+			// time, when one of them ends, e.g. the stdio client
+			// disconnects, the others are stopped as well. The transports
+			// started before a failing one are stopped on return.
+			var serving sync.WaitGroup
+			defer serving.Wait()
+			serveCtx, stopServing := context.WithCancel(ctx)
+			defer stopServing()
+			serve := func(run func()) {
+				serving.Go(func() {
+					defer stopServing()
+					run()
+				})
+			}
+			go func() {
+				<-serveCtx.Done()
+				slog.Info("shutting down, waiting for the calls in flight", "timeout", drainTimeout)
+				notify.Stopping()
+			}()
+			// descriptions of the transports for systemctl status
+			var transports []string
+
+			if listen != "" {
+				l, err := listenUnix(strings.TrimPrefix(listen, "unix:"))
+				if err != nil {
+					return err
+				}
+				log.Print("MCP server listening on ", listen+mcpPath)
+				transports = append(transports, "http on "+listen)
+				s := unixServer(server)
+				serve(func() {
+					if err := drain.serve(serveCtx, s, func() error { return s.Serve(l) }); err != nil {
+						slog.Error("couldn't start unix socket server", "error", err)
+					}
+				})
+			}
+
+			if varlinkAddr != "" {
+				l, err := listenUnix(strings.TrimPrefix(varlinkAddr, "unix:"))
+				if err != nil {
+					return err
+				}
+				log.Print("MCP server listening for varlink on ", varlinkAddr)
+				transports = append(transports, "varlink on "+varlinkAddr)
+				vs := &varlink.Server{
+					Vendor:  "openSUSE",
+					Product: "systemd-mcp",
+					Version: strings.TrimSpace(version),
+					URL:     "https://github.com/openSUSE/systemd-mcp",
+					ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+						return authkeeper.PeerCredConnContext(authkeeper.WithTransport(ctx, authkeeper.TransportUnix), c)
+					},
+					Connect: func(ctx context.Context, rwc io.ReadWriteCloser) error {
+						_, err := server.Connect(ctx, &mcp.IOTransport{Reader: rwc, Writer: rwc}, nil)
+						return err
+					},
+				}
+				serve(func() {
+					if err := drain.serveListener(serveCtx, l, vs.Serve); err != nil {
+						slog.Error("couldn't serve varlink", "error", err)
+					}
+				})
+			}
+
+			if wsAddr := viper.GetString("ws"); wsAddr != "" {
+				// the websocket listener shares the server with the other
+				// transports and checks the same bearer tokens
+				websocket.AllowedOrigins = viper.GetStringSlice("ws-allowed-origins")
+				var wsHandler http.Handler = websocket.NewHandler(func(*http.Request) *mcp.Server {
+					return server
+				})
+				if !hasNoauth {
+					_, authMiddleware, err := requireBearerToken(bearerAuth)
+					if err != nil {
+						return err
+					}
+					// browsers pass the token as subprotocol
+					wsHandler = websocket.BearerFromProtocol(authMiddleware(wsHandler))
+				}
+				mux := http.NewServeMux()
+				mux.Handle(mcpPath, wsHandler)
+				s := &http.Server{
+					Addr:              wsAddr,
+					Handler:           mux,
+					TLSConfig:         serverTLS,
+					ReadHeaderTimeout: 3 * time.Second,
+					BaseContext:       transportContext(authkeeper.TransportHTTP),
 				}
+				log.Print("MCP websocket server listening on ", wsAddr+mcpPath)
+				transports = append(transports, "websocket on "+wsAddr)
+				serve(func() {
+					if err := drain.serve(serveCtx, s, listenAndServe(s)); err != nil {
+						slog.Error("couldn't start websocket server", "error", err)
+					}
+				})
 			}
 
 			if httpAddr := viper.GetString("http"); httpAddr != "" {
 				handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
 					return server
 				}, nil)
+				s := &http.Server{
+					Addr:              httpAddr,
+					TLSConfig:         serverTLS,
+					ReadHeaderTimeout: 3 * time.Second,
+					BaseContext:       transportContext(authkeeper.TransportHTTP),
+				}
 				if hasNoauth {
-					if viper.GetString("cert-file") == "" {
-						slog.Debug("MCP handler listening at", slog.String("address", httpAddr))
-						if err := http.ListenAndServe(httpAddr, handler); err != nil {
-							slog.Error("couldn't start http server", "error", err)
-						}
-					} else {
-						keyFile := viper.GetString("key-file")
-						certFile := viper.GetString("cert-file")
-						slog.Debug("MCP handler listening with TLS at", slog.String("address", httpAddr))
-						if err := http.ListenAndServeTLS(httpAddr, certFile, keyFile, handler); err != nil {
-							slog.Error("couldn't start tls http server", "error", err)
-						}
+					mux := http.NewServeMux()
+					mux.Handle("/", handler)
+					if serverMetrics != nil {
+						mux.Handle(metricsPath, serverMetrics)
 					}
+					s.Handler = mux
+					slog.Debug("MCP handler listening at", slog.String("address", httpAddr), slog.Bool("tls", viper.GetString("cert-file") != ""))
 				} else {
-					oauthProvider, ok := authorization.(authkeeper.OAuth2Provider)
-					if !ok {
-						return fmt.Errorf("authorization is not an OAuth2Provider")
+					oauthProvider, authMiddleware, err := requireBearerToken(bearerAuth)
+					if err != nil {
+						return err
 					}
-					authMiddleware := auth.RequireBearerToken(oauthProvider.VerifyJWT, &auth.RequireBearerTokenOptions{
-						Scopes: systemdScopes(),
-					})
 
 					loggingMiddleware := func(next http.Handler) http.Handler {
 						return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -317,6 +1661,11 @@ func NewRootCmd() *cobra.Command {
 					}
 
 					http.HandleFunc(mcpPath, loggingMiddleware(authMiddleware(handler)).ServeHTTP)
+					// scraped without bearer token like the metrics of other
+					// services
+					if serverMetrics != nil {
+						http.Handle(metricsPath, serverMetrics)
+					}
 					// handler for resourceMetaURL
 					// TODO: replace with https://github.com/modelcontextprotocol/go-sdk/pull/643 after it's merged
 					http.HandleFunc(remoteauth.DefaultProtectedResourceMetadataURI+mcpPath, func(w http.ResponseWriter, r *http.Request) {
@@ -337,55 +1686,248 @@ func NewRootCmd() *cobra.Command {
 					})
 
 					log.Print("MCP server listening on ", httpAddr+mcpPath)
-					s := &http.Server{
-						Addr:              httpAddr,
-						ReadHeaderTimeout: 3 * time.Second,
-					}
-					if viper.GetString("cert-file") == "" {
-						if err := s.ListenAndServe(); err != nil {
-							slog.Error("couldn't start http server", "error", err)
-						}
-					} else {
-						keyFile := viper.GetString("key-file")
-						certFile := viper.GetString("cert-file")
-						if err := s.ListenAndServeTLS(certFile, keyFile); err != nil {
-							slog.Error("couldn't start tls http server", "error", err)
-						}
-					}
 				}
-			} else {
+				transports = append(transports, "http on "+httpAddr)
+				serve(func() {
+					if err := drain.serve(serveCtx, s, listenAndServe(s)); err != nil {
+						slog.Error("couldn't start http server", "error", err)
+					}
+				})
+			}
+
+			if isStdio {
 				slog.Debug("New client has connected via stdin/stdout")
-				if err := server.Run(context.Background(), &mcp.StdioTransport{}); err != nil {
-					slog.Error("Server failed", slog.Any("error", err))
-				}
+				transports = append(transports, "stdio")
+				serve(func() {
+					if err := drain.run(authkeeper.WithTransport(serveCtx, authkeeper.TransportStdio), &mcp.StdioTransport{}); err != nil {
+						slog.Error("Server failed", slog.Any("error", err))
+					}
+				})
 			}
+			notify.Ready(transportStatus(transports))
+			serving.Wait()
 
 			return nil
 		},
 	}
 
+	rootCmd.Flags().String("config", DefaultConfigFile, "YAML file with the settings in the sections transport, auth, tools, units, files and journal, flags and environment variables take precedence")
+	rootCmd.Flags().Bool("check-config", false, "Check the config file and the settings and exit")
 	rootCmd.Flags().String("http", "", "if set, use streamable HTTP at this address, instead of stdin/stdout")
+	rootCmd.Flags().Bool("stdio", false, "Also serve stdin/stdout next to --http, --ws, --listen or --varlink, the stdio client is authorized by polkit, the server stops when it disconnects")
+	rootCmd.Flags().String("ws", "", "if set, also serve MCP over WebSocket at this address")
+	rootCmd.Flags().StringSlice("ws-allowed-origins", nil, "Origins of web pages, e.g. https://ui.example.com, which may open a WebSocket besides the ones of the server itself, * allows all")
+	rootCmd.Flags().String("listen", "", "if set, serve streamable HTTP on this unix socket, e.g. unix:/run/systemd-mcp.sock, the peers are authorized by their credentials")
+	rootCmd.Flags().StringSlice("listen-read", nil, "Users and groups, e.g. unix-user:alice or unix-group:wheel, which may read over the --listen socket, root and the user of the server always may")
+	rootCmd.Flags().StringSlice("listen-write", nil, "Users and groups which may read and write over the --listen socket")
+	rootCmd.Flags().String("varlink", "", "if set, serve MCP over varlink on this unix socket, e.g. unix:/run/systemd-mcp.varlink, the peers are authorized by their credentials like on --listen")
+	rootCmd.Flags().Duration("drain-timeout", 30*time.Second, "Time the tool calls in flight get to finish when the server is stopped")
 	rootCmd.Flags().Bool("skip-tls-verify", false, "Skip TLS certificate verification for outbound requests (e.g. to OAuth2 controller)")
 	rootCmd.Flags().String("logfile", "", "if set, log to this file instead of stderr")
 	rootCmd.Flags().String("controller", "", "oauth2 controller address")
+	rootCmd.Flags().String("audience", remoteauth.Audience, "Audience the bearer tokens of the controller have to be issued for")
+	rootCmd.Flags().Duration("token-leeway", remoteauth.DefaultLeeway, "Tolerated clock skew to the controller when checking the expiry of the bearer tokens")
 	rootCmd.Flags().BoolP("verbose", "v", false, "Enable verbose logging")
 	rootCmd.Flags().BoolP("debug", "d", false, "Enable debug logging")
 	rootCmd.Flags().Bool("log-json", false, "Output logs in JSON format (machine-readable)")
 	rootCmd.Flags().Bool("list-tools", false, "List all available tools and exit")
 	rootCmd.Flags().BoolP("allow-write", "w", false, "Authorize write to systemd or allow pending write if started without write")
+	rootCmd.Flags().Duration("auth-ttl", 0, "Keep the read and write authorizations granted to a session for this time, e.g. 15m, 0 authorizes every call")
+	rootCmd.Flags().Bool("dry-run", false, "Only describe what the write tools would do instead of doing it, as if every call had dry_run set")
+	rootCmd.Flags().Bool("confirm-destructive", true, "Perform stop, disable, isolate, terminate and power actions only when the call is reissued with the confirmation token returned by the first call")
+	rootCmd.Flags().Bool("elicit-approval", true, "Ask the user of the client to approve the write calls polkit refused, if the client supports elicitation")
 	rootCmd.Flags().BoolP("allow-read", "r", false, "Authorize read to systemd or allow pending read if started without read")
-	rootCmd.Flags().StringSlice("enabled-tools", nil, "A list of tools to enable. Defaults to all tools.")
+	rootCmd.Flags().StringSlice("enabled-tools", nil, fmt.Sprintf("A list of tools and tool groups (%s), optionally as GROUP:read or GROUP:write, to enable. Defaults to all tools.", strings.Join(toolgroup.Names(), ", ")))
 	rootCmd.Flags().Uint32("timeout", 5, "Set the timeout for authentication in seconds")
 	rootCmd.Flags().String("noauth", "", fmt.Sprintf("Disable authorization via dbus/oauth2, this parameter has to be set to %s to work.", magicNoauth))
-	rootCmd.Flags().String("cert-file", "", "Path to server certificate file (PEM format) for TLS. Requires --key-file")
-	rootCmd.Flags().String("key-file", "", "Path to server private key file (PEM format) for TLS. Requires --cert-file")
+	rootCmd.Flags().Bool("detect-language", false, "Tag unit descriptions and log messages with their detected language")
+	rootCmd.Flags().String("translate-cmd", "", "Command which translates descriptions and log messages not in the target language, gets the text on stdin and SOURCE_LANG/TARGET_LANG in the environment. Implies --detect-language")
+	rootCmd.Flags().String("translate-to", "en", "Target language of --translate-cmd")
+	rootCmd.Flags().String("journal-gateway", "", "URL of a systemd-journal-gatewayd, e.g. http://loghost:19531, from which list_log reads the logs of remote hosts")
+	rootCmd.Flags().StringSlice("journal-remote", nil, "URLs of the systemd-journal-gatewayd of fleet members, e.g. http://web1:19531 or web1=http://10.0.0.5:19531, whose logs list_log reads with host set to the member")
+	rootCmd.Flags().String("remote-journal-dir", "/var/log/journal/remote", "Directory with the journals received by systemd-journal-remote, used for remote hosts without --journal-gateway")
+	rootCmd.Flags().String("policy-file", "", "YAML or JSON file with rules which allow, deny or ask for the calls of tools by unit and action, e.g. allow restarting nginx.service but never stopping sshd.service")
+	rootCmd.Flags().StringSlice("allowed-units", nil, "Glob patterns of the only units the tools may list, change, read the logs and files of, e.g. 'nginx*.service', also allowed_units in the policy file")
+	rootCmd.Flags().StringSlice("denied-units", nil, "Glob patterns of units the tools never list, change, read the logs and files of, take precedence over --allowed-units, also denied_units in the policy file")
+	rootCmd.Flags().StringSlice("file-roots", file.DefaultRoots, "Directories below which get_file, find_files and grep_files may read after resolving the symlinks, / allows all files")
+	rootCmd.Flags().StringSlice("file-write-roots", file.DefaultWriteRoots, "Directories below which put_file may write after resolving the symlinks, the files have to be below --file-roots too")
+	rootCmd.Flags().Int("journal-max-entries", 0, "Maximal number of entries list_log returns per call, 0 for no limit")
+	rootCmd.Flags().String("audit-file", "", "if set, also append the audit records of the write tool calls as JSON lines to this file")
+	rootCmd.Flags().String("owners-file", systemd.OwnersPath, "YAML file mapping unit patterns to the owning team, contact and runbook, reported with failed_units, why_not_running and show_unit")
+	rootCmd.Flags().Int("restart-limit", systemd.RestartLimit, "Number of starts, stops and restarts of a unit within --restart-window after which change_unit_state requires override, 0 disables the limit")
+	rootCmd.Flags().Duration("restart-window", systemd.RestartWindow, "Window of --restart-limit")
+	rootCmd.Flags().Int("max-result-size", systemd.DefaultMaxResultSize, "Size in bytes above which the listing of list_loaded_units is cut into pages with a continuation token, 0 never cuts it")
+	rootCmd.Flags().Duration("property-ttl", systemd.DefaultPropertyTTL, "Reuse the properties of the units list_loaded_units fetched for this time unless systemd signals a change, 0 disables the cache")
+	rootCmd.Flags().Bool("per-item-content", false, "Return the entries of list_loaded_units, list_unit_files and change_unit_state as one text block each instead of a single JSON object with items and count")
+	rootCmd.Flags().StringSlice("watch-failed", nil, "Send a log message to the connected clients when a unit matching these patterns fails, use '*' for all units")
+	rootCmd.Flags().Float64("rate-limit", 5, "Calls per second each session may make of a tool, 0 disables the limit")
+	rootCmd.Flags().Int("rate-burst", 10, "Calls of a tool a session may make at once before --rate-limit applies")
+	rootCmd.Flags().StringSlice("tool-rate-limit", nil, "Calls per second of single tools as TOOL=RATE, e.g. list_units=0.5, overriding --rate-limit")
+	rootCmd.Flags().Int("max-concurrent-dbus-calls", 8, "Tool calls of all sessions which may query dbus or the journal at the same time, further calls wait, 0 disables the limit")
+	rootCmd.Flags().Duration("call-timeout", deadline.DefaultTimeout, "Time a tool call gets for its dbus and journal operations before it fails, 0 disables the timeout")
+	rootCmd.Flags().StringSlice("tool-call-timeout", nil, "Timeouts of single tools as TOOL=DURATION, e.g. list_log=1m, overriding --call-timeout")
+	rootCmd.Flags().Bool("dbus-api", false, "Also export the read-only tools as methods of the dbus interface "+dbusapi.Interface+" under "+DBusName)
+	rootCmd.Flags().Bool("metrics", false, "Serve counters of the tool calls, errors and refused authorizations, the dbus latency and the journal read volume in the Prometheus format at /metrics of the --http listener")
+	rootCmd.Flags().String("otlp-endpoint", "", "if set, export spans of the tool calls and their dbus calls with OTLP/HTTP to this collector, e.g. http://collector:4318")
+	rootCmd.Flags().StringSlice("otlp-header", nil, "Headers of the requests to the --otlp-endpoint as KEY=VALUE, e.g. Authorization=Bearer TOKEN")
+	rootCmd.Flags().Bool("check-drift", false, "Compare the host against the stored baseline, print the deviations and exit, e.g. from a timer")
+	rootCmd.Flags().String("cert-file", "", "Path to server certificate file (PEM format) for TLS, also --tls-cert. Requires --key-file")
+	rootCmd.Flags().String("key-file", "", "Path to server private key file (PEM format) for TLS, also --tls-key. Requires --cert-file")
+	rootCmd.Flags().String("tls-client-ca", "", "Path to CA certificates (PEM format) which have to sign the client certificates of the http and websocket transports, enables mutual TLS. Requires --tls-cert")
+	rootCmd.Flags().SetNormalizeFunc(tlsFlagAliases)
 
 	rootCmd.MarkFlagsRequiredTogether("cert-file", "key-file")
 	rootCmd.MarkFlagsMutuallyExclusive("noauth", "controller")
+	rootCmd.MarkFlagsMutuallyExclusive("dbus-api", "controller")
 
 	return rootCmd
 }
 
+// listenAndServe serves with TLS if a certificate is configured
+func listenAndServe(s *http.Server) func() error {
+	return func() error {
+		if viper.GetString("cert-file") == "" {
+			return s.ListenAndServe()
+		}
+		return s.ListenAndServeTLS(viper.GetString("cert-file"), viper.GetString("key-file"))
+	}
+}
+
+// transportStatus describes the transports for systemctl status
+func transportStatus(transports []string) string {
+	switch len(transports) {
+	case 0:
+		return "serving MCP over stdio"
+	case 1:
+		return "serving MCP over " + transports[0]
+	}
+	return "serving MCP over " + strings.Join(transports[:len(transports)-1], ", ") + " and " + transports[len(transports)-1]
+}
+
+// transportContext tags the requests of an http server with the transport,
+// which selects their authorization
+func transportContext(transport string) func(net.Listener) context.Context {
+	return func(net.Listener) context.Context {
+		return authkeeper.WithTransport(context.Background(), transport)
+	}
+}
+
+// listenUnix listens on the unix socket, a socket left over by a previous
+// run is replaced. The peers are authorized by their credentials, so every
+// user may connect.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("%s exists and isn't a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0666); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// unixServer serves the streamable http handler with the credentials of the
+// peer in the context of the requests
+func unixServer(server *mcp.Server) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(mcpPath, mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+		return server
+	}, nil))
+	return &http.Server{
+		Handler:           mux,
+		BaseContext:       transportContext(authkeeper.TransportUnix),
+		ConnContext:       authkeeper.PeerCredConnContext,
+		ReadHeaderTimeout: 3 * time.Second,
+	}
+}
+
+// tlsFlagAliases maps the names of the mutual TLS flags to the ones of the
+// server certificate
+func tlsFlagAliases(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	switch name {
+	case "tls-cert":
+		name = "cert-file"
+	case "tls-key":
+		name = "key-file"
+	}
+	return pflag.NormalizedName(name)
+}
+
+// clientTLSConfig returns the TLS configuration which requires client
+// certificates signed by the CAs in the file, nil without file
+func clientTLSConfig(caFile string) (*tls.Config, error) {
+	if caFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// requireBearerToken returns the middleware which checks the OAuth2 bearer
+// tokens of the http and websocket requests
+func requireBearerToken(authorization authkeeper.AuthKeeper) (authkeeper.OAuth2Provider, func(http.Handler) http.Handler, error) {
+	oauthProvider, ok := authorization.(authkeeper.OAuth2Provider)
+	if !ok {
+		return nil, nil, fmt.Errorf("authorization is not an OAuth2Provider")
+	}
+	return oauthProvider, oauthProvider.Middleware(systemdScopes()), nil
+}
+
+// shortValue keeps the content of drop-ins on a single table line
+func shortValue(val string) string {
+	val = strings.ReplaceAll(strings.TrimSpace(val), "\n", "\\n")
+	if len(val) > 40 {
+		return val[:37] + "..."
+	}
+	return val
+}
+
+// checkDrift logs the deviations from the stored baseline and fails if
+// there are any, so that the drift shows up as failed unit when run by the
+// timer
+func checkDrift(ctx context.Context, conn *systemd.Connection) error {
+	baseline, err := systemd.ReadBaseline()
+	if err != nil {
+		return err
+	}
+	deviations, err := conn.Drift(ctx, baseline, nil)
+	if err != nil {
+		return err
+	}
+	if len(deviations) == 0 {
+		fmt.Println("no drift from baseline", systemd.BaselinePath)
+		return nil
+	}
+	tb := tabby.New()
+	tb.AddHeader("SEVERITY", "KIND", "TARGET", "BASELINE", "CURRENT")
+	for _, dev := range deviations {
+		slog.Warn("drift from baseline", "severity", dev.Severity, "kind", dev.Kind, "target", dev.Target)
+		tb.AddLine(dev.Severity, dev.Kind, dev.Target, shortValue(dev.Baseline), shortValue(dev.Current))
+	}
+	tb.Print()
+	return fmt.Errorf("found %d deviations from baseline %s", len(deviations), systemd.BaselinePath)
+}
+
 func main() {
 	rootCmd := NewRootCmd()
 	if err := rootCmd.Execute(); err != nil {
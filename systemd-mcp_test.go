@@ -2,8 +2,32 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
 )
 
 func TestCLIInvalidOptions(t *testing.T) {
@@ -22,6 +46,26 @@ func TestCLIInvalidOptions(t *testing.T) {
 			args:     []string{"--key-file=key.pem"},
 			expected: "if any flags in the group [cert-file key-file] are set they must all be set",
 		},
+		{
+			name:     "tls-cert alias missing tls-key",
+			args:     []string{"--tls-cert=cert.pem"},
+			expected: "if any flags in the group [cert-file key-file] are set they must all be set",
+		},
+		{
+			name:     "listen without unix socket",
+			args:     []string{"--listen=:8080"},
+			expected: "invalid --listen :8080, use unix:PATH",
+		},
+		{
+			name:     "listen and http without authorization of http",
+			args:     []string{"--listen=unix:/tmp/mcp.sock", "--http=:8080"},
+			expected: "http mode requires either --controller or --noauth=ThisIsInsecure",
+		},
+		{
+			name:     "tls-client-ca missing tls-cert",
+			args:     []string{"--tls-client-ca=ca.pem"},
+			expected: "--tls-client-ca requires --tls-cert and --tls-key",
+		},
 		{
 			name:     "mutually exclusive noauth and controller",
 			args:     []string{"--noauth=ThisIsInsecure", "--controller=http://localhost"},
@@ -32,6 +76,11 @@ func TestCLIInvalidOptions(t *testing.T) {
 			args:     []string{"--http=:8080"},
 			expected: "http mode requires either --controller or --noauth",
 		},
+		{
+			name:     "websocket mode missing auth configuration",
+			args:     []string{"--ws=:8081"},
+			expected: "http mode requires either --controller or --noauth",
+		},
 	}
 
 	for _, tt := range tests {
@@ -58,3 +107,255 @@ func TestCLIInvalidOptions(t *testing.T) {
 		})
 	}
 }
+
+// newCert creates a certificate signed by the parent, self-signed without
+// parent
+func newCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestClientTLSConfig(t *testing.T) {
+	if config, err := clientTLSConfig(""); config != nil || err != nil {
+		t.Fatalf("expected no config without client CA, got %v, %v", config, err)
+	}
+	dir := t.TempDir()
+	if _, err := clientTLSConfig(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Fatal("expected error for missing CA file")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "empty.pem"), []byte("no pem"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clientTLSConfig(filepath.Join(dir, "empty.pem")); err == nil {
+		t.Fatal("expected error for CA file without certificates")
+	}
+
+	ca, caKey := newCert(t, "client ca", nil, nil)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := clientTLSConfig(caFile)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = config
+	srv.StartTLS()
+	defer srv.Close()
+
+	// without client certificate the handshake fails
+	if resp, err := srv.Client().Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected request without client certificate to fail")
+	}
+
+	client := srv.Client()
+	transport := client.Transport.(*http.Transport)
+	for _, tt := range []struct {
+		name  string
+		valid bool
+	}{{"signed by the client ca", true}, {"self-signed", false}} {
+		var cert *x509.Certificate
+		var key *ecdsa.PrivateKey
+		if tt.valid {
+			cert, key = newCert(t, "client", ca, caKey)
+		} else {
+			cert, key = newCert(t, "client", nil, nil)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}
+		transport.CloseIdleConnections()
+		resp, err := client.Get(srv.URL)
+		if tt.valid {
+			if err != nil {
+				t.Fatalf("%s: expected request to succeed, got %v", tt.name, err)
+			}
+			resp.Body.Close()
+		} else if err == nil {
+			resp.Body.Close()
+			t.Fatalf("%s: expected request to fail", tt.name)
+		}
+	}
+}
+
+func TestUnixServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.sock")
+	// a socket left over by a previous run is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	l, err := listenUnix(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0666 {
+		t.Errorf("expected socket accessible by everyone, got %v, %v", info, err)
+	}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "whoami"}, func(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
+		cred, ok := authkeeper.PeerCredFromContext(ctx)
+		if !ok {
+			return nil, nil, fmt.Errorf("no peer credentials")
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprint(cred.UID)}}}, nil, nil
+	})
+	s := unixServer(server)
+	go s.Serve(l)
+	defer s.Close()
+
+	transport := &mcp.StreamableClientTransport{
+		Endpoint: "http://localhost" + mcpPath,
+		HTTPClient: &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}},
+		DisableStandaloneSSE: true,
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil)
+	session, err := client.Connect(context.Background(), transport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer session.Close()
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "whoami"})
+	if err != nil {
+		t.Fatalf("failed to call tool: %v", err)
+	}
+	if res.IsError || res.Content[0].(*mcp.TextContent).Text != fmt.Sprint(os.Getuid()) {
+		t.Errorf("expected uid %d, got %+v", os.Getuid(), res.Content[0])
+	}
+
+	// other files are kept
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenUnix(file); err == nil {
+		t.Error("expected error for a path which isn't a socket")
+	}
+}
+
+func TestTransportStatus(t *testing.T) {
+	tests := map[string][]string{
+		"serving MCP over stdio":                             nil,
+		"serving MCP over http on :8080":                     {"http on :8080"},
+		"serving MCP over http on :8080 and websocket on :8081": {"http on :8080", "websocket on :8081"},
+		"serving MCP over http on :8080, varlink on unix:/run/mcp and stdio": {"http on :8080", "varlink on unix:/run/mcp", "stdio"},
+	}
+	for want, transports := range tests {
+		if got := transportStatus(transports); got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+}
+
+// registeredTools returns the names of the tools registered in main and
+// whether they are read-only, read from the source as most tools are only
+// added with a connection to dbus
+func registeredTools(t *testing.T) map[string]bool {
+	file, err := parser.ParseFile(token.NewFileSet(), "systemd-mcp.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+		fields := make(map[string]ast.Expr)
+		for _, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				if key, ok := kv.Key.(*ast.Ident); ok {
+					fields[key.Name] = kv.Value
+				}
+			}
+		}
+		tool, register := fields["Tool"], fields["Register"]
+		if tool == nil || register == nil {
+			return true
+		}
+		var name string
+		readOnly := false
+		ast.Inspect(tool, func(n ast.Node) bool {
+			if kv, ok := n.(*ast.KeyValueExpr); ok {
+				switch key := kv.Key.(*ast.Ident); {
+				case key == nil:
+				case key.Name == "Name":
+					if val, ok := kv.Value.(*ast.BasicLit); ok {
+						name, _ = strconv.Unquote(val.Value)
+					}
+				case key.Name == "ReadOnlyHint":
+					if val, ok := kv.Value.(*ast.Ident); ok && val.Name == "true" {
+						readOnly = true
+					}
+				}
+			}
+			return true
+		})
+		// batch.AddTool marks the tool as read-only
+		ast.Inspect(register, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok && sel.Sel.Name == "AddTool" {
+				if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "batch" {
+					readOnly = true
+				}
+			}
+			return true
+		})
+		if name != "" {
+			tools[name] = readOnly
+		}
+		return false
+	})
+	return tools
+}
+
+func TestDryRunTools(t *testing.T) {
+	tools := registeredTools(t)
+	if readOnly, ok := tools["change_unit_state"]; !ok || readOnly {
+		t.Fatalf("change_unit_state not found as write tool in systemd-mcp.go: %v", tools)
+	}
+	if readOnly := tools["list_log"]; !readOnly {
+		t.Fatalf("list_log not found as read-only tool in systemd-mcp.go: %v", tools)
+	}
+	dryRunTools := systemd.DryRunTools()
+	for name, readOnly := range tools {
+		if readOnly {
+			continue
+		}
+		if _, ok := dryRunTools[name]; !ok {
+			t.Errorf("write tool %s isn't intercepted by the dry run", name)
+		}
+	}
+}